@@ -36,9 +36,12 @@ import (
 	"github.com/siglens/siglens/pkg/config"
 	commonconfig "github.com/siglens/siglens/pkg/config/common"
 	"github.com/siglens/siglens/pkg/dashboards"
+	"github.com/siglens/siglens/pkg/fluentforward"
+	"github.com/siglens/siglens/pkg/graphite"
 	"github.com/siglens/siglens/pkg/hooks"
 	"github.com/siglens/siglens/pkg/instrumentation"
 	"github.com/siglens/siglens/pkg/localnodeid"
+	"github.com/siglens/siglens/pkg/otlp"
 	"github.com/siglens/siglens/pkg/querytracker"
 	"github.com/siglens/siglens/pkg/retention"
 	"github.com/siglens/siglens/pkg/scroll"
@@ -51,6 +54,8 @@ import (
 	ingestserver "github.com/siglens/siglens/pkg/server/ingest"
 	queryserver "github.com/siglens/siglens/pkg/server/query"
 	"github.com/siglens/siglens/pkg/ssa"
+	"github.com/siglens/siglens/pkg/statsd"
+	"github.com/siglens/siglens/pkg/syslog"
 	"github.com/siglens/siglens/pkg/usageStats"
 	usq "github.com/siglens/siglens/pkg/usersavedqueries"
 	"github.com/siglens/siglens/pkg/utils"
@@ -289,6 +294,17 @@ func StartSiglensServer(nodeType commonconfig.DeploymentType, nodeID string) err
 
 	if ingestNode {
 		startIngestServer(ingestServer)
+		if config.GetOTLPGrpcPort() != 0 {
+			startOTLPGrpcServer(fmt.Sprint(config.GetIngestListenIP()) + ":" + fmt.Sprintf("%d", config.GetOTLPGrpcPort()))
+		}
+		startSyslogServers()
+		startGraphiteServers()
+		if config.GetFluentForwardPort() != 0 {
+			startFluentForwardServer(fmt.Sprint(config.GetIngestListenIP()) + ":" + fmt.Sprintf("%d", config.GetFluentForwardPort()))
+		}
+		if config.GetStatsdPort() != 0 {
+			startStatsdServer(fmt.Sprint(config.GetIngestListenIP()) + ":" + fmt.Sprintf("%d", config.GetStatsdPort()))
+		}
 	}
 	if queryNode {
 		startQueryServer(queryServer)
@@ -354,6 +370,155 @@ func startIngestServer(serverAddr string) {
 	}()
 }
 
+// The receivers that listen on their own ports ingest everything for org 0
+// without running the ingest hook, so they would bypass tenant routing. They
+// are only started when no hook overrides ingest requests.
+func isSingleTenantIngest() bool {
+	return hooks.GlobalHooks.OverrideIngestRequestHook == nil
+}
+
+func startOTLPGrpcServer(serverAddr string) {
+	if !isSingleTenantIngest() {
+		log.Errorf("startOTLPGrpcServer: not starting the OTLP gRPC receiver; it only supports single-tenant deployments")
+		return
+	}
+
+	siglensStartupLog := fmt.Sprintf("----- Siglens OTLP gRPC receiver starting on %s ----- \n", serverAddr)
+	if config.GetLogPrefix() != "" {
+		StdOutLogger.Infof(siglensStartupLog)
+	}
+	log.Infof(siglensStartupLog)
+	go func() {
+		err := otlp.RunGrpcServer(serverAddr)
+		if err != nil {
+			StdOutLogger.Errorf("Failed to start OTLP gRPC receiver: %v", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+func startSyslogServers() {
+	type syslogServer struct {
+		protocol string
+		port     uint64
+		run      func(addr string, indexName string) error
+	}
+
+	if !isSingleTenantIngest() {
+		log.Errorf("startSyslogServers: not starting the syslog receivers; they only support single-tenant deployments")
+		return
+	}
+
+	indexName := config.GetSyslogIndexName()
+	for _, server := range []syslogServer{
+		{protocol: "TCP", port: config.GetSyslogTCPPort(), run: syslog.RunTCPServer},
+		{protocol: "UDP", port: config.GetSyslogUDPPort(), run: syslog.RunUDPServer},
+	} {
+		if server.port == 0 {
+			continue
+		}
+
+		serverAddr := fmt.Sprint(config.GetIngestListenIP()) + ":" + fmt.Sprintf("%d", server.port)
+		siglensStartupLog := fmt.Sprintf("----- Siglens syslog %s receiver starting on %s for index %s ----- \n", server.protocol, serverAddr, indexName)
+		if config.GetLogPrefix() != "" {
+			StdOutLogger.Infof(siglensStartupLog)
+		}
+		log.Infof(siglensStartupLog)
+
+		server := server
+		go func() {
+			err := server.run(serverAddr, indexName)
+			if err != nil {
+				StdOutLogger.Errorf("Failed to start syslog %s receiver: %v", server.protocol, err)
+				os.Exit(1)
+			}
+		}()
+	}
+}
+
+func startGraphiteServers() {
+	type graphiteServer struct {
+		protocol string
+		port     uint64
+		run      func(addr string, templates []string) error
+	}
+
+	if !isSingleTenantIngest() {
+		log.Errorf("startGraphiteServers: not starting the Graphite receivers; they only support single-tenant deployments")
+		return
+	}
+
+	templates := config.GetGraphiteTemplates()
+	for _, server := range []graphiteServer{
+		{protocol: "plaintext TCP", port: config.GetGraphiteTCPPort(), run: graphite.RunTCPServer},
+		{protocol: "plaintext UDP", port: config.GetGraphiteUDPPort(), run: graphite.RunUDPServer},
+		{protocol: "pickle", port: config.GetGraphitePicklePort(), run: graphite.RunPickleServer},
+	} {
+		if server.port == 0 {
+			continue
+		}
+
+		serverAddr := fmt.Sprint(config.GetIngestListenIP()) + ":" + fmt.Sprintf("%d", server.port)
+		siglensStartupLog := fmt.Sprintf("----- Siglens Graphite %s receiver starting on %s ----- \n", server.protocol, serverAddr)
+		if config.GetLogPrefix() != "" {
+			StdOutLogger.Infof(siglensStartupLog)
+		}
+		log.Infof(siglensStartupLog)
+
+		server := server
+		go func() {
+			err := server.run(serverAddr, templates)
+			if err != nil {
+				StdOutLogger.Errorf("Failed to start Graphite %s receiver: %v", server.protocol, err)
+				os.Exit(1)
+			}
+		}()
+	}
+}
+
+func startFluentForwardServer(serverAddr string) {
+	if !isSingleTenantIngest() {
+		log.Errorf("startFluentForwardServer: not starting the Fluent Forward receiver; it only supports single-tenant deployments")
+		return
+	}
+
+	indexName := config.GetFluentForwardIndexName()
+	siglensStartupLog := fmt.Sprintf("----- Siglens Fluent Forward receiver starting on %s for default index %s ----- \n", serverAddr, indexName)
+	if config.GetLogPrefix() != "" {
+		StdOutLogger.Infof(siglensStartupLog)
+	}
+	log.Infof(siglensStartupLog)
+
+	go func() {
+		err := fluentforward.RunServer(serverAddr, indexName, config.GetFluentForwardTagRules())
+		if err != nil {
+			StdOutLogger.Errorf("Failed to start Fluent Forward receiver: %v", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+func startStatsdServer(serverAddr string) {
+	if !isSingleTenantIngest() {
+		log.Errorf("startStatsdServer: not starting the StatsD receiver; it only supports single-tenant deployments")
+		return
+	}
+
+	siglensStartupLog := fmt.Sprintf("----- Siglens StatsD receiver starting on %s ----- \n", serverAddr)
+	if config.GetLogPrefix() != "" {
+		StdOutLogger.Infof(siglensStartupLog)
+	}
+	log.Infof(siglensStartupLog)
+
+	go func() {
+		err := statsd.RunServer(serverAddr, config.GetStatsdFlushInterval(), config.GetStatsdPercentiles())
+		if err != nil {
+			StdOutLogger.Errorf("Failed to start StatsD receiver: %v", err)
+			os.Exit(1)
+		}
+	}()
+}
+
 func startQueryServer(serverAddr string) {
 	siglensStartupLog := fmt.Sprintf("----- Siglens Query server starting on %s ----- \n", serverAddr)
 	siglensUIStartupLog := fmt.Sprintf("----- Siglens UI starting on %s ----- \n", serverAddr)
@@ -0,0 +1,125 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package startup
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/grpc"
+	"github.com/siglens/siglens/pkg/hooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func setOverrideIngestRequestHookForTest(t *testing.T) {
+	t.Helper()
+
+	hooks.GlobalHooks.OverrideIngestRequestHook = func(ctx *fasthttp.RequestCtx, myid uint64,
+		ingestFunc grpc.IngestFuncEnum, useIngestHook bool) bool {
+		return false
+	}
+	t.Cleanup(func() { hooks.GlobalHooks.OverrideIngestRequestHook = nil })
+}
+
+func getFreePort(t *testing.T) uint64 {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, listener.Close())
+
+	return uint64(port)
+}
+
+// Fails if a receiver was started on the port.
+func assertPortNotUsed(t *testing.T, network string, port uint64) {
+	t.Helper()
+
+	// Give a receiver that was wrongly started time to bind the port.
+	time.Sleep(100 * time.Millisecond)
+
+	addr := fmt.Sprintf("0.0.0.0:%d", port)
+	switch network {
+	case "tcp":
+		listener, err := net.Listen(network, addr)
+		assert.NoError(t, err)
+		if err == nil {
+			assert.NoError(t, listener.Close())
+		}
+	case "udp":
+		conn, err := net.ListenPacket(network, addr)
+		assert.NoError(t, err)
+		if err == nil {
+			assert.NoError(t, conn.Close())
+		}
+	}
+}
+
+func Test_StartSyslogServers_MultiTenant(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir())
+	setOverrideIngestRequestHookForTest(t)
+
+	tcpPort := getFreePort(t)
+	udpPort := getFreePort(t)
+	config.GetRunningConfig().Syslog.TCPPort = tcpPort
+	config.GetRunningConfig().Syslog.UDPPort = udpPort
+
+	startSyslogServers()
+	assertPortNotUsed(t, "tcp", tcpPort)
+	assertPortNotUsed(t, "udp", udpPort)
+}
+
+func Test_StartFluentForwardServer_MultiTenant(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir())
+	setOverrideIngestRequestHookForTest(t)
+
+	port := getFreePort(t)
+	startFluentForwardServer(fmt.Sprintf("0.0.0.0:%d", port))
+	assertPortNotUsed(t, "tcp", port)
+}
+
+func Test_StartStatsdServer_MultiTenant(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir())
+	setOverrideIngestRequestHookForTest(t)
+
+	port := getFreePort(t)
+	startStatsdServer(fmt.Sprintf("0.0.0.0:%d", port))
+	assertPortNotUsed(t, "udp", port)
+}
+
+func Test_StartGraphiteServers_MultiTenant(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir())
+	setOverrideIngestRequestHookForTest(t)
+
+	tcpPort := getFreePort(t)
+	udpPort := getFreePort(t)
+	picklePort := getFreePort(t)
+	config.GetRunningConfig().Graphite.TCPPort = tcpPort
+	config.GetRunningConfig().Graphite.UDPPort = udpPort
+	config.GetRunningConfig().Graphite.PicklePort = picklePort
+
+	startGraphiteServers()
+	assertPortNotUsed(t, "tcp", tcpPort)
+	assertPortNotUsed(t, "udp", udpPort)
+	assertPortNotUsed(t, "tcp", picklePort)
+}
@@ -57,109 +57,523 @@ func getParseError(err error) error {
 	return err
 }
 
+// Columns that Loki ingestion stores every log line in.
+const (
+	lineColumn      = "line"
+	timestampColumn = "timestamp"
+	errorLabel      = "__error__"
+)
+
+// The key that Promtail's pack stage stores the original log line under.
+const packedEntryKey = "_entry"
+
+// A stage of a LogQL log pipeline; either a line or label filter, or the
+// aggregators for a parser or formatting expression.
+type logStage struct {
+	filter *ast.Node
+	aggs   *structs.QueryAggregators
+
+	// Set for stages whose output only exists in the records returned by the
+	// search, so the filters after them can't be searched for.
+	changesRecords bool
+}
+
+// Filters are added to the search until a stage changes the records, and the
+// filters after that are run as where clauses in the chain of aggregators.
+func buildLogQuery(stream interface{}, stages []interface{}) (ast.QueryStruct, error) {
+	var q ast.QueryStruct
+	var lastAgg *structs.QueryAggregators
+	appendAggs := func(aggs *structs.QueryAggregators) {
+		if q.PipeCommands == nil {
+			q.PipeCommands = aggs
+		} else {
+			lastAgg.Next = aggs
+		}
+		lastAgg = aggs
+		for lastAgg.Next != nil {
+			lastAgg = lastAgg.Next
+		}
+	}
+
+	filters := make([]*ast.Node, 0)
+	filterRecords := false
+	for _, rawStage := range stages {
+		stage, _ := rawStage.(*logStage)
+		if stage == nil {
+			// The stage failed to parse, which was already reported.
+			continue
+		}
+		if stage.filter != nil && isNoErrorFilter(stage.filter) {
+			continue
+		}
+
+		switch {
+		case stage.filter != nil && !filterRecords:
+			filters = append(filters, stage.filter)
+		case stage.filter != nil:
+			boolExpr, err := filterToBoolExpr(stage.filter)
+			if err != nil {
+				return q, err
+			}
+			appendAggs(&structs.QueryAggregators{
+				PipeCommandType: structs.OutputTransformType,
+				OutputTransforms: &structs.OutputTransforms{
+					FilterRows: boolExpr,
+				},
+				WhereExpr: boolExpr,
+			})
+		case stage.aggs != nil:
+			appendAggs(stage.aggs)
+		}
+		filterRecords = filterRecords || stage.changesRecords
+	}
+
+	searchNodes := make([]*ast.Node, 0)
+	if stream != nil {
+		searchNodes = append(searchNodes, stream.(*ast.Node))
+	}
+	if len(filters) > 0 {
+		searchNodes = append(searchNodes, chainAndNodes(filters))
+	}
+	if len(searchNodes) > 0 {
+		q.SearchFilter = chainAndNodes(searchNodes)
+	}
+
+	return q, nil
+}
+
+// Grafana adds __error__="" to its queries to hide lines that failed to
+// parse; records here never have an __error__ label, so it always matches.
+func isNoErrorFilter(node *ast.Node) bool {
+	if node.NodeType != ast.NodeTerminal || node.Comparison.Field != errorLabel ||
+		node.Comparison.Op != "=" {
+		return false
+	}
+
+	value, ok := node.Comparison.Values.(string)
+	return ok && strings.Trim(value, "\"`") == ""
+}
+
+// Joins the nodes with ANDs, nesting to the right.
+func chainAndNodes(nodes []*ast.Node) *ast.Node {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	return &ast.Node{
+		NodeType: ast.NodeAnd,
+		Left:     nodes[0],
+		Right:    chainAndNodes(nodes[1:]),
+	}
+}
+
+// Loki label matchers have to match the whole value.
+func newLabelRegexNode(field string, op string, pattern string) (*ast.Node, error) {
+	anchoredPattern := "^(?:" + pattern + ")$"
+	if _, err := regexp.Compile(anchoredPattern); err != nil {
+		return nil, fmt.Errorf("newLabelRegexNode: invalid regex %v; err=%v", pattern, err)
+	}
+
+	return &ast.Node{
+		NodeType: ast.NodeTerminal,
+		Comparison: ast.Comparison{
+			Op:           op,
+			Field:        field,
+			Values:       anchoredPattern,
+			ValueIsRegex: true,
+		},
+	}, nil
+}
+
+// Converts a line or label filter to the condition of a where clause.
+func filterToBoolExpr(node *ast.Node) (*structs.BoolExpr, error) {
+	comparison := node.Comparison
+	var boolExpr *structs.BoolExpr
+	switch value := comparison.Values.(type) {
+	case ast.GrepValue:
+		boolExpr = newMatchBoolExpr(lineColumn, regexp.QuoteMeta(strings.Trim(value.Field, "\"")))
+	case string:
+		if !comparison.ValueIsRegex {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			return newCompareBoolExpr(comparison.Field, comparison.Op, value)
+		}
+		boolExpr = newMatchBoolExpr(comparison.Field, value)
+	case json.Number:
+		return newCompareBoolExpr(comparison.Field, comparison.Op, value.String())
+	default:
+		return nil, fmt.Errorf("filterToBoolExpr: unsupported value %v of type %T", value, value)
+	}
+
+	switch comparison.Op {
+	case "=":
+		return boolExpr, nil
+	case "!=":
+		return &structs.BoolExpr{
+			LeftBool: boolExpr,
+			BoolOp:   structs.BoolOpNot,
+		}, nil
+	default:
+		return nil, fmt.Errorf("filterToBoolExpr: unsupported operator %v", comparison.Op)
+	}
+}
+
+func newMatchBoolExpr(field string, pattern string) *structs.BoolExpr {
+	return &structs.BoolExpr{
+		IsTerminal: true,
+		LeftValue:  newFieldValueExpr(field),
+		RightValue: newStringValueExpr(pattern),
+		ValueOp:    "match",
+	}
+}
+
+func newCompareBoolExpr(field string, op string, value string) (*structs.BoolExpr, error) {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("newCompareBoolExpr: unsupported operator %v", op)
+	}
+
+	rightValue := newStringValueExpr(value)
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		rightValue = &structs.ValueExpr{
+			ValueExprMode: structs.VEMNumericExpr,
+			NumericExpr: &structs.NumericExpr{
+				IsTerminal:      true,
+				Value:           value,
+				NumericExprMode: structs.NEMNumber,
+			},
+		}
+	}
+
+	return &structs.BoolExpr{
+		IsTerminal: true,
+		LeftValue:  newFieldValueExpr(field),
+		RightValue: rightValue,
+		ValueOp:    op,
+	}, nil
+}
+
+func newFieldValueExpr(field string) *structs.ValueExpr {
+	return &structs.ValueExpr{
+		ValueExprMode: structs.VEMNumericExpr,
+		NumericExpr: &structs.NumericExpr{
+			IsTerminal:      true,
+			ValueIsField:    true,
+			Value:           field,
+			NumericExprMode: structs.NEMNumberField,
+		},
+	}
+}
+
+func newStringValueExpr(value string) *structs.ValueExpr {
+	return &structs.ValueExpr{
+		ValueExprMode: structs.VEMStringExpr,
+		StringExpr: &structs.StringExpr{
+			StringExprMode: structs.SEMRawString,
+			RawString:      value,
+		},
+	}
+}
+
+// The labels of a packed line are extracted at ingestion like any other JSON
+// key, so unpacking only needs to restore the original line from _entry.
+// Lines that weren't packed keep their line.
+func newUnpackStage() *logStage {
+	valueExpr := &structs.ValueExpr{
+		ValueExprMode: structs.VEMConditionExpr,
+		ConditionExpr: &structs.ConditionExpr{
+			Op:        "coalesce",
+			ValueList: []*structs.ValueExpr{newFieldValueExpr(packedEntryKey), newFieldValueExpr(lineColumn)},
+		},
+	}
+
+	return &logStage{aggs: newEvalAggs(lineColumn, valueExpr), changesRecords: true}
+}
+
+// Extracts the named groups of the regex from the log line.
+func newRexStage(pattern string) (*logStage, error) {
+	rexExp, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("newRexStage: invalid regex %v; err=%v", pattern, err)
+	}
+
+	rexColNames := make([]string, 0)
+	for _, name := range rexExp.SubexpNames() {
+		if name != "" {
+			rexColNames = append(rexColNames, name)
+		}
+	}
+	if len(rexColNames) == 0 {
+		return nil, fmt.Errorf("newRexStage: regex %v has no named groups", pattern)
+	}
+
+	rexExpr := &structs.RexExpr{
+		FieldName:   lineColumn,
+		Pattern:     pattern,
+		RexColNames: rexColNames,
+	}
+	aggs := &structs.QueryAggregators{
+		PipeCommandType: structs.OutputTransformType,
+		OutputTransforms: &structs.OutputTransforms{
+			LetColumns: &structs.LetColumnsRequest{RexColRequest: rexExpr},
+		},
+		RexExpr: rexExpr,
+	}
+
+	return &logStage{aggs: aggs, changesRecords: true}, nil
+}
+
+// Converts a Loki pattern like `<ip> - <_> "<method> <path>"` to a regex with a
+// named group per capture. As in Loki, the pattern matches from the start of
+// the line and a capture at the end takes the rest of it.
+func patternToRegex(pattern string) (string, error) {
+	captureRegex := regexp.MustCompile(`<(_|[a-zA-Z_][a-zA-Z0-9_]*)>`)
+	matches := captureRegex.FindAllStringSubmatchIndex(pattern, -1)
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	numNamedCaptures := 0
+	end := 0
+	for _, match := range matches {
+		sb.WriteString(regexp.QuoteMeta(pattern[end:match[0]]))
+		end = match[1]
+
+		expr := ".*?"
+		if end == len(pattern) {
+			expr = ".*"
+		}
+
+		name := pattern[match[2]:match[3]]
+		if name == "_" {
+			sb.WriteString("(?:" + expr + ")")
+		} else {
+			sb.WriteString("(?P<" + name + ">" + expr + ")")
+			numNamedCaptures++
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(pattern[end:]))
+
+	if numNamedCaptures == 0 {
+		return "", fmt.Errorf("patternToRegex: pattern %v has no named captures", pattern)
+	}
+
+	return sb.String(), nil
+}
+
+// Only templates that print labels, like "{{.method}} {{ .path }}", are
+// supported.
+func templateToValueExpr(template string) (*structs.ValueExpr, error) {
+	actionRegex := regexp.MustCompile(`{{\s*\.([a-zA-Z_][a-zA-Z0-9_]*)\s*}}`)
+	atoms := make([]*structs.ConcatAtom, 0)
+	appendText := func(text string) error {
+		if strings.Contains(text, "{{") {
+			return fmt.Errorf("templateToValueExpr: unsupported template %v; only {{.label}} actions are supported", template)
+		}
+		if text != "" {
+			atoms = append(atoms, &structs.ConcatAtom{Value: text})
+		}
+		return nil
+	}
+
+	end := 0
+	for _, match := range actionRegex.FindAllStringSubmatchIndex(template, -1) {
+		if err := appendText(template[end:match[0]]); err != nil {
+			return nil, err
+		}
+		atoms = append(atoms, &structs.ConcatAtom{IsField: true, Value: template[match[2]:match[3]]})
+		end = match[1]
+	}
+	if err := appendText(template[end:]); err != nil {
+		return nil, err
+	}
+
+	if len(atoms) == 0 {
+		return newStringValueExpr(""), nil
+	}
+
+	return &structs.ValueExpr{
+		ValueExprMode: structs.VEMStringExpr,
+		StringExpr: &structs.StringExpr{
+			StringExprMode: structs.SEMConcatExpr,
+			ConcatExpr:     &structs.ConcatExpr{Atoms: atoms},
+		},
+	}, nil
+}
+
+func newEvalAggs(field string, valueExpr *structs.ValueExpr) *structs.QueryAggregators {
+	return &structs.QueryAggregators{
+		PipeCommandType: structs.OutputTransformType,
+		OutputTransforms: &structs.OutputTransforms{
+			LetColumns: &structs.LetColumnsRequest{
+				NewColName:      field,
+				ValueColRequest: valueExpr,
+			},
+		},
+		EvalExpr: &structs.EvalExpr{
+			ValueExpr: valueExpr,
+			FieldName: field,
+		},
+	}
+}
+
+func newFieldsAggs(columnsRequest *structs.ColumnsRequest) *structs.QueryAggregators {
+	return &structs.QueryAggregators{
+		PipeCommandType: structs.OutputTransformType,
+		OutputTransforms: &structs.OutputTransforms{
+			OutputColumns: columnsRequest,
+		},
+		FieldsExpr: columnsRequest,
+	}
+}
+
+// Range functions that need an unwrapped label to aggregate.
+var unwrapRangeFunctions = map[string]bool{
+	"avg_over_time":      true,
+	"sum_over_time":      true,
+	"min_over_time":      true,
+	"max_over_time":      true,
+	"first_over_time":    true,
+	"last_over_time":     true,
+	"quantile_over_time": true,
+}
+
+func newRangeAggregation(function string, param interface{}, q ast.QueryStruct,
+	grouping interface{}) (ast.QueryStruct, error) {
+
+	metricsExpr := q.MetricsExpr
+	if metricsExpr == nil {
+		return q, fmt.Errorf("newRangeAggregation: invalid range for %v", function)
+	}
+	metricsExpr.RangeFunction = function
+
+	switch {
+	case unwrapRangeFunctions[function] && metricsExpr.Unwrap == nil:
+		return q, fmt.Errorf("newRangeAggregation: %v requires an unwrap expression", function)
+	case !unwrapRangeFunctions[function] && function != "rate" && metricsExpr.Unwrap != nil:
+		return q, fmt.Errorf("newRangeAggregation: %v does not support an unwrap expression", function)
+	case grouping != nil && metricsExpr.Unwrap == nil:
+		return q, fmt.Errorf("newRangeAggregation: grouping %v requires an unwrap expression", function)
+	}
+	if grouping != nil {
+		metricsExpr.Grouping = grouping.(*ast.LogGrouping)
+	}
+
+	if (function == "quantile_over_time") != (param != nil) {
+		return q, fmt.Errorf("newRangeAggregation: only quantile_over_time takes a parameter")
+	}
+	if param != nil {
+		quantile, err := param.(json.Number).Float64()
+		if err != nil || quantile < 0 || quantile > 1 {
+			return q, fmt.Errorf("newRangeAggregation: quantile must be between 0 and 1; err=%v", err)
+		}
+		metricsExpr.Quantile = quantile
+	}
+
+	return q, nil
+}
+
+// Returns the names parsed by LabelNameList.
+func getLabelNames(first interface{}, rest interface{}) []string {
+	names := []string{first.(string)}
+	for _, element := range rest.([]interface{}) {
+		names = append(names, element.([]interface{})[3].(string))
+	}
+
+	return names
+}
+
 var g = &grammar{
 	rules: []*rule{
 		{
 			name: "Start",
-			pos:  position{line: 52, col: 1, offset: 1395},
+			pos:  position{line: 463, col: 1, offset: 13131},
 			expr: &choiceExpr{
-				pos: position{line: 52, col: 10, offset: 1404},
+				pos: position{line: 463, col: 10, offset: 13140},
 				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 52, col: 10, offset: 1404},
+						pos: position{line: 463, col: 10, offset: 13140},
 						run: (*parser).callonStart2,
 						expr: &seqExpr{
-							pos: position{line: 52, col: 10, offset: 1404},
+							pos: position{line: 463, col: 10, offset: 13140},
 							exprs: []any{
 								&labeledExpr{
-									pos:   position{line: 52, col: 10, offset: 1404},
+									pos:   position{line: 463, col: 10, offset: 13140},
 									label: "query",
 									expr: &zeroOrOneExpr{
-										pos: position{line: 52, col: 16, offset: 1410},
+										pos: position{line: 463, col: 16, offset: 13146},
 										expr: &ruleRefExpr{
-											pos:  position{line: 52, col: 16, offset: 1410},
+											pos:  position{line: 463, col: 16, offset: 13146},
 											name: "Stream",
 										},
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 52, col: 24, offset: 1418},
-									label: "jf",
-									expr: &zeroOrOneExpr{
-										pos: position{line: 52, col: 27, offset: 1421},
+									pos:   position{line: 463, col: 24, offset: 13154},
+									label: "stages",
+									expr: &zeroOrMoreExpr{
+										pos: position{line: 463, col: 31, offset: 13161},
 										expr: &ruleRefExpr{
-											pos:  position{line: 52, col: 27, offset: 1421},
-											name: "JSONFilter",
+											pos:  position{line: 463, col: 31, offset: 13161},
+											name: "PipelineStage",
 										},
 									},
 								},
-								&labeledExpr{
-									pos:   position{line: 52, col: 39, offset: 1433},
-									label: "fs",
-									expr: &zeroOrOneExpr{
-										pos: position{line: 52, col: 42, offset: 1436},
-										expr: &ruleRefExpr{
-											pos:  position{line: 52, col: 42, offset: 1436},
-											name: "FilterStream",
-										},
+								&zeroOrOneExpr{
+									pos: position{line: 463, col: 46, offset: 13176},
+									expr: &ruleRefExpr{
+										pos:  position{line: 463, col: 46, offset: 13176},
+										name: "space",
 									},
 								},
 								&ruleRefExpr{
-									pos:  position{line: 52, col: 56, offset: 1450},
+									pos:  position{line: 463, col: 53, offset: 13183},
 									name: "EOF",
 								},
 							},
 						},
 					},
 					&actionExpr{
-						pos: position{line: 79, col: 5, offset: 2102},
-						run: (*parser).callonStart14,
+						pos: position{line: 465, col: 5, offset: 13249},
+						run: (*parser).callonStart13,
 						expr: &seqExpr{
-							pos: position{line: 79, col: 5, offset: 2102},
+							pos: position{line: 465, col: 5, offset: 13249},
 							exprs: []any{
 								&ruleRefExpr{
-									pos:  position{line: 79, col: 5, offset: 2102},
-									name: "COUNT_OVER_TIME",
-								},
-								&litMatcher{
-									pos:        position{line: 79, col: 21, offset: 2118},
-									val:        "(",
-									ignoreCase: false,
-									want:       "\"(\"",
+									pos:  position{line: 465, col: 5, offset: 13249},
+									name: "_",
 								},
 								&labeledExpr{
-									pos:   position{line: 79, col: 25, offset: 2122},
-									label: "query",
+									pos:   position{line: 465, col: 7, offset: 13251},
+									label: "expr",
 									expr: &ruleRefExpr{
-										pos:  position{line: 79, col: 31, offset: 2128},
-										name: "Stream",
+										pos:  position{line: 465, col: 12, offset: 13256},
+										name: "MetricExpr",
 									},
 								},
-								&labeledExpr{
-									pos:   position{line: 79, col: 38, offset: 2135},
-									label: "duration",
+								&zeroOrOneExpr{
+									pos: position{line: 465, col: 23, offset: 13267},
 									expr: &ruleRefExpr{
-										pos:  position{line: 79, col: 47, offset: 2144},
-										name: "Duration",
+										pos:  position{line: 465, col: 23, offset: 13267},
+										name: "space",
 									},
 								},
-								&litMatcher{
-									pos:        position{line: 79, col: 56, offset: 2153},
-									val:        ")",
-									ignoreCase: false,
-									want:       "\")\"",
+								&ruleRefExpr{
+									pos:  position{line: 465, col: 30, offset: 13274},
+									name: "EOF",
 								},
 							},
 						},
 					},
 					&actionExpr{
-						pos: position{line: 90, col: 5, offset: 2706},
-						run: (*parser).callonStart23,
+						pos: position{line: 467, col: 5, offset: 13305},
+						run: (*parser).callonStart21,
 						expr: &labeledExpr{
-							pos:   position{line: 90, col: 5, offset: 2706},
+							pos:   position{line: 467, col: 5, offset: 13305},
 							label: "expr",
 							expr: &ruleRefExpr{
-								pos:  position{line: 90, col: 11, offset: 2712},
+								pos:  position{line: 467, col: 11, offset: 13311},
 								name: "VectorArithmeticExpr",
 							},
 						},
@@ -169,44 +583,44 @@ var g = &grammar{
 		},
 		{
 			name: "Stream",
-			pos:  position{line: 99, col: 1, offset: 2978},
+			pos:  position{line: 476, col: 1, offset: 13577},
 			expr: &actionExpr{
-				pos: position{line: 99, col: 11, offset: 2988},
+				pos: position{line: 476, col: 11, offset: 13587},
 				run: (*parser).callonStream1,
 				expr: &seqExpr{
-					pos: position{line: 99, col: 11, offset: 2988},
+					pos: position{line: 476, col: 11, offset: 13587},
 					exprs: []any{
 						&ruleRefExpr{
-							pos:  position{line: 99, col: 11, offset: 2988},
+							pos:  position{line: 476, col: 11, offset: 13587},
 							name: "Delimiter",
 						},
 						&labeledExpr{
-							pos:   position{line: 99, col: 21, offset: 2998},
+							pos:   position{line: 476, col: 21, offset: 13597},
 							label: "q1",
 							expr: &ruleRefExpr{
-								pos:  position{line: 99, col: 24, offset: 3001},
-								name: "Query",
+								pos:  position{line: 476, col: 24, offset: 13600},
+								name: "StreamMatcher",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 99, col: 30, offset: 3007},
+							pos:   position{line: 476, col: 38, offset: 13614},
 							label: "rest",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 99, col: 35, offset: 3012},
+								pos: position{line: 476, col: 43, offset: 13619},
 								expr: &ruleRefExpr{
-									pos:  position{line: 99, col: 36, offset: 3013},
-									name: "Query",
+									pos:  position{line: 476, col: 44, offset: 13620},
+									name: "StreamMatcher",
 								},
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 99, col: 44, offset: 3021},
+							pos:  position{line: 476, col: 60, offset: 13636},
 							name: "Delimiter",
 						},
 						&zeroOrOneExpr{
-							pos: position{line: 99, col: 54, offset: 3031},
+							pos: position{line: 476, col: 70, offset: 13646},
 							expr: &ruleRefExpr{
-								pos:  position{line: 99, col: 54, offset: 3031},
+								pos:  position{line: 476, col: 70, offset: 13646},
 								name: "space",
 							},
 						},
@@ -215,103 +629,291 @@ var g = &grammar{
 			},
 		},
 		{
-			name: "FilterStream",
-			pos:  position{line: 128, col: 1, offset: 3723},
-			expr: &actionExpr{
-				pos: position{line: 128, col: 17, offset: 3739},
-				run: (*parser).callonFilterStream1,
-				expr: &seqExpr{
-					pos: position{line: 128, col: 17, offset: 3739},
-					exprs: []any{
-						&labeledExpr{
-							pos:   position{line: 128, col: 17, offset: 3739},
-							label: "rest",
-							expr: &zeroOrMoreExpr{
-								pos: position{line: 128, col: 22, offset: 3744},
-								expr: &choiceExpr{
-									pos: position{line: 128, col: 23, offset: 3745},
-									alternatives: []any{
-										&ruleRefExpr{
-											pos:  position{line: 128, col: 23, offset: 3745},
-											name: "LogFilter",
-										},
-										&ruleRefExpr{
-											pos:  position{line: 128, col: 35, offset: 3757},
-											name: "LabelFilter",
-										},
+			name: "StreamMatcher",
+			pos:  position{line: 505, col: 1, offset: 14338},
+			expr: &choiceExpr{
+				pos: position{line: 505, col: 18, offset: 14355},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 505, col: 18, offset: 14355},
+						run: (*parser).callonStreamMatcher2,
+						expr: &seqExpr{
+							pos: position{line: 505, col: 18, offset: 14355},
+							exprs: []any{
+								&labeledExpr{
+									pos:   position{line: 505, col: 18, offset: 14355},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 24, offset: 14361},
+										name: "LabelName",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 505, col: 34, offset: 14371},
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 34, offset: 14371},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 505, col: 41, offset: 14378},
+									label: "op",
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 44, offset: 14381},
+										name: "RegexMatchOp",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 505, col: 57, offset: 14394},
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 57, offset: 14394},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 505, col: 64, offset: 14401},
+									label: "pattern",
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 72, offset: 14409},
+										name: "StringLiteral",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 505, col: 86, offset: 14423},
+									expr: &litMatcher{
+										pos:        position{line: 505, col: 86, offset: 14423},
+										val:        ",",
+										ignoreCase: false,
+										want:       "\",\"",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 505, col: 91, offset: 14428},
+									expr: &ruleRefExpr{
+										pos:  position{line: 505, col: 91, offset: 14428},
+										name: "space",
 									},
 								},
-							},
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 128, col: 49, offset: 3771},
-							expr: &ruleRefExpr{
-								pos:  position{line: 128, col: 49, offset: 3771},
-								name: "space",
 							},
 						},
 					},
-				},
-			},
-		},
-		{
-			name: "Query",
-			pos:  position{line: 158, col: 1, offset: 4498},
-			expr: &actionExpr{
-				pos: position{line: 158, col: 11, offset: 4508},
-				run: (*parser).callonQuery1,
-				expr: &seqExpr{
-					pos: position{line: 158, col: 11, offset: 4508},
-					exprs: []any{
-						&labeledExpr{
-							pos:   position{line: 158, col: 11, offset: 4508},
-							label: "field",
-							expr: &ruleRefExpr{
-								pos:  position{line: 158, col: 17, offset: 4514},
-								name: "Field",
-							},
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 158, col: 23, offset: 4520},
-							expr: &ruleRefExpr{
-								pos:  position{line: 158, col: 23, offset: 4520},
-								name: "space",
-							},
-						},
-						&litMatcher{
-							pos:        position{line: 158, col: 30, offset: 4527},
-							val:        "=",
-							ignoreCase: false,
-							want:       "\"=\"",
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 158, col: 34, offset: 4531},
+					&actionExpr{
+						pos: position{line: 507, col: 5, offset: 14517},
+						run: (*parser).callonStreamMatcher18,
+						expr: &seqExpr{
+							pos: position{line: 507, col: 5, offset: 14517},
+							exprs: []any{
+								&labeledExpr{
+									pos:   position{line: 507, col: 5, offset: 14517},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 507, col: 11, offset: 14523},
+										name: "LabelName",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 507, col: 21, offset: 14533},
+									expr: &ruleRefExpr{
+										pos:  position{line: 507, col: 21, offset: 14533},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 507, col: 28, offset: 14540},
+									val:        "!=",
+									ignoreCase: false,
+									want:       "\"!=\"",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 507, col: 33, offset: 14545},
+									expr: &ruleRefExpr{
+										pos:  position{line: 507, col: 33, offset: 14545},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 507, col: 40, offset: 14552},
+									label: "field1",
+									expr: &ruleRefExpr{
+										pos:  position{line: 507, col: 47, offset: 14559},
+										name: "Field",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 507, col: 53, offset: 14565},
+									expr: &litMatcher{
+										pos:        position{line: 507, col: 53, offset: 14565},
+										val:        ",",
+										ignoreCase: false,
+										want:       "\",\"",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 507, col: 58, offset: 14570},
+									expr: &ruleRefExpr{
+										pos:  position{line: 507, col: 58, offset: 14570},
+										name: "space",
+									},
+								},
+							},
+						},
+					},
+					&ruleRefExpr{
+						pos:  position{line: 516, col: 5, offset: 14783},
+						name: "Query",
+					},
+				},
+			},
+		},
+		{
+			name: "PipelineStage",
+			pos:  position{line: 518, col: 1, offset: 14790},
+			expr: &choiceExpr{
+				pos: position{line: 518, col: 18, offset: 14807},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 518, col: 18, offset: 14807},
+						run: (*parser).callonPipelineStage2,
+						expr: &seqExpr{
+							pos: position{line: 518, col: 18, offset: 14807},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 518, col: 18, offset: 14807},
+									expr: &ruleRefExpr{
+										pos:  position{line: 518, col: 18, offset: 14807},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 518, col: 25, offset: 14814},
+									label: "stage",
+									expr: &choiceExpr{
+										pos: position{line: 518, col: 32, offset: 14821},
+										alternatives: []any{
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 32, offset: 14821},
+												name: "JSONFilter",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 45, offset: 14834},
+												name: "LogfmtParser",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 60, offset: 14849},
+												name: "RegexpParser",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 75, offset: 14864},
+												name: "PatternParser",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 91, offset: 14880},
+												name: "UnpackParser",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 106, offset: 14895},
+												name: "LineFormat",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 119, offset: 14908},
+												name: "LabelFormat",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 133, offset: 14922},
+												name: "DropLabels",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 518, col: 146, offset: 14935},
+												name: "KeepLabels",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 520, col: 5, offset: 14975},
+						run: (*parser).callonPipelineStage17,
+						expr: &labeledExpr{
+							pos:   position{line: 520, col: 5, offset: 14975},
+							label: "filter",
+							expr: &choiceExpr{
+								pos: position{line: 520, col: 13, offset: 14983},
+								alternatives: []any{
+									&ruleRefExpr{
+										pos:  position{line: 520, col: 13, offset: 14983},
+										name: "LogFilter",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 520, col: 25, offset: 14995},
+										name: "LabelFilter",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Query",
+			pos:  position{line: 524, col: 1, offset: 15067},
+			expr: &actionExpr{
+				pos: position{line: 524, col: 11, offset: 15077},
+				run: (*parser).callonQuery1,
+				expr: &seqExpr{
+					pos: position{line: 524, col: 11, offset: 15077},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 524, col: 11, offset: 15077},
+							label: "field",
+							expr: &ruleRefExpr{
+								pos:  position{line: 524, col: 17, offset: 15083},
+								name: "Field",
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 524, col: 23, offset: 15089},
+							expr: &ruleRefExpr{
+								pos:  position{line: 524, col: 23, offset: 15089},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 524, col: 30, offset: 15096},
+							val:        "=",
+							ignoreCase: false,
+							want:       "\"=\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 524, col: 34, offset: 15100},
 							expr: &ruleRefExpr{
-								pos:  position{line: 158, col: 34, offset: 4531},
+								pos:  position{line: 524, col: 34, offset: 15100},
 								name: "space",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 158, col: 41, offset: 4538},
+							pos:   position{line: 524, col: 41, offset: 15107},
 							label: "field1",
 							expr: &ruleRefExpr{
-								pos:  position{line: 158, col: 48, offset: 4545},
+								pos:  position{line: 524, col: 48, offset: 15114},
 								name: "Field",
 							},
 						},
 						&zeroOrOneExpr{
-							pos: position{line: 158, col: 54, offset: 4551},
+							pos: position{line: 524, col: 54, offset: 15120},
 							expr: &litMatcher{
-								pos:        position{line: 158, col: 54, offset: 4551},
+								pos:        position{line: 524, col: 54, offset: 15120},
 								val:        ",",
 								ignoreCase: false,
 								want:       "\",\"",
 							},
 						},
 						&zeroOrOneExpr{
-							pos: position{line: 158, col: 59, offset: 4556},
+							pos: position{line: 524, col: 59, offset: 15125},
 							expr: &ruleRefExpr{
-								pos:  position{line: 158, col: 59, offset: 4556},
+								pos:  position{line: 524, col: 59, offset: 15125},
 								name: "space",
 							},
 						},
@@ -321,41 +923,41 @@ var g = &grammar{
 		},
 		{
 			name: "SingleField",
-			pos:  position{line: 169, col: 1, offset: 4767},
+			pos:  position{line: 535, col: 1, offset: 15336},
 			expr: &actionExpr{
-				pos: position{line: 169, col: 17, offset: 4783},
+				pos: position{line: 535, col: 17, offset: 15352},
 				run: (*parser).callonSingleField1,
 				expr: &seqExpr{
-					pos: position{line: 169, col: 17, offset: 4783},
+					pos: position{line: 535, col: 17, offset: 15352},
 					exprs: []any{
 						&zeroOrOneExpr{
-							pos: position{line: 169, col: 17, offset: 4783},
+							pos: position{line: 535, col: 17, offset: 15352},
 							expr: &litMatcher{
-								pos:        position{line: 169, col: 17, offset: 4783},
+								pos:        position{line: 535, col: 17, offset: 15352},
 								val:        ",",
 								ignoreCase: false,
 								want:       "\",\"",
 							},
 						},
 						&zeroOrOneExpr{
-							pos: position{line: 169, col: 22, offset: 4788},
+							pos: position{line: 535, col: 22, offset: 15357},
 							expr: &ruleRefExpr{
-								pos:  position{line: 169, col: 22, offset: 4788},
+								pos:  position{line: 535, col: 22, offset: 15357},
 								name: "space",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 169, col: 29, offset: 4795},
+							pos:   position{line: 535, col: 29, offset: 15364},
 							label: "field",
 							expr: &ruleRefExpr{
-								pos:  position{line: 169, col: 35, offset: 4801},
+								pos:  position{line: 535, col: 35, offset: 15370},
 								name: "Field",
 							},
 						},
 						&zeroOrOneExpr{
-							pos: position{line: 169, col: 41, offset: 4807},
+							pos: position{line: 535, col: 41, offset: 15376},
 							expr: &litMatcher{
-								pos:        position{line: 169, col: 41, offset: 4807},
+								pos:        position{line: 535, col: 41, offset: 15376},
 								val:        ",",
 								ignoreCase: false,
 								want:       "\",\"",
@@ -367,48 +969,99 @@ var g = &grammar{
 		},
 		{
 			name: "LogFilter",
-			pos:  position{line: 179, col: 1, offset: 4994},
-			expr: &actionExpr{
-				pos: position{line: 179, col: 14, offset: 5007},
-				run: (*parser).callonLogFilter1,
-				expr: &seqExpr{
-					pos: position{line: 179, col: 14, offset: 5007},
-					exprs: []any{
-						&zeroOrOneExpr{
-							pos: position{line: 179, col: 14, offset: 5007},
-							expr: &ruleRefExpr{
-								pos:  position{line: 179, col: 14, offset: 5007},
-								name: "space",
-							},
-						},
-						&labeledExpr{
-							pos:   position{line: 179, col: 21, offset: 5014},
-							label: "grep",
-							expr: &ruleRefExpr{
-								pos:  position{line: 179, col: 26, offset: 5019},
-								name: "GrepFilter",
-							},
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 179, col: 37, offset: 5030},
-							expr: &ruleRefExpr{
-								pos:  position{line: 179, col: 37, offset: 5030},
-								name: "space",
-							},
-						},
-						&labeledExpr{
-							pos:   position{line: 179, col: 44, offset: 5037},
-							label: "field",
-							expr: &ruleRefExpr{
-								pos:  position{line: 179, col: 50, offset: 5043},
-								name: "Field",
+			pos:  position{line: 545, col: 1, offset: 15563},
+			expr: &choiceExpr{
+				pos: position{line: 545, col: 14, offset: 15576},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 545, col: 14, offset: 15576},
+						run: (*parser).callonLogFilter2,
+						expr: &seqExpr{
+							pos: position{line: 545, col: 14, offset: 15576},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 545, col: 14, offset: 15576},
+									expr: &ruleRefExpr{
+										pos:  position{line: 545, col: 14, offset: 15576},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 545, col: 21, offset: 15583},
+									label: "op",
+									expr: &ruleRefExpr{
+										pos:  position{line: 545, col: 24, offset: 15586},
+										name: "LineRegexOp",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 545, col: 36, offset: 15598},
+									expr: &ruleRefExpr{
+										pos:  position{line: 545, col: 36, offset: 15598},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 545, col: 43, offset: 15605},
+									label: "pattern",
+									expr: &ruleRefExpr{
+										pos:  position{line: 545, col: 51, offset: 15613},
+										name: "StringLiteral",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 545, col: 65, offset: 15627},
+									expr: &ruleRefExpr{
+										pos:  position{line: 545, col: 65, offset: 15627},
+										name: "space",
+									},
+								},
 							},
 						},
-						&zeroOrOneExpr{
-							pos: position{line: 179, col: 56, offset: 5049},
-							expr: &ruleRefExpr{
-								pos:  position{line: 179, col: 56, offset: 5049},
-								name: "space",
+					},
+					&actionExpr{
+						pos: position{line: 558, col: 5, offset: 16030},
+						run: (*parser).callonLogFilter14,
+						expr: &seqExpr{
+							pos: position{line: 558, col: 5, offset: 16030},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 558, col: 5, offset: 16030},
+									expr: &ruleRefExpr{
+										pos:  position{line: 558, col: 5, offset: 16030},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 558, col: 12, offset: 16037},
+									label: "grep",
+									expr: &ruleRefExpr{
+										pos:  position{line: 558, col: 17, offset: 16042},
+										name: "GrepFilter",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 558, col: 28, offset: 16053},
+									expr: &ruleRefExpr{
+										pos:  position{line: 558, col: 28, offset: 16053},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 558, col: 35, offset: 16060},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 558, col: 41, offset: 16066},
+										name: "Field",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 558, col: 47, offset: 16072},
+									expr: &ruleRefExpr{
+										pos:  position{line: 558, col: 47, offset: 16072},
+										name: "space",
+									},
+								},
 							},
 						},
 					},
@@ -417,85 +1070,1322 @@ var g = &grammar{
 		},
 		{
 			name: "LabelFilter",
-			pos:  position{line: 190, col: 1, offset: 5266},
-			expr: &actionExpr{
-				pos: position{line: 190, col: 16, offset: 5281},
-				run: (*parser).callonLabelFilter1,
-				expr: &seqExpr{
-					pos: position{line: 190, col: 16, offset: 5281},
-					exprs: []any{
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 16, offset: 5281},
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 16, offset: 5281},
-								name: "space",
+			pos:  position{line: 569, col: 1, offset: 16289},
+			expr: &choiceExpr{
+				pos: position{line: 569, col: 16, offset: 16304},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 569, col: 16, offset: 16304},
+						run: (*parser).callonLabelFilter2,
+						expr: &seqExpr{
+							pos: position{line: 569, col: 16, offset: 16304},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 16, offset: 16304},
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 16, offset: 16304},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 569, col: 23, offset: 16311},
+									val:        "|",
+									ignoreCase: false,
+									want:       "\"|\"",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 27, offset: 16315},
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 27, offset: 16315},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 569, col: 34, offset: 16322},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 40, offset: 16328},
+										name: "Field",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 46, offset: 16334},
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 46, offset: 16334},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 569, col: 53, offset: 16341},
+									label: "op",
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 56, offset: 16344},
+										name: "RegexMatchOp",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 69, offset: 16357},
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 69, offset: 16357},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 569, col: 76, offset: 16364},
+									label: "pattern",
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 84, offset: 16372},
+										name: "StringLiteral",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 98, offset: 16386},
+									expr: &litMatcher{
+										pos:        position{line: 569, col: 98, offset: 16386},
+										val:        ",",
+										ignoreCase: false,
+										want:       "\",\"",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 569, col: 103, offset: 16391},
+									expr: &ruleRefExpr{
+										pos:  position{line: 569, col: 103, offset: 16391},
+										name: "space",
+									},
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 571, col: 5, offset: 16480},
+						run: (*parser).callonLabelFilter23,
+						expr: &seqExpr{
+							pos: position{line: 571, col: 5, offset: 16480},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 5, offset: 16480},
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 5, offset: 16480},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 571, col: 12, offset: 16487},
+									val:        "|",
+									ignoreCase: false,
+									want:       "\"|\"",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 16, offset: 16491},
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 16, offset: 16491},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 571, col: 23, offset: 16498},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 29, offset: 16504},
+										name: "Field",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 35, offset: 16510},
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 35, offset: 16510},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 571, col: 42, offset: 16517},
+									label: "op",
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 45, offset: 16520},
+										name: "opCOMP",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 52, offset: 16527},
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 52, offset: 16527},
+										name: "space",
+									},
+								},
+								&labeledExpr{
+									pos:   position{line: 571, col: 59, offset: 16534},
+									label: "field1",
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 66, offset: 16541},
+										name: "Field",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 72, offset: 16547},
+									expr: &litMatcher{
+										pos:        position{line: 571, col: 72, offset: 16547},
+										val:        ",",
+										ignoreCase: false,
+										want:       "\",\"",
+									},
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 571, col: 77, offset: 16552},
+									expr: &ruleRefExpr{
+										pos:  position{line: 571, col: 77, offset: 16552},
+										name: "space",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "JSONFilter",
+			pos:  position{line: 582, col: 1, offset: 16770},
+			expr: &actionExpr{
+				pos: position{line: 582, col: 15, offset: 16784},
+				run: (*parser).callonJSONFilter1,
+				expr: &seqExpr{
+					pos: position{line: 582, col: 15, offset: 16784},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 582, col: 15, offset: 16784},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 582, col: 19, offset: 16788},
+							expr: &ruleRefExpr{
+								pos:  position{line: 582, col: 19, offset: 16788},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 582, col: 26, offset: 16795},
+							val:        "json",
+							ignoreCase: false,
+							want:       "\"json\"",
+						},
+						&notExpr{
+							pos: position{line: 582, col: 33, offset: 16802},
+							expr: &ruleRefExpr{
+								pos:  position{line: 582, col: 34, offset: 16803},
+								name: "LabelChar",
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 582, col: 44, offset: 16813},
+							expr: &ruleRefExpr{
+								pos:  position{line: 582, col: 44, offset: 16813},
+								name: "space",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 582, col: 51, offset: 16820},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 582, col: 56, offset: 16825},
+								expr: &ruleRefExpr{
+									pos:  position{line: 582, col: 57, offset: 16826},
+									name: "Query",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LogfmtParser",
+			pos:  position{line: 615, col: 1, offset: 18239},
+			expr: &actionExpr{
+				pos: position{line: 615, col: 17, offset: 18255},
+				run: (*parser).callonLogfmtParser1,
+				expr: &seqExpr{
+					pos: position{line: 615, col: 17, offset: 18255},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 615, col: 17, offset: 18255},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 615, col: 21, offset: 18259},
+							expr: &ruleRefExpr{
+								pos:  position{line: 615, col: 21, offset: 18259},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 615, col: 28, offset: 18266},
+							val:        "logfmt",
+							ignoreCase: false,
+							want:       "\"logfmt\"",
+						},
+						&notExpr{
+							pos: position{line: 615, col: 37, offset: 18275},
+							expr: &ruleRefExpr{
+								pos:  position{line: 615, col: 38, offset: 18276},
+								name: "LabelChar",
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 615, col: 48, offset: 18286},
+							expr: &ruleRefExpr{
+								pos:  position{line: 615, col: 48, offset: 18286},
+								name: "space",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 615, col: 55, offset: 18293},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 615, col: 60, offset: 18298},
+								expr: &choiceExpr{
+									pos: position{line: 615, col: 61, offset: 18299},
+									alternatives: []any{
+										&ruleRefExpr{
+											pos:  position{line: 615, col: 61, offset: 18299},
+											name: "Query",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 615, col: 69, offset: 18307},
+											name: "SingleField",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RegexpParser",
+			pos:  position{line: 631, col: 1, offset: 19077},
+			expr: &actionExpr{
+				pos: position{line: 631, col: 17, offset: 19093},
+				run: (*parser).callonRegexpParser1,
+				expr: &seqExpr{
+					pos: position{line: 631, col: 17, offset: 19093},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 631, col: 17, offset: 19093},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 631, col: 21, offset: 19097},
+							expr: &ruleRefExpr{
+								pos:  position{line: 631, col: 21, offset: 19097},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 631, col: 28, offset: 19104},
+							val:        "regexp",
+							ignoreCase: false,
+							want:       "\"regexp\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 631, col: 37, offset: 19113},
+							expr: &ruleRefExpr{
+								pos:  position{line: 631, col: 37, offset: 19113},
+								name: "space",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 631, col: 44, offset: 19120},
+							label: "pattern",
+							expr: &ruleRefExpr{
+								pos:  position{line: 631, col: 52, offset: 19128},
+								name: "StringLiteral",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "PatternParser",
+			pos:  position{line: 635, col: 1, offset: 19188},
+			expr: &actionExpr{
+				pos: position{line: 635, col: 18, offset: 19205},
+				run: (*parser).callonPatternParser1,
+				expr: &seqExpr{
+					pos: position{line: 635, col: 18, offset: 19205},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 635, col: 18, offset: 19205},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 635, col: 22, offset: 19209},
+							expr: &ruleRefExpr{
+								pos:  position{line: 635, col: 22, offset: 19209},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 635, col: 29, offset: 19216},
+							val:        "pattern",
+							ignoreCase: false,
+							want:       "\"pattern\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 635, col: 39, offset: 19226},
+							expr: &ruleRefExpr{
+								pos:  position{line: 635, col: 39, offset: 19226},
+								name: "space",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 635, col: 46, offset: 19233},
+							label: "pattern",
+							expr: &ruleRefExpr{
+								pos:  position{line: 635, col: 54, offset: 19241},
+								name: "StringLiteral",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "UnpackParser",
+			pos:  position{line: 644, col: 1, offset: 19474},
+			expr: &actionExpr{
+				pos: position{line: 644, col: 17, offset: 19490},
+				run: (*parser).callonUnpackParser1,
+				expr: &seqExpr{
+					pos: position{line: 644, col: 17, offset: 19490},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 644, col: 17, offset: 19490},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 644, col: 21, offset: 19494},
+							expr: &ruleRefExpr{
+								pos:  position{line: 644, col: 21, offset: 19494},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 644, col: 28, offset: 19501},
+							val:        "unpack",
+							ignoreCase: false,
+							want:       "\"unpack\"",
+						},
+						&notExpr{
+							pos: position{line: 644, col: 37, offset: 19510},
+							expr: &ruleRefExpr{
+								pos:  position{line: 644, col: 38, offset: 19511},
+								name: "LabelChar",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LineFormat",
+			pos:  position{line: 648, col: 1, offset: 19554},
+			expr: &actionExpr{
+				pos: position{line: 648, col: 15, offset: 19568},
+				run: (*parser).callonLineFormat1,
+				expr: &seqExpr{
+					pos: position{line: 648, col: 15, offset: 19568},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 648, col: 15, offset: 19568},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 648, col: 19, offset: 19572},
+							expr: &ruleRefExpr{
+								pos:  position{line: 648, col: 19, offset: 19572},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 648, col: 26, offset: 19579},
+							val:        "line_format",
+							ignoreCase: false,
+							want:       "\"line_format\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 648, col: 40, offset: 19593},
+							expr: &ruleRefExpr{
+								pos:  position{line: 648, col: 40, offset: 19593},
+								name: "space",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 648, col: 47, offset: 19600},
+							label: "template",
+							expr: &ruleRefExpr{
+								pos:  position{line: 648, col: 56, offset: 19609},
+								name: "StringLiteral",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LabelFormat",
+			pos:  position{line: 656, col: 1, offset: 19829},
+			expr: &actionExpr{
+				pos: position{line: 656, col: 16, offset: 19844},
+				run: (*parser).callonLabelFormat1,
+				expr: &seqExpr{
+					pos: position{line: 656, col: 16, offset: 19844},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 656, col: 16, offset: 19844},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 656, col: 20, offset: 19848},
+							expr: &ruleRefExpr{
+								pos:  position{line: 656, col: 20, offset: 19848},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 656, col: 27, offset: 19855},
+							val:        "label_format",
+							ignoreCase: false,
+							want:       "\"label_format\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 656, col: 42, offset: 19870},
+							name: "space",
+						},
+						&labeledExpr{
+							pos:   position{line: 656, col: 48, offset: 19876},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 656, col: 54, offset: 19882},
+								name: "LabelFormatExpr",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 656, col: 70, offset: 19898},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 656, col: 75, offset: 19903},
+								expr: &seqExpr{
+									pos: position{line: 656, col: 76, offset: 19904},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 656, col: 76, offset: 19904},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 656, col: 78, offset: 19906},
+											val:        ",",
+											ignoreCase: false,
+											want:       "\",\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 656, col: 82, offset: 19910},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 656, col: 84, offset: 19912},
+											name: "LabelFormatExpr",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LabelFormatExpr",
+			pos:  position{line: 666, col: 1, offset: 20227},
+			expr: &choiceExpr{
+				pos: position{line: 666, col: 20, offset: 20246},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 666, col: 20, offset: 20246},
+						run: (*parser).callonLabelFormatExpr2,
+						expr: &seqExpr{
+							pos: position{line: 666, col: 20, offset: 20246},
+							exprs: []any{
+								&labeledExpr{
+									pos:   position{line: 666, col: 20, offset: 20246},
+									label: "dst",
+									expr: &ruleRefExpr{
+										pos:  position{line: 666, col: 24, offset: 20250},
+										name: "LabelName",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 666, col: 34, offset: 20260},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 666, col: 36, offset: 20262},
+									val:        "=",
+									ignoreCase: false,
+									want:       "\"=\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 666, col: 40, offset: 20266},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 666, col: 42, offset: 20268},
+									label: "template",
+									expr: &ruleRefExpr{
+										pos:  position{line: 666, col: 51, offset: 20277},
+										name: "StringLiteral",
+									},
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 672, col: 5, offset: 20461},
+						run: (*parser).callonLabelFormatExpr11,
+						expr: &seqExpr{
+							pos: position{line: 672, col: 5, offset: 20461},
+							exprs: []any{
+								&labeledExpr{
+									pos:   position{line: 672, col: 5, offset: 20461},
+									label: "dst",
+									expr: &ruleRefExpr{
+										pos:  position{line: 672, col: 9, offset: 20465},
+										name: "LabelName",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 672, col: 19, offset: 20475},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 672, col: 21, offset: 20477},
+									val:        "=",
+									ignoreCase: false,
+									want:       "\"=\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 672, col: 25, offset: 20481},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 672, col: 27, offset: 20483},
+									label: "src",
+									expr: &ruleRefExpr{
+										pos:  position{line: 672, col: 31, offset: 20487},
+										name: "LabelName",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "DropLabels",
+			pos:  position{line: 686, col: 1, offset: 20914},
+			expr: &actionExpr{
+				pos: position{line: 686, col: 15, offset: 20928},
+				run: (*parser).callonDropLabels1,
+				expr: &seqExpr{
+					pos: position{line: 686, col: 15, offset: 20928},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 686, col: 15, offset: 20928},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 686, col: 19, offset: 20932},
+							expr: &ruleRefExpr{
+								pos:  position{line: 686, col: 19, offset: 20932},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 686, col: 26, offset: 20939},
+							val:        "drop",
+							ignoreCase: false,
+							want:       "\"drop\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 686, col: 33, offset: 20946},
+							name: "space",
+						},
+						&labeledExpr{
+							pos:   position{line: 686, col: 39, offset: 20952},
+							label: "labels",
+							expr: &ruleRefExpr{
+								pos:  position{line: 686, col: 46, offset: 20959},
+								name: "LabelNameList",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "KeepLabels",
+			pos:  position{line: 692, col: 1, offset: 21173},
+			expr: &actionExpr{
+				pos: position{line: 692, col: 15, offset: 21187},
+				run: (*parser).callonKeepLabels1,
+				expr: &seqExpr{
+					pos: position{line: 692, col: 15, offset: 21187},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 692, col: 15, offset: 21187},
+							val:        "|",
+							ignoreCase: false,
+							want:       "\"|\"",
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 692, col: 19, offset: 21191},
+							expr: &ruleRefExpr{
+								pos:  position{line: 692, col: 19, offset: 21191},
+								name: "space",
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 692, col: 26, offset: 21198},
+							val:        "keep",
+							ignoreCase: false,
+							want:       "\"keep\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 692, col: 33, offset: 21205},
+							name: "space",
+						},
+						&labeledExpr{
+							pos:   position{line: 692, col: 39, offset: 21211},
+							label: "labels",
+							expr: &ruleRefExpr{
+								pos:  position{line: 692, col: 46, offset: 21218},
+								name: "LabelNameList",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "MetricExpr",
+			pos:  position{line: 699, col: 1, offset: 21482},
+			expr: &choiceExpr{
+				pos: position{line: 699, col: 15, offset: 21496},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 699, col: 15, offset: 21496},
+						name: "VectorAggregationExpr",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 699, col: 39, offset: 21520},
+						name: "RangeAggregationExpr",
+					},
+				},
+			},
+		},
+		{
+			name: "VectorAggregationExpr",
+			pos:  position{line: 701, col: 1, offset: 21542},
+			expr: &actionExpr{
+				pos: position{line: 701, col: 26, offset: 21567},
+				run: (*parser).callonVectorAggregationExpr1,
+				expr: &seqExpr{
+					pos: position{line: 701, col: 26, offset: 21567},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 701, col: 26, offset: 21567},
+							label: "op",
+							expr: &ruleRefExpr{
+								pos:  position{line: 701, col: 29, offset: 21570},
+								name: "VectorOp",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 701, col: 38, offset: 21579},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 701, col: 40, offset: 21581},
+							label: "before",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 701, col: 47, offset: 21588},
+								expr: &ruleRefExpr{
+									pos:  position{line: 701, col: 47, offset: 21588},
+									name: "Grouping",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 701, col: 57, offset: 21598},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 701, col: 59, offset: 21600},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 701, col: 63, offset: 21604},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 701, col: 65, offset: 21606},
+							label: "param",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 701, col: 71, offset: 21612},
+								expr: &seqExpr{
+									pos: position{line: 701, col: 72, offset: 21613},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 701, col: 72, offset: 21613},
+											name: "Integer",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 701, col: 80, offset: 21621},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 701, col: 82, offset: 21623},
+											val:        ",",
+											ignoreCase: false,
+											want:       "\",\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 701, col: 86, offset: 21627},
+											name: "_",
+										},
+									},
+								},
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 701, col: 90, offset: 21631},
+							label: "inner",
+							expr: &ruleRefExpr{
+								pos:  position{line: 701, col: 96, offset: 21637},
+								name: "MetricExpr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 701, col: 107, offset: 21648},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 701, col: 109, offset: 21650},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+						&labeledExpr{
+							pos:   position{line: 701, col: 113, offset: 21654},
+							label: "after",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 701, col: 119, offset: 21660},
+								expr: &seqExpr{
+									pos: position{line: 701, col: 120, offset: 21661},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 701, col: 120, offset: 21661},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 701, col: 122, offset: 21663},
+											name: "Grouping",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RangeAggregationExpr",
+			pos:  position{line: 728, col: 1, offset: 22696},
+			expr: &actionExpr{
+				pos: position{line: 728, col: 25, offset: 22720},
+				run: (*parser).callonRangeAggregationExpr1,
+				expr: &seqExpr{
+					pos: position{line: 728, col: 25, offset: 22720},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 728, col: 25, offset: 22720},
+							label: "function",
+							expr: &ruleRefExpr{
+								pos:  position{line: 728, col: 34, offset: 22729},
+								name: "RangeOp",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 728, col: 42, offset: 22737},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 728, col: 44, offset: 22739},
+							val:        "(",
+							ignoreCase: false,
+							want:       "\"(\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 728, col: 48, offset: 22743},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 728, col: 50, offset: 22745},
+							label: "param",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 728, col: 56, offset: 22751},
+								expr: &seqExpr{
+									pos: position{line: 728, col: 57, offset: 22752},
+									exprs: []any{
+										&choiceExpr{
+											pos: position{line: 728, col: 58, offset: 22753},
+											alternatives: []any{
+												&ruleRefExpr{
+													pos:  position{line: 728, col: 58, offset: 22753},
+													name: "Float",
+												},
+												&ruleRefExpr{
+													pos:  position{line: 728, col: 66, offset: 22761},
+													name: "Integer",
+												},
+											},
+										},
+										&ruleRefExpr{
+											pos:  position{line: 728, col: 75, offset: 22770},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 728, col: 77, offset: 22772},
+											val:        ",",
+											ignoreCase: false,
+											want:       "\",\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 728, col: 81, offset: 22776},
+											name: "_",
+										},
+									},
+								},
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 728, col: 85, offset: 22780},
+							label: "query",
+							expr: &ruleRefExpr{
+								pos:  position{line: 728, col: 91, offset: 22786},
+								name: "LogRangeExpr",
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 728, col: 104, offset: 22799},
+							name: "_",
+						},
+						&litMatcher{
+							pos:        position{line: 728, col: 106, offset: 22801},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
+						},
+						&labeledExpr{
+							pos:   position{line: 728, col: 110, offset: 22805},
+							label: "grouping",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 728, col: 119, offset: 22814},
+								expr: &seqExpr{
+									pos: position{line: 728, col: 120, offset: 22815},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 728, col: 120, offset: 22815},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 728, col: 122, offset: 22817},
+											name: "Grouping",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LogRangeExpr",
+			pos:  position{line: 739, col: 1, offset: 23126},
+			expr: &actionExpr{
+				pos: position{line: 739, col: 17, offset: 23142},
+				run: (*parser).callonLogRangeExpr1,
+				expr: &seqExpr{
+					pos: position{line: 739, col: 17, offset: 23142},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 739, col: 17, offset: 23142},
+							label: "query",
+							expr: &ruleRefExpr{
+								pos:  position{line: 739, col: 23, offset: 23148},
+								name: "Stream",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 739, col: 30, offset: 23155},
+							label: "stages",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 739, col: 37, offset: 23162},
+								expr: &ruleRefExpr{
+									pos:  position{line: 739, col: 37, offset: 23162},
+									name: "PipelineStage",
+								},
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 739, col: 52, offset: 23177},
+							label: "unwrap",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 739, col: 59, offset: 23184},
+								expr: &ruleRefExpr{
+									pos:  position{line: 739, col: 59, offset: 23184},
+									name: "Unwrap",
+								},
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 739, col: 67, offset: 23192},
+							label: "postStages",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 739, col: 78, offset: 23203},
+								expr: &ruleRefExpr{
+									pos:  position{line: 739, col: 78, offset: 23203},
+									name: "PipelineStage",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 739, col: 93, offset: 23218},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 739, col: 95, offset: 23220},
+							label: "duration",
+							expr: &ruleRefExpr{
+								pos:  position{line: 739, col: 104, offset: 23229},
+								name: "Duration",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Unwrap",
+			pos:  position{line: 752, col: 1, offset: 23590},
+			expr: &choiceExpr{
+				pos: position{line: 752, col: 11, offset: 23600},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 752, col: 11, offset: 23600},
+						run: (*parser).callonUnwrap2,
+						expr: &seqExpr{
+							pos: position{line: 752, col: 11, offset: 23600},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 752, col: 11, offset: 23600},
+									expr: &ruleRefExpr{
+										pos:  position{line: 752, col: 11, offset: 23600},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 752, col: 18, offset: 23607},
+									val:        "|",
+									ignoreCase: false,
+									want:       "\"|\"",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 752, col: 22, offset: 23611},
+									expr: &ruleRefExpr{
+										pos:  position{line: 752, col: 22, offset: 23611},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 752, col: 29, offset: 23618},
+									val:        "unwrap",
+									ignoreCase: false,
+									want:       "\"unwrap\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 752, col: 38, offset: 23627},
+									name: "space",
+								},
+								&labeledExpr{
+									pos:   position{line: 752, col: 44, offset: 23633},
+									label: "conversion",
+									expr: &choiceExpr{
+										pos: position{line: 752, col: 56, offset: 23645},
+										alternatives: []any{
+											&litMatcher{
+												pos:        position{line: 752, col: 56, offset: 23645},
+												val:        "duration_seconds",
+												ignoreCase: false,
+												want:       "\"duration_seconds\"",
+											},
+											&litMatcher{
+												pos:        position{line: 752, col: 77, offset: 23666},
+												val:        "duration",
+												ignoreCase: false,
+												want:       "\"duration\"",
+											},
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 752, col: 89, offset: 23678},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 752, col: 91, offset: 23680},
+									val:        "(",
+									ignoreCase: false,
+									want:       "\"(\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 752, col: 95, offset: 23684},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 752, col: 97, offset: 23686},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 752, col: 103, offset: 23692},
+										name: "LabelName",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 752, col: 113, offset: 23702},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 752, col: 115, offset: 23704},
+									val:        ")",
+									ignoreCase: false,
+									want:       "\")\"",
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 754, col: 5, offset: 23809},
+						run: (*parser).callonUnwrap22,
+						expr: &seqExpr{
+							pos: position{line: 754, col: 5, offset: 23809},
+							exprs: []any{
+								&zeroOrOneExpr{
+									pos: position{line: 754, col: 5, offset: 23809},
+									expr: &ruleRefExpr{
+										pos:  position{line: 754, col: 5, offset: 23809},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 754, col: 12, offset: 23816},
+									val:        "|",
+									ignoreCase: false,
+									want:       "\"|\"",
+								},
+								&zeroOrOneExpr{
+									pos: position{line: 754, col: 16, offset: 23820},
+									expr: &ruleRefExpr{
+										pos:  position{line: 754, col: 16, offset: 23820},
+										name: "space",
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 754, col: 23, offset: 23827},
+									val:        "unwrap",
+									ignoreCase: false,
+									want:       "\"unwrap\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 754, col: 32, offset: 23836},
+									name: "space",
+								},
+								&labeledExpr{
+									pos:   position{line: 754, col: 38, offset: 23842},
+									label: "field",
+									expr: &ruleRefExpr{
+										pos:  position{line: 754, col: 44, offset: 23848},
+										name: "LabelName",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Grouping",
+			pos:  position{line: 758, col: 1, offset: 23917},
+			expr: &actionExpr{
+				pos: position{line: 758, col: 13, offset: 23929},
+				run: (*parser).callonGrouping1,
+				expr: &seqExpr{
+					pos: position{line: 758, col: 13, offset: 23929},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 758, col: 13, offset: 23929},
+							label: "kind",
+							expr: &choiceExpr{
+								pos: position{line: 758, col: 19, offset: 23935},
+								alternatives: []any{
+									&litMatcher{
+										pos:        position{line: 758, col: 19, offset: 23935},
+										val:        "by",
+										ignoreCase: false,
+										want:       "\"by\"",
+									},
+									&litMatcher{
+										pos:        position{line: 758, col: 26, offset: 23942},
+										val:        "without",
+										ignoreCase: false,
+										want:       "\"without\"",
+									},
+								},
 							},
 						},
+						&ruleRefExpr{
+							pos:  position{line: 758, col: 37, offset: 23953},
+							name: "_",
+						},
 						&litMatcher{
-							pos:        position{line: 190, col: 23, offset: 5288},
-							val:        "|",
+							pos:        position{line: 758, col: 39, offset: 23955},
+							val:        "(",
 							ignoreCase: false,
-							want:       "\"|\"",
-						},
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 27, offset: 5292},
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 27, offset: 5292},
-								name: "space",
-							},
-						},
-						&labeledExpr{
-							pos:   position{line: 190, col: 34, offset: 5299},
-							label: "field",
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 40, offset: 5305},
-								name: "Field",
-							},
+							want:       "\"(\"",
 						},
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 46, offset: 5311},
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 46, offset: 5311},
-								name: "space",
-							},
+						&ruleRefExpr{
+							pos:  position{line: 758, col: 43, offset: 23959},
+							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 190, col: 53, offset: 5318},
-							label: "op",
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 56, offset: 5321},
-								name: "opCOMP",
+							pos:   position{line: 758, col: 45, offset: 23961},
+							label: "labels",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 758, col: 52, offset: 23968},
+								expr: &ruleRefExpr{
+									pos:  position{line: 758, col: 52, offset: 23968},
+									name: "LabelNameList",
+								},
 							},
 						},
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 63, offset: 5328},
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 63, offset: 5328},
-								name: "space",
-							},
+						&ruleRefExpr{
+							pos:  position{line: 758, col: 67, offset: 23983},
+							name: "_",
 						},
-						&labeledExpr{
-							pos:   position{line: 190, col: 70, offset: 5335},
-							label: "field1",
-							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 77, offset: 5342},
-								name: "Field",
-							},
+						&litMatcher{
+							pos:        position{line: 758, col: 69, offset: 23985},
+							val:        ")",
+							ignoreCase: false,
+							want:       "\")\"",
 						},
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 83, offset: 5348},
-							expr: &litMatcher{
-								pos:        position{line: 190, col: 83, offset: 5348},
-								val:        ",",
-								ignoreCase: false,
-								want:       "\",\"",
+					},
+				},
+			},
+		},
+		{
+			name: "VectorOp",
+			pos:  position{line: 766, col: 1, offset: 24170},
+			expr: &actionExpr{
+				pos: position{line: 766, col: 13, offset: 24182},
+				run: (*parser).callonVectorOp1,
+				expr: &seqExpr{
+					pos: position{line: 766, col: 13, offset: 24182},
+					exprs: []any{
+						&choiceExpr{
+							pos: position{line: 766, col: 14, offset: 24183},
+							alternatives: []any{
+								&litMatcher{
+									pos:        position{line: 766, col: 14, offset: 24183},
+									val:        "sum",
+									ignoreCase: false,
+									want:       "\"sum\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 22, offset: 24191},
+									val:        "avg",
+									ignoreCase: false,
+									want:       "\"avg\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 30, offset: 24199},
+									val:        "min",
+									ignoreCase: false,
+									want:       "\"min\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 38, offset: 24207},
+									val:        "max",
+									ignoreCase: false,
+									want:       "\"max\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 46, offset: 24215},
+									val:        "count",
+									ignoreCase: false,
+									want:       "\"count\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 56, offset: 24225},
+									val:        "topk",
+									ignoreCase: false,
+									want:       "\"topk\"",
+								},
+								&litMatcher{
+									pos:        position{line: 766, col: 65, offset: 24234},
+									val:        "bottomk",
+									ignoreCase: false,
+									want:       "\"bottomk\"",
+								},
 							},
 						},
-						&zeroOrOneExpr{
-							pos: position{line: 190, col: 88, offset: 5353},
+						&notExpr{
+							pos: position{line: 766, col: 76, offset: 24245},
 							expr: &ruleRefExpr{
-								pos:  position{line: 190, col: 88, offset: 5353},
-								name: "space",
+								pos:  position{line: 766, col: 77, offset: 24246},
+								name: "LabelChar",
 							},
 						},
 					},
@@ -503,156 +2393,129 @@ var g = &grammar{
 			},
 		},
 		{
-			name: "JSONFilter",
-			pos:  position{line: 201, col: 1, offset: 5571},
-			expr: &choiceExpr{
-				pos: position{line: 201, col: 15, offset: 5585},
-				alternatives: []any{
-					&actionExpr{
-						pos: position{line: 201, col: 15, offset: 5585},
-						run: (*parser).callonJSONFilter2,
-						expr: &seqExpr{
-							pos: position{line: 201, col: 15, offset: 5585},
-							exprs: []any{
-								&zeroOrOneExpr{
-									pos: position{line: 201, col: 15, offset: 5585},
-									expr: &ruleRefExpr{
-										pos:  position{line: 201, col: 15, offset: 5585},
-										name: "space",
-									},
-								},
+			name: "RangeOp",
+			pos:  position{line: 770, col: 1, offset: 24292},
+			expr: &actionExpr{
+				pos: position{line: 770, col: 12, offset: 24303},
+				run: (*parser).callonRangeOp1,
+				expr: &seqExpr{
+					pos: position{line: 770, col: 12, offset: 24303},
+					exprs: []any{
+						&choiceExpr{
+							pos: position{line: 770, col: 13, offset: 24304},
+							alternatives: []any{
 								&litMatcher{
-									pos:        position{line: 201, col: 22, offset: 5592},
-									val:        "|",
+									pos:        position{line: 770, col: 13, offset: 24304},
+									val:        "count_over_time",
 									ignoreCase: false,
-									want:       "\"|\"",
+									want:       "\"count_over_time\"",
 								},
-								&ruleRefExpr{
-									pos:  position{line: 201, col: 26, offset: 5596},
-									name: "space",
+								&litMatcher{
+									pos:        position{line: 770, col: 33, offset: 24324},
+									val:        "rate",
+									ignoreCase: false,
+									want:       "\"rate\"",
 								},
 								&litMatcher{
-									pos:        position{line: 201, col: 32, offset: 5602},
-									val:        "json",
+									pos:        position{line: 770, col: 42, offset: 24333},
+									val:        "bytes_over_time",
 									ignoreCase: false,
-									want:       "\"json\"",
+									want:       "\"bytes_over_time\"",
 								},
-								&zeroOrOneExpr{
-									pos: position{line: 201, col: 39, offset: 5609},
-									expr: &ruleRefExpr{
-										pos:  position{line: 201, col: 39, offset: 5609},
-										name: "space",
-									},
+								&litMatcher{
+									pos:        position{line: 770, col: 62, offset: 24353},
+									val:        "bytes_rate",
+									ignoreCase: false,
+									want:       "\"bytes_rate\"",
 								},
-								&labeledExpr{
-									pos:   position{line: 201, col: 46, offset: 5616},
-									label: "rest",
-									expr: &zeroOrMoreExpr{
-										pos: position{line: 201, col: 51, offset: 5621},
-										expr: &ruleRefExpr{
-											pos:  position{line: 201, col: 52, offset: 5622},
-											name: "Query",
-										},
-									},
+								&litMatcher{
+									pos:        position{line: 770, col: 77, offset: 24368},
+									val:        "avg_over_time",
+									ignoreCase: false,
+									want:       "\"avg_over_time\"",
 								},
-							},
-						},
-					},
-					&actionExpr{
-						pos: position{line: 232, col: 5, offset: 7012},
-						run: (*parser).callonJSONFilter14,
-						expr: &seqExpr{
-							pos: position{line: 232, col: 5, offset: 7012},
-							exprs: []any{
-								&zeroOrOneExpr{
-									pos: position{line: 232, col: 5, offset: 7012},
-									expr: &ruleRefExpr{
-										pos:  position{line: 232, col: 5, offset: 7012},
-										name: "space",
-									},
+								&litMatcher{
+									pos:        position{line: 770, col: 95, offset: 24386},
+									val:        "sum_over_time",
+									ignoreCase: false,
+									want:       "\"sum_over_time\"",
 								},
 								&litMatcher{
-									pos:        position{line: 232, col: 12, offset: 7019},
-									val:        "|",
+									pos:        position{line: 770, col: 113, offset: 24404},
+									val:        "min_over_time",
 									ignoreCase: false,
-									want:       "\"|\"",
+									want:       "\"min_over_time\"",
 								},
-								&ruleRefExpr{
-									pos:  position{line: 232, col: 16, offset: 7023},
-									name: "space",
+								&litMatcher{
+									pos:        position{line: 770, col: 131, offset: 24422},
+									val:        "max_over_time",
+									ignoreCase: false,
+									want:       "\"max_over_time\"",
 								},
 								&litMatcher{
-									pos:        position{line: 232, col: 22, offset: 7029},
-									val:        "logfmt",
+									pos:        position{line: 770, col: 149, offset: 24440},
+									val:        "first_over_time",
 									ignoreCase: false,
-									want:       "\"logfmt\"",
+									want:       "\"first_over_time\"",
 								},
-								&zeroOrOneExpr{
-									pos: position{line: 232, col: 31, offset: 7038},
-									expr: &ruleRefExpr{
-										pos:  position{line: 232, col: 31, offset: 7038},
-										name: "space",
-									},
+								&litMatcher{
+									pos:        position{line: 770, col: 169, offset: 24460},
+									val:        "last_over_time",
+									ignoreCase: false,
+									want:       "\"last_over_time\"",
 								},
-								&labeledExpr{
-									pos:   position{line: 232, col: 38, offset: 7045},
-									label: "rest",
-									expr: &zeroOrMoreExpr{
-										pos: position{line: 232, col: 43, offset: 7050},
-										expr: &choiceExpr{
-											pos: position{line: 232, col: 44, offset: 7051},
-											alternatives: []any{
-												&ruleRefExpr{
-													pos:  position{line: 232, col: 44, offset: 7051},
-													name: "Query",
-												},
-												&ruleRefExpr{
-													pos:  position{line: 232, col: 52, offset: 7059},
-													name: "SingleField",
-												},
-											},
-										},
-									},
+								&litMatcher{
+									pos:        position{line: 770, col: 188, offset: 24479},
+									val:        "quantile_over_time",
+									ignoreCase: false,
+									want:       "\"quantile_over_time\"",
 								},
 							},
 						},
+						&notExpr{
+							pos: position{line: 770, col: 210, offset: 24501},
+							expr: &ruleRefExpr{
+								pos:  position{line: 770, col: 211, offset: 24502},
+								name: "LabelChar",
+							},
+						},
 					},
 				},
 			},
 		},
 		{
 			name: "Duration",
-			pos:  position{line: 245, col: 1, offset: 7721},
+			pos:  position{line: 774, col: 1, offset: 24548},
 			expr: &actionExpr{
-				pos: position{line: 245, col: 13, offset: 7733},
+				pos: position{line: 774, col: 13, offset: 24560},
 				run: (*parser).callonDuration1,
 				expr: &seqExpr{
-					pos: position{line: 245, col: 13, offset: 7733},
+					pos: position{line: 774, col: 13, offset: 24560},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 245, col: 13, offset: 7733},
+							pos:        position{line: 774, col: 13, offset: 24560},
 							val:        "[",
 							ignoreCase: false,
 							want:       "\"[\"",
 						},
 						&labeledExpr{
-							pos:   position{line: 245, col: 17, offset: 7737},
+							pos:   position{line: 774, col: 17, offset: 24564},
 							label: "val",
 							expr: &ruleRefExpr{
-								pos:  position{line: 245, col: 21, offset: 7741},
+								pos:  position{line: 774, col: 21, offset: 24568},
 								name: "Integer",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 245, col: 29, offset: 7749},
+							pos:   position{line: 774, col: 29, offset: 24576},
 							label: "timeUnit",
 							expr: &ruleRefExpr{
-								pos:  position{line: 245, col: 38, offset: 7758},
+								pos:  position{line: 774, col: 38, offset: 24585},
 								name: "TIME_UNIT",
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 245, col: 48, offset: 7768},
+							pos:        position{line: 774, col: 48, offset: 24595},
 							val:        "]",
 							ignoreCase: false,
 							want:       "\"]\"",
@@ -663,27 +2526,27 @@ var g = &grammar{
 		},
 		{
 			name: "VectorArithmeticExpr",
-			pos:  position{line: 259, col: 1, offset: 8122},
+			pos:  position{line: 788, col: 1, offset: 24949},
 			expr: &actionExpr{
-				pos: position{line: 259, col: 25, offset: 8146},
+				pos: position{line: 788, col: 25, offset: 24973},
 				run: (*parser).callonVectorArithmeticExpr1,
 				expr: &seqExpr{
-					pos: position{line: 259, col: 25, offset: 8146},
+					pos: position{line: 788, col: 25, offset: 24973},
 					exprs: []any{
 						&ruleRefExpr{
-							pos:  position{line: 259, col: 25, offset: 8146},
+							pos:  position{line: 788, col: 25, offset: 24973},
 							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 259, col: 27, offset: 8148},
+							pos:   position{line: 788, col: 27, offset: 24975},
 							label: "expr",
 							expr: &ruleRefExpr{
-								pos:  position{line: 259, col: 32, offset: 8153},
+								pos:  position{line: 788, col: 32, offset: 24980},
 								name: "ArithmeticExpr",
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 259, col: 47, offset: 8168},
+							pos:  position{line: 788, col: 47, offset: 24995},
 							name: "_",
 						},
 					},
@@ -692,52 +2555,52 @@ var g = &grammar{
 		},
 		{
 			name: "ArithmeticExpr",
-			pos:  position{line: 264, col: 1, offset: 8231},
+			pos:  position{line: 793, col: 1, offset: 25058},
 			expr: &actionExpr{
-				pos: position{line: 264, col: 19, offset: 8249},
+				pos: position{line: 793, col: 19, offset: 25076},
 				run: (*parser).callonArithmeticExpr1,
 				expr: &seqExpr{
-					pos: position{line: 264, col: 19, offset: 8249},
+					pos: position{line: 793, col: 19, offset: 25076},
 					exprs: []any{
 						&labeledExpr{
-							pos:   position{line: 264, col: 19, offset: 8249},
+							pos:   position{line: 793, col: 19, offset: 25076},
 							label: "head",
 							expr: &ruleRefExpr{
-								pos:  position{line: 264, col: 24, offset: 8254},
+								pos:  position{line: 793, col: 24, offset: 25081},
 								name: "Term",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 264, col: 29, offset: 8259},
+							pos:   position{line: 793, col: 29, offset: 25086},
 							label: "tail",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 264, col: 34, offset: 8264},
+								pos: position{line: 793, col: 34, offset: 25091},
 								expr: &seqExpr{
-									pos: position{line: 264, col: 35, offset: 8265},
+									pos: position{line: 793, col: 35, offset: 25092},
 									exprs: []any{
 										&ruleRefExpr{
-											pos:  position{line: 264, col: 35, offset: 8265},
+											pos:  position{line: 793, col: 35, offset: 25092},
 											name: "_",
 										},
 										&choiceExpr{
-											pos: position{line: 264, col: 38, offset: 8268},
+											pos: position{line: 793, col: 38, offset: 25095},
 											alternatives: []any{
 												&ruleRefExpr{
-													pos:  position{line: 264, col: 38, offset: 8268},
+													pos:  position{line: 793, col: 38, offset: 25095},
 													name: "Add",
 												},
 												&ruleRefExpr{
-													pos:  position{line: 264, col: 44, offset: 8274},
+													pos:  position{line: 793, col: 44, offset: 25101},
 													name: "Subtract",
 												},
 											},
 										},
 										&ruleRefExpr{
-											pos:  position{line: 264, col: 54, offset: 8284},
+											pos:  position{line: 793, col: 54, offset: 25111},
 											name: "_",
 										},
 										&ruleRefExpr{
-											pos:  position{line: 264, col: 56, offset: 8286},
+											pos:  position{line: 793, col: 56, offset: 25113},
 											name: "Term",
 										},
 									},
@@ -750,56 +2613,56 @@ var g = &grammar{
 		},
 		{
 			name: "Term",
-			pos:  position{line: 281, col: 1, offset: 8780},
+			pos:  position{line: 810, col: 1, offset: 25607},
 			expr: &actionExpr{
-				pos: position{line: 281, col: 9, offset: 8788},
+				pos: position{line: 810, col: 9, offset: 25615},
 				run: (*parser).callonTerm1,
 				expr: &seqExpr{
-					pos: position{line: 281, col: 9, offset: 8788},
+					pos: position{line: 810, col: 9, offset: 25615},
 					exprs: []any{
 						&labeledExpr{
-							pos:   position{line: 281, col: 9, offset: 8788},
+							pos:   position{line: 810, col: 9, offset: 25615},
 							label: "head",
 							expr: &ruleRefExpr{
-								pos:  position{line: 281, col: 14, offset: 8793},
+								pos:  position{line: 810, col: 14, offset: 25620},
 								name: "VectorExpr",
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 281, col: 25, offset: 8804},
+							pos:   position{line: 810, col: 25, offset: 25631},
 							label: "tail",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 281, col: 30, offset: 8809},
+								pos: position{line: 810, col: 30, offset: 25636},
 								expr: &seqExpr{
-									pos: position{line: 281, col: 31, offset: 8810},
+									pos: position{line: 810, col: 31, offset: 25637},
 									exprs: []any{
 										&ruleRefExpr{
-											pos:  position{line: 281, col: 31, offset: 8810},
+											pos:  position{line: 810, col: 31, offset: 25637},
 											name: "_",
 										},
 										&choiceExpr{
-											pos: position{line: 281, col: 34, offset: 8813},
+											pos: position{line: 810, col: 34, offset: 25640},
 											alternatives: []any{
 												&ruleRefExpr{
-													pos:  position{line: 281, col: 34, offset: 8813},
+													pos:  position{line: 810, col: 34, offset: 25640},
 													name: "Multiply",
 												},
 												&ruleRefExpr{
-													pos:  position{line: 281, col: 45, offset: 8824},
+													pos:  position{line: 810, col: 45, offset: 25651},
 													name: "Divide",
 												},
 												&ruleRefExpr{
-													pos:  position{line: 281, col: 54, offset: 8833},
+													pos:  position{line: 810, col: 54, offset: 25660},
 													name: "Modulo",
 												},
 											},
 										},
 										&ruleRefExpr{
-											pos:  position{line: 281, col: 62, offset: 8841},
+											pos:  position{line: 810, col: 62, offset: 25668},
 											name: "_",
 										},
 										&ruleRefExpr{
-											pos:  position{line: 281, col: 64, offset: 8843},
+											pos:  position{line: 810, col: 64, offset: 25670},
 											name: "VectorExpr",
 										},
 									},
@@ -812,56 +2675,56 @@ var g = &grammar{
 		},
 		{
 			name: "VectorExpr",
-			pos:  position{line: 298, col: 1, offset: 9302},
+			pos:  position{line: 827, col: 1, offset: 26129},
 			expr: &actionExpr{
-				pos: position{line: 298, col: 15, offset: 9316},
+				pos: position{line: 827, col: 15, offset: 26143},
 				run: (*parser).callonVectorExpr1,
 				expr: &seqExpr{
-					pos: position{line: 298, col: 15, offset: 9316},
+					pos: position{line: 827, col: 15, offset: 26143},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 298, col: 15, offset: 9316},
+							pos:        position{line: 827, col: 15, offset: 26143},
 							val:        "vector",
 							ignoreCase: false,
 							want:       "\"vector\"",
 						},
 						&ruleRefExpr{
-							pos:  position{line: 298, col: 24, offset: 9325},
+							pos:  position{line: 827, col: 24, offset: 26152},
 							name: "_",
 						},
 						&litMatcher{
-							pos:        position{line: 298, col: 26, offset: 9327},
+							pos:        position{line: 827, col: 26, offset: 26154},
 							val:        "(",
 							ignoreCase: false,
 							want:       "\"(\"",
 						},
 						&ruleRefExpr{
-							pos:  position{line: 298, col: 30, offset: 9331},
+							pos:  position{line: 827, col: 30, offset: 26158},
 							name: "_",
 						},
 						&labeledExpr{
-							pos:   position{line: 298, col: 32, offset: 9333},
+							pos:   position{line: 827, col: 32, offset: 26160},
 							label: "value",
 							expr: &choiceExpr{
-								pos: position{line: 298, col: 39, offset: 9340},
+								pos: position{line: 827, col: 39, offset: 26167},
 								alternatives: []any{
 									&ruleRefExpr{
-										pos:  position{line: 298, col: 39, offset: 9340},
+										pos:  position{line: 827, col: 39, offset: 26167},
 										name: "Float",
 									},
 									&ruleRefExpr{
-										pos:  position{line: 298, col: 47, offset: 9348},
+										pos:  position{line: 827, col: 47, offset: 26175},
 										name: "Integer",
 									},
 								},
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 298, col: 56, offset: 9357},
+							pos:  position{line: 827, col: 56, offset: 26184},
 							name: "_",
 						},
 						&litMatcher{
-							pos:        position{line: 298, col: 58, offset: 9359},
+							pos:        position{line: 827, col: 58, offset: 26186},
 							val:        ")",
 							ignoreCase: false,
 							want:       "\")\"",
@@ -872,75 +2735,75 @@ var g = &grammar{
 		},
 		{
 			name: "TIME_UNIT",
-			pos:  position{line: 308, col: 1, offset: 9570},
+			pos:  position{line: 837, col: 1, offset: 26397},
 			expr: &choiceExpr{
-				pos: position{line: 308, col: 14, offset: 9583},
+				pos: position{line: 837, col: 14, offset: 26410},
 				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 308, col: 14, offset: 9583},
+						pos: position{line: 837, col: 14, offset: 26410},
 						run: (*parser).callonTIME_UNIT2,
 						expr: &litMatcher{
-							pos:        position{line: 308, col: 14, offset: 9583},
+							pos:        position{line: 837, col: 14, offset: 26410},
 							val:        "ms",
 							ignoreCase: false,
 							want:       "\"ms\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 310, col: 5, offset: 9620},
+						pos: position{line: 839, col: 5, offset: 26447},
 						run: (*parser).callonTIME_UNIT4,
 						expr: &litMatcher{
-							pos:        position{line: 310, col: 5, offset: 9620},
+							pos:        position{line: 839, col: 5, offset: 26447},
 							val:        "s",
 							ignoreCase: false,
 							want:       "\"s\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 312, col: 5, offset: 9659},
+						pos: position{line: 841, col: 5, offset: 26486},
 						run: (*parser).callonTIME_UNIT6,
 						expr: &litMatcher{
-							pos:        position{line: 312, col: 5, offset: 9659},
+							pos:        position{line: 841, col: 5, offset: 26486},
 							val:        "m",
 							ignoreCase: false,
 							want:       "\"m\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 314, col: 5, offset: 9699},
+						pos: position{line: 843, col: 5, offset: 26526},
 						run: (*parser).callonTIME_UNIT8,
 						expr: &litMatcher{
-							pos:        position{line: 314, col: 5, offset: 9699},
+							pos:        position{line: 843, col: 5, offset: 26526},
 							val:        "h",
 							ignoreCase: false,
 							want:       "\"h\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 316, col: 5, offset: 9744},
+						pos: position{line: 845, col: 5, offset: 26571},
 						run: (*parser).callonTIME_UNIT10,
 						expr: &litMatcher{
-							pos:        position{line: 316, col: 5, offset: 9744},
+							pos:        position{line: 845, col: 5, offset: 26571},
 							val:        "d",
 							ignoreCase: false,
 							want:       "\"d\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 318, col: 5, offset: 9794},
+						pos: position{line: 847, col: 5, offset: 26621},
 						run: (*parser).callonTIME_UNIT12,
 						expr: &litMatcher{
-							pos:        position{line: 318, col: 5, offset: 9794},
+							pos:        position{line: 847, col: 5, offset: 26621},
 							val:        "w",
 							ignoreCase: false,
 							want:       "\"w\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 320, col: 5, offset: 9848},
+						pos: position{line: 849, col: 5, offset: 26675},
 						run: (*parser).callonTIME_UNIT14,
 						expr: &litMatcher{
-							pos:        position{line: 320, col: 5, offset: 9848},
+							pos:        position{line: 849, col: 5, offset: 26675},
 							val:        "y",
 							ignoreCase: false,
 							want:       "\"y\"",
@@ -951,99 +2814,99 @@ var g = &grammar{
 		},
 		{
 			name: "opCOMP",
-			pos:  position{line: 324, col: 1, offset: 9903},
+			pos:  position{line: 853, col: 1, offset: 26730},
 			expr: &choiceExpr{
-				pos: position{line: 324, col: 11, offset: 9913},
+				pos: position{line: 853, col: 11, offset: 26740},
 				alternatives: []any{
 					&ruleRefExpr{
-						pos:  position{line: 324, col: 11, offset: 9913},
+						pos:  position{line: 853, col: 11, offset: 26740},
 						name: "opCustom",
 					},
 					&actionExpr{
-						pos: position{line: 325, col: 3, offset: 9924},
+						pos: position{line: 854, col: 3, offset: 26751},
 						run: (*parser).callonopCOMP3,
 						expr: &litMatcher{
-							pos:        position{line: 325, col: 3, offset: 9924},
+							pos:        position{line: 854, col: 3, offset: 26751},
 							val:        "==",
 							ignoreCase: false,
 							want:       "\"==\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 327, col: 5, offset: 9955},
+						pos: position{line: 856, col: 5, offset: 26782},
 						run: (*parser).callonopCOMP5,
 						expr: &litMatcher{
-							pos:        position{line: 327, col: 5, offset: 9955},
+							pos:        position{line: 856, col: 5, offset: 26782},
 							val:        "=~",
 							ignoreCase: false,
 							want:       "\"=~\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 329, col: 5, offset: 9986},
+						pos: position{line: 858, col: 5, offset: 26813},
 						run: (*parser).callonopCOMP7,
 						expr: &litMatcher{
-							pos:        position{line: 329, col: 5, offset: 9986},
+							pos:        position{line: 858, col: 5, offset: 26813},
 							val:        "<=",
 							ignoreCase: false,
 							want:       "\"<=\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 331, col: 5, offset: 10028},
+						pos: position{line: 860, col: 5, offset: 26855},
 						run: (*parser).callonopCOMP9,
 						expr: &litMatcher{
-							pos:        position{line: 331, col: 5, offset: 10028},
+							pos:        position{line: 860, col: 5, offset: 26855},
 							val:        ">=",
 							ignoreCase: false,
 							want:       "\">=\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 333, col: 5, offset: 10070},
+						pos: position{line: 862, col: 5, offset: 26897},
 						run: (*parser).callonopCOMP11,
 						expr: &litMatcher{
-							pos:        position{line: 333, col: 5, offset: 10070},
+							pos:        position{line: 862, col: 5, offset: 26897},
 							val:        "=",
 							ignoreCase: false,
 							want:       "\"=\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 335, col: 5, offset: 10111},
+						pos: position{line: 864, col: 5, offset: 26938},
 						run: (*parser).callonopCOMP13,
 						expr: &litMatcher{
-							pos:        position{line: 335, col: 5, offset: 10111},
+							pos:        position{line: 864, col: 5, offset: 26938},
 							val:        "<",
 							ignoreCase: false,
 							want:       "\"<\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 337, col: 5, offset: 10152},
+						pos: position{line: 866, col: 5, offset: 26979},
 						run: (*parser).callonopCOMP15,
 						expr: &litMatcher{
-							pos:        position{line: 337, col: 5, offset: 10152},
+							pos:        position{line: 866, col: 5, offset: 26979},
 							val:        ">",
 							ignoreCase: false,
 							want:       "\">\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 339, col: 5, offset: 10193},
+						pos: position{line: 868, col: 5, offset: 27020},
 						run: (*parser).callonopCOMP17,
 						expr: &litMatcher{
-							pos:        position{line: 339, col: 5, offset: 10193},
+							pos:        position{line: 868, col: 5, offset: 27020},
 							val:        "!=",
 							ignoreCase: false,
 							want:       "\"!=\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 341, col: 5, offset: 10235},
+						pos: position{line: 870, col: 5, offset: 27062},
 						run: (*parser).callonopCOMP19,
 						expr: &litMatcher{
-							pos:        position{line: 341, col: 5, offset: 10235},
+							pos:        position{line: 870, col: 5, offset: 27062},
 							val:        "!~",
 							ignoreCase: false,
 							want:       "\"!~\"",
@@ -1054,45 +2917,83 @@ var g = &grammar{
 		},
 		{
 			name: "GrepFilter",
-			pos:  position{line: 345, col: 1, offset: 10267},
+			pos:  position{line: 874, col: 1, offset: 27094},
 			expr: &choiceExpr{
-				pos: position{line: 345, col: 15, offset: 10281},
+				pos: position{line: 874, col: 15, offset: 27108},
 				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 345, col: 15, offset: 10281},
+						pos: position{line: 874, col: 15, offset: 27108},
 						run: (*parser).callonGrepFilter2,
 						expr: &litMatcher{
-							pos:        position{line: 345, col: 15, offset: 10281},
+							pos:        position{line: 874, col: 15, offset: 27108},
 							val:        "|=",
 							ignoreCase: false,
 							want:       "\"|=\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 347, col: 5, offset: 10312},
+						pos: position{line: 876, col: 5, offset: 27139},
 						run: (*parser).callonGrepFilter4,
 						expr: &litMatcher{
-							pos:        position{line: 347, col: 5, offset: 10312},
+							pos:        position{line: 876, col: 5, offset: 27139},
 							val:        "!=",
 							ignoreCase: false,
 							want:       "\"!=\"",
 						},
 					},
+				},
+			},
+		},
+		{
+			name: "LineRegexOp",
+			pos:  position{line: 880, col: 1, offset: 27180},
+			expr: &choiceExpr{
+				pos: position{line: 880, col: 16, offset: 27195},
+				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 349, col: 5, offset: 10354},
-						run: (*parser).callonGrepFilter6,
+						pos: position{line: 880, col: 16, offset: 27195},
+						run: (*parser).callonLineRegexOp2,
 						expr: &litMatcher{
-							pos:        position{line: 349, col: 5, offset: 10354},
+							pos:        position{line: 880, col: 16, offset: 27195},
 							val:        "|~",
 							ignoreCase: false,
 							want:       "\"|~\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 351, col: 5, offset: 10386},
-						run: (*parser).callonGrepFilter8,
+						pos: position{line: 882, col: 5, offset: 27226},
+						run: (*parser).callonLineRegexOp4,
+						expr: &litMatcher{
+							pos:        position{line: 882, col: 5, offset: 27226},
+							val:        "!~",
+							ignoreCase: false,
+							want:       "\"!~\"",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RegexMatchOp",
+			pos:  position{line: 886, col: 1, offset: 27257},
+			expr: &choiceExpr{
+				pos: position{line: 886, col: 17, offset: 27273},
+				alternatives: []any{
+					&actionExpr{
+						pos: position{line: 886, col: 17, offset: 27273},
+						run: (*parser).callonRegexMatchOp2,
+						expr: &litMatcher{
+							pos:        position{line: 886, col: 17, offset: 27273},
+							val:        "=~",
+							ignoreCase: false,
+							want:       "\"=~\"",
+						},
+					},
+					&actionExpr{
+						pos: position{line: 888, col: 5, offset: 27304},
+						run: (*parser).callonRegexMatchOp4,
 						expr: &litMatcher{
-							pos:        position{line: 351, col: 5, offset: 10386},
+							pos:        position{line: 888, col: 5, offset: 27304},
 							val:        "!~",
 							ignoreCase: false,
 							want:       "\"!~\"",
@@ -1103,26 +3004,26 @@ var g = &grammar{
 		},
 		{
 			name: "opCustom",
-			pos:  position{line: 356, col: 1, offset: 10419},
+			pos:  position{line: 893, col: 1, offset: 27336},
 			expr: &actionExpr{
-				pos: position{line: 356, col: 13, offset: 10431},
+				pos: position{line: 893, col: 13, offset: 27348},
 				run: (*parser).callonopCustom1,
 				expr: &seqExpr{
-					pos: position{line: 356, col: 13, offset: 10431},
+					pos: position{line: 893, col: 13, offset: 27348},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 356, col: 13, offset: 10431},
+							pos:        position{line: 893, col: 13, offset: 27348},
 							val:        "=",
 							ignoreCase: false,
 							want:       "\"=\"",
 						},
 						&labeledExpr{
-							pos:   position{line: 356, col: 17, offset: 10435},
+							pos:   position{line: 893, col: 17, offset: 27352},
 							label: "opname",
 							expr: &oneOrMoreExpr{
-								pos: position{line: 356, col: 24, offset: 10442},
+								pos: position{line: 893, col: 24, offset: 27359},
 								expr: &charClassMatcher{
-									pos:        position{line: 356, col: 24, offset: 10442},
+									pos:        position{line: 893, col: 24, offset: 27359},
 									val:        "[a-z]i",
 									ranges:     []rune{'a', 'z'},
 									ignoreCase: true,
@@ -1131,7 +3032,7 @@ var g = &grammar{
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 356, col: 32, offset: 10450},
+							pos:        position{line: 893, col: 32, offset: 27367},
 							val:        "=",
 							ignoreCase: false,
 							want:       "\"=\"",
@@ -1142,25 +3043,25 @@ var g = &grammar{
 		},
 		{
 			name: "LetOpr",
-			pos:  position{line: 361, col: 1, offset: 10497},
+			pos:  position{line: 898, col: 1, offset: 27414},
 			expr: &choiceExpr{
-				pos: position{line: 361, col: 11, offset: 10507},
+				pos: position{line: 898, col: 11, offset: 27424},
 				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 361, col: 11, offset: 10507},
+						pos: position{line: 898, col: 11, offset: 27424},
 						run: (*parser).callonLetOpr2,
 						expr: &seqExpr{
-							pos: position{line: 361, col: 11, offset: 10507},
+							pos: position{line: 898, col: 11, offset: 27424},
 							exprs: []any{
 								&charClassMatcher{
-									pos:        position{line: 361, col: 11, offset: 10507},
+									pos:        position{line: 898, col: 11, offset: 27424},
 									val:        "[>]",
 									chars:      []rune{'>'},
 									ignoreCase: false,
 									inverted:   false,
 								},
 								&litMatcher{
-									pos:        position{line: 361, col: 15, offset: 10511},
+									pos:        position{line: 898, col: 15, offset: 27428},
 									val:        "=",
 									ignoreCase: false,
 									want:       "\"=\"",
@@ -1169,30 +3070,30 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 363, col: 5, offset: 10567},
+						pos: position{line: 900, col: 5, offset: 27484},
 						run: (*parser).callonLetOpr6,
 						expr: &litMatcher{
-							pos:        position{line: 363, col: 5, offset: 10567},
+							pos:        position{line: 900, col: 5, offset: 27484},
 							val:        ">",
 							ignoreCase: false,
 							want:       "\">\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 365, col: 5, offset: 10614},
+						pos: position{line: 902, col: 5, offset: 27531},
 						run: (*parser).callonLetOpr8,
 						expr: &seqExpr{
-							pos: position{line: 365, col: 5, offset: 10614},
+							pos: position{line: 902, col: 5, offset: 27531},
 							exprs: []any{
 								&charClassMatcher{
-									pos:        position{line: 365, col: 5, offset: 10614},
+									pos:        position{line: 902, col: 5, offset: 27531},
 									val:        "[<]",
 									chars:      []rune{'<'},
 									ignoreCase: false,
 									inverted:   false,
 								},
 								&litMatcher{
-									pos:        position{line: 365, col: 9, offset: 10618},
+									pos:        position{line: 902, col: 9, offset: 27535},
 									val:        "=",
 									ignoreCase: false,
 									want:       "\"=\"",
@@ -1201,30 +3102,30 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 367, col: 5, offset: 10671},
+						pos: position{line: 904, col: 5, offset: 27588},
 						run: (*parser).callonLetOpr12,
 						expr: &litMatcher{
-							pos:        position{line: 367, col: 5, offset: 10671},
+							pos:        position{line: 904, col: 5, offset: 27588},
 							val:        "<",
 							ignoreCase: false,
 							want:       "\"<\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 369, col: 5, offset: 10715},
+						pos: position{line: 906, col: 5, offset: 27632},
 						run: (*parser).callonLetOpr14,
 						expr: &seqExpr{
-							pos: position{line: 369, col: 5, offset: 10715},
+							pos: position{line: 906, col: 5, offset: 27632},
 							exprs: []any{
 								&charClassMatcher{
-									pos:        position{line: 369, col: 5, offset: 10715},
+									pos:        position{line: 906, col: 5, offset: 27632},
 									val:        "[=]",
 									chars:      []rune{'='},
 									ignoreCase: false,
 									inverted:   false,
 								},
 								&litMatcher{
-									pos:        position{line: 369, col: 9, offset: 10719},
+									pos:        position{line: 906, col: 9, offset: 27636},
 									val:        "=",
 									ignoreCase: false,
 									want:       "\"=\"",
@@ -1233,20 +3134,20 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 371, col: 5, offset: 10761},
+						pos: position{line: 908, col: 5, offset: 27678},
 						run: (*parser).callonLetOpr18,
 						expr: &seqExpr{
-							pos: position{line: 371, col: 5, offset: 10761},
+							pos: position{line: 908, col: 5, offset: 27678},
 							exprs: []any{
 								&charClassMatcher{
-									pos:        position{line: 371, col: 5, offset: 10761},
+									pos:        position{line: 908, col: 5, offset: 27678},
 									val:        "[!]",
 									chars:      []rune{'!'},
 									ignoreCase: false,
 									inverted:   false,
 								},
 								&litMatcher{
-									pos:        position{line: 371, col: 9, offset: 10765},
+									pos:        position{line: 908, col: 9, offset: 27682},
 									val:        "=",
 									ignoreCase: false,
 									want:       "\"=\"",
@@ -1255,50 +3156,50 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 373, col: 5, offset: 10810},
+						pos: position{line: 910, col: 5, offset: 27727},
 						run: (*parser).callonLetOpr22,
 						expr: &litMatcher{
-							pos:        position{line: 373, col: 5, offset: 10810},
+							pos:        position{line: 910, col: 5, offset: 27727},
 							val:        "+",
 							ignoreCase: false,
 							want:       "\"+\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 375, col: 5, offset: 10849},
+						pos: position{line: 912, col: 5, offset: 27766},
 						run: (*parser).callonLetOpr24,
 						expr: &litMatcher{
-							pos:        position{line: 375, col: 5, offset: 10849},
+							pos:        position{line: 912, col: 5, offset: 27766},
 							val:        "-",
 							ignoreCase: false,
 							want:       "\"-\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 377, col: 5, offset: 10893},
+						pos: position{line: 914, col: 5, offset: 27810},
 						run: (*parser).callonLetOpr26,
 						expr: &litMatcher{
-							pos:        position{line: 377, col: 5, offset: 10893},
+							pos:        position{line: 914, col: 5, offset: 27810},
 							val:        "/",
 							ignoreCase: false,
 							want:       "\"/\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 379, col: 5, offset: 10935},
+						pos: position{line: 916, col: 5, offset: 27852},
 						run: (*parser).callonLetOpr28,
 						expr: &litMatcher{
-							pos:        position{line: 379, col: 5, offset: 10935},
+							pos:        position{line: 916, col: 5, offset: 27852},
 							val:        "*",
 							ignoreCase: false,
 							want:       "\"*\"",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 381, col: 5, offset: 10979},
+						pos: position{line: 918, col: 5, offset: 27896},
 						run: (*parser).callonLetOpr30,
 						expr: &litMatcher{
-							pos:        position{line: 381, col: 5, offset: 10979},
+							pos:        position{line: 918, col: 5, offset: 27896},
 							val:        "%",
 							ignoreCase: false,
 							want:       "\"%\"",
@@ -1309,67 +3210,67 @@ var g = &grammar{
 		},
 		{
 			name: "LetIdentifier",
-			pos:  position{line: 385, col: 1, offset: 11020},
+			pos:  position{line: 922, col: 1, offset: 27937},
 			expr: &choiceExpr{
-				pos: position{line: 385, col: 18, offset: 11037},
+				pos: position{line: 922, col: 18, offset: 27954},
 				alternatives: []any{
 					&actionExpr{
-						pos: position{line: 385, col: 18, offset: 11037},
+						pos: position{line: 922, col: 18, offset: 27954},
 						run: (*parser).callonLetIdentifier2,
 						expr: &seqExpr{
-							pos: position{line: 385, col: 18, offset: 11037},
+							pos: position{line: 922, col: 18, offset: 27954},
 							exprs: []any{
 								&zeroOrOneExpr{
-									pos: position{line: 385, col: 18, offset: 11037},
+									pos: position{line: 922, col: 18, offset: 27954},
 									expr: &litMatcher{
-										pos:        position{line: 385, col: 18, offset: 11037},
+										pos:        position{line: 922, col: 18, offset: 27954},
 										val:        "-",
 										ignoreCase: false,
 										want:       "\"-\"",
 									},
 								},
 								&ruleRefExpr{
-									pos:  position{line: 385, col: 23, offset: 11042},
+									pos:  position{line: 922, col: 23, offset: 27959},
 									name: "Float",
 								},
 							},
 						},
 					},
 					&actionExpr{
-						pos: position{line: 391, col: 5, offset: 11237},
+						pos: position{line: 928, col: 5, offset: 28154},
 						run: (*parser).callonLetIdentifier7,
 						expr: &seqExpr{
-							pos: position{line: 391, col: 5, offset: 11237},
+							pos: position{line: 928, col: 5, offset: 28154},
 							exprs: []any{
 								&oneOrMoreExpr{
-									pos: position{line: 391, col: 5, offset: 11237},
+									pos: position{line: 928, col: 5, offset: 28154},
 									expr: &litMatcher{
-										pos:        position{line: 391, col: 5, offset: 11237},
+										pos:        position{line: 928, col: 5, offset: 28154},
 										val:        "-",
 										ignoreCase: false,
 										want:       "\"-\"",
 									},
 								},
 								&ruleRefExpr{
-									pos:  position{line: 391, col: 10, offset: 11242},
+									pos:  position{line: 928, col: 10, offset: 28159},
 									name: "Integer",
 								},
 							},
 						},
 					},
 					&actionExpr{
-						pos: position{line: 397, col: 6, offset: 11447},
+						pos: position{line: 934, col: 6, offset: 28364},
 						run: (*parser).callonLetIdentifier12,
 						expr: &ruleRefExpr{
-							pos:  position{line: 397, col: 6, offset: 11447},
+							pos:  position{line: 934, col: 6, offset: 28364},
 							name: "Integer",
 						},
 					},
 					&actionExpr{
-						pos: position{line: 403, col: 5, offset: 11656},
+						pos: position{line: 940, col: 5, offset: 28573},
 						run: (*parser).callonLetIdentifier14,
 						expr: &ruleRefExpr{
-							pos:  position{line: 403, col: 5, offset: 11656},
+							pos:  position{line: 940, col: 5, offset: 28573},
 							name: "QuotedValue",
 						},
 					},
@@ -1378,12 +3279,12 @@ var g = &grammar{
 		},
 		{
 			name: "Add",
-			pos:  position{line: 412, col: 1, offset: 11853},
+			pos:  position{line: 949, col: 1, offset: 28770},
 			expr: &actionExpr{
-				pos: position{line: 412, col: 8, offset: 11860},
+				pos: position{line: 949, col: 8, offset: 28777},
 				run: (*parser).callonAdd1,
 				expr: &litMatcher{
-					pos:        position{line: 412, col: 8, offset: 11860},
+					pos:        position{line: 949, col: 8, offset: 28777},
 					val:        "+",
 					ignoreCase: false,
 					want:       "\"+\"",
@@ -1392,12 +3293,12 @@ var g = &grammar{
 		},
 		{
 			name: "Subtract",
-			pos:  position{line: 413, col: 1, offset: 11889},
+			pos:  position{line: 950, col: 1, offset: 28806},
 			expr: &actionExpr{
-				pos: position{line: 413, col: 13, offset: 11901},
+				pos: position{line: 950, col: 13, offset: 28818},
 				run: (*parser).callonSubtract1,
 				expr: &litMatcher{
-					pos:        position{line: 413, col: 13, offset: 11901},
+					pos:        position{line: 950, col: 13, offset: 28818},
 					val:        "-",
 					ignoreCase: false,
 					want:       "\"-\"",
@@ -1406,12 +3307,12 @@ var g = &grammar{
 		},
 		{
 			name: "Multiply",
-			pos:  position{line: 414, col: 1, offset: 11925},
+			pos:  position{line: 951, col: 1, offset: 28842},
 			expr: &actionExpr{
-				pos: position{line: 414, col: 13, offset: 11937},
+				pos: position{line: 951, col: 13, offset: 28854},
 				run: (*parser).callonMultiply1,
 				expr: &litMatcher{
-					pos:        position{line: 414, col: 13, offset: 11937},
+					pos:        position{line: 951, col: 13, offset: 28854},
 					val:        "*",
 					ignoreCase: false,
 					want:       "\"*\"",
@@ -1420,12 +3321,12 @@ var g = &grammar{
 		},
 		{
 			name: "Divide",
-			pos:  position{line: 415, col: 1, offset: 11961},
+			pos:  position{line: 952, col: 1, offset: 28878},
 			expr: &actionExpr{
-				pos: position{line: 415, col: 11, offset: 11971},
+				pos: position{line: 952, col: 11, offset: 28888},
 				run: (*parser).callonDivide1,
 				expr: &litMatcher{
-					pos:        position{line: 415, col: 11, offset: 11971},
+					pos:        position{line: 952, col: 11, offset: 28888},
 					val:        "/",
 					ignoreCase: false,
 					want:       "\"/\"",
@@ -1434,12 +3335,12 @@ var g = &grammar{
 		},
 		{
 			name: "Modulo",
-			pos:  position{line: 416, col: 1, offset: 11997},
+			pos:  position{line: 953, col: 1, offset: 28914},
 			expr: &actionExpr{
-				pos: position{line: 416, col: 11, offset: 12007},
+				pos: position{line: 953, col: 11, offset: 28924},
 				run: (*parser).callonModulo1,
 				expr: &litMatcher{
-					pos:        position{line: 416, col: 11, offset: 12007},
+					pos:        position{line: 953, col: 11, offset: 28924},
 					val:        "%",
 					ignoreCase: false,
 					want:       "\"%\"",
@@ -1448,18 +3349,18 @@ var g = &grammar{
 		},
 		{
 			name: "BoolValue",
-			pos:  position{line: 418, col: 1, offset: 12034},
+			pos:  position{line: 955, col: 1, offset: 28951},
 			expr: &choiceExpr{
-				pos: position{line: 418, col: 14, offset: 12047},
+				pos: position{line: 955, col: 14, offset: 28964},
 				alternatives: []any{
 					&litMatcher{
-						pos:        position{line: 418, col: 14, offset: 12047},
+						pos:        position{line: 955, col: 14, offset: 28964},
 						val:        "false",
 						ignoreCase: false,
 						want:       "\"false\"",
 					},
 					&litMatcher{
-						pos:        position{line: 418, col: 24, offset: 12057},
+						pos:        position{line: 955, col: 24, offset: 28974},
 						val:        "true",
 						ignoreCase: false,
 						want:       "\"true\"",
@@ -1467,21 +3368,11 @@ var g = &grammar{
 				},
 			},
 		},
-		{
-			name: "COUNT_OVER_TIME",
-			pos:  position{line: 420, col: 1, offset: 12065},
-			expr: &litMatcher{
-				pos:        position{line: 420, col: 20, offset: 12084},
-				val:        "count_over_time",
-				ignoreCase: false,
-				want:       "\"count_over_time\"",
-			},
-		},
 		{
 			name: "VECTOR",
-			pos:  position{line: 422, col: 1, offset: 12104},
+			pos:  position{line: 957, col: 1, offset: 28982},
 			expr: &litMatcher{
-				pos:        position{line: 422, col: 11, offset: 12114},
+				pos:        position{line: 957, col: 11, offset: 28992},
 				val:        "vector",
 				ignoreCase: false,
 				want:       "\"vector\"",
@@ -1489,22 +3380,22 @@ var g = &grammar{
 		},
 		{
 			name: "Field",
-			pos:  position{line: 424, col: 1, offset: 12124},
+			pos:  position{line: 959, col: 1, offset: 29002},
 			expr: &choiceExpr{
-				pos: position{line: 424, col: 10, offset: 12133},
+				pos: position{line: 959, col: 10, offset: 29011},
 				alternatives: []any{
 					&ruleRefExpr{
-						pos:  position{line: 424, col: 10, offset: 12133},
+						pos:  position{line: 959, col: 10, offset: 29011},
 						name: "Value",
 					},
 					&actionExpr{
-						pos: position{line: 424, col: 18, offset: 12141},
+						pos: position{line: 959, col: 18, offset: 29019},
 						run: (*parser).callonField3,
 						expr: &labeledExpr{
-							pos:   position{line: 424, col: 18, offset: 12141},
+							pos:   position{line: 959, col: 18, offset: 29019},
 							label: "pieces",
 							expr: &ruleRefExpr{
-								pos:  position{line: 424, col: 25, offset: 12148},
+								pos:  position{line: 959, col: 25, offset: 29026},
 								name: "FieldPiece",
 							},
 						},
@@ -1514,14 +3405,14 @@ var g = &grammar{
 		},
 		{
 			name: "Identifier",
-			pos:  position{line: 432, col: 1, offset: 12240},
+			pos:  position{line: 967, col: 1, offset: 29118},
 			expr: &actionExpr{
-				pos: position{line: 433, col: 4, offset: 12257},
+				pos: position{line: 968, col: 4, offset: 29135},
 				run: (*parser).callonIdentifier1,
 				expr: &oneOrMoreExpr{
-					pos: position{line: 433, col: 4, offset: 12257},
+					pos: position{line: 968, col: 4, offset: 29135},
 					expr: &charClassMatcher{
-						pos:        position{line: 433, col: 4, offset: 12257},
+						pos:        position{line: 968, col: 4, offset: 29135},
 						val:        "[a-zA-Z0-9_@./*]i",
 						chars:      []rune{'_', '@', '.', '/', '*'},
 						ranges:     []rune{'a', 'z', 'a', 'z', '0', '9'},
@@ -1533,22 +3424,22 @@ var g = &grammar{
 		},
 		{
 			name: "Value",
-			pos:  position{line: 437, col: 1, offset: 12315},
+			pos:  position{line: 972, col: 1, offset: 29193},
 			expr: &actionExpr{
-				pos: position{line: 437, col: 10, offset: 12324},
+				pos: position{line: 972, col: 10, offset: 29202},
 				run: (*parser).callonValue1,
 				expr: &labeledExpr{
-					pos:   position{line: 437, col: 10, offset: 12324},
+					pos:   position{line: 972, col: 10, offset: 29202},
 					label: "val",
 					expr: &choiceExpr{
-						pos: position{line: 438, col: 5, offset: 12334},
+						pos: position{line: 973, col: 5, offset: 29212},
 						alternatives: []any{
 							&ruleRefExpr{
-								pos:  position{line: 438, col: 5, offset: 12334},
+								pos:  position{line: 973, col: 5, offset: 29212},
 								name: "Float",
 							},
 							&ruleRefExpr{
-								pos:  position{line: 439, col: 7, offset: 12346},
+								pos:  position{line: 974, col: 7, offset: 29224},
 								name: "Integer",
 							},
 						},
@@ -1558,17 +3449,17 @@ var g = &grammar{
 		},
 		{
 			name: "Integer",
-			pos:  position{line: 445, col: 1, offset: 12401},
+			pos:  position{line: 980, col: 1, offset: 29279},
 			expr: &actionExpr{
-				pos: position{line: 445, col: 12, offset: 12412},
+				pos: position{line: 980, col: 12, offset: 29290},
 				run: (*parser).callonInteger1,
 				expr: &seqExpr{
-					pos: position{line: 445, col: 12, offset: 12412},
+					pos: position{line: 980, col: 12, offset: 29290},
 					exprs: []any{
 						&zeroOrOneExpr{
-							pos: position{line: 445, col: 12, offset: 12412},
+							pos: position{line: 980, col: 12, offset: 29290},
 							expr: &charClassMatcher{
-								pos:        position{line: 445, col: 12, offset: 12412},
+								pos:        position{line: 980, col: 12, offset: 29290},
 								val:        "[+-]",
 								chars:      []rune{'+', '-'},
 								ignoreCase: false,
@@ -1576,9 +3467,9 @@ var g = &grammar{
 							},
 						},
 						&oneOrMoreExpr{
-							pos: position{line: 445, col: 18, offset: 12418},
+							pos: position{line: 980, col: 18, offset: 29296},
 							expr: &charClassMatcher{
-								pos:        position{line: 445, col: 18, offset: 12418},
+								pos:        position{line: 980, col: 18, offset: 29296},
 								val:        "[0-9]",
 								ranges:     []rune{'0', '9'},
 								ignoreCase: false,
@@ -1591,17 +3482,17 @@ var g = &grammar{
 		},
 		{
 			name: "Float",
-			pos:  position{line: 449, col: 1, offset: 12476},
+			pos:  position{line: 984, col: 1, offset: 29354},
 			expr: &actionExpr{
-				pos: position{line: 449, col: 10, offset: 12485},
+				pos: position{line: 984, col: 10, offset: 29363},
 				run: (*parser).callonFloat1,
 				expr: &seqExpr{
-					pos: position{line: 449, col: 10, offset: 12485},
+					pos: position{line: 984, col: 10, offset: 29363},
 					exprs: []any{
 						&zeroOrOneExpr{
-							pos: position{line: 449, col: 10, offset: 12485},
+							pos: position{line: 984, col: 10, offset: 29363},
 							expr: &charClassMatcher{
-								pos:        position{line: 449, col: 10, offset: 12485},
+								pos:        position{line: 984, col: 10, offset: 29363},
 								val:        "[+-]",
 								chars:      []rune{'+', '-'},
 								ignoreCase: false,
@@ -1609,12 +3500,12 @@ var g = &grammar{
 							},
 						},
 						&seqExpr{
-							pos: position{line: 449, col: 17, offset: 12492},
+							pos: position{line: 984, col: 17, offset: 29370},
 							exprs: []any{
 								&zeroOrMoreExpr{
-									pos: position{line: 449, col: 17, offset: 12492},
+									pos: position{line: 984, col: 17, offset: 29370},
 									expr: &charClassMatcher{
-										pos:        position{line: 449, col: 17, offset: 12492},
+										pos:        position{line: 984, col: 17, offset: 29370},
 										val:        "[0-9]",
 										ranges:     []rune{'0', '9'},
 										ignoreCase: false,
@@ -1622,15 +3513,15 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 449, col: 24, offset: 12499},
+									pos:        position{line: 984, col: 24, offset: 29377},
 									val:        ".",
 									ignoreCase: false,
 									want:       "\".\"",
 								},
 								&oneOrMoreExpr{
-									pos: position{line: 449, col: 28, offset: 12503},
+									pos: position{line: 984, col: 28, offset: 29381},
 									expr: &charClassMatcher{
-										pos:        position{line: 449, col: 28, offset: 12503},
+										pos:        position{line: 984, col: 28, offset: 29381},
 										val:        "[0-9]",
 										ranges:     []rune{'0', '9'},
 										ignoreCase: false,
@@ -1645,20 +3536,20 @@ var g = &grammar{
 		},
 		{
 			name: "FieldPiece",
-			pos:  position{line: 453, col: 1, offset: 12567},
+			pos:  position{line: 988, col: 1, offset: 29445},
 			expr: &choiceExpr{
-				pos: position{line: 453, col: 15, offset: 12581},
+				pos: position{line: 988, col: 15, offset: 29459},
 				alternatives: []any{
 					&ruleRefExpr{
-						pos:  position{line: 453, col: 15, offset: 12581},
+						pos:  position{line: 988, col: 15, offset: 29459},
 						name: "QuotedFieldPiece",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 453, col: 34, offset: 12600},
+						pos:  position{line: 988, col: 34, offset: 29478},
 						name: "UnquotedFieldPiece",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 453, col: 55, offset: 12621},
+						pos:  position{line: 988, col: 55, offset: 29499},
 						name: "Star",
 					},
 				},
@@ -1666,14 +3557,14 @@ var g = &grammar{
 		},
 		{
 			name: "UnquotedFieldPiece",
-			pos:  position{line: 455, col: 1, offset: 12627},
+			pos:  position{line: 990, col: 1, offset: 29505},
 			expr: &actionExpr{
-				pos: position{line: 455, col: 23, offset: 12649},
+				pos: position{line: 990, col: 23, offset: 29527},
 				run: (*parser).callonUnquotedFieldPiece1,
 				expr: &oneOrMoreExpr{
-					pos: position{line: 455, col: 23, offset: 12649},
+					pos: position{line: 990, col: 23, offset: 29527},
 					expr: &charClassMatcher{
-						pos:        position{line: 455, col: 23, offset: 12649},
+						pos:        position{line: 990, col: 23, offset: 29527},
 						val:        "[-a-zA-Z0-9$&,?#%_@;[\\]{}+-./*:]i",
 						chars:      []rune{'-', '$', '&', ',', '?', '#', '%', '_', '@', ';', '[', ']', '{', '}', '/', '*', ':'},
 						ranges:     []rune{'a', 'z', 'a', 'z', '0', '9', '+', '.'},
@@ -1683,22 +3574,165 @@ var g = &grammar{
 				},
 			},
 		},
-		{
-			name: "QuotedFieldPiece",
-			pos:  position{line: 459, col: 1, offset: 12720},
-			expr: &ruleRefExpr{
-				pos:  position{line: 459, col: 21, offset: 12740},
-				name: "QuotedValue",
-			},
-		},
+		{
+			name: "QuotedFieldPiece",
+			pos:  position{line: 994, col: 1, offset: 29598},
+			expr: &ruleRefExpr{
+				pos:  position{line: 994, col: 21, offset: 29618},
+				name: "QuotedValue",
+			},
+		},
+		{
+			name: "LabelName",
+			pos:  position{line: 996, col: 1, offset: 29631},
+			expr: &actionExpr{
+				pos: position{line: 996, col: 14, offset: 29644},
+				run: (*parser).callonLabelName1,
+				expr: &seqExpr{
+					pos: position{line: 996, col: 14, offset: 29644},
+					exprs: []any{
+						&charClassMatcher{
+							pos:        position{line: 996, col: 14, offset: 29644},
+							val:        "[a-zA-Z_]",
+							chars:      []rune{'_'},
+							ranges:     []rune{'a', 'z', 'A', 'Z'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+						&zeroOrMoreExpr{
+							pos: position{line: 996, col: 24, offset: 29654},
+							expr: &ruleRefExpr{
+								pos:  position{line: 996, col: 24, offset: 29654},
+								name: "LabelChar",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "LabelChar",
+			pos:  position{line: 1000, col: 1, offset: 29701},
+			expr: &charClassMatcher{
+				pos:        position{line: 1000, col: 14, offset: 29714},
+				val:        "[a-zA-Z0-9_]",
+				chars:      []rune{'_'},
+				ranges:     []rune{'a', 'z', 'A', 'Z', '0', '9'},
+				ignoreCase: false,
+				inverted:   false,
+			},
+		},
+		{
+			name: "LabelNameList",
+			pos:  position{line: 1002, col: 1, offset: 29728},
+			expr: &actionExpr{
+				pos: position{line: 1002, col: 18, offset: 29745},
+				run: (*parser).callonLabelNameList1,
+				expr: &seqExpr{
+					pos: position{line: 1002, col: 18, offset: 29745},
+					exprs: []any{
+						&labeledExpr{
+							pos:   position{line: 1002, col: 18, offset: 29745},
+							label: "first",
+							expr: &ruleRefExpr{
+								pos:  position{line: 1002, col: 24, offset: 29751},
+								name: "LabelName",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 1002, col: 34, offset: 29761},
+							label: "rest",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 1002, col: 39, offset: 29766},
+								expr: &seqExpr{
+									pos: position{line: 1002, col: 40, offset: 29767},
+									exprs: []any{
+										&ruleRefExpr{
+											pos:  position{line: 1002, col: 40, offset: 29767},
+											name: "_",
+										},
+										&litMatcher{
+											pos:        position{line: 1002, col: 42, offset: 29769},
+											val:        ",",
+											ignoreCase: false,
+											want:       "\",\"",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 1002, col: 46, offset: 29773},
+											name: "_",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 1002, col: 48, offset: 29775},
+											name: "LabelName",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "StringLiteral",
+			pos:  position{line: 1006, col: 1, offset: 29835},
+			expr: &choiceExpr{
+				pos: position{line: 1006, col: 18, offset: 29852},
+				alternatives: []any{
+					&ruleRefExpr{
+						pos:  position{line: 1006, col: 18, offset: 29852},
+						name: "QuotedValue",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 1006, col: 32, offset: 29866},
+						name: "RawString",
+					},
+				},
+			},
+		},
+		{
+			name: "RawString",
+			pos:  position{line: 1008, col: 1, offset: 29877},
+			expr: &actionExpr{
+				pos: position{line: 1008, col: 14, offset: 29890},
+				run: (*parser).callonRawString1,
+				expr: &seqExpr{
+					pos: position{line: 1008, col: 14, offset: 29890},
+					exprs: []any{
+						&litMatcher{
+							pos:        position{line: 1008, col: 14, offset: 29890},
+							val:        "`",
+							ignoreCase: false,
+							want:       "\"`\"",
+						},
+						&zeroOrMoreExpr{
+							pos: position{line: 1008, col: 18, offset: 29894},
+							expr: &charClassMatcher{
+								pos:        position{line: 1008, col: 18, offset: 29894},
+								val:        "[^`]",
+								chars:      []rune{'`'},
+								ignoreCase: false,
+								inverted:   true,
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 1008, col: 24, offset: 29900},
+							val:        "`",
+							ignoreCase: false,
+							want:       "\"`\"",
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Star",
-			pos:  position{line: 461, col: 1, offset: 12753},
+			pos:  position{line: 1012, col: 1, offset: 29957},
 			expr: &actionExpr{
-				pos: position{line: 461, col: 9, offset: 12761},
+				pos: position{line: 1012, col: 9, offset: 29965},
 				run: (*parser).callonStar1,
 				expr: &litMatcher{
-					pos:        position{line: 461, col: 9, offset: 12761},
+					pos:        position{line: 1012, col: 9, offset: 29965},
 					val:        "*",
 					ignoreCase: false,
 					want:       "\"*\"",
@@ -1707,50 +3741,50 @@ var g = &grammar{
 		},
 		{
 			name: "QuotedValue",
-			pos:  position{line: 464, col: 1, offset: 12789},
+			pos:  position{line: 1015, col: 1, offset: 29993},
 			expr: &actionExpr{
-				pos: position{line: 464, col: 16, offset: 12804},
+				pos: position{line: 1015, col: 16, offset: 30008},
 				run: (*parser).callonQuotedValue1,
 				expr: &seqExpr{
-					pos: position{line: 464, col: 16, offset: 12804},
+					pos: position{line: 1015, col: 16, offset: 30008},
 					exprs: []any{
 						&litMatcher{
-							pos:        position{line: 464, col: 16, offset: 12804},
+							pos:        position{line: 1015, col: 16, offset: 30008},
 							val:        "\"",
 							ignoreCase: false,
 							want:       "\"\\\"\"",
 						},
 						&zeroOrMoreExpr{
-							pos: position{line: 464, col: 20, offset: 12808},
+							pos: position{line: 1015, col: 20, offset: 30012},
 							expr: &choiceExpr{
-								pos: position{line: 464, col: 22, offset: 12810},
+								pos: position{line: 1015, col: 22, offset: 30014},
 								alternatives: []any{
 									&seqExpr{
-										pos: position{line: 464, col: 22, offset: 12810},
+										pos: position{line: 1015, col: 22, offset: 30014},
 										exprs: []any{
 											&notExpr{
-												pos: position{line: 464, col: 22, offset: 12810},
+												pos: position{line: 1015, col: 22, offset: 30014},
 												expr: &ruleRefExpr{
-													pos:  position{line: 464, col: 23, offset: 12811},
+													pos:  position{line: 1015, col: 23, offset: 30015},
 													name: "EscapedChar",
 												},
 											},
 											&anyMatcher{
-												line: 464, col: 35, offset: 12823,
+												line: 1015, col: 35, offset: 30027,
 											},
 										},
 									},
 									&seqExpr{
-										pos: position{line: 464, col: 39, offset: 12827},
+										pos: position{line: 1015, col: 39, offset: 30031},
 										exprs: []any{
 											&litMatcher{
-												pos:        position{line: 464, col: 39, offset: 12827},
+												pos:        position{line: 1015, col: 39, offset: 30031},
 												val:        "\\",
 												ignoreCase: false,
 												want:       "\"\\\\\"",
 											},
 											&ruleRefExpr{
-												pos:  position{line: 464, col: 44, offset: 12832},
+												pos:  position{line: 1015, col: 44, offset: 30036},
 												name: "EscapeSequence",
 											},
 										},
@@ -1759,7 +3793,7 @@ var g = &grammar{
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 464, col: 62, offset: 12850},
+							pos:        position{line: 1015, col: 62, offset: 30054},
 							val:        "\"",
 							ignoreCase: false,
 							want:       "\"\\\"\"",
@@ -1770,9 +3804,9 @@ var g = &grammar{
 		},
 		{
 			name: "EscapedChar",
-			pos:  position{line: 468, col: 1, offset: 12967},
+			pos:  position{line: 1019, col: 1, offset: 30171},
 			expr: &charClassMatcher{
-				pos:        position{line: 468, col: 16, offset: 12982},
+				pos:        position{line: 1019, col: 16, offset: 30186},
 				val:        "[\\x00-\\x1f\"\\\\]",
 				chars:      []rune{'"', '\\'},
 				ranges:     []rune{'\x00', '\x1f'},
@@ -1782,16 +3816,16 @@ var g = &grammar{
 		},
 		{
 			name: "EscapeSequence",
-			pos:  position{line: 470, col: 1, offset: 12998},
+			pos:  position{line: 1021, col: 1, offset: 30202},
 			expr: &choiceExpr{
-				pos: position{line: 470, col: 19, offset: 13016},
+				pos: position{line: 1021, col: 19, offset: 30220},
 				alternatives: []any{
 					&ruleRefExpr{
-						pos:  position{line: 470, col: 19, offset: 13016},
+						pos:  position{line: 1021, col: 19, offset: 30220},
 						name: "SingleCharEscape",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 470, col: 38, offset: 13035},
+						pos:  position{line: 1021, col: 38, offset: 30239},
 						name: "UnicodeEscape",
 					},
 				},
@@ -1799,9 +3833,9 @@ var g = &grammar{
 		},
 		{
 			name: "SingleCharEscape",
-			pos:  position{line: 472, col: 1, offset: 13050},
+			pos:  position{line: 1023, col: 1, offset: 30254},
 			expr: &charClassMatcher{
-				pos:        position{line: 472, col: 21, offset: 13070},
+				pos:        position{line: 1023, col: 21, offset: 30274},
 				val:        "[\"\\\\/bfnrt]",
 				chars:      []rune{'"', '\\', '/', 'b', 'f', 'n', 'r', 't'},
 				ignoreCase: false,
@@ -1810,30 +3844,30 @@ var g = &grammar{
 		},
 		{
 			name: "UnicodeEscape",
-			pos:  position{line: 474, col: 1, offset: 13083},
+			pos:  position{line: 1025, col: 1, offset: 30287},
 			expr: &seqExpr{
-				pos: position{line: 474, col: 18, offset: 13100},
+				pos: position{line: 1025, col: 18, offset: 30304},
 				exprs: []any{
 					&litMatcher{
-						pos:        position{line: 474, col: 18, offset: 13100},
+						pos:        position{line: 1025, col: 18, offset: 30304},
 						val:        "u",
 						ignoreCase: false,
 						want:       "\"u\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 474, col: 22, offset: 13104},
+						pos:  position{line: 1025, col: 22, offset: 30308},
 						name: "HexDigit",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 474, col: 31, offset: 13113},
+						pos:  position{line: 1025, col: 31, offset: 30317},
 						name: "HexDigit",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 474, col: 40, offset: 13122},
+						pos:  position{line: 1025, col: 40, offset: 30326},
 						name: "HexDigit",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 474, col: 49, offset: 13131},
+						pos:  position{line: 1025, col: 49, offset: 30335},
 						name: "HexDigit",
 					},
 				},
@@ -1841,9 +3875,9 @@ var g = &grammar{
 		},
 		{
 			name: "HexDigit",
-			pos:  position{line: 476, col: 1, offset: 13141},
+			pos:  position{line: 1027, col: 1, offset: 30345},
 			expr: &charClassMatcher{
-				pos:        position{line: 476, col: 13, offset: 13153},
+				pos:        position{line: 1027, col: 13, offset: 30357},
 				val:        "[0-9a-f]i",
 				ranges:     []rune{'0', '9', 'a', 'f'},
 				ignoreCase: true,
@@ -1852,21 +3886,21 @@ var g = &grammar{
 		},
 		{
 			name: "EOF",
-			pos:  position{line: 481, col: 1, offset: 13237},
+			pos:  position{line: 1032, col: 1, offset: 30441},
 			expr: &notExpr{
-				pos: position{line: 481, col: 7, offset: 13243},
+				pos: position{line: 1032, col: 7, offset: 30447},
 				expr: &anyMatcher{
-					line: 481, col: 8, offset: 13244,
+					line: 1032, col: 8, offset: 30448,
 				},
 			},
 		},
 		{
 			name: "whitespace",
-			pos:  position{line: 483, col: 1, offset: 13247},
+			pos:  position{line: 1034, col: 1, offset: 30451},
 			expr: &zeroOrMoreExpr{
-				pos: position{line: 483, col: 15, offset: 13261},
+				pos: position{line: 1034, col: 15, offset: 30465},
 				expr: &charClassMatcher{
-					pos:        position{line: 483, col: 15, offset: 13261},
+					pos:        position{line: 1034, col: 15, offset: 30465},
 					val:        "[ \\n\\t\\r]",
 					chars:      []rune{' ', '\n', '\t', '\r'},
 					ignoreCase: false,
@@ -1876,11 +3910,11 @@ var g = &grammar{
 		},
 		{
 			name: "_",
-			pos:  position{line: 485, col: 1, offset: 13273},
+			pos:  position{line: 1036, col: 1, offset: 30477},
 			expr: &zeroOrMoreExpr{
-				pos: position{line: 485, col: 6, offset: 13278},
+				pos: position{line: 1036, col: 6, offset: 30482},
 				expr: &charClassMatcher{
-					pos:        position{line: 485, col: 6, offset: 13278},
+					pos:        position{line: 1036, col: 6, offset: 30482},
 					val:        "[ \\t]",
 					chars:      []rune{' ', '\t'},
 					ignoreCase: false,
@@ -1890,11 +3924,11 @@ var g = &grammar{
 		},
 		{
 			name: "space",
-			pos:  position{line: 487, col: 1, offset: 13286},
+			pos:  position{line: 1038, col: 1, offset: 30490},
 			expr: &oneOrMoreExpr{
-				pos: position{line: 487, col: 10, offset: 13295},
+				pos: position{line: 1038, col: 10, offset: 30499},
 				expr: &charClassMatcher{
-					pos:        position{line: 487, col: 10, offset: 13295},
+					pos:        position{line: 1038, col: 10, offset: 30499},
 					val:        "[ \\n\\t\\r]",
 					chars:      []rune{' ', '\n', '\t', '\r'},
 					ignoreCase: false,
@@ -1904,18 +3938,18 @@ var g = &grammar{
 		},
 		{
 			name: "Delimiter",
-			pos:  position{line: 489, col: 1, offset: 13307},
+			pos:  position{line: 1040, col: 1, offset: 30511},
 			expr: &choiceExpr{
-				pos: position{line: 489, col: 14, offset: 13320},
+				pos: position{line: 1040, col: 14, offset: 30524},
 				alternatives: []any{
 					&litMatcher{
-						pos:        position{line: 489, col: 14, offset: 13320},
+						pos:        position{line: 1040, col: 14, offset: 30524},
 						val:        "{",
 						ignoreCase: false,
 						want:       "\"{\"",
 					},
 					&litMatcher{
-						pos:        position{line: 489, col: 20, offset: 13326},
+						pos:        position{line: 1040, col: 20, offset: 30530},
 						val:        "}",
 						ignoreCase: false,
 						want:       "\"}\"",
@@ -1926,61 +3960,27 @@ var g = &grammar{
 	},
 }
 
-func (c *current) onStart2(query, jf, fs any) (any, error) {
-	var q ast.QueryStruct
-	if jf != nil {
-		q.PipeCommands = jf.(*structs.QueryAggregators)
-		q.PipeCommands.PipeCommandType = structs.OutputTransformType
-	}
-	if query != nil && fs != nil {
-		finalNode := &ast.Node{
-			NodeType: ast.NodeAnd,
-			Left:     query.(*ast.Node),
-			Right:    fs.(*ast.Node),
-		}
-		q.SearchFilter = finalNode
-		return q, nil
-
-	}
-	if fs != nil && query == nil {
-		q.SearchFilter = fs.(*ast.Node)
-		return q, nil
-	}
-
-	if query != nil && fs == nil {
-		q.SearchFilter = query.(*ast.Node)
-		return q, nil
-	}
-
-	return q, nil
+func (c *current) onStart2(query, stages any) (any, error) {
+	return buildLogQuery(query, stages.([]interface{}))
 }
 
 func (p *parser) callonStart2() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onStart2(stack["query"], stack["jf"], stack["fs"])
+	return p.cur.onStart2(stack["query"], stack["stages"])
 }
 
-func (c *current) onStart14(query, duration any) (any, error) {
-	var q ast.QueryStruct
-	q.SearchFilter = query.(*ast.Node)
-	aggs := &structs.QueryAggregators{}
-	countCols := []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}}
-	aggs.GroupByRequest = &structs.GroupByRequest{MeasureOperations: countCols, GroupByColumns: []string{"*"}}
-	timeNow := utils.GetCurrentTimeMillis()
-	aggs.TimeHistogram = &structs.TimeBucket{StartTime: timeNow - duration.(uint64), EndTime: timeNow}
-	q.PipeCommands = aggs
-	q.PipeCommands.PipeCommandType = structs.GroupByType
-	return q, nil
+func (c *current) onStart13(expr any) (any, error) {
+	return expr, nil
 }
 
-func (p *parser) callonStart14() (any, error) {
+func (p *parser) callonStart13() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onStart14(stack["query"], stack["duration"])
+	return p.cur.onStart13(stack["expr"])
 }
 
-func (c *current) onStart23(expr any) (any, error) {
+func (c *current) onStart21(expr any) (any, error) {
 	var q ast.QueryStruct
 	aggs := &structs.QueryAggregators{}
 	aggs.VectorArithmeticExpr = expr.(*structs.NumericExpr)
@@ -1989,10 +3989,10 @@ func (c *current) onStart23(expr any) (any, error) {
 	return q, nil
 }
 
-func (p *parser) callonStart23() (any, error) {
+func (p *parser) callonStart21() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onStart23(stack["expr"])
+	return p.cur.onStart21(stack["expr"])
 }
 
 func (c *current) onStream1(q1, rest any) (any, error) {
@@ -2030,40 +4030,51 @@ func (p *parser) callonStream1() (any, error) {
 	return p.cur.onStream1(stack["q1"], stack["rest"])
 }
 
-func (c *current) onFilterStream1(rest any) (any, error) {
-	if rest == nil || len(rest.([]interface{})) == 0 {
-		return nil, nil
-	}
-	list := rest.([]interface{})
-	if len(list) == 1 {
-		return list[0].(*ast.Node), nil
-	}
-	finalNode := &ast.Node{
-		NodeType: ast.NodeAnd,
-		Left:     list[0].(*ast.Node),
-		Right:    &ast.Node{},
-	}
-	ptr := finalNode
-	list = list[1:]
-	for index, filter := range list {
-		if index == len(list)-1 {
-			ptr.Right = filter.(*ast.Node)
-		} else {
-			ptr.Right = &ast.Node{
-				NodeType: ast.NodeAnd,
-				Left:     filter.(*ast.Node),
-				Right:    &ast.Node{},
-			}
-			ptr = ptr.Right
-		}
-	}
-	return finalNode, nil
+func (c *current) onStreamMatcher2(field, op, pattern any) (any, error) {
+	return newLabelRegexNode(field.(string), op.(string), pattern.(string))
+}
+
+func (p *parser) callonStreamMatcher2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onStreamMatcher2(stack["field"], stack["op"], stack["pattern"])
+}
+
+func (c *current) onStreamMatcher18(field, field1 any) (any, error) {
+	return &ast.Node{
+		NodeType: ast.NodeTerminal,
+		Comparison: ast.Comparison{
+			Op:     "!=",
+			Field:  field.(string),
+			Values: field1,
+		},
+	}, nil
+}
+
+func (p *parser) callonStreamMatcher18() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onStreamMatcher18(stack["field"], stack["field1"])
+}
+
+func (c *current) onPipelineStage2(stage any) (any, error) {
+	return stage, nil
+}
+
+func (p *parser) callonPipelineStage2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPipelineStage2(stack["stage"])
 }
 
-func (p *parser) callonFilterStream1() (any, error) {
+func (c *current) onPipelineStage17(filter any) (any, error) {
+	return &logStage{filter: filter.(*ast.Node)}, nil
+}
+
+func (p *parser) callonPipelineStage17() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onFilterStream1(stack["rest"])
+	return p.cur.onPipelineStage17(stack["filter"])
 }
 
 func (c *current) onQuery1(field, field1 any) (any, error) {
@@ -2099,7 +4110,28 @@ func (p *parser) callonSingleField1() (any, error) {
 	return p.cur.onSingleField1(stack["field"])
 }
 
-func (c *current) onLogFilter1(grep, field any) (any, error) {
+func (c *current) onLogFilter2(op, pattern any) (any, error) {
+	if _, err := regexp.Compile(pattern.(string)); err != nil {
+		return nil, fmt.Errorf("LogFilter: invalid regex %v; err=%v", pattern, err)
+	}
+	return &ast.Node{
+		NodeType: ast.NodeTerminal,
+		Comparison: ast.Comparison{
+			Op:           op.(string),
+			Field:        lineColumn,
+			Values:       pattern,
+			ValueIsRegex: true,
+		},
+	}, nil
+}
+
+func (p *parser) callonLogFilter2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLogFilter2(stack["op"], stack["pattern"])
+}
+
+func (c *current) onLogFilter14(grep, field any) (any, error) {
 	return &ast.Node{
 		NodeType: ast.NodeTerminal,
 		Comparison: ast.Comparison{
@@ -2110,13 +4142,23 @@ func (c *current) onLogFilter1(grep, field any) (any, error) {
 
 }
 
-func (p *parser) callonLogFilter1() (any, error) {
+func (p *parser) callonLogFilter14() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLogFilter14(stack["grep"], stack["field"])
+}
+
+func (c *current) onLabelFilter2(field, op, pattern any) (any, error) {
+	return newLabelRegexNode(field.(string), op.(string), pattern.(string))
+}
+
+func (p *parser) callonLabelFilter2() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onLogFilter1(stack["grep"], stack["field"])
+	return p.cur.onLabelFilter2(stack["field"], stack["op"], stack["pattern"])
 }
 
-func (c *current) onLabelFilter1(field, op, field1 any) (any, error) {
+func (c *current) onLabelFilter23(field, op, field1 any) (any, error) {
 	return &ast.Node{
 		NodeType: ast.NodeTerminal,
 		Comparison: ast.Comparison{
@@ -2127,19 +4169,19 @@ func (c *current) onLabelFilter1(field, op, field1 any) (any, error) {
 	}, nil
 }
 
-func (p *parser) callonLabelFilter1() (any, error) {
+func (p *parser) callonLabelFilter23() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onLabelFilter1(stack["field"], stack["op"], stack["field1"])
+	return p.cur.onLabelFilter23(stack["field"], stack["op"], stack["field1"])
 }
 
-func (c *current) onJSONFilter2(rest any) (any, error) {
+func (c *current) onJSONFilter1(rest any) (any, error) {
 	if len(rest.([]interface{})) == 0 {
-		return nil, nil
+		return &logStage{}, nil
 	}
 	rawIncludeValues := make([]*structs.IncludeValue, 0)
 	mapLabels := make(map[string]string, 0)
-	aggNode := &structs.QueryAggregators{OutputTransforms: &structs.OutputTransforms{}}
+	aggNode := &structs.QueryAggregators{PipeCommandType: structs.OutputTransformType}
 	columsArray := make([]string, 0)
 	for _, query := range rest.([]interface{}) {
 		label := query.(*ast.Node).Comparison.Field
@@ -2163,17 +4205,20 @@ func (c *current) onJSONFilter2(rest any) (any, error) {
 	aggNode.OutputTransforms = &structs.OutputTransforms{OutputColumns: &structs.ColumnsRequest{IncludeColumns: columsArray}}
 	aggNode.OutputTransforms.OutputColumns.RenameColumns = mapLabels
 	aggNode.OutputTransforms.OutputColumns.IncludeValues = rawIncludeValues
-	return aggNode, nil
+	return &logStage{aggs: aggNode}, nil
 }
 
-func (p *parser) callonJSONFilter2() (any, error) {
+func (p *parser) callonJSONFilter1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onJSONFilter2(stack["rest"])
+	return p.cur.onJSONFilter1(stack["rest"])
 }
 
-func (c *current) onJSONFilter14(rest any) (any, error) {
-	aggNode := &structs.QueryAggregators{OutputTransforms: &structs.OutputTransforms{OutputColumns: &structs.ColumnsRequest{}}}
+func (c *current) onLogfmtParser1(rest any) (any, error) {
+	aggNode := &structs.QueryAggregators{
+		PipeCommandType:  structs.OutputTransformType,
+		OutputTransforms: &structs.OutputTransforms{OutputColumns: &structs.ColumnsRequest{}},
+	}
 	rawIncludeValues := make([]*structs.IncludeValue, 0)
 	for _, query := range rest.([]interface{}) {
 		expression := strings.Trim(query.(*ast.Node).Comparison.Values.(string), "\"")
@@ -2182,13 +4227,258 @@ func (c *current) onJSONFilter14(rest any) (any, error) {
 	}
 	aggNode.OutputTransforms.OutputColumns.IncludeValues = rawIncludeValues
 	aggNode.OutputTransforms.OutputColumns.Logfmt = true
-	return aggNode, nil
+	aggNode.LogfmtExpr = aggNode.OutputTransforms.OutputColumns
+	return &logStage{aggs: aggNode, changesRecords: true}, nil
+}
+
+func (p *parser) callonLogfmtParser1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLogfmtParser1(stack["rest"])
+}
+
+func (c *current) onRegexpParser1(pattern any) (any, error) {
+	return newRexStage(pattern.(string))
+}
+
+func (p *parser) callonRegexpParser1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRegexpParser1(stack["pattern"])
+}
+
+func (c *current) onPatternParser1(pattern any) (any, error) {
+	regex, err := patternToRegex(pattern.(string))
+	if err != nil {
+		return nil, err
+	}
+	return newRexStage(regex)
+}
+
+func (p *parser) callonPatternParser1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPatternParser1(stack["pattern"])
+}
+
+func (c *current) onUnpackParser1() (any, error) {
+	return newUnpackStage(), nil
+}
+
+func (p *parser) callonUnpackParser1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onUnpackParser1()
+}
+
+func (c *current) onLineFormat1(template any) (any, error) {
+	valueExpr, err := templateToValueExpr(template.(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logStage{aggs: newEvalAggs(lineColumn, valueExpr), changesRecords: true}, nil
+}
+
+func (p *parser) callonLineFormat1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLineFormat1(stack["template"])
 }
 
-func (p *parser) callonJSONFilter14() (any, error) {
+func (c *current) onLabelFormat1(first, rest any) (any, error) {
+	root := first.(*structs.QueryAggregators)
+	lastAgg := root
+	for _, element := range rest.([]interface{}) {
+		lastAgg.Next = element.([]interface{})[3].(*structs.QueryAggregators)
+		lastAgg = lastAgg.Next
+	}
+	return &logStage{aggs: root, changesRecords: true}, nil
+}
+
+func (p *parser) callonLabelFormat1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLabelFormat1(stack["first"], stack["rest"])
+}
+
+func (c *current) onLabelFormatExpr2(dst, template any) (any, error) {
+	valueExpr, err := templateToValueExpr(template.(string))
+	if err != nil {
+		return nil, err
+	}
+	return newEvalAggs(dst.(string), valueExpr), nil
+}
+
+func (p *parser) callonLabelFormatExpr2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLabelFormatExpr2(stack["dst"], stack["template"])
+}
+
+func (c *current) onLabelFormatExpr11(dst, src any) (any, error) {
+	renameExpr := &structs.RenameExpr{
+		RenameExprMode:  structs.REMOverride,
+		OriginalPattern: src.(string),
+		NewPattern:      dst.(string),
+	}
+	return &structs.QueryAggregators{
+		PipeCommandType: structs.OutputTransformType,
+		OutputTransforms: &structs.OutputTransforms{
+			LetColumns: &structs.LetColumnsRequest{RenameColRequest: renameExpr},
+		},
+	}, nil
+}
+
+func (p *parser) callonLabelFormatExpr11() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLabelFormatExpr11(stack["dst"], stack["src"])
+}
+
+func (c *current) onDropLabels1(labels any) (any, error) {
+	columnsRequest := &structs.ColumnsRequest{ExcludeColumns: labels.([]string)}
+	return &logStage{aggs: newFieldsAggs(columnsRequest)}, nil
+}
+
+func (p *parser) callonDropLabels1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onDropLabels1(stack["labels"])
+}
+
+func (c *current) onKeepLabels1(labels any) (any, error) {
+	includeColumns := append(labels.([]string), lineColumn, timestampColumn)
+	columnsRequest := &structs.ColumnsRequest{IncludeColumns: includeColumns}
+	return &logStage{aggs: newFieldsAggs(columnsRequest)}, nil
+}
+
+func (p *parser) callonKeepLabels1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onKeepLabels1(stack["labels"])
+}
+
+func (c *current) onVectorAggregationExpr1(op, before, param, inner, after any) (any, error) {
+	q := inner.(ast.QueryStruct)
+	aggregation := &ast.LogVectorAggregation{Op: op.(string)}
+	if before != nil && after != nil {
+		return q, fmt.Errorf("VectorAggregationExpr: %v can only have one grouping", aggregation.Op)
+	} else if before != nil {
+		aggregation.Grouping = before.(*ast.LogGrouping)
+	} else if after != nil {
+		aggregation.Grouping = after.([]interface{})[1].(*ast.LogGrouping)
+	}
+
+	takesParam := aggregation.Op == "topk" || aggregation.Op == "bottomk"
+	if takesParam != (param != nil) {
+		return q, fmt.Errorf("VectorAggregationExpr: only topk and bottomk take a parameter")
+	}
+	if param != nil {
+		k, err := param.([]interface{})[0].(json.Number).Int64()
+		if err != nil || k <= 0 {
+			return q, fmt.Errorf("VectorAggregationExpr: invalid parameter for %v", aggregation.Op)
+		}
+		aggregation.Param = int(k)
+	}
+
+	q.MetricsExpr.Aggregations = append(q.MetricsExpr.Aggregations, aggregation)
+	return q, nil
+}
+
+func (p *parser) callonVectorAggregationExpr1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onVectorAggregationExpr1(stack["op"], stack["before"], stack["param"], stack["inner"], stack["after"])
+}
+
+func (c *current) onRangeAggregationExpr1(function, param, query, grouping any) (any, error) {
+	var rawParam, rawGrouping interface{}
+	if param != nil {
+		rawParam = param.([]interface{})[0]
+	}
+	if grouping != nil {
+		rawGrouping = grouping.([]interface{})[1]
+	}
+	return newRangeAggregation(function.(string), rawParam, query.(ast.QueryStruct), rawGrouping)
+}
+
+func (p *parser) callonRangeAggregationExpr1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRangeAggregationExpr1(stack["function"], stack["param"], stack["query"], stack["grouping"])
+}
+
+func (c *current) onLogRangeExpr1(query, stages, unwrap, postStages, duration any) (any, error) {
+	allStages := append(stages.([]interface{}), postStages.([]interface{})...)
+	q, err := buildLogQuery(query, allStages)
+	if err != nil {
+		return q, err
+	}
+	q.MetricsExpr = &ast.LogMetricsExpr{RangeMillis: duration.(uint64)}
+	if unwrap != nil {
+		q.MetricsExpr.Unwrap = unwrap.(*ast.LogUnwrap)
+	}
+	return q, nil
+}
+
+func (p *parser) callonLogRangeExpr1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLogRangeExpr1(stack["query"], stack["stages"], stack["unwrap"], stack["postStages"], stack["duration"])
+}
+
+func (c *current) onUnwrap2(conversion, field any) (any, error) {
+	return &ast.LogUnwrap{Field: field.(string), Conversion: string(conversion.([]byte))}, nil
+}
+
+func (p *parser) callonUnwrap2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onUnwrap2(stack["conversion"], stack["field"])
+}
+
+func (c *current) onUnwrap22(field any) (any, error) {
+	return &ast.LogUnwrap{Field: field.(string)}, nil
+}
+
+func (p *parser) callonUnwrap22() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onUnwrap22(stack["field"])
+}
+
+func (c *current) onGrouping1(kind, labels any) (any, error) {
+	grouping := &ast.LogGrouping{Without: string(kind.([]byte)) == "without"}
+	if labels != nil {
+		grouping.Labels = labels.([]string)
+	}
+	return grouping, nil
+}
+
+func (p *parser) callonGrouping1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onGrouping1(stack["kind"], stack["labels"])
+}
+
+func (c *current) onVectorOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonVectorOp1() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onJSONFilter14(stack["rest"])
+	return p.cur.onVectorOp1()
+}
+
+func (c *current) onRangeOp1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonRangeOp1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRangeOp1()
 }
 
 func (c *current) onDuration1(val, timeUnit any) (any, error) {
@@ -2460,24 +4750,44 @@ func (p *parser) callonGrepFilter4() (any, error) {
 	return p.cur.onGrepFilter4()
 }
 
-func (c *current) onGrepFilter6() (any, error) {
+func (c *current) onLineRegexOp2() (any, error) {
+	return "=", nil
+}
+
+func (p *parser) callonLineRegexOp2() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLineRegexOp2()
+}
+
+func (c *current) onLineRegexOp4() (any, error) {
+	return "!=", nil
+}
+
+func (p *parser) callonLineRegexOp4() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLineRegexOp4()
+}
+
+func (c *current) onRegexMatchOp2() (any, error) {
 	return "=", nil
 }
 
-func (p *parser) callonGrepFilter6() (any, error) {
+func (p *parser) callonRegexMatchOp2() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onGrepFilter6()
+	return p.cur.onRegexMatchOp2()
 }
 
-func (c *current) onGrepFilter8() (any, error) {
+func (c *current) onRegexMatchOp4() (any, error) {
 	return "!=", nil
 }
 
-func (p *parser) callonGrepFilter8() (any, error) {
+func (p *parser) callonRegexMatchOp4() (any, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onGrepFilter8()
+	return p.cur.onRegexMatchOp4()
 }
 
 func (c *current) onopCustom1(opname any) (any, error) {
@@ -2774,6 +5084,36 @@ func (p *parser) callonUnquotedFieldPiece1() (any, error) {
 	return p.cur.onUnquotedFieldPiece1()
 }
 
+func (c *current) onLabelName1() (any, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonLabelName1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLabelName1()
+}
+
+func (c *current) onLabelNameList1(first, rest any) (any, error) {
+	return getLabelNames(first, rest), nil
+}
+
+func (p *parser) callonLabelNameList1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLabelNameList1(stack["first"], stack["rest"])
+}
+
+func (c *current) onRawString1() (any, error) {
+	return string(c.text[1 : len(c.text)-1]), nil
+}
+
+func (p *parser) callonRawString1() (any, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onRawString1()
+}
+
 func (c *current) onStar1() (any, error) {
 	return "*", nil
 }
@@ -161,7 +161,10 @@ func Test_RangeMetrics(t *testing.T) {
 	queryJson := res.(ast.QueryStruct).SearchFilter
 	pipeCommands := res.(ast.QueryStruct).PipeCommands
 	assert.Nil(t, err)
-	assert.Equal(t, pipeCommands.GroupByRequest.GroupByColumns, []string{"*"})
+	assert.Nil(t, pipeCommands)
+	metricsExpr := res.(ast.QueryStruct).MetricsExpr
+	assert.Equal(t, "count_over_time", metricsExpr.RangeFunction)
+	assert.Equal(t, uint64(90*24*60*60*1000), metricsExpr.RangeMillis)
 	assert.Equal(t, queryJson.Comparison.Field, "gender")
 	assert.Equal(t, queryJson.Comparison.Values, "\"male\"")
 	assert.Equal(t, queryJson.Comparison.Op, "=")
@@ -287,3 +290,158 @@ func Test_ParseVectorArithmeticExprNested(t *testing.T) {
 	assert.Equal(t, rightExpr.Left.Right.Value, "3")
 	assert.Equal(t, rightExpr.Right.Value, "4")
 }
+
+func Test_ParseStreamMatchers(t *testing.T) {
+	res, err := Parse("", []byte(`{app=~"api|web", env!="dev", team!~"ops.*"}`))
+	assert.Nil(t, err)
+	queryJson := res.(ast.QueryStruct).SearchFilter
+	assert.Equal(t, ast.Comparison{Op: "=", Field: "app", Values: "^(?:api|web)$", ValueIsRegex: true}, queryJson.Left.Comparison)
+	assert.Equal(t, ast.Comparison{Op: "!=", Field: "env", Values: "\"dev\""}, queryJson.Right.Left.Comparison)
+	assert.Equal(t, ast.Comparison{Op: "!=", Field: "team", Values: "^(?:ops.*)$", ValueIsRegex: true}, queryJson.Right.Right.Comparison)
+
+	_, err = Parse("", []byte(`{app=~"api("}`))
+	assert.NotNil(t, err)
+}
+
+func Test_ParseRegexLineFilters(t *testing.T) {
+	res, err := Parse("", []byte("{app=\"api\"} |~ \"err(or)?\" !~ `debug`"))
+	assert.Nil(t, err)
+	queryJson := res.(ast.QueryStruct).SearchFilter
+	assert.Nil(t, res.(ast.QueryStruct).PipeCommands)
+	assert.Equal(t, ast.Comparison{Op: "=", Field: "line", Values: "err(or)?", ValueIsRegex: true}, queryJson.Right.Left.Comparison)
+	assert.Equal(t, ast.Comparison{Op: "!=", Field: "line", Values: "debug", ValueIsRegex: true}, queryJson.Right.Right.Comparison)
+}
+
+func Test_ParseFiltersAfterLogfmt(t *testing.T) {
+	res, err := Parse("", []byte(`{app="api"} |= "GET" | logfmt | status >= 500 != "timeout"`))
+	assert.Nil(t, err)
+	queryJson := res.(ast.QueryStruct).SearchFilter
+	assert.Equal(t, "\"api\"", queryJson.Left.Comparison.Values)
+	assert.Equal(t, ast.GrepValue{Field: "\"GET\""}, queryJson.Right.Comparison.Values)
+
+	pipeCommands := res.(ast.QueryStruct).PipeCommands
+	assert.True(t, pipeCommands.OutputTransforms.OutputColumns.Logfmt)
+
+	statusFilter := pipeCommands.Next.OutputTransforms.FilterRows
+	assert.Equal(t, statusFilter, pipeCommands.Next.WhereExpr)
+	assert.Equal(t, ">=", statusFilter.ValueOp)
+	assert.Equal(t, "status", statusFilter.LeftValue.NumericExpr.Value)
+	assert.Equal(t, "500", statusFilter.RightValue.NumericExpr.Value)
+
+	lineFilter := pipeCommands.Next.Next.OutputTransforms.FilterRows
+	assert.Equal(t, structs.BoolOpNot, lineFilter.BoolOp)
+	assert.Equal(t, "match", lineFilter.LeftBool.ValueOp)
+	assert.Equal(t, "line", lineFilter.LeftBool.LeftValue.NumericExpr.Value)
+	assert.Equal(t, "timeout", lineFilter.LeftBool.RightValue.StringExpr.RawString)
+	assert.Nil(t, pipeCommands.Next.Next.Next)
+}
+
+func Test_ParseRegexpAndPattern(t *testing.T) {
+	res, err := Parse("", []byte(`{app="api"} | regexp "(?P<method>\\w+) (?P<path>\\S+)" | method=~"GET|POST"`))
+	assert.Nil(t, err)
+	pipeCommands := res.(ast.QueryStruct).PipeCommands
+	rexExpr := pipeCommands.OutputTransforms.LetColumns.RexColRequest
+	assert.Equal(t, &structs.RexExpr{Pattern: `(?P<method>\w+) (?P<path>\S+)`, FieldName: "line", RexColNames: []string{"method", "path"}}, rexExpr)
+	methodFilter := pipeCommands.Next.OutputTransforms.FilterRows
+	assert.Equal(t, "match", methodFilter.ValueOp)
+	assert.Equal(t, "^(?:GET|POST)$", methodFilter.RightValue.StringExpr.RawString)
+
+	res, err = Parse("", []byte(`{app="api"} | pattern "<ip> - <_> \"<method> <uri>\" <status>"`))
+	assert.Nil(t, err)
+	rexExpr = res.(ast.QueryStruct).PipeCommands.OutputTransforms.LetColumns.RexColRequest
+	assert.Equal(t, `^(?P<ip>.*?) - (?:.*?) "(?P<method>.*?) (?P<uri>.*?)" (?P<status>.*)`, rexExpr.Pattern)
+	assert.Equal(t, []string{"ip", "method", "uri", "status"}, rexExpr.RexColNames)
+
+	_, err = Parse("", []byte(`{app="api"} | regexp "(\\w+)"`))
+	assert.NotNil(t, err)
+	_, err = Parse("", []byte(`{app="api"} | pattern "<_> foo"`))
+	assert.NotNil(t, err)
+}
+
+func Test_ParseLineAndLabelFormat(t *testing.T) {
+	res, err := Parse("", []byte(`{app="api"} | json | line_format "{{.method}} {{ .path }}" |= "GET"`))
+	assert.Nil(t, err)
+	assert.Equal(t, "\"api\"", res.(ast.QueryStruct).SearchFilter.Comparison.Values)
+	pipeCommands := res.(ast.QueryStruct).PipeCommands
+	letColumns := pipeCommands.OutputTransforms.LetColumns
+	assert.Equal(t, "line", letColumns.NewColName)
+	assert.Equal(t, []*structs.ConcatAtom{{IsField: true, Value: "method"}, {Value: " "}, {IsField: true, Value: "path"}}, letColumns.ValueColRequest.StringExpr.ConcatExpr.Atoms)
+	assert.Equal(t, "match", pipeCommands.Next.OutputTransforms.FilterRows.ValueOp)
+
+	res, err = Parse("", []byte(`{app="api"} | label_format dst=src, greeting="hi {{.name}}"`))
+	assert.Nil(t, err)
+	pipeCommands = res.(ast.QueryStruct).PipeCommands
+	assert.Equal(t, &structs.RenameExpr{RenameExprMode: structs.REMOverride, OriginalPattern: "src", NewPattern: "dst"}, pipeCommands.OutputTransforms.LetColumns.RenameColRequest)
+	assert.Equal(t, "greeting", pipeCommands.Next.EvalExpr.FieldName)
+	assert.Equal(t, []*structs.ConcatAtom{{Value: "hi "}, {IsField: true, Value: "name"}}, pipeCommands.Next.EvalExpr.ValueExpr.StringExpr.ConcatExpr.Atoms)
+
+	_, err = Parse("", []byte(`{app="api"} | line_format "{{ if .x }}y{{ end }}"`))
+	assert.NotNil(t, err)
+}
+
+func Test_ParseUnpackDropAndKeep(t *testing.T) {
+	res, err := Parse("", []byte(`{app="api"} | unpack | drop pod, node | keep level`))
+	assert.Nil(t, err)
+	pipeCommands := res.(ast.QueryStruct).PipeCommands
+	assert.Equal(t, "line", pipeCommands.EvalExpr.FieldName)
+	conditionExpr := pipeCommands.EvalExpr.ValueExpr.ConditionExpr
+	assert.Equal(t, "coalesce", conditionExpr.Op)
+	assert.Equal(t, "_entry", conditionExpr.ValueList[0].NumericExpr.Value)
+	assert.Equal(t, "line", conditionExpr.ValueList[1].NumericExpr.Value)
+
+	dropCommand := pipeCommands.Next
+	assert.Equal(t, []string{"pod", "node"}, dropCommand.OutputTransforms.OutputColumns.ExcludeColumns)
+	assert.Equal(t, dropCommand.OutputTransforms.OutputColumns, dropCommand.FieldsExpr)
+	assert.Equal(t, []string{"level", "line", "timestamp"}, dropCommand.Next.OutputTransforms.OutputColumns.IncludeColumns)
+	assert.Equal(t, structs.OutputTransformType, dropCommand.Next.PipeCommandType)
+}
+
+func Test_ParseRangeAndVectorAggregations(t *testing.T) {
+	res, err := Parse("", []byte(`sum by (level) (rate({app="api"} |= "error" | __error__="" [5m]))`))
+	assert.Nil(t, err)
+	query := res.(ast.QueryStruct)
+	assert.Equal(t, "\"api\"", query.SearchFilter.Left.Comparison.Values)
+	assert.Equal(t, ast.GrepValue{Field: "\"error\""}, query.SearchFilter.Right.Comparison.Values)
+	assert.Equal(t, "rate", query.MetricsExpr.RangeFunction)
+	assert.Equal(t, uint64(5*60*1000), query.MetricsExpr.RangeMillis)
+	assert.Equal(t, []*ast.LogVectorAggregation{{Op: "sum", Grouping: &ast.LogGrouping{Labels: []string{"level"}}}}, query.MetricsExpr.Aggregations)
+
+	res, err = Parse("", []byte(`topk(3, sum(bytes_rate({app="api"}[1h])) without (pod))`))
+	assert.Nil(t, err)
+	metricsExpr := res.(ast.QueryStruct).MetricsExpr
+	assert.Equal(t, "bytes_rate", metricsExpr.RangeFunction)
+	assert.Equal(t, []*ast.LogVectorAggregation{
+		{Op: "sum", Grouping: &ast.LogGrouping{Without: true, Labels: []string{"pod"}}},
+		{Op: "topk", Param: 3},
+	}, metricsExpr.Aggregations)
+
+	_, err = Parse("", []byte(`topk(sum(rate({app="api"}[1m])))`))
+	assert.NotNil(t, err)
+	_, err = Parse("", []byte(`sum by (pod) (rate({app="api"}[1m])) by (node)`))
+	assert.NotNil(t, err)
+}
+
+func Test_ParseUnwrap(t *testing.T) {
+	res, err := Parse("", []byte(`quantile_over_time(0.99, {app="api"} | logfmt | unwrap duration(latency) | status="500" [1m]) by (path)`))
+	assert.Nil(t, err)
+	query := res.(ast.QueryStruct)
+	assert.Equal(t, "quantile_over_time", query.MetricsExpr.RangeFunction)
+	assert.Equal(t, 0.99, query.MetricsExpr.Quantile)
+	assert.Equal(t, &ast.LogUnwrap{Field: "latency", Conversion: "duration"}, query.MetricsExpr.Unwrap)
+	assert.Equal(t, &ast.LogGrouping{Labels: []string{"path"}}, query.MetricsExpr.Grouping)
+	assert.True(t, query.PipeCommands.OutputTransforms.OutputColumns.Logfmt)
+	assert.NotNil(t, query.PipeCommands.Next.WhereExpr)
+
+	res, err = Parse("", []byte(`avg_over_time({app="api"} | json | unwrap bytes [5m])`))
+	assert.Nil(t, err)
+	assert.Equal(t, &ast.LogUnwrap{Field: "bytes"}, res.(ast.QueryStruct).MetricsExpr.Unwrap)
+
+	_, err = Parse("", []byte(`avg_over_time({app="api"}[5m])`))
+	assert.NotNil(t, err)
+	_, err = Parse("", []byte(`count_over_time({app="api"} | unwrap bytes [5m])`))
+	assert.NotNil(t, err)
+	_, err = Parse("", []byte(`quantile_over_time(1.5, {app="api"} | unwrap bytes [5m])`))
+	assert.NotNil(t, err)
+	_, err = Parse("", []byte(`rate({app="api"}[5m]) by (pod)`))
+	assert.NotNil(t, err)
+}
@@ -68,7 +68,25 @@ func ParseRequest(searchText string, startEpoch, endEpoch uint64, qid uint64, qu
 		boolNode.TimeRange = tRange
 	}
 
-	//aggs
+	queryAggs, err = finalizeQueryAggs(queryAggs, startEpoch, endEpoch, indexName, qid)
+	if err != nil {
+		log.Errorf("qid=%d, ParseRequest: finalizeQueryAggs error: %v", qid, err)
+		return nil, nil, []string{}, err
+	}
+
+	err = parseJoinSubsearches(queryAggs, startEpoch, endEpoch, indexName, qid)
+	if err != nil {
+		log.Errorf("qid=%d, ParseRequest: parseJoinSubsearches error: %v", qid, err)
+		return nil, nil, []string{}, err
+	}
+
+	segment.LogASTNode(queryLanguageType+"query parser", boolNode, qid)
+	segment.LogQueryAggsNode(queryLanguageType+"aggs parser", queryAggs, qid)
+	return boolNode, queryAggs, parsedIndexNames, nil
+}
+
+// Sets up the early exit, sorting, and bucketing options for the aggregators.
+func finalizeQueryAggs(queryAggs *QueryAggregators, startEpoch, endEpoch uint64, indexName string, qid uint64) (*QueryAggregators, error) {
 	if queryAggs != nil {
 		// if groupby request or segment stats exist, dont early exist and no sort is needed
 		if queryAggs.GroupByRequest != nil && queryAggs.StreamStatsOptions == nil {
@@ -84,8 +102,8 @@ func ParseRequest(searchText string, startEpoch, endEpoch uint64, qid uint64, qu
 					queryAggs.TimeHistogram.Timechart.BinOptions.SpanOptions.DefaultSettings {
 					spanOptions, err := ast.GetDefaultTimechartSpanOptions(startEpoch, endEpoch, qid)
 					if err != nil {
-						log.Errorf("qid=%d, ParseRequest: GetDefaultTimechartSpanOptions error: %v", qid, err)
-						return nil, nil, []string{}, err
+						log.Errorf("qid=%d, finalizeQueryAggs: GetDefaultTimechartSpanOptions error: %v", qid, err)
+						return nil, err
 					}
 					queryAggs.TimeHistogram.Timechart.BinOptions.SpanOptions = spanOptions
 					queryAggs.TimeHistogram.IntervalMillis = aggregations.GetIntervalInMillis(spanOptions.SpanLength.Num, spanOptions.SpanLength.TimeScalr)
@@ -109,9 +127,55 @@ func ParseRequest(searchText string, startEpoch, endEpoch uint64, qid uint64, qu
 		queryAggs = structs.InitDefaultQueryAggregations()
 	}
 
-	segment.LogASTNode(queryLanguageType+"query parser", boolNode, qid)
-	segment.LogQueryAggsNode(queryLanguageType+"aggs parser", queryAggs, qid)
-	return boolNode, queryAggs, parsedIndexNames, nil
+	return queryAggs, nil
+}
+
+// Converts the subsearch of each join command into an ASTNode and aggregators,
+// so that the join can run the subsearch like any other query.
+func parseJoinSubsearches(queryAggs *QueryAggregators, startEpoch, endEpoch uint64, indexName string, qid uint64) error {
+	for curAgg := queryAggs; curAgg != nil; curAgg = curAgg.Next {
+		if curAgg.JoinExpr == nil {
+			continue
+		}
+
+		queryStruct, ok := curAgg.JoinExpr.Subsearch.(ast.QueryStruct)
+		if !ok {
+			return toputils.TeeErrorf("qid=%d, parseJoinSubsearches: expected QueryStruct, got %T", qid, curAgg.JoinExpr.Subsearch)
+		}
+
+		boolNode, subsearchAggs, err := queryStructToASTnode(queryStruct, false, qid)
+		if err != nil {
+			return toputils.TeeErrorf("qid=%d, parseJoinSubsearches: queryStructToASTnode error: %v", qid, err)
+		}
+
+		if boolNode.TimeRange == nil {
+			boolNode.TimeRange, err = ast.ParseTimeRange(startEpoch, endEpoch, subsearchAggs, qid)
+			if err != nil {
+				return toputils.TeeErrorf("qid=%d, parseJoinSubsearches: parseTimeRange error: %v", qid, err)
+			}
+		}
+
+		subsearchIndexName := indexName
+		if len(queryStruct.IndexNames) > 0 {
+			subsearchIndexName = strings.Join(queryStruct.IndexNames, ",")
+		}
+
+		subsearchAggs, err = finalizeQueryAggs(subsearchAggs, startEpoch, endEpoch, subsearchIndexName, qid)
+		if err != nil {
+			return toputils.TeeErrorf("qid=%d, parseJoinSubsearches: finalizeQueryAggs error: %v", qid, err)
+		}
+
+		err = parseJoinSubsearches(subsearchAggs, startEpoch, endEpoch, subsearchIndexName, qid)
+		if err != nil {
+			return err
+		}
+
+		curAgg.JoinExpr.SubsearchNode = boolNode
+		curAgg.JoinExpr.SubsearchAggs = subsearchAggs
+		curAgg.JoinExpr.SubsearchIndexNames = queryStruct.IndexNames
+	}
+
+	return nil
 }
 
 func ParseQuery(searchText string, qid uint64, queryLanguageType string) (*ASTNode, *QueryAggregators, []string, error) {
@@ -197,6 +261,16 @@ func parsePipeSearch(searchText string, queryLanguage string, qid uint64) (*ASTN
 		return nil, nil, []string{}, toputils.TeeErrorf("qid=%d, parsePipeSearch: expected QueryStruct, got %T", qid, res)
 	}
 
+	boolNode, pipeCommands, err := queryStructToASTnode(queryStruct, forceCaseSensitive, qid)
+	if err != nil {
+		log.Errorf("qid=%d, parsePipeSearch: queryStructToASTnode error: %v", qid, err)
+		return nil, nil, []string{}, err
+	}
+
+	return boolNode, pipeCommands, queryStruct.IndexNames, nil
+}
+
+func queryStructToASTnode(queryStruct ast.QueryStruct, forceCaseSensitive bool, qid uint64) (*ASTNode, *QueryAggregators, error) {
 	searchNode := queryStruct.SearchFilter
 	aggs := queryStruct.PipeCommands
 	boolNode := &ASTNode{}
@@ -206,25 +280,25 @@ func parsePipeSearch(searchText string, queryLanguage string, qid uint64) (*ASTN
 
 	searchNode, aggs = optimizeQuery(searchNode, aggs)
 
-	err = SearchQueryToASTnode(searchNode, boolNode, qid, forceCaseSensitive)
+	err := SearchQueryToASTnode(searchNode, boolNode, qid, forceCaseSensitive)
 	if err != nil {
-		log.Errorf("qid=%d, parsePipeSearch: SearchQueryToASTnode error: %v", qid, err)
-		return nil, nil, []string{}, err
+		log.Errorf("qid=%d, queryStructToASTnode: SearchQueryToASTnode error: %v", qid, err)
+		return nil, nil, err
 	}
 
 	if aggs == nil {
-		return boolNode, nil, queryStruct.IndexNames, nil
+		return boolNode, nil, nil
 	}
 
 	pipeCommands, err := searchPipeCommandsToASTnode(aggs, qid)
 	if err != nil {
-		log.Errorf("qid=%d, parsePipeSearch: searchPipeCommandsToASTnode error: %v", qid, err)
-		return nil, nil, []string{}, err
+		log.Errorf("qid=%d, queryStructToASTnode: searchPipeCommandsToASTnode error: %v", qid, err)
+		return nil, nil, err
 	}
 
 	updatePositionForGenEvents(pipeCommands)
 
-	return boolNode, pipeCommands, queryStruct.IndexNames, nil
+	return boolNode, pipeCommands, nil
 }
 
 func optimizeQuery(searchNode *ast.Node, aggs *QueryAggregators) (*ast.Node, *QueryAggregators) {
@@ -437,6 +511,10 @@ func searchPipeCommandsToASTnode(node *QueryAggregators, qid uint64) (*QueryAggr
 		log.Errorf("qid=%d, searchPipeCommandsToASTnode: search pipe command node can not be nil %v", qid, node)
 		return nil, errors.New("searchPipeCommandsToASTnode: search pipe command node is nil ")
 	}
+	if node.IsNewPipelineOnlyCmd() {
+		log.Errorf("qid=%d, searchPipeCommandsToASTnode: command is only supported by the new query pipeline", qid)
+		return nil, errors.New("searchPipeCommandsToASTnode: command is only supported by the new query pipeline")
+	}
 	switch node.PipeCommandType {
 	case GenerateEventType:
 		pipeCommands, err = parseGenerateCmd(node.GenerateEvent, qid)
@@ -623,6 +701,12 @@ func parseColumnsCmd(node *structs.OutputTransforms, qid uint64) (*QueryAggregat
 			}
 			aggNode.OutputTransforms.OutputColumns.IncludeValues = node.OutputColumns.IncludeValues
 		}
+		if node.OutputColumns.Logfmt {
+			if aggNode.OutputTransforms.OutputColumns == nil {
+				aggNode.OutputTransforms.OutputColumns = &ColumnsRequest{}
+			}
+			aggNode.OutputTransforms.OutputColumns.Logfmt = true
+		}
 	}
 	if node.LetColumns != nil {
 		aggNode.OutputTransforms.LetColumns = &LetColumnsRequest{}
@@ -11452,3 +11452,599 @@ func Test_Eval_Expr(t *testing.T) {
 	assert.Equal(t, aggregator.Next.Next.Next.Next.EvalExpr.ValueExpr.StringExpr.ConcatExpr.Atoms[2].Value, "  end")
 	assert.Equal(t, aggregator.Next.Next.Next.Next.EvalExpr.ValueExpr.StringExpr.ConcatExpr.Atoms[2].IsField, false)
 }
+
+func Test_Lookup(t *testing.T) {
+	query := `* | lookup hosts.csv host_id`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.Nil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.LookupExpr)
+	assert.Equal(t, "hosts.csv", aggregator.LookupExpr.Filename)
+	assert.Equal(t, []*structs.LookupField{{LookupFieldName: "host_id", EventFieldName: "host_id"}}, aggregator.LookupExpr.MatchFields)
+	assert.Empty(t, aggregator.LookupExpr.OutputFields)
+	assert.False(t, aggregator.LookupExpr.OutputNew)
+}
+
+func Test_Lookup_OutputWithRename(t *testing.T) {
+	query := `* | lookup "hosts.csv.gz" host_id AS host dc OUTPUT team AS owner description | stats count BY owner`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.LookupExpr)
+	assert.NotNil(t, aggregator.Next)
+	assert.Equal(t, "hosts.csv.gz", aggregator.LookupExpr.Filename)
+	assert.Equal(t, []*structs.LookupField{
+		{LookupFieldName: "host_id", EventFieldName: "host"},
+		{LookupFieldName: "dc", EventFieldName: "dc"},
+	}, aggregator.LookupExpr.MatchFields)
+	assert.Equal(t, []*structs.LookupField{
+		{LookupFieldName: "team", EventFieldName: "owner"},
+		{LookupFieldName: "description", EventFieldName: "description"},
+	}, aggregator.LookupExpr.OutputFields)
+	assert.False(t, aggregator.LookupExpr.OutputNew)
+}
+
+func Test_Lookup_OutputNew(t *testing.T) {
+	query := `* | lookup errors.csv code as status_code OUTPUTNEW message`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.LookupExpr)
+	assert.Equal(t, []*structs.LookupField{{LookupFieldName: "code", EventFieldName: "status_code"}}, aggregator.LookupExpr.MatchFields)
+	assert.Equal(t, []*structs.LookupField{{LookupFieldName: "message", EventFieldName: "message"}}, aggregator.LookupExpr.OutputFields)
+	assert.True(t, aggregator.LookupExpr.OutputNew)
+}
+
+func Test_Lookup_MissingMatchField(t *testing.T) {
+	query := `* | lookup errors.csv OUTPUT message`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_Join(t *testing.T) {
+	query := `app=web | join request_id [search _index=auth status=failed | fields request_id, user]`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.Nil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.JoinExpr)
+	assert.Equal(t, "inner", aggregator.JoinExpr.JoinType)
+	assert.Equal(t, uint64(1), aggregator.JoinExpr.Max)
+	assert.True(t, aggregator.JoinExpr.Overwrite)
+	assert.Equal(t, []string{"request_id"}, aggregator.JoinExpr.FieldList)
+
+	subsearch, ok := aggregator.JoinExpr.Subsearch.(ast.QueryStruct)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"auth"}, subsearch.IndexNames)
+	assert.NotNil(t, subsearch.SearchFilter)
+	assert.NotNil(t, subsearch.PipeCommands)
+	assert.NotNil(t, subsearch.PipeCommands.OutputTransforms)
+	assert.Equal(t, []string{"request_id", "user"}, subsearch.PipeCommands.OutputTransforms.OutputColumns.IncludeColumns)
+}
+
+func Test_Join_WithOptions(t *testing.T) {
+	query := `* | join type=left max=0 overwrite=false host, port [ search dc=east | stats count BY host, port ] | head 5`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.JoinExpr)
+	assert.NotNil(t, aggregator.Next)
+	assert.Equal(t, "left", aggregator.JoinExpr.JoinType)
+	assert.Equal(t, uint64(0), aggregator.JoinExpr.Max)
+	assert.False(t, aggregator.JoinExpr.Overwrite)
+	assert.Equal(t, []string{"host", "port"}, aggregator.JoinExpr.FieldList)
+
+	subsearch, ok := aggregator.JoinExpr.Subsearch.(ast.QueryStruct)
+	assert.True(t, ok)
+	assert.Empty(t, subsearch.IndexNames)
+	assert.NotNil(t, subsearch.PipeCommands)
+	assert.NotNil(t, subsearch.PipeCommands.GroupByRequest)
+}
+
+func Test_Join_NoFields(t *testing.T) {
+	query := `* | join type=outer [search status=500]`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.JoinExpr)
+	assert.Equal(t, "outer", aggregator.JoinExpr.JoinType)
+	assert.Empty(t, aggregator.JoinExpr.FieldList)
+}
+
+func Test_Join_InvalidType(t *testing.T) {
+	query := `* | join type=right host [search status=500]`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_Join_MissingSubsearch(t *testing.T) {
+	query := `* | join host`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_Eventstats(t *testing.T) {
+	query := `* | eventstats avg(latency) AS avg_latency, count BY service | eval pct=latency/avg_latency*100`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.EventstatsExpr)
+	assert.NotNil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.Next.EvalExpr)
+
+	statsExpr := aggregator.EventstatsExpr.StatsExpr
+	assert.NotNil(t, statsExpr)
+	assert.Nil(t, statsExpr.MeasureOperations)
+	assert.NotNil(t, statsExpr.GroupByRequest)
+	assert.Equal(t, []string{"service"}, statsExpr.GroupByRequest.GroupByColumns)
+	assert.Len(t, statsExpr.GroupByRequest.MeasureOperations, 2)
+	assert.Equal(t, "latency", statsExpr.GroupByRequest.MeasureOperations[0].MeasureCol)
+	assert.Equal(t, utils.Avg, statsExpr.GroupByRequest.MeasureOperations[0].MeasureFunc)
+	assert.Equal(t, "*", statsExpr.GroupByRequest.MeasureOperations[1].MeasureCol)
+	assert.Equal(t, utils.Count, statsExpr.GroupByRequest.MeasureOperations[1].MeasureFunc)
+	assert.Equal(t, map[string]string{"avg(latency)": "avg_latency"}, aggregator.EventstatsExpr.RenameColumns)
+}
+
+func Test_Eventstats_NoGroupBy(t *testing.T) {
+	query := `* | eventstats max(bytes)`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.EventstatsExpr)
+	assert.Nil(t, aggregator.Next)
+
+	statsExpr := aggregator.EventstatsExpr.StatsExpr
+	assert.Nil(t, statsExpr.GroupByRequest)
+	assert.Len(t, statsExpr.MeasureOperations, 1)
+	assert.Equal(t, "bytes", statsExpr.MeasureOperations[0].MeasureCol)
+	assert.Equal(t, utils.Max, statsExpr.MeasureOperations[0].MeasureFunc)
+	assert.Nil(t, aggregator.EventstatsExpr.RenameColumns)
+}
+
+func Test_Chart_OverBy(t *testing.T) {
+	query := `* | chart count over endpoint by status limit=5 useother=false otherstr=OTHER`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.ChartExpr)
+	assert.Equal(t, "endpoint", aggregator.ChartExpr.OverField)
+
+	timechartExpr := aggregator.ChartExpr.TimechartExpr
+	assert.NotNil(t, timechartExpr)
+	assert.Equal(t, "status", timechartExpr.ByField)
+	assert.Len(t, timechartExpr.SingleAgg.MeasureOperations, 1)
+	assert.Equal(t, "*", timechartExpr.SingleAgg.MeasureOperations[0].MeasureCol)
+	assert.Equal(t, utils.Count, timechartExpr.SingleAgg.MeasureOperations[0].MeasureFunc)
+	assert.NotNil(t, timechartExpr.LimitExpr)
+	assert.Equal(t, 5, timechartExpr.LimitExpr.Num)
+	assert.False(t, timechartExpr.TcOptions.UseOther)
+	assert.True(t, timechartExpr.TcOptions.UseNull)
+	assert.Equal(t, "OTHER", timechartExpr.TcOptions.OtherStr)
+	assert.Equal(t, "null", timechartExpr.TcOptions.NullStr)
+}
+
+func Test_Chart_ByTwoFields(t *testing.T) {
+	query := `* | chart avg(latency) AS avg_lat by endpoint, status`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.ChartExpr)
+	assert.Equal(t, "endpoint", aggregator.ChartExpr.OverField)
+
+	timechartExpr := aggregator.ChartExpr.TimechartExpr
+	assert.Equal(t, "status", timechartExpr.ByField)
+	assert.Len(t, timechartExpr.SingleAgg.MeasureOperations, 1)
+	assert.Equal(t, "latency", timechartExpr.SingleAgg.MeasureOperations[0].MeasureCol)
+	assert.Equal(t, utils.Avg, timechartExpr.SingleAgg.MeasureOperations[0].MeasureFunc)
+	assert.Equal(t, "avg_lat", timechartExpr.SingleAgg.MeasureOperations[0].StrEnc)
+}
+
+func Test_Chart_OverOnly(t *testing.T) {
+	query := `* | chart max(bytes) over host`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.ChartExpr)
+	assert.Equal(t, "host", aggregator.ChartExpr.OverField)
+	assert.Equal(t, "", aggregator.ChartExpr.TimechartExpr.ByField)
+	assert.Nil(t, aggregator.ChartExpr.TimechartExpr.LimitExpr)
+}
+
+func Test_Chart_MissingFields(t *testing.T) {
+	query := `* | chart count`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_Xyseries(t *testing.T) {
+	query := `* | stats count by host, status | xyseries host status count | sort host`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.Next)
+	xyseriesAgg := aggregator.Next
+	assert.NotNil(t, xyseriesAgg.XyseriesExpr)
+	assert.Equal(t, "host", xyseriesAgg.XyseriesExpr.XField)
+	assert.Equal(t, "status", xyseriesAgg.XyseriesExpr.YField)
+	assert.Equal(t, []string{"count"}, xyseriesAgg.XyseriesExpr.ValueFields)
+	assert.NotNil(t, xyseriesAgg.Next)
+	assert.NotNil(t, xyseriesAgg.Next.SortExpr)
+}
+
+func Test_Xyseries_MultipleValueFields(t *testing.T) {
+	query := `* | xyseries host, status, count, bytes`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.XyseriesExpr)
+	assert.Equal(t, "host", aggregator.XyseriesExpr.XField)
+	assert.Equal(t, "status", aggregator.XyseriesExpr.YField)
+	assert.Equal(t, []string{"count", "bytes"}, aggregator.XyseriesExpr.ValueFields)
+}
+
+func Test_Xyseries_MissingValueField(t *testing.T) {
+	query := `* | xyseries host status`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_Untable(t *testing.T) {
+	query := `* | untable host status count | fields host, count`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.UntableExpr)
+	assert.Equal(t, "host", aggregator.UntableExpr.XField)
+	assert.Equal(t, "status", aggregator.UntableExpr.NameField)
+	assert.Equal(t, "count", aggregator.UntableExpr.ValueField)
+	assert.NotNil(t, aggregator.Next)
+}
+
+func Test_Untable_MissingField(t *testing.T) {
+	query := `* | untable host status`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_OutputLookup(t *testing.T) {
+	query := `* | stats count by src_ip | outputlookup known_ips.csv`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.Next)
+	outputLookupExpr := aggregator.Next.OutputLookupExpr
+	assert.NotNil(t, outputLookupExpr)
+	assert.Equal(t, "known_ips.csv", outputLookupExpr.Filename)
+	assert.False(t, outputLookupExpr.Append)
+	assert.False(t, outputLookupExpr.CreateEmpty)
+}
+
+func Test_OutputLookup_WithOptions(t *testing.T) {
+	query := `* | outputlookup append=true create_empty=true "known_ips.csv.gz"`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.OutputLookupExpr)
+	assert.Equal(t, "known_ips.csv.gz", aggregator.OutputLookupExpr.Filename)
+	assert.True(t, aggregator.OutputLookupExpr.Append)
+	assert.True(t, aggregator.OutputLookupExpr.CreateEmpty)
+}
+
+func Test_OutputLookup_DuplicateOption(t *testing.T) {
+	query := `* | outputlookup append=true append=false known_ips.csv`
+	_, err := spl.Parse("", []byte(query))
+	assert.NotNil(t, err)
+}
+
+func Test_MakeResults(t *testing.T) {
+	query := `| makeresults | eval x=len("abc")`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.Equal(t, &structs.MakeResultsExpr{Count: 1}, aggregator.MakeResultsExpr)
+	assert.NotNil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.Next.EvalExpr)
+}
+
+func Test_MakeResults_CountAndAnnotate(t *testing.T) {
+	query := `| makeresults count=5 annotate=true`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.Equal(t, &structs.MakeResultsExpr{Count: 5, Annotate: true}, aggregator.MakeResultsExpr)
+	assert.Nil(t, aggregator.Next)
+}
+
+func Test_MakeResults_Data(t *testing.T) {
+	query := `| makeresults format=csv data="ip,label
+10.0.0.1,\"gateway, main\"" | where label="gateway, main"`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.MakeResultsExpr)
+	assert.Equal(t, "csv", aggregator.MakeResultsExpr.Format)
+	assert.Equal(t, "ip,label\n10.0.0.1,\"gateway, main\"", aggregator.MakeResultsExpr.Data)
+	assert.NotNil(t, aggregator.Next)
+
+	query = `| makeresults data="a,b\n1,2"`
+	res, err = spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+	aggregator = res.(ast.QueryStruct).PipeCommands
+	assert.Equal(t, &structs.MakeResultsExpr{Count: 1, Format: "csv", Data: "a,b\n1,2"}, aggregator.MakeResultsExpr)
+
+	query = `| makeresults format=json data="[{\"a\": 1}]"`
+	res, err = spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+	aggregator = res.(ast.QueryStruct).PipeCommands
+	assert.Equal(t, &structs.MakeResultsExpr{Count: 1, Format: "json", Data: `[{"a": 1}]`}, aggregator.MakeResultsExpr)
+}
+
+func Test_MakeResults_Invalid(t *testing.T) {
+	invalidQueries := []string{
+		`| makeresults format=csv`,
+		`| makeresults count=2 count=3`,
+		`| makeresults format=xml data="a"`,
+		`| makeresultsx`,
+	}
+
+	for _, query := range invalidQueries {
+		_, err := spl.Parse("", []byte(query))
+		assert.NotNil(t, err, query)
+	}
+}
+
+func Test_Tstats(t *testing.T) {
+	query := `| tstats count, sum(latency) AS total where index=web* OR index=api by host, status span=1h | sort host`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.TstatsExpr)
+	assert.True(t, aggregator.IsNewPipelineOnlyCmd())
+
+	tstatsExpr := aggregator.TstatsExpr
+	assert.Len(t, tstatsExpr.MeasureOperations, 2)
+	assert.Equal(t, "*", tstatsExpr.MeasureOperations[0].MeasureCol)
+	assert.Equal(t, utils.Count, tstatsExpr.MeasureOperations[0].MeasureFunc)
+	assert.Equal(t, "latency", tstatsExpr.MeasureOperations[1].MeasureCol)
+	assert.Equal(t, utils.Sum, tstatsExpr.MeasureOperations[1].MeasureFunc)
+	assert.Equal(t, "total", tstatsExpr.MeasureOperations[1].StrEnc)
+	assert.Equal(t, []string{"web*", "api"}, tstatsExpr.IndexNames)
+	assert.Equal(t, []string{"host", "status"}, tstatsExpr.GroupByColumns)
+	assert.Equal(t, &structs.SpanLength{Num: 1, TimeScalr: utils.TMHour}, tstatsExpr.SpanLength)
+	assert.NotNil(t, aggregator.Next)
+}
+
+func Test_Tstats_MeasuresOnly(t *testing.T) {
+	query := `| tstats max(latency) dc(host)`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.TstatsExpr)
+	assert.Len(t, aggregator.TstatsExpr.MeasureOperations, 2)
+	assert.Equal(t, utils.Max, aggregator.TstatsExpr.MeasureOperations[0].MeasureFunc)
+	assert.Equal(t, utils.Cardinality, aggregator.TstatsExpr.MeasureOperations[1].MeasureFunc)
+	assert.Nil(t, aggregator.TstatsExpr.IndexNames)
+	assert.Nil(t, aggregator.TstatsExpr.GroupByColumns)
+	assert.Nil(t, aggregator.TstatsExpr.SpanLength)
+	assert.Nil(t, aggregator.Next)
+}
+
+func Test_Tstats_Invalid(t *testing.T) {
+	invalidQueries := []string{
+		`| tstats`,
+		`| tstats count span=1mon`,
+		`| tstats count(eval(x>1))`,
+		`| tstats count where host=abc`,
+		`search foo | tstats count`,
+	}
+
+	for _, query := range invalidQueries {
+		_, err := spl.Parse("", []byte(query))
+		assert.NotNil(t, err, query)
+	}
+}
+
+func Test_Foreach(t *testing.T) {
+	query := `* | foreach latency_* [eval <<FIELD>>_ms = <<FIELD>> * 1000]`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	filterNode := res.(ast.QueryStruct).SearchFilter
+	assert.NotNil(t, filterNode)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.True(t, aggregator.IsNewPipelineOnlyCmd())
+	assert.Equal(t, []string{"latency_*"}, aggregator.ForeachExpr.FieldPatterns)
+	assert.Equal(t, "eval <<FIELD>>_ms = <<FIELD>> * 1000", aggregator.ForeachExpr.Template)
+	assert.Nil(t, aggregator.Next)
+
+	evalExprs := aggregator.ForeachExpr.Evals
+	assert.Len(t, evalExprs, 1)
+	replacer := aggregator.ForeachExpr.GetPlaceholderReplacer("latency_p50", []string{"p50"})
+	assert.Equal(t, "latency_p50_ms", replacer.Replace(evalExprs[0].FieldName))
+	fields := evalExprs[0].ValueExpr.GetFields()
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "latency_p50", replacer.Replace(fields[0]))
+}
+
+func Test_Foreach_MultiplePatterns(t *testing.T) {
+	query := `* | foreach bytes_*, *_count [ eval <<MATCHSEG1>>_total = <<FIELD>>, copy_<<MATCHSTR>> = <<FIELD>> ] | fields *_total`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.ForeachExpr)
+	assert.Equal(t, []string{"bytes_*", "*_count"}, aggregator.ForeachExpr.FieldPatterns)
+	assert.NotNil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.Next.OutputTransforms)
+
+	evalExprs := aggregator.ForeachExpr.Evals
+	assert.Len(t, evalExprs, 2)
+	replacer := aggregator.ForeachExpr.GetPlaceholderReplacer("bytes_in", []string{"in"})
+	assert.Equal(t, "in_total", replacer.Replace(evalExprs[0].FieldName))
+	assert.Equal(t, "copy_in", replacer.Replace(evalExprs[1].FieldName))
+}
+
+func Test_Foreach_Invalid(t *testing.T) {
+	invalidQueries := []string{
+		`* | foreach latency_*`,
+		`* | foreach [eval <<FIELD>>_ms = <<FIELD>> * 1000]`,
+		`* | foreach latency_* [stats count]`,
+		`* | foreach latency_* [eval <<FIELD>>_ms = ]`,
+		`* | foreach latency_* []`,
+	}
+
+	for _, query := range invalidQueries {
+		_, err := spl.Parse("", []byte(query))
+		assert.NotNil(t, err, query)
+	}
+}
+
+func Test_IPLocation(t *testing.T) {
+	query := `* | iplocation src_ip`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.True(t, aggregator.IsNewPipelineOnlyCmd())
+	assert.Equal(t, &structs.IPLocationExpr{
+		IPField:  "src_ip",
+		Language: "en",
+	}, aggregator.IPLocationExpr)
+	assert.Nil(t, aggregator.Next)
+}
+
+func Test_IPLocation_Options(t *testing.T) {
+	query := `* | iplocation prefix=geo_ allfields=true lang=fr src_ip | fields geo_Country`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.Equal(t, &structs.IPLocationExpr{
+		IPField:   "src_ip",
+		Prefix:    "geo_",
+		AllFields: true,
+		Language:  "fr",
+	}, aggregator.IPLocationExpr)
+	assert.NotNil(t, aggregator.Next)
+	assert.NotNil(t, aggregator.Next.OutputTransforms)
+}
+
+func Test_IPLocation_Invalid(t *testing.T) {
+	invalidQueries := []string{
+		`* | iplocation prefix=geo_`,
+		`* | iplocation src_*`,
+		`* | iplocation allfields=maybe src_ip`,
+	}
+
+	for _, query := range invalidQueries {
+		_, err := spl.Parse("", []byte(query))
+		assert.NotNil(t, err, query)
+	}
+}
+
+func Test_Geostats(t *testing.T) {
+	query := `* | iplocation src_ip | geostats`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	assert.NotNil(t, aggregator.Next)
+	assert.True(t, aggregator.Next.IsNewPipelineOnlyCmd())
+	assert.Equal(t, &structs.GeostatsExpr{
+		LatField:        "lat",
+		LongField:       "lon",
+		OutputLatField:  "latitude",
+		OutputLongField: "longitude",
+		BinSpanLat:      22.5,
+		BinSpanLong:     45,
+		GlobalLimit:     10,
+		MeasureOperations: []*structs.MeasureAggregator{
+			{MeasureCol: "*", MeasureFunc: utils.Count},
+		},
+	}, aggregator.Next.GeostatsExpr)
+}
+
+func Test_Geostats_OptionsAndBy(t *testing.T) {
+	query := `* | geostats latfield=y longfield=x binspanlat=10 binspanlong=20.5 globallimit=3 count, avg(latency) AS avg_latency by Country`
+	res, err := spl.Parse("", []byte(query))
+	assert.Nil(t, err)
+
+	aggregator := res.(ast.QueryStruct).PipeCommands
+	assert.NotNil(t, aggregator)
+	geostatsExpr := aggregator.GeostatsExpr
+	assert.NotNil(t, geostatsExpr)
+	assert.Equal(t, "y", geostatsExpr.LatField)
+	assert.Equal(t, "x", geostatsExpr.LongField)
+	assert.Equal(t, 10.0, geostatsExpr.BinSpanLat)
+	assert.Equal(t, 20.5, geostatsExpr.BinSpanLong)
+	assert.Equal(t, 3, geostatsExpr.GlobalLimit)
+	assert.Equal(t, "Country", geostatsExpr.ByField)
+	assert.Len(t, geostatsExpr.MeasureOperations, 2)
+	assert.Equal(t, utils.Count, geostatsExpr.MeasureOperations[0].MeasureFunc)
+	assert.Equal(t, utils.Avg, geostatsExpr.MeasureOperations[1].MeasureFunc)
+	assert.Equal(t, "latency", geostatsExpr.MeasureOperations[1].MeasureCol)
+	assert.Equal(t, "avg_latency", geostatsExpr.MeasureOperations[1].StrEnc)
+}
+
+func Test_Geostats_Invalid(t *testing.T) {
+	invalidQueries := []string{
+		`* | geostats binspanlat=0`,
+		`* | geostats binspanlong=wide`,
+		`* | geostats globallimit=-1`,
+		`* | geostats count by`,
+	}
+
+	for _, query := range invalidQueries {
+		_, err := spl.Parse("", []byte(query))
+		assert.NotNil(t, err, query)
+	}
+}
@@ -29,6 +29,36 @@ type QueryStruct struct {
 	SearchFilter *Node
 	PipeCommands *structs.QueryAggregators
 	IndexNames   []string
+	MetricsExpr  *LogMetricsExpr // Only set for LogQL metric queries.
+}
+
+// A LogQL metric query, which is evaluated on the log lines that the search
+// filter and pipe commands of its QueryStruct return.
+type LogMetricsExpr struct {
+	RangeFunction string // e.g. count_over_time, rate or quantile_over_time
+	RangeMillis   uint64
+	Quantile      float64      // Only used by quantile_over_time.
+	Unwrap        *LogUnwrap   // Only set for functions over unwrapped values.
+	Grouping      *LogGrouping // Only set for functions over unwrapped values.
+
+	// Applied in order, so the outermost aggregation is the last one.
+	Aggregations []*LogVectorAggregation
+}
+
+type LogUnwrap struct {
+	Field      string
+	Conversion string // "", "duration" or "duration_seconds"
+}
+
+type LogGrouping struct {
+	Without bool
+	Labels  []string
+}
+
+type LogVectorAggregation struct {
+	Op       string // sum, avg, min, max, count, topk or bottomk
+	Param    int    // The k of topk and bottomk.
+	Grouping *LogGrouping
 }
 
 // NodeType represents the type of a node in the parse tree
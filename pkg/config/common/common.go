@@ -61,6 +61,41 @@ type TracingConfig struct {
 	SamplingPercentage float64 `yaml:"samplingPercentage"` // sampling percentage for tracing (0-100)
 }
 
+type SyslogConfig struct {
+	TCPPort   uint64 `yaml:"tcpPort"`   // port for syslog over TCP; 0 disables it
+	UDPPort   uint64 `yaml:"udpPort"`   // port for syslog over UDP; 0 disables it
+	IndexName string `yaml:"indexName"` // index that syslog messages are ingested into
+}
+
+type FluentForwardConfig struct {
+	Port      uint64          `yaml:"port"`      // port for the Fluent Forward receiver; 0 disables it
+	IndexName string          `yaml:"indexName"` // index for events whose tag matches no rule
+	TagRules  []FluentTagRule `yaml:"tagRules"`  // rules mapping fluent tags to indexes; the first match wins
+}
+
+type FluentTagRule struct {
+	Match     string `yaml:"match"`     // tag pattern; * matches one tag part and ** matches any number of parts
+	IndexName string `yaml:"indexName"` // index for events whose tag matches the pattern
+}
+
+type StatsdConfig struct {
+	Port                 uint64    `yaml:"port"`                 // UDP port for the StatsD receiver; 0 disables it
+	FlushIntervalSeconds uint64    `yaml:"flushIntervalSeconds"` // how often aggregated metrics are written
+	Percentiles          []float64 `yaml:"percentiles"`          // percentiles computed for timers, from 0 to 100
+}
+
+type GraphiteConfig struct {
+	TCPPort    uint64   `yaml:"tcpPort"`    // TCP port for the plaintext protocol; 0 disables it
+	UDPPort    uint64   `yaml:"udpPort"`    // UDP port for the plaintext protocol; 0 disables it
+	PicklePort uint64   `yaml:"picklePort"` // TCP port for the pickle protocol; 0 disables it
+	Templates  []string `yaml:"templates"`  // templates converting metric paths to names and tags
+}
+
+type HecTokenConfig struct {
+	Index      string `yaml:"index"`      // index for events that don't set one
+	Sourcetype string `yaml:"sourcetype"` // sourcetype for events that don't set one
+}
+
 type AlertConfig struct {
 	Enabled  bool   `yaml:"enabled"`
 	Provider string `yaml:"provider"`
@@ -129,10 +164,17 @@ type Configuration struct {
 	TLS                         TLSConfig `yaml:"tls"`            // TLS related config
 	CompressStatic              string    `yaml:"compressStatic"` // compress static files
 	CompressStaticConverted     bool
-	Tracing                     TracingConfig  `yaml:"tracing"` // Tracing related config
-	EmailConfig                 EmailConfig    `yaml:"emailConfig"`
-	DatabaseConfig              DatabaseConfig `yaml:"minionSearch"`
-	IsNewQueryPipelineEnabled   bool           `yaml:"isNewQueryPipelineEnabled"`
+	Tracing                     TracingConfig             `yaml:"tracing"` // Tracing related config
+	EmailConfig                 EmailConfig               `yaml:"emailConfig"`
+	DatabaseConfig              DatabaseConfig            `yaml:"minionSearch"`
+	IsNewQueryPipelineEnabled   bool                      `yaml:"isNewQueryPipelineEnabled"`
+	GeoIPDatabasePath           string                    `yaml:"geoIPDatabasePath"` // path to a MaxMind-format .mmdb file used by iplocation
+	OTLPGrpcPort                uint64                    `yaml:"otlpGrpcPort"`      // port for the OTLP gRPC receiver; 0 disables it
+	Syslog                      SyslogConfig              `yaml:"syslog"`            // syslog receiver config
+	FluentForward               FluentForwardConfig       `yaml:"fluentForward"`     // Fluent Forward receiver config
+	Statsd                      StatsdConfig              `yaml:"statsd"`            // StatsD receiver config
+	Graphite                    GraphiteConfig            `yaml:"graphite"`          // Graphite carbon receiver config
+	SplunkHecTokens             map[string]HecTokenConfig `yaml:"splunkHecTokens"`   // defaults for events sent with each Splunk HEC token
 }
 
 type RunModConfig struct {
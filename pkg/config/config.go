@@ -178,6 +178,91 @@ func GetQueryPort() uint64 {
 	return runningConfig.QueryPort
 }
 
+// returns the configured port for the OTLP gRPC receiver
+// a value of 0 means the receiver is disabled
+// the receiver ingests everything for the default org, so it is single-tenant only
+func GetOTLPGrpcPort() uint64 {
+	return runningConfig.OTLPGrpcPort
+}
+
+// returns the configured syslog TCP port
+// a value of 0 means syslog over TCP is disabled
+func GetSyslogTCPPort() uint64 {
+	return runningConfig.Syslog.TCPPort
+}
+
+// returns the configured syslog UDP port
+// a value of 0 means syslog over UDP is disabled
+func GetSyslogUDPPort() uint64 {
+	return runningConfig.Syslog.UDPPort
+}
+
+// returns the index that syslog messages are ingested into
+func GetSyslogIndexName() string {
+	return runningConfig.Syslog.IndexName
+}
+
+// returns the configured port for the Fluent Forward receiver
+// a value of 0 means the receiver is disabled
+func GetFluentForwardPort() uint64 {
+	return runningConfig.FluentForward.Port
+}
+
+// returns the index for fluent events whose tag matches no rule
+func GetFluentForwardIndexName() string {
+	return runningConfig.FluentForward.IndexName
+}
+
+// returns the rules mapping fluent tags to indexes
+func GetFluentForwardTagRules() []common.FluentTagRule {
+	return runningConfig.FluentForward.TagRules
+}
+
+// returns the configured UDP port for the StatsD receiver
+// a value of 0 means the receiver is disabled
+func GetStatsdPort() uint64 {
+	return runningConfig.Statsd.Port
+}
+
+// returns how often aggregated StatsD metrics are written
+func GetStatsdFlushInterval() time.Duration {
+	return time.Duration(runningConfig.Statsd.FlushIntervalSeconds) * time.Second
+}
+
+// returns the percentiles computed for StatsD timers
+func GetStatsdPercentiles() []float64 {
+	return runningConfig.Statsd.Percentiles
+}
+
+// returns the configured TCP port for the Graphite plaintext protocol
+// a value of 0 means the listener is disabled
+func GetGraphiteTCPPort() uint64 {
+	return runningConfig.Graphite.TCPPort
+}
+
+// returns the configured UDP port for the Graphite plaintext protocol
+// a value of 0 means the listener is disabled
+func GetGraphiteUDPPort() uint64 {
+	return runningConfig.Graphite.UDPPort
+}
+
+// returns the configured TCP port for the Graphite pickle protocol
+// a value of 0 means the listener is disabled
+func GetGraphitePicklePort() uint64 {
+	return runningConfig.Graphite.PicklePort
+}
+
+// returns the templates used to convert Graphite metric paths
+func GetGraphiteTemplates() []string {
+	return runningConfig.Graphite.Templates
+}
+
+// returns the defaults configured for events sent with the Splunk HEC token
+func GetSplunkHecTokenConfig(token string) (common.HecTokenConfig, bool) {
+	tokenConfig, ok := runningConfig.SplunkHecTokens[token]
+	return tokenConfig, ok
+}
+
 func GetDataPath() string {
 	return runningConfig.DataPath
 }
@@ -186,6 +271,15 @@ func GetLookupPath() string {
 	return runningConfig.DataPath + "lookups/"
 }
 
+// returns the path of the GeoIP database used by the iplocation command.
+// Defaults to GeoLite2-City.mmdb under the data path when not configured.
+func GetGeoIPDatabasePath() string {
+	if runningConfig.GeoIPDatabasePath != "" {
+		return runningConfig.GeoIPDatabasePath
+	}
+	return runningConfig.DataPath + "geoip/GeoLite2-City.mmdb"
+}
+
 // returns if tls is enabled
 func IsTlsEnabled() bool {
 	return runningConfig.TLS.Enabled
@@ -547,6 +641,9 @@ func GetTestConfig(dataPath string) common.Configuration {
 		CompressStatic:              "false",
 		CompressStaticConverted:     false,
 		Tracing:                     common.TracingConfig{ServiceName: "", Endpoint: "", SamplingPercentage: 1},
+		Syslog:                      common.SyslogConfig{TCPPort: 0, UDPPort: 0, IndexName: "syslog"},
+		FluentForward:               common.FluentForwardConfig{Port: 0, IndexName: "fluent"},
+		Statsd:                      common.StatsdConfig{Port: 0, FlushIntervalSeconds: 10, Percentiles: []float64{50, 90, 99}},
 		DatabaseConfig:              common.DatabaseConfig{Enabled: true, Provider: "sqlite"},
 		EmailConfig:                 common.EmailConfig{SmtpHost: "smtp.gmail.com", SmtpPort: 587, SenderEmail: "doe1024john@gmail.com", GmailAppPassword: " "},
 	}
@@ -871,6 +968,27 @@ func ExtractConfigData(yamlData []byte) (common.Configuration, error) {
 		config.Tracing.SamplingPercentage = 100
 	}
 
+	if len(config.Syslog.IndexName) <= 0 {
+		config.Syslog.IndexName = "syslog"
+	}
+
+	if len(config.FluentForward.IndexName) <= 0 {
+		config.FluentForward.IndexName = "fluent"
+	}
+
+	if config.Statsd.FlushIntervalSeconds == 0 {
+		config.Statsd.FlushIntervalSeconds = 10
+	}
+
+	if config.Statsd.Percentiles == nil {
+		config.Statsd.Percentiles = []float64{50, 90, 99}
+	}
+	for _, percentile := range config.Statsd.Percentiles {
+		if percentile <= 0 || percentile > 100 {
+			return config, fmt.Errorf("ExtractConfigData: statsd percentile %v is not between 0 and 100", percentile)
+		}
+	}
+
 	return config, nil
 }
 
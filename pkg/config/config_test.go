@@ -79,6 +79,21 @@ func Test_ExtractConfigData(t *testing.T) {
    endpoint: "http://localhost:4317"
    serviceName: "siglens"
    samplingPercentage: 100
+ syslog:
+   tcpPort: 1514
+   indexName: "network"
+ fluentForward:
+   port: 24224
+   tagRules:
+     - match: "kube.**"
+       indexName: "kubernetes"
+ statsd:
+   port: 8125
+   percentiles: [95]
+ graphite:
+   tcpPort: 2003
+   templates:
+     - "servers.* .host.measurement*"
  log:
    logPrefix: "./pkg/ingestor/httpserver/"
    logFileRotationSizeMB: 100
@@ -125,6 +140,11 @@ func Test_ExtractConfigData(t *testing.T) {
 				CompressStatic:              "false",
 				CompressStaticConverted:     false,
 				Tracing:                     common.TracingConfig{Endpoint: "http://localhost:4317", ServiceName: "siglens", SamplingPercentage: 100},
+				Syslog:                      common.SyslogConfig{TCPPort: 1514, IndexName: "network"},
+				FluentForward: common.FluentForwardConfig{Port: 24224, IndexName: "fluent",
+					TagRules: []common.FluentTagRule{{Match: "kube.**", IndexName: "kubernetes"}}},
+				Statsd:   common.StatsdConfig{Port: 8125, FlushIntervalSeconds: 10, Percentiles: []float64{95}},
+				Graphite: common.GraphiteConfig{TCPPort: 2003, Templates: []string{"servers.* .host.measurement*"}},
 			},
 		},
 		{ // case 2 - For wrong input type, show error message
@@ -212,6 +232,9 @@ func Test_ExtractConfigData(t *testing.T) {
 				CompressStatic:              "true",
 				CompressStaticConverted:     true,
 				Tracing:                     common.TracingConfig{Endpoint: "", ServiceName: "siglens", SamplingPercentage: 0},
+				Syslog:                      common.SyslogConfig{IndexName: "syslog"},
+				FluentForward:               common.FluentForwardConfig{IndexName: "fluent"},
+				Statsd:                      common.StatsdConfig{FlushIntervalSeconds: 10, Percentiles: []float64{50, 90, 99}},
 			},
 		},
 		{ // case 3 - Error out on bad yaml
@@ -255,6 +278,9 @@ invalid input, we should error out
 				DualCaseCheckConverted:     true,
 				Log:                        common.LogConfig{LogPrefix: "", LogFileRotationSizeMB: 100, CompressLogFile: false},
 				Tracing:                    common.TracingConfig{Endpoint: "", ServiceName: "siglens", SamplingPercentage: 1},
+				Syslog:                     common.SyslogConfig{IndexName: "syslog"},
+				FluentForward:              common.FluentForwardConfig{IndexName: "fluent"},
+				Statsd:                     common.StatsdConfig{FlushIntervalSeconds: 10, Percentiles: []float64{50, 90, 99}},
 			},
 		},
 		{ // case 4 - For no input, pick defaults
@@ -301,6 +327,9 @@ a: b
 				CompressStatic:              "true",
 				CompressStaticConverted:     true,
 				Tracing:                     common.TracingConfig{Endpoint: "", ServiceName: "siglens", SamplingPercentage: 0},
+				Syslog:                      common.SyslogConfig{IndexName: "syslog"},
+				FluentForward:               common.FluentForwardConfig{IndexName: "fluent"},
+				Statsd:                      common.StatsdConfig{FlushIntervalSeconds: 10, Percentiles: []float64{50, 90, 99}},
 			},
 		},
 	}
@@ -68,6 +68,34 @@ func CreateSingleDocReqASTNode(columnName string, columnValue string, isKibana b
 	return singleNode
 }
 
+// Matches records whose column has any of the values, over all time.
+func CreateMultiDocReqASTNode(columnName string, columnValues []string, qid uint64) *ASTNode {
+	filterCriteria := make([]*FilterCriteria, 0, len(columnValues))
+	for _, columnValue := range columnValues {
+		colValEnc, err := CreateDtypeEnclosure(columnValue, qid)
+		if err != nil {
+			log.Errorf("qid=%d, CreateMultiDocReqASTNode: failed to create DtypeEnclosure: %v", qid, err)
+			return nil
+		}
+
+		filterCriteria = append(filterCriteria, &FilterCriteria{
+			ExpressionFilter: &ExpressionFilter{
+				LeftInput:      &FilterInput{Expression: &Expression{LeftInput: &ExpressionInput{ColumnName: columnName}}},
+				FilterOperator: Equals,
+				RightInput:     &FilterInput{Expression: &Expression{LeftInput: &ExpressionInput{ColumnValue: colValEnc}}},
+			},
+		})
+	}
+
+	return &ASTNode{
+		OrFilterCondition: &Condition{FilterCriteria: filterCriteria},
+		TimeRange: &dtu.TimeRange{
+			StartEpochMs: 0,
+			EndEpochMs:   math.MaxUint64,
+		},
+	}
+}
+
 func CreateMgetReqASTNode(idColName string, idVal string, docTypeColName string, docTypeVal string, qid uint64) *ASTNode {
 	andFilterConditions := make([]*FilterCriteria, 0)
 	idDtype, err := CreateDtypeEnclosure(idVal, qid)
@@ -20,6 +20,7 @@ package writer
 import (
 	"bytes"
 	"errors"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -48,11 +49,13 @@ const (
 	CREATE
 	UPDATE
 	DELETE
+	UNKNOWN_ACTION
 )
 
 const INDEX_TOP_STR string = "index"
 const CREATE_TOP_STR string = "create"
 const UPDATE_TOP_STR string = "update"
+const DELETE_TOP_STR string = "delete"
 const INDEX_UNDER_STR string = "_index"
 
 const MAX_INDEX_NAME_LEN = 256
@@ -163,13 +166,49 @@ func HandleBulkBody(postBody []byte, ctx *fasthttp.RequestCtx, rid uint64, myid
 		}
 	}()
 
+	// Events are written in batches per index, but a delete or update has to
+	// see the events before it in the request, so those are written first.
+	pendingPLEs := make([]*writer.ParsedLogEvent, 0)
+	writePendingPLEs := func() {
+		pleBatches := utils.ConvertSliceToMap(pendingPLEs, func(ple *writer.ParsedLogEvent) string {
+			return ple.GetIndexName()
+		})
+
+		for indexName, plesInBatch := range pleBatches {
+			err := ProcessIndexRequestPle(tsNow, indexName, false, localIndexMap,
+				myid, rid, idxToStreamIdCache, cnameCacheByteHashToStr,
+				jsParsingStackbuf[:], plesInBatch)
+			if err != nil {
+				log.Errorf("HandleBulkBody: failed to process index request, indexName=%v, err=%v", indexName, err)
+				// TODO: update `atleastOneSuccess`
+			}
+		}
+		pendingPLEs = pendingPLEs[:0]
+	}
+	addPLE := func(indexName string, rawJson []byte) error {
+		ple := plePool.Get().(*writer.ParsedLogEvent)
+		ple.Reset()
+		allPLEs = append(allPLEs, ple)
+		pendingPLEs = append(pendingPLEs, ple)
+
+		ple.SetIndexName(indexName)
+		ple.SetRawJson(rawJson)
+
+		return writer.ParseRawJsonObject("", rawJson, &tsKey, jsParsingStackbuf[:], ple)
+	}
+
+	finder := newDocFinder(postBody, myid)
+
 	var err error
 	var line []byte
 	remainingPostBody := postBody
 	for {
 		line, remainingPostBody = utils.ReadLine(remainingPostBody)
-		if len(remainingPostBody) == 0 {
-			break
+		if len(bytes.TrimSpace(line)) == 0 {
+			if len(remainingPostBody) == 0 {
+				break
+			}
+			continue
 		}
 
 		inCount++
@@ -179,6 +218,9 @@ func HandleBulkBody(postBody []byte, ctx *fasthttp.RequestCtx, rid uint64, myid
 		}
 
 		esAction, indexName, idVal := extractIndexAndValidateAction(line)
+		// Set for the actions that build their own response.
+		var itemResponse map[string]interface{}
+		var itemHasError bool
 
 		switch esAction {
 
@@ -219,35 +261,66 @@ func HandleBulkBody(postBody []byte, ctx *fasthttp.RequestCtx, rid uint64, myid
 						}
 					}
 				} else {
-					ple := plePool.Get().(*writer.ParsedLogEvent)
-					ple.Reset()
-					allPLEs = append(allPLEs, ple)
-
-					ple.SetIndexName(indexName)
-					ple.SetRawJson(line)
+					line, err = addDocId(line, idVal)
+					if err != nil {
+						log.Errorf("HandleBulkBody: failed to set _id=%v, err: %v", idVal, err)
+						success = false
+						break
+					}
 
-					err := writer.ParseRawJsonObject("", line, &tsKey, jsParsingStackbuf[:], ple)
+					err := addPLE(indexName, line)
 					if err != nil {
 						log.Errorf("HandleBulkBody: ParseRawJsonObject: failed to do parsing, err: %v", err)
 						success = false
 					}
+					finder.markWritten(indexName, idVal)
 				}
 			} else {
 				success = false
 				maxRecordSizeExceeded = true
 			}
 		case UPDATE:
-			success = false
 			line, remainingPostBody = utils.ReadLine(remainingPostBody)
 			if len(line) == 0 && len(remainingPostBody) == 0 {
 				log.Errorf("HandleBulkBody: expected another line after UPDATE")
+				itemResponse = getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+					"update request is missing a body", "action_request_validation_exception")
+				itemHasError = true
 				break
 			}
+
+			bytesReceived += len(line)
+			processedCount++
+			writePendingPLEs()
+
+			var newDoc []byte
+			newDoc, itemResponse, itemHasError = updateDocById(indexName, idVal, line, finder)
+			if newDoc != nil {
+				finder.markWritten(indexName, idVal)
+				err := addPLE(indexName, newDoc)
+				if err != nil {
+					log.Errorf("HandleBulkBody: ParseRawJsonObject: failed to parse updated doc, err: %v", err)
+					itemResponse = getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+						"failed to update the document", "mapper_parse_exception")
+					itemHasError = true
+				}
+			}
+		case DELETE:
+			processedCount++
+			writePendingPLEs()
+			itemResponse, itemHasError = deleteDocById(indexName, idVal, finder)
 		default:
 			success = false
 		}
 
-		if !success {
+		if itemResponse != nil {
+			items[inCount-1] = itemResponse
+			if itemHasError {
+				overallError = true
+			} else {
+				atleastOneSuccess = true
+			}
+		} else if !success {
 			responsebody := make(map[string]interface{})
 			if maxRecordSizeExceeded {
 				error_response := utils.BulkErrorResponse{
@@ -271,19 +344,7 @@ func HandleBulkBody(postBody []byte, ctx *fasthttp.RequestCtx, rid uint64, myid
 		}
 	}
 
-	pleBatches := utils.ConvertSliceToMap(allPLEs, func(ple *writer.ParsedLogEvent) string {
-		return ple.GetIndexName()
-	})
-
-	for indexName, plesInBatch := range pleBatches {
-		err = ProcessIndexRequestPle(tsNow, indexName, false, localIndexMap,
-			myid, rid, idxToStreamIdCache, cnameCacheByteHashToStr,
-			jsParsingStackbuf[:], plesInBatch)
-		if err != nil {
-			log.Errorf("HandleBulkBody: failed to process index request, indexName=%v, err=%v", indexName, err)
-			// TODO: update `atleastOneSuccess`
-		}
-	}
+	writePendingPLEs()
 
 	usageStats.UpdateStats(uint64(bytesReceived), uint64(inCount), myid)
 	timeTook := time.Now().UnixNano() - (startTime)
@@ -298,6 +359,19 @@ func HandleBulkBody(postBody []byte, ctx *fasthttp.RequestCtx, rid uint64, myid
 	}
 }
 
+// Stores the _id from the action metadata in the doc, so the doc can be
+// deleted or updated later. A doc without an _id is returned unchanged, so it
+// doesn't get an _id column.
+func addDocId(rawJson []byte, idVal string) ([]byte, error) {
+	if idVal == "" {
+		return rawJson, nil
+	}
+
+	// The line is copied since Set may write past its end, into the rest of
+	// the request.
+	return jp.Set(append([]byte(nil), rawJson...), []byte(strconv.Quote(idVal)), "_id")
+}
+
 func extractIndexAndValidateAction(rawJson []byte) (int, string, string) {
 
 	val, dType, _, err := jp.Get(rawJson, INDEX_TOP_STR)
@@ -341,7 +415,20 @@ func extractIndexAndValidateAction(rawJson []byte) (int, string, string) {
 		}
 		return UPDATE, idxVal, idVal
 	}
-	return DELETE, "eventType", ""
+	val, dType, _, err = jp.Get(rawJson, DELETE_TOP_STR)
+	if err == nil && dType == jp.Object {
+		idVal, err := jp.GetString(val, "_id")
+		if err != nil {
+			idVal = ""
+		}
+
+		idxVal, err := jp.GetString(val, INDEX_UNDER_STR)
+		if err != nil {
+			idxVal = ""
+		}
+		return DELETE, idxVal, idVal
+	}
+	return UNKNOWN_ACTION, "eventType", ""
 }
 
 func AddAndGetRealIndexName(indexNameIn string, localIndexMap map[string]string, myid uint64) string {
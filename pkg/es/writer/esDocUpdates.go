@@ -0,0 +1,486 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nqd/flat"
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/es/query"
+	rutils "github.com/siglens/siglens/pkg/readerUtils"
+	"github.com/siglens/siglens/pkg/segment"
+	"github.com/siglens/siglens/pkg/segment/reader/record"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
+	segutils "github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/siglens/siglens/pkg/segment/writer"
+	"github.com/siglens/siglens/pkg/utils"
+	vtable "github.com/siglens/siglens/pkg/virtualtable"
+	log "github.com/sirupsen/logrus"
+)
+
+// Docs indexed more than once with the same _id are stored as separate
+// records; deleting or updating the _id replaces all of them.
+const MAX_DOCS_WITH_SAME_ID = 1000
+
+type updateRequest struct {
+	Doc         map[string]interface{} `json:"doc"`
+	DocAsUpsert bool                   `json:"doc_as_upsert"`
+	Upsert      map[string]interface{} `json:"upsert"`
+	Script      interface{}            `json:"script"`
+}
+
+// Records can't be removed from segment files, so deleting a doc tombstones
+// its records and searches skip them from then on.
+func deleteDocById(indexName string, idVal string, finder *docFinder) (map[string]interface{}, bool) {
+	if idVal == "" {
+		return getBulkItemErrorResponse(DELETE_TOP_STR, indexName, idVal, 400,
+			"Validation Failed: 1: id is missing;", "action_request_validation_exception"), true
+	}
+
+	rrcs, segEncToKey, err := finder.find(indexName, idVal)
+	if err != nil {
+		log.Errorf("deleteDocById: failed to find doc %v in index %v; err=%v", idVal, indexName, err)
+		return getBulkItemErrorResponse(DELETE_TOP_STR, indexName, idVal, 500, "failed to find the document", "exception"), true
+	}
+
+	if len(rrcs) == 0 {
+		return getBulkItemResponse(DELETE_TOP_STR, indexName, idVal, 404, "not_found"), false
+	}
+
+	err = tombstoneDocs(rrcs, segEncToKey)
+	if err != nil {
+		log.Errorf("deleteDocById: failed to delete doc %v in index %v; err=%v", idVal, indexName, err)
+		return getBulkItemErrorResponse(DELETE_TOP_STR, indexName, idVal, 500, "failed to delete the document", "exception"), true
+	}
+	finder.markDeleted(indexName, idVal)
+
+	return getBulkItemResponse(DELETE_TOP_STR, indexName, idVal, 200, "deleted"), false
+}
+
+// Merges the partial doc in the request into the stored doc and returns the
+// resulting doc, which the caller must index. The records of the stored doc
+// are tombstoned. If there's no stored doc, the returned doc is the upsert doc
+// of the request, if any.
+func updateDocById(indexName string, idVal string, body []byte, finder *docFinder) ([]byte, map[string]interface{}, bool) {
+	if idVal == "" {
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"Validation Failed: 1: id is missing;", "action_request_validation_exception"), true
+	}
+
+	request := updateRequest{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&request)
+	if err != nil {
+		log.Errorf("updateDocById: failed to parse update request %v; err=%v", string(body), err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"failed to parse update request", "parse_exception"), true
+	}
+
+	if request.Script != nil {
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"script updates are not supported", "illegal_argument_exception"), true
+	}
+	if request.Doc == nil {
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"Validation Failed: 1: script or doc is missing;", "action_request_validation_exception"), true
+	}
+
+	rrcs, segEncToKey, err := finder.find(indexName, idVal)
+	if err != nil {
+		log.Errorf("updateDocById: failed to find doc %v in index %v; err=%v", idVal, indexName, err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 500, "failed to find the document", "exception"), true
+	}
+
+	if len(rrcs) == 0 {
+		upsertDoc := request.Upsert
+		if request.DocAsUpsert {
+			upsertDoc = request.Doc
+		}
+		if upsertDoc == nil {
+			return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 404,
+				fmt.Sprintf("[%v]: document missing", idVal), "document_missing_exception"), true
+		}
+
+		upsertDoc["_id"] = idVal
+		newDoc, err := json.Marshal(upsertDoc)
+		if err != nil {
+			log.Errorf("updateDocById: failed to marshal upsert doc %v; err=%v", upsertDoc, err)
+			return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+				"failed to create the document", "mapper_parse_exception"), true
+		}
+
+		return newDoc, getBulkItemResponse(UPDATE_TOP_STR, indexName, idVal, 201, "created"), false
+	}
+
+	latestRRC := rrcs[0]
+	for _, rrc := range rrcs[1:] {
+		if rrc.TimeStamp > latestRRC.TimeStamp {
+			latestRRC = rrc
+		}
+	}
+
+	source, err := readDocSource(latestRRC, segEncToKey)
+	if err != nil {
+		log.Errorf("updateDocById: failed to read doc %v in index %v; err=%v", idVal, indexName, err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 500, "failed to read the document", "exception"), true
+	}
+
+	err = mergePartialDoc(source, "", request.Doc)
+	if err != nil {
+		log.Errorf("updateDocById: failed to merge partial doc %v; err=%v", request.Doc, err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"failed to merge the partial document", "mapper_parse_exception"), true
+	}
+	source["_id"] = idVal
+
+	newDoc, err := json.Marshal(source)
+	if err != nil {
+		log.Errorf("updateDocById: failed to marshal updated doc %v; err=%v", source, err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 400,
+			"failed to update the document", "mapper_parse_exception"), true
+	}
+
+	err = tombstoneDocs(rrcs, segEncToKey)
+	if err != nil {
+		log.Errorf("updateDocById: failed to delete old version of doc %v in index %v; err=%v", idVal, indexName, err)
+		return nil, getBulkItemErrorResponse(UPDATE_TOP_STR, indexName, idVal, 500, "failed to update the document", "exception"), true
+	}
+	finder.markDeleted(indexName, idVal)
+
+	return newDoc, getBulkItemResponse(UPDATE_TOP_STR, indexName, idVal, 200, "updated"), false
+}
+
+// Finds the stored docs for the deletes and updates of one bulk request.
+// Looking up each _id on its own would flush the index and search all of it
+// once per item, so all the _ids of the request are looked up together the
+// first time one of them is needed. An _id that's written again later in the
+// request is looked up again, since the first search couldn't see its new
+// records.
+type docFinder struct {
+	myid uint64
+
+	// Maps a real index name to the _ids deleted or updated in the request.
+	neededIds map[string]map[string]struct{}
+
+	// Maps a real index name to the _ids that have to be looked up before
+	// their docs can be used.
+	idsToFind map[string]map[string]struct{}
+
+	// Maps a real index name and _id to the docs last found for it.
+	foundDocs map[string]map[string]*storedDocs
+}
+
+type storedDocs struct {
+	rrcs        []*segutils.RecordResultContainer
+	segEncToKey map[uint16]string
+}
+
+// Collects the _ids of every delete and update in the request body.
+func newDocFinder(postBody []byte, myid uint64) *docFinder {
+	finder := &docFinder{
+		myid:      myid,
+		neededIds: make(map[string]map[string]struct{}),
+		idsToFind: make(map[string]map[string]struct{}),
+		foundDocs: make(map[string]map[string]*storedDocs),
+	}
+
+	var line []byte
+	remainingPostBody := postBody
+	for len(remainingPostBody) > 0 {
+		line, remainingPostBody = utils.ReadLine(remainingPostBody)
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		esAction, indexName, idVal := extractIndexAndValidateAction(line)
+		switch esAction {
+		case INDEX, CREATE:
+			_, remainingPostBody = utils.ReadLine(remainingPostBody)
+		case UPDATE:
+			_, remainingPostBody = utils.ReadLine(remainingPostBody)
+			finder.addNeededId(indexName, idVal)
+		case DELETE:
+			finder.addNeededId(indexName, idVal)
+		}
+	}
+
+	return finder
+}
+
+func (f *docFinder) addNeededId(indexName string, idVal string) {
+	if idVal == "" {
+		return
+	}
+
+	realIndexName := getRealIndexName(indexName, f.myid)
+	addToIdSet(f.neededIds, realIndexName, idVal)
+	addToIdSet(f.idsToFind, realIndexName, idVal)
+}
+
+func addToIdSet(idSets map[string]map[string]struct{}, indexName string, idVal string) {
+	if _, ok := idSets[indexName]; !ok {
+		idSets[indexName] = make(map[string]struct{})
+	}
+	idSets[indexName][idVal] = struct{}{}
+}
+
+// Must be called whenever a doc with the _id is written during the request.
+func (f *docFinder) markWritten(indexName string, idVal string) {
+	if idVal == "" {
+		return
+	}
+
+	realIndexName := getRealIndexName(indexName, f.myid)
+	if _, ok := f.neededIds[realIndexName][idVal]; !ok {
+		return
+	}
+
+	delete(f.foundDocs[realIndexName], idVal)
+	addToIdSet(f.idsToFind, realIndexName, idVal)
+}
+
+// Must be called once the docs found for the _id are tombstoned.
+func (f *docFinder) markDeleted(indexName string, idVal string) {
+	realIndexName := getRealIndexName(indexName, f.myid)
+	if _, ok := f.foundDocs[realIndexName]; !ok {
+		f.foundDocs[realIndexName] = make(map[string]*storedDocs)
+	}
+	f.foundDocs[realIndexName][idVal] = &storedDocs{}
+}
+
+// Returns the records stored with the _id, along with the mapping from their
+// segment key encodings to segment keys. The buffered records of the index
+// are flushed before searching, so docs ingested moments ago are found too.
+func (f *docFinder) find(indexName string, idVal string) ([]*segutils.RecordResultContainer, map[uint16]string, error) {
+	realIndexName := getRealIndexName(indexName, f.myid)
+	docs, ok := f.foundDocs[realIndexName][idVal]
+	if !ok {
+		addToIdSet(f.idsToFind, realIndexName, idVal)
+		err := f.findAll(realIndexName)
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = f.foundDocs[realIndexName][idVal]
+	}
+
+	return docs.rrcs, docs.segEncToKey, nil
+}
+
+// Looks up all the _ids of the index that still need to be found.
+func (f *docFinder) findAll(indexName string) error {
+	if !config.IsQueryNode() {
+		return fmt.Errorf("docFinder.findAll: cannot find docs since this node does not run queries")
+	}
+
+	ids := utils.GetKeysOfMap(f.idsToFind[indexName])
+	delete(f.idsToFind, indexName)
+
+	err := writer.FlushWipBufferForIndex(indexName, f.myid)
+	if err != nil {
+		return fmt.Errorf("docFinder.findAll: failed to flush index %v; err=%v", indexName, err)
+	}
+
+	qid := rutils.GetNextQid()
+	searchNode := query.CreateMultiDocReqASTNode("_id", ids, qid)
+	if searchNode == nil {
+		return fmt.Errorf("docFinder.findAll: failed to create query for %v _ids", len(ids))
+	}
+
+	qc := structs.InitQueryContext(indexName, uint64(MAX_DOCS_WITH_SAME_ID*len(ids)), 0, f.myid, true)
+	result := segment.ExecuteQuery(searchNode, &structs.QueryAggregators{}, qid, qc)
+	if result == nil {
+		return fmt.Errorf("docFinder.findAll: query for %v _ids returned no result", len(ids))
+	}
+	if len(result.ErrList) > 0 {
+		return fmt.Errorf("docFinder.findAll: query for %v _ids failed; err=%v", len(ids), result.ErrList[0])
+	}
+
+	idToRRCs, err := groupRRCsById(result.AllRecords, result.SegEncToKey, qid)
+	if err != nil {
+		return fmt.Errorf("docFinder.findAll: %v", err)
+	}
+
+	if _, ok := f.foundDocs[indexName]; !ok {
+		f.foundDocs[indexName] = make(map[string]*storedDocs, len(ids))
+	}
+	for _, idVal := range ids {
+		f.foundDocs[indexName][idVal] = &storedDocs{rrcs: idToRRCs[idVal], segEncToKey: result.SegEncToKey}
+	}
+
+	return nil
+}
+
+func groupRRCsById(rrcs []*segutils.RecordResultContainer, segEncToKey map[uint16]string,
+	qid uint64) (map[string][]*segutils.RecordResultContainer, error) {
+
+	segKeyToRRCs := make(map[string][]*segutils.RecordResultContainer)
+	for _, rrc := range rrcs {
+		if rrc.SegKeyInfo.IsRemote {
+			continue
+		}
+
+		segKey, ok := segEncToKey[rrc.SegKeyInfo.SegKeyEnc]
+		if !ok {
+			return nil, fmt.Errorf("groupRRCsById: unknown segment key encoding %v", rrc.SegKeyInfo.SegKeyEnc)
+		}
+		segKeyToRRCs[segKey] = append(segKeyToRRCs[segKey], rrc)
+	}
+
+	idToRRCs := make(map[string][]*segutils.RecordResultContainer)
+	for segKey, rrcsInSegment := range segKeyToRRCs {
+		ids, err := record.ReadColForRRCs(segKey, rrcsInSegment, "_id", qid, true)
+		if err != nil {
+			return nil, fmt.Errorf("groupRRCsById: failed to read _id from segKey %v; err=%v", segKey, err)
+		}
+
+		for i, rrc := range rrcsInSegment {
+			idVal, err := ids[i].GetString()
+			if err != nil {
+				continue
+			}
+			idToRRCs[idVal] = append(idToRRCs[idVal], rrc)
+		}
+	}
+
+	return idToRRCs, nil
+}
+
+func tombstoneDocs(rrcs []*segutils.RecordResultContainer, segEncToKey map[uint16]string) error {
+	segKeyToRecords := make(map[string]map[uint16][]uint16)
+	for _, rrc := range rrcs {
+		segKey, ok := segEncToKey[rrc.SegKeyInfo.SegKeyEnc]
+		if !ok {
+			return fmt.Errorf("tombstoneDocs: unknown segment key encoding %v", rrc.SegKeyInfo.SegKeyEnc)
+		}
+
+		if _, ok := segKeyToRecords[segKey]; !ok {
+			segKeyToRecords[segKey] = make(map[uint16][]uint16)
+		}
+		segKeyToRecords[segKey][rrc.BlockNum] = append(segKeyToRecords[segKey][rrc.BlockNum], rrc.RecordNum)
+	}
+
+	for segKey, records := range segKeyToRecords {
+		err := tombstones.AddTombstones(segKey, records)
+		if err != nil {
+			return fmt.Errorf("tombstoneDocs: failed to tombstone records in segKey %v; err=%v", segKey, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the stored columns of the record. Nested fields are flattened, the
+// same way they are when ingested.
+func readDocSource(rrc *segutils.RecordResultContainer, segEncToKey map[uint16]string) (map[string]interface{}, error) {
+	segKey, ok := segEncToKey[rrc.SegKeyInfo.SegKeyEnc]
+	if !ok {
+		return nil, fmt.Errorf("readDocSource: unknown segment key encoding %v", rrc.SegKeyInfo.SegKeyEnc)
+	}
+
+	ignoredCols := map[string]struct{}{"_index": {}}
+	colToValues, err := record.ReadAllColsForRRCs(segKey, rrc.VirtualTableName,
+		[]*segutils.RecordResultContainer{rrc}, 0, ignoredCols, true)
+	if err != nil {
+		return nil, fmt.Errorf("readDocSource: failed to read record from segKey %v; err=%v", segKey, err)
+	}
+
+	source := make(map[string]interface{}, len(colToValues))
+	for cname, values := range colToValues {
+		if len(values) == 0 || values[0].CVal == nil {
+			continue
+		}
+		source[cname] = values[0].CVal
+	}
+
+	return source, nil
+}
+
+// Applies the partial doc to the flattened source. Like Elasticsearch, objects
+// are merged recursively, while any other value, including an array, replaces
+// the old value and everything nested under it.
+func mergePartialDoc(source map[string]interface{}, prefix string, partialDoc map[string]interface{}) error {
+	for key, value := range partialDoc {
+		fullKey := prefix + key
+
+		if object, ok := value.(map[string]interface{}); ok && len(object) > 0 {
+			delete(source, fullKey)
+			err := mergePartialDoc(source, fullKey+".", object)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for existingKey := range source {
+			if existingKey == fullKey || strings.HasPrefix(existingKey, fullKey+".") {
+				delete(source, existingKey)
+			}
+		}
+
+		flattened, err := flat.Flatten(map[string]interface{}{fullKey: value}, nil)
+		if err != nil {
+			return fmt.Errorf("mergePartialDoc: failed to flatten %v; err=%v", fullKey, err)
+		}
+		for flatKey, flatValue := range flattened {
+			source[flatKey] = flatValue
+		}
+	}
+
+	return nil
+}
+
+// Unlike AddAndGetRealIndexName, this doesn't create the index if it doesn't
+// exist.
+func getRealIndexName(indexName string, myid uint64) string {
+	if isAlias, realName := vtable.IsAlias(indexName, myid); isAlias {
+		return realName
+	}
+
+	return indexName
+}
+
+func getBulkItemResponse(action string, indexName string, idVal string, status int, result string) map[string]interface{} {
+	return map[string]interface{}{
+		action: map[string]interface{}{
+			"_index": indexName,
+			"_id":    idVal,
+			"status": status,
+			"result": result,
+		},
+	}
+}
+
+func getBulkItemErrorResponse(action string, indexName string, idVal string, status int, reason string,
+	errType string) map[string]interface{} {
+
+	return map[string]interface{}{
+		action: map[string]interface{}{
+			"_index": indexName,
+			"_id":    idVal,
+			"status": status,
+			"error":  utils.NewBulkErrorResponseInfo(reason, errType),
+		},
+	}
+}
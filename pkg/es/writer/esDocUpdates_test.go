@@ -0,0 +1,163 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package writer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_extractIndexAndValidateAction(t *testing.T) {
+	action, indexName, idVal := extractIndexAndValidateAction([]byte(`{"delete": {"_index": "logs", "_id": "abc"}}`))
+	assert.Equal(t, DELETE, action)
+	assert.Equal(t, "logs", indexName)
+	assert.Equal(t, "abc", idVal)
+
+	action, indexName, idVal = extractIndexAndValidateAction([]byte(`{"update": {"_index": "logs", "_id": "abc"}}`))
+	assert.Equal(t, UPDATE, action)
+	assert.Equal(t, "logs", indexName)
+	assert.Equal(t, "abc", idVal)
+
+	action, _, _ = extractIndexAndValidateAction([]byte(`{"unknown": {"_index": "logs"}}`))
+	assert.Equal(t, UNKNOWN_ACTION, action)
+}
+
+func Test_addDocId(t *testing.T) {
+	doc, err := addDocId([]byte(`{"message": "hello"}`), "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"message": "hello"}`, string(doc))
+
+	doc, err = addDocId([]byte(`{"message": "hello"}`), "abc")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"message": "hello", "_id": "abc"}`, string(doc))
+}
+
+func Test_mergePartialDoc(t *testing.T) {
+	source := map[string]interface{}{
+		"_id":         "abc",
+		"message":     "hello",
+		"user.name":   "alice",
+		"user.id":     1,
+		"tags.0":      "a",
+		"tags.1":      "b",
+		"status":      "open",
+		"geo.lat":     1.5,
+		"geo.lon":     2.5,
+		"unchanged.x": true,
+	}
+	partialDoc := map[string]interface{}{
+		"message": "bye",
+		"user":    map[string]interface{}{"name": "bob", "email": "bob@example.com"},
+		"tags":    []interface{}{"c"},
+		"status":  map[string]interface{}{"code": 2},
+		"geo":     "unknown",
+	}
+
+	err := mergePartialDoc(source, "", partialDoc)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"_id":         "abc",
+		"message":     "bye",
+		"user.name":   "bob",
+		"user.id":     1,
+		"user.email":  "bob@example.com",
+		"tags.0":      "c",
+		"status.code": 2,
+		"geo":         "unknown",
+		"unchanged.x": true,
+	}, source)
+}
+
+func Test_HandleBulkBody_DeleteAndUpdateWithoutId(t *testing.T) {
+	body := []byte(`{"update": {"_index": "logs"}}
+{"doc": {"a": 1}}
+{"delete": {"_index": "logs"}}
+`)
+
+	processedCount, response, err := HandleBulkBody(body, nil, 0, 0, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, processedCount)
+	assert.Equal(t, true, response["errors"])
+
+	items := response["items"].([]interface{})
+	assert.Len(t, items, 2)
+
+	expectedItems := []map[string]interface{}{
+		getBulkItemErrorResponse(UPDATE_TOP_STR, "logs", "", 400,
+			"Validation Failed: 1: id is missing;", "action_request_validation_exception"),
+		getBulkItemErrorResponse(DELETE_TOP_STR, "logs", "", 400,
+			"Validation Failed: 1: id is missing;", "action_request_validation_exception"),
+	}
+	for i, expected := range expectedItems {
+		expectedJson, err := json.Marshal(expected)
+		assert.Nil(t, err)
+		actualJson, err := json.Marshal(items[i])
+		assert.Nil(t, err)
+		assert.JSONEq(t, string(expectedJson), string(actualJson))
+	}
+}
+
+func Test_newDocFinder(t *testing.T) {
+	body := []byte(`{"index": {"_index": "logs", "_id": "1"}}
+{"a": 1}
+{"update": {"_index": "logs", "_id": "2"}}
+{"doc": {"a": 2}}
+
+{"delete": {"_index": "logs", "_id": "3"}}
+{"delete": {"_index": "other", "_id": "4"}}
+{"delete": {"_index": "logs"}}
+`)
+
+	finder := newDocFinder(body, 0)
+	expected := map[string]map[string]struct{}{
+		"logs":  {"2": {}, "3": {}},
+		"other": {"4": {}},
+	}
+	assert.Equal(t, expected, finder.idsToFind)
+	assert.Equal(t, expected, finder.neededIds)
+
+	// Deleted docs don't need to be looked up again.
+	finder.markDeleted("logs", "3")
+	rrcs, _, err := finder.find("logs", "3")
+	assert.Nil(t, err)
+	assert.Empty(t, rrcs)
+
+	// Writing an _id that's deleted or updated later means it has to be
+	// looked up again, but other _ids don't.
+	delete(finder.idsToFind, "logs")
+	finder.markWritten("logs", "1")
+	finder.markWritten("logs", "3")
+	assert.Equal(t, map[string]struct{}{"3": {}}, finder.idsToFind["logs"])
+	_, ok := finder.foundDocs["logs"]["3"]
+	assert.False(t, ok)
+}
+
+func Test_getBulkItemResponse(t *testing.T) {
+	response := getBulkItemResponse(DELETE_TOP_STR, "logs", "abc", 404, "not_found")
+	responseJson, err := json.Marshal(response)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"delete": {"_index": "logs", "_id": "abc", "status": 404, "result": "not_found"}}`, string(responseJson))
+
+	response = getBulkItemErrorResponse(UPDATE_TOP_STR, "logs", "abc", 404, "[abc]: document missing", "document_missing_exception")
+	responseJson, err = json.Marshal(response)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"update": {"_index": "logs", "_id": "abc", "status": 404,
+		"error": {"reason": "[abc]: document missing", "type": "document_missing_exception"}}}`, string(responseJson))
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fluentforward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config/common"
+)
+
+type forwardEntry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// Parses a message in any of the Forward protocol's modes. Returns the tag,
+// the entries, and the chunk id to acknowledge, which is empty if the client
+// didn't ask for an ack.
+func parseForwardMessage(message interface{}) (string, []forwardEntry, string, error) {
+	array, ok := message.([]interface{})
+	if !ok || len(array) < 2 {
+		return "", nil, "", fmt.Errorf("parseForwardMessage: expected an array of at least 2 elements but got %T", message)
+	}
+
+	tag, ok := array[0].(string)
+	if !ok {
+		return "", nil, "", fmt.Errorf("parseForwardMessage: expected the tag to be a string but got %T", array[0])
+	}
+
+	var option map[string]interface{}
+	var entries []forwardEntry
+	var err error
+	switch events := array[1].(type) {
+	case []interface{}:
+		// Forward mode: [tag, [[time, record], ...], option]
+		option, err = getOption(array, 2)
+		if err != nil {
+			return "", nil, "", err
+		}
+		entries, err = parseEntries(events)
+	case string, []byte:
+		// PackedForward and CompressedPackedForward modes:
+		// [tag, <concatenated entries>, option]
+		option, err = getOption(array, 2)
+		if err != nil {
+			return "", nil, "", err
+		}
+		entries, err = parsePackedEntries([]byte(toString(events)), option)
+	default:
+		// Message mode: [tag, time, record, option]
+		if len(array) < 3 {
+			return "", nil, "", fmt.Errorf("parseForwardMessage: expected a record after the time")
+		}
+		option, err = getOption(array, 3)
+		if err != nil {
+			return "", nil, "", err
+		}
+		var entry forwardEntry
+		entry, err = parseEntry(array[1], array[2])
+		entries = []forwardEntry{entry}
+	}
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	chunk, _ := option["chunk"].(string)
+	return tag, entries, chunk, nil
+}
+
+func getOption(array []interface{}, index int) (map[string]interface{}, error) {
+	if len(array) <= index || array[index] == nil {
+		return nil, nil
+	}
+
+	option, ok := array[index].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("getOption: expected the option to be a map but got %T", array[index])
+	}
+
+	return option, nil
+}
+
+func parseEntries(events []interface{}) ([]forwardEntry, error) {
+	entries := make([]forwardEntry, 0, len(events))
+	for _, event := range events {
+		pair, ok := event.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("parseEntries: expected a [time, record] pair but got %v", event)
+		}
+
+		entry, err := parseEntry(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// The entries are a stream of MessagePack encoded [time, record] pairs,
+// optionally gzipped. All the entries together may decompress to at most
+// maxMessageSize bytes.
+func parsePackedEntries(data []byte, option map[string]interface{}) ([]forwardEntry, error) {
+	var reader io.Reader = bytes.NewReader(data)
+	compression, _ := option["compressed"].(string)
+	switch compression {
+	case "":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("parsePackedEntries: failed to read gzip header; err=%v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	default:
+		return nil, fmt.Errorf("parsePackedEntries: unsupported compression %v", compression)
+	}
+
+	decoder := newMsgpackDecoder(bufio.NewReader(reader))
+	entries := make([]forwardEntry, 0)
+	remaining := maxMessageSize
+	for {
+		event, err := decoder.decode(remaining)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsePackedEntries: failed to decode entry; err=%v", err)
+		}
+		remaining = decoder.remaining
+
+		pair, ok := event.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("parsePackedEntries: expected a [time, record] pair but got %v", event)
+		}
+
+		entry, err := parseEntry(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func parseEntry(rawTime interface{}, rawRecord interface{}) (forwardEntry, error) {
+	record, ok := rawRecord.(map[string]interface{})
+	if !ok {
+		return forwardEntry{}, fmt.Errorf("parseEntry: expected the record to be a map but got %T", rawRecord)
+	}
+
+	var timestamp time.Time
+	switch rawTime := rawTime.(type) {
+	case time.Time:
+		timestamp = rawTime
+	case int64:
+		timestamp = time.Unix(rawTime, 0)
+	case uint64:
+		timestamp = time.Unix(int64(rawTime), 0)
+	case float64:
+		seconds := int64(rawTime)
+		timestamp = time.Unix(seconds, int64((rawTime-float64(seconds))*1e9))
+	default:
+		return forwardEntry{}, fmt.Errorf("parseEntry: expected the time to be a number or EventTime but got %T", rawTime)
+	}
+
+	return forwardEntry{time: timestamp, record: record}, nil
+}
+
+// Clients choose their tags, so the cache is cleared once it holds this many
+// rather than growing with every tag a client sends.
+const maxCachedTags = 10_000
+
+type tagRule struct {
+	pattern   *regexp.Regexp
+	indexName string
+}
+
+// Maps fluent tags to index names using the first rule whose match pattern
+// matches the tag, falling back to a default index. Patterns use fluentd's
+// syntax: `*` matches one tag part, `**` matches zero or more parts, and
+// `{a,b}` matches either pattern.
+type tagRouter struct {
+	rules            []tagRule
+	defaultIndexName string
+
+	mutex sync.RWMutex
+	cache map[string]string
+}
+
+func newTagRouter(rules []common.FluentTagRule, defaultIndexName string) (*tagRouter, error) {
+	router := &tagRouter{
+		rules:            make([]tagRule, 0, len(rules)),
+		defaultIndexName: defaultIndexName,
+		cache:            make(map[string]string),
+	}
+
+	for _, rule := range rules {
+		pattern, err := compileTagPattern(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("newTagRouter: invalid match pattern %v; err=%v", rule.Match, err)
+		}
+		router.rules = append(router.rules, tagRule{pattern: pattern, indexName: rule.IndexName})
+	}
+
+	return router, nil
+}
+
+func (r *tagRouter) getIndexName(tag string) string {
+	r.mutex.RLock()
+	indexName, ok := r.cache[tag]
+	r.mutex.RUnlock()
+	if ok {
+		return indexName
+	}
+
+	indexName = r.defaultIndexName
+	for _, rule := range r.rules {
+		if rule.pattern.MatchString(tag) {
+			indexName = rule.indexName
+			break
+		}
+	}
+
+	r.mutex.Lock()
+	if len(r.cache) >= maxCachedTags {
+		r.cache = make(map[string]string)
+	}
+	r.cache[tag] = indexName
+	r.mutex.Unlock()
+
+	return indexName
+}
+
+func compileTagPattern(pattern string) (*regexp.Regexp, error) {
+	expr, rest, err := tagPatternToRegex(pattern, false)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("compileTagPattern: unmatched '}'")
+	}
+
+	return regexp.Compile("^" + expr + "$")
+}
+
+// Converts the pattern to a regex, stopping at an unmatched ',' or '}' when
+// inside braces. Returns the regex and the unconverted rest of the pattern.
+func tagPatternToRegex(pattern string, inBraces bool) (string, string, error) {
+	var sb strings.Builder
+	for len(pattern) > 0 {
+		switch {
+		case strings.HasPrefix(pattern, ".**"):
+			// Zero or more parts, so "a.**" matches "a" too.
+			sb.WriteString(`(\..*)?`)
+			pattern = pattern[3:]
+		case strings.HasPrefix(pattern, "**"):
+			sb.WriteString(`.*`)
+			pattern = pattern[2:]
+		case pattern[0] == '*':
+			sb.WriteString(`[^.]*`)
+			pattern = pattern[1:]
+		case pattern[0] == '{':
+			var alternatives []string
+			rest := pattern[1:]
+			for {
+				expr, remaining, err := tagPatternToRegex(rest, true)
+				if err != nil {
+					return "", "", err
+				}
+				if remaining == "" {
+					return "", "", fmt.Errorf("tagPatternToRegex: unmatched '{'")
+				}
+
+				alternatives = append(alternatives, expr)
+				rest = remaining[1:]
+				if remaining[0] == '}' {
+					break
+				}
+			}
+			sb.WriteString("(?:" + strings.Join(alternatives, "|") + ")")
+			pattern = rest
+		case inBraces && (pattern[0] == ',' || pattern[0] == '}'):
+			return sb.String(), pattern, nil
+		case pattern[0] == '}':
+			return sb.String(), pattern, nil
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[:1]))
+			pattern = pattern[1:]
+		}
+	}
+
+	return sb.String(), "", nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fluentforward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, value interface{}) []byte {
+	buf, err := appendMsgpack(nil, value)
+	assert.NoError(t, err)
+	return buf
+}
+
+func decode(t *testing.T, data []byte) interface{} {
+	decoder := newMsgpackDecoder(bufio.NewReader(bytes.NewReader(data)))
+	value, err := decoder.decode(len(data))
+	assert.NoError(t, err)
+	return value
+}
+
+func Test_Msgpack_RoundTrip(t *testing.T) {
+	longString := string(bytes.Repeat([]byte("a"), 300))
+	value := []interface{}{
+		nil, true, false, int64(5), int64(-3), int64(-1000), uint64(1 << 40), 1.5,
+		"short", longString, []byte{1, 2, 3},
+		time.Unix(1_700_000_000, 123),
+		map[string]interface{}{"nested": []interface{}{int64(1), "x"}},
+	}
+
+	assert.Equal(t, value, decode(t, encode(t, value)))
+}
+
+func Test_Msgpack_FixedWidthTypes(t *testing.T) {
+	// int8 -1, int16 -2, uint16 300, float32 0.5, str8 "hi", map with int key
+	data := []byte{0x96, 0xd0, 0xff, 0xd1, 0xff, 0xfe, 0xcd, 0x01, 0x2c, 0xca, 0x3f, 0x00, 0x00, 0x00,
+		0xd9, 0x02, 'h', 'i', 0x81, 0x01, 0xc0}
+	assert.Equal(t, []interface{}{int64(-1), int64(-2), uint64(300), 0.5, "hi", map[string]interface{}{"1": nil}},
+		decode(t, data))
+}
+
+func Test_Msgpack_SizeLimit(t *testing.T) {
+	// An array claiming 2^32-1 elements.
+	data := []byte{0xdd, 0xff, 0xff, 0xff, 0xff}
+	decoder := newMsgpackDecoder(bufio.NewReader(bytes.NewReader(data)))
+	_, err := decoder.decode(1024)
+	assert.Error(t, err)
+
+	data = encode(t, "a string that is too long")
+	decoder = newMsgpackDecoder(bufio.NewReader(bytes.NewReader(data)))
+	_, err = decoder.decode(10)
+	assert.Error(t, err)
+}
+
+func Test_Msgpack_DepthLimit(t *testing.T) {
+	// Arrays of one element nested far deeper than maxMsgpackDepth.
+	data := append(bytes.Repeat([]byte{0x91}, 100_000), 0xc0)
+	decoder := newMsgpackDecoder(bufio.NewReader(bytes.NewReader(data)))
+	_, err := decoder.decode(len(data))
+	assert.Error(t, err)
+
+	// Maps count towards the depth too.
+	data = bytes.Repeat([]byte{0x81, 0xa1, 'k'}, 200)
+	data = append(data, 0xc0)
+	decoder = newMsgpackDecoder(bufio.NewReader(bytes.NewReader(data)))
+	_, err = decoder.decode(len(data))
+	assert.Error(t, err)
+
+	data = append(bytes.Repeat([]byte{0x91}, maxMsgpackDepth), 0xc0)
+	assert.NotNil(t, decode(t, data))
+}
+
+func Test_ParseForwardMessage(t *testing.T) {
+	eventTime := time.Unix(1_700_000_000, 5_000_000)
+	record := map[string]interface{}{"log": "hello"}
+	expected := []forwardEntry{{time: eventTime, record: record}}
+	option := map[string]interface{}{"chunk": "abc"}
+
+	// Message mode
+	tag, entries, chunk, err := parseForwardMessage([]interface{}{"app", eventTime, record, option})
+	assert.NoError(t, err)
+	assert.Equal(t, "app", tag)
+	assert.Equal(t, expected, entries)
+	assert.Equal(t, "abc", chunk)
+
+	// Message mode with integer time and no option
+	_, entries, chunk, err = parseForwardMessage([]interface{}{"app", int64(1_700_000_000), record})
+	assert.NoError(t, err)
+	assert.Equal(t, []forwardEntry{{time: time.Unix(1_700_000_000, 0), record: record}}, entries)
+	assert.Equal(t, "", chunk)
+
+	// Forward mode
+	_, entries, chunk, err = parseForwardMessage([]interface{}{"app", []interface{}{[]interface{}{eventTime, record}}, option})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, entries)
+	assert.Equal(t, "abc", chunk)
+
+	// PackedForward mode
+	packed := encode(t, []interface{}{eventTime, record})
+	packed = append(packed, packed...)
+	_, entries, _, err = parseForwardMessage([]interface{}{"app", packed, option})
+	assert.NoError(t, err)
+	assert.Equal(t, append(expected, expected...), entries)
+
+	// CompressedPackedForward mode
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err = gzipWriter.Write(packed)
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+	compressedOption := map[string]interface{}{"chunk": "abc", "compressed": "gzip"}
+	_, entries, _, err = parseForwardMessage([]interface{}{"app", compressed.Bytes(), compressedOption})
+	assert.NoError(t, err)
+	assert.Equal(t, append(expected, expected...), entries)
+}
+
+func Test_ParseForwardMessage_Invalid(t *testing.T) {
+	invalid := []interface{}{
+		"not an array",
+		[]interface{}{int64(1), int64(2), map[string]interface{}{}},
+		[]interface{}{"app", int64(1)},
+		[]interface{}{"app", int64(1), "not a record"},
+		[]interface{}{"app", "not a time", map[string]interface{}{}},
+		[]interface{}{"app", []byte{0x01}, map[string]interface{}{"compressed": "zstd"}},
+	}
+
+	for _, message := range invalid {
+		_, _, _, err := parseForwardMessage(message)
+		assert.Error(t, err, "message: %v", message)
+	}
+}
+
+func Test_TagRouter(t *testing.T) {
+	rules := []common.FluentTagRule{
+		{Match: "kube.**", IndexName: "kubernetes"},
+		{Match: "app.*.access", IndexName: "access"},
+		{Match: "{nginx,apache}.*", IndexName: "web"},
+		{Match: "**.error", IndexName: "errors"},
+	}
+	router, err := newTagRouter(rules, "fluent")
+	assert.NoError(t, err)
+
+	expected := map[string]string{
+		"kube":               "kubernetes",
+		"kube.pod.container": "kubernetes",
+		"kubelet":            "fluent",
+		"app.web.access":     "access",
+		"app.web.v2.access":  "fluent",
+		"nginx.access":       "web",
+		"apache.error":       "web",
+		"mysql.error":        "errors",
+		"mysql":              "fluent",
+	}
+	for tag, indexName := range expected {
+		assert.Equal(t, indexName, router.getIndexName(tag), "tag: %v", tag)
+		// A second lookup is served from the cache.
+		assert.Equal(t, indexName, router.getIndexName(tag), "tag: %v", tag)
+	}
+
+	for i := 0; i < maxCachedTags+10; i++ {
+		router.getIndexName(fmt.Sprintf("tag%v", i))
+	}
+	assert.LessOrEqual(t, len(router.cache), maxCachedTags)
+	assert.Equal(t, "kubernetes", router.getIndexName("kube.pod"))
+
+	_, err = newTagRouter([]common.FluentTagRule{{Match: "{a,b", IndexName: "x"}}, "fluent")
+	assert.Error(t, err)
+}
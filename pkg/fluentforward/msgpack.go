@@ -0,0 +1,412 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fluentforward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Fluentd's EventTime is a MessagePack extension with this type holding the
+// seconds and nanoseconds as big-endian uint32s.
+const eventTimeExtType = 0
+
+// Arrays and maps nested deeper than this are rejected, since each level of
+// nesting is a level of recursion and takes only a byte to encode.
+const maxMsgpackDepth = 100
+
+var errSizeLimitExceeded = errors.New("message is larger than the size limit")
+
+// A MessagePack extension value other than EventTime.
+type msgpackExt struct {
+	extType int8
+	data    []byte
+}
+
+// Decodes MessagePack values from a stream. Strings and binaries become
+// string and []byte, integers become int64 or uint64, floats become float64,
+// arrays become []interface{} and maps become map[string]interface{}, with
+// non-string keys formatted as strings. EventTime becomes time.Time.
+type msgpackDecoder struct {
+	reader *bufio.Reader
+
+	// Number of bytes the current value may still use, so that a bad length
+	// can't make us allocate an arbitrary amount of memory.
+	remaining int
+	depth     int
+}
+
+func newMsgpackDecoder(reader *bufio.Reader) *msgpackDecoder {
+	return &msgpackDecoder{reader: reader}
+}
+
+// Decodes the next value, which may be at most maxSize bytes. Returns io.EOF
+// if the stream ends before the value starts.
+func (d *msgpackDecoder) decode(maxSize int) (interface{}, error) {
+	_, err := d.reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	d.remaining = maxSize
+	d.depth = 0
+	value, err := d.decodeValue()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return value, err
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if d.remaining < 1 {
+		return 0, errSizeLimitExceeded
+	}
+	d.remaining--
+
+	return d.reader.ReadByte()
+}
+
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > d.remaining {
+		return nil, errSizeLimitExceeded
+	}
+	d.remaining -= n
+
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.reader, buf)
+	return buf, err
+}
+
+func (d *msgpackDecoder) readUint(numBytes int) (uint64, error) {
+	buf, err := d.readBytes(numBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	switch numBytes {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	default:
+		return binary.BigEndian.Uint64(buf), nil
+	}
+}
+
+func (d *msgpackDecoder) readLength(numBytes int) (int, error) {
+	length, err := d.readUint(numBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every element takes at least a byte, so no valid length can be more
+	// than the bytes remaining.
+	if length > uint64(d.remaining) {
+		return 0, errSizeLimitExceeded
+	}
+
+	return int(length), nil
+}
+
+func (d *msgpackDecoder) decodeValue() (interface{}, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b >= 0x80 && b <= 0x8f:
+		return d.decodeMap(int(b & 0x0f))
+	case b >= 0x90 && b <= 0x9f:
+		return d.decodeArray(int(b & 0x0f))
+	case b >= 0xa0 && b <= 0xbf:
+		return d.decodeString(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		length, err := d.readLength(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(length)
+	case 0xc7, 0xc8, 0xc9:
+		length, err := d.readLength(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(length)
+	case 0xca:
+		bits, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := d.readUint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		numBytes := 1 << (b - 0xd0)
+		value, err := d.readUint(numBytes)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend from the encoded width.
+		shift := 64 - 8*numBytes
+		return int64(value<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.readLength(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(length)
+	case 0xdc, 0xdd:
+		length, err := d.readLength(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(length)
+	case 0xde, 0xdf:
+		length, err := d.readLength(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(length)
+	default:
+		return nil, fmt.Errorf("msgpackDecoder.decodeValue: invalid type byte 0x%x", b)
+	}
+}
+
+func (d *msgpackDecoder) decodeString(length int) (string, error) {
+	buf, err := d.readBytes(length)
+	return string(buf), err
+}
+
+func (d *msgpackDecoder) enter() error {
+	if d.depth >= maxMsgpackDepth {
+		return fmt.Errorf("msgpackDecoder.enter: values are nested more than %v deep", maxMsgpackDepth)
+	}
+
+	d.depth++
+	return nil
+}
+
+func (d *msgpackDecoder) exit() {
+	d.depth--
+}
+
+func (d *msgpackDecoder) decodeArray(length int) ([]interface{}, error) {
+	if length > d.remaining {
+		return nil, errSizeLimitExceeded
+	}
+
+	err := d.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer d.exit()
+
+	array := make([]interface{}, length)
+	for i := range array {
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		array[i] = value
+	}
+
+	return array, nil
+}
+
+func (d *msgpackDecoder) decodeMap(length int) (map[string]interface{}, error) {
+	if 2*length > d.remaining {
+		return nil, errSizeLimitExceeded
+	}
+
+	err := d.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer d.exit()
+
+	result := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		result[toString(key)] = value
+	}
+
+	return result, nil
+}
+
+func (d *msgpackDecoder) decodeExt(length int) (interface{}, error) {
+	extType, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.readBytes(length)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(extType) == eventTimeExtType && length == 8 {
+		seconds := binary.BigEndian.Uint32(data[:4])
+		nanos := binary.BigEndian.Uint32(data[4:])
+		return time.Unix(int64(seconds), int64(nanos)), nil
+	}
+
+	return msgpackExt{extType: int8(extType), data: data}, nil
+}
+
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Appends the MessagePack encoding of the value. Supports the types the
+// decoder produces, plus int and uint.
+func appendMsgpack(buf []byte, value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if value {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case int:
+		return appendMsgpackInt(buf, int64(value)), nil
+	case int64:
+		return appendMsgpackInt(buf, value), nil
+	case uint:
+		return appendMsgpackUint(buf, uint64(value)), nil
+	case uint64:
+		return appendMsgpackUint(buf, value), nil
+	case float64:
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(value)), nil
+	case string:
+		return appendMsgpackString(buf, value), nil
+	case []byte:
+		buf = appendMsgpackHeader(buf, len(value), 0, 0, 0xc4, 0xc5, 0xc6)
+		return append(buf, value...), nil
+	case time.Time:
+		buf = append(buf, 0xd7, eventTimeExtType)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(value.Unix()))
+		return binary.BigEndian.AppendUint32(buf, uint32(value.Nanosecond())), nil
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, len(value), 0x90, 16, 0, 0xdc, 0xdd)
+		var err error
+		for _, element := range value {
+			buf, err = appendMsgpack(buf, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendMsgpackHeader(buf, len(value), 0x80, 16, 0, 0xde, 0xdf)
+		var err error
+		for key, element := range value {
+			buf = appendMsgpackString(buf, key)
+			buf, err = appendMsgpack(buf, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("appendMsgpack: unsupported type %T", value)
+	}
+}
+
+func appendMsgpackInt(buf []byte, value int64) []byte {
+	if value >= 0 {
+		return appendMsgpackUint(buf, uint64(value))
+	}
+	if value >= -32 {
+		return append(buf, byte(value))
+	}
+
+	buf = append(buf, 0xd3)
+	return binary.BigEndian.AppendUint64(buf, uint64(value))
+}
+
+func appendMsgpackUint(buf []byte, value uint64) []byte {
+	if value <= 0x7f {
+		return append(buf, byte(value))
+	}
+
+	buf = append(buf, 0xcf)
+	return binary.BigEndian.AppendUint64(buf, value)
+}
+
+func appendMsgpackString(buf []byte, value string) []byte {
+	buf = appendMsgpackHeader(buf, len(value), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	return append(buf, value...)
+}
+
+// Appends the header for a value of the given length. Lengths below fixLimit
+// are encoded in the fixType byte; otherwise the smallest of the 8, 16 and
+// 32-bit length types is used. A type of 0 means that width isn't available.
+func appendMsgpackHeader(buf []byte, length int, fixType byte, fixLimit int, type8 byte, type16 byte, type32 byte) []byte {
+	switch {
+	case length < fixLimit:
+		return append(buf, fixType|byte(length))
+	case type8 != 0 && length <= math.MaxUint8:
+		return append(buf, type8, byte(length))
+	case length <= math.MaxUint16:
+		buf = append(buf, type16)
+		return binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf = append(buf, type32)
+		return binary.BigEndian.AppendUint32(buf, uint32(length))
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fluentforward
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/config/common"
+	"github.com/siglens/siglens/pkg/es/writer"
+	"github.com/siglens/siglens/pkg/usageStats"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Messages larger than this are rejected so a bad length can't make us buffer
+// an arbitrary amount of data. This also limits the size of decompressed
+// CompressedPackedForward entries.
+const maxMessageSize = 64 * 1024 * 1024
+
+// Holds the per-connection state needed to write events to an index.
+type ingester struct {
+	router                  *tagRouter
+	orgId                   uint64
+	localIndexMap           map[string]string
+	idxToStreamIdCache      map[string]string
+	cnameCacheByteHashToStr map[uint64]string
+	jsParsingStackbuf       [utils.UnescapeStackBufSize]byte
+}
+
+func newIngester(router *tagRouter, orgId uint64) *ingester {
+	return &ingester{
+		router:                  router,
+		orgId:                   orgId,
+		localIndexMap:           make(map[string]string),
+		idxToStreamIdCache:      make(map[string]string),
+		cnameCacheByteHashToStr: make(map[uint64]string),
+	}
+}
+
+// Listens on the address and ingests Forward protocol messages until the
+// listener fails. Records go to the index of the first rule matching their
+// tag, or to indexName if no rule matches. Returns an error if the address
+// can't be listened on or a rule is invalid.
+func RunServer(addr string, indexName string, rules []common.FluentTagRule) error {
+	router, err := newTagRouter(rules, indexName)
+	if err != nil {
+		return fmt.Errorf("RunServer: failed to create tag router; err=%v", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("RunServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return serve(listener, router)
+}
+
+func serve(listener net.Listener, router *tagRouter) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Errorf("serve: failed to accept connection; err=%v", err)
+			continue
+		}
+
+		go handleConnection(conn, router)
+	}
+}
+
+func handleConnection(conn net.Conn, router *tagRouter) {
+	defer conn.Close()
+
+	decoder := newMsgpackDecoder(bufio.NewReader(conn))
+	ingester := newIngester(router, 0)
+	for {
+		message, err := decoder.decode(maxMessageSize)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Errorf("handleConnection: closing connection from %v; failed to decode message; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+
+		tag, entries, chunk, err := parseForwardMessage(message)
+		if err != nil {
+			log.Errorf("handleConnection: closing connection from %v; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+
+		err = ingester.ingest(tag, entries)
+		if err != nil {
+			// Don't ack so the client retries the chunk.
+			log.Errorf("handleConnection: failed to ingest %v entries with tag %v; err=%v", len(entries), tag, err)
+			continue
+		}
+
+		if chunk != "" {
+			ack, err := appendMsgpack(nil, map[string]interface{}{"ack": chunk})
+			if err != nil {
+				log.Errorf("handleConnection: failed to encode ack; err=%v", err)
+				return
+			}
+
+			_, err = conn.Write(ack)
+			if err != nil {
+				log.Errorf("handleConnection: closing connection from %v; failed to write ack; err=%v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+func (i *ingester) ingest(tag string, entries []forwardEntry) error {
+	indexName := i.router.getIndexName(tag)
+	for _, entry := range entries {
+		jsonData, err := entryToJson(tag, entry)
+		if err != nil {
+			return fmt.Errorf("ingester.ingest: failed to convert record to JSON; err=%v", err)
+		}
+
+		tsNow := uint64(entry.time.UnixMilli())
+		err = writer.ProcessIndexRequest(jsonData, tsNow, indexName, uint64(len(jsonData)), false,
+			i.localIndexMap, i.orgId, 0, i.idxToStreamIdCache, i.cnameCacheByteHashToStr, i.jsParsingStackbuf[:])
+		if err != nil {
+			return fmt.Errorf("ingester.ingest: failed to process ingest request; err=%v", err)
+		}
+
+		usageStats.UpdateStats(uint64(len(jsonData)), 1, i.orgId)
+	}
+
+	return nil
+}
+
+// The event time becomes the timestamp, and the tag is added as a field
+// unless the record already has one.
+func entryToJson(tag string, entry forwardEntry) ([]byte, error) {
+	result := make(map[string]interface{}, len(entry.record)+2)
+	for key, value := range entry.record {
+		result[key] = toJsonValue(value)
+	}
+
+	result[config.GetTimeStampKey()] = entry.time.UnixMilli()
+	if _, ok := result["tag"]; !ok {
+		result["tag"] = tag
+	}
+
+	return json.Marshal(result)
+}
+
+// Converts decoded MessagePack values that JSON would otherwise encode badly.
+func toJsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []byte:
+		return string(value)
+	case msgpackExt:
+		return nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, element := range value {
+			result[i] = toJsonValue(element)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			result[key] = toJsonValue(element)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fluentforward
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/config/common"
+	"github.com/siglens/siglens/pkg/segment/memory/limit"
+	vtable "github.com/siglens/siglens/pkg/virtualtable"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EntryToJson(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	entry := forwardEntry{
+		time: time.UnixMilli(1_700_000_000_123),
+		record: map[string]interface{}{
+			"log":    []byte("hello"),
+			"nested": map[string]interface{}{"ext": msgpackExt{extType: 5}},
+		},
+	}
+	jsonData, err := entryToJson("app.web", entry)
+	assert.NoError(t, err)
+
+	var result map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]interface{}{
+		config.GetTimeStampKey(): float64(1_700_000_000_123),
+		"log":                    "hello",
+		"nested":                 map[string]interface{}{"ext": nil},
+		"tag":                    "app.web",
+	}, result)
+
+	// A tag field in the record is kept.
+	entry.record["tag"] = "mine"
+	jsonData, err = entryToJson("app.web", entry)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(jsonData, &result))
+	assert.Equal(t, "mine", result["tag"])
+}
+
+func Test_HandleConnection_Ack(t *testing.T) {
+	config.InitializeDefaultConfig(t.TempDir())
+	_ = vtable.InitVTable()
+	limit.InitMemoryLimiter()
+
+	router, err := newTagRouter([]common.FluentTagRule{{Match: "app.**", IndexName: "test-fluent-app"}}, "test-fluent")
+	assert.NoError(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go handleConnection(server, router)
+
+	record := map[string]interface{}{"log": "hello"}
+	message := []interface{}{"app.web", []interface{}{[]interface{}{time.Now(), record}}, map[string]interface{}{"chunk": "chunk-1"}}
+	go func() {
+		_, _ = client.Write(encode(t, message))
+	}()
+
+	decoder := newMsgpackDecoder(bufio.NewReader(client))
+	ack, err := decoder.decode(1024)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ack": "chunk-1"}, ack)
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+)
+
+const defaultLanguage = "en"
+
+// A GeoIP City database in the MaxMind DB format, like GeoLite2-City.mmdb.
+type Database struct {
+	reader  *mmdbReader
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// Where an IP address is located. Names that the database doesn't have are
+// left empty.
+type Location struct {
+	City           string
+	Region         string
+	Country        string
+	CountryISOCode string
+	Continent      string
+	Timezone       string
+	MetroCode      uint64
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+}
+
+var cachedDatabase *Database
+var cachedDatabaseLock sync.Mutex
+
+// Returns the database at the configured path. The file is reread whenever it
+// changes, so the database can be updated without restarting.
+func GetDatabase() (*Database, error) {
+	path := config.GetGeoIPDatabasePath()
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("GetDatabase: cannot read GeoIP database %v; err=%v", path, err)
+	}
+
+	cachedDatabaseLock.Lock()
+	defer cachedDatabaseLock.Unlock()
+
+	if cachedDatabase != nil && cachedDatabase.path == path &&
+		cachedDatabase.modTime.Equal(fileInfo.ModTime()) && cachedDatabase.size == fileInfo.Size() {
+		return cachedDatabase, nil
+	}
+
+	database, err := Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("GetDatabase: %v", err)
+	}
+	database.modTime = fileInfo.ModTime()
+	database.size = fileInfo.Size()
+	cachedDatabase = database
+
+	return database, nil
+}
+
+func Open(path string) (*Database, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: cannot read %v; err=%v", path, err)
+	}
+
+	reader, err := newMMDBReader(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("Open: invalid GeoIP database %v; err=%v", path, err)
+	}
+
+	return &Database{reader: reader, path: path}, nil
+}
+
+// Returns nil if the database has no location for the IP, or if ipStr isn't
+// an IP address. Names are in the given language when the database has them,
+// and in English otherwise.
+func (db *Database) Lookup(ipStr string, language string) (*Location, error) {
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return nil, nil
+	}
+
+	value, err := db.reader.lookup(ip)
+	if err != nil {
+		return nil, fmt.Errorf("Database.Lookup: failed to look up %v; err=%v", ipStr, err)
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	location := &Location{
+		City:           getName(record["city"], language),
+		Country:        getName(record["country"], language),
+		CountryISOCode: getString(record["country"], "iso_code"),
+		Continent:      getName(record["continent"], language),
+	}
+
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		location.Region = getName(subdivisions[0], language)
+	}
+
+	if locationRecord, ok := record["location"].(map[string]any); ok {
+		location.Timezone = getString(locationRecord, "time_zone")
+		location.MetroCode, _ = locationRecord["metro_code"].(uint64)
+
+		latitude, hasLatitude := locationRecord["latitude"].(float64)
+		longitude, hasLongitude := locationRecord["longitude"].(float64)
+		if hasLatitude && hasLongitude {
+			location.Latitude = latitude
+			location.Longitude = longitude
+			location.HasCoordinates = true
+		}
+	}
+
+	return location, nil
+}
+
+// Returns the name from a record like {"names": {"en": "Paris", "fr": "Paris"}}.
+func getName(value any, language string) string {
+	record, ok := value.(map[string]any)
+	if !ok {
+		return ""
+	}
+	names, ok := record["names"].(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	if name, ok := names[language].(string); ok {
+		return name
+	}
+	name, _ := names[defaultLanguage].(string)
+
+	return name
+}
+
+func getString(value any, key string) string {
+	record, ok := value.(map[string]any)
+	if !ok {
+		return ""
+	}
+	str, _ := record[key].(string)
+
+	return str
+}
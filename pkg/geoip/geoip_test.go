@@ -0,0 +1,228 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMockNetworks() []MockNetwork {
+	return []MockNetwork{
+		{
+			CIDR: "81.2.69.0/24",
+			Record: map[string]any{
+				"city":      map[string]any{"names": map[string]any{"en": "London", "fr": "Londres"}},
+				"continent": map[string]any{"names": map[string]any{"en": "Europe"}},
+				"country":   map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom"}},
+				"location": map[string]any{
+					"latitude":  51.5142,
+					"longitude": -0.0931,
+					"time_zone": "Europe/London",
+				},
+				"subdivisions": []any{
+					map[string]any{"names": map[string]any{"en": "England"}},
+				},
+			},
+		},
+		{
+			CIDR: "216.160.83.56/29",
+			Record: map[string]any{
+				"city":    map[string]any{"names": map[string]any{"en": "Milton"}},
+				"country": map[string]any{"iso_code": "US", "names": map[string]any{"en": "United States"}},
+				"location": map[string]any{
+					"latitude":   47.2513,
+					"longitude":  -122.3149,
+					"metro_code": uint64(819),
+				},
+			},
+		},
+		{
+			CIDR:   "10.0.0.0/8",
+			Record: map[string]any{"country": map[string]any{"iso_code": "ZZ"}},
+		},
+	}
+}
+
+func writeMockDatabase(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "mock.mmdb")
+	err := WriteMockDatabase(path, getMockNetworks())
+	assert.NoError(t, err)
+
+	return path
+}
+
+func Test_Lookup(t *testing.T) {
+	database, err := Open(writeMockDatabase(t))
+	assert.NoError(t, err)
+
+	location, err := database.Lookup("81.2.69.160", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, &Location{
+		City:           "London",
+		Region:         "England",
+		Country:        "United Kingdom",
+		CountryISOCode: "GB",
+		Continent:      "Europe",
+		Timezone:       "Europe/London",
+		Latitude:       51.5142,
+		Longitude:      -0.0931,
+		HasCoordinates: true,
+	}, location)
+
+	location, err = database.Lookup("216.160.83.60", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, "Milton", location.City)
+	assert.Equal(t, "", location.Region)
+	assert.Equal(t, uint64(819), location.MetroCode)
+
+	location, err = database.Lookup("10.1.2.3", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, &Location{CountryISOCode: "ZZ"}, location)
+}
+
+func Test_Lookup_Language(t *testing.T) {
+	database, err := Open(writeMockDatabase(t))
+	assert.NoError(t, err)
+
+	location, err := database.Lookup("81.2.69.1", "fr")
+	assert.NoError(t, err)
+	assert.Equal(t, "Londres", location.City)
+	assert.Equal(t, "United Kingdom", location.Country) // Falls back to English.
+}
+
+func Test_Lookup_NotFound(t *testing.T) {
+	database, err := Open(writeMockDatabase(t))
+	assert.NoError(t, err)
+
+	for _, ip := range []string{"216.160.83.64", "81.2.70.1", "8.8.8.8", "::1", "not an ip", ""} {
+		location, err := database.Lookup(ip, "en")
+		assert.NoError(t, err, ip)
+		assert.Nil(t, location, ip)
+	}
+}
+
+func Test_Open_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	err := os.WriteFile(path, []byte("not a database"), 0644)
+	assert.NoError(t, err)
+
+	_, err = Open(path)
+	assert.Error(t, err)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
+
+func Test_GetDatabase(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	_, err := GetDatabase()
+	assert.Error(t, err)
+
+	path := config.GetGeoIPDatabasePath()
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	assert.NoError(t, err)
+	err = WriteMockDatabase(path, getMockNetworks()[:1])
+	assert.NoError(t, err)
+
+	database, err := GetDatabase()
+	assert.NoError(t, err)
+	sameDatabase, err := GetDatabase()
+	assert.NoError(t, err)
+	assert.Same(t, database, sameDatabase)
+
+	location, err := database.Lookup("216.160.83.60", "en")
+	assert.NoError(t, err)
+	assert.Nil(t, location)
+
+	// Replacing the file should load the new version.
+	err = WriteMockDatabase(path, getMockNetworks())
+	assert.NoError(t, err)
+	err = os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	database, err = GetDatabase()
+	assert.NoError(t, err)
+	location, err = database.Lookup("216.160.83.60", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, "Milton", location.City)
+}
+
+func Test_ReadNode(t *testing.T) {
+	node := []byte{0x12, 0x34, 0x56, 0xAB, 0x78, 0x9A, 0xBC, 0xDE}
+
+	reader := &mmdbReader{buffer: node, recordSize: 24, nodeSize: 6}
+	assert.Equal(t, uint64(0x123456), reader.readNode(0, 0))
+	assert.Equal(t, uint64(0xAB789A), reader.readNode(0, 1))
+
+	reader = &mmdbReader{buffer: node, recordSize: 28, nodeSize: 7}
+	assert.Equal(t, uint64(0xA123456), reader.readNode(0, 0))
+	assert.Equal(t, uint64(0xB789ABC), reader.readNode(0, 1))
+
+	reader = &mmdbReader{buffer: node, recordSize: 32, nodeSize: 8}
+	assert.Equal(t, uint64(0x123456AB), reader.readNode(0, 0))
+	assert.Equal(t, uint64(0x789ABCDE), reader.readNode(0, 1))
+}
+
+func Test_DecodePointer(t *testing.T) {
+	decoder := &mmdbDecoder{buffer: []byte{
+		0x43, 'a', 'b', 'c', // The string "abc".
+		0x20, 0x00, // A pointer to offset 0.
+		0xE1, 0x20, 0x00, 0x20, 0x00, // A map from "abc" to "abc", using pointers.
+	}}
+
+	value, offset, err := decoder.decode(4)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", value)
+	assert.Equal(t, uint64(6), offset)
+
+	value, offset, err = decoder.decode(6)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"abc": "abc"}, value)
+	assert.Equal(t, uint64(11), offset)
+
+	_, _, err = decoder.decode(11)
+	assert.Error(t, err)
+}
+
+func Test_Decode_Corrupt(t *testing.T) {
+	// A pointer to itself.
+	decoder := &mmdbDecoder{buffer: []byte{0x20, 0x00}}
+	_, _, err := decoder.decode(0)
+	assert.Error(t, err)
+
+	// An array that claims 65821 + 0xFFFFFF entries but has none.
+	decoder = &mmdbDecoder{buffer: []byte{0x1F, 0x04, 0xFF, 0xFF, 0xFF}}
+	_, _, err = decoder.decode(0)
+	assert.Error(t, err)
+
+	// Arrays nested deeper than any real database would nest them.
+	nested := make([]byte, 0, 2*(maxDecodeDepth+2))
+	for i := 0; i < maxDecodeDepth+2; i++ {
+		nested = append(nested, 0x01, 0x04) // An array with one entry.
+	}
+	decoder = &mmdbDecoder{buffer: nested}
+	_, _, err = decoder.decode(0)
+	assert.Error(t, err)
+}
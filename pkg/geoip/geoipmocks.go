@@ -0,0 +1,196 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+)
+
+// A network and the record a mock database returns for IPs in it.
+type MockNetwork struct {
+	CIDR   string
+	Record map[string]any
+}
+
+// Writes an IPv4 MaxMind DB file with 24-bit records. The networks must not
+// overlap. Record values can be strings, float64, uint64, bool, []any, or
+// map[string]any. Should only be called by tests.
+func WriteMockDatabase(path string, networks []MockNetwork) error {
+	const recordSize = 24
+	const emptyRecord = -1
+
+	// Each node has a left and right record. A record is a node index, a
+	// data index encoded as -(dataIdx + 2), or emptyRecord.
+	nodes := [][2]int{{emptyRecord, emptyRecord}}
+	data := &bytes.Buffer{}
+	dataOffsets := make([]int, 0, len(networks))
+
+	for dataIdx, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.CIDR)
+		if err != nil {
+			return fmt.Errorf("WriteMockDatabase: invalid CIDR %v; err=%v", network.CIDR, err)
+		}
+		address := ipNet.IP.To4()
+		if address == nil {
+			return fmt.Errorf("WriteMockDatabase: only IPv4 networks are supported; got %v", network.CIDR)
+		}
+		prefixLen, _ := ipNet.Mask.Size()
+		if prefixLen == 0 {
+			return fmt.Errorf("WriteMockDatabase: prefix length must be positive; got %v", network.CIDR)
+		}
+
+		dataOffsets = append(dataOffsets, data.Len())
+		err = encodeMockValue(data, network.Record)
+		if err != nil {
+			return fmt.Errorf("WriteMockDatabase: failed to encode record for %v; err=%v", network.CIDR, err)
+		}
+
+		node := 0
+		for i := 0; i < prefixLen; i++ {
+			bit := (address[i/8] >> (7 - uint(i%8))) & 1
+			if i == prefixLen-1 {
+				nodes[node][bit] = -(dataIdx + 2)
+				break
+			}
+
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{emptyRecord, emptyRecord})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	file := &bytes.Buffer{}
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		for _, record := range node {
+			value := nodeCount
+			if record >= 0 {
+				value = record
+			} else if record != emptyRecord {
+				value = nodeCount + dataSectionSeparatorSize + dataOffsets[-record-2]
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, dataSectionSeparatorSize))
+	file.Write(data.Bytes())
+
+	file.Write(metadataStartMarker)
+	err := encodeMockValue(file, map[string]any{
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"database_type":               "Mock-City",
+		"ip_version":                  uint64(4),
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(recordSize),
+	})
+	if err != nil {
+		return fmt.Errorf("WriteMockDatabase: failed to encode metadata; err=%v", err)
+	}
+
+	return os.WriteFile(path, file.Bytes(), 0644)
+}
+
+func encodeMockValue(buf *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case string:
+		writeMockControl(buf, mmdbTypeString, len(value))
+		buf.WriteString(value)
+	case float64:
+		writeMockControl(buf, mmdbTypeDouble, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(value))
+	case uint64:
+		valueBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(valueBytes, value)
+		valueBytes = bytes.TrimLeft(valueBytes, "\x00")
+		writeMockControl(buf, mmdbTypeUint64, len(valueBytes))
+		buf.Write(valueBytes)
+	case bool:
+		size := 0
+		if value {
+			size = 1
+		}
+		writeMockControl(buf, mmdbTypeBool, size)
+	case []any:
+		writeMockControl(buf, mmdbTypeArray, len(value))
+		for _, element := range value {
+			err := encodeMockValue(buf, element)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMockControl(buf, mmdbTypeMap, len(value))
+		for _, key := range keys {
+			err := encodeMockValue(buf, key)
+			if err != nil {
+				return err
+			}
+			err = encodeMockValue(buf, value[key])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("encodeMockValue: unsupported type %T", value)
+	}
+
+	return nil
+}
+
+func writeMockControl(buf *bytes.Buffer, typeNum int, size int) {
+	ctrlByte := byte(typeNum << 5)
+	if typeNum > 7 {
+		ctrlByte = 0
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		ctrlByte |= byte(size)
+	case size < 285:
+		ctrlByte |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrlByte |= 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		ctrlByte |= 31
+		sizeBytes = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+	}
+
+	buf.WriteByte(ctrlByte)
+	if typeNum > 7 {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(sizeBytes)
+}
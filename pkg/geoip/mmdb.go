@@ -0,0 +1,398 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+)
+
+// The metadata section of a MaxMind DB file starts after the last occurrence
+// of this marker. See https://maxmind.github.io/MaxMind-DB/
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// The search tree and the data section are separated by 16 zero bytes.
+const dataSectionSeparatorSize = 16
+
+// Bounds how deeply maps, arrays, and pointers can nest, so a corrupt file
+// with a pointer cycle or absurd nesting fails instead of overflowing the
+// stack. Real databases nest only a few levels.
+const maxDecodeDepth = 512
+
+// Data field types of the MaxMind DB format.
+const (
+	mmdbTypeExtended = iota
+	mmdbTypePointer
+	mmdbTypeString
+	mmdbTypeDouble
+	mmdbTypeBytes
+	mmdbTypeUint16
+	mmdbTypeUint32
+	mmdbTypeMap
+	mmdbTypeInt32
+	mmdbTypeUint64
+	mmdbTypeUint128
+	mmdbTypeArray
+	mmdbTypeContainer
+	mmdbTypeEndMarker
+	mmdbTypeBool
+	mmdbTypeFloat32
+)
+
+// Reads a MaxMind DB file that's fully loaded into memory.
+type mmdbReader struct {
+	buffer     []byte
+	nodeCount  uint64
+	recordSize uint64 // In bits; 24, 28, or 32.
+	nodeSize   uint64 // In bytes.
+	ipVersion  uint64
+	ipv4Start  uint64 // The node for ::0.0.0.0/96 in an IPv6 tree.
+	data       mmdbDecoder
+}
+
+// Decodes values from the data section. Maps are decoded into
+// map[string]any, arrays into []any, and unsigned integers into uint64, or
+// *big.Int for uint128.
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	metadataStart := bytes.LastIndex(buffer, metadataStartMarker)
+	if metadataStart == -1 {
+		return nil, fmt.Errorf("newMMDBReader: metadata marker not found; not a MaxMind DB file")
+	}
+
+	metadataDecoder := mmdbDecoder{buffer: buffer[metadataStart+len(metadataStartMarker):]}
+	metadataValue, _, err := metadataDecoder.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("newMMDBReader: failed to decode metadata; err=%v", err)
+	}
+	metadata, ok := metadataValue.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("newMMDBReader: metadata is %T, not a map", metadataValue)
+	}
+
+	reader := &mmdbReader{buffer: buffer}
+	for key, dest := range map[string]*uint64{
+		"node_count":  &reader.nodeCount,
+		"record_size": &reader.recordSize,
+		"ip_version":  &reader.ipVersion,
+	} {
+		value, ok := metadata[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("newMMDBReader: metadata has invalid %v: %v", key, metadata[key])
+		}
+		*dest = value
+	}
+
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("newMMDBReader: unsupported record size %v", reader.recordSize)
+	}
+	if reader.ipVersion != 4 && reader.ipVersion != 6 {
+		return nil, fmt.Errorf("newMMDBReader: unsupported ip version %v", reader.ipVersion)
+	}
+
+	reader.nodeSize = reader.recordSize / 4
+	if reader.nodeCount > uint64(metadataStart)/reader.nodeSize {
+		return nil, fmt.Errorf("newMMDBReader: search tree of %v nodes does not fit in the file", reader.nodeCount)
+	}
+	treeSize := reader.nodeCount * reader.nodeSize
+	if treeSize+dataSectionSeparatorSize > uint64(metadataStart) {
+		return nil, fmt.Errorf("newMMDBReader: search tree of %v nodes does not fit in the file", reader.nodeCount)
+	}
+	reader.data = mmdbDecoder{buffer: buffer[treeSize+dataSectionSeparatorSize : metadataStart]}
+
+	if reader.ipVersion == 6 {
+		node := uint64(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.readNode(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+
+	return reader, nil
+}
+
+// Returns the data record for the network containing the IP, or nil if the
+// database has no record for it.
+func (r *mmdbReader) lookup(ip net.IP) (any, error) {
+	node := uint64(0)
+	address := ip.To4()
+	if address != nil {
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		address = ip.To16()
+		if address == nil {
+			return nil, fmt.Errorf("mmdbReader.lookup: invalid IP %v", ip)
+		}
+	}
+
+	numBits := len(address) * 8
+	for i := 0; i < numBits && node < r.nodeCount; i++ {
+		bit := (address[i/8] >> (7 - uint(i%8))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("mmdbReader.lookup: search tree is deeper than the address length")
+	}
+	if node < r.nodeCount+dataSectionSeparatorSize {
+		return nil, fmt.Errorf("mmdbReader.lookup: record %v points into the data section separator", node)
+	}
+
+	offset := node - r.nodeCount - dataSectionSeparatorSize
+	value, _, err := r.data.decode(offset)
+	if err != nil {
+		return nil, fmt.Errorf("mmdbReader.lookup: failed to decode record at %v; err=%v", offset, err)
+	}
+
+	return value, nil
+}
+
+// Returns the left record of the node if bit is 0, and the right otherwise.
+func (r *mmdbReader) readNode(node uint64, bit byte) uint64 {
+	b := r.buffer[node*r.nodeSize : (node+1)*r.nodeSize]
+
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+	case 28:
+		if bit == 0 {
+			return uint64(b[3]&0xF0)<<20 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3]&0x0F)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+	default:
+		if bit == 0 {
+			return uint64(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint64(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// Returns the value at the offset and the offset just past it.
+func (d *mmdbDecoder) decode(offset uint64) (any, uint64, error) {
+	return d.decodeAtDepth(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeAtDepth(offset uint64, depth int) (any, uint64, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("mmdbDecoder.decode: value at %v is nested more than %v levels deep", offset, maxDecodeDepth)
+	}
+	if offset >= uint64(len(d.buffer)) {
+		return nil, 0, fmt.Errorf("mmdbDecoder.decode: offset %v is past the end of the data", offset)
+	}
+
+	ctrlByte := d.buffer[offset]
+	offset++
+
+	typeNum := int(ctrlByte >> 5)
+	if typeNum == mmdbTypePointer {
+		pointer, nextOffset, err := d.decodePointer(ctrlByte, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		value, _, err := d.decodeAtDepth(pointer, depth+1)
+		return value, nextOffset, err
+	}
+
+	if typeNum == mmdbTypeExtended {
+		if offset >= uint64(len(d.buffer)) {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decode: missing extended type at %v", offset)
+		}
+		typeNum = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	size, offset, err := d.decodeSize(ctrlByte, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return d.decodeFromType(typeNum, size, offset, depth)
+}
+
+func (d *mmdbDecoder) decodePointer(ctrlByte byte, offset uint64) (uint64, uint64, error) {
+	pointerSize := uint64((ctrlByte>>3)&0x3) + 1
+	if offset+pointerSize > uint64(len(d.buffer)) {
+		return 0, 0, fmt.Errorf("mmdbDecoder.decodePointer: pointer at %v is past the end of the data", offset)
+	}
+
+	pointer := uint64(ctrlByte & 0x7)
+	if pointerSize == 4 {
+		pointer = 0
+	}
+	for _, b := range d.buffer[offset : offset+pointerSize] {
+		pointer = pointer<<8 | uint64(b)
+	}
+
+	switch pointerSize {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+
+	return pointer, offset + pointerSize, nil
+}
+
+func (d *mmdbDecoder) decodeSize(ctrlByte byte, offset uint64) (uint64, uint64, error) {
+	size := uint64(ctrlByte & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	numBytes := size - 28
+	if offset+numBytes > uint64(len(d.buffer)) {
+		return 0, 0, fmt.Errorf("mmdbDecoder.decodeSize: size at %v is past the end of the data", offset)
+	}
+
+	extra := uint64(0)
+	for _, b := range d.buffer[offset : offset+numBytes] {
+		extra = extra<<8 | uint64(b)
+	}
+
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+
+	return size, offset + numBytes, nil
+}
+
+func (d *mmdbDecoder) decodeFromType(typeNum int, size uint64, offset uint64, depth int) (any, uint64, error) {
+	switch typeNum {
+	case mmdbTypeMap, mmdbTypeArray:
+		// Every entry takes at least one byte, so a larger size can only come
+		// from a corrupt file; checking it keeps us from allocating for it.
+		if size > uint64(len(d.buffer))-offset {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: container of size %v at %v is larger than the data", size, offset)
+		}
+	}
+
+	switch typeNum {
+	case mmdbTypeMap:
+		result := make(map[string]any, size)
+		for i := uint64(0); i < size; i++ {
+			key, nextOffset, err := d.decodeAtDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: map key at %v is %T, not a string", offset, key)
+			}
+
+			value, nextOffset, err := d.decodeAtDepth(nextOffset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			result[keyStr] = value
+			offset = nextOffset
+		}
+		return result, offset, nil
+	case mmdbTypeArray:
+		result := make([]any, 0, size)
+		for i := uint64(0); i < size; i++ {
+			value, nextOffset, err := d.decodeAtDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			result = append(result, value)
+			offset = nextOffset
+		}
+		return result, offset, nil
+	case mmdbTypeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid bool size %v", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	if offset+size > uint64(len(d.buffer)) {
+		return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: value of size %v at %v is past the end of the data", size, offset)
+	}
+	valueBytes := d.buffer[offset : offset+size]
+	nextOffset := offset + size
+
+	switch typeNum {
+	case mmdbTypeString:
+		return string(valueBytes), nextOffset, nil
+	case mmdbTypeBytes:
+		result := make([]byte, size)
+		copy(result, valueBytes)
+		return result, nextOffset, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid double size %v", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(valueBytes)), nextOffset, nil
+	case mmdbTypeFloat32:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid float size %v", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(valueBytes)), nextOffset, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid uint size %v", size)
+		}
+		result := uint64(0)
+		for _, b := range valueBytes {
+			result = result<<8 | uint64(b)
+		}
+		return result, nextOffset, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid int32 size %v", size)
+		}
+		result := uint32(0)
+		for _, b := range valueBytes {
+			result = result<<8 | uint32(b)
+		}
+		return int32(result), nextOffset, nil
+	case mmdbTypeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: invalid uint128 size %v", size)
+		}
+		return new(big.Int).SetBytes(valueBytes), nextOffset, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdbDecoder.decodeFromType: unsupported type %v", typeNum)
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Pickle opcodes needed to decode lists and tuples of strings and numbers,
+// which is all carbon clients send. Opcodes that build arbitrary objects, like
+// GLOBAL and REDUCE, are deliberately unsupported.
+const (
+	opMark           = '('
+	opStop           = '.'
+	opFloat          = 'F'
+	opInt            = 'I'
+	opBinInt         = 'J'
+	opBinInt1        = 'K'
+	opLong           = 'L'
+	opBinInt2        = 'M'
+	opNone           = 'N'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opUnicode        = 'V'
+	opBinUnicode     = 'X'
+	opAppend         = 'a'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opLongBinGet     = 'j'
+	opList           = 'l'
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opTuple          = 't'
+	opAppends        = 'e'
+	opBinFloat       = 'G'
+	opEmptyList      = ']'
+	opEmptyTuple     = ')'
+	opBinBytes       = 'B'
+	opShortBinBytes  = 'C'
+	opProto          = 0x80
+	opTuple1         = 0x85
+	opTuple2         = 0x86
+	opTuple3         = 0x87
+	opNewTrue        = 0x88
+	opNewFalse       = 0x89
+	opLong1          = 0x8a
+	opShortBinUni    = 0x8c
+	opBinUnicode8    = 0x8d
+	opMemoize        = 0x94
+	opFrame          = 0x95
+)
+
+// Lists are mutable, so they're kept behind a pointer while decoding in case
+// they're appended to after being memoized.
+type pickleList struct {
+	items []interface{}
+}
+
+type pickleDecoder struct {
+	data  []byte
+	pos   int
+	stack []interface{}
+	marks []int
+	memo  map[int]interface{}
+}
+
+// Decodes a pickled value made of lists, tuples, strings, numbers, booleans
+// and None. Lists and tuples both become []interface{}, integers become
+// int64 and strings and bytes become string.
+func unpickle(data []byte) (interface{}, error) {
+	d := &pickleDecoder{data: data, memo: make(map[int]interface{})}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("unpickle: data ended without a STOP opcode")
+		}
+
+		op := d.data[d.pos]
+		d.pos++
+		if op == opStop {
+			value, err := d.pop()
+			if err != nil {
+				return nil, err
+			}
+			return newPickleFinisher(len(d.data)).finish(value)
+		}
+
+		err := d.execute(op)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Values nested deeper than this are rejected rather than risking a stack
+// overflow; carbon clients never nest more than three levels.
+const maxPickleDepth = 64
+
+// Converts decoded lists into plain slices. The memo lets a pickle refer to
+// the same list more than once, or append a list to itself, so each list may
+// only be visited once. The number of values produced is capped by the
+// payload size, which stops shared tuples from expanding exponentially.
+type pickleFinisher struct {
+	seenLists map[*pickleList]struct{}
+	depth     int
+	remaining int
+}
+
+func newPickleFinisher(dataLen int) *pickleFinisher {
+	return &pickleFinisher{
+		seenLists: make(map[*pickleList]struct{}),
+		remaining: dataLen + 1,
+	}
+}
+
+func (f *pickleFinisher) finish(value interface{}) (interface{}, error) {
+	f.remaining--
+	if f.remaining < 0 {
+		return nil, fmt.Errorf("pickleFinisher.finish: pickle expands to more values than it has bytes")
+	}
+
+	switch value := value.(type) {
+	case *pickleList:
+		if _, ok := f.seenLists[value]; ok {
+			return nil, fmt.Errorf("pickleFinisher.finish: lists may not be shared or contain themselves")
+		}
+		f.seenLists[value] = struct{}{}
+		return f.finishItems(value.items)
+	case []interface{}:
+		return f.finishItems(value)
+	default:
+		return value, nil
+	}
+}
+
+func (f *pickleFinisher) finishItems(items []interface{}) (interface{}, error) {
+	if f.depth >= maxPickleDepth {
+		return nil, fmt.Errorf("pickleFinisher.finishItems: values are nested more than %v deep", maxPickleDepth)
+	}
+	f.depth++
+	defer func() { f.depth-- }()
+
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		value, err := f.finish(item)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+
+	return result, nil
+}
+
+func (d *pickleDecoder) execute(op byte) error {
+	switch op {
+	case opProto:
+		_, err := d.readN(1)
+		return err
+	case opFrame:
+		_, err := d.readN(8)
+		return err
+	case opMark:
+		d.marks = append(d.marks, len(d.stack))
+	case opNone:
+		d.push(nil)
+	case opNewTrue:
+		d.push(true)
+	case opNewFalse:
+		d.push(false)
+	case opEmptyList:
+		d.push(&pickleList{})
+	case opEmptyTuple:
+		d.push([]interface{}{})
+	case opList:
+		items, err := d.popToMark()
+		if err != nil {
+			return err
+		}
+		d.push(&pickleList{items: items})
+	case opTuple:
+		items, err := d.popToMark()
+		if err != nil {
+			return err
+		}
+		d.push(items)
+	case opTuple1, opTuple2, opTuple3:
+		size := int(op-opTuple1) + 1
+		if len(d.stack) < size {
+			return fmt.Errorf("pickleDecoder.execute: stack underflow")
+		}
+		tuple := append([]interface{}{}, d.stack[len(d.stack)-size:]...)
+		d.stack = d.stack[:len(d.stack)-size]
+		d.push(tuple)
+	case opAppend:
+		value, err := d.pop()
+		if err != nil {
+			return err
+		}
+		return d.appendToList([]interface{}{value})
+	case opAppends:
+		items, err := d.popToMark()
+		if err != nil {
+			return err
+		}
+		return d.appendToList(items)
+	case opBinInt:
+		buf, err := d.readN(4)
+		if err != nil {
+			return err
+		}
+		d.push(int64(int32(binary.LittleEndian.Uint32(buf))))
+	case opBinInt1:
+		buf, err := d.readN(1)
+		if err != nil {
+			return err
+		}
+		d.push(int64(buf[0]))
+	case opBinInt2:
+		buf, err := d.readN(2)
+		if err != nil {
+			return err
+		}
+		d.push(int64(binary.LittleEndian.Uint16(buf)))
+	case opLong1:
+		buf, err := d.readN(1)
+		if err != nil {
+			return err
+		}
+		return d.pushLong(int(buf[0]))
+	case opInt, opLong:
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		// Protocol 0 writes booleans as INT 01 and 00.
+		if op == opInt && (line == "01" || line == "00") {
+			d.push(line == "01")
+			return nil
+		}
+		value, err := strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("pickleDecoder.execute: invalid integer %q; err=%v", line, err)
+		}
+		d.push(value)
+	case opFloat:
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return fmt.Errorf("pickleDecoder.execute: invalid float %q; err=%v", line, err)
+		}
+		d.push(value)
+	case opBinFloat:
+		buf, err := d.readN(8)
+		if err != nil {
+			return err
+		}
+		d.push(math.Float64frombits(binary.BigEndian.Uint64(buf)))
+	case opShortBinString, opShortBinBytes, opShortBinUni:
+		return d.pushString(1)
+	case opBinString, opBinBytes, opBinUnicode:
+		return d.pushString(4)
+	case opBinUnicode8:
+		return d.pushString(8)
+	case opString:
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		value, err := unquotePythonString(line)
+		if err != nil {
+			return err
+		}
+		d.push(value)
+	case opUnicode:
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		d.push(line)
+	case opPut, opBinPut, opLongBinPut, opMemoize:
+		index, err := d.readMemoIndex(op)
+		if err != nil {
+			return err
+		}
+		if len(d.stack) == 0 {
+			return fmt.Errorf("pickleDecoder.execute: stack underflow")
+		}
+		d.memo[index] = d.stack[len(d.stack)-1]
+	case opGet, opBinGet, opLongBinGet:
+		index, err := d.readMemoIndex(op)
+		if err != nil {
+			return err
+		}
+		value, ok := d.memo[index]
+		if !ok {
+			return fmt.Errorf("pickleDecoder.execute: memo index %v is not set", index)
+		}
+		d.push(value)
+	default:
+		return fmt.Errorf("pickleDecoder.execute: unsupported opcode 0x%x at offset %v", op, d.pos-1)
+	}
+
+	return nil
+}
+
+func (d *pickleDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("pickleDecoder.readN: need %v bytes at offset %v but only %v remain", n, d.pos, len(d.data)-d.pos)
+	}
+
+	buf := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return buf, nil
+}
+
+func (d *pickleDecoder) readLine() (string, error) {
+	idx := bytes.IndexByte(d.data[d.pos:], '\n')
+	if idx < 0 {
+		return "", fmt.Errorf("pickleDecoder.readLine: no newline after offset %v", d.pos)
+	}
+
+	line := string(d.data[d.pos : d.pos+idx])
+	d.pos += idx + 1
+	return line, nil
+}
+
+func (d *pickleDecoder) readMemoIndex(op byte) (int, error) {
+	switch op {
+	case opMemoize:
+		return len(d.memo), nil
+	case opBinPut, opBinGet:
+		buf, err := d.readN(1)
+		if err != nil {
+			return 0, err
+		}
+		return int(buf[0]), nil
+	case opLongBinPut, opLongBinGet:
+		buf, err := d.readN(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.LittleEndian.Uint32(buf)), nil
+	default:
+		line, err := d.readLine()
+		if err != nil {
+			return 0, err
+		}
+		index, err := strconv.Atoi(line)
+		if err != nil {
+			return 0, fmt.Errorf("pickleDecoder.readMemoIndex: invalid memo index %q; err=%v", line, err)
+		}
+		return index, nil
+	}
+}
+
+// The string's length is stored little endian in lengthBytes bytes before it.
+func (d *pickleDecoder) pushString(lengthBytes int) error {
+	buf, err := d.readN(lengthBytes)
+	if err != nil {
+		return err
+	}
+
+	var length uint64
+	for i := lengthBytes - 1; i >= 0; i-- {
+		length = length<<8 | uint64(buf[i])
+	}
+	if length > uint64(len(d.data)) {
+		return fmt.Errorf("pickleDecoder.pushString: invalid length %v", length)
+	}
+
+	buf, err = d.readN(int(length))
+	if err != nil {
+		return err
+	}
+	d.push(string(buf))
+	return nil
+}
+
+// Pushes a little endian two's complement integer of n bytes.
+func (d *pickleDecoder) pushLong(n int) error {
+	if n > 8 {
+		return fmt.Errorf("pickleDecoder.pushLong: integers of %v bytes are too large", n)
+	}
+
+	buf, err := d.readN(n)
+	if err != nil {
+		return err
+	}
+
+	var value uint64
+	for i := n - 1; i >= 0; i-- {
+		value = value<<8 | uint64(buf[i])
+	}
+	if n > 0 && n < 8 && buf[n-1]&0x80 != 0 {
+		value |= math.MaxUint64 << (8 * n)
+	}
+
+	d.push(int64(value))
+	return nil
+}
+
+func (d *pickleDecoder) push(value interface{}) {
+	d.stack = append(d.stack, value)
+}
+
+func (d *pickleDecoder) pop() (interface{}, error) {
+	if len(d.stack) == 0 {
+		return nil, fmt.Errorf("pickleDecoder.pop: stack underflow")
+	}
+
+	value := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	return value, nil
+}
+
+func (d *pickleDecoder) popToMark() ([]interface{}, error) {
+	if len(d.marks) == 0 {
+		return nil, fmt.Errorf("pickleDecoder.popToMark: no mark on the stack")
+	}
+
+	mark := d.marks[len(d.marks)-1]
+	d.marks = d.marks[:len(d.marks)-1]
+	items := append([]interface{}{}, d.stack[mark:]...)
+	d.stack = d.stack[:mark]
+	return items, nil
+}
+
+func (d *pickleDecoder) appendToList(items []interface{}) error {
+	if len(d.stack) == 0 {
+		return fmt.Errorf("pickleDecoder.appendToList: stack underflow")
+	}
+
+	list, ok := d.stack[len(d.stack)-1].(*pickleList)
+	if !ok {
+		return fmt.Errorf("pickleDecoder.appendToList: expected a list but got %T", d.stack[len(d.stack)-1])
+	}
+
+	list.items = append(list.items, items...)
+	return nil
+}
+
+// Protocol 0 strings are written with Python's repr, such as 'a.b' or "it's".
+func unquotePythonString(quoted string) (string, error) {
+	if len(quoted) < 2 || (quoted[0] != '\'' && quoted[0] != '"') || quoted[len(quoted)-1] != quoted[0] {
+		return "", fmt.Errorf("unquotePythonString: invalid string %q", quoted)
+	}
+
+	var sb strings.Builder
+	body := quoted[1 : len(quoted)-1]
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i == len(body)-1 {
+			sb.WriteByte(body[i])
+			continue
+		}
+
+		i++
+		switch body[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'x':
+			if i+3 > len(body) {
+				return "", fmt.Errorf("unquotePythonString: invalid escape in %q", quoted)
+			}
+			value, err := strconv.ParseUint(body[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("unquotePythonString: invalid escape in %q; err=%v", quoted, err)
+			}
+			sb.WriteByte(byte(value))
+			i += 2
+		default:
+			sb.WriteByte(body[i])
+		}
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeHex(t *testing.T, data string) []byte {
+	decoded, err := hex.DecodeString(data)
+	assert.NoError(t, err)
+	return decoded
+}
+
+func Test_Unpickle(t *testing.T) {
+	expected := []interface{}{
+		[]interface{}{"servers.web01.cpu.load", []interface{}{int64(1_700_000_000), 1.5}},
+		[]interface{}{"servers.web02.cpu.idle", []interface{}{1_700_000_000.0, int64(98)}},
+	}
+
+	// pickle.dumps(points, protocol=p) for protocols 0, 2 and 4.
+	for _, data := range []string{
+		"286c70300a2856736572766572732e77656230312e6370752e6c6f61640a70310a2849313730303030303030300a46312e350a7470320a7470330a612856736572766572732e77656230322e6370752e69646c650a70340a2846313730303030303030302e300a4939380a7470350a7470360a612e",
+		"80025d7100285816000000736572766572732e77656230312e6370752e6c6f616471014a00f15365473ff80000000000008671028671035816000000736572766572732e77656230322e6370752e69646c6571044741d954fc400000004b62867105867106652e",
+		"80049558000000000000005d94288c16736572766572732e77656230312e6370752e6c6f6164944a00f15365473ff8000000000000869486948c16736572766572732e77656230322e6370752e69646c65944741d954fc400000004b6286948694652e",
+	} {
+		value, err := unpickle(decodeHex(t, data))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+}
+
+func Test_Unpickle_Longs(t *testing.T) {
+	// [('a.b', (2**40, -3)), ('a.c', (-2**33, True))] with protocol 2
+	value, err := unpickle(decodeHex(t, "80025d7100285803000000612e6271018a060000000000014afdffffff8671028671035803000000612e6371048a0500000000fe88867105867106652e"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		[]interface{}{"a.b", []interface{}{int64(1 << 40), int64(-3)}},
+		[]interface{}{"a.c", []interface{}{int64(-1 << 33), true}},
+	}, value)
+}
+
+func Test_Unpickle_Protocol0Strings(t *testing.T) {
+	value, err := unpickle([]byte("(lp0\n(S'it\\'s\\x41'\np1\n(I1\nL2L\ntp2\ntp3\na."))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{"it'sA", []interface{}{int64(1), int64(2)}}}, value)
+}
+
+func Test_Unpickle_Invalid(t *testing.T) {
+	for _, data := range []string{
+		// os.system('ls') must never be called.
+		"cos\nsystem\n(S'ls'\ntR.",
+		"",
+		"]",
+		"a.",
+		"X\xff\xff\xff\x7fabc.",
+		"h\x05.",
+		"\x8a\x09000000000.",
+		"(S'unterminated\n.",
+		// A list appended to itself.
+		"]q\x00h\x00a.",
+		// The same list appended to another list twice.
+		"]q\x00]h\x00ah\x00a.",
+		// Tuples nested deeper than maxPickleDepth.
+		strings.Repeat("(", 100) + strings.Repeat("t", 100) + ".",
+		// A memoized tuple doubled into itself many times.
+		"(tq\x00" + strings.Repeat("h\x00h\x00\x86q\x00", 40) + ".",
+	} {
+		_, err := unpickle([]byte(data))
+		assert.Error(t, err, "data: %q", data)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	jp "github.com/buger/jsonparser"
+	"github.com/siglens/siglens/pkg/segment/writer/metrics"
+	"github.com/siglens/siglens/pkg/usageStats"
+	log "github.com/sirupsen/logrus"
+)
+
+// Lines and pickle messages larger than this are rejected, matching carbon's
+// limit for pickle messages.
+const maxMessageSize = 1024 * 1024
+
+const maxDatagramSize = 65536
+
+type point struct {
+	name      string
+	tags      map[string]string
+	value     float64
+	timestamp uint32
+}
+
+// Listens on the address and ingests plaintext protocol lines sent over TCP
+// until the listener fails. Returns an error if the address can't be listened
+// on or a template is invalid.
+func RunTCPServer(addr string, templates []string) error {
+	matcher, err := newTemplateMatcher(templates)
+	if err != nil {
+		return fmt.Errorf("RunTCPServer: failed to parse templates; err=%v", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("RunTCPServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return serveTCP(listener, func(conn net.Conn) { handlePlaintextConnection(conn, matcher) })
+}
+
+// Listens on the address and ingests pickle protocol messages sent over TCP
+// until the listener fails. Returns an error if the address can't be listened
+// on or a template is invalid.
+func RunPickleServer(addr string, templates []string) error {
+	matcher, err := newTemplateMatcher(templates)
+	if err != nil {
+		return fmt.Errorf("RunPickleServer: failed to parse templates; err=%v", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("RunPickleServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return serveTCP(listener, func(conn net.Conn) { handlePickleConnection(conn, matcher) })
+}
+
+// Listens on the address and ingests the plaintext protocol lines in each UDP
+// datagram until the connection fails. Returns an error if the address can't
+// be listened on or a template is invalid.
+func RunUDPServer(addr string, templates []string) error {
+	matcher, err := newTemplateMatcher(templates)
+	if err != nil {
+		return fmt.Errorf("RunUDPServer: failed to parse templates; err=%v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("RunUDPServer: failed to listen on %v; err=%v", addr, err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("RunUDPServer: failed to read datagram; err=%v", err)
+		}
+
+		now := time.Now()
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			ingestLine(line, matcher, now, 0)
+		}
+	}
+}
+
+func serveTCP(listener net.Listener, handleConnection func(conn net.Conn)) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Errorf("serveTCP: failed to accept connection; err=%v", err)
+			continue
+		}
+
+		go func() {
+			defer conn.Close()
+			handleConnection(conn)
+		}()
+	}
+}
+
+func handlePlaintextConnection(conn net.Conn, matcher *templateMatcher) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxMessageSize)
+	for scanner.Scan() {
+		ingestLine(scanner.Text(), matcher, time.Now(), 0)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		log.Errorf("handlePlaintextConnection: closing connection from %v; err=%v", conn.RemoteAddr(), err)
+	}
+}
+
+func ingestLine(line string, matcher *templateMatcher, now time.Time, orgId uint64) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	p, err := parseLine(line, matcher, now)
+	if err != nil {
+		log.Debugf("ingestLine: dropping line; err=%v", err)
+		return
+	}
+
+	err = writePoint(p, orgId)
+	if err != nil {
+		log.Errorf("ingestLine: failed to write point for line %q; err=%v", line, err)
+		return
+	}
+
+	usageStats.UpdateMetricsStats(uint64(len(line)), 1, orgId)
+}
+
+// Parses a plaintext protocol line: <path> <value> [<timestamp>]. The path may
+// have Graphite tags appended as ;key=value, which take precedence over tags
+// from the template. A missing or negative timestamp means now.
+func parseLine(line string, matcher *templateMatcher, now time.Time) (*point, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("parseLine: expected <path> <value> [<timestamp>] but got %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("parseLine: invalid value in %q; err=%v", line, err)
+	}
+
+	var timestamp interface{} = int64(-1)
+	if len(fields) == 3 {
+		timestamp, err = strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parseLine: invalid timestamp in %q; err=%v", line, err)
+		}
+	}
+
+	return newPoint(fields[0], value, timestamp, matcher, now)
+}
+
+func newPoint(metricPath string, value float64, rawTimestamp interface{}, matcher *templateMatcher, now time.Time) (*point, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("newPoint: value %v for %v is not a finite number", value, metricPath)
+	}
+
+	var timestamp float64
+	switch rawTimestamp := rawTimestamp.(type) {
+	case int64:
+		timestamp = float64(rawTimestamp)
+	case float64:
+		timestamp = rawTimestamp
+	default:
+		return nil, fmt.Errorf("newPoint: expected a numeric timestamp for %v but got %T", metricPath, rawTimestamp)
+	}
+	if timestamp < 0 {
+		timestamp = float64(now.Unix())
+	}
+	if timestamp > math.MaxUint32 {
+		return nil, fmt.Errorf("newPoint: timestamp %v for %v is out of range", timestamp, metricPath)
+	}
+
+	pathTags := strings.Split(metricPath, ";")
+	name, tags := matcher.apply(pathTags[0])
+	for _, tag := range pathTags[1:] {
+		key, tagValue, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("newPoint: expected a key=value tag in %v but got %q", metricPath, tag)
+		}
+		tags[sanitizeName(key, false)] = tagValue
+	}
+	if name == "" {
+		return nil, fmt.Errorf("newPoint: empty metric name")
+	}
+
+	return &point{name: name, tags: tags, value: value, timestamp: uint32(timestamp)}, nil
+}
+
+func writePoint(p *point, orgId uint64) error {
+	tagsHolder := metrics.GetTagsHolder()
+	for key, value := range p.tags {
+		tagsHolder.Insert(key, []byte(value), jp.String)
+	}
+
+	return metrics.EncodeDatapoint([]byte(p.name), tagsHolder, p.value, p.timestamp, 0, orgId)
+}
+
+// Each pickle message is a 4-byte big endian length followed by a pickled
+// list of (path, (timestamp, value)) tuples.
+func handlePickleConnection(conn net.Conn, matcher *templateMatcher) {
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 4)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Errorf("handlePickleConnection: closing connection from %v; failed to read header; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+
+		length := binary.BigEndian.Uint32(header)
+		if length > maxMessageSize {
+			log.Errorf("handlePickleConnection: closing connection from %v; message of %v bytes is larger than the limit of %v bytes",
+				conn.RemoteAddr(), length, maxMessageSize)
+			return
+		}
+
+		message := make([]byte, length)
+		_, err = io.ReadFull(reader, message)
+		if err != nil {
+			log.Errorf("handlePickleConnection: closing connection from %v; failed to read message; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+
+		err = ingestPickleMessage(message, matcher, time.Now(), 0)
+		if err != nil {
+			log.Errorf("handlePickleConnection: closing connection from %v; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Points that can't be converted or written are logged and skipped, but a
+// message that isn't a list of points is an error.
+func ingestPickleMessage(message []byte, matcher *templateMatcher, now time.Time, orgId uint64) error {
+	points, err := parsePickleMessage(message, matcher, now)
+	if err != nil {
+		return err
+	}
+
+	numWritten := 0
+	for _, p := range points {
+		err = writePoint(p, orgId)
+		if err != nil {
+			log.Errorf("ingestPickleMessage: failed to write point for %v; err=%v", p.name, err)
+			continue
+		}
+		numWritten++
+	}
+
+	usageStats.UpdateMetricsStats(uint64(len(message)), uint64(numWritten), orgId)
+	return nil
+}
+
+func parsePickleMessage(message []byte, matcher *templateMatcher, now time.Time) ([]*point, error) {
+	value, err := unpickle(message)
+	if err != nil {
+		return nil, fmt.Errorf("parsePickleMessage: failed to unpickle message; err=%v", err)
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parsePickleMessage: expected a list of points but got %T", value)
+	}
+
+	points := make([]*point, 0, len(items))
+	for _, item := range items {
+		p, err := pickleItemToPoint(item, matcher, now)
+		if err != nil {
+			log.Debugf("parsePickleMessage: dropping point; err=%v", err)
+			continue
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+func pickleItemToPoint(item interface{}, matcher *templateMatcher, now time.Time) (*point, error) {
+	pair, ok := item.([]interface{})
+	if !ok || len(pair) != 2 {
+		return nil, fmt.Errorf("pickleItemToPoint: expected a (path, (timestamp, value)) tuple but got %v", item)
+	}
+
+	metricPath, ok := pair[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("pickleItemToPoint: expected the path to be a string but got %T", pair[0])
+	}
+
+	datapoint, ok := pair[1].([]interface{})
+	if !ok || len(datapoint) != 2 {
+		return nil, fmt.Errorf("pickleItemToPoint: expected a (timestamp, value) tuple for %v but got %v", metricPath, pair[1])
+	}
+
+	var value float64
+	switch rawValue := datapoint[1].(type) {
+	case int64:
+		value = float64(rawValue)
+	case float64:
+		value = rawValue
+	case string:
+		var err error
+		value, err = strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pickleItemToPoint: invalid value for %v; err=%v", metricPath, err)
+		}
+	default:
+		return nil, fmt.Errorf("pickleItemToPoint: expected a numeric value for %v but got %T", metricPath, datapoint[1])
+	}
+
+	return newPoint(metricPath, value, datapoint[0], matcher, now)
+}
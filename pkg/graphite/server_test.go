@@ -0,0 +1,78 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLine(t *testing.T) {
+	matcher, err := newTemplateMatcher([]string{"servers.* .host.measurement*"})
+	assert.NoError(t, err)
+	now := time.Unix(1_700_000_100, 0)
+
+	p, err := parseLine("servers.web01.cpu.load 1.5 1700000000", matcher, now)
+	assert.NoError(t, err)
+	assert.Equal(t, &point{name: "cpu_load", tags: map[string]string{"host": "web01"}, value: 1.5, timestamp: 1_700_000_000}, p)
+
+	// Missing and negative timestamps mean now, and Graphite tags override
+	// template tags.
+	for _, line := range []string{"servers.web01.cpu.load;host=web09;dc=east 2", "servers.web01.cpu.load;host=web09;dc=east 2 -1"} {
+		p, err = parseLine(line, matcher, now)
+		assert.NoError(t, err)
+		assert.Equal(t, &point{name: "cpu_load", tags: map[string]string{"host": "web09", "dc": "east"}, value: 2, timestamp: 1_700_000_100}, p)
+	}
+
+	for _, line := range []string{
+		"servers.web01.cpu.load",
+		"servers.web01.cpu.load abc 1700000000",
+		"servers.web01.cpu.load 1 abc",
+		"servers.web01.cpu.load nan 1700000000",
+		"servers.web01.cpu.load 1 1700000000 extra",
+		"servers.web01.cpu.load;notatag 1",
+		"servers.web01.cpu.load 1 99999999999",
+	} {
+		_, err = parseLine(line, matcher, now)
+		assert.Error(t, err, "line: %v", line)
+	}
+}
+
+func Test_ParsePickleMessage(t *testing.T) {
+	matcher, err := newTemplateMatcher([]string{"servers.* .host.measurement*"})
+	assert.NoError(t, err)
+
+	// Protocol 2 pickle of two points.
+	message := decodeHex(t, "80025d7100285816000000736572766572732e77656230312e6370752e6c6f616471014a00f15365473ff80000000000008671028671035816000000736572766572732e77656230322e6370752e69646c6571044741d954fc400000004b62867105867106652e")
+	points, err := parsePickleMessage(message, matcher, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []*point{
+		{name: "cpu_load", tags: map[string]string{"host": "web01"}, value: 1.5, timestamp: 1_700_000_000},
+		{name: "cpu_idle", tags: map[string]string{"host": "web02"}, value: 98, timestamp: 1_700_000_000},
+	}, points)
+
+	// Invalid points are dropped.
+	points, err = parsePickleMessage([]byte("(lp0\n(S'a.b'\n(I1\nS'x'\nttp1\na(S'a.c'\nI1\ntp2\na."), matcher, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+
+	_, err = parsePickleMessage([]byte("I1\n."), matcher, time.Now())
+	assert.Error(t, err)
+}
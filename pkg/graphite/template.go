@@ -0,0 +1,268 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Converts a dotted metric path into a metric name and tags. Each template
+// part applies to the path part at the same position: "measurement" and
+// "field" parts make up the name, a trailing "*" on either takes all the
+// remaining path parts, an empty part skips the path part, and any other part
+// is a tag key. Path parts beyond the template are ignored.
+type template struct {
+	filter      []string
+	parts       []string
+	defaultTags map[string]string
+}
+
+// Picks the template to use for each metric path. When several filters match,
+// the most specific wins; comparing parts from the left, an exact part beats
+// a wildcard, and a longer filter beats a shorter one.
+type templateMatcher struct {
+	templates       []*template
+	defaultTemplate *template
+}
+
+// Each spec is "[filter] template [tags]", where the filter is a dotted path
+// that may use wildcards in its parts, and the tags are comma separated
+// key=value pairs added to every metric the template applies to.
+func newTemplateMatcher(specs []string) (*templateMatcher, error) {
+	matcher := &templateMatcher{}
+	for _, spec := range specs {
+		t, err := parseTemplate(spec)
+		if err != nil {
+			return nil, fmt.Errorf("newTemplateMatcher: invalid template %q; err=%v", spec, err)
+		}
+
+		if len(t.filter) > 0 {
+			matcher.templates = append(matcher.templates, t)
+			continue
+		}
+
+		if matcher.defaultTemplate != nil {
+			return nil, fmt.Errorf("newTemplateMatcher: only one template may have no filter but got %q", spec)
+		}
+		matcher.defaultTemplate = t
+	}
+
+	return matcher, nil
+}
+
+func parseTemplate(spec string) (*template, error) {
+	fields := strings.Fields(spec)
+	var filter, parts, rawTags string
+	switch len(fields) {
+	case 1:
+		parts = fields[0]
+	case 2:
+		if strings.Contains(fields[1], "=") {
+			parts, rawTags = fields[0], fields[1]
+		} else {
+			filter, parts = fields[0], fields[1]
+		}
+	case 3:
+		filter, parts, rawTags = fields[0], fields[1], fields[2]
+	default:
+		return nil, fmt.Errorf("parseTemplate: expected 1 to 3 space-separated fields but got %v", len(fields))
+	}
+
+	t := &template{
+		parts:       strings.Split(parts, "."),
+		defaultTags: make(map[string]string),
+	}
+	if filter != "" {
+		t.filter = strings.Split(filter, ".")
+		for _, filterPart := range t.filter {
+			_, err := path.Match(filterPart, "")
+			if err != nil {
+				return nil, fmt.Errorf("parseTemplate: invalid filter part %q; err=%v", filterPart, err)
+			}
+		}
+	}
+
+	hasMeasurement := false
+	for i, part := range t.parts {
+		switch part {
+		case "measurement", "measurement*":
+			hasMeasurement = true
+		}
+		if strings.HasSuffix(part, "*") && i != len(t.parts)-1 {
+			return nil, fmt.Errorf("parseTemplate: only the last part may end with * but got %q", part)
+		}
+		if part == "*" || (strings.HasSuffix(part, "*") && part != "measurement*" && part != "field*") {
+			return nil, fmt.Errorf("parseTemplate: only measurement and field may end with * but got %q", part)
+		}
+	}
+	if !hasMeasurement {
+		return nil, fmt.Errorf("parseTemplate: no measurement part in %q", parts)
+	}
+
+	if rawTags != "" {
+		for _, tag := range strings.Split(rawTags, ",") {
+			key, value, ok := strings.Cut(tag, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("parseTemplate: expected a key=value tag but got %q", tag)
+			}
+			t.defaultTags[sanitizeName(key, false)] = value
+		}
+	}
+
+	return t, nil
+}
+
+// Returns the metric name and tags for the path. Without a matching template
+// the whole path is the name.
+func (m *templateMatcher) apply(metricPath string) (string, map[string]string) {
+	pathParts := strings.Split(metricPath, ".")
+	t := m.match(pathParts)
+	if t == nil {
+		return sanitizeName(metricPath, true), make(map[string]string)
+	}
+
+	tags := make(map[string]string, len(t.defaultTags)+len(t.parts))
+	for key, value := range t.defaultTags {
+		tags[key] = value
+	}
+
+	var measurement, field []string
+	tagValues := make(map[string][]string)
+	for i, part := range t.parts {
+		if i >= len(pathParts) {
+			break
+		}
+
+		switch part {
+		case "":
+		case "measurement":
+			measurement = append(measurement, pathParts[i])
+		case "measurement*":
+			measurement = append(measurement, pathParts[i:]...)
+		case "field":
+			field = append(field, pathParts[i])
+		case "field*":
+			field = append(field, pathParts[i:]...)
+		default:
+			tagValues[part] = append(tagValues[part], pathParts[i])
+		}
+	}
+	for key, values := range tagValues {
+		tags[sanitizeName(key, false)] = strings.Join(values, ".")
+	}
+
+	if len(measurement) == 0 {
+		return sanitizeName(metricPath, true), tags
+	}
+
+	name := strings.Join(measurement, "_")
+	if len(field) > 0 {
+		name += "_" + strings.Join(field, "_")
+	}
+
+	return sanitizeName(name, true), tags
+}
+
+func (m *templateMatcher) match(pathParts []string) *template {
+	var best *template
+	var bestRanks []int
+	for _, t := range m.templates {
+		ranks, ok := matchFilter(t.filter, pathParts)
+		if !ok {
+			continue
+		}
+
+		if best == nil || compareRanks(ranks, bestRanks) > 0 {
+			best, bestRanks = t, ranks
+		}
+	}
+
+	if best == nil {
+		return m.defaultTemplate
+	}
+
+	return best
+}
+
+const (
+	wildcardRank = 1
+	exactRank    = 2
+)
+
+// Returns how specifically each filter part matched, if the filter matches a
+// prefix of the path.
+func matchFilter(filter []string, pathParts []string) ([]int, bool) {
+	if len(filter) > len(pathParts) {
+		return nil, false
+	}
+
+	ranks := make([]int, len(filter))
+	for i, filterPart := range filter {
+		matched, err := path.Match(filterPart, pathParts[i])
+		if err != nil || !matched {
+			return nil, false
+		}
+
+		ranks[i] = exactRank
+		if strings.ContainsAny(filterPart, "*?[") {
+			ranks[i] = wildcardRank
+		}
+	}
+
+	return ranks, true
+}
+
+// Compares lexicographically, so a missing part ranks below any part.
+func compareRanks(a []int, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+// Graphite paths may contain characters PromQL can't query, so characters
+// that aren't valid in a Prometheus name are replaced with underscores.
+func sanitizeName(name string, allowColon bool) string {
+	if name == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	if name[0] >= '0' && name[0] <= '9' {
+		sb.WriteByte('_')
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		isValid := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') || char == '_' || (allowColon && char == ':')
+		if isValid {
+			sb.WriteByte(char)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TemplateMatcher(t *testing.T) {
+	matcher, err := newTemplateMatcher([]string{
+		"servers.*.cpu.* .host.measurement.field",
+		"servers.web01.cpu .host.measurement.field* role=frontend",
+		"collectd.* .host.measurement* source=collectd",
+		"stats.*.*.timers .region.measurement*",
+		"measurement.measurement.field*",
+	})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		path         string
+		expectedName string
+		expectedTags map[string]string
+	}{
+		{"servers.web02.cpu.load", "cpu_load", map[string]string{"host": "web02"}},
+		// The exact filter part beats the wildcard.
+		{"servers.web01.cpu.load.shortterm", "cpu_load_shortterm", map[string]string{"host": "web01", "role": "frontend"}},
+		{"collectd.db-1.memory.used", "memory_used", map[string]string{"host": "db-1", "source": "collectd"}},
+		{"stats.us-east.api.timers", "api_timers", map[string]string{"region": "us-east"}},
+		// The default template applies when no filter matches.
+		{"app.requests.ok.total", "app_requests_ok_total", map[string]string{}},
+		{"app", "app", map[string]string{}},
+	}
+
+	for _, c := range cases {
+		name, tags := matcher.apply(c.path)
+		assert.Equal(t, c.expectedName, name, "path: %v", c.path)
+		assert.Equal(t, c.expectedTags, tags, "path: %v", c.path)
+	}
+}
+
+func Test_TemplateMatcher_NoTemplates(t *testing.T) {
+	matcher, err := newTemplateMatcher(nil)
+	assert.NoError(t, err)
+
+	name, tags := matcher.apply("servers.web-01.cpu.load")
+	assert.Equal(t, "servers_web_01_cpu_load", name)
+	assert.Empty(t, tags)
+
+	// Tags from a template without a measurement part for the path.
+	matcher, err = newTemplateMatcher([]string{"a.* host.measurement"})
+	assert.NoError(t, err)
+	name, tags = matcher.apply("a.b")
+	assert.Equal(t, "b", name)
+	assert.Equal(t, map[string]string{"host": "a"}, tags)
+}
+
+func Test_TemplateMatcher_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"host.field",
+		"measurement*.host",
+		"host.*",
+		"host.tag*.measurement",
+		"a.b measurement c=d extra",
+		"a.[ measurement",
+		"measurement bad-tag",
+	} {
+		_, err := newTemplateMatcher([]string{spec})
+		assert.Error(t, err, "spec: %q", spec)
+	}
+
+	_, err := newTemplateMatcher([]string{"measurement*", "host.measurement*"})
+	assert.Error(t, err)
+}
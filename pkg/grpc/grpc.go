@@ -37,4 +37,8 @@ const (
 	INGEST_FUNC_OTLP_TRACES
 	INGEST_FUNC_FAKE_DATA
 	INGEST_FUNC_LOKI
+	INGEST_FUNC_OTLP_LOGS
+	INGEST_FUNC_OTLP_METRICS
+	INGEST_FUNC_ZIPKIN_TRACES
+	INGEST_FUNC_JAEGER_TRACES
 )
@@ -0,0 +1,874 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loki
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siglens/siglens/pkg/ast"
+	"github.com/siglens/siglens/pkg/ast/pipesearch"
+	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
+	rutils "github.com/siglens/siglens/pkg/readerUtils"
+	"github.com/siglens/siglens/pkg/segment"
+	"github.com/siglens/siglens/pkg/segment/metadata"
+	"github.com/siglens/siglens/pkg/segment/query/processor"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	segutils "github.com/siglens/siglens/pkg/segment/utils"
+	segwriter "github.com/siglens/siglens/pkg/segment/writer"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// Range functions that need the value of every matching line load them all,
+	// so this bounds the memory they can use; queries matching more lines fail
+	// instead of being wrong. The other functions are aggregated by the stats
+	// engine.
+	MaxMetricQueryRecords = 500_000
+	MaxMetricQueryPoints  = 11_000
+	DefaultMetricPoints   = 250
+	lineColumn            = "line"
+	lineBytesColumn       = "_line_bytes"
+)
+
+// Range functions that only need the number of lines in each time bucket, and
+// the sum, minimum or maximum of their values.
+var bucketedRangeFunctions = map[string]bool{
+	"count_over_time": true,
+	"rate":            true,
+	"bytes_over_time": true,
+	"bytes_rate":      true,
+	"sum_over_time":   true,
+	"avg_over_time":   true,
+	"min_over_time":   true,
+	"max_over_time":   true,
+}
+
+// Range functions whose result for several series is the sum of their results.
+var additiveRangeFunctions = map[string]bool{
+	"count_over_time": true,
+	"rate":            true,
+	"bytes_over_time": true,
+	"bytes_rate":      true,
+	"sum_over_time":   true,
+}
+
+// The lines of a series in a time bucket, or a single line, in which case the
+// count is 1 and the sum, min and max are its value.
+type logSample struct {
+	timestamp uint64
+	count     float64
+	sum       float64
+	min       float64
+	max       float64
+}
+
+type logSampleSeries struct {
+	labels  map[string]string
+	samples []logSample
+}
+
+// A series of a metric query's result, with values keyed by the evaluation
+// timestamp in milliseconds.
+type metricSeries struct {
+	labels map[string]string
+	values map[uint64]float64
+}
+
+func processMetricsQueryRequest(ctx *fasthttp.RequestCtx, query string, metricsExpr *ast.LogMetricsExpr, myid uint64) {
+	isRangeQuery := strings.HasSuffix(string(ctx.Path()), "query_range")
+	evalTimes, err := getMetricEvaluationTimes(ctx, isRangeQuery)
+	if err != nil {
+		utils.SendError(ctx, "Failed to parse time range", "", err)
+		return
+	}
+
+	startTimeMs := uint64(0)
+	if evalTimes[0] > metricsExpr.RangeMillis {
+		startTimeMs = evalTimes[0] - metricsExpr.RangeMillis
+	}
+	endTimeMs := evalTimes[len(evalTimes)-1]
+
+	qid := rutils.GetNextQid()
+	simpleNode, aggs, _, err := pipesearch.ParseRequest(query, startTimeMs, endTimeMs, qid, "Log QL", LOKIINDEX_STAR)
+	if err != nil {
+		utils.SendError(ctx, "Failed to parse request", "", err)
+		return
+	}
+
+	segment.LogASTNode("logql query parser", simpleNode, qid)
+	segment.LogQueryAggsNode("logql aggs parser", aggs, qid)
+	startTime := utils.GetCurrentTimeInMs()
+	ti := structs.InitTableInfo(LOKIINDEX_STAR, myid, false)
+	labelColumns, ok := getGroupingLabels(metricsExpr)
+	if !ok {
+		labelColumns = getAllLabelColumns(aggs, ti, simpleNode.TimeRange, myid, metricsExpr)
+	}
+
+	var allSeries []*logSampleSeries
+	if bucketedRangeFunctions[metricsExpr.RangeFunction] && (metricsExpr.Unwrap == nil || metricsExpr.Unwrap.Conversion == "") {
+		allSeries, err = getBucketSampleSeries(simpleNode, aggs, qid, ti, myid, metricsExpr, labelColumns, evalTimes)
+	} else {
+		allSeries, err = getLineSampleSeries(simpleNode, aggs, qid, ti, myid, metricsExpr, labelColumns)
+	}
+	if err != nil {
+		utils.SendError(ctx, err.Error(), fmt.Sprintf("qid=%v, QUERY: %v", qid, query), err)
+		return
+	}
+
+	series := evaluateRangeFunction(allSeries, metricsExpr, evalTimes)
+	for _, aggregation := range metricsExpr.Aggregations {
+		series = applyVectorAggregation(series, aggregation, evalTimes)
+	}
+
+	if isRangeQuery {
+		response := getMatrixResponse(series)
+		// The matching lines aren't loaded, so there are no line counts.
+		response.Data.Stats = getQueryStats(&structs.NodeResult{}, startTime, myid)
+		utils.WriteJsonResponse(ctx, response)
+	} else {
+		utils.WriteJsonResponse(ctx, getInstantVectorResponse(series, evalTimes[0]))
+	}
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// Range queries are evaluated every step from start to end, and instant
+// queries only at the given time.
+func getMetricEvaluationTimes(ctx *fasthttp.RequestCtx, isRangeQuery bool) ([]uint64, error) {
+	if !isRangeQuery {
+		timeParam := string(ctx.QueryArgs().Peek("time"))
+		if timeParam == "" {
+			return []uint64{utils.GetCurrentTimeInMs()}, nil
+		}
+		evalTime, err := utils.ConvertTimestampToMillis(timeParam)
+		if err != nil {
+			return nil, err
+		}
+		return []uint64{evalTime}, nil
+	}
+
+	startTimeMs, endTimeMs, err := parseTimeRangeInMS(ctx, uint64(HOUR_IN_MS))
+	if err != nil {
+		return nil, err
+	}
+	if startTimeMs > endTimeMs {
+		return nil, fmt.Errorf("getMetricEvaluationTimes: end time %v is before start time %v", endTimeMs, startTimeMs)
+	}
+
+	stepMs, err := parseStepInMS(string(ctx.QueryArgs().Peek("step")), startTimeMs, endTimeMs)
+	if err != nil {
+		return nil, err
+	}
+	if (endTimeMs-startTimeMs)/stepMs+1 > MaxMetricQueryPoints {
+		return nil, fmt.Errorf("getMetricEvaluationTimes: step %vms is too small for the time range, it exceeds %v points",
+			stepMs, MaxMetricQueryPoints)
+	}
+
+	evalTimes := make([]uint64, 0, (endTimeMs-startTimeMs)/stepMs+1)
+	for evalTime := startTimeMs; evalTime <= endTimeMs; evalTime += stepMs {
+		evalTimes = append(evalTimes, evalTime)
+	}
+
+	return evalTimes, nil
+}
+
+// The step is either a number of seconds or a duration like "30s". When it
+// isn't given, the range is split into about DefaultMetricPoints steps.
+func parseStepInMS(step string, startTimeMs uint64, endTimeMs uint64) (uint64, error) {
+	if step == "" {
+		stepMs := (endTimeMs - startTimeMs) / DefaultMetricPoints / 1000 * 1000
+		if stepMs < 1000 {
+			stepMs = 1000
+		}
+		return stepMs, nil
+	}
+
+	var stepMs float64
+	if seconds, err := strconv.ParseFloat(step, 64); err == nil {
+		stepMs = seconds * 1000
+	} else if duration, err := time.ParseDuration(step); err == nil {
+		stepMs = float64(duration.Milliseconds())
+	} else {
+		return 0, fmt.Errorf("parseStepInMS: invalid step %v; err=%v", step, err)
+	}
+
+	if stepMs < 1 {
+		return 0, fmt.Errorf("parseStepInMS: step %v must be positive", step)
+	}
+
+	return uint64(stepMs), nil
+}
+
+// Returns the labels the series can be grouped by before they're evaluated:
+// those of the range function's grouping, or of the first vector aggregation
+// when it combines the series the same way the range function combines time
+// buckets.
+func getGroupingLabels(metricsExpr *ast.LogMetricsExpr) ([]string, bool) {
+	if metricsExpr.Grouping != nil {
+		return metricsExpr.Grouping.Labels, !metricsExpr.Grouping.Without
+	}
+	if len(metricsExpr.Aggregations) == 0 {
+		return nil, false
+	}
+
+	aggregation := metricsExpr.Aggregations[0]
+	switch {
+	case aggregation.Grouping != nil && aggregation.Grouping.Without:
+		return nil, false
+	case aggregation.Op == "sum" && additiveRangeFunctions[metricsExpr.RangeFunction],
+		aggregation.Op == "min" && metricsExpr.RangeFunction == "min_over_time",
+		aggregation.Op == "max" && metricsExpr.RangeFunction == "max_over_time":
+		if aggregation.Grouping == nil {
+			return []string{}, true
+		}
+		return aggregation.Grouping.Labels, true
+	default:
+		return nil, false
+	}
+}
+
+// Returns the stored columns of the queried indexes and the ones the log
+// pipeline adds, other than the line, its timestamp and the unwrapped label.
+// The keys a logfmt stage without parameters extracts aren't known up front, so
+// they aren't labels.
+func getAllLabelColumns(aggs *structs.QueryAggregators, ti *structs.TableInfo, timeRange *dtu.TimeRange,
+	myid uint64, metricsExpr *ast.LogMetricsExpr) []string {
+
+	indexNames := ti.GetQueryTables()
+	columns := metadata.GetColumnsForTheIndexesByTimeRange(timeRange, indexNames, myid)
+	for cname := range segwriter.GetUnrotatedColumnsForTheIndexesByTimeRange(timeRange, indexNames, myid) {
+		columns[cname] = true
+	}
+
+	for agg := aggs; agg != nil; agg = agg.Next {
+		switch {
+		case agg.EvalExpr != nil:
+			columns[agg.EvalExpr.FieldName] = true
+		case agg.RexExpr != nil:
+			for _, cname := range agg.RexExpr.RexColNames {
+				columns[cname] = true
+			}
+		case agg.LogfmtExpr != nil:
+			for _, includeValue := range agg.LogfmtExpr.IncludeValues {
+				label := includeValue.Label
+				if columns[label] {
+					label += "_extracted"
+				}
+				columns[label] = true
+			}
+		case agg.FieldsExpr != nil:
+			for _, cname := range agg.FieldsExpr.ExcludeColumns {
+				delete(columns, cname)
+			}
+			if agg.FieldsExpr.IncludeColumns != nil {
+				included := make(map[string]bool, len(agg.FieldsExpr.IncludeColumns))
+				for _, cname := range agg.FieldsExpr.IncludeColumns {
+					included[cname] = columns[cname]
+				}
+				columns = included
+			}
+		}
+	}
+
+	delete(columns, lineColumn)
+	delete(columns, TimeStamp)
+	delete(columns, Index)
+	if metricsExpr.Unwrap != nil {
+		delete(columns, metricsExpr.Unwrap.Field)
+	}
+
+	labelColumns := make([]string, 0, len(columns))
+	for cname, exists := range columns {
+		if exists {
+			labelColumns = append(labelColumns, cname)
+		}
+	}
+	sort.Strings(labelColumns)
+
+	return labelColumns
+}
+
+// Has the stats engine aggregate the lines of each series in time buckets.
+// There's a bucket boundary at every evaluation time and at the start of every
+// range, so each range is made of whole buckets.
+func getBucketSampleSeries(node *structs.ASTNode, aggs *structs.QueryAggregators, qid uint64, ti *structs.TableInfo,
+	myid uint64, metricsExpr *ast.LogMetricsExpr, labelColumns []string, evalTimes []uint64) ([]*logSampleSeries, error) {
+
+	bucketMillis := metricsExpr.RangeMillis
+	if len(evalTimes) > 1 {
+		bucketMillis = gcd(evalTimes[1]-evalTimes[0], metricsExpr.RangeMillis)
+	}
+
+	// Ranges exclude their start and include their end, so the buckets are
+	// aligned to start just after an evaluation time.
+	alignTime := evalTimes[0] + 1
+	metricAggs := &structs.QueryAggregators{
+		BinExpr: &structs.BinCmdOptions{
+			Field: TimeStamp,
+			BinSpanOptions: &structs.BinSpanOptions{
+				BinSpanLength: &structs.BinSpanLength{Num: float64(bucketMillis), TimeScale: segutils.TMMillisecond},
+			},
+			AlignTime: &alignTime,
+		},
+	}
+
+	valueColumn := ""
+	switch {
+	case metricsExpr.Unwrap != nil:
+		valueColumn = metricsExpr.Unwrap.Field
+	case metricsExpr.RangeFunction == "bytes_over_time" || metricsExpr.RangeFunction == "bytes_rate":
+		valueColumn = lineBytesColumn
+		metricAggs = &structs.QueryAggregators{
+			EvalExpr: &structs.EvalExpr{FieldName: lineBytesColumn, ValueExpr: getLineLengthExpr()},
+			Next:     metricAggs,
+		}
+	}
+
+	countAgg := &structs.MeasureAggregator{MeasureCol: TimeStamp, MeasureFunc: segutils.Count}
+	if valueColumn != "" {
+		countAgg.MeasureCol = valueColumn
+	}
+	measureAggs := []*structs.MeasureAggregator{countAgg}
+	var valueAgg *structs.MeasureAggregator
+	switch metricsExpr.RangeFunction {
+	case "count_over_time":
+	case "min_over_time":
+		valueAgg = &structs.MeasureAggregator{MeasureCol: valueColumn, MeasureFunc: segutils.Min}
+	case "max_over_time":
+		valueAgg = &structs.MeasureAggregator{MeasureCol: valueColumn, MeasureFunc: segutils.Max}
+	default:
+		if valueColumn != "" {
+			valueAgg = &structs.MeasureAggregator{MeasureCol: valueColumn, MeasureFunc: segutils.Sum}
+		}
+	}
+	if valueAgg != nil {
+		measureAggs = append(measureAggs, valueAgg)
+	}
+
+	lastAgg := metricAggs
+	for lastAgg.Next != nil {
+		lastAgg = lastAgg.Next
+	}
+	lastAgg.Next = &structs.QueryAggregators{
+		StatsExpr: &structs.StatsExpr{
+			GroupByRequest: &structs.GroupByRequest{
+				GroupByColumns:    append([]string{TimeStamp}, labelColumns...),
+				MeasureOperations: measureAggs,
+			},
+		},
+	}
+	aggs = appendAggs(aggs, metricAggs)
+
+	columns := append([]string{TimeStamp}, labelColumns...)
+	for _, measureAgg := range measureAggs {
+		columns = append(columns, measureAgg.String())
+	}
+
+	qc := structs.InitQueryContextWithTableInfo(ti, segutils.QUERY_MAX_BUCKETS, 0, myid, false)
+	values, numRows, err := processor.RunQueryForColumns(node, aggs, qid, qc, columns, segutils.QUERY_MAX_BUCKETS)
+	if err != nil {
+		return nil, fmt.Errorf("getBucketSampleSeries: failed to run query; err=%v", err)
+	}
+	if numRows >= int(segutils.QUERY_MAX_BUCKETS) {
+		return nil, fmt.Errorf("query has more than %v series and time buckets; use a larger step or fewer labels",
+			segutils.QUERY_MAX_BUCKETS)
+	}
+
+	valueMeasure := ""
+	if valueAgg != nil {
+		valueMeasure = valueAgg.String()
+	}
+
+	return getBucketSeries(values, numRows, countAgg.String(), valueMeasure, labelColumns, bucketMillis, metricsExpr.Grouping), nil
+}
+
+// Each row has the start of a time bucket, the labels of a series, the number
+// of lines of the series in the bucket and optionally the sum, min or max of
+// their values.
+func getBucketSeries(values map[string][]segutils.CValueEnclosure, numRows int, countMeasure string, valueMeasure string,
+	labelColumns []string, bucketMillis uint64, grouping *ast.LogGrouping) []*logSampleSeries {
+
+	seriesByKey := make(map[string]*logSampleSeries)
+	for i := 0; i < numRows; i++ {
+		bucketStart, err := dtu.ConvertToUInt(values[TimeStamp][i].CVal, 64)
+		if err != nil {
+			log.Errorf("getBucketSeries: invalid bucket %v; err=%v", values[TimeStamp][i].CVal, err)
+			continue
+		}
+
+		count, err := dtu.ConvertToFloat(values[countMeasure][i].CVal, 64)
+		if err != nil || count == 0 {
+			continue
+		}
+		sample := logSample{timestamp: bucketStart - 1 + bucketMillis, count: count}
+		if valueMeasure != "" {
+			value, err := dtu.ConvertToFloat(values[valueMeasure][i].CVal, 64)
+			if err != nil {
+				log.Debugf("getBucketSeries: skipping bucket without a numeric value; err=%v", err)
+				continue
+			}
+			sample.sum, sample.min, sample.max = value, value, value
+		}
+
+		addSample(seriesByKey, getRowLabels(values, labelColumns, i, grouping), sample)
+	}
+
+	return getSortedSeries(seriesByKey)
+}
+
+// Loads the timestamp, unwrapped label and labels of every matching line, for
+// the range functions that need each value.
+func getLineSampleSeries(node *structs.ASTNode, aggs *structs.QueryAggregators, qid uint64, ti *structs.TableInfo,
+	myid uint64, metricsExpr *ast.LogMetricsExpr, labelColumns []string) ([]*logSampleSeries, error) {
+
+	if metricsExpr.Unwrap == nil {
+		return nil, fmt.Errorf("getLineSampleSeries: %v needs an unwrapped label", metricsExpr.RangeFunction)
+	}
+
+	columns := append([]string{TimeStamp, metricsExpr.Unwrap.Field}, labelColumns...)
+	qc := structs.InitQueryContextWithTableInfo(ti, MaxMetricQueryRecords, 0, myid, false)
+	values, numRows, err := processor.RunQueryForColumns(node, aggs, qid, qc, columns, MaxMetricQueryRecords)
+	if err != nil {
+		return nil, fmt.Errorf("getLineSampleSeries: failed to run query; err=%v", err)
+	}
+
+	return getLineSeries(values, numRows, metricsExpr.Unwrap, labelColumns, metricsExpr.Grouping), nil
+}
+
+// Each row has the timestamp, unwrapped label and labels of a line. Lines whose
+// unwrapped label isn't a number are skipped.
+func getLineSeries(values map[string][]segutils.CValueEnclosure, numRows int, unwrap *ast.LogUnwrap,
+	labelColumns []string, grouping *ast.LogGrouping) []*logSampleSeries {
+
+	seriesByKey := make(map[string]*logSampleSeries)
+	for i := 0; i < numRows; i++ {
+		timestamp, err := dtu.ConvertToUInt(values[TimeStamp][i].CVal, 64)
+		if err != nil {
+			continue
+		}
+
+		var rawValue segutils.CValueEnclosure
+		if unwrapValues, ok := values[unwrap.Field]; ok {
+			rawValue = unwrapValues[i]
+		}
+		value, err := getSampleValue(rawValue, unwrap)
+		if err != nil {
+			log.Debugf("getLineSeries: skipping record; err=%v", err)
+			continue
+		}
+
+		sample := logSample{timestamp: timestamp, count: 1, sum: value, min: value, max: value}
+		addSample(seriesByKey, getRowLabels(values, labelColumns, i, grouping), sample)
+	}
+
+	return getSortedSeries(seriesByKey)
+}
+
+func getSampleValue(rawValue segutils.CValueEnclosure, unwrap *ast.LogUnwrap) (float64, error) {
+	if rawValue.CVal == nil || rawValue.Dtype == segutils.SS_DT_BACKFILL {
+		return 0, fmt.Errorf("getSampleValue: label %v is missing", unwrap.Field)
+	}
+
+	switch unwrap.Conversion {
+	case "duration", "duration_seconds":
+		duration, err := time.ParseDuration(fmt.Sprintf("%v", rawValue.CVal))
+		if err != nil {
+			return 0, fmt.Errorf("getSampleValue: invalid duration %v; err=%v", rawValue.CVal, err)
+		}
+		return duration.Seconds(), nil
+	default:
+		return dtu.ConvertToFloat(rawValue.CVal, 64)
+	}
+}
+
+// The labels of a row are its values for the label columns, without the empty
+// ones.
+func getRowLabels(values map[string][]segutils.CValueEnclosure, labelColumns []string, row int,
+	grouping *ast.LogGrouping) map[string]string {
+
+	labels := make(map[string]string, len(labelColumns))
+	for _, label := range labelColumns {
+		columnValues, ok := values[label]
+		if !ok {
+			continue
+		}
+		value := columnValues[row]
+		if value.CVal == nil || value.Dtype == segutils.SS_DT_BACKFILL {
+			continue
+		}
+		labelValue := fmt.Sprintf("%v", value.CVal)
+		if labelValue == "" || labelValue == segutils.STR_VALTYPE_ENC_BACKFILL {
+			continue
+		}
+		labels[label] = labelValue
+	}
+
+	if grouping != nil {
+		labels = groupLabels(labels, grouping)
+	}
+
+	return labels
+}
+
+func addSample(seriesByKey map[string]*logSampleSeries, labels map[string]string, sample logSample) {
+	key := getLabelsKey(labels)
+	series, ok := seriesByKey[key]
+	if !ok {
+		series = &logSampleSeries{labels: labels}
+		seriesByKey[key] = series
+	}
+	series.samples = append(series.samples, sample)
+}
+
+func getSortedSeries(seriesByKey map[string]*logSampleSeries) []*logSampleSeries {
+	allSeries := make([]*logSampleSeries, 0, len(seriesByKey))
+	for _, series := range seriesByKey {
+		sort.SliceStable(series.samples, func(i, j int) bool {
+			return series.samples[i].timestamp < series.samples[j].timestamp
+		})
+		allSeries = append(allSeries, series)
+	}
+
+	return allSeries
+}
+
+// Returns an expression for the length of the log line.
+func getLineLengthExpr() *structs.ValueExpr {
+	return &structs.ValueExpr{
+		ValueExprMode: structs.VEMNumericExpr,
+		NumericExpr: &structs.NumericExpr{
+			Op: "len",
+			Left: &structs.NumericExpr{
+				IsTerminal:      true,
+				ValueIsField:    true,
+				Value:           lineColumn,
+				NumericExprMode: structs.NEMLenField,
+			},
+			NumericExprMode: structs.NEMLenField,
+		},
+	}
+}
+
+// Returns the aggregators with the others appended to them.
+func appendAggs(aggs *structs.QueryAggregators, others *structs.QueryAggregators) *structs.QueryAggregators {
+	if aggs == nil {
+		return others
+	}
+
+	lastAgg := aggs
+	for lastAgg.Next != nil {
+		lastAgg = lastAgg.Next
+	}
+	lastAgg.Next = others
+
+	return aggs
+}
+
+func gcd(a uint64, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Each evaluation uses the samples in (evalTime - range, evalTime]; there's
+// no point for the evaluations without samples.
+func evaluateRangeFunction(allSeries []*logSampleSeries, metricsExpr *ast.LogMetricsExpr, evalTimes []uint64) []*metricSeries {
+	rangeSeconds := float64(metricsExpr.RangeMillis) / 1000
+	result := make([]*metricSeries, 0, len(allSeries))
+	for _, series := range allSeries {
+		values := make(map[uint64]float64)
+		for _, evalTime := range evalTimes {
+			start := sort.Search(len(series.samples), func(i int) bool {
+				return series.samples[i].timestamp+metricsExpr.RangeMillis > evalTime
+			})
+			end := sort.Search(len(series.samples), func(i int) bool {
+				return series.samples[i].timestamp > evalTime
+			})
+			if start >= end {
+				continue
+			}
+
+			samples := series.samples[start:end]
+			combined := combineSamples(samples)
+			switch metricsExpr.RangeFunction {
+			case "count_over_time":
+				values[evalTime] = combined.count
+			case "rate":
+				if metricsExpr.Unwrap == nil {
+					values[evalTime] = combined.count / rangeSeconds
+				} else {
+					values[evalTime] = combined.sum / rangeSeconds
+				}
+			case "bytes_rate":
+				values[evalTime] = combined.sum / rangeSeconds
+			case "bytes_over_time", "sum_over_time":
+				values[evalTime] = combined.sum
+			case "avg_over_time":
+				values[evalTime] = combined.sum / combined.count
+			case "min_over_time":
+				values[evalTime] = combined.min
+			case "max_over_time":
+				values[evalTime] = combined.max
+			case "first_over_time":
+				values[evalTime] = samples[0].sum
+			case "last_over_time":
+				values[evalTime] = samples[len(samples)-1].sum
+			case "quantile_over_time":
+				values[evalTime] = getQuantile(getSampleValues(samples), metricsExpr.Quantile)
+			default:
+				log.Errorf("evaluateRangeFunction: unsupported range function %v", metricsExpr.RangeFunction)
+				return []*metricSeries{}
+			}
+		}
+
+		if len(values) > 0 {
+			result = append(result, &metricSeries{labels: series.labels, values: values})
+		}
+	}
+
+	return result
+}
+
+func combineSamples(samples []logSample) logSample {
+	combined := samples[0]
+	for _, sample := range samples[1:] {
+		combined.count += sample.count
+		combined.sum += sample.sum
+		combined.min = math.Min(combined.min, sample.min)
+		combined.max = math.Max(combined.max, sample.max)
+	}
+	return combined
+}
+
+// Returns the values of the single line samples in ascending order.
+func getSampleValues(samples []logSample) []float64 {
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = sample.sum
+	}
+	sort.Float64s(values)
+	return values
+}
+
+// Linearly interpolates between the closest ranks, like Prometheus does.
+func getQuantile(sortedValues []float64, quantile float64) float64 {
+	rank := quantile * float64(len(sortedValues)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sortedValues[lower]*(1-weight) + sortedValues[upper]*weight
+}
+
+func applyVectorAggregation(allSeries []*metricSeries, aggregation *ast.LogVectorAggregation, evalTimes []uint64) []*metricSeries {
+	groups := make(map[string][]*metricSeries)
+	groupKeys := make([]string, 0)
+	groupLabelsByKey := make(map[string]map[string]string)
+	for _, series := range allSeries {
+		labels := groupLabels(series.labels, aggregation.Grouping)
+		key := getLabelsKey(labels)
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+			groupLabelsByKey[key] = labels
+		}
+		groups[key] = append(groups[key], series)
+	}
+	sort.Strings(groupKeys)
+
+	result := make([]*metricSeries, 0)
+	for _, key := range groupKeys {
+		if aggregation.Op == "topk" || aggregation.Op == "bottomk" {
+			result = append(result, selectKSeries(groups[key], aggregation, evalTimes)...)
+			continue
+		}
+
+		aggregated := &metricSeries{labels: groupLabelsByKey[key], values: make(map[uint64]float64)}
+		for _, evalTime := range evalTimes {
+			count := 0
+			aggValue := 0.0
+			for _, series := range groups[key] {
+				value, ok := series.values[evalTime]
+				if !ok {
+					continue
+				}
+				count++
+				switch {
+				case count == 1 && aggregation.Op != "count":
+					aggValue = value
+				case aggregation.Op == "sum" || aggregation.Op == "avg":
+					aggValue += value
+				case aggregation.Op == "min":
+					aggValue = math.Min(aggValue, value)
+				case aggregation.Op == "max":
+					aggValue = math.Max(aggValue, value)
+				}
+			}
+
+			if count == 0 {
+				continue
+			}
+			switch aggregation.Op {
+			case "count":
+				aggValue = float64(count)
+			case "avg":
+				aggValue /= float64(count)
+			}
+			aggregated.values[evalTime] = aggValue
+		}
+
+		if len(aggregated.values) > 0 {
+			result = append(result, aggregated)
+		}
+	}
+
+	return result
+}
+
+// Keeps the k largest (or smallest for bottomk) series at each evaluation;
+// the selected series keep all their labels.
+func selectKSeries(group []*metricSeries, aggregation *ast.LogVectorAggregation, evalTimes []uint64) []*metricSeries {
+	selected := make(map[*metricSeries]*metricSeries)
+	order := make([]*metricSeries, 0)
+	for _, evalTime := range evalTimes {
+		candidates := make([]*metricSeries, 0, len(group))
+		for _, series := range group {
+			if _, ok := series.values[evalTime]; ok {
+				candidates = append(candidates, series)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if aggregation.Op == "bottomk" {
+				return candidates[i].values[evalTime] < candidates[j].values[evalTime]
+			}
+			return candidates[i].values[evalTime] > candidates[j].values[evalTime]
+		})
+		if len(candidates) > aggregation.Param {
+			candidates = candidates[:aggregation.Param]
+		}
+
+		for _, series := range candidates {
+			output, ok := selected[series]
+			if !ok {
+				output = &metricSeries{labels: series.labels, values: make(map[uint64]float64)}
+				selected[series] = output
+				order = append(order, output)
+			}
+			output.values[evalTime] = series.values[evalTime]
+		}
+	}
+
+	return order
+}
+
+// Returns the labels kept by the grouping; without a grouping no labels are
+// kept.
+func groupLabels(labels map[string]string, grouping *ast.LogGrouping) map[string]string {
+	grouped := make(map[string]string)
+	if grouping == nil {
+		return grouped
+	}
+
+	listed := make(map[string]bool, len(grouping.Labels))
+	for _, label := range grouping.Labels {
+		listed[label] = true
+	}
+	for label, value := range labels {
+		if listed[label] != grouping.Without {
+			grouped[label] = value
+		}
+	}
+
+	return grouped
+}
+
+func getLabelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(fmt.Sprintf("%q=%q,", name, labels[name]))
+	}
+	return key.String()
+}
+
+func sortMetricSeries(allSeries []*metricSeries) {
+	sort.SliceStable(allSeries, func(i, j int) bool {
+		return getLabelsKey(allSeries[i].labels) < getLabelsKey(allSeries[j].labels)
+	})
+}
+
+func getMetricLabels(labels map[string]string) map[string]interface{} {
+	metric := make(map[string]interface{}, len(labels))
+	for label, value := range labels {
+		metric[label] = value
+	}
+	return metric
+}
+
+func getMetricPoint(evalTime uint64, value float64) []interface{} {
+	return []interface{}{float64(evalTime) / 1000, strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+func getMatrixResponse(allSeries []*metricSeries) LokiMatrixResponse {
+	sortMetricSeries(allSeries)
+	response := LokiMatrixResponse{Status: "success"}
+	response.Data = MatrixData{ResultType: "matrix", Result: make([]VectorValue, 0, len(allSeries))}
+	for _, series := range allSeries {
+		evalTimes := make([]uint64, 0, len(series.values))
+		for evalTime := range series.values {
+			evalTimes = append(evalTimes, evalTime)
+		}
+		sort.Slice(evalTimes, func(i, j int) bool { return evalTimes[i] < evalTimes[j] })
+
+		values := make([][]interface{}, 0, len(evalTimes))
+		for _, evalTime := range evalTimes {
+			values = append(values, getMetricPoint(evalTime, series.values[evalTime]))
+		}
+		response.Data.Result = append(response.Data.Result, VectorValue{Metric: getMetricLabels(series.labels), Values: values})
+	}
+
+	return response
+}
+
+func getInstantVectorResponse(allSeries []*metricSeries, evalTime uint64) LokiMetricsResponse {
+	sortMetricSeries(allSeries)
+	response := LokiMetricsResponse{Status: "success"}
+	response.Data = MetricsData{ResultType: "vector", MetricResult: make([]MetricValue, 0, len(allSeries))}
+	for _, series := range allSeries {
+		value, ok := series.values[evalTime]
+		if !ok {
+			continue
+		}
+		response.Data.MetricResult = append(response.Data.MetricResult, MetricValue{
+			Stream: getMetricLabels(series.labels),
+			Values: getMetricPoint(evalTime, value),
+		})
+	}
+
+	return response
+}
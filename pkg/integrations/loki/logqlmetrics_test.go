@@ -0,0 +1,186 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loki
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/ast"
+	segutils "github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func getStringValues(values ...string) []segutils.CValueEnclosure {
+	enclosures := make([]segutils.CValueEnclosure, len(values))
+	for i, value := range values {
+		enclosures[i] = segutils.CValueEnclosure{Dtype: segutils.SS_DT_STRING, CVal: value}
+	}
+	return enclosures
+}
+
+func getNumberValues(values ...uint64) []segutils.CValueEnclosure {
+	enclosures := make([]segutils.CValueEnclosure, len(values))
+	for i, value := range values {
+		enclosures[i] = segutils.CValueEnclosure{Dtype: segutils.SS_DT_UNSIGNED_NUM, CVal: value}
+	}
+	return enclosures
+}
+
+func Test_EvaluateRangeFunction_Buckets(t *testing.T) {
+	// The stats engine returns the bucket starts and labels as strings; the
+	// last row has no app label.
+	values := map[string][]segutils.CValueEnclosure{
+		"timestamp":          getStringValues("1", "2001", "4001", "4001"),
+		"app":                getStringValues("api", "web", "api", segutils.STR_VALTYPE_ENC_BACKFILL),
+		"count(_line_bytes)": getNumberValues(2, 1, 1, 1),
+		"sum(_line_bytes)":   getNumberValues(7, 2, 1, 3),
+	}
+	evalTimes := []uint64{2000, 4000, 6000}
+
+	rateExpr := &ast.LogMetricsExpr{RangeFunction: "rate", RangeMillis: 2000}
+	allSeries := getBucketSeries(values, 4, "count(_line_bytes)", "", []string{"app"}, 2000, nil)
+	series := evaluateRangeFunction(allSeries, rateExpr, evalTimes)
+	sortMetricSeries(series)
+	assert.Len(t, series, 3)
+	assert.Equal(t, map[string]string{}, series[0].labels)
+	assert.Equal(t, map[uint64]float64{6000: 0.5}, series[0].values)
+	assert.Equal(t, map[string]string{"app": "api"}, series[1].labels)
+	assert.Equal(t, map[uint64]float64{2000: 1, 6000: 0.5}, series[1].values)
+	assert.Equal(t, map[uint64]float64{4000: 0.5}, series[2].values)
+
+	bytesExpr := &ast.LogMetricsExpr{RangeFunction: "bytes_over_time", RangeMillis: 2000}
+	allSeries = getBucketSeries(values, 4, "count(_line_bytes)", "sum(_line_bytes)", []string{"app"}, 2000, nil)
+	series = evaluateRangeFunction(allSeries, bytesExpr, evalTimes)
+	series = applyVectorAggregation(series, &ast.LogVectorAggregation{Op: "sum"}, evalTimes)
+	assert.Len(t, series, 1)
+	assert.Equal(t, map[string]string{}, series[0].labels)
+	assert.Equal(t, map[uint64]float64{2000: 7, 4000: 2, 6000: 4}, series[0].values)
+}
+
+func Test_EvaluateRangeFunction_OverlappingRanges(t *testing.T) {
+	// With a 1s step and a 2s range, each range is made of two 1s buckets.
+	values := map[string][]segutils.CValueEnclosure{
+		"timestamp":        getStringValues("1001", "2001", "3001"),
+		"count(timestamp)": getNumberValues(1, 2, 4),
+	}
+	evalTimes := []uint64{2000, 3000, 4000}
+
+	countExpr := &ast.LogMetricsExpr{RangeFunction: "count_over_time", RangeMillis: 2000}
+	allSeries := getBucketSeries(values, 3, "count(timestamp)", "", nil, gcd(1000, 2000), nil)
+	series := evaluateRangeFunction(allSeries, countExpr, evalTimes)
+	assert.Len(t, series, 1)
+	assert.Equal(t, map[uint64]float64{2000: 1, 3000: 3, 4000: 6}, series[0].values)
+}
+
+func Test_EvaluateRangeFunction_Lines(t *testing.T) {
+	values := map[string][]segutils.CValueEnclosure{
+		"timestamp": getNumberValues(1000, 2000, 2500, 5000),
+		"app":       getStringValues("api", "api", "web", "api"),
+		"latency":   getStringValues("1.5", "2.5", "x", "4"),
+	}
+	evalTimes := []uint64{2000, 4000, 6000}
+
+	// The sample for "web" can't be unwrapped, so only "api" has samples.
+	quantileExpr := &ast.LogMetricsExpr{
+		RangeFunction: "quantile_over_time",
+		RangeMillis:   5000,
+		Quantile:      0.5,
+		Unwrap:        &ast.LogUnwrap{Field: "latency"},
+		Grouping:      &ast.LogGrouping{Labels: []string{"app"}},
+	}
+	allSeries := getLineSeries(values, 4, quantileExpr.Unwrap, []string{"app"}, quantileExpr.Grouping)
+	series := evaluateRangeFunction(allSeries, quantileExpr, evalTimes)
+	assert.Len(t, series, 1)
+	assert.Equal(t, map[string]string{"app": "api"}, series[0].labels)
+	assert.Equal(t, map[uint64]float64{2000: 2, 4000: 2, 6000: 3.25}, series[0].values)
+}
+
+func Test_GetGroupingLabels(t *testing.T) {
+	labels, ok := getGroupingLabels(&ast.LogMetricsExpr{
+		RangeFunction: "rate",
+		Aggregations:  []*ast.LogVectorAggregation{{Op: "sum", Grouping: &ast.LogGrouping{Labels: []string{"app"}}}},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"app"}, labels)
+
+	labels, ok = getGroupingLabels(&ast.LogMetricsExpr{
+		RangeFunction: "count_over_time",
+		Aggregations:  []*ast.LogVectorAggregation{{Op: "sum"}},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{}, labels)
+
+	_, ok = getGroupingLabels(&ast.LogMetricsExpr{
+		RangeFunction: "avg_over_time",
+		Aggregations:  []*ast.LogVectorAggregation{{Op: "sum"}},
+	})
+	assert.False(t, ok)
+
+	_, ok = getGroupingLabels(&ast.LogMetricsExpr{
+		RangeFunction: "rate",
+		Aggregations:  []*ast.LogVectorAggregation{{Op: "sum", Grouping: &ast.LogGrouping{Without: true, Labels: []string{"pod"}}}},
+	})
+	assert.False(t, ok)
+}
+
+func Test_ApplyVectorAggregation(t *testing.T) {
+	evalTimes := []uint64{1000, 2000}
+	series := []*metricSeries{
+		{labels: map[string]string{"app": "api", "pod": "a"}, values: map[uint64]float64{1000: 1, 2000: 5}},
+		{labels: map[string]string{"app": "api", "pod": "b"}, values: map[uint64]float64{1000: 3}},
+		{labels: map[string]string{"app": "web", "pod": "c"}, values: map[uint64]float64{1000: 2, 2000: 1}},
+	}
+
+	result := applyVectorAggregation(series, &ast.LogVectorAggregation{Op: "avg", Grouping: &ast.LogGrouping{Labels: []string{"app"}}}, evalTimes)
+	assert.Len(t, result, 2)
+	assert.Equal(t, map[string]string{"app": "api"}, result[0].labels)
+	assert.Equal(t, map[uint64]float64{1000: 2, 2000: 5}, result[0].values)
+
+	result = applyVectorAggregation(series, &ast.LogVectorAggregation{Op: "max", Grouping: &ast.LogGrouping{Without: true, Labels: []string{"pod"}}}, evalTimes)
+	assert.Equal(t, map[uint64]float64{1000: 2, 2000: 1}, result[1].values)
+
+	result = applyVectorAggregation(series, &ast.LogVectorAggregation{Op: "topk", Param: 1}, evalTimes)
+	sortMetricSeries(result)
+	assert.Len(t, result, 2)
+	assert.Equal(t, map[string]string{"app": "api", "pod": "a"}, result[0].labels)
+	assert.Equal(t, map[uint64]float64{2000: 5}, result[0].values)
+	assert.Equal(t, map[uint64]float64{1000: 3}, result[1].values)
+
+	response := getMatrixResponse(result)
+	assert.Equal(t, "matrix", response.Data.ResultType)
+	assert.Equal(t, [][]interface{}{{2.0, "5"}}, response.Data.Result[0].Values)
+}
+
+func Test_ParseStepInMS(t *testing.T) {
+	stepMs, err := parseStepInMS("15", 0, 3_600_000)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15_000), stepMs)
+
+	stepMs, err = parseStepInMS("1m", 0, 3_600_000)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(60_000), stepMs)
+
+	stepMs, err = parseStepInMS("", 0, 3_600_000)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(14_000), stepMs)
+
+	_, err = parseStepInMS("0", 0, 3_600_000)
+	assert.NotNil(t, err)
+	_, err = parseStepInMS("abc", 0, 3_600_000)
+	assert.NotNil(t, err)
+}
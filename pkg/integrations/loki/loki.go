@@ -20,12 +20,12 @@ package loki
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/golang/snappy"
 	"github.com/siglens/siglens/pkg/ast"
+	"github.com/siglens/siglens/pkg/ast/logql"
 	"github.com/siglens/siglens/pkg/ast/pipesearch"
 	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
 	"github.com/siglens/siglens/pkg/es/writer"
@@ -516,14 +516,23 @@ func ProcessLokiLabelValuesRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 }
 
 func ProcessQueryRequest(ctx *fasthttp.RequestCtx, myid uint64) {
-	query := removeUnimplementedMethods(string(ctx.QueryArgs().Peek("query")))
+	query := string(ctx.QueryArgs().Peek("query"))
 	if query == "" {
 		utils.SendError(ctx, "Search request is empty", "", nil)
 		return
 	}
 
+	parsedQuery, err := logql.Parse("", []byte(query))
+	if err != nil {
+		utils.SendError(ctx, "Failed to parse query", fmt.Sprintf("QUERY: %v", query), err)
+		return
+	}
+	if queryStruct, ok := parsedQuery.(ast.QueryStruct); ok && queryStruct.MetricsExpr != nil {
+		processMetricsQueryRequest(ctx, query, queryStruct.MetricsExpr, myid)
+		return
+	}
+
 	var sizeLimit uint64 = 100
-	var err error
 
 	limitStr := string(ctx.QueryArgs().Peek("limit"))
 	if limitStr != "" {
@@ -557,10 +566,6 @@ func ProcessQueryRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 		return
 	}
 
-	if aggs != nil && aggs.GroupByRequest != nil {
-		aggs.GroupByRequest.GroupByColumns = remove(aggs.GroupByRequest.GroupByColumns, "line")
-	}
-
 	if sortOrder == "ASC" {
 		aggs = addAscSortColRequestToQueryAggs(aggs, sizeLimit)
 	}
@@ -593,13 +598,6 @@ func ProcessQueryRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 
 	allJsons, allCols, err := record.GetJsonFromAllRrc(queryResult.AllRecords, false, qid, queryResult.SegEncToKey, aggs, queryResult.AllColumnsInAggs)
 
-	if len(queryResult.MeasureResults) > 0 {
-		lokiMetricsResponse := getMetricsResponse(queryResult)
-		utils.WriteJsonResponse(ctx, lokiMetricsResponse)
-		ctx.SetStatusCode(fasthttp.StatusOK)
-		return
-	}
-
 	lokiQueryResponse := LokiQueryResponse{}
 
 	if len(allJsons) > 0 {
@@ -663,7 +661,7 @@ func ProcessQueryRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 }
 
 func ProcessIndexStatsRequest(ctx *fasthttp.RequestCtx, myid uint64) {
-	query := removeUnimplementedMethods(string(ctx.QueryArgs().Peek("query")))
+	query := string(ctx.QueryArgs().Peek("query"))
 
 	qid := rutils.GetNextQid()
 
@@ -768,47 +766,6 @@ func remove(slice []string, stringToRemove string) []string {
 	return slice
 }
 
-// needs to be modified as changes are made to logql parsing. Logfmt, json, label/line expression
-// and stream selectors are supported
-func removeUnimplementedMethods(queryString string) string {
-
-	// Define the regular expression pattern
-	pattern := `sum\s+by\s+\(level\)\s+\(count_over_time\(`
-	regex := regexp.MustCompile(pattern)
-	matchIndex := regex.FindStringIndex(queryString)
-	if matchIndex != nil {
-		extractedString := queryString[matchIndex[1]:]
-		return extractedString
-	} else {
-		return queryString
-	}
-}
-
-func getMetricsResponse(queryResult *structs.NodeResult) LokiMetricsResponse {
-	lokiMetricsResponse := LokiMetricsResponse{}
-	lokiMetricsResponse.Status = "success"
-	lokiMetricsResponse.Data = MetricsData{ResultType: "vector"}
-	lokiMetricsResponse.Data.MetricResult = make([]MetricValue, 0)
-	if queryResult.MeasureResults != nil {
-		metricResult := make([]MetricValue, 0)
-		for _, bucket := range queryResult.MeasureResults {
-			groupByCols := queryResult.GroupByCols
-			newMetricVal := MetricValue{}
-			newMetricVal.Stream = make(map[string]interface{})
-			for index, colName := range groupByCols {
-				newMetricVal.Stream[colName] = bucket.GroupByValues[index]
-			}
-			valResult := make([]interface{}, 0)
-			valResult = append(valResult, 1689919818.158, queryResult.MeasureFunctions[0])
-			newMetricVal.Values = valResult
-			metricResult = append(metricResult, newMetricVal)
-		}
-		lokiMetricsResponse.Data.MetricResult = metricResult
-	}
-
-	lokiMetricsResponse.Data.Stats = MetricStats{}
-	return lokiMetricsResponse
-}
 func getQueryStats(queryResult *structs.NodeResult, startTime uint64, myid uint64) Stats {
 	lokiQueryStats := Stats{}
 	if queryResult == nil {
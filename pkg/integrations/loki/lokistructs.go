@@ -33,7 +33,7 @@ type LokiMetricsResponse struct {
 
 type MetricsData struct {
 	ResultType   string        `json:"resultType"`
-	MetricResult []MetricValue `json:"result,omitempty"`
+	MetricResult []MetricValue `json:"result"`
 	Stats        MetricStats   `json:"stats"`
 }
 
@@ -121,6 +121,17 @@ type StreamValue struct {
 	Values [][]string             `json:"values"`
 }
 
+type LokiMatrixResponse struct {
+	Status string     `json:"status"`
+	Data   MatrixData `json:"data"`
+}
+
+type MatrixData struct {
+	ResultType string        `json:"resultType"`
+	Result     []VectorValue `json:"result"`
+	Stats      Stats         `json:"stats"`
+}
+
 type VectorValue struct {
 	Metric map[string]interface{} `json:"metric"`
 	Values [][]interface{}        `json:"values"`
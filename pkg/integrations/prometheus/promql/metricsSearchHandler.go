@@ -1314,6 +1314,7 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 					mquery.Aggregator = structs.Aggregation{AggregatorFunction: segutils.Avg}
 				}
 			case *parser.VectorSelector:
+				setTimeModifiers(&mquery, expr, startTime, endTime)
 				_, grouping := extractGroupsFromPath(path)
 				mquery.Aggregator.GroupByFields = sort.StringSlice(grouping)
 				aggFunc := extractFuncFromPath(path)
@@ -1378,7 +1379,7 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 			if node == nil {
 				return nil
 			}
-			switch node.(type) {
+			switch node := node.(type) {
 			case *parser.MatrixSelector:
 				function := extractFuncFromPath(path)
 
@@ -1441,6 +1442,7 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 					return fmt.Errorf("parser.Inspect: unsupported function type %v", function)
 				}
 			case *parser.VectorSelector:
+				setTimeModifiers(&mquery, node, startTime, endTime)
 				function := extractFuncFromPath(path)
 				switch function {
 				case "abs":
@@ -1537,6 +1539,7 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 		mquery.HashedMName = xxhash.Sum64String(mquery.MetricName)
 		mquery.OrgId = myid
 		mquery.SelectAllSeries = true
+		setTimeModifiers(&mquery, expr, startTime, endTime)
 		agg := structs.Aggregation{AggregatorFunction: segutils.Avg}
 		mquery.Downsampler = structs.Downsampler{Interval: int(intervalSeconds), Unit: "s", Aggregator: agg}
 
@@ -1589,17 +1592,12 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 
 		req := append(lhsRequest, rhsRequest...)
 
-		if expr.VectorMatching != nil && len(expr.VectorMatching.MatchingLabels) > 0 {
-			if putils.IsLogicalOperator(arithmeticOperation.Operation) {
-				return []structs.MetricsQueryRequest{}, "", []structs.QueryArithmetic{}, fmt.Errorf("convertPqlToMetricsQuery: Grouping modifiers can only be used for comparison and arithmetic %T", expr)
-			}
-
-			arithmeticOperation.VectorMatching = &structs.VectorMatching{
-				Cardinality:    structs.VectorMatchCardinality(expr.VectorMatching.Card),
-				MatchingLabels: expr.VectorMatching.MatchingLabels,
-				On:             expr.VectorMatching.On,
-			}
-			sort.Strings(arithmeticOperation.VectorMatching.MatchingLabels)
+		vectorMatching, err := getVectorMatching(expr, arithmeticOperation.Operation)
+		if err != nil {
+			return []structs.MetricsQueryRequest{}, "", []structs.QueryArithmetic{}, err
+		}
+		if vectorMatching != nil {
+			arithmeticOperation.VectorMatching = vectorMatching
 
 			for i := 0; i < len(req); i++ {
 				if len(req[i].MetricsQuery.TagsFilters) > 0 {
@@ -1663,6 +1661,22 @@ func ConvertPqlToMetricsQuery(searchText string, startTime, endTime uint32, myid
 	return []structs.MetricsQueryRequest{*metricQueryRequest}, pqlQuerytype, []structs.QueryArithmetic{}, nil
 }
 
+// Sets the offset and @ modifiers of the selector on the query, so that it is
+// evaluated over the time range the modifiers point to. The @ start() and
+// @ end() modifiers refer to the time range of the query.
+func setTimeModifiers(mQuery *structs.MetricsQuery, vs *parser.VectorSelector, startTime, endTime uint32) {
+	mQuery.Offset = int64(vs.OriginalOffset.Seconds())
+
+	switch {
+	case vs.StartOrEnd == parser.START:
+		mQuery.AtEpochSec = startTime
+	case vs.StartOrEnd == parser.END:
+		mQuery.AtEpochSec = endTime
+	case vs.Timestamp != nil:
+		mQuery.AtEpochSec = uint32(*vs.Timestamp / 1000)
+	}
+}
+
 func parseTimeFromString(timeStr string) (uint32, error) {
 	// if it is not a relative time, parse as absolute time
 	var t time.Time
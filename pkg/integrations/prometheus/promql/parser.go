@@ -6,6 +6,7 @@ import (
 	"sort"
 
 	"github.com/cespare/xxhash"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/siglens/siglens/pkg/common/dtypeutils"
@@ -17,6 +18,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// How far back absent looks for data points, the same as the default lookback delta of Prometheus
+const absentLookbackSeconds = 300
+
 func extractSelectors(expr parser.Expr) [][]*labels.Matcher {
 	var selectors [][]*labels.Matcher
 	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
@@ -157,6 +161,9 @@ func parsePromQLQuery(query string, startTime, endTime uint32, myid uint64) ([]*
 		}
 		return err
 	})
+	if err != nil {
+		return []*structs.MetricsQueryRequest{}, "", []*structs.QueryArithmetic{}, err
+	}
 
 	if len(mQueryReqs) == 0 {
 		return mQueryReqs, pqlQuerytype, queryArithmetic, nil
@@ -227,7 +234,7 @@ func parsePromQLExprNode(node parser.Node, mQueryReqs []*structs.MetricsQueryReq
 			updateMetricQueryWithAggs(mQuery, mQueryAgg)
 		}
 	case *parser.VectorSelector:
-		mQueryReqs, err = handleVectorSelector(mQueryReqs, intervalSeconds)
+		mQueryReqs, err = handleVectorSelector(node, mQueryReqs, intervalSeconds)
 	case *parser.BinaryExpr:
 		mQueryReqs, queryArithmetic, err = handleBinaryExpr(node, mQueryReqs, queryArithmetic)
 		exit = true
@@ -245,6 +252,8 @@ func parsePromQLExprNode(node parser.Node, mQueryReqs []*structs.MetricsQueryReq
 		// Ignore the ParenExpr, As the Expr inside the ParenExpr will be handled in the next iteration
 	case *parser.NumberLiteral:
 		// Ignore the number literals, As they are handled in the handleCallExpr and BinaryExpr
+	case *parser.StringLiteral:
+		// Ignore the string literals, As they are handled in the handleCallExpr
 	default:
 		log.Errorf("parsePromQLExprNode: Unsupported node type: %T\n", node)
 	}
@@ -488,6 +497,9 @@ func handlePromQLRangeFunctionNode(functionName string, timeWindow, step float64
 		mQuery.Function = structs.Function{RangeFunction: segutils.Changes, TimeWindow: timeWindow, Step: step}
 	case "resets":
 		mQuery.Function = structs.Function{RangeFunction: segutils.Resets, TimeWindow: timeWindow, Step: step}
+	case "absent_over_time":
+		mQuery.Function = structs.Function{AbsentFunction: segutils.Absent_Over_Time, TimeWindow: timeWindow, ValueList: extractAbsentLabels(expr.Args[0])}
+		mQuery.LookbackSeconds = uint32(timeWindow)
 	default:
 		return fmt.Errorf("handlePromQLRangeFunctionNode: unsupported function type %v", functionName)
 	}
@@ -583,6 +595,57 @@ func handleCallExprVectorSelectorNode(expr *parser.Call, mQuery *structs.Metrics
 		mQuery.Function = structs.Function{TimeFunction: segutils.DayOfYear}
 	case "days_in_month":
 		mQuery.Function = structs.Function{TimeFunction: segutils.DaysInMonth}
+	case "absent":
+		if len(expr.Args) != 1 {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters: %v for the absent function", expr.Args.String())
+		}
+		mQuery.Function = structs.Function{AbsentFunction: segutils.Absent, TimeWindow: absentLookbackSeconds, ValueList: extractAbsentLabels(expr.Args[0])}
+		mQuery.LookbackSeconds = absentLookbackSeconds
+	case "label_replace":
+		if len(expr.Args) != 5 {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters: %v for the label_replace function", expr.Args.String())
+		}
+		valueList, err := extractStringArgs(expr.Args[1:])
+		if err != nil {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters for the label_replace function; err=%v", err)
+		}
+		if !model.LabelName(valueList[0]).IsValid() {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: invalid destination label name %v for the label_replace function", valueList[0])
+		}
+		_, err = regexp.Compile("^(?:" + valueList[3] + ")$")
+		if err != nil {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: invalid regex %v for the label_replace function; err=%v", valueList[3], err)
+		}
+		mQuery.Function = structs.Function{LabelFunction: segutils.LabelReplace, ValueList: valueList}
+		mQuery.GetAllLabels = true
+	case "label_join":
+		if len(expr.Args) < 3 {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters: %v for the label_join function", expr.Args.String())
+		}
+		valueList, err := extractStringArgs(expr.Args[1:])
+		if err != nil {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters for the label_join function; err=%v", err)
+		}
+		if !model.LabelName(valueList[0]).IsValid() {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: invalid destination label name %v for the label_join function", valueList[0])
+		}
+		for _, srcLabel := range valueList[2:] {
+			if !model.LabelName(srcLabel).IsValid() {
+				return fmt.Errorf("handleCallExprVectorSelectorNode: invalid source label name %v for the label_join function", srcLabel)
+			}
+		}
+		mQuery.Function = structs.Function{LabelFunction: segutils.LabelJoin, ValueList: valueList}
+		mQuery.GetAllLabels = true
+	case "histogram_quantile":
+		if len(expr.Args) != 2 {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: incorrect parameters: %v for the histogram_quantile function", expr.Args.String())
+		}
+		if _, ok := expr.Args[0].(*parser.NumberLiteral); !ok {
+			return fmt.Errorf("handleCallExprVectorSelectorNode: quantile %v for the histogram_quantile function must be a number", expr.Args[0].String())
+		}
+		// The buckets are told apart by their le label, so every series needs all of its labels
+		mQuery.Function = structs.Function{HistogramFunction: segutils.HistogramQuantile, ValueList: []string{expr.Args[0].String()}}
+		mQuery.GetAllLabels = true
 	default:
 		return fmt.Errorf("handleCallExprVectorSelectorNode: unsupported function type %v", function)
 	}
@@ -590,10 +653,65 @@ func handleCallExprVectorSelectorNode(expr *parser.Call, mQuery *structs.Metrics
 	return nil
 }
 
-func handleVectorSelector(mQueryReqs []*structs.MetricsQueryRequest, intervalSeconds uint32) ([]*structs.MetricsQueryRequest, error) {
+// The series returned by absent has the labels of the equality matchers of the
+// selector, as key and value pairs sorted by key. Labels with more than one
+// equality matcher are left out, since their value is ambiguous.
+func extractAbsentLabels(arg parser.Expr) []string {
+	var vs *parser.VectorSelector
+	switch arg := arg.(type) {
+	case *parser.VectorSelector:
+		vs = arg
+	case *parser.MatrixSelector:
+		vs, _ = arg.VectorSelector.(*parser.VectorSelector)
+	}
+	if vs == nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	ambiguous := make(map[string]struct{})
+	for _, matcher := range vs.LabelMatchers {
+		if matcher.Name == labels.MetricName || matcher.Type != labels.MatchEqual {
+			continue
+		}
+		if _, ok := values[matcher.Name]; ok {
+			ambiguous[matcher.Name] = struct{}{}
+		}
+		values[matcher.Name] = matcher.Value
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if _, ok := ambiguous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	absentLabels := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		absentLabels = append(absentLabels, key, values[key])
+	}
+	return absentLabels
+}
+
+func extractStringArgs(args parser.Expressions) ([]string, error) {
+	values := make([]string, 0, len(args))
+	for _, arg := range args {
+		stringLiteral, ok := arg.(*parser.StringLiteral)
+		if !ok {
+			return nil, fmt.Errorf("extractStringArgs: expected a string but got %v", arg.String())
+		}
+		values = append(values, stringLiteral.Val)
+	}
+	return values, nil
+}
+
+func handleVectorSelector(vs *parser.VectorSelector, mQueryReqs []*structs.MetricsQueryRequest, intervalSeconds uint32) ([]*structs.MetricsQueryRequest, error) {
 	mQuery := &mQueryReqs[0].MetricsQuery
 	mQuery.HashedMName = xxhash.Sum64String(mQuery.MetricName)
 	mQuery.SelectAllSeries = true
+	setTimeModifiers(mQuery, vs, mQueryReqs[0].TimeRange.StartEpochSec, mQueryReqs[0].TimeRange.EndEpochSec)
 
 	// Use the innermost aggregator of the query as the aggregator for the downsampler
 	agg := structs.Aggregation{AggregatorFunction: segutils.Avg}
@@ -686,17 +804,12 @@ func handleBinaryExpr(expr *parser.BinaryExpr, mQueryReqs []*structs.MetricsQuer
 	}
 	mQueryReqs = append(mQueryReqs, rhsRequest...)
 
-	if expr.VectorMatching != nil && len(expr.VectorMatching.MatchingLabels) > 0 {
-		if putils.IsLogicalOperator(arithmeticOperation.Operation) {
-			return []*structs.MetricsQueryRequest{}, []*structs.QueryArithmetic{}, fmt.Errorf("convertPqlToMetricsQuery: Grouping modifiers can only be used for comparison and arithmetic %T", expr)
-		}
-
-		arithmeticOperation.VectorMatching = &structs.VectorMatching{
-			Cardinality:    structs.VectorMatchCardinality(expr.VectorMatching.Card),
-			MatchingLabels: expr.VectorMatching.MatchingLabels,
-			On:             expr.VectorMatching.On,
-		}
-		sort.Strings(arithmeticOperation.VectorMatching.MatchingLabels)
+	vectorMatching, err := getVectorMatching(expr, arithmeticOperation.Operation)
+	if err != nil {
+		return []*structs.MetricsQueryRequest{}, []*structs.QueryArithmetic{}, err
+	}
+	if vectorMatching != nil {
+		arithmeticOperation.VectorMatching = vectorMatching
 
 		for i := 0; i < len(mQueryReqs); i++ {
 			if len(mQueryReqs[i].MetricsQuery.TagsFilters) > 0 {
@@ -716,6 +829,35 @@ func handleBinaryExpr(expr *parser.BinaryExpr, mQueryReqs []*structs.MetricsQuer
 	return mQueryReqs, queryArithmetic, nil
 }
 
+// Returns nil when the binary operation has no on(), ignoring() or grouping
+// modifiers, in which case the series are matched on all of their labels.
+func getVectorMatching(expr *parser.BinaryExpr, operation segutils.LogicalAndArithmeticOperator) (*structs.VectorMatching, error) {
+	if expr.VectorMatching == nil {
+		return nil, nil
+	}
+
+	if putils.IsLogicalOperator(operation) {
+		if len(expr.VectorMatching.MatchingLabels) > 0 {
+			return nil, fmt.Errorf("getVectorMatching: Grouping modifiers can only be used for comparison and arithmetic %T", expr)
+		}
+		return nil, nil
+	}
+
+	if expr.VectorMatching.Card == parser.CardOneToOne && !expr.VectorMatching.On && len(expr.VectorMatching.MatchingLabels) == 0 {
+		return nil, nil
+	}
+
+	vectorMatching := &structs.VectorMatching{
+		Cardinality:    structs.VectorMatchCardinality(expr.VectorMatching.Card),
+		MatchingLabels: expr.VectorMatching.MatchingLabels,
+		On:             expr.VectorMatching.On,
+		Include:        expr.VectorMatching.Include,
+	}
+	sort.Strings(vectorMatching.MatchingLabels)
+
+	return vectorMatching, nil
+}
+
 func appendMetricAggsToTheMQuery(mQueryReqs []*structs.MetricsQueryRequest, mQuery *structs.MetricsQuery) []*structs.MetricsQueryRequest {
 	for _, mQueryReq := range mQueryReqs {
 		currentAggs := mQueryReq.MetricsQuery.MQueryAggs
@@ -1236,3 +1236,146 @@ func Test_parsePromQLQuery_Parse_Promql_Test_CSV(t *testing.T) {
 		assert.True(t, len(mQueryReqs) > 0, "No Metric Search Reqs found for query: %s", query)
 	}
 }
+
+func Test_parsePromQLQuery_LabelAndHistogramFunctions(t *testing.T) {
+	endTime := uint32(time.Now().Unix())
+	startTime := endTime - 86400 // 1 day
+	myId := uint64(0)
+
+	query := `label_replace(up, "host", "$1", "instance", "(.*):.*")`
+	mQueryReqs, _, _, err := parsePromQLQuery(query, startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mQueryReqs))
+	assert.Equal(t, "up", mQueryReqs[0].MetricsQuery.MetricName)
+	assert.True(t, mQueryReqs[0].MetricsQuery.GetAllLabels)
+	assert.Equal(t, structs.AggregatorBlock, mQueryReqs[0].MetricsQuery.MQueryAggs.AggBlockType)
+	assert.Equal(t, structs.FunctionBlock, mQueryReqs[0].MetricsQuery.MQueryAggs.Next.AggBlockType)
+	function := mQueryReqs[0].MetricsQuery.MQueryAggs.Next.FunctionBlock
+	assert.Equal(t, segutils.LabelReplace, function.LabelFunction)
+	assert.Equal(t, []string{"host", "$1", "instance", "(.*):.*"}, function.ValueList)
+
+	query = `label_join(rate(http_requests_total[5m]), "endpoint", "-", "method", "path")`
+	mQueryReqs, _, _, err = parsePromQLQuery(query, startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, "http_requests_total", mQueryReqs[0].MetricsQuery.MetricName)
+	assert.True(t, mQueryReqs[0].MetricsQuery.GetAllLabels)
+	rateBlock := mQueryReqs[0].MetricsQuery.MQueryAggs.Next
+	assert.Equal(t, segutils.Rate, rateBlock.FunctionBlock.RangeFunction)
+	assert.Equal(t, segutils.LabelJoin, rateBlock.Next.FunctionBlock.LabelFunction)
+	assert.Equal(t, []string{"endpoint", "-", "method", "path"}, rateBlock.Next.FunctionBlock.ValueList)
+
+	query = `histogram_quantile(0.9, sum by (le) (rate(request_duration_seconds_bucket[5m])))`
+	mQueryReqs, _, _, err = parsePromQLQuery(query, startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, "request_duration_seconds_bucket", mQueryReqs[0].MetricsQuery.MetricName)
+	assert.True(t, mQueryReqs[0].MetricsQuery.GetAllLabels)
+	aggBlock := mQueryReqs[0].MetricsQuery.MQueryAggs.Next.Next
+	assert.Equal(t, segutils.Sum, aggBlock.AggregatorBlock.AggregatorFunction)
+	assert.Equal(t, []string{"le"}, []string(aggBlock.AggregatorBlock.GroupByFields))
+	assert.Equal(t, segutils.HistogramQuantile, aggBlock.Next.FunctionBlock.HistogramFunction)
+	assert.Equal(t, []string{"0.9"}, aggBlock.Next.FunctionBlock.ValueList)
+
+	invalidQueries := []string{
+		`label_replace(up, "1host", "$1", "instance", "(.*)")`,
+		`label_replace(up, "host", "$1", "instance", "(.*")`,
+		`label_join(up, "host", "-", "in-stance")`,
+	}
+	for _, query := range invalidQueries {
+		_, _, _, err = parsePromQLQuery(query, startTime, endTime, myId)
+		assert.NotNil(t, err, "query: %v", query)
+	}
+}
+
+func Test_parsePromQLQuery_TimeModifiersAndAbsent(t *testing.T) {
+	endTime := uint32(1700000000)
+	startTime := endTime - 3600
+	myId := uint64(0)
+
+	mQueryReqs, _, _, err := parsePromQLQuery("http_requests_total offset 1w", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7*24*3600), mQueryReqs[0].MetricsQuery.Offset)
+	assert.Equal(t, uint32(0), mQueryReqs[0].MetricsQuery.AtEpochSec)
+
+	mQueryReqs, _, _, err = parsePromQLQuery("rate(http_requests_total[5m] @ 1690000000 offset 1h)", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3600), mQueryReqs[0].MetricsQuery.Offset)
+	assert.Equal(t, uint32(1690000000), mQueryReqs[0].MetricsQuery.AtEpochSec)
+	evalTimeRange := mQueryReqs[0].MetricsQuery.GetEvaluationTimeRange(&mQueryReqs[0].TimeRange)
+	assert.Equal(t, dtu.MetricsTimeRange{StartEpochSec: 1690000000 - 3600 - 3600, EndEpochSec: 1690000000 - 3600}, *evalTimeRange)
+
+	mQueryReqs, _, _, err = parsePromQLQuery("sum(http_requests_total @ start())", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, startTime, mQueryReqs[0].MetricsQuery.AtEpochSec)
+
+	mQueryReqs, _, _, err = parsePromQLQuery("http_requests_total @ end()", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, endTime, mQueryReqs[0].MetricsQuery.AtEpochSec)
+
+	// Each side of a binary expression has its own modifiers
+	mQueryReqs, _, _, err = parsePromQLQuery("http_requests_total - http_requests_total offset 1d", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mQueryReqs))
+	assert.Equal(t, int64(0), mQueryReqs[0].MetricsQuery.Offset)
+	assert.Equal(t, int64(24*3600), mQueryReqs[1].MetricsQuery.Offset)
+	assert.NotEqual(t, mQueryReqs[0].MetricsQuery.QueryHash, mQueryReqs[1].MetricsQuery.QueryHash)
+
+	mQueryReqs, _, _, err = parsePromQLQuery(`absent(up{job="api",env="prod",instance=~"a.*"})`, startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, "up", mQueryReqs[0].MetricsQuery.MetricName)
+	assert.Equal(t, uint32(absentLookbackSeconds), mQueryReqs[0].MetricsQuery.LookbackSeconds)
+	function := mQueryReqs[0].MetricsQuery.MQueryAggs.Next.FunctionBlock
+	assert.Equal(t, segutils.Absent, function.AbsentFunction)
+	assert.Equal(t, float64(absentLookbackSeconds), function.TimeWindow)
+	assert.Equal(t, []string{"env", "prod", "job", "api"}, function.ValueList)
+
+	mQueryReqs, _, _, err = parsePromQLQuery(`absent_over_time(up{job="api",job="db"}[10m])`, startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(600), mQueryReqs[0].MetricsQuery.LookbackSeconds)
+	function = mQueryReqs[0].MetricsQuery.MQueryAggs.Next.FunctionBlock
+	assert.Equal(t, segutils.Absent_Over_Time, function.AbsentFunction)
+	assert.Equal(t, float64(600), function.TimeWindow)
+	assert.Equal(t, []string{}, function.ValueList)
+}
+
+func Test_parsePromQLQuery_VectorMatching(t *testing.T) {
+	endTime := uint32(1700000000)
+	startTime := endTime - 3600
+	myId := uint64(0)
+
+	_, _, queryArithmetic, err := parsePromQLQuery("container_memory_usage_bytes * on(pod, namespace) group_left(node) kube_pod_info", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(queryArithmetic))
+	vectorMatching := queryArithmetic[0].VectorMatching
+	assert.NotNil(t, vectorMatching)
+	assert.Equal(t, structs.CardManyToOne, vectorMatching.Cardinality)
+	assert.True(t, vectorMatching.On)
+	assert.Equal(t, []string{"namespace", "pod"}, vectorMatching.MatchingLabels)
+	assert.Equal(t, []string{"node"}, vectorMatching.Include)
+
+	// An empty on() matches every series with every other series
+	_, _, queryArithmetic, err = parsePromQLQuery("http_requests_total / on() group_right up", startTime, endTime, myId)
+	assert.Nil(t, err)
+	vectorMatching = queryArithmetic[0].VectorMatching
+	assert.NotNil(t, vectorMatching)
+	assert.Equal(t, structs.CardOneToMany, vectorMatching.Cardinality)
+	assert.True(t, vectorMatching.On)
+	assert.Empty(t, vectorMatching.MatchingLabels)
+
+	_, _, queryArithmetic, err = parsePromQLQuery("http_requests_total > bool ignoring(code) http_requests_limit", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.True(t, queryArithmetic[0].ReturnBool)
+	vectorMatching = queryArithmetic[0].VectorMatching
+	assert.NotNil(t, vectorMatching)
+	assert.Equal(t, structs.CardOneToOne, vectorMatching.Cardinality)
+	assert.False(t, vectorMatching.On)
+	assert.Equal(t, []string{"code"}, vectorMatching.MatchingLabels)
+
+	// Without modifiers the series are matched on all their labels
+	_, _, queryArithmetic, err = parsePromQLQuery("http_requests_total - http_requests_failed", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Nil(t, queryArithmetic[0].VectorMatching)
+
+	_, _, queryArithmetic, err = parsePromQLQuery("http_requests_total and up", startTime, endTime, myId)
+	assert.Nil(t, err)
+	assert.Nil(t, queryArithmetic[0].VectorMatching)
+}
@@ -18,9 +18,12 @@
 package splunk
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/siglens/siglens/pkg/config"
 	writer "github.com/siglens/siglens/pkg/es/writer"
 	"github.com/siglens/siglens/pkg/grpc"
 	"github.com/siglens/siglens/pkg/hooks"
@@ -52,7 +55,9 @@ func ProcessSplunkHecIngestRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 		return
 	}
 
+	defaults := getHecDefaults(ctx)
 	for _, record := range jsonObjects {
+		defaults.applyTo(record)
 		err, statusCode := handleSingleRecord(record, myid)
 		if err != nil {
 			utils.SendError(ctx, "Failed to ingest a record", fmt.Sprintf("record: %v", record), err)
@@ -66,6 +71,102 @@ func ProcessSplunkHecIngestRequest(ctx *fasthttp.RequestCtx, myid uint64) {
 	ctx.SetStatusCode(fasthttp.StatusOK)
 }
 
+// Handles /services/collector/raw, where the body is raw text with one event
+// per line. The metadata for the events comes from the query string and the
+// HEC token. The channel parameter is accepted but unused since indexer
+// acknowledgement isn't supported.
+func ProcessSplunkHecRawIngestRequest(ctx *fasthttp.RequestCtx, myid uint64) {
+	if hook := hooks.GlobalHooks.OverrideIngestRequestHook; hook != nil {
+		alreadyHandled := hook(ctx, myid, grpc.INGEST_FUNC_SPLUNK, false)
+		if alreadyHandled {
+			return
+		}
+	}
+
+	responseBody := make(map[string]interface{})
+	body, err := utils.GetDecodedBody(ctx)
+	if err != nil {
+		utils.SendError(ctx, "Unable to decode request body", "", err)
+		return
+	}
+
+	defaults := getHecDefaults(ctx)
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		record := map[string]interface{}{"event": string(line)}
+		defaults.applyTo(record)
+		err, statusCode := handleSingleRecord(record, myid)
+		if err != nil {
+			utils.SendError(ctx, "Failed to ingest a record", fmt.Sprintf("record: %v", record), err)
+			ctx.SetStatusCode(statusCode)
+			return
+		}
+	}
+
+	responseBody["status"] = "Success"
+	utils.WriteJsonResponse(ctx, responseBody)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// Metadata for events that don't set their own.
+type hecDefaults struct {
+	index      string
+	sourcetype string
+	host       string
+	source     string
+}
+
+// Query string parameters take precedence over the defaults configured for
+// the request's HEC token.
+func getHecDefaults(ctx *fasthttp.RequestCtx) *hecDefaults {
+	defaults := &hecDefaults{}
+	if tokenConfig, ok := config.GetSplunkHecTokenConfig(getHecToken(ctx)); ok {
+		defaults.index = tokenConfig.Index
+		defaults.sourcetype = tokenConfig.Sourcetype
+	}
+
+	args := ctx.QueryArgs()
+	if index := string(args.Peek("index")); index != "" {
+		defaults.index = index
+	}
+	if sourcetype := string(args.Peek("sourcetype")); sourcetype != "" {
+		defaults.sourcetype = sourcetype
+	}
+	defaults.host = string(args.Peek("host"))
+	defaults.source = string(args.Peek("source"))
+
+	return defaults
+}
+
+// HEC clients send the token as "Authorization: Splunk <token>".
+func getHecToken(ctx *fasthttp.RequestCtx) string {
+	authorization := string(ctx.Request.Header.Peek("Authorization"))
+	if !strings.HasPrefix(authorization, "Splunk ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Splunk "))
+}
+
+func (d *hecDefaults) applyTo(record map[string]interface{}) {
+	setIfMissing := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		if existing, ok := record[key]; !ok || existing == nil || existing == "" {
+			record[key] = value
+		}
+	}
+
+	setIfMissing("index", d.index)
+	setIfMissing("sourcetype", d.sourcetype)
+	setIfMissing("host", d.host)
+	setIfMissing("source", d.source)
+}
+
 func handleSingleRecord(record map[string]interface{}, myid uint64) (error, int) {
 	if record["index"] == "" || record["index"] == nil {
 		record["index"] = "default"
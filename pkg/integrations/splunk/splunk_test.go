@@ -0,0 +1,55 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package splunk
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/config/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_GetHecDefaults(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	config.GetRunningConfig().SplunkHecTokens = map[string]common.HecTokenConfig{
+		"firewall-token": {Index: "firewall", Sourcetype: "pan:traffic"},
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.Set("Authorization", "Splunk firewall-token")
+	ctx.Request.SetRequestURI("/services/collector/raw?channel=abc&host=fw1")
+	defaults := getHecDefaults(ctx)
+	assert.Equal(t, &hecDefaults{index: "firewall", sourcetype: "pan:traffic", host: "fw1"}, defaults)
+
+	// The event's own metadata takes precedence.
+	record := map[string]interface{}{"event": "x", "index": "audit", "sourcetype": ""}
+	defaults.applyTo(record)
+	assert.Equal(t, map[string]interface{}{"event": "x", "index": "audit", "sourcetype": "pan:traffic", "host": "fw1"}, record)
+
+	// The query string takes precedence over the token.
+	ctx.Request.SetRequestURI("/services/collector/raw?index=override")
+	defaults = getHecDefaults(ctx)
+	assert.Equal(t, &hecDefaults{index: "override", sourcetype: "pan:traffic"}, defaults)
+
+	// Unknown tokens have no defaults.
+	ctx.Request.Header.Set("Authorization", "Splunk other-token")
+	ctx.Request.SetRequestURI("/services/collector/raw")
+	assert.Equal(t, &hecDefaults{}, getHecDefaults(ctx))
+}
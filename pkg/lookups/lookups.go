@@ -18,12 +18,15 @@
 package lookups
 
 import (
+	"compress/gzip"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/siglens/siglens/pkg/config"
 	"github.com/siglens/siglens/pkg/utils"
@@ -36,6 +39,10 @@ const (
 	allowedExtCSVGZ = ".csv.gz"
 )
 
+// Guards the files in the lookups directory. Anything that creates, replaces,
+// or deletes a lookup file holds the write lock; readers hold the read lock.
+var lookupFilesLock sync.RWMutex
+
 func UploadLookupFile(ctx *fasthttp.RequestCtx) {
 	fileName := string(ctx.FormValue("name"))
 	if fileName == "" {
@@ -80,6 +87,9 @@ func UploadLookupFile(ctx *fasthttp.RequestCtx) {
 
 	dstPath := filepath.Join(fullLookupsDir, fileName)
 
+	lookupFilesLock.Lock()
+	defer lookupFilesLock.Unlock()
+
 	// Check if file exists and handle overwrite
 	fileExists := false
 	if _, err := os.Stat(dstPath); err == nil {
@@ -143,7 +153,7 @@ func GetAllLookupFiles(ctx *fasthttp.RequestCtx) {
 
 	fileNames := []string{}
 	for _, file := range files {
-		if file.Type().IsRegular() {
+		if file.Type().IsRegular() && !isTempLookupFile(file.Name()) {
 			fileNames = append(fileNames, file.Name())
 		}
 	}
@@ -171,6 +181,9 @@ func GetLookupFile(ctx *fasthttp.RequestCtx) {
 	lookupsDir := config.GetLookupPath()
 	filePath := filepath.Join(lookupsDir, lookupFilename)
 
+	lookupFilesLock.RLock()
+	defer lookupFilesLock.RUnlock()
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -199,7 +212,9 @@ func DeleteLookupFile(ctx *fasthttp.RequestCtx) {
 	lookupsDir := config.GetLookupPath()
 	filePath := filepath.Join(lookupsDir, lookupFilename)
 
+	lookupFilesLock.Lock()
 	err := os.Remove(filePath)
+	lookupFilesLock.Unlock()
 	if err != nil {
 		if os.IsNotExist(err) {
 			ctx.Error("File not found", fasthttp.StatusNotFound)
@@ -213,3 +228,56 @@ func DeleteLookupFile(ctx *fasthttp.RequestCtx) {
 	utils.WriteJsonResponse(ctx, response)
 	ctx.SetStatusCode(fasthttp.StatusOK)
 }
+
+// ReadLookupFile reads a .csv or .csv.gz file from the lookups directory and
+// returns its header row along with all of its data rows.
+func ReadLookupFile(filename string) ([]string, [][]string, error) {
+	// The name comes from the query, so it must not reach outside the
+	// lookups directory.
+	err := ValidateLookupFilename(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadLookupFile: %v", err)
+	}
+	isCSVGZ := strings.HasSuffix(strings.ToLower(filename), allowedExtCSVGZ)
+
+	filePath := filepath.Join(config.GetLookupPath(), filename)
+
+	lookupFilesLock.RLock()
+	defer lookupFilesLock.RUnlock()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadLookupFile: failed to open %v; err=%v", filePath, err)
+	}
+	defer file.Close()
+
+	reader, err := newCSVReader(file, isCSVGZ)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadLookupFile: failed to create reader for %v; err=%v", filePath, err)
+	}
+
+	columnNames, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadLookupFile: failed to read column names from %v; err=%v", filePath, err)
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadLookupFile: failed to read rows from %v; err=%v", filePath, err)
+	}
+
+	return columnNames, rows, nil
+}
+
+func newCSVReader(file *os.File, isCSVGZ bool) (*csv.Reader, error) {
+	if !isCSVGZ {
+		return csv.NewReader(file), nil
+	}
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return csv.NewReader(gzipReader), nil
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookups
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const tempLookupFilePrefix = ".tmp-lookup-"
+
+// LookupFileWriter stages rows in a temporary file in the lookups directory,
+// and only creates, replaces, or appends to the lookup file when Commit() is
+// called. Readers never see a partially written lookup file.
+type LookupFileWriter struct {
+	filename   string
+	appendRows bool
+
+	tempFile  *os.File
+	csvWriter *csv.Writer
+	numRows   uint64
+
+	// Staged rows only have values for the columns known when they were
+	// written, so earlier rows may be shorter than later ones.
+	columns     []string
+	columnToIdx map[string]int
+}
+
+func isTempLookupFile(filename string) bool {
+	return strings.HasPrefix(filename, tempLookupFilePrefix)
+}
+
+func ValidateLookupFilename(filename string) error {
+	if filename == "" || filename != filepath.Base(filename) || isTempLookupFile(filename) {
+		return fmt.Errorf("ValidateLookupFilename: invalid lookup filename %v", filename)
+	}
+
+	lowerFilename := strings.ToLower(filename)
+	if !strings.HasSuffix(lowerFilename, allowedExtCSV) && !strings.HasSuffix(lowerFilename, allowedExtCSVGZ) {
+		return fmt.Errorf("ValidateLookupFilename: only %s and %s files are supported; got %v",
+			allowedExtCSV, allowedExtCSVGZ, filename)
+	}
+
+	return nil
+}
+
+func NewLookupFileWriter(filename string, appendRows bool) (*LookupFileWriter, error) {
+	err := ValidateLookupFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupsDir := config.GetLookupPath()
+	err = os.MkdirAll(lookupsDir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("NewLookupFileWriter: failed to create lookups directory %v; err=%v", lookupsDir, err)
+	}
+
+	tempFile, err := os.CreateTemp(lookupsDir, tempLookupFilePrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("NewLookupFileWriter: failed to create temporary file; err=%v", err)
+	}
+
+	return &LookupFileWriter{
+		filename:    filename,
+		appendRows:  appendRows,
+		tempFile:    tempFile,
+		csvWriter:   csv.NewWriter(tempFile),
+		columns:     make([]string, 0),
+		columnToIdx: make(map[string]int),
+	}, nil
+}
+
+// WriteRows stages the rows; each row has one value per column. The columns
+// may differ between calls.
+func (w *LookupFileWriter) WriteRows(columns []string, rows [][]string) error {
+	if w.tempFile == nil {
+		return fmt.Errorf("LookupFileWriter.WriteRows: writer for %v is closed", w.filename)
+	}
+
+	indices := make([]int, len(columns))
+	for i, column := range columns {
+		idx, ok := w.columnToIdx[column]
+		if !ok {
+			idx = len(w.columns)
+			w.columnToIdx[column] = idx
+			w.columns = append(w.columns, column)
+		}
+		indices[i] = idx
+	}
+
+	record := make([]string, len(w.columns))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = ""
+		}
+		for i, value := range row {
+			record[indices[i]] = value
+		}
+
+		err := w.csvWriter.Write(record)
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.WriteRows: failed to write row; err=%v", err)
+		}
+	}
+	w.numRows += uint64(len(rows))
+
+	return nil
+}
+
+// Commit writes the staged rows to the lookup file and closes the writer. If
+// there are no staged rows, an existing lookup file is left as-is, and a
+// missing one is only created when createEmpty is true.
+func (w *LookupFileWriter) Commit(createEmpty bool) error {
+	if w.tempFile == nil {
+		return fmt.Errorf("LookupFileWriter.Commit: writer for %v is closed", w.filename)
+	}
+	defer w.Close()
+
+	w.csvWriter.Flush()
+	if err := w.csvWriter.Error(); err != nil {
+		return fmt.Errorf("LookupFileWriter.Commit: failed to flush rows; err=%v", err)
+	}
+
+	lookupFilesLock.Lock()
+	defer lookupFilesLock.Unlock()
+
+	dstPath := filepath.Join(config.GetLookupPath(), w.filename)
+	_, err := os.Stat(dstPath)
+	fileExists := err == nil
+
+	if w.numRows == 0 && (fileExists || !createEmpty) {
+		return nil
+	}
+
+	outputFile, err := os.CreateTemp(config.GetLookupPath(), tempLookupFilePrefix+"*")
+	if err != nil {
+		return fmt.Errorf("LookupFileWriter.Commit: failed to create output file; err=%v", err)
+	}
+	outputPath := outputFile.Name()
+	defer os.Remove(outputPath) // This fails harmlessly after the rename.
+
+	err = w.writeLookupFile(outputFile, dstPath, w.appendRows && fileExists)
+	closeErr := outputFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("LookupFileWriter.Commit: failed to close output file; err=%v", closeErr)
+	}
+
+	err = os.Rename(outputPath, dstPath)
+	if err != nil {
+		return fmt.Errorf("LookupFileWriter.Commit: failed to replace %v; err=%v", dstPath, err)
+	}
+
+	log.Infof("LookupFileWriter.Commit: wrote %v rows to lookup file %v", w.numRows, w.filename)
+
+	return nil
+}
+
+// The caller must hold the write lock.
+func (w *LookupFileWriter) writeLookupFile(outputFile *os.File, dstPath string, appendToExisting bool) error {
+	isCSVGZ := strings.HasSuffix(strings.ToLower(w.filename), allowedExtCSVGZ)
+
+	var output io.Writer = outputFile
+	var gzipWriter *gzip.Writer
+	if isCSVGZ {
+		gzipWriter = gzip.NewWriter(outputFile)
+		output = gzipWriter
+	}
+	csvWriter := csv.NewWriter(output)
+
+	columns := w.columns
+	var existingReader *csv.Reader
+	if appendToExisting {
+		existingFile, err := os.Open(dstPath)
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to open %v; err=%v", dstPath, err)
+		}
+		defer existingFile.Close()
+
+		existingReader, err = newCSVReader(existingFile, isCSVGZ)
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to create reader for %v; err=%v", dstPath, err)
+		}
+		existingReader.FieldsPerRecord = -1
+
+		existingColumns, err := existingReader.Read()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to read column names from %v; err=%v", dstPath, err)
+		}
+
+		// Keep the existing columns first, then add any new ones.
+		columns = append([]string{}, existingColumns...)
+		for _, column := range w.columns {
+			if !utils.SliceContainsString(existingColumns, column) {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if len(columns) > 0 {
+		err := csvWriter.Write(columns)
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to write column names; err=%v", err)
+		}
+	}
+
+	if existingReader != nil {
+		err := copyCSVRows(existingReader, csvWriter, nil, len(columns))
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to copy rows from %v; err=%v", dstPath, err)
+		}
+	}
+
+	_, err := w.tempFile.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to rewind staged rows; err=%v", err)
+	}
+	stagedReader := csv.NewReader(w.tempFile)
+	stagedReader.FieldsPerRecord = -1
+
+	stagedToOutputIdx := make([]int, len(w.columns))
+	for i, column := range w.columns {
+		for j := range columns {
+			if columns[j] == column {
+				stagedToOutputIdx[i] = j
+				break
+			}
+		}
+	}
+
+	err = copyCSVRows(stagedReader, csvWriter, stagedToOutputIdx, len(columns))
+	if err != nil {
+		return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to copy staged rows; err=%v", err)
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to flush rows; err=%v", err)
+	}
+
+	if gzipWriter != nil {
+		err := gzipWriter.Close()
+		if err != nil {
+			return fmt.Errorf("LookupFileWriter.writeLookupFile: failed to finish gzip stream; err=%v", err)
+		}
+	}
+
+	return nil
+}
+
+// Copies every remaining row from the reader, padding each to numColumns. If
+// indexMapping is nil, the i-th value of each row stays at index i; otherwise
+// it moves to indexMapping[i].
+func copyCSVRows(reader *csv.Reader, writer *csv.Writer, indexMapping []int, numColumns int) error {
+	output := make([]string, numColumns)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for i := range output {
+			output[i] = ""
+		}
+		for i, value := range row {
+			idx := i
+			if indexMapping != nil {
+				idx = indexMapping[i]
+			}
+			if idx < numColumns {
+				output[idx] = value
+			}
+		}
+
+		err = writer.Write(output)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close discards any uncommitted rows. It's safe to call more than once.
+func (w *LookupFileWriter) Close() {
+	if w.tempFile == nil {
+		return
+	}
+
+	tempPath := w.tempFile.Name()
+	err := w.tempFile.Close()
+	if err != nil {
+		log.Errorf("LookupFileWriter.Close: failed to close %v; err=%v", tempPath, err)
+	}
+
+	err = os.Remove(tempPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("LookupFileWriter.Close: failed to remove %v; err=%v", tempPath, err)
+	}
+
+	w.tempFile = nil
+	w.csvWriter = nil
+}
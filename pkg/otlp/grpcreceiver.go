@@ -0,0 +1,163 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/usageStats"
+	log "github.com/sirupsen/logrus"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Registers the gzip decompressor used by most OTLP exporters.
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP exporters batch aggressively, so allow requests larger than the gRPC
+// default of 4MB.
+const grpcMaxRecvMsgSize = 64 * 1024 * 1024
+
+type traceServiceServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+	orgId uint64
+}
+
+type logsServiceServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	orgId uint64
+}
+
+type metricsServiceServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	orgId uint64
+}
+
+// Creates a gRPC server with the OTLP trace, logs and metrics services
+// registered. Everything is ingested for the given org; unlike the HTTP
+// handlers, requests don't go through OverrideIngestRequestHook, since it
+// needs a fasthttp request. So the receiver is only for single-tenant
+// deployments.
+func NewGrpcServer(orgId uint64) (*grpclib.Server, error) {
+	options := []grpclib.ServerOption{grpclib.MaxRecvMsgSize(grpcMaxRecvMsgSize)}
+	if config.IsTlsEnabled() {
+		creds, err := credentials.NewServerTLSFromFile(config.GetTLSCertificatePath(), config.GetTLSPrivateKeyPath())
+		if err != nil {
+			return nil, fmt.Errorf("NewGrpcServer: failed to load TLS credentials; err=%v", err)
+		}
+		options = append(options, grpclib.Creds(creds))
+	}
+
+	server := grpclib.NewServer(options...)
+	coltracepb.RegisterTraceServiceServer(server, &traceServiceServer{orgId: orgId})
+	collogspb.RegisterLogsServiceServer(server, &logsServiceServer{orgId: orgId})
+	colmetricspb.RegisterMetricsServiceServer(server, &metricsServiceServer{orgId: orgId})
+
+	return server, nil
+}
+
+// Listens on the address and serves OTLP over gRPC until the server is
+// stopped. Returns an error if the address can't be listened on.
+func RunGrpcServer(addr string) error {
+	server, err := NewGrpcServer(0)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("RunGrpcServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return server.Serve(listener)
+}
+
+func (s *traceServiceServer) Export(ctx context.Context, request *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	numSpans, numFailedSpans := IngestTracesRequest(request, s.orgId)
+
+	log.Debugf("traceServiceServer.Export: %v spans in the request and failed to ingest %v of them", numSpans, numFailedSpans)
+	usageStats.UpdateTracesStats(uint64(proto.Size(request)), uint64(numSpans), s.orgId)
+
+	err := getGrpcExportError(numSpans, numFailedSpans, "span")
+	if err != nil {
+		return nil, err
+	}
+
+	response := &coltracepb.ExportTraceServiceResponse{}
+	if numFailedSpans > 0 {
+		response.PartialSuccess = &coltracepb.ExportTracePartialSuccess{RejectedSpans: int64(numFailedSpans)}
+	}
+
+	return response, nil
+}
+
+func (s *logsServiceServer) Export(ctx context.Context, request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	numRecords, numFailedRecords := IngestLogsRequest(request, s.orgId)
+
+	log.Debugf("logsServiceServer.Export: %v log records in the request and failed to ingest %v of them", numRecords, numFailedRecords)
+	usageStats.UpdateStats(uint64(proto.Size(request)), uint64(numRecords-numFailedRecords), s.orgId)
+
+	err := getGrpcExportError(numRecords, numFailedRecords, "log record")
+	if err != nil {
+		return nil, err
+	}
+
+	response := &collogspb.ExportLogsServiceResponse{}
+	if numFailedRecords > 0 {
+		response.PartialSuccess = &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: int64(numFailedRecords)}
+	}
+
+	return response, nil
+}
+
+func (s *metricsServiceServer) Export(ctx context.Context, request *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	numDataPoints, numFailedDataPoints := IngestMetricsRequest(request, s.orgId)
+
+	log.Debugf("metricsServiceServer.Export: %v data points in the request and failed to ingest %v of them", numDataPoints, numFailedDataPoints)
+	usageStats.UpdateMetricsStats(uint64(proto.Size(request)), uint64(numDataPoints-numFailedDataPoints), s.orgId)
+
+	err := getGrpcExportError(numDataPoints, numFailedDataPoints, "data point")
+	if err != nil {
+		return nil, err
+	}
+
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if numFailedDataPoints > 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{RejectedDataPoints: int64(numFailedDataPoints)}
+	}
+
+	return response, nil
+}
+
+// Matches writeExportResponse: a request is only rejected when every item in
+// it failed, otherwise the failures are reported as a partial success.
+func getGrpcExportError(numItems int, numFailedItems int, itemName string) error {
+	if numItems > 0 && numFailedItems >= numItems {
+		log.Errorf("getGrpcExportError: every %v failed ingestion. NumItems: %d, NumFailedItems: %d", itemName, numItems, numFailedItems)
+		return status.Errorf(codes.Internal, "Every %v failed ingestion", itemName)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/stretchr/testify/assert"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_GrpcServer_EmptyRequests(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	server, err := NewGrpcServer(0)
+	assert.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpclib.DialContext(context.Background(), "bufnet",
+		grpclib.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpclib.WithTransportCredentials(insecure.NewCredentials()),
+		grpclib.WithDefaultCallOptions(grpclib.UseCompressor(gzip.Name)),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	traceResponse, err := coltracepb.NewTraceServiceClient(conn).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{})
+	assert.NoError(t, err)
+	assert.Nil(t, traceResponse.PartialSuccess)
+
+	logsResponse, err := collogspb.NewLogsServiceClient(conn).Export(context.Background(), &collogspb.ExportLogsServiceRequest{})
+	assert.NoError(t, err)
+	assert.Nil(t, logsResponse.PartialSuccess)
+
+	metricsResponse, err := colmetricspb.NewMetricsServiceClient(conn).Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{})
+	assert.NoError(t, err)
+	assert.Nil(t, metricsResponse.PartialSuccess)
+}
+
+func Test_GetGrpcExportError(t *testing.T) {
+	assert.NoError(t, getGrpcExportError(0, 0, "span"))
+	assert.NoError(t, getGrpcExportError(3, 2, "span"))
+
+	err := getGrpcExportError(3, 3, "span")
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
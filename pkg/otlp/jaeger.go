@@ -0,0 +1,383 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/siglens/siglens/pkg/grpc"
+	"github.com/siglens/siglens/pkg/hooks"
+	"github.com/siglens/siglens/pkg/usageStats"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Values of the Jaeger TagType enum.
+const (
+	jaegerTagString int32 = 0
+	jaegerTagDouble int32 = 1
+	jaegerTagBool   int32 = 2
+	jaegerTagLong   int32 = 3
+	jaegerTagBinary int32 = 4
+)
+
+// Values of the Jaeger SpanRefType enum.
+const (
+	jaegerRefChildOf     int32 = 0
+	jaegerRefFollowsFrom int32 = 1
+)
+
+type jaegerTag struct {
+	key       string
+	valueType int32
+	vStr      string
+	vDouble   float64
+	vBool     bool
+	vLong     int64
+	vBinary   []byte
+}
+
+type jaegerLog struct {
+	timestamp int64
+	fields    []jaegerTag
+}
+
+type jaegerSpanRef struct {
+	refType     int32
+	traceIdLow  int64
+	traceIdHigh int64
+	spanId      int64
+}
+
+type jaegerSpan struct {
+	traceIdLow    int64
+	traceIdHigh   int64
+	spanId        int64
+	parentSpanId  int64
+	operationName string
+	references    []jaegerSpanRef
+	startTime     int64
+	duration      int64
+	tags          []jaegerTag
+	logs          []jaegerLog
+}
+
+type jaegerBatch struct {
+	serviceName string
+	processTags []jaegerTag
+	spans       []jaegerSpan
+}
+
+// Handles spans sent by Jaeger clients as a Thrift-encoded batch over HTTP.
+// The spans are converted to OTLP spans so they're stored the same way as
+// spans sent to ProcessTraceIngest.
+func ProcessJaegerTraceIngest(ctx *fasthttp.RequestCtx, myid uint64) {
+	if hook := hooks.GlobalHooks.OverrideIngestRequestHook; hook != nil {
+		alreadyHandled := hook(ctx, myid, grpc.INGEST_FUNC_JAEGER_TRACES, false)
+		if alreadyHandled {
+			return
+		}
+	}
+
+	contentType := string(ctx.Request.Header.Peek("Content-Type"))
+	if contentType != "application/x-thrift" && contentType != "application/vnd.apache.thrift.binary" {
+		log.Infof("ProcessJaegerTraceIngest: got an unsupported request. Got Content-Type: %s", contentType)
+		setTextFailureResponse(ctx, fasthttp.StatusUnsupportedMediaType, "Expected a Thrift request")
+		return
+	}
+
+	data, err := getRequestBody(ctx)
+	if err != nil {
+		setTextFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data")
+		return
+	}
+
+	batch, err := unmarshalJaegerBatch(data)
+	if err != nil {
+		log.Errorf("ProcessJaegerTraceIngest: failed to unpack batch; err=%v", err)
+		setTextFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to unmarshal Jaeger batch")
+		return
+	}
+
+	request := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{jaegerBatchToResourceSpans(batch)},
+	}
+	numSpans, numFailedSpans := IngestTracesRequest(request, myid)
+
+	log.Debugf("ProcessJaegerTraceIngest: %v spans in the request and failed to ingest %v of them", numSpans, numFailedSpans)
+	usageStats.UpdateTracesStats(uint64(len(data)), uint64(numSpans), myid)
+	handleAcceptedTraceResponse(ctx, numSpans, numFailedSpans)
+}
+
+func unmarshalJaegerBatch(data []byte) (*jaegerBatch, error) {
+	reader := newThriftReader(data)
+	batch := &jaegerBatch{}
+	err := reader.readStruct(func(fieldType byte, fieldId int16) error {
+		switch {
+		case fieldId == 1 && fieldType == thriftStruct:
+			return reader.readStruct(func(fieldType byte, fieldId int16) error {
+				var err error
+				switch {
+				case fieldId == 1 && fieldType == thriftString:
+					batch.serviceName, err = reader.readString()
+				case fieldId == 2 && fieldType == thriftList:
+					batch.processTags, err = readJaegerTags(reader)
+				default:
+					err = reader.skip(fieldType)
+				}
+				return err
+			})
+		case fieldId == 2 && fieldType == thriftList:
+			return reader.readList(thriftStruct, func() error {
+				span, err := readJaegerSpan(reader)
+				if err != nil {
+					return err
+				}
+				batch.spans = append(batch.spans, span)
+				return nil
+			})
+		default:
+			return reader.skip(fieldType)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalJaegerBatch: failed to read batch; err=%v", err)
+	}
+
+	return batch, nil
+}
+
+func readJaegerSpan(reader *thriftReader) (jaegerSpan, error) {
+	var span jaegerSpan
+	err := reader.readStruct(func(fieldType byte, fieldId int16) error {
+		var err error
+		switch {
+		case fieldId == 1 && fieldType == thriftI64:
+			span.traceIdLow, err = reader.readI64()
+		case fieldId == 2 && fieldType == thriftI64:
+			span.traceIdHigh, err = reader.readI64()
+		case fieldId == 3 && fieldType == thriftI64:
+			span.spanId, err = reader.readI64()
+		case fieldId == 4 && fieldType == thriftI64:
+			span.parentSpanId, err = reader.readI64()
+		case fieldId == 5 && fieldType == thriftString:
+			span.operationName, err = reader.readString()
+		case fieldId == 6 && fieldType == thriftList:
+			err = reader.readList(thriftStruct, func() error {
+				ref, err := readJaegerSpanRef(reader)
+				span.references = append(span.references, ref)
+				return err
+			})
+		case fieldId == 8 && fieldType == thriftI64:
+			span.startTime, err = reader.readI64()
+		case fieldId == 9 && fieldType == thriftI64:
+			span.duration, err = reader.readI64()
+		case fieldId == 10 && fieldType == thriftList:
+			span.tags, err = readJaegerTags(reader)
+		case fieldId == 11 && fieldType == thriftList:
+			err = reader.readList(thriftStruct, func() error {
+				var spanLog jaegerLog
+				err := reader.readStruct(func(fieldType byte, fieldId int16) error {
+					var err error
+					switch {
+					case fieldId == 1 && fieldType == thriftI64:
+						spanLog.timestamp, err = reader.readI64()
+					case fieldId == 2 && fieldType == thriftList:
+						spanLog.fields, err = readJaegerTags(reader)
+					default:
+						err = reader.skip(fieldType)
+					}
+					return err
+				})
+				span.logs = append(span.logs, spanLog)
+				return err
+			})
+		default:
+			err = reader.skip(fieldType)
+		}
+		return err
+	})
+
+	return span, err
+}
+
+func readJaegerSpanRef(reader *thriftReader) (jaegerSpanRef, error) {
+	var ref jaegerSpanRef
+	err := reader.readStruct(func(fieldType byte, fieldId int16) error {
+		var err error
+		switch {
+		case fieldId == 1 && fieldType == thriftI32:
+			ref.refType, err = reader.readI32()
+		case fieldId == 2 && fieldType == thriftI64:
+			ref.traceIdLow, err = reader.readI64()
+		case fieldId == 3 && fieldType == thriftI64:
+			ref.traceIdHigh, err = reader.readI64()
+		case fieldId == 4 && fieldType == thriftI64:
+			ref.spanId, err = reader.readI64()
+		default:
+			err = reader.skip(fieldType)
+		}
+		return err
+	})
+
+	return ref, err
+}
+
+func readJaegerTags(reader *thriftReader) ([]jaegerTag, error) {
+	tags := make([]jaegerTag, 0)
+	err := reader.readList(thriftStruct, func() error {
+		var tag jaegerTag
+		err := reader.readStruct(func(fieldType byte, fieldId int16) error {
+			var err error
+			switch {
+			case fieldId == 1 && fieldType == thriftString:
+				tag.key, err = reader.readString()
+			case fieldId == 2 && fieldType == thriftI32:
+				tag.valueType, err = reader.readI32()
+			case fieldId == 3 && fieldType == thriftString:
+				tag.vStr, err = reader.readString()
+			case fieldId == 4 && fieldType == thriftDouble:
+				tag.vDouble, err = reader.readDouble()
+			case fieldId == 5 && fieldType == thriftBool:
+				tag.vBool, err = reader.readBool()
+			case fieldId == 6 && fieldType == thriftI64:
+				tag.vLong, err = reader.readI64()
+			case fieldId == 7 && fieldType == thriftString:
+				tag.vBinary, err = reader.readBinary()
+			default:
+				err = reader.skip(fieldType)
+			}
+			return err
+		})
+		tags = append(tags, tag)
+		return err
+	})
+
+	return tags, err
+}
+
+func jaegerBatchToResourceSpans(batch *jaegerBatch) *tracepb.ResourceSpans {
+	resourceAttributes := []*commonpb.KeyValue{stringAttribute("service.name", batch.serviceName)}
+	resourceAttributes = append(resourceAttributes, jaegerTagsToAttributes(batch.processTags)...)
+
+	spans := make([]*tracepb.Span, 0, len(batch.spans))
+	for i := range batch.spans {
+		spans = append(spans, jaegerSpanToSpan(&batch.spans[i]))
+	}
+
+	return &tracepb.ResourceSpans{
+		Resource:   &resourcepb.Resource{Attributes: resourceAttributes},
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+	}
+}
+
+func jaegerSpanToSpan(jaegerSpan *jaegerSpan) *tracepb.Span {
+	startTimeNano := uint64(jaegerSpan.startTime) * 1000
+	span := &tracepb.Span{
+		TraceId:           jaegerTraceId(jaegerSpan.traceIdHigh, jaegerSpan.traceIdLow),
+		SpanId:            jaegerSpanId(jaegerSpan.spanId),
+		Name:              jaegerSpan.operationName,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: startTimeNano,
+		EndTimeUnixNano:   startTimeNano + uint64(jaegerSpan.duration)*1000,
+		Attributes:        jaegerTagsToAttributes(jaegerSpan.tags),
+	}
+
+	// Newer clients may only give the parent as a CHILD_OF reference. The
+	// other references become links.
+	parentSpanId := jaegerSpan.parentSpanId
+	for _, ref := range jaegerSpan.references {
+		isParent := ref.refType == jaegerRefChildOf && ref.traceIdLow == jaegerSpan.traceIdLow &&
+			ref.traceIdHigh == jaegerSpan.traceIdHigh && (parentSpanId == 0 || parentSpanId == ref.spanId)
+		if isParent {
+			parentSpanId = ref.spanId
+			continue
+		}
+
+		refType := "child_of"
+		if ref.refType == jaegerRefFollowsFrom {
+			refType = "follows_from"
+		}
+		span.Links = append(span.Links, &tracepb.Span_Link{
+			TraceId:    jaegerTraceId(ref.traceIdHigh, ref.traceIdLow),
+			SpanId:     jaegerSpanId(ref.spanId),
+			Attributes: []*commonpb.KeyValue{stringAttribute("opentracing.ref_type", refType)},
+		})
+	}
+	if parentSpanId != 0 {
+		span.ParentSpanId = jaegerSpanId(parentSpanId)
+	}
+
+	for _, spanLog := range jaegerSpan.logs {
+		event := &tracepb.Span_Event{TimeUnixNano: uint64(spanLog.timestamp) * 1000}
+		for _, field := range spanLog.fields {
+			if field.key == "event" && field.valueType == jaegerTagString {
+				event.Name = field.vStr
+				continue
+			}
+			event.Attributes = append(event.Attributes, jaegerTagToAttribute(field))
+		}
+		span.Events = append(span.Events, event)
+	}
+
+	setSpanKindAndStatusFromTags(span)
+	return span
+}
+
+func jaegerTraceId(high int64, low int64) []byte {
+	traceId := make([]byte, 16)
+	binary.BigEndian.PutUint64(traceId[:8], uint64(high))
+	binary.BigEndian.PutUint64(traceId[8:], uint64(low))
+	return traceId
+}
+
+func jaegerSpanId(spanId int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(spanId))
+}
+
+func jaegerTagsToAttributes(tags []jaegerTag) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(tags))
+	for _, tag := range tags {
+		attributes = append(attributes, jaegerTagToAttribute(tag))
+	}
+
+	return attributes
+}
+
+func jaegerTagToAttribute(tag jaegerTag) *commonpb.KeyValue {
+	value := &commonpb.AnyValue{}
+	switch tag.valueType {
+	case jaegerTagDouble:
+		value.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: tag.vDouble}
+	case jaegerTagBool:
+		value.Value = &commonpb.AnyValue_BoolValue{BoolValue: tag.vBool}
+	case jaegerTagLong:
+		value.Value = &commonpb.AnyValue_IntValue{IntValue: tag.vLong}
+	case jaegerTagBinary:
+		value.Value = &commonpb.AnyValue_BytesValue{BytesValue: tag.vBinary}
+	default:
+		value.Value = &commonpb.AnyValue_StringValue{StringValue: tag.vStr}
+	}
+
+	return &commonpb.KeyValue{Key: tag.key, Value: value}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Builds Thrift binary protocol data for tests.
+type thriftWriter struct {
+	buf []byte
+}
+
+func (w *thriftWriter) field(fieldType byte, fieldId int16) *thriftWriter {
+	w.buf = append(w.buf, fieldType)
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(fieldId))
+	return w
+}
+
+func (w *thriftWriter) stop() *thriftWriter {
+	w.buf = append(w.buf, thriftStop)
+	return w
+}
+
+func (w *thriftWriter) i32(value int32) *thriftWriter {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(value))
+	return w
+}
+
+func (w *thriftWriter) i64(value int64) *thriftWriter {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(value))
+	return w
+}
+
+func (w *thriftWriter) str(value string) *thriftWriter {
+	w.i32(int32(len(value)))
+	w.buf = append(w.buf, value...)
+	return w
+}
+
+func (w *thriftWriter) list(elemType byte, size int32) *thriftWriter {
+	w.buf = append(w.buf, elemType)
+	return w.i32(size)
+}
+
+func (w *thriftWriter) stringTag(key string, value string) *thriftWriter {
+	return w.field(thriftString, 1).str(key).field(thriftI32, 2).i32(jaegerTagString).field(thriftString, 3).str(value).stop()
+}
+
+func (w *thriftWriter) boolTag(key string, value bool) *thriftWriter {
+	w.field(thriftString, 1).str(key).field(thriftI32, 2).i32(jaegerTagBool).field(thriftBool, 5)
+	if value {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+	return w.stop()
+}
+
+func Test_UnmarshalJaegerBatch(t *testing.T) {
+	w := &thriftWriter{}
+	// Process
+	w.field(thriftStruct, 1).
+		field(thriftString, 1).str("frontend").
+		field(thriftList, 2).list(thriftStruct, 1).stringTag("hostname", "host1").
+		stop()
+	// Spans
+	w.field(thriftList, 2).list(thriftStruct, 1).
+		field(thriftI64, 1).i64(2).
+		field(thriftI64, 2).i64(1).
+		field(thriftI64, 3).i64(0x0a).
+		field(thriftI64, 4).i64(0).
+		field(thriftString, 5).str("GET /api").
+		field(thriftList, 6).list(thriftStruct, 2).
+		field(thriftI32, 1).i32(jaegerRefChildOf).field(thriftI64, 2).i64(2).field(thriftI64, 3).i64(1).field(thriftI64, 4).i64(0x09).stop().
+		field(thriftI32, 1).i32(jaegerRefFollowsFrom).field(thriftI64, 2).i64(3).field(thriftI64, 3).i64(0).field(thriftI64, 4).i64(0x08).stop().
+		field(thriftI32, 7).i32(1).
+		field(thriftI64, 8).i64(1_700_000_000_000_000).
+		field(thriftI64, 9).i64(2500).
+		field(thriftList, 10).list(thriftStruct, 3).
+		stringTag("span.kind", "client").
+		boolTag("error", true).
+		field(thriftString, 1).str("attempt").field(thriftI32, 2).i32(jaegerTagDouble).field(thriftDouble, 4).i64(int64(math.Float64bits(1.5))).stop().
+		field(thriftList, 11).list(thriftStruct, 1).
+		field(thriftI64, 1).i64(1_700_000_000_001_000).
+		field(thriftList, 2).list(thriftStruct, 2).stringTag("event", "retry").stringTag("reason", "timeout").
+		stop().
+		// An unknown field is skipped.
+		field(thriftMap, 99).i32(0).i32(0).
+		stop()
+	w.field(thriftI64, 3).i64(7).stop()
+
+	batch, err := unmarshalJaegerBatch(w.buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "frontend", batch.serviceName)
+	assert.Len(t, batch.spans, 1)
+
+	resourceSpans := jaegerBatchToResourceSpans(batch)
+	assert.Equal(t, []*commonpb.KeyValue{stringAttribute("service.name", "frontend"), stringAttribute("hostname", "host1")},
+		resourceSpans.Resource.Attributes)
+
+	span := resourceSpans.ScopeSpans[0].Spans[0]
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}, span.TraceId)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0x0a}, span.SpanId)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0x09}, span.ParentSpanId)
+	assert.Equal(t, "GET /api", span.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, span.Kind)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	assert.Equal(t, uint64(1_700_000_000_000_000_000), span.StartTimeUnixNano)
+	assert.Equal(t, uint64(1_700_000_000_002_500_000), span.EndTimeUnixNano)
+	assert.Equal(t, []*commonpb.KeyValue{
+		{Key: "error", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+		{Key: "attempt", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}}},
+	}, span.Attributes)
+	assert.Equal(t, []*tracepb.Span_Event{{
+		TimeUnixNano: 1_700_000_000_001_000_000,
+		Name:         "retry",
+		Attributes:   []*commonpb.KeyValue{stringAttribute("reason", "timeout")},
+	}}, span.Events)
+	assert.Equal(t, []*tracepb.Span_Link{{
+		TraceId:    []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3},
+		SpanId:     []byte{0, 0, 0, 0, 0, 0, 0, 0x08},
+		Attributes: []*commonpb.KeyValue{stringAttribute("opentracing.ref_type", "follows_from")},
+	}}, span.Links)
+}
+
+func Test_UnmarshalJaegerBatch_Invalid(t *testing.T) {
+	// Truncated string
+	w := &thriftWriter{}
+	w.field(thriftStruct, 1).field(thriftString, 1).i32(100)
+	_, err := unmarshalJaegerBatch(w.buf)
+	assert.Error(t, err)
+
+	// Huge list size
+	w = &thriftWriter{}
+	w.field(thriftList, 2).list(thriftStruct, math.MaxInt32)
+	_, err = unmarshalJaegerBatch(w.buf)
+	assert.Error(t, err)
+
+	// Deeply nested unknown fields
+	w = &thriftWriter{}
+	for i := 0; i < 2*maxThriftDepth; i++ {
+		w.field(thriftStruct, 50)
+	}
+	_, err = unmarshalJaegerBatch(w.buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/es/writer"
+	"github.com/siglens/siglens/pkg/grpc"
+	"github.com/siglens/siglens/pkg/hooks"
+	"github.com/siglens/siglens/pkg/usageStats"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const otlpLogsIndexName = "otel-logs"
+
+// Handles OTLP/HTTP logs sent as protobuf or JSON. Each log record is
+// ingested as one event in the otel-logs index.
+func ProcessLogIngest(ctx *fasthttp.RequestCtx, myid uint64) {
+	if hook := hooks.GlobalHooks.OverrideIngestRequestHook; hook != nil {
+		alreadyHandled := hook(ctx, myid, grpc.INGEST_FUNC_OTLP_LOGS, false)
+		if alreadyHandled {
+			return
+		}
+	}
+
+	data, isJson, ok := readRequestBody(ctx, "ProcessLogIngest")
+	if !ok {
+		return
+	}
+
+	request, err := unmarshalLogsRequest(data, isJson)
+	if err != nil {
+		log.Errorf("ProcessLogIngest: failed to unpack data: %s with err %v", string(data), err)
+		setEncodedFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to unmarshal logs", isJson)
+		return
+	}
+
+	numRecords, numFailedRecords := IngestLogsRequest(request, myid)
+
+	log.Debugf("ProcessLogIngest: %v log records in the request and failed to ingest %v of them", numRecords, numFailedRecords)
+	usageStats.UpdateStats(uint64(len(data)), uint64(numRecords-numFailedRecords), myid)
+
+	handleLogIngestionResponse(ctx, numRecords, numFailedRecords, isJson)
+}
+
+// Writes each log record in the request through the same segment writer used
+// by ES bulk. Returns the number of log records and how many of them failed.
+func IngestLogsRequest(request *collogspb.ExportLogsServiceRequest, myid uint64) (int, int) {
+	now := utils.GetCurrentTimeInMs()
+	localIndexMap := make(map[string]string)
+	idxToStreamIdCache := make(map[string]string)
+	cnameCacheByteHashToStr := make(map[uint64]string)
+	var jsParsingStackbuf [utils.UnescapeStackBufSize]byte
+
+	numRecords := 0
+	numFailedRecords := 0
+	for _, resourceLogs := range request.ResourceLogs {
+		resourceFields := make(map[string]interface{})
+		if resourceLogs.Resource != nil {
+			addAttributes(resourceFields, resourceLogs.Resource.Attributes)
+		}
+
+		for _, scopeLogs := range resourceLogs.ScopeLogs {
+			scopeFields := make(map[string]interface{}, len(resourceFields))
+			for key, value := range resourceFields {
+				scopeFields[key] = value
+			}
+			if scopeLogs.Scope != nil {
+				if scopeLogs.Scope.Name != "" {
+					scopeFields["scope.name"] = scopeLogs.Scope.Name
+				}
+				if scopeLogs.Scope.Version != "" {
+					scopeFields["scope.version"] = scopeLogs.Scope.Version
+				}
+				addAttributes(scopeFields, scopeLogs.Scope.Attributes)
+			}
+
+			numRecords += len(scopeLogs.LogRecords)
+			for _, logRecord := range scopeLogs.LogRecords {
+				jsonData, err := logRecordToJson(logRecord, scopeFields)
+				if err != nil {
+					log.Errorf("IngestLogsRequest: failed to convert log record %v to JSON; err=%v", logRecord, err)
+					numFailedRecords++
+					continue
+				}
+
+				err = writer.ProcessIndexRequest(jsonData, now, otlpLogsIndexName, uint64(len(jsonData)), false, localIndexMap, myid, 0, idxToStreamIdCache, cnameCacheByteHashToStr, jsParsingStackbuf[:])
+				if err != nil {
+					log.Errorf("IngestLogsRequest: failed to process ingest request; err=%v. JSON Data: %s", err, string(jsonData))
+					numFailedRecords++
+					continue
+				}
+			}
+		}
+	}
+
+	return numRecords, numFailedRecords
+}
+
+// Flattens the log record and the resource and scope fields into one event.
+// Log record attributes take precedence over scope and resource attributes
+// with the same key.
+func logRecordToJson(logRecord *logspb.LogRecord, scopeFields map[string]interface{}) ([]byte, error) {
+	result := make(map[string]interface{}, len(scopeFields)+len(logRecord.Attributes)+8)
+	for key, value := range scopeFields {
+		result[key] = value
+	}
+
+	addAttributes(result, logRecord.Attributes)
+
+	timeUnixNano := logRecord.TimeUnixNano
+	if timeUnixNano == 0 {
+		timeUnixNano = logRecord.ObservedTimeUnixNano
+	}
+	if timeUnixNano != 0 {
+		result[config.GetTimeStampKey()] = timeUnixNano / 1_000_000
+	}
+
+	if logRecord.Body != nil && logRecord.Body.Value != nil {
+		body, err := extractAnyValue(logRecord.Body)
+		if err != nil {
+			return nil, fmt.Errorf("logRecordToJson: failed to extract body; err=%v", err)
+		}
+		result["body"] = body
+	}
+
+	if logRecord.SeverityText != "" {
+		result["severity_text"] = logRecord.SeverityText
+	}
+	if logRecord.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		result["severity_number"] = int32(logRecord.SeverityNumber)
+	}
+	if len(logRecord.TraceId) > 0 {
+		result["trace_id"] = hex.EncodeToString(logRecord.TraceId)
+	}
+	if len(logRecord.SpanId) > 0 {
+		result["span_id"] = hex.EncodeToString(logRecord.SpanId)
+	}
+	if logRecord.Flags != 0 {
+		result["flags"] = logRecord.Flags
+	}
+	if logRecord.DroppedAttributesCount != 0 {
+		result["dropped_attributes_count"] = logRecord.DroppedAttributesCount
+	}
+
+	return json.Marshal(result)
+}
+
+// Attributes without a value, or with a value that can't be extracted, are
+// skipped so one bad attribute doesn't drop the whole log record.
+func addAttributes(fields map[string]interface{}, attributes []*commonpb.KeyValue) {
+	for _, keyvalue := range attributes {
+		if keyvalue.Value == nil || keyvalue.Value.Value == nil {
+			continue
+		}
+
+		key, value, err := extractKeyValue(keyvalue)
+		if err != nil {
+			continue
+		}
+
+		fields[key] = value
+	}
+}
+
+func unmarshalLogsRequest(data []byte, isJson bool) (*collogspb.ExportLogsServiceRequest, error) {
+	var request collogspb.ExportLogsServiceRequest
+	if !isJson {
+		err := proto.Unmarshal(data, &request)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalLogsRequest: failed to unmarshal protobuf; err=%v", err)
+		}
+		return &request, nil
+	}
+
+	data, err := convertJsonIdsToBase64(data)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalLogsRequest: %v", err)
+	}
+
+	err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, &request)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalLogsRequest: failed to unmarshal JSON; err=%v", err)
+	}
+
+	return &request, nil
+}
+
+// OTLP/JSON encodes trace and span IDs as hex strings instead of the base64
+// that protojson expects for bytes fields, so convert them before unmarshaling.
+func convertJsonIdsToBase64(data []byte) ([]byte, error) {
+	var request map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&request)
+	if err != nil {
+		return nil, fmt.Errorf("convertJsonIdsToBase64: invalid JSON; err=%v", err)
+	}
+
+	for _, resourceLogs := range getJsonArray(request, "resourceLogs", "resource_logs") {
+		for _, scopeLogs := range getJsonArray(resourceLogs, "scopeLogs", "scope_logs") {
+			for _, logRecord := range getJsonArray(scopeLogs, "logRecords", "log_records") {
+				for _, key := range []string{"traceId", "trace_id", "spanId", "span_id"} {
+					hexId, ok := logRecord[key].(string)
+					if !ok || hexId == "" {
+						continue
+					}
+
+					id, err := hex.DecodeString(hexId)
+					if err != nil {
+						return nil, fmt.Errorf("convertJsonIdsToBase64: invalid %v %v; err=%v", key, hexId, err)
+					}
+					logRecord[key] = base64.StdEncoding.EncodeToString(id)
+				}
+			}
+		}
+	}
+
+	return json.Marshal(request)
+}
+
+// Returns the objects in the array at the first key that's present.
+func getJsonArray(object map[string]interface{}, keys ...string) []map[string]interface{} {
+	for _, key := range keys {
+		array, ok := object[key].([]interface{})
+		if !ok {
+			continue
+		}
+
+		objects := make([]map[string]interface{}, 0, len(array))
+		for _, element := range array {
+			if elementObject, ok := element.(map[string]interface{}); ok {
+				objects = append(objects, elementObject)
+			}
+		}
+		return objects
+	}
+
+	return nil
+}
+
+func handleLogIngestionResponse(ctx *fasthttp.RequestCtx, numRecords int, numFailedRecords int, isJson bool) {
+	logsResponse := &collogspb.ExportLogsServiceResponse{}
+	if numFailedRecords > 0 {
+		logsResponse.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: int64(numFailedRecords),
+		}
+	}
+
+	writeExportResponse(ctx, logsResponse, numRecords, numFailedRecords, "log record", isJson)
+}
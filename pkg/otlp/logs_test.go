@@ -0,0 +1,162 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringKeyValue(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func Test_LogRecordToJson(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	logRecord := &logspb.LogRecord{
+		TimeUnixNano:   1_700_000_000_123_456_789,
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+		SeverityText:   "WARN",
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "login failed"}},
+		Attributes: []*commonpb.KeyValue{
+			stringKeyValue("user", "alice"),
+			stringKeyValue("env", "override"),
+			{Key: "attempts", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 3}}},
+		},
+		TraceId: []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+		SpanId:  []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+	}
+	scopeFields := map[string]interface{}{"service.name": "auth", "env": "prod", "scope.name": "authlib"}
+
+	jsonData, err := logRecordToJson(logRecord, scopeFields)
+	assert.NoError(t, err)
+
+	var result map[string]interface{}
+	err = json.Unmarshal(jsonData, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		config.GetTimeStampKey(): float64(1_700_000_000_123),
+		"service.name":           "auth",
+		"scope.name":             "authlib",
+		"env":                    "override",
+		"user":                   "alice",
+		"attempts":               float64(3),
+		"body":                   "login failed",
+		"severity_text":          "WARN",
+		"severity_number":        float64(13),
+		"trace_id":               "5b8efff798038103d269b633813fc60c",
+		"span_id":                "eee19b7ec3c1b174",
+	}, result)
+}
+
+func Test_LogRecordToJson_StructuredBody(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	logRecord := &logspb.LogRecord{
+		ObservedTimeUnixNano: 2_000_000,
+		Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+			Values: []*commonpb.KeyValue{stringKeyValue("event", "logout")},
+		}}},
+	}
+
+	jsonData, err := logRecordToJson(logRecord, map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"`+config.GetTimeStampKey()+`": 2, "body": {"event": "logout"}}`, string(jsonData))
+}
+
+func Test_UnmarshalLogsRequest_Json(t *testing.T) {
+	data := []byte(`{
+		"resourceLogs": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "auth"}}]},
+			"scopeLogs": [{
+				"scope": {"name": "authlib"},
+				"logRecords": [{
+					"timeUnixNano": "1700000000123456789",
+					"severityNumber": 9,
+					"severityText": "INFO",
+					"body": {"stringValue": "login ok"},
+					"traceId": "5B8EFFF798038103D269B633813FC60C",
+					"spanId": "eee19b7ec3c1b174"
+				}]
+			}]
+		}]
+	}`)
+
+	request, err := unmarshalLogsRequest(data, true)
+	assert.NoError(t, err)
+	assert.Len(t, request.ResourceLogs, 1)
+	assert.Len(t, request.ResourceLogs[0].ScopeLogs, 1)
+
+	logRecord := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, uint64(1700000000123456789), logRecord.TimeUnixNano)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, logRecord.SeverityNumber)
+	assert.Equal(t, "login ok", logRecord.Body.GetStringValue())
+	assert.Equal(t, []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c}, logRecord.TraceId)
+	assert.Equal(t, []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74}, logRecord.SpanId)
+
+	_, err = unmarshalLogsRequest([]byte(`{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"traceId": "xyz"}]}]}]}`), true)
+	assert.Error(t, err)
+
+	_, err = unmarshalLogsRequest([]byte(`not json`), true)
+	assert.Error(t, err)
+}
+
+func Test_UnmarshalLogsRequest_Protobuf(t *testing.T) {
+	original := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			ScopeLogs: []*logspb.ScopeLogs{{
+				LogRecords: []*logspb.LogRecord{{SeverityText: "ERROR"}},
+			}},
+		}},
+	}
+	data, err := proto.Marshal(original)
+	assert.NoError(t, err)
+
+	request, err := unmarshalLogsRequest(data, false)
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(original, request))
+}
+
+func Test_HandleLogIngestionResponse(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	handleLogIngestionResponse(ctx, 3, 1, true)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+
+	var response collogspb.ExportLogsServiceResponse
+	err := protojson.Unmarshal(ctx.Response.Body(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.PartialSuccess.RejectedLogRecords)
+
+	ctx = &fasthttp.RequestCtx{}
+	handleLogIngestionResponse(ctx, 2, 2, false)
+	assert.Equal(t, fasthttp.StatusInternalServerError, ctx.Response.StatusCode())
+
+	ctx = &fasthttp.RequestCtx{}
+	handleLogIngestionResponse(ctx, 0, 0, false)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+}
@@ -0,0 +1,531 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/siglens/siglens/pkg/grpc"
+	"github.com/siglens/siglens/pkg/hooks"
+	segutils "github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/siglens/siglens/pkg/segment/writer"
+	"github.com/siglens/siglens/pkg/usageStats"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// One point of one series, in the format the metrics writer accepts.
+type metricSample struct {
+	Metric    string            `json:"metric"`
+	Tags      map[string]string `json:"tags"`
+	Timestamp uint64            `json:"timestamp"`
+	Value     float64           `json:"value"`
+}
+
+// Running totals for series received with delta temporality, so they can be
+// stored as cumulative series like everything else. The totals are only kept
+// in memory, so they restart from zero when the server restarts; queries
+// should use rate() or increase(), which treat that like a counter reset. A
+// series that gets no points for deltaTotalTTLMs is forgotten, so series that
+// stop reporting don't grow the map forever; if it reports again, its total
+// restarts from zero too.
+type deltaTotals struct {
+	lock          sync.Mutex
+	totals        map[string]*deltaTotal
+	lastExpiredMs uint64
+}
+
+type deltaTotal struct {
+	value       float64
+	lastAddedMs uint64
+}
+
+const deltaTotalTTLMs = uint64(60 * 60 * 1000)
+
+var globalDeltaTotals = newDeltaTotals()
+
+func newDeltaTotals() *deltaTotals {
+	return &deltaTotals{totals: make(map[string]*deltaTotal)}
+}
+
+// Adds the delta to the total of the sample's series and returns the new total.
+func (dt *deltaTotals) add(orgid uint64, sample *metricSample, delta float64, nowMs uint64) float64 {
+	key := getSeriesKey(orgid, sample)
+
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	dt.expireStaleTotals(nowMs)
+
+	total, ok := dt.totals[key]
+	if !ok {
+		total = &deltaTotal{}
+		dt.totals[key] = total
+	}
+	total.value += delta
+	total.lastAddedMs = nowMs
+
+	return total.value
+}
+
+// Scans for stale totals at most once per TTL. The caller must hold the lock.
+func (dt *deltaTotals) expireStaleTotals(nowMs uint64) {
+	if nowMs < dt.lastExpiredMs+deltaTotalTTLMs {
+		return
+	}
+	dt.lastExpiredMs = nowMs
+
+	for key, total := range dt.totals {
+		if nowMs >= total.lastAddedMs+deltaTotalTTLMs {
+			delete(dt.totals, key)
+		}
+	}
+}
+
+func getSeriesKey(orgid uint64, sample *metricSample) string {
+	tagKeys := make([]string, 0, len(sample.Tags))
+	for key := range sample.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatUint(orgid, 10))
+	sb.WriteByte(0)
+	sb.WriteString(sample.Metric)
+	for _, key := range tagKeys {
+		sb.WriteByte(0)
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(sample.Tags[key])
+	}
+
+	return sb.String()
+}
+
+type metricConverter struct {
+	orgid       uint64
+	now         uint64
+	deltaTotals *deltaTotals
+}
+
+// Handles OTLP/HTTP metrics sent as protobuf or JSON. Data points are stored
+// in the same series model as Prometheus remote write.
+func ProcessMetricIngest(ctx *fasthttp.RequestCtx, myid uint64) {
+	if hook := hooks.GlobalHooks.OverrideIngestRequestHook; hook != nil {
+		alreadyHandled := hook(ctx, myid, grpc.INGEST_FUNC_OTLP_METRICS, false)
+		if alreadyHandled {
+			return
+		}
+	}
+
+	data, isJson, ok := readRequestBody(ctx, "ProcessMetricIngest")
+	if !ok {
+		return
+	}
+
+	request, err := unmarshalMetricsRequest(data, isJson)
+	if err != nil {
+		log.Errorf("ProcessMetricIngest: failed to unpack data: %s with err %v", string(data), err)
+		setEncodedFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to unmarshal metrics", isJson)
+		return
+	}
+
+	numDataPoints, numFailedDataPoints := IngestMetricsRequest(request, myid)
+
+	log.Debugf("ProcessMetricIngest: %v data points in the request and failed to ingest %v of them", numDataPoints, numFailedDataPoints)
+	usageStats.UpdateMetricsStats(uint64(len(data)), uint64(numDataPoints-numFailedDataPoints), myid)
+
+	handleMetricIngestionResponse(ctx, numDataPoints, numFailedDataPoints, isJson)
+}
+
+// Converts each data point in the request to one or more series points and
+// writes them to the metrics writer. Returns the number of data points and how
+// many of them failed.
+func IngestMetricsRequest(request *colmetricspb.ExportMetricsServiceRequest, myid uint64) (int, int) {
+	converter := &metricConverter{
+		orgid:       myid,
+		now:         utils.GetCurrentTimeInMs(),
+		deltaTotals: globalDeltaTotals,
+	}
+
+	numDataPoints := 0
+	numFailedDataPoints := 0
+	for _, resourceMetrics := range request.ResourceMetrics {
+		resourceTags := make(map[string]string)
+		if resourceMetrics.Resource != nil {
+			addAttributeTags(resourceTags, resourceMetrics.Resource.Attributes)
+		}
+
+		for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+			for _, metric := range scopeMetrics.Metrics {
+				samplesPerDataPoint, numFailed := converter.getMetricSamples(metric, resourceTags)
+				numDataPoints += len(samplesPerDataPoint) + numFailed
+				numFailedDataPoints += numFailed
+
+				for _, samples := range samplesPerDataPoint {
+					err := writeMetricSamples(samples, myid)
+					if err != nil {
+						log.Errorf("IngestMetricsRequest: failed to write data point of metric %v; err=%v", metric.Name, err)
+						numFailedDataPoints++
+					}
+				}
+			}
+		}
+	}
+
+	return numDataPoints, numFailedDataPoints
+}
+
+func writeMetricSamples(samples []*metricSample, myid uint64) error {
+	for _, sample := range samples {
+		rawJson, err := json.Marshal(sample)
+		if err != nil {
+			return fmt.Errorf("writeMetricSamples: failed to marshal sample %+v; err=%v", sample, err)
+		}
+
+		err = writer.AddTimeSeriesEntryToInMemBuf(rawJson, segutils.SIGNAL_METRICS_OTSDB, myid)
+		if err != nil {
+			return fmt.Errorf("writeMetricSamples: failed to add time series entry %s; err=%v", rawJson, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the series points for each data point of the metric, and the number
+// of data points that couldn't be converted. Data points flagged as having no
+// recorded value are dropped without counting as failures.
+func (mc *metricConverter) getMetricSamples(metric *metricspb.Metric, resourceTags map[string]string) ([][]*metricSample, int) {
+	name := sanitizeMetricName(metric.Name)
+	if name == "" {
+		numDataPoints := getNumDataPoints(metric)
+		log.Errorf("getMetricSamples: dropping %v data points of a metric without a name", numDataPoints)
+		return nil, numDataPoints
+	}
+
+	samplesPerDataPoint := make([][]*metricSample, 0)
+	numFailed := 0
+
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dataPoint := range data.Gauge.DataPoints {
+			samples := mc.getNumberSamples(name, dataPoint, resourceTags, false)
+			if samples != nil {
+				samplesPerDataPoint = append(samplesPerDataPoint, samples)
+			}
+		}
+	case *metricspb.Metric_Sum:
+		isDelta := data.Sum.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dataPoint := range data.Sum.DataPoints {
+			samples := mc.getNumberSamples(name, dataPoint, resourceTags, isDelta)
+			if samples != nil {
+				samplesPerDataPoint = append(samplesPerDataPoint, samples)
+			}
+		}
+	case *metricspb.Metric_Histogram:
+		isDelta := data.Histogram.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dataPoint := range data.Histogram.DataPoints {
+			samples, err := mc.getHistogramSamples(name, dataPoint, resourceTags, isDelta)
+			if err != nil {
+				log.Errorf("getMetricSamples: failed to convert histogram data point of metric %v; err=%v", name, err)
+				numFailed++
+				continue
+			}
+			if samples != nil {
+				samplesPerDataPoint = append(samplesPerDataPoint, samples)
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, dataPoint := range data.Summary.DataPoints {
+			samples := mc.getSummarySamples(name, dataPoint, resourceTags)
+			if samples != nil {
+				samplesPerDataPoint = append(samplesPerDataPoint, samples)
+			}
+		}
+	default:
+		numFailed = getNumDataPoints(metric)
+		log.Errorf("getMetricSamples: metric %v has unsupported type %T; dropping %v data points", name, metric.Data, numFailed)
+	}
+
+	return samplesPerDataPoint, numFailed
+}
+
+func getNumDataPoints(metric *metricspb.Metric) int {
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.DataPoints)
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.DataPoints)
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.DataPoints)
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.DataPoints)
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.DataPoints)
+	default:
+		return 0
+	}
+}
+
+func (mc *metricConverter) getNumberSamples(name string, dataPoint *metricspb.NumberDataPoint,
+	resourceTags map[string]string, isDelta bool) []*metricSample {
+
+	if hasNoRecordedValue(dataPoint.Flags) {
+		return nil
+	}
+
+	var value float64
+	switch dataPointValue := dataPoint.Value.(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = dataPointValue.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(dataPointValue.AsInt)
+	default:
+		return nil
+	}
+
+	sample := mc.newSample(name, dataPoint.TimeUnixNano, resourceTags, dataPoint.Attributes)
+	if !mc.setSampleValue(sample, value, isDelta) {
+		return nil
+	}
+
+	return []*metricSample{sample}
+}
+
+// Follows the Prometheus convention of a cumulative name_bucket series per
+// bucket boundary plus name_sum and name_count.
+func (mc *metricConverter) getHistogramSamples(name string, dataPoint *metricspb.HistogramDataPoint,
+	resourceTags map[string]string, isDelta bool) ([]*metricSample, error) {
+
+	if hasNoRecordedValue(dataPoint.Flags) {
+		return nil, nil
+	}
+
+	if len(dataPoint.BucketCounts) > 0 && len(dataPoint.BucketCounts) != len(dataPoint.ExplicitBounds)+1 {
+		return nil, fmt.Errorf("getHistogramSamples: got %v bucket counts for %v explicit bounds",
+			len(dataPoint.BucketCounts), len(dataPoint.ExplicitBounds))
+	}
+
+	samples := make([]*metricSample, 0, len(dataPoint.BucketCounts)+2)
+	addSample := func(metricName string, extraTagKey string, extraTagValue string, value float64) {
+		sample := mc.newSample(metricName, dataPoint.TimeUnixNano, resourceTags, dataPoint.Attributes)
+		if extraTagKey != "" {
+			sample.Tags[extraTagKey] = extraTagValue
+		}
+		if mc.setSampleValue(sample, value, isDelta) {
+			samples = append(samples, sample)
+		}
+	}
+
+	if len(dataPoint.BucketCounts) > 0 {
+		cumulativeCount := uint64(0)
+		for i, bound := range dataPoint.ExplicitBounds {
+			cumulativeCount += dataPoint.BucketCounts[i]
+			addSample(name+"_bucket", "le", strconv.FormatFloat(bound, 'f', -1, 64), float64(cumulativeCount))
+		}
+		addSample(name+"_bucket", "le", "+Inf", float64(dataPoint.Count))
+	}
+
+	if dataPoint.Sum != nil {
+		addSample(name+"_sum", "", "", *dataPoint.Sum)
+	}
+	addSample(name+"_count", "", "", float64(dataPoint.Count))
+
+	return samples, nil
+}
+
+func (mc *metricConverter) getSummarySamples(name string, dataPoint *metricspb.SummaryDataPoint,
+	resourceTags map[string]string) []*metricSample {
+
+	if hasNoRecordedValue(dataPoint.Flags) {
+		return nil
+	}
+
+	samples := make([]*metricSample, 0, len(dataPoint.QuantileValues)+2)
+	addSample := func(metricName string, quantile string, value float64) {
+		sample := mc.newSample(metricName, dataPoint.TimeUnixNano, resourceTags, dataPoint.Attributes)
+		if quantile != "" {
+			sample.Tags["quantile"] = quantile
+		}
+		if mc.setSampleValue(sample, value, false) {
+			samples = append(samples, sample)
+		}
+	}
+
+	for _, quantileValue := range dataPoint.QuantileValues {
+		addSample(name, strconv.FormatFloat(quantileValue.Quantile, 'f', -1, 64), quantileValue.Value)
+	}
+	addSample(name+"_sum", "", dataPoint.Sum)
+	addSample(name+"_count", "", float64(dataPoint.Count))
+
+	return samples
+}
+
+// Data point attributes take precedence over resource attributes with the
+// same key.
+func (mc *metricConverter) newSample(name string, timeUnixNano uint64, resourceTags map[string]string,
+	attributes []*commonpb.KeyValue) *metricSample {
+
+	tags := make(map[string]string, len(resourceTags)+len(attributes)+1)
+	for key, value := range resourceTags {
+		tags[key] = value
+	}
+	addAttributeTags(tags, attributes)
+
+	timestamp := timeUnixNano / 1_000_000
+	if timestamp == 0 {
+		timestamp = mc.now
+	}
+
+	return &metricSample{
+		Metric:    name,
+		Tags:      tags,
+		Timestamp: timestamp,
+	}
+}
+
+// Returns false if the value can't be stored. For delta series the value is
+// added to the running total, so the tags must be final before this is called.
+func (mc *metricConverter) setSampleValue(sample *metricSample, value float64, isDelta bool) bool {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return false
+	}
+
+	if isDelta {
+		value = mc.deltaTotals.add(mc.orgid, sample, value, mc.now)
+	}
+
+	sample.Value = value
+	return true
+}
+
+func hasNoRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+// Attributes are stored as string tags with Prometheus-compatible keys, so
+// service.name becomes service_name.
+func addAttributeTags(tags map[string]string, attributes []*commonpb.KeyValue) {
+	for _, keyvalue := range attributes {
+		if keyvalue.Value == nil || keyvalue.Value.Value == nil {
+			continue
+		}
+
+		key := sanitizeLabelName(keyvalue.Key)
+		if key == "" {
+			continue
+		}
+
+		value, err := extractAnyValue(keyvalue.Value)
+		if err != nil {
+			continue
+		}
+
+		switch typedValue := value.(type) {
+		case string:
+			tags[key] = typedValue
+		case bool, int64, float64:
+			tags[key] = fmt.Sprint(typedValue)
+		default:
+			encodedValue, err := json.Marshal(typedValue)
+			if err != nil {
+				continue
+			}
+			tags[key] = string(encodedValue)
+		}
+	}
+}
+
+// Replaces characters that aren't valid in a Prometheus metric name with
+// underscores.
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+// Replaces characters that aren't valid in a Prometheus label name with
+// underscores.
+func sanitizeLabelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+func sanitizeName(name string, allowColon bool) string {
+	if name == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	if name[0] >= '0' && name[0] <= '9' {
+		sb.WriteByte('_')
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		isValid := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') || char == '_' || (allowColon && char == ':')
+		if isValid {
+			sb.WriteByte(char)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+func unmarshalMetricsRequest(data []byte, isJson bool) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	var request colmetricspb.ExportMetricsServiceRequest
+	if !isJson {
+		err := proto.Unmarshal(data, &request)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalMetricsRequest: failed to unmarshal protobuf; err=%v", err)
+		}
+		return &request, nil
+	}
+
+	err := protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, &request)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalMetricsRequest: failed to unmarshal JSON; err=%v", err)
+	}
+
+	return &request, nil
+}
+
+func handleMetricIngestionResponse(ctx *fasthttp.RequestCtx, numDataPoints int, numFailedDataPoints int, isJson bool) {
+	metricsResponse := &colmetricspb.ExportMetricsServiceResponse{}
+	if numFailedDataPoints > 0 {
+		metricsResponse.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(numFailedDataPoints),
+		}
+	}
+
+	writeExportResponse(ctx, metricsResponse, numDataPoints, numFailedDataPoints, "data point", isJson)
+}
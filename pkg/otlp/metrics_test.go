@@ -0,0 +1,167 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func newTestMetricConverter() *metricConverter {
+	return &metricConverter{orgid: 0, now: 1_700_000_000_000, deltaTotals: newDeltaTotals()}
+}
+
+func numberDataPoint(timeUnixNano uint64, value float64, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		TimeUnixNano: timeUnixNano,
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+		Attributes:   attributes,
+	}
+}
+
+func Test_GetMetricSamples_Gauge(t *testing.T) {
+	converter := newTestMetricConverter()
+	resourceTags := make(map[string]string)
+	addAttributeTags(resourceTags, []*commonpb.KeyValue{
+		stringKeyValue("service.name", "checkout"),
+		stringKeyValue("host", "a"),
+	})
+
+	metric := &metricspb.Metric{
+		Name: "system.cpu.utilization",
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+			numberDataPoint(1_700_000_001_000_000_000, 0.25, stringKeyValue("host", "b"), stringKeyValue("cpu", "0")),
+			{TimeUnixNano: 0, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}},
+			{TimeUnixNano: 1, Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)},
+		}}},
+	}
+
+	samplesPerDataPoint, numFailed := converter.getMetricSamples(metric, resourceTags)
+	assert.Equal(t, 0, numFailed)
+	assert.Equal(t, [][]*metricSample{
+		{{Metric: "system_cpu_utilization", Tags: map[string]string{"service_name": "checkout", "host": "b", "cpu": "0"}, Timestamp: 1_700_000_001_000, Value: 0.25}},
+		{{Metric: "system_cpu_utilization", Tags: map[string]string{"service_name": "checkout", "host": "a"}, Timestamp: 1_700_000_000_000, Value: 3}},
+	}, samplesPerDataPoint)
+}
+
+func Test_GetMetricSamples_DeltaSum(t *testing.T) {
+	converter := newTestMetricConverter()
+	metric := &metricspb.Metric{
+		Name: "requests",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+			DataPoints: []*metricspb.NumberDataPoint{
+				numberDataPoint(1_000_000_000, 5, stringKeyValue("route", "/a")),
+				numberDataPoint(1_000_000_000, 2, stringKeyValue("route", "/b")),
+				numberDataPoint(2_000_000_000, 4, stringKeyValue("route", "/a")),
+			},
+		}},
+	}
+
+	samplesPerDataPoint, numFailed := converter.getMetricSamples(metric, map[string]string{})
+	assert.Equal(t, 0, numFailed)
+	assert.Len(t, samplesPerDataPoint, 3)
+	assert.Equal(t, float64(5), samplesPerDataPoint[0][0].Value)
+	assert.Equal(t, float64(2), samplesPerDataPoint[1][0].Value)
+	assert.Equal(t, float64(9), samplesPerDataPoint[2][0].Value)
+
+	// Cumulative sums are stored as they are.
+	metric.GetSum().AggregationTemporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	samplesPerDataPoint, _ = converter.getMetricSamples(metric, map[string]string{})
+	assert.Equal(t, float64(4), samplesPerDataPoint[2][0].Value)
+}
+
+func Test_DeltaTotals_ExpireStaleSeries(t *testing.T) {
+	totals := newDeltaTotals()
+	stale := &metricSample{Metric: "requests", Tags: map[string]string{"route": "/a"}}
+	active := &metricSample{Metric: "requests", Tags: map[string]string{"route": "/b"}}
+
+	nowMs := uint64(1_700_000_000_000)
+	assert.Equal(t, float64(5), totals.add(0, stale, 5, nowMs))
+	assert.Equal(t, float64(1), totals.add(0, active, 1, nowMs))
+	assert.Equal(t, float64(3), totals.add(0, active, 2, nowMs+deltaTotalTTLMs/2))
+	assert.Len(t, totals.totals, 2)
+
+	// Only the series without points for a whole TTL is forgotten.
+	nowMs += deltaTotalTTLMs
+	assert.Equal(t, float64(7), totals.add(0, active, 4, nowMs))
+	assert.Len(t, totals.totals, 1)
+	assert.Equal(t, float64(2), totals.add(0, stale, 2, nowMs))
+}
+
+func Test_GetMetricSamples_Histogram(t *testing.T) {
+	converter := newTestMetricConverter()
+	sum := 12.5
+	metric := &metricspb.Metric{
+		Name: "http.server.duration",
+		Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.HistogramDataPoint{
+				{
+					TimeUnixNano:   1_000_000_000,
+					Count:          6,
+					Sum:            &sum,
+					BucketCounts:   []uint64{1, 2, 3},
+					ExplicitBounds: []float64{0.5, 2.5},
+				},
+				{
+					TimeUnixNano:   1_000_000_000,
+					Count:          1,
+					BucketCounts:   []uint64{1},
+					ExplicitBounds: []float64{0.5, 2.5},
+				},
+			},
+		}},
+	}
+
+	samplesPerDataPoint, numFailed := converter.getMetricSamples(metric, map[string]string{"job": "api"})
+	assert.Equal(t, 1, numFailed)
+	assert.Equal(t, [][]*metricSample{{
+		{Metric: "http_server_duration_bucket", Tags: map[string]string{"job": "api", "le": "0.5"}, Timestamp: 1000, Value: 1},
+		{Metric: "http_server_duration_bucket", Tags: map[string]string{"job": "api", "le": "2.5"}, Timestamp: 1000, Value: 3},
+		{Metric: "http_server_duration_bucket", Tags: map[string]string{"job": "api", "le": "+Inf"}, Timestamp: 1000, Value: 6},
+		{Metric: "http_server_duration_sum", Tags: map[string]string{"job": "api"}, Timestamp: 1000, Value: 12.5},
+		{Metric: "http_server_duration_count", Tags: map[string]string{"job": "api"}, Timestamp: 1000, Value: 6},
+	}}, samplesPerDataPoint)
+}
+
+func Test_GetMetricSamples_Unsupported(t *testing.T) {
+	converter := newTestMetricConverter()
+	metric := &metricspb.Metric{
+		Name: "latency",
+		Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			DataPoints: []*metricspb.ExponentialHistogramDataPoint{{Count: 1}, {Count: 2}},
+		}},
+	}
+
+	samplesPerDataPoint, numFailed := converter.getMetricSamples(metric, map[string]string{})
+	assert.Equal(t, 2, numFailed)
+	assert.Empty(t, samplesPerDataPoint)
+}
+
+func Test_SanitizeName(t *testing.T) {
+	assert.Equal(t, "service_name", sanitizeLabelName("service.name"))
+	assert.Equal(t, "_2xx_count", sanitizeLabelName("2xx-count"))
+	assert.Equal(t, "job_runs", sanitizeLabelName("job:runs"))
+	assert.Equal(t, "job:runs", sanitizeMetricName("job:runs"))
+	assert.Equal(t, "", sanitizeMetricName(""))
+}
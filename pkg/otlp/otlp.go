@@ -20,10 +20,12 @@ package otlp
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/siglens/siglens/pkg/es/writer"
 	"github.com/siglens/siglens/pkg/grpc"
@@ -36,6 +38,7 @@ import (
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -56,19 +59,10 @@ func ProcessTraceIngest(ctx *fasthttp.RequestCtx) {
 	}
 
 	// Get the data from the request.
-	data := ctx.PostBody()
-	if requiresGzipDecompression(ctx) {
-		reader, err := gzip.NewReader(bytes.NewReader(data))
-		if err != nil {
-			setFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data")
-			return
-		}
-
-		data, err = io.ReadAll(reader)
-		if err != nil {
-			setFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data")
-			return
-		}
+	data, err := getRequestBody(ctx)
+	if err != nil {
+		setFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data")
+		return
 	}
 
 	// Unmarshal the data.
@@ -79,12 +73,22 @@ func ProcessTraceIngest(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	numSpans, numFailedSpans := IngestTracesRequest(request, 0)
+
+	log.Debugf("ProcessTraceIngest: %v spans in the request and failed to ingest %v of them", numSpans, numFailedSpans)
+	usageStats.UpdateTracesStats(uint64(len(data)), uint64(numSpans), 0)
+	// Send the appropriate response.
+	handleTraceIngestionResponse(ctx, numSpans, numFailedSpans)
+}
+
+// Writes each span in the request to the traces index. Returns the number of
+// spans and how many of them failed.
+func IngestTracesRequest(request *coltracepb.ExportTraceServiceRequest, myid uint64) (int, int) {
 	// Setup ingestion parameters.
 	now := utils.GetCurrentTimeInMs()
 	indexName := "traces"
 	shouldFlush := false
 	localIndexMap := make(map[string]string)
-	orgId := uint64(0)
 
 	idxToStreamIdCache := make(map[string]string)
 	cnameCacheByteHashToStr := make(map[uint64]string)
@@ -110,15 +114,15 @@ func ProcessTraceIngest(ctx *fasthttp.RequestCtx) {
 			for _, span := range scopeSpans.Spans {
 				jsonData, err := spanToJson(span, service)
 				if err != nil {
-					log.Errorf("ProcessTraceIngest: failed to marshal span %s: %v. Service name: %s", span, err, service)
+					log.Errorf("IngestTracesRequest: failed to marshal span %s: %v. Service name: %s", span, err, service)
 					numFailedSpans++
 					continue
 				}
 
 				lenJsonData := uint64(len(jsonData))
-				err = writer.ProcessIndexRequest(jsonData, now, indexName, lenJsonData, shouldFlush, localIndexMap, orgId, 0, idxToStreamIdCache, cnameCacheByteHashToStr, jsParsingStackbuf[:])
+				err = writer.ProcessIndexRequest(jsonData, now, indexName, lenJsonData, shouldFlush, localIndexMap, myid, 0, idxToStreamIdCache, cnameCacheByteHashToStr, jsParsingStackbuf[:])
 				if err != nil {
-					log.Errorf("ProcessTraceIngest: failed to process ingest request with err: %v. JSON Data: %s", err, string(jsonData))
+					log.Errorf("IngestTracesRequest: failed to process ingest request with err: %v. JSON Data: %s", err, string(jsonData))
 					numFailedSpans++
 					continue
 				}
@@ -126,10 +130,53 @@ func ProcessTraceIngest(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
-	log.Debugf("ProcessTraceIngest: %v spans in the request and failed to ingest %v of them", numSpans, numFailedSpans)
-	usageStats.UpdateTracesStats(uint64(len(data)), uint64(numSpans), 0)
-	// Send the appropriate response.
-	handleTraceIngestionResponse(ctx, numSpans, numFailedSpans)
+	return numSpans, numFailedSpans
+}
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJson     = "application/json"
+)
+
+// Returns the decompressed body of a protobuf or JSON request, and whether
+// it's JSON. The response is set up to use the same encoding as the request.
+// If this fails, the failure response is already set and ok is false.
+func readRequestBody(ctx *fasthttp.RequestCtx, caller string) ([]byte, bool, bool) {
+	contentType := string(ctx.Request.Header.Peek("Content-Type"))
+	isJson := strings.HasPrefix(contentType, contentTypeJson)
+	if isJson {
+		ctx.Response.Header.Set("Content-Type", contentTypeJson)
+	} else {
+		ctx.Response.Header.Set("Content-Type", contentTypeProtobuf)
+		if contentType != contentTypeProtobuf {
+			log.Infof("%v: got an unsupported request. Got Content-Type: %s", caller, contentType)
+			setEncodedFailureResponse(ctx, fasthttp.StatusUnsupportedMediaType, "Expected a protobuf or JSON request", false)
+			return nil, false, false
+		}
+	}
+
+	data, err := getRequestBody(ctx)
+	if err != nil {
+		setEncodedFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data", isJson)
+		return nil, false, false
+	}
+
+	return data, isJson, true
+}
+
+// Returns the request body, decompressing it if needed.
+func getRequestBody(ctx *fasthttp.RequestCtx) ([]byte, error) {
+	data := ctx.PostBody()
+	if !requiresGzipDecompression(ctx) {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(reader)
 }
 
 func requiresGzipDecompression(ctx *fasthttp.RequestCtx) bool {
@@ -235,6 +282,21 @@ func extractAnyValue(anyValue *commonpb.AnyValue) (interface{}, error) {
 		}
 
 		return value, nil
+	case *commonpb.AnyValue_KvlistValue:
+		keyValues := anyValue.GetKvlistValue().Values
+		value := make(map[string]interface{}, len(keyValues))
+		for _, keyvalue := range keyValues {
+			key, kvValue, err := extractKeyValue(keyvalue)
+			if err != nil {
+				return nil, err
+			}
+
+			value[key] = kvValue
+		}
+
+		return value, nil
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(anyValue.GetBytesValue()), nil
 	default:
 		return nil, fmt.Errorf("extractAnyValue: unsupported value type: %T", anyValue.Value)
 	}
@@ -298,6 +360,59 @@ func setFailureResponse(ctx *fasthttp.RequestCtx, statusCode int, message string
 	}
 }
 
+func marshalResponse(message proto.Message, isJson bool) ([]byte, error) {
+	if isJson {
+		return protojson.Marshal(message)
+	}
+	return proto.Marshal(message)
+}
+
+func setEncodedFailureResponse(ctx *fasthttp.RequestCtx, statusCode int, message string, isJson bool) {
+	ctx.SetStatusCode(statusCode)
+
+	failureStatus := status.Status{
+		Code:    int32(statusCode),
+		Message: message,
+	}
+
+	bytes, err := marshalResponse(&failureStatus, isJson)
+	if err != nil {
+		log.Errorf("setEncodedFailureResponse: failed to marshal failure status. err: %v. Status: %+v", err, &failureStatus)
+	}
+	_, err = ctx.Write(bytes)
+	if err != nil {
+		log.Errorf("setEncodedFailureResponse: failed to write failure status: %v", err)
+	}
+}
+
+// Writes the response to an export request, which should have its partial
+// success set if any items failed. If every item failed, a failure status is
+// sent instead.
+func writeExportResponse(ctx *fasthttp.RequestCtx, exportResponse proto.Message, numItems int, numFailedItems int,
+	itemName string, isJson bool) {
+
+	if numItems > 0 && numFailedItems >= numItems {
+		log.Errorf("writeExportResponse: every %v failed ingestion. NumItems: %d, NumFailedItems: %d", itemName, numItems, numFailedItems)
+		setEncodedFailureResponse(ctx, fasthttp.StatusInternalServerError, fmt.Sprintf("Every %v failed ingestion", itemName), isJson)
+		return
+	}
+
+	response, err := marshalResponse(exportResponse, isJson)
+	if err != nil {
+		log.Errorf("writeExportResponse: failed to marshal response. err: %v. NumItems: %d, NumFailedItems: %d", err, numItems, numFailedItems)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		return
+	}
+	_, err = ctx.Write(response)
+	if err != nil {
+		log.Errorf("writeExportResponse: failed to write response. err: %v. NumItems: %d, NumFailedItems: %d", err, numItems, numFailedItems)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
 func handleTraceIngestionResponse(ctx *fasthttp.RequestCtx, numSpans int, numFailedSpans int) {
 	if numFailedSpans == 0 {
 		// This request was successful.
@@ -350,3 +465,90 @@ func handleTraceIngestionResponse(ctx *fasthttp.RequestCtx, numSpans int, numFai
 		return
 	}
 }
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// Zipkin and Jaeger clients record the span kind and status as tags. Moves
+// those tags into the span's kind and status so the span is stored the same
+// way as an OTLP span would be. An "error" tag marks the span as failed but is
+// kept since its value may be a useful message.
+func setSpanKindAndStatusFromTags(span *tracepb.Span) {
+	span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_UNSET}
+	hasStatusCode := false
+
+	attributes := make([]*commonpb.KeyValue, 0, len(span.Attributes))
+	for _, keyvalue := range span.Attributes {
+		switch keyvalue.Key {
+		case "span.kind":
+			span.Kind = getSpanKind(keyvalue.Value.GetStringValue())
+			continue
+		case "otel.status_code":
+			switch strings.ToUpper(keyvalue.Value.GetStringValue()) {
+			case "OK":
+				span.Status.Code = tracepb.Status_STATUS_CODE_OK
+			case "ERROR":
+				span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+			}
+			hasStatusCode = true
+			continue
+		case "otel.status_description":
+			span.Status.Message = keyvalue.Value.GetStringValue()
+			continue
+		case "error":
+			isError := true
+			if boolValue, ok := keyvalue.Value.Value.(*commonpb.AnyValue_BoolValue); ok {
+				isError = boolValue.BoolValue
+			} else if keyvalue.Value.GetStringValue() == "false" {
+				isError = false
+			}
+
+			if isError && !hasStatusCode {
+				span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+			}
+		}
+
+		attributes = append(attributes, keyvalue)
+	}
+
+	span.Attributes = attributes
+}
+
+// Returns the OTLP kind for a Zipkin kind or Jaeger span.kind tag.
+func getSpanKind(kind string) tracepb.Span_SpanKind {
+	switch strings.ToLower(kind) {
+	case "client":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "server":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "producer":
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case "consumer":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	}
+}
+
+func setTextFailureResponse(ctx *fasthttp.RequestCtx, statusCode int, message string) {
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetBodyString(message)
+}
+
+// Zipkin and Jaeger clients expect 202 Accepted with an empty body, and don't
+// support partial success.
+func handleAcceptedTraceResponse(ctx *fasthttp.RequestCtx, numSpans int, numFailedSpans int) {
+	if numSpans > 0 && numFailedSpans >= numSpans {
+		log.Errorf("handleAcceptedTraceResponse: every span failed ingestion. NumSpans: %d, NumFailedSpans: %d", numSpans, numFailedSpans)
+		setTextFailureResponse(ctx, fasthttp.StatusInternalServerError, "Every span failed ingestion")
+		return
+	}
+
+	if numFailedSpans > 0 {
+		log.Warnf("handleAcceptedTraceResponse: failed to ingest %d of %d spans", numFailedSpans, numSpans)
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Type ids used by the Thrift binary protocol.
+const (
+	thriftStop   byte = 0
+	thriftBool   byte = 2
+	thriftByte   byte = 3
+	thriftDouble byte = 4
+	thriftI16    byte = 6
+	thriftI32    byte = 8
+	thriftI64    byte = 10
+	thriftString byte = 11
+	thriftStruct byte = 12
+	thriftMap    byte = 13
+	thriftSet    byte = 14
+	thriftList   byte = 15
+)
+
+// Values nested deeper than this are rejected so malicious input can't
+// exhaust the stack.
+const maxThriftDepth = 64
+
+// Reads values encoded with the Thrift binary protocol from a buffer.
+type thriftReader struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func newThriftReader(data []byte) *thriftReader {
+	return &thriftReader{data: data}
+}
+
+func (r *thriftReader) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, fmt.Errorf("thriftReader.readN: need %v bytes at offset %v but only %v remain", n, r.pos, len(r.data)-r.pos)
+	}
+
+	buf := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return buf, nil
+}
+
+func (r *thriftReader) readByte() (byte, error) {
+	buf, err := r.readN(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+func (r *thriftReader) readBool() (bool, error) {
+	b, err := r.readByte()
+	return b != 0, err
+}
+
+func (r *thriftReader) readI16() (int16, error) {
+	buf, err := r.readN(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(buf)), nil
+}
+
+func (r *thriftReader) readI32() (int32, error) {
+	buf, err := r.readN(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(buf)), nil
+}
+
+func (r *thriftReader) readI64() (int64, error) {
+	buf, err := r.readN(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
+
+func (r *thriftReader) readDouble() (float64, error) {
+	buf, err := r.readN(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+}
+
+func (r *thriftReader) readBinary() ([]byte, error) {
+	length, err := r.readI32()
+	if err != nil {
+		return nil, err
+	}
+	return r.readN(int(length))
+}
+
+func (r *thriftReader) readString() (string, error) {
+	buf, err := r.readBinary()
+	return string(buf), err
+}
+
+// Returns the element type and the number of elements. Lists and sets share
+// the same encoding.
+func (r *thriftReader) readListHeader() (byte, int, error) {
+	elemType, err := r.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := r.readI32()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Every element takes at least a byte.
+	if size < 0 || int(size) > len(r.data)-r.pos {
+		return 0, 0, fmt.Errorf("thriftReader.readListHeader: invalid size %v", size)
+	}
+
+	return elemType, int(size), nil
+}
+
+// Calls readField for each field of the struct at the current position.
+// readField must consume the field's value, and should call skip for fields
+// it doesn't know.
+func (r *thriftReader) readStruct(readField func(fieldType byte, fieldId int16) error) error {
+	err := r.enter()
+	if err != nil {
+		return err
+	}
+	defer r.exit()
+
+	for {
+		fieldType, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if fieldType == thriftStop {
+			return nil
+		}
+
+		fieldId, err := r.readI16()
+		if err != nil {
+			return err
+		}
+
+		err = readField(fieldType, fieldId)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Calls readElem for each element of the list at the current position, after
+// checking the elements have the expected type.
+func (r *thriftReader) readList(expectedType byte, readElem func() error) error {
+	elemType, size, err := r.readListHeader()
+	if err != nil {
+		return err
+	}
+	if elemType != expectedType && size > 0 {
+		return fmt.Errorf("thriftReader.readList: expected elements of type %v but got %v", expectedType, elemType)
+	}
+
+	for i := 0; i < size; i++ {
+		err = readElem()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *thriftReader) enter() error {
+	if r.depth >= maxThriftDepth {
+		return fmt.Errorf("thriftReader.enter: values are nested more than %v deep", maxThriftDepth)
+	}
+
+	r.depth++
+	return nil
+}
+
+func (r *thriftReader) exit() {
+	r.depth--
+}
+
+// Skips over a value of the given type.
+func (r *thriftReader) skip(valueType byte) error {
+	err := r.enter()
+	if err != nil {
+		return err
+	}
+	defer r.exit()
+
+	switch valueType {
+	case thriftBool, thriftByte:
+		_, err = r.readN(1)
+	case thriftI16:
+		_, err = r.readN(2)
+	case thriftI32:
+		_, err = r.readN(4)
+	case thriftDouble, thriftI64:
+		_, err = r.readN(8)
+	case thriftString:
+		_, err = r.readBinary()
+	case thriftStruct:
+		err = r.readStruct(func(fieldType byte, _ int16) error {
+			return r.skip(fieldType)
+		})
+	case thriftMap:
+		var keyType, valueType byte
+		var size int32
+		keyType, err = r.readByte()
+		if err == nil {
+			valueType, err = r.readByte()
+		}
+		if err == nil {
+			size, err = r.readI32()
+		}
+		if err == nil && (size < 0 || int(size) > len(r.data)-r.pos) {
+			err = fmt.Errorf("thriftReader.skip: invalid map size %v", size)
+		}
+		for i := 0; err == nil && i < int(size); i++ {
+			err = r.skip(keyType)
+			if err == nil {
+				err = r.skip(valueType)
+			}
+		}
+	case thriftSet, thriftList:
+		var elemType byte
+		var size int
+		elemType, size, err = r.readListHeader()
+		for i := 0; err == nil && i < size; i++ {
+			err = r.skip(elemType)
+		}
+	default:
+		err = fmt.Errorf("thriftReader.skip: unknown type %v", valueType)
+	}
+
+	return err
+}
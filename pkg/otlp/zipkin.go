@@ -0,0 +1,217 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siglens/siglens/pkg/grpc"
+	"github.com/siglens/siglens/pkg/hooks"
+	"github.com/siglens/siglens/pkg/usageStats"
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+	Ipv4        string `json:"ipv4"`
+	Ipv6        string `json:"ipv6"`
+	Port        int    `json:"port"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp uint64 `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// A span in the Zipkin v2 JSON format. Timestamps and durations are in
+// microseconds.
+type zipkinSpan struct {
+	TraceId        string             `json:"traceId"`
+	Id             string             `json:"id"`
+	ParentId       string             `json:"parentId"`
+	Name           string             `json:"name"`
+	Kind           string             `json:"kind"`
+	Timestamp      uint64             `json:"timestamp"`
+	Duration       uint64             `json:"duration"`
+	LocalEndpoint  *zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint *zipkinEndpoint    `json:"remoteEndpoint"`
+	Annotations    []zipkinAnnotation `json:"annotations"`
+	Tags           map[string]string  `json:"tags"`
+}
+
+// Handles spans sent by Zipkin clients in the v2 JSON format. The spans are
+// converted to OTLP spans so they're stored the same way as spans sent to
+// ProcessTraceIngest.
+func ProcessZipkinTraceIngest(ctx *fasthttp.RequestCtx, myid uint64) {
+	if hook := hooks.GlobalHooks.OverrideIngestRequestHook; hook != nil {
+		alreadyHandled := hook(ctx, myid, grpc.INGEST_FUNC_ZIPKIN_TRACES, false)
+		if alreadyHandled {
+			return
+		}
+	}
+
+	contentType := string(ctx.Request.Header.Peek("Content-Type"))
+	if contentType != "" && !strings.HasPrefix(contentType, contentTypeJson) {
+		log.Infof("ProcessZipkinTraceIngest: got an unsupported request. Got Content-Type: %s", contentType)
+		setTextFailureResponse(ctx, fasthttp.StatusUnsupportedMediaType, "Expected a JSON request")
+		return
+	}
+
+	data, err := getRequestBody(ctx)
+	if err != nil {
+		setTextFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to gzip decompress the data")
+		return
+	}
+
+	var spans []zipkinSpan
+	err = json.Unmarshal(data, &spans)
+	if err != nil {
+		log.Errorf("ProcessZipkinTraceIngest: failed to unpack data: %s with err %v", string(data), err)
+		setTextFailureResponse(ctx, fasthttp.StatusBadRequest, "Unable to unmarshal Zipkin spans")
+		return
+	}
+
+	request, err := zipkinSpansToRequest(spans)
+	if err != nil {
+		log.Errorf("ProcessZipkinTraceIngest: failed to convert spans; err=%v", err)
+		setTextFailureResponse(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+	numSpans, numFailedSpans := IngestTracesRequest(request, myid)
+
+	log.Debugf("ProcessZipkinTraceIngest: %v spans in the request and failed to ingest %v of them", numSpans, numFailedSpans)
+	usageStats.UpdateTracesStats(uint64(len(data)), uint64(numSpans), myid)
+	handleAcceptedTraceResponse(ctx, numSpans, numFailedSpans)
+}
+
+// Groups the spans by the service in their local endpoint, since OTLP gives
+// the service once for each group of spans.
+func zipkinSpansToRequest(zipkinSpans []zipkinSpan) (*coltracepb.ExportTraceServiceRequest, error) {
+	request := &coltracepb.ExportTraceServiceRequest{}
+	serviceToResourceSpans := make(map[string]*tracepb.ResourceSpans)
+	for i := range zipkinSpans {
+		span, err := zipkinSpanToSpan(&zipkinSpans[i])
+		if err != nil {
+			return nil, err
+		}
+
+		service := ""
+		if zipkinSpans[i].LocalEndpoint != nil {
+			service = zipkinSpans[i].LocalEndpoint.ServiceName
+		}
+
+		resourceSpans, ok := serviceToResourceSpans[service]
+		if !ok {
+			resourceSpans = &tracepb.ResourceSpans{
+				Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttribute("service.name", service)}},
+				ScopeSpans: []*tracepb.ScopeSpans{{}},
+			}
+			serviceToResourceSpans[service] = resourceSpans
+			request.ResourceSpans = append(request.ResourceSpans, resourceSpans)
+		}
+		resourceSpans.ScopeSpans[0].Spans = append(resourceSpans.ScopeSpans[0].Spans, span)
+	}
+
+	return request, nil
+}
+
+func zipkinSpanToSpan(zipkinSpan *zipkinSpan) (*tracepb.Span, error) {
+	traceId, err := decodeZipkinId(zipkinSpan.TraceId, 16)
+	if err != nil {
+		return nil, fmt.Errorf("zipkinSpanToSpan: invalid traceId %q; err=%v", zipkinSpan.TraceId, err)
+	}
+	spanId, err := decodeZipkinId(zipkinSpan.Id, 8)
+	if err != nil {
+		return nil, fmt.Errorf("zipkinSpanToSpan: invalid id %q; err=%v", zipkinSpan.Id, err)
+	}
+
+	var parentSpanId []byte
+	if zipkinSpan.ParentId != "" {
+		parentSpanId, err = decodeZipkinId(zipkinSpan.ParentId, 8)
+		if err != nil {
+			return nil, fmt.Errorf("zipkinSpanToSpan: invalid parentId %q; err=%v", zipkinSpan.ParentId, err)
+		}
+	}
+
+	span := &tracepb.Span{
+		TraceId:           traceId,
+		SpanId:            spanId,
+		ParentSpanId:      parentSpanId,
+		Name:              zipkinSpan.Name,
+		StartTimeUnixNano: zipkinSpan.Timestamp * 1000,
+		EndTimeUnixNano:   (zipkinSpan.Timestamp + zipkinSpan.Duration) * 1000,
+	}
+
+	// Sort the tags so the attributes have a stable order.
+	keys := make([]string, 0, len(zipkinSpan.Tags))
+	for key := range zipkinSpan.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		span.Attributes = append(span.Attributes, stringAttribute(key, zipkinSpan.Tags[key]))
+	}
+
+	if remote := zipkinSpan.RemoteEndpoint; remote != nil {
+		if remote.ServiceName != "" {
+			span.Attributes = append(span.Attributes, stringAttribute("peer.service", remote.ServiceName))
+		}
+		if remote.Ipv4 != "" || remote.Ipv6 != "" {
+			ip := remote.Ipv4
+			if ip == "" {
+				ip = remote.Ipv6
+			}
+			span.Attributes = append(span.Attributes, stringAttribute("net.peer.ip", ip))
+		}
+		if remote.Port != 0 {
+			span.Attributes = append(span.Attributes, stringAttribute("net.peer.port", strconv.Itoa(remote.Port)))
+		}
+	}
+
+	for _, annotation := range zipkinSpan.Annotations {
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			TimeUnixNano: annotation.Timestamp * 1000,
+			Name:         annotation.Value,
+		})
+	}
+
+	setSpanKindAndStatusFromTags(span)
+	span.Kind = getSpanKind(zipkinSpan.Kind)
+
+	return span, nil
+}
+
+// Zipkin ids are lowercase hex, and 64-bit trace ids are allowed. Shorter ids
+// are padded with leading zeros.
+func decodeZipkinId(id string, numBytes int) ([]byte, error) {
+	if id == "" || len(id) > 2*numBytes {
+		return nil, fmt.Errorf("decodeZipkinId: expected 1 to %v hex characters but got %v", 2*numBytes, len(id))
+	}
+
+	return hex.DecodeString(strings.Repeat("0", 2*numBytes-len(id)) + id)
+}
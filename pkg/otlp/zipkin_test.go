@@ -0,0 +1,134 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func Test_ZipkinSpanToSpan(t *testing.T) {
+	data := `[{
+		"traceId": "5af7183fb1d4cf5f",
+		"id": "6b221d5bc9e6496c",
+		"parentId": "352bff9a74ca9ad2",
+		"name": "get /api",
+		"kind": "SERVER",
+		"timestamp": 1700000000000000,
+		"duration": 2500,
+		"localEndpoint": {"serviceName": "frontend", "ipv4": "10.0.0.1"},
+		"remoteEndpoint": {"serviceName": "backend", "ipv4": "10.0.0.2", "port": 8080},
+		"annotations": [{"timestamp": 1700000000001000, "value": "ws"}],
+		"tags": {"http.method": "GET", "error": "500", "otel.status_description": "boom"}
+	}]`
+
+	var zipkinSpans []zipkinSpan
+	assert.NoError(t, json.Unmarshal([]byte(data), &zipkinSpans))
+
+	span, err := zipkinSpanToSpan(&zipkinSpans[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x5a, 0xf7, 0x18, 0x3f, 0xb1, 0xd4, 0xcf, 0x5f}, span.TraceId)
+	assert.Equal(t, []byte{0x6b, 0x22, 0x1d, 0x5b, 0xc9, 0xe6, 0x49, 0x6c}, span.SpanId)
+	assert.Equal(t, []byte{0x35, 0x2b, 0xff, 0x9a, 0x74, 0xca, 0x9a, 0xd2}, span.ParentSpanId)
+	assert.Equal(t, "get /api", span.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, span.Kind)
+	assert.Equal(t, uint64(1_700_000_000_000_000_000), span.StartTimeUnixNano)
+	assert.Equal(t, uint64(1_700_000_000_002_500_000), span.EndTimeUnixNano)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	assert.Equal(t, "boom", span.Status.Message)
+	assert.Equal(t, []*tracepb.Span_Event{{TimeUnixNano: 1_700_000_000_001_000_000, Name: "ws"}}, span.Events)
+
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	jsonData, err := spanToJson(span, "frontend")
+	assert.NoError(t, err)
+
+	var result map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonData, &result))
+	assert.Equal(t, "00000000000000005af7183fb1d4cf5f", result["trace_id"])
+	assert.Equal(t, "352bff9a74ca9ad2", result["parent_span_id"])
+	assert.Equal(t, "frontend", result["service"])
+	assert.Equal(t, "SPAN_KIND_SERVER", result["kind"])
+	assert.Equal(t, "STATUS_CODE_ERROR", result["status"])
+	assert.Equal(t, float64(2_500_000), result["duration"])
+	assert.Equal(t, "GET", result["http.method"])
+	assert.Equal(t, "500", result["error"])
+	assert.Equal(t, "backend", result["peer.service"])
+	assert.Equal(t, "10.0.0.2", result["net.peer.ip"])
+	assert.Equal(t, "8080", result["net.peer.port"])
+	assert.NotContains(t, result, "otel.status_description")
+}
+
+func Test_ZipkinSpansToRequest(t *testing.T) {
+	zipkinSpans := []zipkinSpan{
+		{TraceId: "1", Id: "a", LocalEndpoint: &zipkinEndpoint{ServiceName: "frontend"}},
+		{TraceId: "1", Id: "b", ParentId: "a", LocalEndpoint: &zipkinEndpoint{ServiceName: "backend"}},
+		{TraceId: "1", Id: "c", ParentId: "a", LocalEndpoint: &zipkinEndpoint{ServiceName: "frontend"}},
+	}
+
+	request, err := zipkinSpansToRequest(zipkinSpans)
+	assert.NoError(t, err)
+	assert.Len(t, request.ResourceSpans, 2)
+	assert.Equal(t, "frontend", request.ResourceSpans[0].Resource.Attributes[0].Value.GetStringValue())
+	assert.Len(t, request.ResourceSpans[0].ScopeSpans[0].Spans, 2)
+	assert.Equal(t, "backend", request.ResourceSpans[1].Resource.Attributes[0].Value.GetStringValue())
+	assert.Len(t, request.ResourceSpans[1].ScopeSpans[0].Spans, 1)
+
+	// A span without a parent is a root span.
+	assert.Empty(t, request.ResourceSpans[0].ScopeSpans[0].Spans[0].ParentSpanId)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, request.ResourceSpans[0].ScopeSpans[0].Spans[0].Kind)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_UNSET, request.ResourceSpans[0].ScopeSpans[0].Spans[0].Status.Code)
+
+	for _, invalid := range []zipkinSpan{
+		{TraceId: "", Id: "a"},
+		{TraceId: "xyz", Id: "a"},
+		{TraceId: "1", Id: "00112233445566778899"},
+		{TraceId: "1", Id: "a", ParentId: "not hex"},
+	} {
+		_, err = zipkinSpansToRequest([]zipkinSpan{invalid})
+		assert.Error(t, err, "span: %+v", invalid)
+	}
+}
+
+func Test_ProcessZipkinTraceIngest_BadRequest(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetContentType("application/x-protobuf")
+	ProcessZipkinTraceIngest(ctx, 0)
+	assert.Equal(t, fasthttp.StatusUnsupportedMediaType, ctx.Response.StatusCode())
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetContentType("application/json")
+	ctx.Request.SetBodyString(`{"not": "an array"}`)
+	ProcessZipkinTraceIngest(ctx, 0)
+	assert.Equal(t, fasthttp.StatusBadRequest, ctx.Response.StatusCode())
+}
+
+func Test_HandleAcceptedTraceResponse(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	handleAcceptedTraceResponse(ctx, 3, 1)
+	assert.Equal(t, fasthttp.StatusAccepted, ctx.Response.StatusCode())
+	assert.Empty(t, ctx.Response.Body())
+
+	ctx = &fasthttp.RequestCtx{}
+	handleAcceptedTraceResponse(ctx, 3, 3)
+	assert.Equal(t, fasthttp.StatusInternalServerError, ctx.Response.StatusCode())
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/siglens/siglens/pkg/hooks"
 	segmetadata "github.com/siglens/siglens/pkg/segment/metadata"
 	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
 	"github.com/siglens/siglens/pkg/segment/writer"
 	mmeta "github.com/siglens/siglens/pkg/segment/writer/metrics/meta"
 	"github.com/siglens/siglens/pkg/utils"
@@ -330,6 +331,7 @@ func DeleteSegmentData(segmentsToDelete map[string]*structs.SegMeta, updateBlob
 	// 2) Then from in memory metadata
 	for _, segMetaEntry := range segmentsToDelete {
 		segmetadata.DeleteSegmentKey(segMetaEntry.SegmentKey)
+		tombstones.DeleteSegmentKey(segMetaEntry.SegmentKey)
 	}
 
 	// 3) then iterate through blob
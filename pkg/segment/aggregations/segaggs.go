@@ -36,6 +36,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Loki ingestion stores the raw log line in this column.
+const logLineColumn = "line"
+
 func applyTimeRangeHistogram(nodeResult *structs.NodeResult, rangeHistogram *structs.TimeBucket, aggName string) {
 
 	if nodeResult.Histogram == nil || rangeHistogram.Timechart != nil {
@@ -763,9 +766,48 @@ func performMaxRows(nodeResult *structs.NodeResult, headExpr *structs.HeadExpr,
 	return nil
 }
 
+// Adds the logfmt pairs of the log line in the record as fields. When labels
+// isn't empty, only its keys are added, under the labels they map to. As in
+// Loki, a field that already exists is kept and the pair is added with an
+// "_extracted" suffix.
+func AddLogfmtFields(record map[string]interface{}, labels map[string]string, finalCols map[string]bool) {
+	line, ok := record[logLineColumn].(string)
+	if !ok {
+		return
+	}
+
+	for key, value := range utils.ParseLogfmt(line) {
+		label := key
+		if len(labels) > 0 {
+			label, ok = labels[key]
+			if !ok {
+				continue
+			}
+		}
+		if _, exists := record[label]; exists {
+			label += "_extracted"
+		}
+
+		record[label] = segutils.GetLiteralFromString(value)
+		if finalCols != nil {
+			finalCols[label] = true
+		}
+	}
+}
+
 func performColumnsRequestWithoutGroupby(nodeResult *structs.NodeResult, colReq *structs.ColumnsRequest, recs map[string]map[string]interface{},
 	finalCols map[string]bool) error {
 
+	if colReq.Logfmt {
+		labels := make(map[string]string, len(colReq.IncludeValues))
+		for _, includeValue := range colReq.IncludeValues {
+			labels[includeValue.ColName] = includeValue.Label
+		}
+		for _, record := range recs {
+			AddLogfmtFields(record, labels, finalCols)
+		}
+	}
+
 	if colReq.RenameAggregationColumns != nil {
 		for oldCName, newCName := range colReq.RenameAggregationColumns {
 			if _, exists := finalCols[oldCName]; !exists {
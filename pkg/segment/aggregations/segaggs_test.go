@@ -3453,3 +3453,26 @@ func Test_PerformMVExpand(t *testing.T) {
 		}
 	}
 }
+
+func Test_AddLogfmtFields(t *testing.T) {
+	record := map[string]interface{}{
+		"line":  `level=error msg="request failed" status=500 app=api`,
+		"app":   "web",
+		"level": "info",
+	}
+	finalCols := map[string]bool{"line": true, "app": true, "level": true}
+	AddLogfmtFields(record, nil, finalCols)
+	assert.Equal(t, "request failed", record["msg"])
+	assert.Equal(t, int64(500), record["status"])
+	assert.Equal(t, "web", record["app"])
+	assert.Equal(t, "api", record["app_extracted"])
+	assert.Equal(t, "error", record["level_extracted"])
+	assert.True(t, finalCols["msg"])
+	assert.True(t, finalCols["app_extracted"])
+
+	record = map[string]interface{}{"line": `level=error msg="request failed"`}
+	finalCols = map[string]bool{"line": true}
+	AddLogfmtFields(record, map[string]string{"msg": "message"}, finalCols)
+	assert.Equal(t, map[string]interface{}{"line": `level=error msg="request failed"`, "message": "request failed"}, record)
+	assert.Equal(t, map[string]bool{"line": true, "message": true}, finalCols)
+}
@@ -88,9 +88,21 @@ func ApplyMetricsQuery(mQuery *structs.MetricsQuery, timeRange *dtu.MetricsTimeR
 	// init metrics results structs
 	mRes := mresults.InitMetricResults(mQuery, qid)
 
-	mSegments, err := getAllRequestsWithinTimeRange(timeRange, mQuery.OrgId, querySummary)
+	// The offset and @ modifiers change the time range the query is evaluated over, and the results are moved back to the
+	// requested time range at the end. Functions like absent also need data from before the evaluation time range.
+	evalTimeRange := mQuery.GetEvaluationTimeRange(timeRange)
+	searchTimeRange := evalTimeRange
+	if mQuery.LookbackSeconds > 0 {
+		searchStart := evalTimeRange.StartEpochSec - mQuery.LookbackSeconds
+		if mQuery.LookbackSeconds > evalTimeRange.StartEpochSec {
+			searchStart = 0
+		}
+		searchTimeRange = &dtu.MetricsTimeRange{StartEpochSec: searchStart, EndEpochSec: evalTimeRange.EndEpochSec}
+	}
+
+	mSegments, err := getAllRequestsWithinTimeRange(searchTimeRange, mQuery.OrgId, querySummary)
 	if err != nil {
-		log.Errorf("ApplyMetricsQuery: failed to get all metric segments within time range %+v; err=%v", timeRange, err)
+		log.Errorf("ApplyMetricsQuery: failed to get all metric segments within time range %+v; err=%v", searchTimeRange, err)
 		return &mresults.MetricsResult{
 			ErrList: []error{err},
 		}
@@ -130,12 +142,12 @@ func ApplyMetricsQuery(mQuery *structs.MetricsQuery, timeRange *dtu.MetricsTimeR
 	}
 
 	if mQuery.TagValueSearchOnly {
-		applyTagValuesSearchOnlyOnSegments(mQuery, mSegments, mRes, timeRange, qid, querySummary)
+		applyTagValuesSearchOnlyOnSegments(mQuery, mSegments, mRes, searchTimeRange, qid, querySummary)
 		return mRes
 	}
 
 	// iterate through all metrics segments, applying search as needed
-	applyMetricsOperatorOnSegments(mQuery, mSegments, mRes, timeRange, qid, querySummary)
+	applyMetricsOperatorOnSegments(mQuery, mSegments, mRes, searchTimeRange, qid, querySummary)
 	if mQuery.ExitAfterTagsSearch {
 		return mRes
 	}
@@ -163,7 +175,11 @@ func ApplyMetricsQuery(mQuery *structs.MetricsQuery, timeRange *dtu.MetricsTimeR
 	for mQuery.MQueryAggs != nil {
 		if mQuery.MQueryAggs.AggBlockType == structs.FunctionBlock {
 			mQuery.Function = *mQuery.MQueryAggs.FunctionBlock
-			errors = mRes.ApplyFunctionsToResults(parallelism, mQuery.Function)
+			if mQuery.Function.AbsentFunction > 0 {
+				errors = mRes.ApplyAbsentFunctionToResults(mQuery.Function, evalTimeRange, uint32(mQuery.Downsampler.Interval))
+			} else {
+				errors = mRes.ApplyFunctionsToResults(parallelism, mQuery.Function)
+			}
 			if errors != nil {
 				for _, err := range errors {
 					mRes.AddError(err)
@@ -190,6 +206,10 @@ func ApplyMetricsQuery(mQuery *structs.MetricsQuery, timeRange *dtu.MetricsTimeR
 		mQuery.MQueryAggs = mQuery.MQueryAggs.Next
 	}
 
+	if mQuery.HasTimeModifiers() {
+		mRes.ApplyTimeModifiers(mQuery, timeRange, uint32(mQuery.Downsampler.Interval))
+	}
+
 	return mRes
 }
 
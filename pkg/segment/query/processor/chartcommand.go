@@ -0,0 +1,553 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/siglens/siglens/pkg/segment/aggregations"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+type chartProcessor struct {
+	options *structs.ChartExpr
+	stats   *statsProcessor
+
+	// The number of records for each value of the by field. This is used to
+	// rank the by values when the limit is based on frequency.
+	byValueCounts map[string]int
+
+	// If the by values merged into the other column can't be merged from their
+	// aggregated values, the first pass only finds which by values to keep and
+	// the second pass aggregates the rest together as the other column.
+	needsOtherPass bool
+	keptByValues   []string            // Only set after the first pass.
+	otherByValues  map[string]struct{} // Only set after the first pass.
+}
+
+// Holds the aggregated values for one row of the chart.
+type chartRow struct {
+	overValue utils.CValueEnclosure
+	cells     map[string][]utils.CValueEnclosure // Column value -> measure index -> value.
+}
+
+func (p *chartProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR != nil {
+		return nil, p.aggregate(inputIQR)
+	}
+
+	if p.stats == nil {
+		// There was no input.
+		return nil, io.EOF
+	}
+
+	statsIQR, err := p.stats.Process(nil)
+	if err != nil && err != io.EOF {
+		return nil, toputils.TeeErrorf("chart.Process: failed to get stats results; err=%v", err)
+	}
+	if statsIQR == nil {
+		return nil, io.EOF
+	}
+
+	if p.needsOtherPass && p.keptByValues == nil {
+		err := p.findKeptByValues(statsIQR)
+		if err != nil {
+			return nil, toputils.TeeErrorf("chart.Process: failed to find by values to keep; err=%v", err)
+		}
+
+		return nil, io.EOF
+	}
+
+	outputIQR, err := p.buildChart(statsIQR)
+	if err != nil {
+		return nil, toputils.TeeErrorf("chart.Process: failed to build chart; err=%v", err)
+	}
+
+	return outputIQR, io.EOF
+}
+
+func (p *chartProcessor) aggregate(inputIQR *iqr.IQR) error {
+	timechartExpr := p.options.TimechartExpr
+	if p.stats == nil {
+		groupByCols := []string{p.options.OverField}
+		if timechartExpr.ByField != "" {
+			groupByCols = append(groupByCols, timechartExpr.ByField)
+		}
+
+		p.stats = &statsProcessor{
+			options: &structs.StatsExpr{
+				GroupByRequest: &structs.GroupByRequest{
+					GroupByColumns:    groupByCols,
+					MeasureOperations: timechartExpr.SingleAgg.MeasureOperations,
+				},
+			},
+			qid: inputIQR.GetQID(),
+		}
+		p.byValueCounts = make(map[string]int)
+	}
+
+	if p.otherByValues != nil {
+		err := p.replaceOtherByValues(inputIQR)
+		if err != nil {
+			return toputils.TeeErrorf("chart.aggregate: %v", err)
+		}
+	}
+
+	_, err := p.stats.Process(inputIQR)
+	if err != nil && err != io.EOF {
+		return toputils.TeeErrorf("chart.aggregate: failed to aggregate records; err=%v", err)
+	}
+
+	if timechartExpr.ByField == "" || timechartExpr.LimitExpr == nil ||
+		timechartExpr.LimitExpr.LimitScoreMode != structs.LSMByFreq {
+		return nil
+	}
+
+	byValues, err := inputIQR.ReadColumn(timechartExpr.ByField)
+	if err != nil {
+		// Every record has a null by value.
+		p.byValueCounts[utils.STR_VALTYPE_ENC_BACKFILL] += inputIQR.NumberOfRecords()
+		return nil
+	}
+
+	for i := range byValues {
+		if byValues[i].IsNull() {
+			p.byValueCounts[utils.STR_VALTYPE_ENC_BACKFILL]++
+		} else {
+			p.byValueCounts[string(byValues[i].AsBytes())]++
+		}
+	}
+
+	return nil
+}
+
+func (p *chartProcessor) buildChart(statsIQR *iqr.IQR) (*iqr.IQR, error) {
+	rows, measureNames, err := p.getChartRows(statsIQR)
+	if err != nil {
+		return nil, err
+	}
+
+	sortChartRows(rows)
+
+	byField := p.options.TimechartExpr.ByField
+	if byField == "" {
+		return p.getChartIQR(statsIQR.GetQID(), rows, []string{""}, measureNames, measureNames)
+	}
+
+	byColumns := p.applyLimit(rows)
+
+	outputNames := make([]string, 0, len(byColumns)*len(measureNames))
+	for _, measureName := range measureNames {
+		for _, byColumn := range byColumns {
+			if len(measureNames) == 1 {
+				outputNames = append(outputNames, byColumn)
+			} else {
+				outputNames = append(outputNames, fmt.Sprintf("%v: %v", measureName, byColumn))
+			}
+		}
+	}
+
+	return p.getChartIQR(statsIQR.GetQID(), rows, byColumns, measureNames, outputNames)
+}
+
+// Groups the stats rows by the over field. Also returns the measure names.
+func (p *chartProcessor) getChartRows(statsIQR *iqr.IQR) ([]*chartRow, []string, error) {
+	statsValues, err := statsIQR.ReadAllColumns()
+	if err != nil {
+		return nil, nil, toputils.TeeErrorf("chart.getChartRows: failed to read stats results; err=%v", err)
+	}
+
+	measureOperations := p.options.TimechartExpr.SingleAgg.MeasureOperations
+	measureNames := make([]string, len(measureOperations))
+	for i, measureAgg := range measureOperations {
+		measureNames[i] = measureAgg.String()
+	}
+
+	numStatsRows := statsIQR.NumberOfRecords()
+	overValues, ok := statsValues[p.options.OverField]
+	if !ok && numStatsRows > 0 {
+		return nil, nil, toputils.TeeErrorf("chart.getChartRows: missing over field %v", p.options.OverField)
+	}
+
+	byField := p.options.TimechartExpr.ByField
+	var byValues []utils.CValueEnclosure
+	if byField != "" {
+		byValues, ok = statsValues[byField]
+		if !ok && numStatsRows > 0 {
+			return nil, nil, toputils.TeeErrorf("chart.getChartRows: missing by field %v", byField)
+		}
+	}
+
+	rows := make([]*chartRow, 0)
+	overValueToRow := make(map[string]*chartRow)
+	for i := 0; i < numStatsRows; i++ {
+		overValue, err := overValues[i].GetString()
+		if err != nil || overValue == utils.STR_VALTYPE_ENC_BACKFILL {
+			// Like Splunk, skip records without an over value.
+			continue
+		}
+
+		row, ok := overValueToRow[overValue]
+		if !ok {
+			row = &chartRow{overValue: overValues[i], cells: make(map[string][]utils.CValueEnclosure)}
+			overValueToRow[overValue] = row
+			rows = append(rows, row)
+		}
+
+		byValue := ""
+		if byValues != nil {
+			byValue, err = byValues[i].GetString()
+			if err != nil {
+				continue
+			}
+		}
+
+		cell := make([]utils.CValueEnclosure, len(measureNames))
+		for j, measureName := range measureNames {
+			values, ok := statsValues[measureName]
+			if !ok {
+				cell[j] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+				continue
+			}
+			cell[j] = values[i]
+		}
+		row.cells[byValue] = cell
+	}
+
+	return rows, measureNames, nil
+}
+
+// Limits the number of by values that get their own column, and merges or
+// drops the rest based on the useother option. Returns the by values that
+// should be columns, in the order they should appear.
+func (p *chartProcessor) applyLimit(rows []*chartRow) []string {
+	tcOptions := p.options.TimechartExpr.TcOptions
+
+	var byColumns, otherColumns []string
+	var hasNullColumn bool
+	if p.keptByValues != nil {
+		// The other column was already aggregated in this pass.
+		byColumns = append([]string{}, p.keptByValues...)
+		hasNullColumn = hasChartColumn(rows, utils.STR_VALTYPE_ENC_BACKFILL)
+		if hasChartColumn(rows, tcOptions.OtherStr) {
+			otherColumns = []string{tcOptions.OtherStr}
+		}
+	} else {
+		byColumns, otherColumns, hasNullColumn = p.rankByValues(rows)
+	}
+	sort.Strings(byColumns)
+
+	if hasNullColumn && tcOptions.UseNull {
+		p.renameChartColumn(rows, utils.STR_VALTYPE_ENC_BACKFILL, tcOptions.NullStr)
+		byColumns = append(byColumns, tcOptions.NullStr)
+	}
+
+	if len(otherColumns) > 0 && tcOptions.UseOther {
+		if p.keptByValues == nil {
+			p.mergeIntoOtherColumn(rows, otherColumns, tcOptions.OtherStr)
+		}
+		byColumns = append(byColumns, tcOptions.OtherStr)
+	}
+
+	return byColumns
+}
+
+// Returns the by values within the limit, the ones past it, and whether any
+// row has a null by value.
+func (p *chartProcessor) rankByValues(rows []*chartRow) ([]string, []string, bool) {
+	limitExpr := p.options.TimechartExpr.LimitExpr
+
+	scores := make(map[string]float64)
+	hasNullColumn := false
+	for _, row := range rows {
+		for byValue, cell := range row.cells {
+			if byValue == utils.STR_VALTYPE_ENC_BACKFILL {
+				hasNullColumn = true
+				continue
+			}
+
+			if limitExpr != nil && limitExpr.LimitScoreMode == structs.LSMByFreq {
+				scores[byValue] = float64(p.byValueCounts[byValue])
+				continue
+			}
+
+			score, err := cell[0].GetFloatValue()
+			if err != nil {
+				score = 0
+			}
+			scores[byValue] += score
+		}
+	}
+
+	byColumns := toputils.GetKeysOfMap(scores)
+	sort.Slice(byColumns, func(i, j int) bool {
+		score1, score2 := scores[byColumns[i]], scores[byColumns[j]]
+		if score1 == score2 {
+			return byColumns[i] < byColumns[j]
+		}
+		if limitExpr == nil || limitExpr.IsTop {
+			return score1 > score2
+		}
+		return score1 < score2
+	})
+
+	otherColumns := []string{}
+	if limitExpr != nil && limitExpr.Num > 0 && len(byColumns) > limitExpr.Num {
+		otherColumns = byColumns[limitExpr.Num:]
+		byColumns = append([]string{}, byColumns[:limitExpr.Num]...)
+	}
+
+	return byColumns, otherColumns, hasNullColumn
+}
+
+func hasChartColumn(rows []*chartRow, byValue string) bool {
+	for _, row := range rows {
+		if _, ok := row.cells[byValue]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only count, sum, min, and max can be merged from the aggregated values of the
+// by values that go into the other column; anything else (like avg or dc)
+// needs a second pass that aggregates the records of those by values together.
+func chartNeedsOtherPass(options *structs.ChartExpr) bool {
+	if options == nil || options.TimechartExpr == nil || options.TimechartExpr.SingleAgg == nil {
+		return false
+	}
+
+	timechartExpr := options.TimechartExpr
+	if timechartExpr.ByField == "" || timechartExpr.TcOptions == nil || !timechartExpr.TcOptions.UseOther ||
+		timechartExpr.LimitExpr == nil || timechartExpr.LimitExpr.Num <= 0 {
+		return false
+	}
+
+	for _, measureOp := range timechartExpr.SingleAgg.MeasureOperations {
+		switch measureOp.MeasureFunc {
+		case utils.Count, utils.Sum, utils.Min, utils.Max:
+			continue
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *chartProcessor) findKeptByValues(statsIQR *iqr.IQR) error {
+	rows, _, err := p.getChartRows(statsIQR)
+	if err != nil {
+		return err
+	}
+
+	keptByValues, otherByValues, _ := p.rankByValues(rows)
+	p.keptByValues = keptByValues
+	p.otherByValues = make(map[string]struct{}, len(otherByValues))
+	for _, byValue := range otherByValues {
+		p.otherByValues[byValue] = struct{}{}
+	}
+
+	return nil
+}
+
+func (p *chartProcessor) replaceOtherByValues(inputIQR *iqr.IQR) error {
+	byField := p.options.TimechartExpr.ByField
+	byValues, err := inputIQR.ReadColumn(byField)
+	if err != nil {
+		// Every record has a null by value.
+		return nil
+	}
+
+	otherValue := utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: p.options.TimechartExpr.TcOptions.OtherStr}
+	newByValues := make([]utils.CValueEnclosure, len(byValues))
+	for i := range byValues {
+		newByValues[i] = byValues[i]
+		byValue, err := byValues[i].GetString()
+		if err != nil || byValues[i].IsNull() {
+			continue
+		}
+
+		if _, ok := p.otherByValues[byValue]; ok {
+			newByValues[i] = otherValue
+		}
+	}
+
+	err = inputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{byField: newByValues})
+	if err != nil {
+		return fmt.Errorf("failed to replace by values; err=%v", err)
+	}
+
+	return nil
+}
+
+func (p *chartProcessor) renameChartColumn(rows []*chartRow, oldName string, newName string) {
+	for _, row := range rows {
+		if cell, ok := row.cells[oldName]; ok {
+			delete(row.cells, oldName)
+			row.cells[newName] = cell
+		}
+	}
+}
+
+func (p *chartProcessor) mergeIntoOtherColumn(rows []*chartRow, otherColumns []string, otherStr string) {
+	measureOperations := p.options.TimechartExpr.SingleAgg.MeasureOperations
+
+	for _, row := range rows {
+		var otherCell []utils.CValueEnclosure
+		for _, byValue := range otherColumns {
+			cell, ok := row.cells[byValue]
+			if !ok {
+				continue
+			}
+
+			if otherCell == nil {
+				otherCell = make([]utils.CValueEnclosure, len(cell))
+				copy(otherCell, cell)
+				continue
+			}
+
+			for i := range otherCell {
+				if cell[i].IsNull() {
+					continue
+				}
+				if otherCell[i].IsNull() {
+					otherCell[i] = cell[i]
+					continue
+				}
+
+				aggregations.MergeVal(&otherCell[i], cell[i], nil, nil, nil, nil,
+					measureOperations[i].MeasureFunc, true)
+			}
+		}
+
+		if otherCell != nil {
+			row.cells[otherStr] = otherCell
+		}
+	}
+}
+
+// Each output column is for one measure and one by value. The outputNames are
+// ordered by measure, then by the byColumns. Without a by field, byColumns
+// should be a single empty string.
+func (p *chartProcessor) getChartIQR(qid uint64, rows []*chartRow, byColumns []string,
+	measureNames []string, outputNames []string) (*iqr.IQR, error) {
+
+	knownValues := make(map[string][]utils.CValueEnclosure, len(outputNames)+1)
+	columnIndex := make(map[string]int, len(outputNames)+1)
+
+	overValues := make([]utils.CValueEnclosure, len(rows))
+	for i, row := range rows {
+		overValues[i] = row.overValue
+	}
+	knownValues[p.options.OverField] = overValues
+	columnIndex[p.options.OverField] = 0
+
+	for measureIdx := range measureNames {
+		for byIdx, byColumn := range byColumns {
+			outputIdx := measureIdx*len(byColumns) + byIdx
+			outputName := outputNames[outputIdx]
+
+			values := make([]utils.CValueEnclosure, len(rows))
+			for i, row := range rows {
+				cell, ok := row.cells[byColumn]
+				if !ok {
+					values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+					continue
+				}
+				values[i] = cell[measureIdx]
+			}
+
+			knownValues[outputName] = values
+			columnIndex[outputName] = outputIdx + 1
+		}
+	}
+
+	outputIQR := iqr.NewIQR(qid)
+	err := outputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("chart.getChartIQR: failed to append known values; err=%v", err)
+	}
+	outputIQR.AddColumnIndex(columnIndex)
+
+	return outputIQR, nil
+}
+
+// Sorts numerically if every over value is a number; otherwise sorts
+// lexicographically.
+func sortChartRows(rows []*chartRow) {
+	overStrings := make([]string, len(rows))
+	overNumbers := make([]float64, len(rows))
+	allNumeric := true
+	for i, row := range rows {
+		overStrings[i], _ = row.overValue.GetString()
+		number, err := strconv.ParseFloat(overStrings[i], 64)
+		if err != nil {
+			allNumeric = false
+		}
+		overNumbers[i] = number
+	}
+
+	indices := make([]int, len(rows))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		if allNumeric {
+			return overNumbers[indices[i]] < overNumbers[indices[j]]
+		}
+		return overStrings[indices[i]] < overStrings[indices[j]]
+	})
+
+	sortedRows := make([]*chartRow, len(rows))
+	for i, idx := range indices {
+		sortedRows[i] = rows[idx]
+	}
+	copy(rows, sortedRows)
+}
+
+// The records are aggregated again after a rewind; in the second pass of a
+// two-pass chart, the by values found in the first pass are kept.
+func (p *chartProcessor) Rewind() {
+	// Keep the by values found in the first pass; the second pass needs them.
+	if p.stats != nil {
+		p.stats.Cleanup()
+		p.stats = nil
+	}
+
+	p.byValueCounts = nil
+}
+
+func (p *chartProcessor) Cleanup() {
+	if p.stats != nil {
+		p.stats.Cleanup()
+		p.stats = nil
+	}
+
+	p.byValueCounts = nil
+	p.keptByValues = nil
+	p.otherByValues = nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var chartTestValues = map[string][]utils.CValueEnclosure{
+	"endpoint": {
+		stringCVal("/b"), stringCVal("/a"), stringCVal("/a"), stringCVal("/b"),
+		stringCVal("/a"), stringCVal("/a"), stringCVal("/c"),
+	},
+	"status": {
+		stringCVal("200"), stringCVal("200"), stringCVal("500"), stringCVal("404"),
+		stringCVal("200"), backfillCVal(), stringCVal("200"),
+	},
+}
+
+func getChartTestExpr(byField string, limit int, useOther bool) *structs.ChartExpr {
+	return &structs.ChartExpr{
+		OverField: "endpoint",
+		TimechartExpr: &structs.TimechartExpr{
+			SingleAgg: &structs.SingleAgg{
+				MeasureOperations: []*structs.MeasureAggregator{
+					{MeasureCol: "*", MeasureFunc: utils.Count},
+				},
+			},
+			ByField: byField,
+			LimitExpr: &structs.LimitExpr{
+				IsTop:          true,
+				Num:            limit,
+				LimitScoreMode: structs.LSMBySum,
+			},
+			TcOptions: &structs.TcOptions{
+				UseNull:  true,
+				UseOther: useOther,
+				NullStr:  "null",
+				OtherStr: "other",
+			},
+		},
+	}
+}
+
+func getChartColumnAsFloats(t *testing.T, result *iqr.IQR, cname string) []float64 {
+	values, err := result.ReadColumn(cname)
+	assert.NoError(t, err)
+
+	floats := make([]float64, len(values))
+	for i := range values {
+		if values[i].IsNull() {
+			floats[i] = -1
+			continue
+		}
+
+		floats[i], err = values[i].GetFloatValue()
+		assert.NoError(t, err)
+	}
+
+	return floats
+}
+
+func Test_Chart_OverBy(t *testing.T) {
+	dp := NewChartDP(getChartTestExpr("status", 1, true))
+
+	output, err := dp.processor.Process(newTestIQR(t, chartTestValues))
+	assert.NoError(t, err)
+	assert.Nil(t, output)
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, 3, result.NumberOfRecords())
+
+	endpoints, err := result.ReadColumn("endpoint")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("/a"), stringCVal("/b"), stringCVal("/c")}, endpoints)
+
+	// Only the top status gets its own column; the rest are merged into other.
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"endpoint": {}, "200": {}, "null": {}, "other": {}}, columns)
+
+	assert.Equal(t, []float64{2, 1, 1}, getChartColumnAsFloats(t, result, "200"))
+	assert.Equal(t, []float64{1, 1, -1}, getChartColumnAsFloats(t, result, "other"))
+	assert.Equal(t, []float64{1, -1, -1}, getChartColumnAsFloats(t, result, "null"))
+}
+
+func Test_Chart_WithoutOther(t *testing.T) {
+	dp := NewChartDP(getChartTestExpr("status", 2, false))
+
+	_, err := dp.processor.Process(newTestIQR(t, chartTestValues))
+	assert.NoError(t, err)
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"endpoint": {}, "200": {}, "404": {}, "null": {}}, columns)
+	assert.Equal(t, []float64{-1, 1, -1}, getChartColumnAsFloats(t, result, "404"))
+}
+
+func Test_Chart_OverOnly(t *testing.T) {
+	dp := NewChartDP(getChartTestExpr("", 0, true))
+
+	_, err := dp.processor.Process(newTestIQR(t, chartTestValues))
+	assert.NoError(t, err)
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"endpoint": {}, "count(*)": {}}, columns)
+	assert.Equal(t, []float64{4, 2, 1}, getChartColumnAsFloats(t, result, "count(*)"))
+}
+
+func Test_Chart_OtherWithAvg(t *testing.T) {
+	chartExpr := getChartTestExpr("status", 1, true)
+	chartExpr.TimechartExpr.SingleAgg.MeasureOperations = []*structs.MeasureAggregator{
+		{MeasureCol: "latency", MeasureFunc: utils.Avg},
+	}
+
+	dp := NewChartDP(chartExpr)
+	assert.True(t, dp.IsTwoPassCmd())
+
+	input := NewMakeresultsDP(&structs.MakeResultsExpr{
+		Format: "csv",
+		Data: `endpoint,status,latency
+			/a,200,10
+			/a,500,1
+			/a,404,3
+			/b,200,20
+			/b,404,5`,
+	})
+	dp.streams = append(dp.streams, NewCachedStream(&separateEOFStreamer{stream: input}))
+
+	result, err := dp.Fetch()
+	assert.Equal(t, io.EOF, err)
+	assert.NotNil(t, result)
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"endpoint": {}, "200": {}, "other": {}}, columns)
+
+	// The other column averages the records of both merged statuses, rather
+	// than combining their averages.
+	assert.Equal(t, []float64{10, 20}, getChartColumnAsFloats(t, result, "200"))
+	assert.Equal(t, []float64{2, 5}, getChartColumnAsFloats(t, result, "other"))
+}
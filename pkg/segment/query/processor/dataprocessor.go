@@ -21,6 +21,7 @@ import (
 	"errors"
 	"io"
 
+	"github.com/siglens/siglens/pkg/segment/query"
 	"github.com/siglens/siglens/pkg/segment/query/iqr"
 	"github.com/siglens/siglens/pkg/segment/structs"
 	"github.com/siglens/siglens/pkg/utils"
@@ -43,6 +44,10 @@ type DataProcessor struct {
 	isBottleneckCmd   bool // This command must see all input before yielding any output.
 	isTwoPassCmd      bool // A subset of bottleneck commands.
 	finishedFirstPass bool // Only used for two-pass commands.
+
+	// This command must get a nil input after its last input, even when the
+	// last input came along with the EOF.
+	needsEndOfInput bool
 }
 
 func (dp *DataProcessor) DoesInputOrderMatter() bool {
@@ -90,6 +95,13 @@ func (dp *DataProcessor) Fetch() (*iqr.IQR, error) {
 			gotEOF = true
 		} else if err != nil {
 			return nil, utils.TeeErrorf("DP.Fetch: failed to process input: %v", err)
+		} else if gotEOF && input != nil && dp.needsEndOfInput {
+			// The last input came along with the EOF, so the processor
+			// hasn't been told yet that there's no more input.
+			output, err = dp.processEndOfInput(output)
+			if err != nil {
+				return nil, utils.TeeErrorf("DP.Fetch: failed to process end of input: %v", err)
+			}
 		}
 
 		if gotEOF {
@@ -108,9 +120,27 @@ func (dp *DataProcessor) Fetch() (*iqr.IQR, error) {
 	}
 }
 
+func (dp *DataProcessor) processEndOfInput(output *iqr.IQR) (*iqr.IQR, error) {
+	finalOutput, err := dp.processor.Process(nil)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if output == nil {
+		return finalOutput, nil
+	}
+
+	err = output.Append(finalOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
 func (dp *DataProcessor) IsDataGenerator() bool {
 	switch dp.processor.(type) {
-	case *gentimesProcessor:
+	case *gentimesProcessor, *makeresultsProcessor, *tstatsProcessor:
 		return true
 	default:
 		return false
@@ -201,6 +231,18 @@ func NewBinDP(options *structs.BinCmdOptions) *DataProcessor {
 	}
 }
 
+func NewChartDP(options *structs.ChartExpr) *DataProcessor {
+	needsOtherPass := chartNeedsOtherPass(options)
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &chartProcessor{options: options, needsOtherPass: needsOtherPass},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   true,
+		isTwoPassCmd:      needsOtherPass,
+	}
+}
+
 func NewDedupDP(options *structs.DedupExpr) *DataProcessor {
 	hasSort := len(options.DedupSortEles) > 0
 	return &DataProcessor{
@@ -224,6 +266,17 @@ func NewEvalDP(options *structs.EvalExpr) *DataProcessor {
 	}
 }
 
+func NewEventstatsDP(options *structs.EventstatsExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &eventstatsProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   true,
+		isTwoPassCmd:      true,
+	}
+}
+
 func NewFieldsDP(options *structs.ColumnsRequest) *DataProcessor {
 	return &DataProcessor{
 		streams:           make([]*cachedStream, 0),
@@ -247,6 +300,17 @@ func NewFillnullDP(options *structs.FillNullExpr) *DataProcessor {
 	}
 }
 
+func NewForeachDP(options *structs.ForeachExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &foreachProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
 func NewGentimesDP(options *structs.GenTimes) *DataProcessor {
 	return &DataProcessor{
 		streams: make([]*cachedStream, 0),
@@ -261,6 +325,18 @@ func NewGentimesDP(options *structs.GenTimes) *DataProcessor {
 	}
 }
 
+func NewGeostatsDP(options *structs.GeostatsExpr) *DataProcessor {
+	processor := &geostatsProcessor{options: options}
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         processor,
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   true,
+		isTwoPassCmd:      chartNeedsOtherPass(processor.getChartExpr()),
+	}
+}
+
 func NewHeadDP(options *structs.HeadExpr) *DataProcessor {
 	return &DataProcessor{
 		streams:           make([]*cachedStream, 0),
@@ -272,6 +348,73 @@ func NewHeadDP(options *structs.HeadExpr) *DataProcessor {
 	}
 }
 
+func NewIPLocationDP(options *structs.IPLocationExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &iplocationProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewJoinDP(options *structs.JoinExpr, queryInfo *query.QueryInformation) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &joinProcessor{options: options, parentQueryInfo: queryInfo},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewLogfmtDP(options *structs.ColumnsRequest) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &logfmtProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewLookupDP(options *structs.LookupExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &lookupProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewOutputLookupDP(options *structs.OutputLookupExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &outputlookupProcessor{options: options},
+		inputOrderMatters: true,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   true, // A head after this must not stop it early.
+		isTwoPassCmd:      false,
+		needsEndOfInput:   true, // The lookup file is written at the end.
+	}
+}
+
+func NewMakeresultsDP(options *structs.MakeResultsExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &makeresultsProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
 func NewTailDP(options *structs.TailExpr) *DataProcessor {
 	return &DataProcessor{
 		streams:           make([]*cachedStream, 0),
@@ -403,3 +546,36 @@ func NewSortDP(options *structs.SortExpr) *DataProcessor {
 		isTwoPassCmd:      false,
 	}
 }
+
+func NewTstatsDP(options *structs.TstatsExpr, queryInfo *query.QueryInformation) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &tstatsProcessor{options: options, queryInfo: queryInfo},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewUntableDP(options *structs.UntableExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &untableProcessor{options: options},
+		inputOrderMatters: false,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   false,
+		isTwoPassCmd:      false,
+	}
+}
+
+func NewXyseriesDP(options *structs.XyseriesExpr) *DataProcessor {
+	return &DataProcessor{
+		streams:           make([]*cachedStream, 0),
+		processor:         &xyseriesProcessor{options: options},
+		inputOrderMatters: true,
+		isPermutingCmd:    false,
+		isBottleneckCmd:   true,
+		isTwoPassCmd:      false,
+	}
+}
@@ -53,9 +53,10 @@ func Test_Getters(t *testing.T) {
 }
 
 type mockStreamer struct {
-	allRecords map[string][]utils.CValueEnclosure
-	numSent    int
-	qid        uint64
+	allRecords      map[string][]utils.CValueEnclosure
+	numSent         int
+	qid             uint64
+	sendEOFWithLast bool
 }
 
 func (ms *mockStreamer) Fetch() (*iqr.IQR, error) {
@@ -75,6 +76,10 @@ func (ms *mockStreamer) Fetch() (*iqr.IQR, error) {
 	}
 
 	ms.numSent++
+	if ms.sendEOFWithLast && ms.numSent == len(ms.allRecords["col1"]) {
+		return iqr, io.EOF
+	}
+
 	return iqr, nil
 }
 
@@ -82,6 +87,32 @@ func (ms *mockStreamer) Rewind() {
 	ms.numSent = 0
 }
 
+// Sends the records that a stream sends along with its EOF in one fetch, and
+// the EOF in the next fetch, the way the searcher does.
+type separateEOFStreamer struct {
+	stream streamer
+	gotEOF bool
+}
+
+func (s *separateEOFStreamer) Fetch() (*iqr.IQR, error) {
+	if s.gotEOF {
+		return nil, io.EOF
+	}
+
+	output, err := s.stream.Fetch()
+	if err == io.EOF && output != nil {
+		s.gotEOF = true
+		return output, nil
+	}
+
+	return output, err
+}
+
+func (s *separateEOFStreamer) Rewind() {
+	s.stream.Rewind()
+	s.gotEOF = false
+}
+
 type passThroughProcessor struct{}
 
 func (ptp *passThroughProcessor) Process(input *iqr.IQR) (*iqr.IQR, error) {
@@ -125,14 +156,16 @@ func Test_Fetch_nonBottleneck(t *testing.T) {
 }
 
 type mockBottleneckProcessor struct {
-	numSeen     int
-	lastSeenIQR *iqr.IQR
+	numSeen      int
+	numNilInputs int
+	lastSeenIQR  *iqr.IQR
 }
 
 func (mbp *mockBottleneckProcessor) Process(input *iqr.IQR) (*iqr.IQR, error) {
 	defer func() { mbp.lastSeenIQR = input }()
 
 	if input == nil {
+		mbp.numNilInputs++
 		return mbp.lastSeenIQR, io.EOF
 	}
 
@@ -168,6 +201,48 @@ func Test_Fetch_bottleneck(t *testing.T) {
 	assert.Equal(t, 3, dp.processor.(*mockBottleneckProcessor).numSeen)
 }
 
+func Test_Fetch_bottleneckLastInputWithEOF(t *testing.T) {
+	getStream := func() *mockStreamer {
+		return &mockStreamer{
+			allRecords: map[string][]utils.CValueEnclosure{
+				"col1": {
+					utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: "a"},
+					utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: "b"},
+				},
+			},
+			qid:             0,
+			sendEOFWithLast: true,
+		}
+	}
+
+	// Only a processor that asks for it is told about the end of the input
+	// after its last input.
+	dp := &DataProcessor{
+		streams:         []*cachedStream{{getStream(), nil, false}},
+		processor:       &mockBottleneckProcessor{},
+		isBottleneckCmd: true,
+	}
+
+	output, err := dp.Fetch()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 1, output.NumberOfRecords())
+	assert.Equal(t, 2, dp.processor.(*mockBottleneckProcessor).numSeen)
+	assert.Equal(t, 0, dp.processor.(*mockBottleneckProcessor).numNilInputs)
+
+	dp = &DataProcessor{
+		streams:         []*cachedStream{{getStream(), nil, false}},
+		processor:       &mockBottleneckProcessor{},
+		isBottleneckCmd: true,
+		needsEndOfInput: true,
+	}
+
+	output, err = dp.Fetch()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, output.NumberOfRecords())
+	assert.Equal(t, 2, dp.processor.(*mockBottleneckProcessor).numSeen)
+	assert.Equal(t, 1, dp.processor.(*mockBottleneckProcessor).numNilInputs)
+}
+
 func Test_Fetch_twoPass(t *testing.T) {
 	stream := &mockStreamer{
 		allRecords: map[string][]utils.CValueEnclosure{
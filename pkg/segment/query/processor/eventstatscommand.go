@@ -0,0 +1,229 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+type eventstatsProcessor struct {
+	options *structs.EventstatsExpr
+
+	// The first pass feeds every record into this; the second pass adds the
+	// aggregated values to each record.
+	stats      *statsProcessor
+	secondPass bool
+
+	// These are populated at the start of the second pass.
+	loadedStats  bool
+	groupByCols  []string
+	measureNames []string
+	keyToRow     map[string]int
+	statsValues  map[string][]utils.CValueEnclosure
+}
+
+func (p *eventstatsProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	if !p.secondPass {
+		if p.stats == nil {
+			p.stats = &statsProcessor{options: p.options.StatsExpr, qid: inputIQR.GetQID()}
+		}
+
+		_, err := p.stats.Process(inputIQR)
+		if err != nil && err != io.EOF {
+			return nil, toputils.TeeErrorf("eventstats.Process: failed to aggregate records; err=%v", err)
+		}
+
+		return inputIQR, nil
+	}
+
+	if !p.loadedStats {
+		err := p.loadStats()
+		if err != nil {
+			return nil, toputils.TeeErrorf("eventstats.Process: failed to load stats; err=%v", err)
+		}
+	}
+
+	numRecords := inputIQR.NumberOfRecords()
+	if numRecords == 0 {
+		return inputIQR, nil
+	}
+
+	// The i-th element is the stats row for the i-th record, or -1 if there's
+	// no stats row for it.
+	statsRows := make([]int, numRecords)
+	p.findStatsRows(inputIQR, statsRows)
+
+	knownValues := make(map[string][]utils.CValueEnclosure, len(p.measureNames))
+	for _, measureName := range p.measureNames {
+		statsValues, ok := p.statsValues[measureName]
+		if !ok {
+			continue
+		}
+
+		values := make([]utils.CValueEnclosure, numRecords)
+		for i, row := range statsRows {
+			if row < 0 {
+				values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			} else {
+				values[i] = statsValues[row]
+			}
+		}
+
+		outputName := measureName
+		if newName, ok := p.options.RenameColumns[measureName]; ok {
+			outputName = newName
+		}
+		knownValues[outputName] = values
+	}
+
+	err := inputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("eventstats.Process: failed to append known values; err=%v", err)
+	}
+
+	return inputIQR, nil
+}
+
+func (p *eventstatsProcessor) findStatsRows(inputIQR *iqr.IQR, statsRows []int) {
+	for i := range statsRows {
+		statsRows[i] = -1
+	}
+
+	if len(p.groupByCols) == 0 {
+		if len(p.keyToRow) > 0 {
+			// Every record gets the same aggregated values.
+			for i := range statsRows {
+				statsRows[i] = 0
+			}
+		}
+		return
+	}
+
+	groupByValues := make([][]utils.CValueEnclosure, len(p.groupByCols))
+	for i, cname := range p.groupByCols {
+		values, err := inputIQR.ReadColumn(cname)
+		if err != nil || len(values) != len(statsRows) {
+			// Records without a group by field don't get any values.
+			return
+		}
+		groupByValues[i] = values
+	}
+
+	for i := range statsRows {
+		key, ok := getCompositeKey(groupByValues, i)
+		if !ok {
+			continue
+		}
+
+		if row, ok := p.keyToRow[key]; ok {
+			statsRows[i] = row
+		}
+	}
+}
+
+func (p *eventstatsProcessor) loadStats() error {
+	p.loadedStats = true
+	p.keyToRow = make(map[string]int)
+
+	if p.stats == nil {
+		// There was no input.
+		return nil
+	}
+
+	statsIQR, err := p.stats.Process(nil)
+	if err != nil && err != io.EOF {
+		return toputils.TeeErrorf("eventstats.loadStats: failed to get stats results; err=%v", err)
+	}
+	if statsIQR == nil {
+		return nil
+	}
+
+	statsValues, err := statsIQR.ReadAllColumns()
+	if err != nil {
+		return toputils.TeeErrorf("eventstats.loadStats: failed to read stats results; err=%v", err)
+	}
+	p.statsValues = statsValues
+
+	measureOperations := p.options.StatsExpr.MeasureOperations
+	if p.options.StatsExpr.GroupByRequest != nil {
+		measureOperations = p.options.StatsExpr.GroupByRequest.MeasureOperations
+		p.groupByCols = p.options.StatsExpr.GroupByRequest.GroupByColumns
+	}
+
+	p.measureNames = make([]string, len(measureOperations))
+	for i, measureAgg := range measureOperations {
+		p.measureNames[i] = measureAgg.String()
+	}
+
+	numRows := statsIQR.NumberOfRecords()
+	if len(p.groupByCols) == 0 {
+		if numRows > 0 {
+			p.keyToRow[""] = 0
+		}
+		return nil
+	}
+
+	// The stats results store each group by value as the string form of the
+	// original value, so these keys match the keys of the original records.
+	groupByValues := make([][]utils.CValueEnclosure, len(p.groupByCols))
+	for i, cname := range p.groupByCols {
+		values, ok := statsValues[cname]
+		if !ok {
+			return toputils.TeeErrorf("eventstats.loadStats: missing group by column %v", cname)
+		}
+		groupByValues[i] = values
+	}
+
+	for row := 0; row < numRows; row++ {
+		key, ok := getCompositeKey(groupByValues, row)
+		if ok {
+			p.keyToRow[key] = row
+		}
+	}
+
+	return nil
+}
+
+// In the two-pass version of eventstats, Rewind() should remember the
+// aggregations from the first pass.
+func (p *eventstatsProcessor) Rewind() {
+	p.secondPass = true
+}
+
+func (p *eventstatsProcessor) Cleanup() {
+	if p.stats != nil {
+		p.stats.Cleanup()
+		p.stats = nil
+	}
+
+	p.secondPass = false
+	p.loadedStats = false
+	p.groupByCols = nil
+	p.measureNames = nil
+	p.keyToRow = nil
+	p.statsValues = nil
+}
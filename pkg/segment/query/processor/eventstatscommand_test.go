@@ -0,0 +1,112 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var eventstatsTestValues = map[string][]utils.CValueEnclosure{
+	"service": {stringCVal("web"), stringCVal("db"), stringCVal("web"), backfillCVal()},
+	"latency": {intCVal(10), intCVal(40), intCVal(30), intCVal(100)},
+}
+
+func Test_Eventstats_GroupBy(t *testing.T) {
+	dp := NewEventstatsDP(&structs.EventstatsExpr{
+		StatsExpr: &structs.StatsExpr{
+			GroupByRequest: &structs.GroupByRequest{
+				GroupByColumns: []string{"service"},
+				MeasureOperations: []*structs.MeasureAggregator{
+					{MeasureCol: "latency", MeasureFunc: utils.Avg},
+					{MeasureCol: "latency", MeasureFunc: utils.Max},
+				},
+			},
+		},
+		RenameColumns: map[string]string{"avg(latency)": "avg_latency"},
+	})
+
+	// First pass.
+	result, err := dp.processor.Process(newTestIQR(t, eventstatsTestValues))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.NumberOfRecords())
+	_, err = dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+
+	dp.processor.Rewind()
+
+	// Second pass.
+	result, err = dp.processor.Process(newTestIQR(t, eventstatsTestValues))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.NumberOfRecords())
+
+	averages, err := result.ReadColumn("avg_latency")
+	assert.NoError(t, err)
+	assert.Len(t, averages, 4)
+	for i, expected := range []float64{20, 40, 20} {
+		value, err := averages[i].GetFloatValue()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+	assert.True(t, averages[3].IsNull())
+
+	maxes, err := result.ReadColumn("max(latency)")
+	assert.NoError(t, err)
+	assert.Len(t, maxes, 4)
+	for i, expected := range []float64{30, 40, 30} {
+		value, err := maxes[i].GetFloatValue()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+	assert.True(t, maxes[3].IsNull())
+
+	// The original columns are unchanged.
+	latencies, err := result.ReadColumn("latency")
+	assert.NoError(t, err)
+	assert.Equal(t, utils.CValueEnclosure{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(100)}, latencies[3])
+}
+
+func Test_Eventstats_NoGroupBy(t *testing.T) {
+	dp := NewEventstatsDP(&structs.EventstatsExpr{
+		StatsExpr: &structs.StatsExpr{
+			MeasureOperations: []*structs.MeasureAggregator{
+				{MeasureCol: "latency", MeasureFunc: utils.Sum},
+			},
+		},
+	})
+
+	_, err := dp.processor.Process(newTestIQR(t, eventstatsTestValues))
+	assert.NoError(t, err)
+	dp.processor.Rewind()
+
+	result, err := dp.processor.Process(newTestIQR(t, eventstatsTestValues))
+	assert.NoError(t, err)
+
+	sums, err := result.ReadColumn("sum(latency)")
+	assert.NoError(t, err)
+	assert.Len(t, sums, 4)
+	for _, sum := range sums {
+		value, err := sum.GetFloatValue()
+		assert.NoError(t, err)
+		assert.Equal(t, float64(180), value)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+type foreachProcessor struct {
+	options        *structs.ForeachExpr
+	patternRegexes []*regexp.Regexp
+	fieldToEvals   map[string][]*evalProcessor
+}
+
+func (p *foreachProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	if p.patternRegexes == nil {
+		err := p.compilePatterns()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only expand against the columns we started with, so columns created by
+	// the template are not matched again.
+	columns, err := inputIQR.GetColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("foreach.Process: cannot get columns; err=%v", err)
+	}
+	fields := toputils.GetKeysOfMap(columns)
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, eval := range p.getEvals(field) {
+			inputIQR, err = eval.Process(inputIQR)
+			if err != nil {
+				return nil, toputils.TeeErrorf("foreach.Process: cannot evaluate template for field %v; err=%v", field, err)
+			}
+		}
+	}
+
+	return inputIQR, nil
+}
+
+func (p *foreachProcessor) Rewind() {
+	// Nothing to do.
+}
+
+func (p *foreachProcessor) Cleanup() {
+	p.fieldToEvals = nil
+}
+
+func (p *foreachProcessor) compilePatterns() error {
+	p.patternRegexes = make([]*regexp.Regexp, 0, len(p.options.FieldPatterns))
+	for _, pattern := range p.options.FieldPatterns {
+		// Capture the part matched by each wildcard.
+		parts := strings.Split(pattern, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+
+		compiledRegex, err := regexp.Compile("^" + strings.Join(parts, "(.*)") + "$")
+		if err != nil {
+			return toputils.TeeErrorf("foreach.compilePatterns: cannot compile pattern %v; err=%v", pattern, err)
+		}
+		p.patternRegexes = append(p.patternRegexes, compiledRegex)
+	}
+
+	return nil
+}
+
+// Returns nothing if the field doesn't match any pattern. Each field only uses
+// the first pattern it matches.
+func (p *foreachProcessor) getEvals(field string) []*evalProcessor {
+	if evals, ok := p.fieldToEvals[field]; ok {
+		return evals
+	}
+
+	if p.fieldToEvals == nil {
+		p.fieldToEvals = make(map[string][]*evalProcessor)
+	}
+
+	var evals []*evalProcessor
+	for _, patternRegex := range p.patternRegexes {
+		match := patternRegex.FindStringSubmatch(field)
+		if match == nil {
+			continue
+		}
+
+		replacer := p.options.GetPlaceholderReplacer(field, match[1:])
+		evals = make([]*evalProcessor, len(p.options.Evals))
+		for i, evalExpr := range p.options.Evals {
+			expanded := copyWithReplacements(reflect.ValueOf(evalExpr), replacer)
+			evals[i] = &evalProcessor{options: expanded.Interface().(*structs.EvalExpr)}
+		}
+		break
+	}
+
+	p.fieldToEvals[field] = evals
+
+	return evals
+}
+
+// Returns a deep copy of the value with the replacements made in every string
+// it has, such as field names and string literals. Unexported fields are
+// copied as-is.
+func copyWithReplacements(value reflect.Value, replacer *strings.Replacer) reflect.Value {
+	switch value.Kind() {
+	case reflect.String:
+		result := reflect.New(value.Type()).Elem()
+		result.SetString(replacer.Replace(value.String()))
+		return result
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.New(value.Type().Elem())
+		result.Elem().Set(copyWithReplacements(value.Elem(), replacer))
+		return result
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.New(value.Type()).Elem()
+		result.Set(copyWithReplacements(value.Elem(), replacer))
+		return result
+	case reflect.Struct:
+		result := reflect.New(value.Type()).Elem()
+		result.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if result.Field(i).CanSet() {
+				result.Field(i).Set(copyWithReplacements(value.Field(i), replacer))
+			}
+		}
+		return result
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			result.Index(i).Set(copyWithReplacements(value.Index(i), replacer))
+		}
+		return result
+	case reflect.Array:
+		result := reflect.New(value.Type()).Elem()
+		for i := 0; i < value.Len(); i++ {
+			result.Index(i).Set(copyWithReplacements(value.Index(i), replacer))
+		}
+		return result
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(copyWithReplacements(iter.Key(), replacer), copyWithReplacements(iter.Value(), replacer))
+		}
+		return result
+	default:
+		return value
+	}
+}
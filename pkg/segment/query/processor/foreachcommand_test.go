@@ -0,0 +1,131 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// The real parser lives in the SPL package, which can't be imported here. This
+// only handles templates like "eval newField = field * 1000".
+func parseForeachTestTemplate(t *testing.T, template string) []*structs.EvalExpr {
+	t.Helper()
+
+	match := regexp.MustCompile(`^eval (\S+) = (\S+) \* (\d+)$`).FindStringSubmatch(template)
+	assert.NotNil(t, match, "unsupported template: %v", template)
+
+	return []*structs.EvalExpr{{
+		FieldName: match[1],
+		ValueExpr: &structs.ValueExpr{
+			ValueExprMode: structs.VEMNumericExpr,
+			NumericExpr: &structs.NumericExpr{
+				NumericExprMode: structs.NEMNumericExpr,
+				Op:              "*",
+				Left: &structs.NumericExpr{
+					NumericExprMode: structs.NEMNumberField,
+					IsTerminal:      true,
+					ValueIsField:    true,
+					Value:           match[2],
+				},
+				Right: &structs.NumericExpr{
+					NumericExprMode: structs.NEMNumber,
+					IsTerminal:      true,
+					Value:           match[3],
+				},
+			},
+		},
+	}}
+}
+
+func getForeachTestExpr(t *testing.T, fieldPatterns []string, template string) *structs.ForeachExpr {
+	t.Helper()
+
+	foreachExpr := &structs.ForeachExpr{FieldPatterns: fieldPatterns, Template: template}
+	foreachExpr.Evals = parseForeachTestTemplate(t, foreachExpr.GetParseableTemplate())
+
+	return foreachExpr
+}
+
+var foreachTestValues = map[string][]utils.CValueEnclosure{
+	"latency_p50": {intCVal(1), intCVal(2)},
+	"latency_p99": {intCVal(10), intCVal(20)},
+	"host":        {stringCVal("a"), stringCVal("b")},
+}
+
+func Test_Foreach_Field(t *testing.T) {
+	foreachExpr := getForeachTestExpr(t, []string{"latency_*"}, "eval <<FIELD>>_ms = <<FIELD>> * 1000")
+	processor := &foreachProcessor{options: foreachExpr}
+
+	result, err := processor.Process(newTestIQR(t, foreachTestValues))
+	assert.NoError(t, err)
+
+	values, err := result.ReadColumn("latency_p50_ms")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(1000), floatCVal(2000)}, values)
+
+	values, err = result.ReadColumn("latency_p99_ms")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(10000), floatCVal(20000)}, values)
+
+	// The new columns also match the pattern, but they shouldn't be expanded.
+	_, err = result.ReadColumn("latency_p50_ms_ms")
+	assert.Error(t, err)
+
+	// The expanded evals are reused across batches.
+	_, err = processor.Process(newTestIQR(t, foreachTestValues))
+	assert.NoError(t, err)
+	assert.Len(t, processor.fieldToEvals, 3)
+	assert.Equal(t, "latency_p50_ms", processor.fieldToEvals["latency_p50"][0].options.FieldName)
+	assert.Empty(t, processor.fieldToEvals["host"])
+
+	// Expanding for a field doesn't change the parsed template.
+	assert.Equal(t, parseForeachTestTemplate(t, foreachExpr.GetParseableTemplate()), foreachExpr.Evals)
+}
+
+func Test_Foreach_MatchSegments(t *testing.T) {
+	processor := &foreachProcessor{options: getForeachTestExpr(t, []string{"*_p*"},
+		"eval <<MATCHSEG1>>_<<MATCHSEG2>>_<<MATCHSTR>> = <<FIELD>> * 2")}
+
+	result, err := processor.Process(newTestIQR(t, foreachTestValues))
+	assert.NoError(t, err)
+
+	values, err := result.ReadColumn("latency_50_latency50")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(2), floatCVal(4)}, values)
+
+	values, err = result.ReadColumn("latency_99_latency99")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(20), floatCVal(40)}, values)
+}
+
+func Test_Foreach_NoMatches(t *testing.T) {
+	processor := &foreachProcessor{options: getForeachTestExpr(t, []string{"bytes_*"}, "eval <<FIELD>>_kb = <<FIELD>> * 1024")}
+
+	result, err := processor.Process(newTestIQR(t, foreachTestValues))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Len(t, columns, 3)
+}
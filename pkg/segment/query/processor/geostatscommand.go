@@ -0,0 +1,227 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+const geostatsBinField = "geobin"
+
+// Bins records by latitude and longitude, then aggregates each bin like
+// chart does over the bin.
+type geostatsProcessor struct {
+	options   *structs.GeostatsExpr
+	chart     *chartProcessor
+	centroids map[string]*geostatsCentroid // Bin name -> centroid of its records.
+}
+
+type geostatsCentroid struct {
+	latSum  float64
+	longSum float64
+	count   int
+}
+
+func (p *geostatsProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR != nil {
+		return nil, p.aggregate(inputIQR)
+	}
+
+	if p.chart == nil {
+		// There was no input.
+		return nil, io.EOF
+	}
+
+	chartIQR, err := p.chart.Process(nil)
+	if err != nil && err != io.EOF {
+		return nil, toputils.TeeErrorf("geostats.Process: failed to get chart results; err=%v", err)
+	}
+	if chartIQR == nil {
+		return nil, io.EOF
+	}
+
+	outputIQR, err := p.addCentroids(chartIQR)
+	if err != nil {
+		return nil, toputils.TeeErrorf("geostats.Process: %v", err)
+	}
+
+	return outputIQR, io.EOF
+}
+
+func (p *geostatsProcessor) aggregate(inputIQR *iqr.IQR) error {
+	if p.chart == nil {
+		chartExpr := p.getChartExpr()
+		p.chart = &chartProcessor{options: chartExpr, needsOtherPass: chartNeedsOtherPass(chartExpr)}
+	}
+	if p.centroids == nil {
+		p.centroids = make(map[string]*geostatsCentroid)
+	}
+
+	numRecords := inputIQR.NumberOfRecords()
+	bins := make([]utils.CValueEnclosure, numRecords)
+	for i := range bins {
+		bins[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+	}
+
+	latValues, latErr := inputIQR.ReadColumn(p.options.LatField)
+	longValues, longErr := inputIQR.ReadColumn(p.options.LongField)
+	if latErr == nil && longErr == nil {
+		for i := 0; i < numRecords; i++ {
+			lat, err := latValues[i].GetFloatValue()
+			if err != nil || lat < -90 || lat > 90 {
+				continue
+			}
+			long, err := longValues[i].GetFloatValue()
+			if err != nil || long < -180 || long > 180 {
+				continue
+			}
+
+			bin := p.getBin(lat, long)
+			bins[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: bin}
+
+			centroid, ok := p.centroids[bin]
+			if !ok {
+				centroid = &geostatsCentroid{}
+				p.centroids[bin] = centroid
+			}
+			centroid.latSum += lat
+			centroid.longSum += long
+			centroid.count++
+		}
+	}
+
+	err := inputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{geostatsBinField: bins})
+	if err != nil {
+		return toputils.TeeErrorf("geostats.aggregate: failed to append bins; err=%v", err)
+	}
+
+	_, err = p.chart.Process(inputIQR)
+	if err != nil && err != io.EOF {
+		return toputils.TeeErrorf("geostats.aggregate: failed to aggregate records; err=%v", err)
+	}
+
+	return nil
+}
+
+// Uses the same bin names as Splunk at zoom level 0.
+func (p *geostatsProcessor) getBin(lat float64, long float64) string {
+	latBin := int(math.Floor((lat + 90) / p.options.BinSpanLat))
+	longBin := int(math.Floor((long + 180) / p.options.BinSpanLong))
+
+	return fmt.Sprintf("bin_id_zl_0_y_%v_x_%v", latBin, longBin)
+}
+
+func (p *geostatsProcessor) getChartExpr() *structs.ChartExpr {
+	timechartExpr := &structs.TimechartExpr{
+		SingleAgg: &structs.SingleAgg{
+			MeasureOperations: p.options.MeasureOperations,
+		},
+		ByField: p.options.ByField,
+		TcOptions: &structs.TcOptions{
+			UseNull:  true,
+			UseOther: true,
+			NullStr:  "NULL",
+			OtherStr: "OTHER",
+		},
+	}
+
+	if p.options.GlobalLimit > 0 {
+		timechartExpr.LimitExpr = &structs.LimitExpr{
+			IsTop:          true,
+			Num:            p.options.GlobalLimit,
+			LimitScoreMode: structs.LSMBySum,
+		}
+	}
+
+	return &structs.ChartExpr{
+		OverField:     geostatsBinField,
+		TimechartExpr: timechartExpr,
+	}
+}
+
+// Adds the centroid of each bin right after the bin column.
+func (p *geostatsProcessor) addCentroids(chartIQR *iqr.IQR) (*iqr.IQR, error) {
+	knownValues, err := chartIQR.ReadAllColumns()
+	if err != nil {
+		return nil, fmt.Errorf("geostats.addCentroids: failed to read chart results; err=%v", err)
+	}
+	columnOrder := chartIQR.GetColumnsOrder(toputils.GetKeysOfMap(knownValues))
+
+	bins := knownValues[geostatsBinField]
+	latValues := make([]utils.CValueEnclosure, len(bins))
+	longValues := make([]utils.CValueEnclosure, len(bins))
+	for i := range bins {
+		bin, _ := bins[i].GetString()
+		centroid, ok := p.centroids[bin]
+		if !ok || centroid.count == 0 {
+			latValues[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			longValues[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			continue
+		}
+
+		latValues[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: centroid.latSum / float64(centroid.count)}
+		longValues[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: centroid.longSum / float64(centroid.count)}
+	}
+	knownValues[p.options.OutputLatField] = latValues
+	knownValues[p.options.OutputLongField] = longValues
+
+	columnIndex := map[string]int{
+		geostatsBinField:          0,
+		p.options.OutputLatField:  1,
+		p.options.OutputLongField: 2,
+	}
+	nextIndex := 3
+	for _, column := range columnOrder {
+		if _, ok := columnIndex[column]; !ok {
+			columnIndex[column] = nextIndex
+			nextIndex++
+		}
+	}
+
+	outputIQR := iqr.NewIQR(chartIQR.GetQID())
+	err = outputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, fmt.Errorf("geostats.addCentroids: failed to append known values; err=%v", err)
+	}
+	outputIQR.AddColumnIndex(columnIndex)
+
+	return outputIQR, nil
+}
+
+// The records are aggregated again after a rewind, so this keeps the chart's
+// state from the first pass but not the centroids.
+func (p *geostatsProcessor) Rewind() {
+	if p.chart != nil {
+		p.chart.Rewind()
+	}
+	p.centroids = nil
+}
+
+func (p *geostatsProcessor) Cleanup() {
+	if p.chart != nil {
+		p.chart.Cleanup()
+	}
+	p.centroids = nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var geostatsTestValues = map[string][]utils.CValueEnclosure{
+	"lat": {
+		floatCVal(51.5), floatCVal(48.8), floatCVal(40.5), floatCVal(42.5), backfillCVal(), floatCVal(91),
+	},
+	"lon": {
+		floatCVal(-0.1), floatCVal(2.3), floatCVal(-74), floatCVal(-71), floatCVal(10), floatCVal(0),
+	},
+	"Country": {
+		stringCVal("UK"), stringCVal("FR"), stringCVal("US"), stringCVal("US"), stringCVal("DE"), stringCVal("XX"),
+	},
+}
+
+func getGeostatsTestExpr(byField string, globalLimit int) *structs.GeostatsExpr {
+	return &structs.GeostatsExpr{
+		LatField:        "lat",
+		LongField:       "lon",
+		OutputLatField:  "latitude",
+		OutputLongField: "longitude",
+		BinSpanLat:      22.5,
+		BinSpanLong:     45,
+		GlobalLimit:     globalLimit,
+		MeasureOperations: []*structs.MeasureAggregator{
+			{MeasureCol: "*", MeasureFunc: utils.Count},
+		},
+		ByField: byField,
+	}
+}
+
+func Test_Geostats(t *testing.T) {
+	dp := NewGeostatsDP(getGeostatsTestExpr("", 10))
+
+	output, err := dp.processor.Process(newTestIQR(t, geostatsTestValues))
+	assert.NoError(t, err)
+	assert.Nil(t, output)
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.NotNil(t, result)
+
+	// Records without a valid location are skipped.
+	bins, err := result.ReadColumn("geobin")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("bin_id_zl_0_y_5_x_2"), stringCVal("bin_id_zl_0_y_6_x_3"), stringCVal("bin_id_zl_0_y_6_x_4"),
+	}, bins)
+
+	latitudes, err := result.ReadColumn("latitude")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(41.5), floatCVal(51.5), floatCVal(48.8)}, latitudes)
+
+	longitudes, err := result.ReadColumn("longitude")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{floatCVal(-72.5), floatCVal(-0.1), floatCVal(2.3)}, longitudes)
+
+	measureName := (&structs.MeasureAggregator{MeasureCol: "*", MeasureFunc: utils.Count}).String()
+	assert.Equal(t, []float64{2, 1, 1}, getChartColumnAsFloats(t, result, measureName))
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"geobin", "latitude", "longitude", measureName},
+		result.GetColumnsOrder([]string{measureName, "longitude", "latitude", "geobin"}))
+	assert.Len(t, columns, 4)
+}
+
+func Test_Geostats_By(t *testing.T) {
+	dp := NewGeostatsDP(getGeostatsTestExpr("Country", 1))
+
+	_, err := dp.processor.Process(newTestIQR(t, geostatsTestValues))
+	assert.NoError(t, err)
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+
+	// Only the top country gets its own column; the rest are merged into OTHER.
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"geobin": {}, "latitude": {}, "longitude": {}, "US": {}, "OTHER": {}}, columns)
+
+	assert.Equal(t, []float64{2, -1, -1}, getChartColumnAsFloats(t, result, "US"))
+	assert.Equal(t, []float64{-1, 1, 1}, getChartColumnAsFloats(t, result, "OTHER"))
+}
+
+func Test_Geostats_NoInput(t *testing.T) {
+	dp := NewGeostatsDP(getGeostatsTestExpr("", 10))
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, result)
+}
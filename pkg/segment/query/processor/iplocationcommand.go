@@ -0,0 +1,138 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+
+	"github.com/siglens/siglens/pkg/geoip"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// The fields are in the same order as Splunk outputs them.
+var iplocationFields = []string{"City", "Country", "Region", "lat", "lon"}
+var iplocationAllFields = []string{"City", "Continent", "Country", "MetroCode", "Region", "Timezone", "lat", "lon"}
+
+type iplocationProcessor struct {
+	options  *structs.IPLocationExpr
+	database *geoip.Database
+}
+
+func (p *iplocationProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	if p.database == nil {
+		database, err := geoip.GetDatabase()
+		if err != nil {
+			return nil, toputils.TeeErrorf("iplocation.Process: cannot load GeoIP database; err=%v", err)
+		}
+		p.database = database
+	}
+
+	fields := iplocationFields
+	if p.options.AllFields {
+		fields = iplocationAllFields
+	}
+
+	numRecords := inputIQR.NumberOfRecords()
+	knownValues := make(map[string][]utils.CValueEnclosure, len(fields))
+	for _, field := range fields {
+		knownValues[p.options.Prefix+field] = make([]utils.CValueEnclosure, numRecords)
+	}
+
+	ipValues, err := inputIQR.ReadColumn(p.options.IPField)
+	if err != nil {
+		// Every record has a null IP.
+		ipValues = nil
+	}
+
+	for i := 0; i < numRecords; i++ {
+		var location *geoip.Location
+		if ipValues != nil && !ipValues[i].IsNull() {
+			ip, err := ipValues[i].GetString()
+			if err == nil {
+				location, err = p.database.Lookup(ip, p.options.Language)
+				if err != nil {
+					return nil, toputils.TeeErrorf("iplocation.Process: %v", err)
+				}
+			}
+		}
+
+		for _, field := range fields {
+			knownValues[p.options.Prefix+field][i] = getIPLocationValue(location, field)
+		}
+	}
+
+	err = inputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("iplocation.Process: failed to append known values; err=%v", err)
+	}
+
+	return inputIQR, nil
+}
+
+// Like Splunk, IPs that are found get an empty string for the names the
+// database doesn't have. Everything is null for IPs that aren't found.
+func getIPLocationValue(location *geoip.Location, field string) utils.CValueEnclosure {
+	if location == nil {
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+	}
+
+	switch field {
+	case "City":
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: location.City}
+	case "Continent":
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: location.Continent}
+	case "Country":
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: location.Country}
+	case "Region":
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: location.Region}
+	case "Timezone":
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: location.Timezone}
+	case "MetroCode":
+		if location.MetroCode == 0 {
+			return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: ""}
+		}
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_UNSIGNED_NUM, CVal: location.MetroCode}
+	case "lat":
+		if !location.HasCoordinates {
+			return utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+		}
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: location.Latitude}
+	case "lon":
+		if !location.HasCoordinates {
+			return utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+		}
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: location.Longitude}
+	default:
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+	}
+}
+
+func (p *iplocationProcessor) Rewind() {
+	// Nothing to do
+}
+
+func (p *iplocationProcessor) Cleanup() {
+	// Nothing to do
+}
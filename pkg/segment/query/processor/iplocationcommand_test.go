@@ -0,0 +1,134 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/geoip"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestGeoIPDatabase(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	path := config.GetGeoIPDatabasePath()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.NoError(t, err)
+
+	err = geoip.WriteMockDatabase(path, []geoip.MockNetwork{
+		{
+			CIDR: "81.2.69.0/24",
+			Record: map[string]any{
+				"city":         map[string]any{"names": map[string]any{"en": "London"}},
+				"continent":    map[string]any{"names": map[string]any{"en": "Europe"}},
+				"country":      map[string]any{"names": map[string]any{"en": "United Kingdom"}},
+				"location":     map[string]any{"latitude": 51.5, "longitude": -0.1, "time_zone": "Europe/London"},
+				"subdivisions": []any{map[string]any{"names": map[string]any{"en": "England"}}},
+			},
+		},
+		{
+			CIDR:   "10.0.0.0/8",
+			Record: map[string]any{"country": map[string]any{"names": map[string]any{"en": "Private"}}},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func runIPLocation(t *testing.T, options *structs.IPLocationExpr, ips []utils.CValueEnclosure) *iqr.IQR {
+	inputIQR := iqr.NewIQR(0)
+	err := inputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{"src_ip": ips})
+	assert.NoError(t, err)
+
+	dp := NewIPLocationDP(options)
+	result, err := dp.processor.Process(inputIQR)
+	assert.NoError(t, err)
+	assert.Equal(t, inputIQR, result)
+
+	result, err = dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, result)
+
+	return inputIQR
+}
+
+func Test_IPLocation(t *testing.T) {
+	writeTestGeoIPDatabase(t)
+	backfill := utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+
+	result := runIPLocation(t, &structs.IPLocationExpr{IPField: "src_ip", Language: "en"},
+		[]utils.CValueEnclosure{stringCVal("81.2.69.160"), stringCVal("10.1.1.1"), stringCVal("8.8.8.8"), backfill})
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"src_ip": {}, "City": {}, "Country": {}, "Region": {}, "lat": {}, "lon": {}}, columns)
+
+	expected := map[string][]utils.CValueEnclosure{
+		"City":    {stringCVal("London"), stringCVal(""), backfill, backfill},
+		"Country": {stringCVal("United Kingdom"), stringCVal("Private"), backfill, backfill},
+		"Region":  {stringCVal("England"), stringCVal(""), backfill, backfill},
+		"lat":     {floatCVal(51.5), backfill, backfill, backfill},
+		"lon":     {floatCVal(-0.1), backfill, backfill, backfill},
+	}
+	for cname, expectedValues := range expected {
+		values, err := result.ReadColumn(cname)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedValues, values, cname)
+	}
+}
+
+func Test_IPLocation_PrefixAndAllFields(t *testing.T) {
+	writeTestGeoIPDatabase(t)
+
+	result := runIPLocation(t, &structs.IPLocationExpr{IPField: "src_ip", Prefix: "geo_", AllFields: true, Language: "en"},
+		[]utils.CValueEnclosure{stringCVal("81.2.69.1")})
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{
+		"src_ip": {}, "geo_City": {}, "geo_Continent": {}, "geo_Country": {}, "geo_MetroCode": {},
+		"geo_Region": {}, "geo_Timezone": {}, "geo_lat": {}, "geo_lon": {},
+	}, columns)
+
+	values, err := result.ReadColumn("geo_Timezone")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("Europe/London")}, values)
+
+	values, err = result.ReadColumn("geo_Continent")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("Europe")}, values)
+}
+
+func Test_IPLocation_MissingDatabase(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	inputIQR := iqr.NewIQR(0)
+	err := inputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{"src_ip": {stringCVal("81.2.69.1")}})
+	assert.NoError(t, err)
+
+	dp := NewIPLocationDP(&structs.IPLocationExpr{IPField: "src_ip", Language: "en"})
+	_, err = dp.processor.Process(inputIQR)
+	assert.Error(t, err)
+}
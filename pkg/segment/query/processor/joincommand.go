@@ -0,0 +1,397 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	rutils "github.com/siglens/siglens/pkg/readerUtils"
+	"github.com/siglens/siglens/pkg/segment/query"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/query/summary"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// Like Splunk, only this many subsearch results are used for the join.
+const maxJoinSubsearchRows = 50_000
+
+type joinProcessor struct {
+	options         *structs.JoinExpr
+	parentQueryInfo *query.QueryInformation
+
+	// These are populated the first time Process() is called, so the
+	// subsearch only runs once per query.
+	ranSubsearch     bool
+	subsearchValues  map[string][]utils.CValueEnclosure
+	numSubsearchRows int
+
+	// Maps the values of the join fields to the matching subsearch rows. This
+	// is rebuilt if the join fields change, which can only happen when the
+	// join fields are inferred from the columns of each input.
+	indexedFields []string
+	keyToRows     map[string][]int
+}
+
+func (p *joinProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	if !p.ranSubsearch {
+		err := p.runSubsearch()
+		if err != nil {
+			return nil, toputils.TeeErrorf("join.Process: failed to run subsearch; err=%v", err)
+		}
+	}
+
+	numRecords := inputIQR.NumberOfRecords()
+	if numRecords == 0 {
+		return inputIQR, nil
+	}
+
+	joinFields, err := p.getJoinFields(inputIQR)
+	if err != nil {
+		return nil, toputils.TeeErrorf("join.Process: failed to get join fields; err=%v", err)
+	}
+	p.indexSubsearch(joinFields)
+
+	// The i-th element is the subsearch rows that match the i-th record.
+	matchedRows := make([][]int, numRecords)
+	p.matchRecords(inputIQR, joinFields, matchedRows)
+
+	outputCols := p.getOutputColumns(joinFields)
+	for _, rows := range matchedRows {
+		if len(rows) > 1 {
+			return p.joinWithDuplicates(inputIQR, matchedRows, outputCols)
+		}
+	}
+
+	return p.joinInPlace(inputIQR, matchedRows, outputCols)
+}
+
+func (p *joinProcessor) isInnerJoin() bool {
+	return p.options.JoinType == "inner"
+}
+
+// If no join fields were specified, join on the fields common to the input
+// and the subsearch results.
+func (p *joinProcessor) getJoinFields(inputIQR *iqr.IQR) ([]string, error) {
+	if len(p.options.FieldList) > 0 {
+		return p.options.FieldList, nil
+	}
+
+	inputColumns, err := inputIQR.GetColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	joinFields := make([]string, 0)
+	for cname := range inputColumns {
+		if _, ok := p.subsearchValues[cname]; ok {
+			joinFields = append(joinFields, cname)
+		}
+	}
+	sort.Strings(joinFields)
+
+	return joinFields, nil
+}
+
+func (p *joinProcessor) indexSubsearch(joinFields []string) {
+	if p.keyToRows != nil && toputils.CompareStringSlices(p.indexedFields, joinFields) {
+		return
+	}
+
+	p.indexedFields = joinFields
+	p.keyToRows = make(map[string][]int)
+
+	joinValues := make([][]utils.CValueEnclosure, len(joinFields))
+	for i, field := range joinFields {
+		values, ok := p.subsearchValues[field]
+		if !ok {
+			// No subsearch row can match.
+			return
+		}
+		joinValues[i] = values
+	}
+
+	if len(joinFields) == 0 {
+		return
+	}
+
+	for row := 0; row < p.numSubsearchRows; row++ {
+		key, ok := getCompositeKey(joinValues, row)
+		if !ok {
+			continue
+		}
+
+		p.keyToRows[key] = append(p.keyToRows[key], row)
+	}
+}
+
+func (p *joinProcessor) matchRecords(inputIQR *iqr.IQR, joinFields []string, matchedRows [][]int) {
+	joinValues := make([][]utils.CValueEnclosure, len(joinFields))
+	for i, field := range joinFields {
+		values, err := inputIQR.ReadColumn(field)
+		if err != nil || len(values) != len(matchedRows) {
+			// This column doesn't exist, so no record can match.
+			return
+		}
+		joinValues[i] = values
+	}
+
+	if len(joinFields) == 0 {
+		return
+	}
+
+	for i := range matchedRows {
+		key, ok := getCompositeKey(joinValues, i)
+		if !ok {
+			continue
+		}
+
+		rows := p.keyToRows[key]
+		if p.options.Max > 0 && uint64(len(rows)) > p.options.Max {
+			rows = rows[:p.options.Max]
+		}
+		matchedRows[i] = rows
+	}
+}
+
+// Returns the subsearch columns that are added to the joined records.
+func (p *joinProcessor) getOutputColumns(joinFields []string) []string {
+	isJoinField := make(map[string]struct{}, len(joinFields))
+	for _, field := range joinFields {
+		isJoinField[field] = struct{}{}
+	}
+
+	outputCols := make([]string, 0, len(p.subsearchValues))
+	for cname := range p.subsearchValues {
+		if _, ok := isJoinField[cname]; !ok {
+			outputCols = append(outputCols, cname)
+		}
+	}
+	sort.Strings(outputCols)
+
+	return outputCols
+}
+
+// This is used when each record matches at most one subsearch row, so the
+// input can be updated without duplicating any records.
+func (p *joinProcessor) joinInPlace(inputIQR *iqr.IQR, matchedRows [][]int, outputCols []string) (*iqr.IQR, error) {
+	numRecords := inputIQR.NumberOfRecords()
+	knownValues := make(map[string][]utils.CValueEnclosure, len(outputCols))
+
+	for _, cname := range outputCols {
+		existingValues, err := inputIQR.ReadColumn(cname)
+		if err != nil || len(existingValues) != numRecords {
+			existingValues = nil
+		}
+
+		newValues := make([]utils.CValueEnclosure, numRecords)
+		for i := 0; i < numRecords; i++ {
+			subsearchRow := -1
+			if len(matchedRows[i]) > 0 {
+				subsearchRow = matchedRows[i][0]
+			}
+
+			newValues[i] = p.getJoinedValue(cname, existingValues, i, subsearchRow)
+		}
+
+		knownValues[cname] = newValues
+	}
+
+	err := inputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("join.joinInPlace: failed to append known values; err=%v", err)
+	}
+
+	if !p.isInnerJoin() {
+		return inputIQR, nil
+	}
+
+	rowsToDiscard := make([]int, 0)
+	for i, rows := range matchedRows {
+		if len(rows) == 0 {
+			rowsToDiscard = append(rowsToDiscard, i)
+		}
+	}
+
+	err = inputIQR.DiscardRows(rowsToDiscard)
+	if err != nil {
+		return nil, toputils.TeeErrorf("join.joinInPlace: failed to discard unmatched rows; err=%v", err)
+	}
+
+	return inputIQR, nil
+}
+
+// This is used when some record matches multiple subsearch rows, so that
+// record is output once per match.
+func (p *joinProcessor) joinWithDuplicates(inputIQR *iqr.IQR, matchedRows [][]int, outputCols []string) (*iqr.IQR, error) {
+	inputValues, err := inputIQR.ReadAllColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("join.joinWithDuplicates: failed to read input; err=%v", err)
+	}
+
+	isOutputCol := make(map[string]struct{}, len(outputCols))
+	for _, cname := range outputCols {
+		isOutputCol[cname] = struct{}{}
+	}
+
+	knownValues := make(map[string][]utils.CValueEnclosure, len(inputValues)+len(outputCols))
+	for i, rows := range matchedRows {
+		if len(rows) == 0 {
+			if p.isInnerJoin() {
+				continue
+			}
+			rows = []int{-1}
+		}
+
+		for _, subsearchRow := range rows {
+			for cname, values := range inputValues {
+				if _, ok := isOutputCol[cname]; !ok {
+					knownValues[cname] = append(knownValues[cname], values[i])
+				}
+			}
+
+			for _, cname := range outputCols {
+				value := p.getJoinedValue(cname, inputValues[cname], i, subsearchRow)
+				knownValues[cname] = append(knownValues[cname], value)
+			}
+		}
+	}
+
+	outputIQR := iqr.NewIQR(inputIQR.GetQID())
+	err = outputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("join.joinWithDuplicates: failed to append known values; err=%v", err)
+	}
+
+	return outputIQR, nil
+}
+
+// A subsearchRow of -1 means the record didn't match any subsearch row.
+func (p *joinProcessor) getJoinedValue(cname string, existingValues []utils.CValueEnclosure,
+	recordIdx int, subsearchRow int) utils.CValueEnclosure {
+
+	existingValue := utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+	if existingValues != nil {
+		existingValue = existingValues[recordIdx]
+	}
+
+	if subsearchRow < 0 {
+		return existingValue
+	}
+
+	subsearchValue := p.subsearchValues[cname][subsearchRow]
+	if existingValue.IsNull() || (p.options.Overwrite && !subsearchValue.IsNull()) {
+		return subsearchValue
+	}
+
+	return existingValue
+}
+
+func (p *joinProcessor) runSubsearch() error {
+	if p.options.SubsearchNode == nil {
+		return toputils.TeeErrorf("join.runSubsearch: subsearch was not parsed")
+	}
+	if p.parentQueryInfo == nil {
+		return toputils.TeeErrorf("join.runSubsearch: no query info for the main search")
+	}
+
+	qid := rutils.GetNextQid()
+	_, err := query.StartQuery(qid, false, nil)
+	if err != nil {
+		return toputils.TeeErrorf("join.runSubsearch: failed to start subsearch; err=%v", err)
+	}
+	defer query.DeleteQuery(qid)
+
+	orgid := p.parentQueryInfo.GetOrgId()
+	tableInfo := p.parentQueryInfo.GetIndexInfo()
+	if len(p.options.SubsearchIndexNames) > 0 {
+		tableInfo = structs.InitTableInfo(strings.Join(p.options.SubsearchIndexNames, ","), orgid, false)
+	}
+	qc := structs.InitQueryContextWithTableInfo(tableInfo, maxJoinSubsearchRows, 0, orgid, false)
+
+	node := p.options.SubsearchNode
+	aggs := p.options.SubsearchAggs
+	_, querySummary, queryInfo, pqid, _, _, _, containsKibana, _, err := query.PrepareToRunQuery(node,
+		node.TimeRange, aggs, qid, qc)
+	if err != nil {
+		return toputils.TeeErrorf("join.runSubsearch: failed to prepare subsearch; err=%v", err)
+	}
+	defer querySummary.LogSummaryAndEmitMetrics(qid, pqid, containsKibana, orgid)
+
+	return p.processSubsearch(aggs, queryInfo, querySummary)
+}
+
+// The usual query processor stops after a page of records, so this uses one
+// that keeps every record the join can use.
+func (p *joinProcessor) processSubsearch(aggs *structs.QueryAggregators, queryInfo *query.QueryInformation,
+	querySummary *summary.QuerySummary) error {
+
+	queryProcessor, err := newQueryProcessor(aggs, queryInfo, querySummary, maxJoinSubsearchRows)
+	if err != nil {
+		return toputils.TeeErrorf("join.processSubsearch: failed to create query processor; err=%v", err)
+	}
+	defer queryProcessor.Cleanup()
+
+	subsearchIQR, err := queryProcessor.getFullIQR()
+	if err != nil {
+		return toputils.TeeErrorf("join.processSubsearch: failed to get subsearch results; err=%v", err)
+	}
+
+	return p.setSubsearchResults(subsearchIQR)
+}
+
+func (p *joinProcessor) setSubsearchResults(subsearchIQR *iqr.IQR) error {
+	err := subsearchIQR.DiscardAfter(maxJoinSubsearchRows)
+	if err != nil {
+		return toputils.TeeErrorf("join.setSubsearchResults: failed to limit results; err=%v", err)
+	}
+
+	// Read the values now, since the subsearch query is deleted afterward.
+	values, err := subsearchIQR.ReadAllColumns()
+	if err != nil {
+		return toputils.TeeErrorf("join.setSubsearchResults: failed to read results; err=%v", err)
+	}
+	if values == nil {
+		values = make(map[string][]utils.CValueEnclosure)
+	}
+
+	p.subsearchValues = values
+	p.numSubsearchRows = subsearchIQR.NumberOfRecords()
+	p.ranSubsearch = true
+
+	return nil
+}
+
+func (p *joinProcessor) Rewind() {
+	// Nothing to do; the subsearch results don't depend on the input.
+}
+
+func (p *joinProcessor) Cleanup() {
+	p.subsearchValues = nil
+	p.numSubsearchRows = 0
+	p.indexedFields = nil
+	p.keyToRows = nil
+	p.ranSubsearch = false
+}
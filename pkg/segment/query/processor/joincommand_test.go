@@ -0,0 +1,179 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/segment/query"
+	"github.com/siglens/siglens/pkg/segment/query/summary"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Join_Inner(t *testing.T) {
+	dp := NewJoinDP(&structs.JoinExpr{
+		JoinType:  "inner",
+		FieldList: []string{"id"},
+		Max:       1,
+		Overwrite: true,
+	}, nil)
+	err := dp.processor.(*joinProcessor).setSubsearchResults(newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"id":   {stringCVal("a"), stringCVal("b"), stringCVal("a")},
+		"user": {stringCVal("alice"), stringCVal("bob"), stringCVal("ignored")},
+		"app":  {stringCVal("web"), backfillCVal(), stringCVal("db")},
+	}))
+	assert.NoError(t, err)
+
+	iqr1 := newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"id":  {stringCVal("a"), stringCVal("c"), stringCVal("b")},
+		"app": {stringCVal("api"), stringCVal("api"), stringCVal("api")},
+	})
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	ids, err := result.ReadColumn("id")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("a"), stringCVal("b")}, ids)
+
+	users, err := result.ReadColumn("user")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("alice"), stringCVal("bob")}, users)
+
+	// A null subsearch value doesn't overwrite the event's value.
+	apps, err := result.ReadColumn("app")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("web"), stringCVal("api")}, apps)
+}
+
+func Test_Join_LeftWithMultipleMatches(t *testing.T) {
+	dp := NewJoinDP(&structs.JoinExpr{
+		JoinType:  "left",
+		FieldList: []string{"id"},
+		Max:       0,
+		Overwrite: true,
+	}, nil)
+	err := dp.processor.(*joinProcessor).setSubsearchResults(newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"id":   {stringCVal("a"), stringCVal("b"), stringCVal("a")},
+		"user": {stringCVal("alice"), stringCVal("bob"), stringCVal("amy")},
+	}))
+	assert.NoError(t, err)
+
+	iqr1 := newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"id":    {stringCVal("a"), stringCVal("c")},
+		"count": {{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(1)}, {Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(2)}},
+	})
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.NumberOfRecords())
+
+	ids, err := result.ReadColumn("id")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("a"), stringCVal("a"), stringCVal("c")}, ids)
+
+	counts, err := result.ReadColumn("count")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(1)},
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(1)},
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(2)},
+	}, counts)
+
+	users, err := result.ReadColumn("user")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("alice"),
+		stringCVal("amy"),
+		backfillCVal(),
+	}, users)
+}
+
+func Test_Join_CommonFields(t *testing.T) {
+	dp := NewJoinDP(&structs.JoinExpr{
+		JoinType:  "outer",
+		Max:       1,
+		Overwrite: true,
+	}, nil)
+	err := dp.processor.(*joinProcessor).setSubsearchResults(newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"host":  {stringCVal("h1"), stringCVal("h2")},
+		"port":  {stringCVal("80"), stringCVal("443")},
+		"owner": {stringCVal("infra"), stringCVal("payments")},
+	}))
+	assert.NoError(t, err)
+
+	iqr1 := newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"host": {stringCVal("h1"), stringCVal("h2"), stringCVal("h2")},
+		"port": {stringCVal("80"), stringCVal("80"), stringCVal("443")},
+	})
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.NumberOfRecords())
+
+	owners, err := result.ReadColumn("owner")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("infra"),
+		backfillCVal(),
+		stringCVal("payments"),
+	}, owners)
+}
+
+func Test_Join_WithoutOverwrite(t *testing.T) {
+	dp := NewJoinDP(&structs.JoinExpr{
+		JoinType:  "inner",
+		FieldList: []string{"host"},
+		Max:       1,
+		Overwrite: false,
+	}, nil)
+	err := dp.processor.(*joinProcessor).setSubsearchResults(newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"host": {stringCVal("h1"), stringCVal("h2")},
+		"note": {stringCVal("sub1"), stringCVal("sub2")},
+	}))
+	assert.NoError(t, err)
+
+	iqr1 := newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"host": {stringCVal("h1"), stringCVal("h2")},
+		"note": {stringCVal("main1"), backfillCVal()},
+	})
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+
+	notes, err := result.ReadColumn("note")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("main1"), stringCVal("sub2")}, notes)
+}
+
+func Test_Join_SubsearchKeepsAllRows(t *testing.T) {
+	numRows := int(utils.QUERY_EARLY_EXIT_LIMIT) + 50
+	aggs := &structs.QueryAggregators{
+		MakeResultsExpr: &structs.MakeResultsExpr{Count: uint64(numRows)},
+	}
+
+	processor := &joinProcessor{options: &structs.JoinExpr{}}
+	err := processor.processSubsearch(aggs, &query.QueryInformation{}, &summary.QuerySummary{})
+	assert.NoError(t, err)
+	assert.Equal(t, numRows, processor.numSubsearchRows)
+	assert.Len(t, processor.subsearchValues[config.GetTimeStampKey()], numRows)
+}
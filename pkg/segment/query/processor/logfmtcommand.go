@@ -0,0 +1,119 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// Loki ingestion stores the raw log line in this column.
+const logLineColumn = "line"
+
+type logfmtProcessor struct {
+	options *structs.ColumnsRequest
+}
+
+// Extracts the key-value pairs of each logfmt line into columns. When the
+// options list labels, only those keys are extracted, under their label. A key
+// that clashes with an existing column gets an "_extracted" suffix.
+func (p *logfmtProcessor) Process(iqr *iqr.IQR) (*iqr.IQR, error) {
+	if iqr == nil {
+		return nil, io.EOF
+	}
+
+	numRecords := iqr.NumberOfRecords()
+	if numRecords == 0 {
+		return iqr, nil
+	}
+
+	existingColumns, err := iqr.GetColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, logfmt.Process: cannot get columns; err=%v", iqr.GetQID(), err)
+	}
+	if _, ok := existingColumns[logLineColumn]; !ok {
+		return iqr, nil
+	}
+
+	lines, err := iqr.ReadColumn(logLineColumn)
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, logfmt.Process: cannot read column %v; err=%v",
+			iqr.GetQID(), logLineColumn, err)
+	}
+
+	labels := make(map[string]string, len(p.options.IncludeValues))
+	for _, includeValue := range p.options.IncludeValues {
+		labels[includeValue.ColName] = includeValue.Label
+	}
+
+	knownValues := make(map[string][]utils.CValueEnclosure)
+	for i := range lines {
+		line, err := lines[i].GetString()
+		if err != nil {
+			continue
+		}
+
+		for key, value := range toputils.ParseLogfmt(line) {
+			label := key
+			if len(labels) > 0 {
+				listedLabel, ok := labels[key]
+				if !ok {
+					continue
+				}
+				label = listedLabel
+			}
+			if _, ok := existingColumns[label]; ok {
+				label += "_extracted"
+			}
+
+			values, ok := knownValues[label]
+			if !ok {
+				values = make([]utils.CValueEnclosure, numRecords)
+				for j := range values {
+					values[j] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+				}
+				knownValues[label] = values
+			}
+
+			err := values[i].ConvertValue(utils.GetLiteralFromString(value))
+			if err != nil {
+				return nil, toputils.TeeErrorf("qid=%v, logfmt.Process: cannot convert value %v; err=%v",
+					iqr.GetQID(), value, err)
+			}
+		}
+	}
+
+	err = iqr.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, logfmt.Process: cannot append extracted values; err=%v", iqr.GetQID(), err)
+	}
+
+	return iqr, nil
+}
+
+func (p *logfmtProcessor) Rewind() {
+	// Nothing to do.
+}
+
+func (p *logfmtProcessor) Cleanup() {
+	// Nothing to do.
+}
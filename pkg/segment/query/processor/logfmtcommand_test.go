@@ -0,0 +1,78 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var logfmtTestValues = map[string][]utils.CValueEnclosure{
+	"line": {
+		stringCVal(`level=info status=200 msg="request done"`),
+		stringCVal(`level=error duration=1.5`),
+	},
+	"level": {
+		stringCVal("stored"),
+		stringCVal("stored"),
+	},
+}
+
+func Test_Logfmt_AllKeys(t *testing.T) {
+	processor := &logfmtProcessor{options: &structs.ColumnsRequest{Logfmt: true}}
+
+	result, err := processor.Process(newTestIQR(t, logfmtTestValues))
+	assert.NoError(t, err)
+
+	values, err := result.ReadAllColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("info"),
+		stringCVal("error"),
+	}, values["level_extracted"])
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(200)},
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+	}, values["status"])
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+		{Dtype: utils.SS_DT_FLOAT, CVal: float64(1.5)},
+	}, values["duration"])
+	assert.Equal(t, "request done", values["msg"][0].CVal)
+}
+
+func Test_Logfmt_ListedKeys(t *testing.T) {
+	processor := &logfmtProcessor{options: &structs.ColumnsRequest{
+		Logfmt:        true,
+		IncludeValues: []*structs.IncludeValue{{ColName: "status", Label: "code"}},
+	}}
+
+	result, err := processor.Process(newTestIQR(t, logfmtTestValues))
+	assert.NoError(t, err)
+
+	values, err := result.ReadAllColumns()
+	assert.NoError(t, err)
+	assert.Len(t, values, 3)
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(200)},
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+	}, values["code"])
+}
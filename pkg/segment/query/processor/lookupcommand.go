@@ -0,0 +1,229 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"strings"
+
+	"github.com/siglens/siglens/pkg/lookups"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// Used to join the values of multiple fields into a single key. It's
+// unlikely to show up in real data.
+const compositeKeySeparator = "\x00"
+
+type lookupProcessor struct {
+	options *structs.LookupExpr
+
+	// These are populated the first time Process() is called, so the lookup
+	// file is only read once per query.
+	loadedTable  bool
+	keyToRow     map[string]int
+	rows         [][]string
+	outputFields []*structs.LookupField
+	outputCols   []int // Index of each output field in the lookup file.
+}
+
+func (p *lookupProcessor) Process(iqr *iqr.IQR) (*iqr.IQR, error) {
+	if iqr == nil {
+		return nil, io.EOF
+	}
+
+	if !p.loadedTable {
+		err := p.loadTable()
+		if err != nil {
+			return nil, toputils.TeeErrorf("lookup.Process: failed to load lookup table; err=%v", err)
+		}
+	}
+
+	numRecords := iqr.NumberOfRecords()
+	if numRecords == 0 {
+		return iqr, nil
+	}
+
+	matchedRows := make([]int, numRecords)
+	for i := range matchedRows {
+		matchedRows[i] = -1
+	}
+
+	matchValues := make([][]utils.CValueEnclosure, len(p.options.MatchFields))
+	for i, field := range p.options.MatchFields {
+		values, err := iqr.ReadColumn(field.EventFieldName)
+		if err != nil {
+			// This column doesn't exist, so no record can match.
+			return p.fillOutputFields(iqr, matchedRows)
+		}
+		matchValues[i] = values
+	}
+
+	for i := 0; i < numRecords; i++ {
+		key, ok := getCompositeKey(matchValues, i)
+		if !ok {
+			continue
+		}
+
+		if row, ok := p.keyToRow[key]; ok {
+			matchedRows[i] = row
+		}
+	}
+
+	return p.fillOutputFields(iqr, matchedRows)
+}
+
+// The i-th element of matchedRows is the row in the lookup file that matches
+// the i-th record, or -1 if there's no match.
+func (p *lookupProcessor) fillOutputFields(iqr *iqr.IQR, matchedRows []int) (*iqr.IQR, error) {
+	numRecords := iqr.NumberOfRecords()
+	knownValues := make(map[string][]utils.CValueEnclosure, len(p.outputFields))
+
+	for fieldIdx, field := range p.outputFields {
+		var existingValues []utils.CValueEnclosure
+		if p.options.OutputNew {
+			values, err := iqr.ReadColumn(field.EventFieldName)
+			if err == nil && len(values) == numRecords {
+				existingValues = values
+			}
+		}
+
+		newValues := make([]utils.CValueEnclosure, numRecords)
+		for i := 0; i < numRecords; i++ {
+			if existingValues != nil && !existingValues[i].IsNull() {
+				newValues[i] = existingValues[i]
+				continue
+			}
+
+			if matchedRows[i] < 0 {
+				newValues[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+				continue
+			}
+
+			newValues[i] = utils.CValueEnclosure{
+				Dtype: utils.SS_DT_STRING,
+				CVal:  p.rows[matchedRows[i]][p.outputCols[fieldIdx]],
+			}
+		}
+
+		knownValues[field.EventFieldName] = newValues
+	}
+
+	err := iqr.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("lookup.fillOutputFields: failed to append known values; err=%v", err)
+	}
+
+	return iqr, nil
+}
+
+func (p *lookupProcessor) loadTable() error {
+	columnNames, rows, err := lookups.ReadLookupFile(p.options.Filename)
+	if err != nil {
+		return err
+	}
+
+	columnIndex := make(map[string]int, len(columnNames))
+	for i, cname := range columnNames {
+		columnIndex[cname] = i
+	}
+
+	matchCols := make([]int, len(p.options.MatchFields))
+	matchColNames := make(map[string]struct{}, len(p.options.MatchFields))
+	for i, field := range p.options.MatchFields {
+		idx, ok := columnIndex[field.LookupFieldName]
+		if !ok {
+			return toputils.TeeErrorf("lookup.loadTable: match field %v is not in lookup file %v",
+				field.LookupFieldName, p.options.Filename)
+		}
+		matchCols[i] = idx
+		matchColNames[field.LookupFieldName] = struct{}{}
+	}
+
+	outputFields := p.options.OutputFields
+	if len(outputFields) == 0 {
+		outputFields = make([]*structs.LookupField, 0, len(columnNames))
+		for _, cname := range columnNames {
+			if _, isMatchCol := matchColNames[cname]; !isMatchCol {
+				outputFields = append(outputFields, &structs.LookupField{
+					LookupFieldName: cname,
+					EventFieldName:  cname,
+				})
+			}
+		}
+	}
+
+	outputCols := make([]int, len(outputFields))
+	for i, field := range outputFields {
+		idx, ok := columnIndex[field.LookupFieldName]
+		if !ok {
+			return toputils.TeeErrorf("lookup.loadTable: output field %v is not in lookup file %v",
+				field.LookupFieldName, p.options.Filename)
+		}
+		outputCols[i] = idx
+	}
+
+	keyToRow := make(map[string]int, len(rows))
+	keyParts := make([]string, len(matchCols))
+	for rowIdx, row := range rows {
+		for i, colIdx := range matchCols {
+			keyParts[i] = row[colIdx]
+		}
+
+		key := strings.Join(keyParts, compositeKeySeparator)
+		if _, ok := keyToRow[key]; !ok {
+			// Like Splunk, use the first matching row.
+			keyToRow[key] = rowIdx
+		}
+	}
+
+	p.keyToRow = keyToRow
+	p.rows = rows
+	p.outputFields = outputFields
+	p.outputCols = outputCols
+	p.loadedTable = true
+
+	return nil
+}
+
+// Returns false if any of the values for this record is null.
+func getCompositeKey(values [][]utils.CValueEnclosure, recordIdx int) (string, bool) {
+	keyParts := make([]string, len(values))
+	for i, columnValues := range values {
+		if columnValues[recordIdx].IsNull() {
+			return "", false
+		}
+		keyParts[i] = string(columnValues[recordIdx].AsBytes())
+	}
+
+	return strings.Join(keyParts, compositeKeySeparator), true
+}
+
+func (p *lookupProcessor) Rewind() {
+	// Nothing to do; the lookup table doesn't depend on the input.
+}
+
+func (p *lookupProcessor) Cleanup() {
+	p.keyToRow = nil
+	p.rows = nil
+	p.outputFields = nil
+	p.outputCols = nil
+	p.loadedTable = false
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestLookupFile(t *testing.T, filename string, contents string) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	err := os.MkdirAll(config.GetLookupPath(), 0755)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(config.GetLookupPath(), filename), []byte(contents), 0644)
+	assert.NoError(t, err)
+}
+
+func Test_Lookup_Output(t *testing.T) {
+	writeTestLookupFile(t, "hosts.csv", "host_id,dc,team\n1,east,infra\n2,west,payments\n1,east,ignored\n")
+
+	dp := NewLookupDP(&structs.LookupExpr{
+		Filename: "hosts.csv",
+		MatchFields: []*structs.LookupField{
+			{LookupFieldName: "host_id", EventFieldName: "host"},
+			{LookupFieldName: "dc", EventFieldName: "dc"},
+		},
+		OutputFields: []*structs.LookupField{
+			{LookupFieldName: "team", EventFieldName: "owner"},
+		},
+	})
+
+	iqr1 := iqr.NewIQR(0)
+	err := iqr1.AppendKnownValues(map[string][]utils.CValueEnclosure{
+		"host": {
+			{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(1)},
+			{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(2)},
+			{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(2)},
+			{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+		},
+		"dc":    {stringCVal("east"), stringCVal("west"), stringCVal("east"), stringCVal("east")},
+		"owner": {stringCVal("a"), stringCVal("b"), stringCVal("c"), stringCVal("d")},
+	})
+	assert.NoError(t, err)
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+
+	owners, err := result.ReadColumn("owner")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("infra"),
+		stringCVal("payments"),
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+	}, owners)
+}
+
+func Test_Lookup_OutputNewAndDefaultFields(t *testing.T) {
+	writeTestLookupFile(t, "errors.csv", "code,message,severity\n404,Not Found,low\n500,Server Error,high\n")
+
+	dp := NewLookupDP(&structs.LookupExpr{
+		Filename: "errors.csv",
+		MatchFields: []*structs.LookupField{
+			{LookupFieldName: "code", EventFieldName: "status"},
+		},
+		OutputNew: true,
+	})
+
+	iqr1 := iqr.NewIQR(0)
+	err := iqr1.AppendKnownValues(map[string][]utils.CValueEnclosure{
+		"status":  {stringCVal("404"), stringCVal("500"), stringCVal("200")},
+		"message": {{Dtype: utils.SS_DT_BACKFILL, CVal: nil}, stringCVal("keep me"), stringCVal("ok")},
+	})
+	assert.NoError(t, err)
+
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+
+	messages, err := result.ReadColumn("message")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("Not Found"), stringCVal("keep me"), stringCVal("ok")}, messages)
+
+	severities, err := result.ReadColumn("severity")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		stringCVal("low"),
+		stringCVal("high"),
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+	}, severities)
+
+	_, err = result.ReadColumn("code")
+	assert.Error(t, err)
+}
+
+func Test_Lookup_InvalidMatchField(t *testing.T) {
+	writeTestLookupFile(t, "errors.csv", "code,message\n404,Not Found\n")
+
+	dp := NewLookupDP(&structs.LookupExpr{
+		Filename:    "errors.csv",
+		MatchFields: []*structs.LookupField{{LookupFieldName: "status", EventFieldName: "status"}},
+	})
+
+	iqr1 := iqr.NewIQR(0)
+	err := iqr1.AppendKnownValues(map[string][]utils.CValueEnclosure{
+		"status": {stringCVal("404")},
+	})
+	assert.NoError(t, err)
+
+	_, err = dp.processor.Process(iqr1)
+	assert.Error(t, err)
+}
+
+func Test_Lookup_InvalidFilename(t *testing.T) {
+	writeTestLookupFile(t, "errors.csv", "code,message\n404,Not Found\n")
+
+	for _, filename := range []string{"../lookups/errors.csv", "../../etc/passwd", "/etc/passwd", "errors.txt"} {
+		dp := NewLookupDP(&structs.LookupExpr{
+			Filename:    filename,
+			MatchFields: []*structs.LookupField{{LookupFieldName: "code", EventFieldName: "code"}},
+		})
+
+		iqr1 := iqr.NewIQR(0)
+		err := iqr1.AppendKnownValues(map[string][]utils.CValueEnclosure{
+			"code": {stringCVal("404")},
+		})
+		assert.NoError(t, err)
+
+		_, err = dp.processor.Process(iqr1)
+		assert.Error(t, err, filename)
+	}
+}
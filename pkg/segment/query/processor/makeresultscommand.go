@@ -0,0 +1,278 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+const makeresultsBatchSize = 10_000
+
+var makeresultsAnnotateFields = []string{"_raw", "host", "source", "sourcetype", "splunk_server"}
+
+type makeresultsProcessor struct {
+	options      *structs.MakeResultsExpr
+	numGenerated uint64
+	timestamp    uint64 // Every generated result has the same time.
+
+	// Only used when there's data.
+	dataColumns []string
+	dataRows    []map[string]utils.CValueEnclosure
+}
+
+func (p *makeresultsProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	if p.timestamp == 0 {
+		p.timestamp = uint64(time.Now().UnixMilli())
+	}
+
+	if p.options.Data != "" {
+		return p.processData(inputIQR)
+	}
+
+	numToGenerate := p.options.Count - p.numGenerated
+	if numToGenerate > makeresultsBatchSize {
+		numToGenerate = makeresultsBatchSize
+	}
+
+	if numToGenerate > 0 {
+		knownValues := map[string][]utils.CValueEnclosure{
+			config.GetTimeStampKey(): p.getTimestamps(int(numToGenerate)),
+		}
+		p.addAnnotations(knownValues, int(numToGenerate))
+
+		err := inputIQR.AppendKnownValues(knownValues)
+		if err != nil {
+			return nil, toputils.TeeErrorf("makeresults.Process: failed to append known values; err=%v", err)
+		}
+	}
+
+	p.numGenerated += numToGenerate
+	if p.numGenerated >= p.options.Count {
+		return inputIQR, io.EOF
+	}
+
+	return inputIQR, nil
+}
+
+// The data is small enough to always generate in one batch.
+func (p *makeresultsProcessor) processData(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if p.dataRows == nil {
+		var err error
+		switch p.options.Format {
+		case "csv":
+			p.dataColumns, p.dataRows, err = parseMakeresultsCSV(p.options.Data)
+		case "json":
+			p.dataColumns, p.dataRows, err = parseMakeresultsJSON(p.options.Data)
+		default:
+			return nil, toputils.TeeErrorf("makeresults.processData: unsupported format %v", p.options.Format)
+		}
+		if err != nil {
+			return nil, toputils.TeeErrorf("makeresults.processData: failed to parse %v data; err=%v", p.options.Format, err)
+		}
+	}
+
+	if len(p.dataRows) == 0 {
+		return nil, io.EOF
+	}
+
+	knownValues := make(map[string][]utils.CValueEnclosure, len(p.dataColumns))
+	columnIndex := make(map[string]int, len(p.dataColumns))
+	for columnIdx, column := range p.dataColumns {
+		values := make([]utils.CValueEnclosure, len(p.dataRows))
+		for i, row := range p.dataRows {
+			value, ok := row[column]
+			if !ok {
+				value = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			}
+			values[i] = value
+		}
+		knownValues[column] = values
+		columnIndex[column] = columnIdx
+	}
+
+	if p.options.Annotate {
+		if _, ok := knownValues[config.GetTimeStampKey()]; !ok {
+			knownValues[config.GetTimeStampKey()] = p.getTimestamps(len(p.dataRows))
+		}
+		p.addAnnotations(knownValues, len(p.dataRows))
+	}
+
+	err := inputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("makeresults.processData: failed to append known values; err=%v", err)
+	}
+	inputIQR.AddColumnIndex(columnIndex)
+
+	return inputIQR, io.EOF
+}
+
+func (p *makeresultsProcessor) getTimestamps(numRecords int) []utils.CValueEnclosure {
+	timestamps := make([]utils.CValueEnclosure, numRecords)
+	for i := range timestamps {
+		timestamps[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_UNSIGNED_NUM, CVal: p.timestamp}
+	}
+
+	return timestamps
+}
+
+// Like Splunk, only splunk_server has a value; it's the name of this host.
+func (p *makeresultsProcessor) addAnnotations(knownValues map[string][]utils.CValueEnclosure, numRecords int) {
+	if !p.options.Annotate {
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	for _, field := range makeresultsAnnotateFields {
+		if _, ok := knownValues[field]; ok {
+			continue
+		}
+
+		values := make([]utils.CValueEnclosure, numRecords)
+		for i := range values {
+			if field == "splunk_server" && hostname != "" {
+				values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: hostname}
+			} else {
+				values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			}
+		}
+		knownValues[field] = values
+	}
+}
+
+// Returns the column names and one map for each row. Empty values are null,
+// and numbers are converted to numeric values.
+func parseMakeresultsCSV(data string) ([]string, []map[string]utils.CValueEnclosure, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimSpace(data)))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return []string{}, []map[string]utils.CValueEnclosure{}, nil
+	}
+
+	columns := records[0]
+	rows := make([]map[string]utils.CValueEnclosure, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]utils.CValueEnclosure, len(columns))
+		for i, column := range columns {
+			if i < len(record) && record[i] != "" {
+				row[column] = inferMakeresultsValue(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return columns, rows, nil
+}
+
+// The data should be a JSON array of objects. The columns are sorted, and
+// nested objects and arrays are kept as JSON strings.
+func parseMakeresultsJSON(data string) ([]string, []map[string]utils.CValueEnclosure, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var objects []map[string]interface{}
+	err := decoder.Decode(&objects)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columnSet := make(map[string]struct{})
+	rows := make([]map[string]utils.CValueEnclosure, 0, len(objects))
+	for _, object := range objects {
+		row := make(map[string]utils.CValueEnclosure, len(object))
+		for key, jsonValue := range object {
+			columnSet[key] = struct{}{}
+
+			value, err := jsonToMakeresultsValue(jsonValue)
+			if err != nil {
+				return nil, nil, err
+			}
+			row[key] = value
+		}
+		rows = append(rows, row)
+	}
+
+	columns := toputils.GetKeysOfMap(columnSet)
+	sort.Strings(columns)
+
+	return columns, rows, nil
+}
+
+func jsonToMakeresultsValue(value interface{}) (utils.CValueEnclosure, error) {
+	switch value := value.(type) {
+	case json.Number:
+		return inferMakeresultsValue(value.String()), nil
+	case string, bool, nil:
+		cValue := utils.CValueEnclosure{}
+		err := cValue.ConvertValue(value)
+		return cValue, err
+	default:
+		jsonBytes, err := json.Marshal(value)
+		if err != nil {
+			return utils.CValueEnclosure{}, err
+		}
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: string(jsonBytes)}, nil
+	}
+}
+
+func inferMakeresultsValue(value string) utils.CValueEnclosure {
+	if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_SIGNED_NUM, CVal: intValue}
+	}
+	if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+		return utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: floatValue}
+	}
+
+	return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: value}
+}
+
+func (p *makeresultsProcessor) Rewind() {
+	// The results aren't stored, so they need to be generated again.
+	p.numGenerated = 0
+}
+
+func (p *makeresultsProcessor) Cleanup() {
+	p.dataRows = nil
+	p.dataColumns = nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Makeresults_Count(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	dp := NewMakeresultsDP(&structs.MakeResultsExpr{Count: makeresultsBatchSize + 5})
+	assert.True(t, dp.IsDataGenerator())
+
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.NoError(t, err)
+	assert.Equal(t, makeresultsBatchSize, result.NumberOfRecords())
+
+	result, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 5, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{config.GetTimeStampKey()}, toputils.GetKeysOfMap(columns))
+
+	timestamps, err := result.ReadColumn(config.GetTimeStampKey())
+	assert.NoError(t, err)
+	assert.Equal(t, utils.SS_DT_UNSIGNED_NUM, timestamps[0].Dtype)
+	assert.Equal(t, timestamps[0], timestamps[4])
+
+	// Rewinding generates the results again.
+	dp.processor.Rewind()
+	result, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.NoError(t, err)
+	assert.Equal(t, makeresultsBatchSize, result.NumberOfRecords())
+}
+
+func Test_Makeresults_Annotate(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	dp := NewMakeresultsDP(&structs.MakeResultsExpr{Count: 2, Annotate: true})
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	expectedColumns := append([]string{config.GetTimeStampKey()}, makeresultsAnnotateFields...)
+	assert.ElementsMatch(t, expectedColumns, toputils.GetKeysOfMap(columns))
+
+	sources, err := result.ReadColumn("source")
+	assert.NoError(t, err)
+	assert.True(t, sources[0].IsNull())
+}
+
+func Test_Makeresults_CSV(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	dp := NewMakeresultsDP(&structs.MakeResultsExpr{
+		Count:  1,
+		Format: "csv",
+		Data:   "name,age,score\nalice,30,1.5\nbob,,2\n\"smith, jo\",41,x",
+	})
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "age", "score"}, result.GetColumnsOrder(toputils.GetKeysOfMap(columns)))
+
+	names, err := result.ReadColumn("name")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("alice"), stringCVal("bob"), stringCVal("smith, jo")}, names)
+
+	ages, err := result.ReadColumn("age")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(30), backfillCVal(), intCVal(41)}, ages)
+
+	scores, err := result.ReadColumn("score")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_FLOAT, CVal: 1.5}, intCVal(2), stringCVal("x"),
+	}, scores)
+}
+
+func Test_Makeresults_JSON(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	dp := NewMakeresultsDP(&structs.MakeResultsExpr{
+		Count:  1,
+		Format: "json",
+		Data:   `[{"name": "alice", "age": 30, "admin": true}, {"name": "bob", "tags": ["a", "b"]}]`,
+	})
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	ages, err := result.ReadColumn("age")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(30), backfillCVal()}, ages)
+
+	admins, err := result.ReadColumn("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{{Dtype: utils.SS_DT_BOOL, CVal: true}, backfillCVal()}, admins)
+
+	tags, err := result.ReadColumn("tags")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{backfillCVal(), stringCVal(`["a","b"]`)}, tags)
+}
+
+func Test_Makeresults_InvalidData(t *testing.T) {
+	dp := NewMakeresultsDP(&structs.MakeResultsExpr{Count: 1, Format: "json", Data: `{"name": "alice"`})
+	_, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+
+	"github.com/siglens/siglens/pkg/lookups"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// Writes every record to a lookup file and passes the records through
+// unchanged. The lookup file is only updated once all records are written,
+// so the records are held back until the input ends.
+type outputlookupProcessor struct {
+	options   *structs.OutputLookupExpr
+	writer    *lookups.LookupFileWriter
+	committed bool
+	results   *iqr.IQR
+}
+
+func (p *outputlookupProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		if p.committed {
+			return nil, io.EOF
+		}
+		p.committed = true
+
+		if p.writer == nil {
+			if !p.options.CreateEmpty {
+				return nil, io.EOF
+			}
+
+			err := p.initWriter()
+			if err != nil {
+				return nil, toputils.TeeErrorf("outputlookup.Process: %v", err)
+			}
+		}
+
+		err := p.writer.Commit(p.options.CreateEmpty)
+		if err != nil {
+			return nil, toputils.TeeErrorf("outputlookup.Process: failed to write %v; err=%v", p.options.Filename, err)
+		}
+
+		return p.results, io.EOF
+	}
+
+	if p.writer == nil {
+		err := p.initWriter()
+		if err != nil {
+			return nil, toputils.TeeErrorf("outputlookup.Process: %v", err)
+		}
+	}
+
+	columns, err := inputIQR.GetColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("outputlookup.Process: failed to get columns; err=%v", err)
+	}
+	columnNames := inputIQR.GetColumnsOrder(toputils.GetKeysOfMap(columns))
+
+	allValues, err := inputIQR.ReadAllColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("outputlookup.Process: failed to read columns; err=%v", err)
+	}
+
+	rows := make([][]string, inputIQR.NumberOfRecords())
+	for i := range rows {
+		rows[i] = make([]string, len(columnNames))
+	}
+
+	for j, columnName := range columnNames {
+		values, ok := allValues[columnName]
+		if !ok {
+			continue
+		}
+
+		for i := range rows {
+			if !values[i].IsNull() {
+				rows[i][j] = string(values[i].AsBytes())
+			}
+		}
+	}
+
+	err = p.writer.WriteRows(columnNames, rows)
+	if err != nil {
+		return nil, toputils.TeeErrorf("outputlookup.Process: failed to write rows; err=%v", err)
+	}
+
+	if p.results == nil {
+		p.results = inputIQR
+	} else {
+		err = p.results.Append(inputIQR)
+		if err != nil {
+			return nil, toputils.TeeErrorf("outputlookup.Process: failed to append records; err=%v", err)
+		}
+	}
+
+	return nil, nil
+}
+
+func (p *outputlookupProcessor) initWriter() error {
+	writer, err := lookups.NewLookupFileWriter(p.options.Filename, p.options.Append)
+	if err != nil {
+		return toputils.TeeErrorf("outputlookup.initWriter: failed to create writer for %v; err=%v",
+			p.options.Filename, err)
+	}
+
+	p.writer = writer
+	return nil
+}
+
+func (p *outputlookupProcessor) Rewind() {
+	// nothing to do
+}
+
+func (p *outputlookupProcessor) Cleanup() {
+	if p.writer != nil {
+		// If the query didn't finish, this discards the uncommitted rows.
+		p.writer.Close()
+		p.writer = nil
+	}
+}
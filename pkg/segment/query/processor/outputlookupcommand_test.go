@@ -0,0 +1,174 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/lookups"
+	"github.com/siglens/siglens/pkg/segment/query"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/query/summary"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func runOutputLookup(t *testing.T, options *structs.OutputLookupExpr, knownValues ...map[string][]utils.CValueEnclosure) {
+	dp := NewOutputLookupDP(options)
+	for _, values := range knownValues {
+		inputIQR := iqr.NewIQR(0)
+		err := inputIQR.AppendKnownValues(values)
+		assert.NoError(t, err)
+
+		result, err := dp.processor.Process(inputIQR)
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+	}
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	if len(knownValues) == 0 {
+		assert.Nil(t, result)
+	} else {
+		assert.NotNil(t, result)
+	}
+	dp.processor.Cleanup()
+}
+
+func assertNoTempLookupFiles(t *testing.T) {
+	entries, err := os.ReadDir(config.GetLookupPath())
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "tmp")
+	}
+}
+
+func Test_OutputLookup_Replace(t *testing.T) {
+	writeTestLookupFile(t, "ips.csv", "ip,count\n10.0.0.9,1\n")
+
+	runOutputLookup(t, &structs.OutputLookupExpr{Filename: "ips.csv"},
+		map[string][]utils.CValueEnclosure{
+			"ip":    {stringCVal("10.0.0.1"), stringCVal("10.0.0.2")},
+			"count": {intCVal(5), {Dtype: utils.SS_DT_BACKFILL, CVal: nil}},
+		},
+		map[string][]utils.CValueEnclosure{
+			"ip":   {stringCVal("10.0.0.3")},
+			"zone": {stringCVal("dmz")},
+		},
+	)
+
+	columns, rows, err := lookups.ReadLookupFile("ips.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"count", "ip", "zone"}, columns)
+	assert.Equal(t, [][]string{{"5", "10.0.0.1", ""}, {"", "10.0.0.2", ""}, {"", "10.0.0.3", "dmz"}}, rows)
+	assertNoTempLookupFiles(t)
+}
+
+func Test_OutputLookup_Append(t *testing.T) {
+	writeTestLookupFile(t, "ips.csv", "ip,owner\n10.0.0.9,ops\n")
+
+	runOutputLookup(t, &structs.OutputLookupExpr{Filename: "ips.csv", Append: true},
+		map[string][]utils.CValueEnclosure{
+			"ip":    {stringCVal("10.0.0.1")},
+			"count": {intCVal(5)},
+		},
+	)
+
+	columns, rows, err := lookups.ReadLookupFile("ips.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ip", "owner", "count"}, columns)
+	assert.Equal(t, [][]string{{"10.0.0.9", "ops", ""}, {"10.0.0.1", "", "5"}}, rows)
+	assertNoTempLookupFiles(t)
+}
+
+func Test_OutputLookup_Gzip(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	options := &structs.OutputLookupExpr{Filename: "ips.csv.gz", Append: true}
+	runOutputLookup(t, options, map[string][]utils.CValueEnclosure{"ip": {stringCVal("10.0.0.1")}})
+	runOutputLookup(t, options, map[string][]utils.CValueEnclosure{"ip": {stringCVal("10.0.0.2")}})
+
+	columns, rows, err := lookups.ReadLookupFile("ips.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ip"}, columns)
+	assert.Equal(t, [][]string{{"10.0.0.1"}, {"10.0.0.2"}}, rows)
+}
+
+func Test_OutputLookup_NoResults(t *testing.T) {
+	writeTestLookupFile(t, "existing.csv", "ip\n10.0.0.9\n")
+
+	runOutputLookup(t, &structs.OutputLookupExpr{Filename: "existing.csv"})
+	_, rows, err := lookups.ReadLookupFile("existing.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"10.0.0.9"}}, rows)
+
+	runOutputLookup(t, &structs.OutputLookupExpr{Filename: "missing.csv"})
+	_, err = os.Stat(filepath.Join(config.GetLookupPath(), "missing.csv"))
+	assert.True(t, os.IsNotExist(err))
+
+	runOutputLookup(t, &structs.OutputLookupExpr{Filename: "empty.csv", CreateEmpty: true})
+	info, err := os.Stat(filepath.Join(config.GetLookupPath(), "empty.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+	assertNoTempLookupFiles(t)
+}
+
+func Test_OutputLookup_InvalidFilename(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	for _, filename := range []string{"../ips.csv", "ips.txt", ""} {
+		dp := NewOutputLookupDP(&structs.OutputLookupExpr{Filename: filename})
+		inputIQR := iqr.NewIQR(0)
+		err := inputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{"ip": {stringCVal("10.0.0.1")}})
+		assert.NoError(t, err)
+
+		_, err = dp.processor.Process(inputIQR)
+		assert.Error(t, err, filename)
+	}
+}
+
+func Test_OutputLookup_QueryProcessor(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	// makeresults sends all its records along with the EOF, and there are
+	// more records than the query processor's head keeps.
+	numRecords := int(utils.QUERY_EARLY_EXIT_LIMIT) + 50
+	aggs := []structs.QueryAggregators{
+		{MakeResultsExpr: &structs.MakeResultsExpr{Count: uint64(numRecords)}},
+		{OutputLookupExpr: &structs.OutputLookupExpr{Filename: "generated.csv"}},
+	}
+	aggs[0].Next = &aggs[1]
+
+	queryProcessor, err := NewQueryProcessor(&aggs[0], &query.QueryInformation{}, &summary.QuerySummary{})
+	assert.NoError(t, err)
+
+	result, err := queryProcessor.getFullIQR()
+	assert.NoError(t, err)
+	assert.Equal(t, int(utils.QUERY_EARLY_EXIT_LIMIT), result.NumberOfRecords())
+	queryProcessor.Cleanup()
+
+	columns, rows, err := lookups.ReadLookupFile("generated.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{config.GetTimeStampKey()}, columns)
+	assert.Len(t, rows, numRecords)
+}
@@ -18,6 +18,7 @@
 package processor
 
 import (
+	"fmt"
 	"io"
 	"time"
 
@@ -53,6 +54,14 @@ func (qp *QueryProcessor) Cleanup() {
 func NewQueryProcessor(firstAgg *structs.QueryAggregators, queryInfo *query.QueryInformation,
 	querySummary *summary.QuerySummary) (*QueryProcessor, error) {
 
+	return newQueryProcessor(firstAgg, queryInfo, querySummary, segutils.QUERY_EARLY_EXIT_LIMIT)
+}
+
+// Like NewQueryProcessor, but a records query returns up to maxRRCRows
+// records instead of the usual early exit limit.
+func newQueryProcessor(firstAgg *structs.QueryAggregators, queryInfo *query.QueryInformation,
+	querySummary *summary.QuerySummary, maxRRCRows uint64) (*QueryProcessor, error) {
+
 	startTime := time.Now()
 	sortMode := recentFirst // TODO: compute this from the query.
 	searcher, err := NewSearcher(queryInfo, querySummary, sortMode, startTime)
@@ -76,7 +85,7 @@ func NewQueryProcessor(firstAgg *structs.QueryAggregators, queryInfo *query.Quer
 
 	dataProcessors := make([]*DataProcessor, 0)
 	for curAgg := firstProcessorAgg; curAgg != nil; curAgg = curAgg.Next {
-		dataProcessor := asDataProcessor(curAgg)
+		dataProcessor := asDataProcessor(curAgg, queryInfo)
 		if dataProcessor == nil {
 			break
 		}
@@ -97,16 +106,16 @@ func NewQueryProcessor(firstAgg *structs.QueryAggregators, queryInfo *query.Quer
 		lastStreamer = dataProcessors[len(dataProcessors)-1]
 	}
 
-	return newQueryProcessorHelper(queryType, lastStreamer, dataProcessors, queryInfo.GetQid())
+	return newQueryProcessorHelper(queryType, lastStreamer, dataProcessors, queryInfo.GetQid(), maxRRCRows)
 }
 
 func newQueryProcessorHelper(queryType structs.QueryType, input streamer,
-	chain []*DataProcessor, qid uint64) (*QueryProcessor, error) {
+	chain []*DataProcessor, qid uint64, maxRRCRows uint64) (*QueryProcessor, error) {
 
 	var limit uint64
 	switch queryType {
 	case structs.RRCCmd:
-		limit = segutils.QUERY_EARLY_EXIT_LIMIT
+		limit = maxRRCRows
 	case structs.SegmentStatsCmd, structs.GroupByCmd:
 		limit = segutils.QUERY_MAX_BUCKETS
 	default:
@@ -128,27 +137,47 @@ func newQueryProcessorHelper(queryType structs.QueryType, input streamer,
 	}, nil
 }
 
-func asDataProcessor(queryAgg *structs.QueryAggregators) *DataProcessor {
+func asDataProcessor(queryAgg *structs.QueryAggregators, queryInfo *query.QueryInformation) *DataProcessor {
 	if queryAgg == nil {
 		return nil
 	}
 
 	if queryAgg.BinExpr != nil {
 		return NewBinDP(queryAgg.BinExpr)
+	} else if queryAgg.ChartExpr != nil {
+		return NewChartDP(queryAgg.ChartExpr)
 	} else if queryAgg.DedupExpr != nil {
 		return NewDedupDP(queryAgg.DedupExpr)
 	} else if queryAgg.EvalExpr != nil {
 		return NewEvalDP(queryAgg.EvalExpr)
+	} else if queryAgg.EventstatsExpr != nil {
+		return NewEventstatsDP(queryAgg.EventstatsExpr)
 	} else if queryAgg.FieldsExpr != nil {
 		return NewFieldsDP(queryAgg.FieldsExpr)
 	} else if queryAgg.FillNullExpr != nil {
 		return NewFillnullDP(queryAgg.FillNullExpr)
+	} else if queryAgg.ForeachExpr != nil {
+		return NewForeachDP(queryAgg.ForeachExpr)
 	} else if queryAgg.GentimesExpr != nil {
 		return NewGentimesDP(queryAgg.GentimesExpr)
+	} else if queryAgg.GeostatsExpr != nil {
+		return NewGeostatsDP(queryAgg.GeostatsExpr)
 	} else if queryAgg.HeadExpr != nil {
 		return NewHeadDP(queryAgg.HeadExpr)
+	} else if queryAgg.IPLocationExpr != nil {
+		return NewIPLocationDP(queryAgg.IPLocationExpr)
+	} else if queryAgg.JoinExpr != nil {
+		return NewJoinDP(queryAgg.JoinExpr, queryInfo)
+	} else if queryAgg.LogfmtExpr != nil {
+		return NewLogfmtDP(queryAgg.LogfmtExpr)
+	} else if queryAgg.LookupExpr != nil {
+		return NewLookupDP(queryAgg.LookupExpr)
 	} else if queryAgg.MakeMVExpr != nil {
 		return NewMakemvDP(queryAgg.MakeMVExpr)
+	} else if queryAgg.MakeResultsExpr != nil {
+		return NewMakeresultsDP(queryAgg.MakeResultsExpr)
+	} else if queryAgg.OutputLookupExpr != nil {
+		return NewOutputLookupDP(queryAgg.OutputLookupExpr)
 	} else if queryAgg.RareExpr != nil {
 		return NewRareDP(queryAgg.RareExpr)
 	} else if queryAgg.RegexExpr != nil {
@@ -175,17 +204,100 @@ func asDataProcessor(queryAgg *structs.QueryAggregators) *DataProcessor {
 		return NewTopDP(queryAgg.TopExpr)
 	} else if queryAgg.TransactionExpr != nil {
 		return NewTransactionDP(queryAgg.TransactionExpr)
+	} else if queryAgg.TstatsExpr != nil {
+		return NewTstatsDP(queryAgg.TstatsExpr, queryInfo)
+	} else if queryAgg.UntableExpr != nil {
+		return NewUntableDP(queryAgg.UntableExpr)
 	} else if queryAgg.WhereExpr != nil {
 		return NewWhereDP(queryAgg.WhereExpr)
+	} else if queryAgg.XyseriesExpr != nil {
+		return NewXyseriesDP(queryAgg.XyseriesExpr)
 	} else {
 		return nil
 	}
 }
 
+// Runs the query to completion and returns the values of the given columns;
+// a column that isn't in the results is left out. Unlike the usual query
+// processor, this fails when a command can't be run by a data processor
+// instead of stopping there, and when there are more than maxRows results.
+func RunQueryForColumns(node *structs.ASTNode, aggs *structs.QueryAggregators, qid uint64,
+	qc *structs.QueryContext, columns []string, maxRows uint64) (map[string][]segutils.CValueEnclosure, int, error) {
+
+	_, err := query.StartQuery(qid, false, nil)
+	if err != nil {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to start query; err=%v", err)
+	}
+	defer query.DeleteQuery(qid)
+
+	_, querySummary, queryInfo, pqid, _, _, _, containsKibana, _, err := query.PrepareToRunQuery(node,
+		node.TimeRange, aggs, qid, qc)
+	if err != nil {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to prepare query; err=%v", err)
+	}
+	defer querySummary.LogSummaryAndEmitMetrics(qid, pqid, containsKibana, qc.Orgid)
+
+	queryProcessor, err := newQueryProcessor(aggs, queryInfo, querySummary, maxRows+1)
+	if err != nil {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to create query processor; err=%v", err)
+	}
+	defer queryProcessor.Cleanup()
+
+	numAggs := 0
+	for agg := aggs; agg != nil; agg = agg.Next {
+		numAggs++
+	}
+	if queryProcessor.queryType != structs.RRCCmd {
+		// The searcher runs the first stats command.
+		numAggs--
+	}
+	if len(queryProcessor.chain) != numAggs {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: command %v of the query is not supported",
+			len(queryProcessor.chain)+1)
+	}
+
+	finalIQR, err := queryProcessor.getFullIQR()
+	if err != nil {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to get results; err=%v", err)
+	}
+
+	numRows := finalIQR.NumberOfRecords()
+	if uint64(numRows) > maxRows {
+		return nil, 0, fmt.Errorf("RunQueryForColumns: query has more than %v results", maxRows)
+	}
+
+	allColumns, err := finalIQR.GetColumns()
+	if err != nil {
+		return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to get columns; err=%v", err)
+	}
+
+	values := make(map[string][]segutils.CValueEnclosure, len(columns))
+	for _, cname := range columns {
+		if _, ok := allColumns[cname]; !ok {
+			continue
+		}
+		values[cname], err = finalIQR.ReadColumn(cname)
+		if err != nil {
+			return nil, 0, utils.TeeErrorf("RunQueryForColumns: failed to read column %v; err=%v", cname, err)
+		}
+	}
+
+	return values, numRows, nil
+}
+
 func (qp *QueryProcessor) GetFullResult() (*structs.PipeSearchResponseOuter, error) {
+	finalIQR, err := qp.getFullIQR()
+	if err != nil {
+		return nil, utils.TeeErrorf("GetFullResult: failed to get IQR; err=%v", err)
+	}
+
+	return finalIQR.AsResult(qp.queryType)
+}
+
+func (qp *QueryProcessor) getFullIQR() (*iqr.IQR, error) {
 	finalIQR, err := qp.DataProcessor.Fetch()
 	if err != nil && err != io.EOF {
-		return nil, utils.TeeErrorf("GetFullResult: failed initial fetch; err=%v", err)
+		return nil, utils.TeeErrorf("getFullIQR: failed initial fetch; err=%v", err)
 	}
 
 	if finalIQR == nil {
@@ -196,16 +308,16 @@ func (qp *QueryProcessor) GetFullResult() (*structs.PipeSearchResponseOuter, err
 	for err != io.EOF {
 		iqr, err = qp.DataProcessor.Fetch()
 		if err != nil && err != io.EOF {
-			return nil, utils.TeeErrorf("GetFullResult: failed to fetch; err=%v", err)
+			return nil, utils.TeeErrorf("getFullIQR: failed to fetch; err=%v", err)
 		}
 
 		appendErr := finalIQR.Append(iqr)
 		if appendErr != nil {
-			return nil, utils.TeeErrorf("GetFullResult: failed to append; err=%v", appendErr)
+			return nil, utils.TeeErrorf("getFullIQR: failed to append; err=%v", appendErr)
 		}
 	}
 
-	return finalIQR.AsResult(qp.queryType)
+	return finalIQR, nil
 }
 
 // Usage:
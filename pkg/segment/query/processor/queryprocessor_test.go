@@ -41,7 +41,7 @@ func Test_GetFullResult_notTruncated(t *testing.T) {
 		qid: qid,
 	}
 
-	queryProcessor, err := newQueryProcessorHelper(structs.RRCCmd, stream, nil, qid)
+	queryProcessor, err := newQueryProcessorHelper(structs.RRCCmd, stream, nil, qid, utils.QUERY_EARLY_EXIT_LIMIT)
 	assert.NoError(t, err)
 
 	response, err := queryProcessor.GetFullResult()
@@ -66,7 +66,7 @@ func Test_GetFullResult_truncated(t *testing.T) {
 		})
 	}
 
-	queryProcessor, err := newQueryProcessorHelper(structs.RRCCmd, stream, nil, qid)
+	queryProcessor, err := newQueryProcessorHelper(structs.RRCCmd, stream, nil, qid, utils.QUERY_EARLY_EXIT_LIMIT)
 	assert.NoError(t, err)
 
 	response, err := queryProcessor.GetFullResult()
@@ -96,14 +96,23 @@ func Test_NewQueryProcessor_simple(t *testing.T) {
 func Test_NewQueryProcessor_allCommands(t *testing.T) {
 	aggs := []structs.QueryAggregators{
 		{BinExpr: &structs.BinCmdOptions{}},
+		{ChartExpr: &structs.ChartExpr{}},
 		{DedupExpr: &structs.DedupExpr{}},
 		{EvalExpr: &structs.EvalExpr{}},
+		{EventstatsExpr: &structs.EventstatsExpr{}},
 		{FieldsExpr: &structs.ColumnsRequest{}},
 		{FillNullExpr: &structs.FillNullExpr{}},
+		{ForeachExpr: &structs.ForeachExpr{}},
 		{GentimesExpr: &structs.GenTimes{}},
+		{GeostatsExpr: &structs.GeostatsExpr{}},
 		{InputLookupExpr: &structs.InputLookup{}},
+		{IPLocationExpr: &structs.IPLocationExpr{}},
 		{HeadExpr: &structs.HeadExpr{}},
+		{JoinExpr: &structs.JoinExpr{}},
+		{LookupExpr: &structs.LookupExpr{}},
 		{MakeMVExpr: &structs.MultiValueColLetRequest{}},
+		{MakeResultsExpr: &structs.MakeResultsExpr{}},
+		{OutputLookupExpr: &structs.OutputLookupExpr{}},
 		{RareExpr: &structs.StatisticExpr{}},
 		{RegexExpr: &structs.RegexExpr{}},
 		{RexExpr: &structs.RexExpr{}},
@@ -114,7 +123,10 @@ func Test_NewQueryProcessor_allCommands(t *testing.T) {
 		{TimechartExpr: &structs.TimechartExpr{}},
 		{TopExpr: &structs.StatisticExpr{}},
 		{TransactionExpr: &structs.TransactionArguments{}},
+		{TstatsExpr: &structs.TstatsExpr{}},
+		{UntableExpr: &structs.UntableExpr{}},
 		{WhereExpr: &structs.BoolExpr{}},
+		{XyseriesExpr: &structs.XyseriesExpr{}},
 	}
 
 	for i := 1; i < len(aggs); i++ {
@@ -18,22 +18,111 @@
 package processor
 
 import (
+	"fmt"
+	"io"
+	"regexp"
+
 	"github.com/siglens/siglens/pkg/segment/query/iqr"
 	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
 )
 
 type rexProcessor struct {
-	options *structs.RexExpr
+	options       *structs.RexExpr
+	compiledRegex *regexp.Regexp
 }
 
+// Extracts the named groups of the pattern into columns. A record that doesn't
+// match keeps the values it already had for those columns.
 func (p *rexProcessor) Process(iqr *iqr.IQR) (*iqr.IQR, error) {
-	panic("not implemented")
+	if iqr == nil {
+		return nil, io.EOF
+	}
+
+	if p.compiledRegex == nil {
+		compiledRegex, err := regexp.Compile(p.options.Pattern)
+		if err != nil {
+			return nil, toputils.TeeErrorf("qid=%v, rex.Process: invalid pattern %v; err=%v",
+				iqr.GetQID(), p.options.Pattern, err)
+		}
+		p.compiledRegex = compiledRegex
+	}
+
+	numRecords := iqr.NumberOfRecords()
+	if numRecords == 0 {
+		return iqr, nil
+	}
+
+	existingColumns, err := iqr.GetColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, rex.Process: cannot get columns; err=%v", iqr.GetQID(), err)
+	}
+	if _, ok := existingColumns[p.options.FieldName]; !ok {
+		return iqr, nil
+	}
+
+	fieldValues, err := iqr.ReadColumn(p.options.FieldName)
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, rex.Process: cannot read column %v; err=%v",
+			iqr.GetQID(), p.options.FieldName, err)
+	}
+
+	knownValues := make(map[string][]utils.CValueEnclosure, len(p.options.RexColNames))
+	for _, rexColName := range p.options.RexColNames {
+		values := make([]utils.CValueEnclosure, numRecords)
+		if _, ok := existingColumns[rexColName]; ok {
+			existingValues, err := iqr.ReadColumn(rexColName)
+			if err != nil {
+				return nil, toputils.TeeErrorf("qid=%v, rex.Process: cannot read column %v; err=%v",
+					iqr.GetQID(), rexColName, err)
+			}
+			copy(values, existingValues)
+		} else {
+			for i := range values {
+				values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			}
+		}
+		knownValues[rexColName] = values
+	}
+
+	for i := range fieldValues {
+		fieldValue, err := fieldValues[i].GetString()
+		if err != nil {
+			fieldValue = fmt.Sprintf("%v", fieldValues[i].CVal)
+		}
+
+		rexResultMap, err := structs.MatchAndExtractGroups(fieldValue, p.compiledRegex)
+		if err != nil {
+			continue
+		}
+
+		for rexColName, value := range rexResultMap {
+			values, ok := knownValues[rexColName]
+			if !ok {
+				continue
+			}
+
+			err := values[i].ConvertValue(utils.GetLiteralFromString(value))
+			if err != nil {
+				return nil, toputils.TeeErrorf("qid=%v, rex.Process: cannot convert value %v; err=%v",
+					iqr.GetQID(), value, err)
+			}
+		}
+	}
+
+	err = iqr.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("qid=%v, rex.Process: cannot append extracted values; err=%v", iqr.GetQID(), err)
+	}
+
+	return iqr, nil
 }
 
 func (p *rexProcessor) Rewind() {
-	panic("not implemented")
+	// Nothing to do.
 }
 
 func (p *rexProcessor) Cleanup() {
-	panic("not implemented")
+	// Nothing to do.
 }
@@ -0,0 +1,71 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Rex(t *testing.T) {
+	iqr1 := iqr.NewIQR(0)
+	err := iqr1.AppendKnownValues(map[string][]utils.CValueEnclosure{
+		"line": {
+			{Dtype: utils.SS_DT_STRING, CVal: "GET /index.html 200"},
+			{Dtype: utils.SS_DT_STRING, CVal: "garbage"},
+			{Dtype: utils.SS_DT_STRING, CVal: "POST /login 500"},
+		},
+		"method": {
+			{Dtype: utils.SS_DT_STRING, CVal: "old"},
+			{Dtype: utils.SS_DT_STRING, CVal: "old"},
+			{Dtype: utils.SS_DT_STRING, CVal: "old"},
+		},
+	})
+	assert.NoError(t, err)
+
+	processor := &rexProcessor{options: &structs.RexExpr{
+		FieldName:   "line",
+		Pattern:     `(?P<method>\w+) (?P<path>\S+) (?P<status>\d+)`,
+		RexColNames: []string{"method", "path", "status"},
+	}}
+
+	result, err := processor.Process(iqr1)
+	assert.NoError(t, err)
+
+	values, err := result.ReadAllColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_STRING, CVal: "GET"},
+		{Dtype: utils.SS_DT_STRING, CVal: "old"},
+		{Dtype: utils.SS_DT_STRING, CVal: "POST"},
+	}, values["method"])
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_STRING, CVal: "/index.html"},
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+		{Dtype: utils.SS_DT_STRING, CVal: "/login"},
+	}, values["path"])
+	assert.Equal(t, []utils.CValueEnclosure{
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(200)},
+		{Dtype: utils.SS_DT_BACKFILL, CVal: nil},
+		{Dtype: utils.SS_DT_SIGNED_NUM, CVal: int64(500)},
+	}, values["status"])
+}
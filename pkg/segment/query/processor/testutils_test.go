@@ -0,0 +1,58 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// The values are copied, so the same fixture can be used for several IQRs.
+func newTestIQR(t *testing.T, knownValues map[string][]utils.CValueEnclosure) *iqr.IQR {
+	t.Helper()
+
+	valuesCopy := make(map[string][]utils.CValueEnclosure, len(knownValues))
+	for cname, values := range knownValues {
+		valuesCopy[cname] = append([]utils.CValueEnclosure(nil), values...)
+	}
+
+	result := iqr.NewIQR(0)
+	err := result.AppendKnownValues(valuesCopy)
+	assert.NoError(t, err)
+
+	return result
+}
+
+func stringCVal(s string) utils.CValueEnclosure {
+	return utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: s}
+}
+
+func intCVal(i int64) utils.CValueEnclosure {
+	return utils.CValueEnclosure{Dtype: utils.SS_DT_SIGNED_NUM, CVal: i}
+}
+
+func floatCVal(f float64) utils.CValueEnclosure {
+	return utils.CValueEnclosure{Dtype: utils.SS_DT_FLOAT, CVal: f}
+}
+
+func backfillCVal() utils.CValueEnclosure {
+	return utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"sort"
+
+	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/segment/aggregations"
+	segmetadata "github.com/siglens/siglens/pkg/segment/metadata"
+	"github.com/siglens/siglens/pkg/segment/query"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/reader/segread"
+	"github.com/siglens/siglens/pkg/segment/results/segresults"
+	"github.com/siglens/siglens/pkg/segment/search"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/siglens/siglens/pkg/segment/writer"
+	toputils "github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// tstats answers only from rotated segments: group by requests use each
+// segment's star tree and other requests use its segment stats. If some data
+// in the query time range cannot be answered this way (a segment is only partly
+// in the range, spans more than one time bucket, has deleted records, or lacks
+// the needed structure, or the data hasn't been rotated into a segment yet),
+// the whole command fails instead of falling back to a raw search.
+type tstatsProcessor struct {
+	options     *structs.TstatsExpr
+	queryInfo   *query.QueryInformation
+	qid         uint64
+	spanMillis  uint64
+	hasFinished bool
+}
+
+func (p *tstatsProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil || p.hasFinished {
+		return nil, io.EOF
+	}
+
+	p.hasFinished = true
+	p.qid = inputIQR.GetQID()
+
+	err := validateTstatsMeasureOps(p.options.MeasureOperations, len(p.options.GroupByColumns) > 0)
+	if err != nil {
+		return nil, toputils.TeeErrorf("tstats.Process: %v", err)
+	}
+
+	if p.options.SpanLength != nil {
+		p.spanMillis = aggregations.GetIntervalInMillis(p.options.SpanLength.Num, p.options.SpanLength.TimeScalr)
+	}
+
+	bucketToResults, err := p.computeResults()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.appendResults(inputIQR, bucketToResults)
+	if err != nil {
+		return nil, err
+	}
+
+	return inputIQR, io.EOF
+}
+
+func (p *tstatsProcessor) Rewind() {
+	p.hasFinished = false
+}
+
+func (p *tstatsProcessor) Cleanup() {
+	// Nothing to do.
+}
+
+// Star trees only store count, sum, min, and max for each measure column, and
+// segment stats additionally have a cardinality sketch.
+func validateTstatsMeasureOps(measureOps []*structs.MeasureAggregator, hasGroupBy bool) error {
+	for _, measureOp := range measureOps {
+		switch measureOp.MeasureFunc {
+		case utils.Count, utils.Sum, utils.Min, utils.Max, utils.Avg:
+			continue
+		case utils.Cardinality, utils.Range:
+			if !hasGroupBy {
+				continue
+			}
+		}
+
+		if hasGroupBy {
+			return toputils.TeeErrorf("%v is not supported with a by clause; only count, sum, min, max, and avg are", measureOp.String())
+		}
+		return toputils.TeeErrorf("%v is not supported; only count, sum, min, max, avg, range, and dc are", measureOp.String())
+	}
+
+	return nil
+}
+
+func (p *tstatsProcessor) getIndexNames() []string {
+	if len(p.options.IndexNames) == 0 {
+		return p.queryInfo.GetIndexInfo().GetQueryTables()
+	}
+
+	indexNames := make([]string, 0)
+	for _, indexName := range p.options.IndexNames {
+		tableInfo := structs.InitTableInfo(indexName, p.queryInfo.GetOrgId(), false)
+		indexNames = append(indexNames, tableInfo.GetQueryTables()...)
+	}
+
+	return indexNames
+}
+
+// Returns the results for each time bucket. When there's no span, everything
+// is in bucket 0.
+func (p *tstatsProcessor) computeResults() (map[uint64]*segresults.SearchResults, error) {
+	timeRange := p.queryInfo.GetQueryRange()
+	indexNames := p.getIndexNames()
+	err := p.checkNoUnrotatedData(indexNames)
+	if err != nil {
+		return nil, err
+	}
+
+	indexToSegments, _, _ := segmetadata.FilterSegmentsByTime(timeRange, indexNames, p.queryInfo.GetOrgId())
+
+	segKeyToInfo := make(map[string]*structs.SegmentByTimeAndColSizes)
+	for _, segments := range indexToSegments {
+		for segKey, segInfo := range segments {
+			segKeyToInfo[segKey] = segInfo
+		}
+	}
+
+	segKeys := toputils.GetKeysOfMap(segKeyToInfo)
+	sort.Strings(segKeys)
+
+	bucketToResults := make(map[uint64]*segresults.SearchResults)
+	for _, segKey := range segKeys {
+		segInfo := segKeyToInfo[segKey]
+		segTimeRange := segInfo.TimeRange
+		if !timeRange.AreTimesFullyEnclosed(segTimeRange.StartEpochMs, segTimeRange.EndEpochMs) {
+			return nil, toputils.TeeErrorf("tstats.computeResults: segment %v has data from %v to %v, which is only partly in the query time range",
+				segKey, segTimeRange.StartEpochMs, segTimeRange.EndEpochMs)
+		}
+
+		// Star trees and segment stats still count deleted records.
+		if tombstones.HasTombstones(segKey) {
+			return nil, toputils.TeeErrorf("tstats.computeResults: segment %v has deleted records", segKey)
+		}
+
+		bucket, err := p.getBucket(segKey, segTimeRange)
+		if err != nil {
+			return nil, err
+		}
+
+		searchResults, ok := bucketToResults[bucket]
+		if !ok {
+			searchResults, err = p.initSearchResults()
+			if err != nil {
+				return nil, toputils.TeeErrorf("tstats.computeResults: cannot initialize search results; err=%v", err)
+			}
+			bucketToResults[bucket] = searchResults
+		}
+
+		if len(p.options.GroupByColumns) > 0 {
+			err = p.applyStarTree(segKey, searchResults)
+		} else {
+			err = p.applySegmentStats(segKey, uint64(segInfo.TotalRecords), searchResults)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("qid=%v, tstats.computeResults: answered from %v segments", p.qid, len(segKeys))
+
+	return bucketToResults, nil
+}
+
+// Data that hasn't been rotated into a segment yet has no star tree or segment
+// stats.
+func (p *tstatsProcessor) checkNoUnrotatedData(indexNames []string) error {
+	timeRange := p.queryInfo.GetQueryRange()
+	indexToTimestamps := writer.GetUnrotatedVTableTimestamps(p.queryInfo.GetOrgId())
+	for _, indexName := range indexNames {
+		timestamps, ok := indexToTimestamps[indexName]
+		if ok && timeRange.CheckRangeOverLap(timestamps.Earliest, timestamps.Latest) {
+			return toputils.TeeErrorf("tstats.checkNoUnrotatedData: index %v has data from %v to %v that is not in a segment yet",
+				indexName, timestamps.Earliest, timestamps.Latest)
+		}
+	}
+
+	return nil
+}
+
+func (p *tstatsProcessor) getBucket(segKey string, segTimeRange *dtu.TimeRange) (uint64, error) {
+	if p.spanMillis == 0 {
+		return 0, nil
+	}
+
+	startBucket := segTimeRange.StartEpochMs - segTimeRange.StartEpochMs%p.spanMillis
+	endBucket := segTimeRange.EndEpochMs - segTimeRange.EndEpochMs%p.spanMillis
+	if startBucket != endBucket {
+		return 0, toputils.TeeErrorf("tstats.getBucket: segment %v has data from %v to %v, which is more than one span of %vms",
+			segKey, segTimeRange.StartEpochMs, segTimeRange.EndEpochMs, p.spanMillis)
+	}
+
+	return startBucket, nil
+}
+
+func (p *tstatsProcessor) getGroupByAggs() *structs.QueryAggregators {
+	return &structs.QueryAggregators{
+		GroupByRequest: &structs.GroupByRequest{
+			GroupByColumns:    p.options.GroupByColumns,
+			MeasureOperations: p.options.MeasureOperations,
+			BucketCount:       int(utils.QUERY_MAX_BUCKETS),
+		},
+	}
+}
+
+func (p *tstatsProcessor) initSearchResults() (*segresults.SearchResults, error) {
+	if len(p.options.GroupByColumns) > 0 {
+		return segresults.InitSearchResults(0, p.getGroupByAggs(), structs.GroupByCmd, p.qid)
+	}
+
+	aggs := &structs.QueryAggregators{MeasureOperations: p.options.MeasureOperations}
+	searchResults, err := segresults.InitSearchResults(0, aggs, structs.SegmentStatsCmd, p.qid)
+	if err != nil {
+		return nil, err
+	}
+	searchResults.InitSegmentStatsResults(p.options.MeasureOperations)
+
+	return searchResults, nil
+}
+
+func (p *tstatsProcessor) applyStarTree(segKey string, searchResults *segresults.SearchResults) error {
+	aggs := p.getGroupByAggs()
+	canUse, agileTreeReader := search.CanDoStarTree(segKey, aggs, p.qid)
+	if !canUse {
+		return toputils.TeeErrorf("tstats.applyStarTree: segment %v has no star tree for grouping by %v with %v",
+			segKey, p.options.GroupByColumns, structs.GetMeasureAggregatorStrEncColumns(p.options.MeasureOperations))
+	}
+	defer agileTreeReader.Close()
+
+	numErrors := len(searchResults.AllErrors)
+	search.ApplyAgileTree(agileTreeReader, aggs, searchResults, 0, p.qid, nil)
+	if len(searchResults.AllErrors) > numErrors {
+		return toputils.TeeErrorf("tstats.applyStarTree: cannot read star tree for segment %v; err=%v",
+			segKey, searchResults.AllErrors[numErrors])
+	}
+
+	return nil
+}
+
+func (p *tstatsProcessor) applySegmentStats(segKey string, numRecords uint64, searchResults *segresults.SearchResults) error {
+	sstMap, err := segread.ReadSegStats(segKey, p.qid)
+	if err != nil {
+		return toputils.TeeErrorf("tstats.applySegmentStats: cannot read segment stats for segment %v; err=%v", segKey, err)
+	}
+
+	sstMap["*"] = &structs.SegStats{
+		Count: numRecords,
+	}
+
+	err = searchResults.UpdateSegmentStats(sstMap, p.options.MeasureOperations)
+	if err != nil {
+		return toputils.TeeErrorf("tstats.applySegmentStats: cannot use segment stats for segment %v; err=%v", segKey, err)
+	}
+
+	return nil
+}
+
+func (p *tstatsProcessor) appendResults(outputIQR *iqr.IQR, bucketToResults map[uint64]*segresults.SearchResults) error {
+	buckets := toputils.GetKeysOfMap(bucketToResults)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	var resultIQR *iqr.IQR
+	for _, bucket := range buckets {
+		searchResults := bucketToResults[bucket]
+
+		var bucketHolderArr []*structs.BucketHolder
+		var measureFuncs, groupByCols []string
+		var bucketCount int
+		if len(p.options.GroupByColumns) > 0 {
+			// Load and convert the bucket results.
+			_ = searchResults.GetBucketResults()
+			bucketHolderArr, measureFuncs, groupByCols, _, bucketCount = searchResults.GetGroupyByBuckets(int(utils.QUERY_MAX_BUCKETS))
+		} else {
+			bucketHolderArr, measureFuncs, groupByCols, _, bucketCount = searchResults.GetSegmentStatsResults(0, false)
+		}
+
+		bucketIQR := iqr.NewIQR(p.qid)
+		err := bucketIQR.AppendStatsResults(bucketHolderArr, measureFuncs, groupByCols, bucketCount)
+		if err != nil {
+			return toputils.TeeErrorf("tstats.appendResults: cannot append stats results; err=%v", err)
+		}
+
+		if p.spanMillis > 0 && bucketCount > 0 {
+			timestamps := make([]utils.CValueEnclosure, bucketCount)
+			for i := range timestamps {
+				timestamps[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_UNSIGNED_NUM, CVal: bucket}
+			}
+
+			err = bucketIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{
+				config.GetTimeStampKey(): timestamps,
+			})
+			if err != nil {
+				return toputils.TeeErrorf("tstats.appendResults: cannot append timestamps; err=%v", err)
+			}
+		}
+
+		if resultIQR == nil {
+			resultIQR = bucketIQR
+			continue
+		}
+
+		err = resultIQR.Append(bucketIQR)
+		if err != nil {
+			return toputils.TeeErrorf("tstats.appendResults: cannot append results for bucket %v; err=%v", bucket, err)
+		}
+	}
+
+	return p.appendValues(outputIQR, resultIQR)
+}
+
+// The stats results are added as plain values, since the output IQR doesn't
+// have the same group by and measure columns.
+func (p *tstatsProcessor) appendValues(outputIQR *iqr.IQR, resultIQR *iqr.IQR) error {
+	if resultIQR != nil && resultIQR.NumberOfRecords() > 0 {
+		values, err := resultIQR.ReadAllColumns()
+		if err != nil {
+			return toputils.TeeErrorf("tstats.appendValues: cannot read results; err=%v", err)
+		}
+
+		err = outputIQR.AppendKnownValues(values)
+		if err != nil {
+			return toputils.TeeErrorf("tstats.appendValues: cannot append results; err=%v", err)
+		}
+	}
+
+	outputIQR.AddColumnIndex(p.getColumnIndex())
+
+	return nil
+}
+
+func (p *tstatsProcessor) getColumnIndex() map[string]int {
+	columnIndex := map[string]int{config.GetTimeStampKey(): 0}
+	for i, groupByCol := range p.options.GroupByColumns {
+		columnIndex[groupByCol] = 1 + i
+	}
+	for i, measureOp := range p.options.MeasureOperations {
+		columnIndex[measureOp.String()] = 1 + len(p.options.GroupByColumns) + i
+	}
+
+	return columnIndex
+}
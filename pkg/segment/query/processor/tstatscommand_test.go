@@ -0,0 +1,278 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
+	"github.com/siglens/siglens/pkg/config"
+	segmetadata "github.com/siglens/siglens/pkg/segment/metadata"
+	"github.com/siglens/siglens/pkg/segment/query"
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/siglens/siglens/pkg/segment/writer"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTstatsTestQueryInfo(t *testing.T, startMs uint64, endMs uint64) *query.QueryInformation {
+	t.Helper()
+
+	timeRange := &dtu.TimeRange{StartEpochMs: startMs, EndEpochMs: endMs}
+	searchNode := &structs.SearchNode{NodeType: structs.MatchAllQuery}
+	tableInfo := structs.InitTableInfo("tstats-test", 0, false)
+	queryInfo, err := query.InitQueryInformation(searchNode, nil, timeRange, tableInfo, 100, 1, 0, nil, 0, 0)
+	assert.NoError(t, err)
+
+	return queryInfo
+}
+
+func addTstatsTestSegment(t *testing.T, segKey string, startMs uint64, endMs uint64) {
+	t.Helper()
+
+	segMeta := &structs.SegMeta{
+		SegmentKey:       segKey,
+		VirtualTableName: "tstats-test",
+		EarliestEpochMS:  startMs,
+		LatestEpochMS:    endMs,
+		RecordCount:      10,
+	}
+	segmetadata.BulkAddSegmentMicroIndex([]*segmetadata.SegmentMicroIndex{
+		segmetadata.InitSegmentMicroIndex(segMeta, false),
+	})
+}
+
+func Test_Tstats_NoSegments(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	assert.True(t, dp.IsDataGenerator())
+
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, result.NumberOfRecords())
+
+	result, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, result)
+}
+
+func Test_Tstats_UnsupportedFunction(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "x", MeasureFunc: utils.Values}},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+
+	tstatsExpr = &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "x", MeasureFunc: utils.Cardinality}},
+		GroupByColumns:    []string{"host"},
+	}
+	dp = NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+}
+
+func writeTstatsTestSegStats(t *testing.T, segKey string, sum int64, max int64) {
+	t.Helper()
+
+	numStats := &structs.NumericStats{
+		Min: utils.NumTypeEnclosure{Ntype: utils.SS_DT_SIGNED_NUM, IntgrVal: 0},
+		Max: utils.NumTypeEnclosure{Ntype: utils.SS_DT_SIGNED_NUM, IntgrVal: max},
+		Sum: utils.NumTypeEnclosure{Ntype: utils.SS_DT_SIGNED_NUM, IntgrVal: sum},
+	}
+	segStats := &structs.SegStats{IsNumeric: true, Count: 5, NumStats: numStats}
+	segStats.CreateNewHll()
+
+	segStore := writer.NewSegStore(0)
+	segStore.SegmentKey = segKey
+	segStore.AllSst = map[string]*structs.SegStats{"x": segStats}
+	assert.NoError(t, segStore.FlushSegStats())
+}
+
+func Test_Tstats_SegmentStats(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	dir := t.TempDir()
+	addTstatsTestSegment(t, dir+"/seg0", 100, 200)
+	writeTstatsTestSegStats(t, dir+"/seg0", 12, 7)
+	addTstatsTestSegment(t, dir+"/seg1", 300, 400)
+	writeTstatsTestSegStats(t, dir+"/seg1", 30, 9)
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{
+			{MeasureCol: "*", MeasureFunc: utils.Count, StrEnc: "count(*)"},
+			{MeasureCol: "x", MeasureFunc: utils.Sum, StrEnc: "sum(x)"},
+			{MeasureCol: "x", MeasureFunc: utils.Max, StrEnc: "max(x)"},
+		},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 1, result.NumberOfRecords())
+
+	values, err := result.ReadAllColumns()
+	assert.NoError(t, err)
+	assertTstatsFloat(t, 20, values["count(*)"][0])
+	assertTstatsFloat(t, 42, values["sum(x)"][0])
+	assertTstatsFloat(t, 9, values["max(x)"][0])
+}
+
+func Test_Tstats_SegmentStatsWithSpan(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	dir := t.TempDir()
+	addTstatsTestSegment(t, dir+"/seg0", 1100, 1200)
+	writeTstatsTestSegStats(t, dir+"/seg0", 12, 7)
+	addTstatsTestSegment(t, dir+"/seg1", 1300, 1400)
+	writeTstatsTestSegStats(t, dir+"/seg1", 30, 9)
+	addTstatsTestSegment(t, dir+"/seg2", 2100, 2200)
+	writeTstatsTestSegStats(t, dir+"/seg2", 5, 3)
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{
+			{MeasureCol: "x", MeasureFunc: utils.Sum, StrEnc: "sum(x)"},
+		},
+		SpanLength: &structs.SpanLength{Num: 1, TimeScalr: utils.TMSecond},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 5000))
+	result, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	values, err := result.ReadAllColumns()
+	assert.NoError(t, err)
+	timestamps := values[config.GetTimeStampKey()]
+	assert.Equal(t, uint64(1000), timestamps[0].CVal)
+	assert.Equal(t, uint64(2000), timestamps[1].CVal)
+	assertTstatsFloat(t, 42, values["sum(x)"][0])
+	assertTstatsFloat(t, 5, values["sum(x)"][1])
+}
+
+func assertTstatsFloat(t *testing.T, expected float64, value utils.CValueEnclosure) {
+	t.Helper()
+
+	actual, err := value.GetFloatValue()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func Test_Tstats_SegmentPartlyInTimeRange(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	addTstatsTestSegment(t, t.TempDir()+"/seg0", 500, 1500)
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+}
+
+func Test_Tstats_SegmentWithDeletedRecords(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	segKey := t.TempDir() + "/seg0"
+	addTstatsTestSegment(t, segKey, 100, 200)
+	err := tombstones.AddTombstones(segKey, map[uint16][]uint16{0: {3}})
+	assert.NoError(t, err)
+	t.Cleanup(func() { tombstones.DeleteSegmentKey(segKey) })
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.ErrorContains(t, err, "deleted records")
+}
+
+func Test_Tstats_SegmentSpansMultipleBuckets(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	addTstatsTestSegment(t, t.TempDir()+"/seg0", 500, 1500)
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}},
+		SpanLength:        &structs.SpanLength{Num: 1, TimeScalr: utils.TMSecond},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 5000))
+	_, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+}
+
+func Test_Tstats_MissingPreAggregatedData(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+	segmetadata.ResetGlobalMetadataForTest()
+	t.Cleanup(segmetadata.ResetGlobalMetadataForTest)
+
+	// The segment has no segment stats or star tree files on disk.
+	addTstatsTestSegment(t, t.TempDir()+"/seg0", 100, 200)
+
+	tstatsExpr := &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "x", MeasureFunc: utils.Sum}},
+	}
+	dp := NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err := dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+
+	tstatsExpr = &structs.TstatsExpr{
+		MeasureOperations: []*structs.MeasureAggregator{{MeasureCol: "*", MeasureFunc: utils.Count}},
+		GroupByColumns:    []string{"host"},
+	}
+	dp = NewTstatsDP(tstatsExpr, getTstatsTestQueryInfo(t, 0, 1000))
+	_, err = dp.processor.Process(iqr.NewIQR(0))
+	assert.Error(t, err)
+}
+
+func Test_Tstats_GetBucket(t *testing.T) {
+	processor := &tstatsProcessor{spanMillis: 1000}
+
+	bucket, err := processor.getBucket("seg0", &dtu.TimeRange{StartEpochMs: 2100, EndEpochMs: 2999})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2000), bucket)
+
+	_, err = processor.getBucket("seg0", &dtu.TimeRange{StartEpochMs: 2100, EndEpochMs: 3000})
+	assert.Error(t, err)
+
+	processor.spanMillis = 0
+	bucket, err = processor.getBucket("seg0", &dtu.TimeRange{StartEpochMs: 2100, EndEpochMs: 3000})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), bucket)
+}
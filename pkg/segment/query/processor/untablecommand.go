@@ -0,0 +1,108 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"sort"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+// Converts each record into one record per non-null field other than the x
+// field; this undoes xyseries.
+type untableProcessor struct {
+	options *structs.UntableExpr
+}
+
+func (p *untableProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR == nil {
+		return nil, io.EOF
+	}
+
+	columns, err := inputIQR.GetColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("untable.Process: failed to get columns; err=%v", err)
+	}
+
+	allValues, err := inputIQR.ReadAllColumns()
+	if err != nil {
+		return nil, toputils.TeeErrorf("untable.Process: failed to read columns; err=%v", err)
+	}
+
+	delete(columns, p.options.XField)
+	columnNames := toputils.GetKeysOfMap(columns)
+	sort.Strings(columnNames)
+	columnNames = inputIQR.GetColumnsOrder(columnNames)
+
+	numRecords := inputIQR.NumberOfRecords()
+	xValues, hasXField := allValues[p.options.XField]
+
+	outputXValues := make([]utils.CValueEnclosure, 0, numRecords)
+	outputNames := make([]utils.CValueEnclosure, 0, numRecords)
+	outputValues := make([]utils.CValueEnclosure, 0, numRecords)
+	for i := 0; i < numRecords; i++ {
+		xValue := utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+		if hasXField {
+			xValue = xValues[i]
+		}
+
+		for _, columnName := range columnNames {
+			values, ok := allValues[columnName]
+			if !ok || values[i].IsNull() {
+				continue
+			}
+
+			outputXValues = append(outputXValues, xValue)
+			outputNames = append(outputNames, utils.CValueEnclosure{Dtype: utils.SS_DT_STRING, CVal: columnName})
+			outputValues = append(outputValues, values[i])
+		}
+	}
+
+	outputIQR := iqr.NewIQR(inputIQR.GetQID())
+	if len(outputValues) == 0 {
+		return outputIQR, nil
+	}
+
+	err = outputIQR.AppendKnownValues(map[string][]utils.CValueEnclosure{
+		p.options.XField:     outputXValues,
+		p.options.NameField:  outputNames,
+		p.options.ValueField: outputValues,
+	})
+	if err != nil {
+		return nil, toputils.TeeErrorf("untable.Process: failed to append known values; err=%v", err)
+	}
+	outputIQR.AddColumnIndex(map[string]int{
+		p.options.XField:     0,
+		p.options.NameField:  1,
+		p.options.ValueField: 2,
+	})
+
+	return outputIQR, nil
+}
+
+func (p *untableProcessor) Rewind() {
+	// nothing to do
+}
+
+func (p *untableProcessor) Cleanup() {
+	// nothing to do
+}
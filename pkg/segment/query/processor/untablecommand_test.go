@@ -0,0 +1,82 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Untable(t *testing.T) {
+	iqr1 := newTestIQR(t, map[string][]utils.CValueEnclosure{
+		"host": {stringCVal("web1"), stringCVal("web2")},
+		"200":  {intCVal(10), intCVal(7)},
+		"500":  {intCVal(2), backfillCVal()},
+	})
+
+	dp := NewUntableDP(&structs.UntableExpr{XField: "host", NameField: "status", ValueField: "count"})
+	result, err := dp.processor.Process(iqr1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.NumberOfRecords())
+
+	hosts, err := result.ReadColumn("host")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("web1"), stringCVal("web1"), stringCVal("web2")}, hosts)
+
+	names, err := result.ReadColumn("status")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("200"), stringCVal("500"), stringCVal("200")}, names)
+
+	values, err := result.ReadColumn("count")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(10), intCVal(2), intCVal(7)}, values)
+
+	result, err = dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, result)
+}
+
+func Test_Untable_AfterXyseries(t *testing.T) {
+	xyseriesDP := NewXyseriesDP(&structs.XyseriesExpr{XField: "host", YField: "status", ValueFields: []string{"count"}})
+	_, err := xyseriesDP.processor.Process(newTestIQR(t, xyseriesTestValues))
+	assert.NoError(t, err)
+	wideIQR, err := xyseriesDP.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+
+	untableDP := NewUntableDP(&structs.UntableExpr{XField: "host", NameField: "status", ValueField: "count"})
+	result, err := untableDP.processor.Process(wideIQR)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.NumberOfRecords())
+
+	// The columns keep the order xyseries gave them.
+	hosts, err := result.ReadColumn("host")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("web1"), stringCVal("web1"), stringCVal("web2"), stringCVal("web2")}, hosts)
+
+	names, err := result.ReadColumn("status")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("200"), stringCVal("500"), stringCVal("200"), stringCVal("404")}, names)
+
+	values, err := result.ReadColumn("count")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(10), intCVal(2), intCVal(7), intCVal(1)}, values)
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/siglens/siglens/pkg/segment/query/iqr"
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+)
+
+type xyseriesProcessor struct {
+	options *structs.XyseriesExpr
+	qid     uint64
+
+	rows        []*xyseriesRow
+	xValueToRow map[string]*xyseriesRow
+	yValues     []string // In the order they were first seen.
+	seenYValues map[string]struct{}
+}
+
+// Holds one output row; each cell is keyed by the y value and the index of
+// the value field.
+type xyseriesRow struct {
+	xValue utils.CValueEnclosure
+	cells  map[string][]utils.CValueEnclosure
+}
+
+func (p *xyseriesProcessor) Process(inputIQR *iqr.IQR) (*iqr.IQR, error) {
+	if inputIQR != nil {
+		return nil, p.collect(inputIQR)
+	}
+
+	if len(p.rows) == 0 {
+		return nil, io.EOF
+	}
+
+	outputIQR, err := p.getXyseriesIQR()
+	if err != nil {
+		return nil, toputils.TeeErrorf("xyseries.Process: failed to build results; err=%v", err)
+	}
+
+	return outputIQR, io.EOF
+}
+
+func (p *xyseriesProcessor) collect(inputIQR *iqr.IQR) error {
+	if p.xValueToRow == nil {
+		p.qid = inputIQR.GetQID()
+		p.rows = make([]*xyseriesRow, 0)
+		p.xValueToRow = make(map[string]*xyseriesRow)
+		p.yValues = make([]string, 0)
+		p.seenYValues = make(map[string]struct{})
+	}
+
+	xValues, err := inputIQR.ReadColumn(p.options.XField)
+	if err != nil {
+		// No record has the x field, so they can't be part of any row.
+		return nil
+	}
+
+	yValues, err := inputIQR.ReadColumn(p.options.YField)
+	if err != nil {
+		// No record has the y field, so they can't be part of any column.
+		return nil
+	}
+
+	values := make([][]utils.CValueEnclosure, len(p.options.ValueFields))
+	for i, valueField := range p.options.ValueFields {
+		values[i], err = inputIQR.ReadColumn(valueField)
+		if err != nil {
+			values[i] = nil
+		}
+	}
+
+	for i := range xValues {
+		if xValues[i].IsNull() || yValues[i].IsNull() {
+			continue
+		}
+
+		xValue := string(xValues[i].AsBytes())
+		row, ok := p.xValueToRow[xValue]
+		if !ok {
+			row = &xyseriesRow{xValue: xValues[i], cells: make(map[string][]utils.CValueEnclosure)}
+			p.xValueToRow[xValue] = row
+			p.rows = append(p.rows, row)
+		}
+
+		yValue := string(yValues[i].AsBytes())
+		if _, ok := p.seenYValues[yValue]; !ok {
+			p.seenYValues[yValue] = struct{}{}
+			p.yValues = append(p.yValues, yValue)
+		}
+
+		cell, ok := row.cells[yValue]
+		if !ok {
+			cell = make([]utils.CValueEnclosure, len(values))
+			for j := range cell {
+				cell[j] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+			}
+			row.cells[yValue] = cell
+		}
+
+		// Like Splunk, later records overwrite earlier ones for the same cell.
+		for j := range values {
+			if values[j] != nil && !values[j][i].IsNull() {
+				cell[j] = values[j][i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// The x field is the first column. With one value field, the other columns
+// are named by the y values; otherwise they're named "<value field>: <y value>".
+func (p *xyseriesProcessor) getXyseriesIQR() (*iqr.IQR, error) {
+	numColumns := 1 + len(p.options.ValueFields)*len(p.yValues)
+	knownValues := make(map[string][]utils.CValueEnclosure, numColumns)
+	columnIndex := make(map[string]int, numColumns)
+
+	xValues := make([]utils.CValueEnclosure, len(p.rows))
+	for i, row := range p.rows {
+		xValues[i] = row.xValue
+	}
+	knownValues[p.options.XField] = xValues
+	columnIndex[p.options.XField] = 0
+
+	for valueIdx, valueField := range p.options.ValueFields {
+		for yIdx, yValue := range p.yValues {
+			outputName := yValue
+			if len(p.options.ValueFields) > 1 {
+				outputName = fmt.Sprintf("%v: %v", valueField, yValue)
+			}
+
+			values := make([]utils.CValueEnclosure, len(p.rows))
+			for i, row := range p.rows {
+				cell, ok := row.cells[yValue]
+				if !ok {
+					values[i] = utils.CValueEnclosure{Dtype: utils.SS_DT_BACKFILL, CVal: nil}
+					continue
+				}
+				values[i] = cell[valueIdx]
+			}
+
+			knownValues[outputName] = values
+			columnIndex[outputName] = 1 + valueIdx*len(p.yValues) + yIdx
+		}
+	}
+
+	outputIQR := iqr.NewIQR(p.qid)
+	err := outputIQR.AppendKnownValues(knownValues)
+	if err != nil {
+		return nil, toputils.TeeErrorf("xyseries.getXyseriesIQR: failed to append known values; err=%v", err)
+	}
+	outputIQR.AddColumnIndex(columnIndex)
+
+	return outputIQR, nil
+}
+
+func (p *xyseriesProcessor) Rewind() {
+	// nothing to do
+}
+
+func (p *xyseriesProcessor) Cleanup() {
+	p.rows = nil
+	p.xValueToRow = nil
+	p.yValues = nil
+	p.seenYValues = nil
+}
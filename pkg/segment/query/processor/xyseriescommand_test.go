@@ -0,0 +1,107 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/utils"
+	toputils "github.com/siglens/siglens/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var xyseriesTestValues = map[string][]utils.CValueEnclosure{
+	"host":   {stringCVal("web1"), stringCVal("web1"), stringCVal("web2"), stringCVal("web2"), stringCVal("web3")},
+	"status": {stringCVal("200"), stringCVal("500"), stringCVal("200"), stringCVal("404"), backfillCVal()},
+	"count":  {intCVal(10), intCVal(2), intCVal(7), intCVal(1), intCVal(3)},
+	"bytes":  {intCVal(100), intCVal(20), intCVal(70), backfillCVal(), intCVal(30)},
+}
+
+func Test_Xyseries(t *testing.T) {
+	dp := NewXyseriesDP(&structs.XyseriesExpr{
+		XField:      "host",
+		YField:      "status",
+		ValueFields: []string{"count"},
+	})
+
+	result, err := dp.processor.Process(newTestIQR(t, xyseriesTestValues))
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, err = dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host", "200", "500", "404"}, result.GetColumnsOrder(toputils.GetKeysOfMap(columns)))
+
+	hosts, err := result.ReadColumn("host")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{stringCVal("web1"), stringCVal("web2")}, hosts)
+
+	values, err := result.ReadColumn("200")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(10), intCVal(7)}, values)
+
+	values, err = result.ReadColumn("500")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(2), backfillCVal()}, values)
+
+	values, err = result.ReadColumn("404")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{backfillCVal(), intCVal(1)}, values)
+}
+
+func Test_Xyseries_MultipleValueFields(t *testing.T) {
+	dp := NewXyseriesDP(&structs.XyseriesExpr{
+		XField:      "host",
+		YField:      "status",
+		ValueFields: []string{"count", "bytes"},
+	})
+
+	_, err := dp.processor.Process(newTestIQR(t, xyseriesTestValues))
+	assert.NoError(t, err)
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, result.NumberOfRecords())
+
+	columns, err := result.GetColumns()
+	assert.NoError(t, err)
+	expectedColumns := []string{"host", "count: 200", "count: 500", "count: 404", "bytes: 200", "bytes: 500", "bytes: 404"}
+	assert.Equal(t, expectedColumns, result.GetColumnsOrder(toputils.GetKeysOfMap(columns)))
+
+	values, err := result.ReadColumn("bytes: 404")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{backfillCVal(), backfillCVal()}, values)
+
+	values, err = result.ReadColumn("bytes: 500")
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.CValueEnclosure{intCVal(20), backfillCVal()}, values)
+}
+
+func Test_Xyseries_NoInput(t *testing.T) {
+	dp := NewXyseriesDP(&structs.XyseriesExpr{XField: "host", YField: "status", ValueFields: []string{"count"}})
+
+	result, err := dp.processor.Process(nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, result)
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/siglens/siglens/pkg/segment/results/segresults"
 	"github.com/siglens/siglens/pkg/segment/search"
 	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
 	segutils "github.com/siglens/siglens/pkg/segment/utils"
 	"github.com/siglens/siglens/pkg/segment/writer"
 	"github.com/siglens/siglens/pkg/utils"
@@ -544,7 +545,7 @@ func applyFopAllRequests(sortedQSRSlice []*QuerySegmentRequest, queryInfo *Query
 		eeType := allSegFileResults.ShouldSearchSegKey(segReq.segKeyTsRange, segReq.sNode.NodeType, otherAggsPresent, timeAggs)
 		if eeType == segresults.EetEarlyExit {
 			allSegFileResults.SetEarlyExit(true)
-		} else if eeType == segresults.EetMatchAllAggs {
+		} else if eeType == segresults.EetMatchAllAggs && !tombstones.HasTombstones(segReq.segKey) {
 			allSegFileResults.SetEarlyExit(true)
 			err := applyFopFastPathSingleRequest(segReq, allSegFileResults, qs)
 			if err != nil {
@@ -662,8 +663,9 @@ func canUseAgileTree(segReq *QuerySegmentRequest, queryInfo *QueryInformation) (
 		segReq.segKeyTsRange.EndEpochMs)
 	_, timeAggs := checkAggTypes(segReq.aggs)
 
+	// The star tree counts deleted records, so it can only be used when there are none.
 	if config.IsAggregationsEnabled() && isSegFullyEncosed && queryInfo.qType == structs.GroupByCmd &&
-		queryInfo.sNodeType == structs.MatchAllQuery && !timeAggs {
+		queryInfo.sNodeType == structs.MatchAllQuery && !timeAggs && !tombstones.HasTombstones(segReq.segKey) {
 		return search.CanDoStarTree(segReq.segKey, segReq.aggs, queryInfo.qid)
 	}
 
@@ -817,7 +819,9 @@ func applyAggOpOnSegments(sortedQSRSlice []*QuerySegmentRequest, allSegFileResul
 		aggHasValuesFunc := segReq.aggs.HasValuesFunc()
 		aggHasListFunc := segReq.aggs.HasListFunc()
 		var sstMap map[string]*structs.SegStats
-		if searchType == structs.MatchAllQuery && isSegmentFullyEnclosed && !aggHasEvalFunc && !aggHasValuesFunc && !aggHasListFunc {
+		// The stored stats also count deleted records, so recompute them if the segment has any
+		hasDeletedRecords := tombstones.HasTombstones(segReq.segKey)
+		if searchType == structs.MatchAllQuery && isSegmentFullyEnclosed && !aggHasEvalFunc && !aggHasValuesFunc && !aggHasListFunc && !hasDeletedRecords {
 			sstMap, err = segread.ReadSegStats(segReq.segKey, segReq.qid)
 			if err != nil {
 				log.Errorf("qid=%d,  applyAggOpOnSegments : ReadSegStats: Failed to get segment level stats for segKey %+v! Error: %v", qid, segReq.segKey, err)
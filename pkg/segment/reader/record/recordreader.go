@@ -36,8 +36,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// If esQuery is false, the _id and _type columns are not read.
 func ReadAllColsForRRCs(segKey string, vTable string, rrcs []*utils.RecordResultContainer,
-	qid uint64, ignoredCols map[string]struct{}) (map[string][]utils.CValueEnclosure, error) {
+	qid uint64, ignoredCols map[string]struct{}, esQuery bool) (map[string][]utils.CValueEnclosure, error) {
 
 	allCols, err := GetColsForSegKey(segKey, vTable)
 	if err != nil {
@@ -51,7 +52,7 @@ func ReadAllColsForRRCs(segKey string, vTable string, rrcs []*utils.RecordResult
 		if _, ignore := ignoredCols[cname]; ignore {
 			continue
 		}
-		columnValues, err := ReadColForRRCs(segKey, rrcs, cname, qid)
+		columnValues, err := ReadColForRRCs(segKey, rrcs, cname, qid, esQuery)
 		if err != nil {
 			log.Errorf("qid=%v, ReadAllColsForRRCs: failed to read column %s for segKey %s; err=%v",
 				qid, cname, segKey, err)
@@ -79,14 +80,16 @@ func GetColsForSegKey(segKey string, vTable string) (map[string]struct{}, error)
 	return toputils.MapToSet(allCols), nil
 }
 
-func ReadColForRRCs(segKey string, rrcs []*utils.RecordResultContainer, cname string, qid uint64) ([]utils.CValueEnclosure, error) {
+// If esQuery is false, the _id and _type columns are not read.
+func ReadColForRRCs(segKey string, rrcs []*utils.RecordResultContainer, cname string, qid uint64,
+	esQuery bool) ([]utils.CValueEnclosure, error) {
 	switch cname {
 	case config.GetTimeStampKey():
 		return readTimestampForRRCs(rrcs)
 	case "_index":
 		return readIndexForRRCs(rrcs)
 	default:
-		return readUserDefinedColForRRCs(segKey, rrcs, cname, qid)
+		return readUserDefinedColForRRCs(segKey, rrcs, cname, qid, esQuery)
 	}
 }
 
@@ -116,7 +119,7 @@ func readIndexForRRCs(rrcs []*utils.RecordResultContainer) ([]utils.CValueEnclos
 
 // All the RRCs must belong to the same segment.
 func readUserDefinedColForRRCs(segKey string, rrcs []*utils.RecordResultContainer,
-	cname string, qid uint64) ([]utils.CValueEnclosure, error) {
+	cname string, qid uint64, esQuery bool) ([]utils.CValueEnclosure, error) {
 
 	if len(rrcs) == 0 {
 		return nil, nil
@@ -179,7 +182,7 @@ func readUserDefinedColForRRCs(segKey string, rrcs []*utils.RecordResultContaine
 			return nil, nil
 		}
 
-		return handleBlock(multiReader, rrcsInBatch[0].BlockNum, rrcsInBatch, qid), nil
+		return handleBlock(multiReader, rrcsInBatch[0].BlockNum, rrcsInBatch, qid, esQuery), nil
 	}
 
 	enclosures, _ := toputils.BatchProcess(rrcs, batchingFunc, batchKeyLess, operation)
@@ -187,7 +190,7 @@ func readUserDefinedColForRRCs(segKey string, rrcs []*utils.RecordResultContaine
 }
 
 func handleBlock(multiReader *segread.MultiColSegmentReader, blockNum uint16,
-	rrcs []*utils.RecordResultContainer, qid uint64) []utils.CValueEnclosure {
+	rrcs []*utils.RecordResultContainer, qid uint64, esQuery bool) []utils.CValueEnclosure {
 
 	sortFunc := func(rrc1, rrc2 *utils.RecordResultContainer) bool {
 		return rrc1.RecordNum < rrc2.RecordNum
@@ -198,7 +201,7 @@ func handleBlock(multiReader *segread.MultiColSegmentReader, blockNum uint16,
 			allRecNums[i] = rrc.RecordNum
 		}
 
-		colToValues, err := readColsForRecords(multiReader, blockNum, allRecNums, qid)
+		colToValues, err := readColsForRecords(multiReader, blockNum, allRecNums, qid, esQuery)
 		if err != nil {
 			log.Errorf("handleBlock: failed to read columns for records; err=%v", err)
 			return nil
@@ -410,10 +413,9 @@ func getMathOpsColMap(MathOps []*structs.MathEvaluator) map[string]int {
 }
 
 func readColsForRecords(segReader *segread.MultiColSegmentReader, blockNum uint16,
-	orderedRecNums []uint16, qid uint64) (map[string][]utils.CValueEnclosure, error) {
+	orderedRecNums []uint16, qid uint64, esQuery bool) (map[string][]utils.CValueEnclosure, error) {
 
 	allMatchedColumns := make(map[string]bool)
-	esQuery := false
 	aggs := &structs.QueryAggregators{}
 	nodeRes := &structs.NodeResult{}
 	unorderedResults := readAllRawRecords(orderedRecNums, blockNum, segReader, allMatchedColumns, esQuery, qid, aggs, nodeRes)
@@ -20,7 +20,6 @@ package record
 import (
 	"fmt"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/siglens/siglens/pkg/config"
@@ -353,12 +352,13 @@ func GetJsonFromAllRrc(allrrc []*utils.RecordResultContainer, esResponse bool, q
 				nodeRes.StoreGlobalSearchError("GetJsonFromAllRrc: Did not find index for record identifier", log.ErrorLevel, nil)
 				unknownIndex = true
 			}
-			if logfmtRequest {
-				record = addKeyValuePairs(record)
+			if logfmtRequest && !hasQueryAggergatorBlock {
+				// Otherwise the fields were added when running the aggregator chain.
+				agg.AddLogfmtFields(record, valuesToLabels, finalCols)
 			}
 			includeValues := make(map[string]interface{})
 			for cname, val := range record {
-				if len(valuesToLabels[cname]) > 0 {
+				if !logfmtRequest && len(valuesToLabels[cname]) > 0 {
 					actualIndex := rawIncludeValuesIndicies[cname]
 					switch valType := val.(type) {
 					case []interface{}:
@@ -433,37 +433,3 @@ func GetJsonFromAllRrc(allrrc []*utils.RecordResultContainer, esResponse bool, q
 
 	return finalRecords, colsSlice, nil
 }
-
-func addKeyValuePairs(record map[string]interface{}) map[string]interface{} {
-	for _, value := range record {
-		if strValue, ok := value.(string); ok {
-			// Check if the string value has key-value pairs
-			keyValuePairs, err := extractKeyValuePairsFromString(strValue)
-			if err == nil {
-				// Add key-value pairs to the record
-				for k, v := range keyValuePairs {
-					record[k] = v
-				}
-			}
-		}
-	}
-	return record
-}
-
-func extractKeyValuePairsFromString(str string) (map[string]interface{}, error) {
-	keyValuePairs := make(map[string]interface{})
-	pairs := strings.Split(str, ",")
-
-	for _, pair := range pairs {
-		parts := strings.Split(pair, "=")
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			keyValuePairs[key] = utils.GetLiteralFromString(value)
-		} else {
-			return nil, fmt.Errorf("invalid key-value pair: %s", pair)
-		}
-	}
-
-	return keyValuePairs, nil
-}
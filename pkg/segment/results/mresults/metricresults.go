@@ -28,6 +28,7 @@ import (
 	"time"
 
 	parser "github.com/prometheus/prometheus/promql/parser"
+	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
 	putils "github.com/siglens/siglens/pkg/integrations/prometheus/utils"
 	tsidtracker "github.com/siglens/siglens/pkg/segment/results/mresults/tsid"
 	"github.com/siglens/siglens/pkg/segment/structs"
@@ -365,6 +366,17 @@ Apply function to results for series sharing a groupid.
 */
 func (r *MetricsResult) ApplyFunctionsToResults(parallelism int, function structs.Function) []error {
 
+	// Functions like label_replace and histogram_quantile work on all the series together, so they can't be split by group
+	if function.IsFunctionFromAllTimeseries() {
+		results, err := ApplyFunctionToAllTimeseries(r.Results, function)
+		if err != nil {
+			return []error{err}
+		}
+		r.Results = results
+		r.DsResults = nil
+		return nil
+	}
+
 	lock := &sync.Mutex{}
 	wg := &sync.WaitGroup{}
 	errList := []error{} // Thread-safe list of errors
@@ -406,6 +418,61 @@ func (r *MetricsResult) ApplyFunctionsToResults(parallelism int, function struct
 	return nil
 }
 
+/*
+Apply absent or absent_over_time to the results at each evaluation timestamp of the time range
+*/
+func (r *MetricsResult) ApplyAbsentFunctionToResults(function structs.Function, timeRange *dtu.MetricsTimeRange, intervalSeconds uint32) []error {
+	results, err := ApplyAbsentFunction(r.Results, function, GetEvaluationTimestamps(timeRange, intervalSeconds))
+	if err != nil {
+		return []error{err}
+	}
+	r.Results = results
+	r.DsResults = nil
+	return nil
+}
+
+/*
+Move the results of a query with the offset or @ modifier from the time range it was evaluated over to the requested time range
+
+Each evaluation timestamp of the requested time range gets the latest value of the series at or before the time it maps
+to, which is the timestamp minus the offset, or the @ time minus the offset. Only values up to one interval older than
+that time are used. With the @ modifier, every series has the same value at all the evaluation timestamps.
+*/
+func (r *MetricsResult) ApplyTimeModifiers(mQuery *structs.MetricsQuery, timeRange *dtu.MetricsTimeRange, intervalSeconds uint32) {
+	timestamps := GetEvaluationTimestamps(timeRange, intervalSeconds)
+	for grpID, ts := range r.Results {
+		fixedTs := make(map[uint32]float64, len(timestamps))
+		for _, timestamp := range timestamps {
+			evalTime := int64(timestamp)
+			if mQuery.AtEpochSec != 0 {
+				evalTime = int64(mQuery.AtEpochSec)
+			}
+			evalTime -= mQuery.Offset
+
+			value, ok := getLatestValueAt(ts, evalTime, int64(intervalSeconds))
+			if ok {
+				fixedTs[timestamp] = value
+			}
+		}
+		r.Results[grpID] = fixedTs
+	}
+}
+
+// Returns the value of the latest timestamp in [evalTime - lookbackSeconds, evalTime], if there is one.
+func getLatestValueAt(ts map[uint32]float64, evalTime int64, lookbackSeconds int64) (float64, bool) {
+	var value float64
+	latestTs := int64(-1)
+	for timestamp, val := range ts {
+		t := int64(timestamp)
+		if t > evalTime || t < evalTime-lookbackSeconds || t <= latestTs {
+			continue
+		}
+		latestTs = t
+		value = val
+	}
+	return value, latestTs >= 0
+}
+
 func (r *MetricsResult) AddError(err error) {
 	r.rwLock.Lock()
 	r.ErrList = append(r.ErrList, err)
@@ -510,7 +577,10 @@ func (r *MetricsResult) GetResultsPromQl(mQuery *structs.MetricsQuery, pqlQueryt
 			var result structs.Result
 			var keyValue []string
 			result.Metric = make(map[string]string)
-			result.Metric["__name__"] = ExtractMetricNameFromGroupID(grpId)
+			// Series like the ones from absent have no metric name
+			if metricName := ExtractMetricNameFromGroupID(grpId); metricName != "" {
+				result.Metric["__name__"] = metricName
+			}
 			for idx, val := range tagValues {
 				if idx == 0 {
 					keyValue = strings.Split(removeMetricNameFromGroupID(val), ":")
@@ -711,6 +781,25 @@ func (r *MetricsResult) FetchPromqlMetricsForUi(mQuery *structs.MetricsQuery, pq
 	return httpResp, nil
 }
 
+// Returns the timestamps the query is evaluated at, which are the multiples of
+// the interval within the time range, like the downsampled timestamps. An
+// instant query is only evaluated at the end of the time range.
+func GetEvaluationTimestamps(timeRange *dtu.MetricsTimeRange, intervalSeconds uint32) []uint32 {
+	if intervalSeconds == 0 {
+		intervalSeconds = 1
+	}
+	if timeRange.EndEpochSec-timeRange.StartEpochSec <= intervalSeconds {
+		return []uint32{timeRange.EndEpochSec}
+	}
+
+	timestamps := make([]uint32, 0)
+	first := (timeRange.StartEpochSec + intervalSeconds - 1) / intervalSeconds * intervalSeconds
+	for timestamp := first; timestamp <= timeRange.EndEpochSec; timestamp += intervalSeconds {
+		timestamps = append(timestamps, timestamp)
+	}
+	return timestamps
+}
+
 func CalculateInterval(timerangeSeconds uint32) (uint32, error) {
 	// If timerangeSeconds is greater than 10 years reject the request
 	if timerangeSeconds > TEN_YEARS_IN_SECS {
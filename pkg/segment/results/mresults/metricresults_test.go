@@ -20,6 +20,7 @@ package mresults
 import (
 	"testing"
 
+	dtu "github.com/siglens/siglens/pkg/common/dtypeutils"
 	"github.com/siglens/siglens/pkg/config"
 	"github.com/siglens/siglens/pkg/segment/structs"
 	"github.com/siglens/siglens/pkg/segment/utils"
@@ -328,3 +329,72 @@ func Test_ApplyAggregationToResults_GroupBy_Multiple_Series_v3(t *testing.T) {
 	assert.Equal(t, 11.0, mResult.Results[aggSeriesId3][2])
 	assert.Equal(t, 12.0, mResult.Results[aggSeriesId3][3])
 }
+
+func Test_GetEvaluationTimestamps(t *testing.T) {
+	timestamps := GetEvaluationTimestamps(&dtu.MetricsTimeRange{StartEpochSec: 1001, EndEpochSec: 1300}, 60)
+	assert.Equal(t, []uint32{1020, 1080, 1140, 1200, 1260}, timestamps)
+
+	// An instant query is only evaluated at its end
+	timestamps = GetEvaluationTimestamps(&dtu.MetricsTimeRange{StartEpochSec: 1299, EndEpochSec: 1300}, 1)
+	assert.Equal(t, []uint32{1300}, timestamps)
+}
+
+func Test_ApplyTimeModifiers_Offset(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"metric{tk1:v1,": {960: 1, 1020: 2},
+		},
+	}
+
+	mQuery := &structs.MetricsQuery{Offset: 3600}
+	metricsResults.ApplyTimeModifiers(mQuery, &dtu.MetricsTimeRange{StartEpochSec: 4500, EndEpochSec: 4620}, 60)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"metric{tk1:v1,": {4560: 1, 4620: 2},
+	}, metricsResults.Results)
+}
+
+func Test_ApplyTimeModifiers_OffsetNotStepAligned(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"metric{tk1:v1,": {960: 1, 1020: 2, 1080: 3},
+		},
+	}
+
+	// The points stay on the step grid and get the latest value at or before the offset time
+	mQuery := &structs.MetricsQuery{Offset: 90}
+	metricsResults.ApplyTimeModifiers(mQuery, &dtu.MetricsTimeRange{StartEpochSec: 1020, EndEpochSec: 1200}, 60)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"metric{tk1:v1,": {1080: 1, 1140: 2, 1200: 3},
+	}, metricsResults.Results)
+}
+
+func Test_ApplyTimeModifiers_At(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"metric{tk1:v1,": {1000: 1, 1060: 2},
+			"metric{tk1:v2,": {1000: 3},
+		},
+	}
+
+	mQuery := &structs.MetricsQuery{AtEpochSec: 1060}
+	metricsResults.ApplyTimeModifiers(mQuery, &dtu.MetricsTimeRange{StartEpochSec: 5000, EndEpochSec: 5180}, 60)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"metric{tk1:v1,": {5040: 2, 5100: 2, 5160: 2},
+		"metric{tk1:v2,": {5040: 3, 5100: 3, 5160: 3},
+	}, metricsResults.Results)
+}
+
+func Test_ApplyTimeModifiers_AtWithLaterSample(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"metric{tk1:v1,": {1000: 1, 1060: 2, 1120: 5},
+		},
+	}
+
+	// The sample after the @ time is not used
+	mQuery := &structs.MetricsQuery{AtEpochSec: 1090}
+	metricsResults.ApplyTimeModifiers(mQuery, &dtu.MetricsTimeRange{StartEpochSec: 5000, EndEpochSec: 5180}, 60)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"metric{tk1:v1,": {5040: 2, 5100: 2, 5160: 2},
+	}, metricsResults.Results)
+}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/nethruster/go-fraction"
+	tsidtracker "github.com/siglens/siglens/pkg/segment/results/mresults/tsid"
 	"github.com/siglens/siglens/pkg/segment/structs"
 	"github.com/siglens/siglens/pkg/segment/utils"
 	segutils "github.com/siglens/siglens/pkg/segment/utils"
@@ -983,6 +984,413 @@ func ApplyTimeFunction(allDPs map[uint32]float64, function structs.Function) (ma
 	return allDPs, nil
 }
 
+const metricNameLabel = "__name__"
+
+// Applies a function that needs every series of the vector at once. The
+// results map each group id to its series, and the returned map can have
+// different group ids than the input.
+func ApplyFunctionToAllTimeseries(results map[string]map[uint32]float64, function structs.Function) (map[string]map[uint32]float64, error) {
+	if function.LabelFunction > 0 {
+		return ApplyLabelFunction(results, function)
+	}
+
+	if function.HistogramFunction > 0 {
+		return ApplyHistogramFunction(results, function)
+	}
+
+	return results, nil
+}
+
+// The group ids are in the format "metricName{tk1:tv1,tk2:tv2,...". The
+// metric name is returned as the __name__ label so that label functions can
+// read and write it like any other label.
+func getLabelsFromGroupID(grpID string) map[string]string {
+	metricName, tagValues, _ := strings.Cut(grpID, "{")
+	labels := make(map[string]string)
+	labels[metricNameLabel] = metricName
+	for _, tagValue := range strings.Split(removeTrailingComma(tagValues), tsidtracker.TAG_VALUE_DELIMITER_STR) {
+		key, value, found := strings.Cut(tagValue, ":")
+		if !found {
+			continue
+		}
+		labels[key] = value
+	}
+	return labels
+}
+
+// Builds the group id for the labels, with the tag keys sorted so that equal
+// label sets always give the same group id.
+func getGroupIDFromLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if key != metricNameLabel {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(labels[metricNameLabel])
+	sb.WriteString("{")
+	for _, key := range keys {
+		sb.WriteString(key)
+		sb.WriteString(":")
+		sb.WriteString(labels[key])
+		sb.WriteString(tsidtracker.TAG_VALUE_DELIMITER_STR)
+	}
+	return sb.String()
+}
+
+func ApplyLabelFunction(results map[string]map[uint32]float64, function structs.Function) (map[string]map[uint32]float64, error) {
+	var relabel func(labels map[string]string)
+
+	switch function.LabelFunction {
+	case segutils.LabelReplace:
+		// label_replace(v, dst_label, replacement, src_label, regex)
+		if len(function.ValueList) != 4 {
+			return results, fmt.Errorf("ApplyLabelFunction: label_replace has incorrect parameters: %v", function.ValueList)
+		}
+		dstLabel, replacement, srcLabel := function.ValueList[0], function.ValueList[1], function.ValueList[2]
+		regex, err := regexp.Compile("^(?:" + function.ValueList[3] + ")$")
+		if err != nil {
+			return results, fmt.Errorf("ApplyLabelFunction: invalid regex %v for label_replace; err=%v", function.ValueList[3], err)
+		}
+		relabel = func(labels map[string]string) {
+			srcValue := labels[srcLabel]
+			indexes := regex.FindStringSubmatchIndex(srcValue)
+			if indexes == nil {
+				return
+			}
+			setLabelValue(labels, dstLabel, string(regex.ExpandString(nil, replacement, srcValue, indexes)))
+		}
+	case segutils.LabelJoin:
+		// label_join(v, dst_label, separator, src_label_1, src_label_2, ...)
+		if len(function.ValueList) < 2 {
+			return results, fmt.Errorf("ApplyLabelFunction: label_join has incorrect parameters: %v", function.ValueList)
+		}
+		dstLabel, separator, srcLabels := function.ValueList[0], function.ValueList[1], function.ValueList[2:]
+		relabel = func(labels map[string]string) {
+			srcValues := make([]string, len(srcLabels))
+			for i, srcLabel := range srcLabels {
+				srcValues[i] = labels[srcLabel]
+			}
+			setLabelValue(labels, dstLabel, strings.Join(srcValues, separator))
+		}
+	default:
+		return results, fmt.Errorf("ApplyLabelFunction: unsupported function type %v", function)
+	}
+
+	relabeledResults := make(map[string]map[uint32]float64, len(results))
+	for grpID, ts := range results {
+		labels := getLabelsFromGroupID(grpID)
+		relabel(labels)
+		newGrpID := getGroupIDFromLabels(labels)
+		if _, ok := relabeledResults[newGrpID]; ok {
+			return results, fmt.Errorf("ApplyLabelFunction: vector cannot contain metrics with the same labelset %v", newGrpID)
+		}
+		relabeledResults[newGrpID] = ts
+	}
+
+	return relabeledResults, nil
+}
+
+// An empty value removes the label, as a label with an empty value is the same
+// as a missing label in PromQL.
+func setLabelValue(labels map[string]string, label string, value string) {
+	if value == "" {
+		delete(labels, label)
+		return
+	}
+	labels[label] = value
+}
+
+// Returns a series with the value 1 at each of the timestamps where none of the
+// series have a data point in the time window ending at the timestamp, so
+// there is no series if data is present at all the timestamps. The labels of
+// the series are in the ValueList as key and value pairs, and it has no metric
+// name.
+func ApplyAbsentFunction(results map[string]map[uint32]float64, function structs.Function, timestamps []uint32) (map[string]map[uint32]float64, error) {
+	if len(function.ValueList)%2 != 0 {
+		return results, fmt.Errorf("ApplyAbsentFunction: labels are not in key and value pairs: %v", function.ValueList)
+	}
+
+	dataTimestamps := make([]uint32, 0)
+	for _, ts := range results {
+		for timestamp := range ts {
+			dataTimestamps = append(dataTimestamps, timestamp)
+		}
+	}
+	sort.Slice(dataTimestamps, func(i, j int) bool {
+		return dataTimestamps[i] < dataTimestamps[j]
+	})
+
+	timeWindow := int64(function.TimeWindow)
+	absentTs := make(map[uint32]float64)
+	for _, timestamp := range timestamps {
+		// find the first data point within the time window
+		i := sort.Search(len(dataTimestamps), func(j int) bool {
+			return int64(dataTimestamps[j]) > int64(timestamp)-timeWindow
+		})
+		if i < len(dataTimestamps) && dataTimestamps[i] <= timestamp {
+			continue
+		}
+		absentTs[timestamp] = 1
+	}
+
+	absentResults := make(map[string]map[uint32]float64)
+	if len(absentTs) == 0 {
+		return absentResults, nil
+	}
+
+	labels := map[string]string{metricNameLabel: ""}
+	for i := 0; i < len(function.ValueList); i += 2 {
+		labels[function.ValueList[i]] = function.ValueList[i+1]
+	}
+	absentResults[getGroupIDFromLabels(labels)] = absentTs
+
+	return absentResults, nil
+}
+
+type histogramBucket struct {
+	upperBound float64
+	count      float64
+}
+
+func ApplyHistogramFunction(results map[string]map[uint32]float64, function structs.Function) (map[string]map[uint32]float64, error) {
+	switch function.HistogramFunction {
+	case segutils.HistogramQuantile:
+		if len(function.ValueList) != 1 {
+			return results, fmt.Errorf("ApplyHistogramFunction: histogram_quantile has incorrect parameters: %v", function.ValueList)
+		}
+		quantile, err := strconv.ParseFloat(function.ValueList[0], 64)
+		if err != nil {
+			return results, fmt.Errorf("ApplyHistogramFunction: histogram_quantile has incorrect parameters: %v, params can not convert to a float: %v", function.ValueList, err)
+		}
+		return computeHistogramQuantile(results, quantile), nil
+	default:
+		return results, fmt.Errorf("ApplyHistogramFunction: unsupported function type %v", function)
+	}
+}
+
+// The bucket series of a histogram share all labels except le, which holds the
+// upper bound of the bucket. Series without a valid le label are dropped, as
+// they are not buckets.
+func computeHistogramQuantile(results map[string]map[uint32]float64, quantile float64) map[string]map[uint32]float64 {
+	bucketsByGroup := make(map[string]map[uint32][]histogramBucket)
+	for grpID, ts := range results {
+		labels := getLabelsFromGroupID(grpID)
+		upperBound, err := strconv.ParseFloat(labels["le"], 64)
+		if err != nil {
+			continue
+		}
+		delete(labels, "le")
+
+		histogramGrpID := getGroupIDFromLabels(labels)
+		bucketsByTime, ok := bucketsByGroup[histogramGrpID]
+		if !ok {
+			bucketsByTime = make(map[uint32][]histogramBucket)
+			bucketsByGroup[histogramGrpID] = bucketsByTime
+		}
+		for timestamp, count := range ts {
+			bucketsByTime[timestamp] = append(bucketsByTime[timestamp], histogramBucket{upperBound: upperBound, count: count})
+		}
+	}
+
+	quantileResults := make(map[string]map[uint32]float64, len(bucketsByGroup))
+	for grpID, bucketsByTime := range bucketsByGroup {
+		ts := make(map[uint32]float64, len(bucketsByTime))
+		for timestamp, buckets := range bucketsByTime {
+			ts[timestamp] = bucketQuantile(quantile, buckets)
+		}
+		quantileResults[grpID] = ts
+	}
+
+	return quantileResults
+}
+
+// Calculates the quantile from cumulative bucket counts the same way Prometheus
+// does: find the bucket that holds the rank of the quantile and interpolate
+// linearly within it, assuming the observations are evenly spread in the
+// bucket. The lower bound of the first bucket is 0 if its upper bound is
+// positive. If the quantile falls in the +Inf bucket, the upper bound of the
+// second highest bucket is returned. Returns NaN if there is no +Inf bucket or
+// no observations.
+func bucketQuantile(quantile float64, buckets []histogramBucket) float64 {
+	if math.IsNaN(quantile) {
+		return math.NaN()
+	}
+	if quantile < 0 {
+		return math.Inf(-1)
+	}
+	if quantile > 1 {
+		return math.Inf(+1)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].upperBound < buckets[j].upperBound
+	})
+	if !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
+		return math.NaN()
+	}
+
+	// Merge buckets with the same upper bound, which can happen if the le
+	// values were formatted differently, e.g. "1" and "1.0"
+	merged := buckets[:1]
+	for _, bucket := range buckets[1:] {
+		if bucket.upperBound == merged[len(merged)-1].upperBound {
+			merged[len(merged)-1].count += bucket.count
+		} else {
+			merged = append(merged, bucket)
+		}
+	}
+	buckets = merged
+
+	// The counts are cumulative, so they should never decrease. They can if
+	// the buckets were scraped at slightly different times, so fix them up to
+	// keep the interpolation sane.
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].count < buckets[i-1].count {
+			buckets[i].count = buckets[i-1].count
+		}
+	}
+
+	if len(buckets) < 2 {
+		return math.NaN()
+	}
+	observations := buckets[len(buckets)-1].count
+	if observations == 0 {
+		return math.NaN()
+	}
+
+	rank := quantile * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool {
+		return buckets[i].count >= rank
+	})
+
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].upperBound
+	}
+	if b == 0 && buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	bucketStart := float64(0)
+	bucketEnd := buckets[b].upperBound
+	count := buckets[b].count
+	if b > 0 {
+		bucketStart = buckets[b-1].upperBound
+		count -= buckets[b-1].count
+		rank -= buckets[b-1].count
+	}
+
+	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+}
+
+// Pairs a series from each side of a binary operation between two vectors.
+// GroupID is the group id of the resulting series.
+type VectorMatch struct {
+	GroupID    string
+	LHSGroupID string
+	RHSGroupID string
+}
+
+// Matches the series of two vectors using the Prometheus vector matching
+// rules. For one-to-many matching the right side is the "many" side, but the
+// returned matches always keep the original sides of the operation.
+// Returns an error if a series on the "one" side has the same matching labels
+// as another series, or if more than one series would get the same group id.
+func MatchVectors(lhs map[string]map[uint32]float64, rhs map[string]map[uint32]float64, matching *structs.VectorMatching) ([]VectorMatch, error) {
+	manySide, oneSide := lhs, rhs
+	if matching.Cardinality == structs.CardOneToMany {
+		manySide, oneSide = rhs, lhs
+	}
+
+	oneSideGroupIDs := make(map[string]string, len(oneSide))
+	for grpID := range oneSide {
+		signature := getMatchingSignature(grpID, matching)
+		if otherGrpID, exists := oneSideGroupIDs[signature]; exists {
+			return nil, fmt.Errorf("MatchVectors: found duplicate series %v and %v for the match group {%v} on the one side of the operation; many-to-many matching not allowed: matching labels must be unique on one side",
+				otherGrpID, grpID, signature)
+		}
+		oneSideGroupIDs[signature] = grpID
+	}
+
+	matches := make([]VectorMatch, 0, len(manySide))
+	matchedSignatures := make(map[string]struct{})
+	resultGroupIDs := make(map[string]struct{})
+	for grpID := range manySide {
+		signature := getMatchingSignature(grpID, matching)
+		oneGrpID, exists := oneSideGroupIDs[signature]
+		if !exists {
+			continue
+		}
+
+		if matching.Cardinality == structs.CardOneToOne {
+			if _, exists := matchedSignatures[signature]; exists {
+				return nil, fmt.Errorf("MatchVectors: multiple matches for labels {%v}: many-to-one matching must be explicit (group_left/group_right)", signature)
+			}
+			matchedSignatures[signature] = struct{}{}
+		}
+
+		resultGrpID := getMatchedGroupID(grpID, oneGrpID, matching.Include)
+		if _, exists := resultGroupIDs[resultGrpID]; exists {
+			return nil, fmt.Errorf("MatchVectors: multiple matches for labels %v: grouping labels must ensure unique matches", resultGrpID)
+		}
+		resultGroupIDs[resultGrpID] = struct{}{}
+
+		match := VectorMatch{GroupID: resultGrpID, LHSGroupID: grpID, RHSGroupID: oneGrpID}
+		if matching.Cardinality == structs.CardOneToMany {
+			match.LHSGroupID, match.RHSGroupID = oneGrpID, grpID
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// The signature has the matching labels of the series, sorted by key. With
+// on() only the given labels are used; with ignoring() every label except
+// the given ones and the metric name is used.
+func getMatchingSignature(grpID string, matching *structs.VectorMatching) string {
+	labels := getLabelsFromGroupID(grpID)
+	delete(labels, metricNameLabel)
+
+	if matching.On {
+		onLabels := make(map[string]string, len(matching.MatchingLabels))
+		for _, label := range matching.MatchingLabels {
+			if value, exists := labels[label]; exists {
+				onLabels[label] = value
+			}
+		}
+		labels = onLabels
+	} else {
+		for _, label := range matching.MatchingLabels {
+			delete(labels, label)
+		}
+	}
+
+	// Without the metric name the group id starts with "{", which isn't
+	// needed in the signature.
+	return strings.TrimPrefix(getGroupIDFromLabels(labels), "{")
+}
+
+// The result keeps the group id of the "many" side, with the labels listed in
+// group_left() or group_right() copied over from the "one" side. A label that
+// is missing on the "one" side is removed from the result.
+func getMatchedGroupID(manyGrpID string, oneGrpID string, include []string) string {
+	if len(include) == 0 {
+		return manyGrpID
+	}
+
+	labels := getLabelsFromGroupID(manyGrpID)
+	oneLabels := getLabelsFromGroupID(oneGrpID)
+	for _, label := range include {
+		setLabelValue(labels, label, oneLabels[label])
+	}
+
+	return getGroupIDFromLabels(labels)
+}
+
 func evaluateWithErr(ts map[uint32]float64, mathFunc float64FuncWithErr) error {
 	for key, val := range ts {
 		resVal, err := mathFunc(val)
@@ -1804,3 +1804,158 @@ func Test_applyRangeFunctionMADOverTime(t *testing.T) {
 		}
 	}
 }
+
+func Test_applyLabelReplace(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"up{instance:host1-9090,job:api,":  {1000: 1},
+			"up{instance:host2-9100,job:node,": {1000: 0},
+			"up{job:db,":                       {1000: 1},
+		},
+	}
+
+	function := structs.Function{LabelFunction: segutils.LabelReplace, ValueList: []string{"host", "$1", "instance", "(.*)-.*"}}
+	errList := metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"up{host:host1,instance:host1-9090,job:api,":  {1000: 1},
+		"up{host:host2,instance:host2-9100,job:node,": {1000: 0},
+		"up{job:db,": {1000: 1},
+	}, metricsResults.Results)
+
+	// An empty replacement removes the label, and the metric name can be replaced too
+	function = structs.Function{LabelFunction: segutils.LabelReplace, ValueList: []string{"instance", "", "job", "api"}}
+	errList = metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	function = structs.Function{LabelFunction: segutils.LabelReplace, ValueList: []string{"__name__", "${1}_status", "__name__", "(.*)"}}
+	errList = metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"up_status{host:host1,job:api,":                      {1000: 1},
+		"up_status{host:host2,instance:host2-9100,job:node,": {1000: 0},
+		"up_status{job:db,":                                  {1000: 1},
+	}, metricsResults.Results)
+
+	// Series that end up with the same labels are an error
+	function = structs.Function{LabelFunction: segutils.LabelReplace, ValueList: []string{"job", "same", "job", ".*"}}
+	errList = metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	function = structs.Function{LabelFunction: segutils.LabelReplace, ValueList: []string{"host", "", "host", ".*"}}
+	errList = metricsResults.ApplyFunctionsToResults(8, function)
+	assert.NotNil(t, errList)
+}
+
+func Test_applyLabelJoin(t *testing.T) {
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"requests{method:GET,path:/api,": {1000: 5},
+			"requests{method:POST,":          {1000: 2},
+			"requests{":                      {1000: 1},
+		},
+	}
+
+	function := structs.Function{LabelFunction: segutils.LabelJoin, ValueList: []string{"endpoint", " ", "method", "path"}}
+	errList := metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"requests{endpoint:GET /api,method:GET,path:/api,": {1000: 5},
+		"requests{endpoint:POST ,method:POST,":             {1000: 2},
+		"requests{endpoint: ,":                             {1000: 1},
+	}, metricsResults.Results)
+}
+
+func Test_applyHistogramQuantile(t *testing.T) {
+	// Two histograms with the cumulative bucket counts at two timestamps
+	metricsResults := &MetricsResult{
+		Results: map[string]map[uint32]float64{
+			"latency_bucket{job:api,le:0.1,":  {1000: 10, 1060: 0},
+			"latency_bucket{job:api,le:0.5,":  {1000: 30, 1060: 0},
+			"latency_bucket{job:api,le:1,":    {1000: 90, 1060: 0},
+			"latency_bucket{job:api,le:+Inf,": {1000: 100, 1060: 0},
+			"latency_bucket{job:db,le:1,":     {1000: 4},
+			"latency_bucket{job:db,le:2,":     {1000: 8},
+			"latency_bucket{job:db,le:+Inf,":  {1000: 10},
+			"latency_bucket{job:web,le:1,":    {1000: 4},
+		},
+	}
+
+	function := structs.Function{HistogramFunction: segutils.HistogramQuantile, ValueList: []string{"0.5"}}
+	errList := metricsResults.ApplyFunctionsToResults(8, function)
+	assert.Nil(t, errList)
+	assert.Equal(t, 3, len(metricsResults.Results))
+
+	// rank 50 falls in the (0.5, 1] bucket, which has 60 observations, 20 of them below the rank
+	assert.InDelta(t, 0.5+0.5*20.0/60.0, metricsResults.Results["latency_bucket{job:api,"][1000], 1e-9)
+	assert.True(t, math.IsNaN(metricsResults.Results["latency_bucket{job:api,"][1060]))
+	// rank 5 falls in the (1, 2] bucket, which has 4 observations, 1 of them below the rank
+	assert.InDelta(t, 1.25, metricsResults.Results["latency_bucket{job:db,"][1000], 1e-9)
+	// There is no +Inf bucket
+	assert.True(t, math.IsNaN(metricsResults.Results["latency_bucket{job:web,"][1000]))
+}
+
+func Test_bucketQuantile(t *testing.T) {
+	getBuckets := func() []histogramBucket {
+		return []histogramBucket{
+			{upperBound: math.Inf(+1), count: 100},
+			{upperBound: 1, count: 60},
+			{upperBound: 0.5, count: 20},
+			{upperBound: 2, count: 90},
+		}
+	}
+
+	assert.Equal(t, math.Inf(-1), bucketQuantile(-0.1, getBuckets()))
+	assert.Equal(t, math.Inf(+1), bucketQuantile(1.1, getBuckets()))
+	assert.True(t, math.IsNaN(bucketQuantile(math.NaN(), getBuckets())))
+
+	// The first bucket starts at 0
+	assert.InDelta(t, 0.25, bucketQuantile(0.1, getBuckets()), 1e-9)
+	assert.InDelta(t, 1.5, bucketQuantile(0.75, getBuckets()), 1e-9)
+	// The rank is in the +Inf bucket, so the highest finite bound is returned
+	assert.Equal(t, float64(2), bucketQuantile(0.95, getBuckets()))
+
+	// Decreasing counts are treated as the previous count
+	buckets := []histogramBucket{
+		{upperBound: 1, count: 50},
+		{upperBound: 2, count: 40},
+		{upperBound: 4, count: 100},
+		{upperBound: math.Inf(+1), count: 100},
+	}
+	assert.InDelta(t, 2+2*25.0/50.0, bucketQuantile(0.75, buckets), 1e-9)
+
+	// Buckets with the same upper bound are merged
+	buckets = []histogramBucket{
+		{upperBound: 1, count: 10},
+		{upperBound: 1, count: 10},
+		{upperBound: math.Inf(+1), count: 40},
+	}
+	assert.InDelta(t, 0.5, bucketQuantile(0.25, buckets), 1e-9)
+}
+
+func Test_applyAbsentFunction(t *testing.T) {
+	timestamps := []uint32{1000, 1060, 1120, 1180}
+	function := structs.Function{AbsentFunction: segutils.Absent_Over_Time, TimeWindow: 60, ValueList: []string{"job", "api"}}
+
+	// Data points within the window ending at a timestamp mean it is not absent there
+	results := map[string]map[uint32]float64{
+		"up{job:api,instance:a,": {990: 1},
+		"up{job:api,instance:b,": {1100: 1, 1120: 1},
+	}
+	absentResults, err := ApplyAbsentFunction(results, function, timestamps)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"{job:api,": {1060: 1, 1180: 1},
+	}, absentResults)
+
+	absentResults, err = ApplyAbsentFunction(map[string]map[uint32]float64{}, function, timestamps)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[uint32]float64{
+		"{job:api,": {1000: 1, 1060: 1, 1120: 1, 1180: 1},
+	}, absentResults)
+
+	results = map[string]map[uint32]float64{
+		"up{job:api,": {1000: 1, 1060: 1, 1120: 1, 1180: 1},
+	}
+	absentResults, err = ApplyAbsentFunction(results, function, timestamps)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(absentResults))
+}
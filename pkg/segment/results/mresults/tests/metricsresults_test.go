@@ -1627,6 +1627,159 @@ func Test_GetResults_GroupLeft(t *testing.T) {
 	)
 }
 
+func Test_GetResults_GroupLeftWithLabels(t *testing.T) {
+	aggregator := structs.Aggregation{AggregatorFunction: utils.Avg}
+	results := make(map[string]map[uint32]float64)
+	results["test.metric.1{container:app,namespace:default,node:node-a,pod:web-1,"] = map[uint32]float64{
+		0:    100,
+		7200: 300,
+	}
+	results["test.metric.1{container:sidecar,namespace:default,node:node-a,pod:web-1,"] = map[uint32]float64{
+		0:    100,
+		7200: 300,
+	}
+	results["test.metric.1{container:app,namespace:default,pod:web-2,"] = map[uint32]float64{
+		0:    100,
+		7200: 300,
+	}
+
+	// The node label is copied over from the series on the right side, and removed when it is missing there.
+	vectorMatching := &structs.VectorMatching{
+		Cardinality:    structs.CardManyToOne,
+		MatchingLabels: []string{"namespace", "pod"},
+		On:             true,
+		Include:        []string{"node"},
+	}
+
+	labelStrs1 := []string{"{container:app,namespace:default,pod:web-1,", "{container:sidecar,namespace:default,pod:web-1,",
+		"{container:app,namespace:default,node:old,pod:web-2,", "{container:app,namespace:kube-system,pod:web-3,"}
+	labelStrs2 := []string{"{namespace:default,node:node-a,pod:web-1,", "{namespace:default,pod:web-2,", "{namespace:default,node:node-b,pod:web-4,"}
+
+	test_GetResults_LogicalAndVectorMatchingOps(t,
+		map[uint32]float64{
+			0:    100,
+			7200: 300,
+		},
+		map[uint32]float64{
+			0:    1,
+			7200: 1,
+		},
+		labelStrs1, labelStrs2, results,
+		[]structs.QueryArithmetic{
+			{
+				LHS:            1,
+				RHS:            2,
+				Operation:      utils.LetMultiply,
+				VectorMatching: vectorMatching,
+			},
+		},
+		structs.Downsampler{
+			Interval:   2,
+			Unit:       "h",
+			CFlag:      false,
+			Aggregator: aggregator,
+		},
+		aggregator,
+	)
+}
+
+func Test_GetResults_VectorMatching_Comparison(t *testing.T) {
+	aggregator := structs.Aggregation{AggregatorFunction: utils.Avg}
+	downsampler := structs.Downsampler{
+		Interval:   2,
+		Unit:       "h",
+		CFlag:      false,
+		Aggregator: aggregator,
+	}
+	vectorMatching := &structs.VectorMatching{
+		Cardinality:    structs.CardOneToOne,
+		MatchingLabels: []string{"color"},
+		On:             true,
+	}
+	labelStrs1 := []string{"{color:red,type:compact,", "{color:blue,type:mid size,"}
+	labelStrs2 := []string{"{color:red,", "{color:white,"}
+	entries1 := map[uint32]float64{
+		0:    1,
+		7200: 5,
+	}
+	entries2 := map[uint32]float64{
+		0:    3,
+		7200: 3,
+	}
+
+	// Without bool the series are filtered and keep the value of the left side
+	results := make(map[string]map[uint32]float64)
+	results["test.metric.1{color:red,type:compact,"] = map[uint32]float64{
+		7200: 5,
+	}
+	test_GetResults_LogicalAndVectorMatchingOps(t, entries1, entries2, labelStrs1, labelStrs2, results,
+		[]structs.QueryArithmetic{
+			{
+				LHS:            1,
+				RHS:            2,
+				Operation:      utils.LetGreaterThan,
+				VectorMatching: vectorMatching,
+			},
+		},
+		downsampler, aggregator)
+
+	results = make(map[string]map[uint32]float64)
+	results["test.metric.1{color:red,type:compact,"] = map[uint32]float64{
+		0:    0,
+		7200: 1,
+	}
+	test_GetResults_LogicalAndVectorMatchingOps(t, entries1, entries2, labelStrs1, labelStrs2, results,
+		[]structs.QueryArithmetic{
+			{
+				LHS:            1,
+				RHS:            2,
+				Operation:      utils.LetGreaterThan,
+				ReturnBool:     true,
+				VectorMatching: vectorMatching,
+			},
+		},
+		downsampler, aggregator)
+}
+
+func Test_GetResults_VectorMatching_Errors(t *testing.T) {
+	aggregator := structs.Aggregation{AggregatorFunction: utils.Avg}
+	downsampler := structs.Downsampler{
+		Interval:   2,
+		Unit:       "h",
+		CFlag:      false,
+		Aggregator: aggregator,
+	}
+	entries := map[uint32]float64{
+		0:    1,
+		7200: 5,
+	}
+
+	// Two series on the left side match the same series without group_left
+	queryOps := []structs.QueryArithmetic{
+		{
+			LHS:       1,
+			RHS:       2,
+			Operation: utils.LetAdd,
+			VectorMatching: &structs.VectorMatching{
+				Cardinality:    structs.CardOneToOne,
+				MatchingLabels: []string{"color"},
+				On:             true,
+			},
+		},
+	}
+	resMap := initialize_Multiple_Metric_Results(t, entries, entries, []string{"{color:red,type:compact,", "{color:red,type:mid size,"},
+		[]string{"{color:red,"}, queryOps, downsampler, aggregator)
+	_, _, err := segment.HelperQueryArithmeticAndLogical(&queryOps[0], resMap, false)
+	assert.NotNil(t, err)
+
+	// The 'one' side has duplicate series for the matching labels
+	queryOps[0].VectorMatching.Cardinality = structs.CardManyToOne
+	resMap = initialize_Multiple_Metric_Results(t, entries, entries, []string{"{color:red,type:compact,"},
+		[]string{"{color:red,size:small,", "{color:red,size:large,"}, queryOps, downsampler, aggregator)
+	_, _, err = segment.HelperQueryArithmeticAndLogical(&queryOps[0], resMap, false)
+	assert.NotNil(t, err)
+}
+
 func addSerieToMetricRes(t *testing.T, metricsResults *mresults.MetricsResult, mQuery *structs.MetricsQuery, entries map[uint32]float64, tsGroupId *bytebufferpool.ByteBuffer, labelStr string, tsid uint64) {
 	_, err := tsGroupId.Write([]byte(mQuery.MetricName + labelStr))
 	assert.NoError(t, err)
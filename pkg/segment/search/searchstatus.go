@@ -25,6 +25,7 @@ import (
 	"github.com/siglens/siglens/pkg/segment/pqmr"
 	"github.com/siglens/siglens/pkg/segment/results/segresults"
 	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
 	"github.com/siglens/siglens/pkg/segment/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -183,6 +184,27 @@ func (sss *SegmentSearchStatus) updateMatchedRecords(blkNum uint16, matchedRecs
 	return nil
 }
 
+// Unsets the records that have been deleted so they are never matched.
+func (sss *SegmentSearchStatus) clearTombstonedRecords(segKey string) {
+	if !tombstones.HasTombstones(segKey) {
+		return
+	}
+
+	for blkNum, blkStatus := range sss.AllBlockStatus {
+		deletedRecs := tombstones.GetTombstonedRecords(segKey, blkNum)
+		if len(deletedRecs) == 0 {
+			continue
+		}
+
+		blkStatus.blockLock.Lock()
+		for recNum := range deletedRecs {
+			blkStatus.allRecords.ClearBit(uint(recNum))
+		}
+		blkStatus.hasAnyMatched = blkStatus.allRecords.Any()
+		blkStatus.blockLock.Unlock()
+	}
+}
+
 func (bss *BlockSearchStatus) intersectMatchedRecords(matchedRecs *pqmr.PQMatchResults) {
 
 	bss.blockLock.Lock()
@@ -40,6 +40,7 @@ import (
 	"github.com/siglens/siglens/pkg/segment/results/blockresults"
 	"github.com/siglens/siglens/pkg/segment/results/segresults"
 	"github.com/siglens/siglens/pkg/segment/structs"
+	"github.com/siglens/siglens/pkg/segment/tombstones"
 	"github.com/siglens/siglens/pkg/segment/utils"
 	"github.com/siglens/siglens/pkg/segment/writer"
 	toputils "github.com/siglens/siglens/pkg/utils"
@@ -230,6 +231,7 @@ func rawSearchColumnar(searchReq *structs.SegmentSearchRequest, searchNode *stru
 	searchRes := executeRawSearchOnNode(searchNode, searchReq, allBlockSearchHelpers, queryMetrics,
 		qid, allSearchResults, nodeRes, blockSummaries, timeRange)
 	mergeSegmentSearchStatus(segmentSearchRecords, searchRes, utils.And, nodeRes)
+	segmentSearchRecords.clearTombstonedRecords(searchReq.SegmentKey)
 	err := applyAggregationsToResult(aggs, segmentSearchRecords, searchReq, blockSummaries, timeRange,
 		sizeLimit, fileParallelism, queryMetrics, qid, allSearchResults, nodeRes)
 	if err != nil {
@@ -407,6 +409,9 @@ func rawSearchSingleSPQMR(multiReader *segread.MultiColSegmentReader, req *struc
 			log.Errorf("qid=%d, rawSearchSingleSPQMR unable to get pqmr results for block %d, segkey=%v", qid, blockNum, req.SegmentKey)
 			continue
 		}
+		for recNum := range tombstones.GetTombstonedRecords(req.SegmentKey, blockNum) {
+			pqmr.ClearBit(uint(recNum))
+		}
 
 		numRecsInBlock := uint(blkSum.RecCount)
 		currTS, ok := allTimestamps[blockNum]
@@ -793,6 +798,7 @@ func RawComputeSegmentStats(req *structs.SegmentSearchRequest, fileParallelism i
 	searchStatus := executeRawSearchOnNode(searchNode, req, allBlockSearchHelpers, queryMetrics,
 		qid, allSearchResults, nodeRes, blockSummaries, timeRange)
 	mergeSegmentSearchStatus(segmentSearchRecords, searchStatus, utils.And, nodeRes)
+	segmentSearchRecords.clearTombstonedRecords(req.SegmentKey)
 
 	segStats, err := applySegStatsToMatchedRecords(measureOps, segmentSearchRecords, req, blockSummaries, timeRange,
 		fileParallelism, queryMetrics, qid, nodeRes)
@@ -279,52 +279,37 @@ func HelperQueryArithmeticAndLogical(queryOp *structs.QueryArithmetic, resMap ma
 			return finalResult, nil, nil
 		}
 
-		// Since each grpID is unique and contains label set information, we can map lGrpID to labelSet and labelSet to rGrpID.
-		// This way, we can quickly find the corresponding rGrpID for a given lGrpID in the other vector. If there is no corresponding result, it means there are no matching labels between the two vectors.
-		idToMatchingLabelSet := make(map[string]string)
-		matchingLabelValTorightGroupID := make(map[string]string)
-		hasVectorMatchingOp := queryOp.VectorMatching != nil && len(queryOp.VectorMatching.MatchingLabels) > 0
-		if hasVectorMatchingOp {
-			// Place the vector with higher cardinality on the left side.
-			if queryOp.VectorMatching.Cardinality == structs.CardOneToMany {
-				swapped = true
-				resultLHS = resMap[queryOp.RHS]
-				resultRHS = resMap[queryOp.LHS]
+		if queryOp.VectorMatching != nil {
+			if !leftOk || !rightOk {
+				return finalResult, nil, nil
 			}
 
-			// If the query has vector matching operation, then we need to perform operations on that matching label set.
+			matches, err := mresults.MatchVectors(resultLHS.Results, resultRHS.Results, queryOp.VectorMatching)
+			if err != nil {
+				return nil, nil, fmt.Errorf("HelperQueryArithmeticAndLogical: failed to match the vectors; err=%v", err)
+			}
 
-			matchingLabelsComb := make(map[string]struct{}, 0)
-			for lGroupID := range resultLHS.Results {
-				matchingLabelValStr := putils.ExtractMatchingLabelSet(lGroupID, queryOp.VectorMatching.MatchingLabels, queryOp.VectorMatching.On)
-				// If the left vector is the 'One' (vector with lower cardinality), it should not have repeated MatchingLabels.
-				// E.g.: (metric1{type="compact"} on (color,type) group_right metric2), the value combinations of (color,type) must be unique in the metric1
-				if queryOp.VectorMatching.Cardinality == structs.CardOneToOne {
-					_, exists := matchingLabelsComb[matchingLabelValStr]
-					// None of the operators we currently implement support many-to-many operations, and this may need to be modified in the future.
-					if exists {
-						return nil, nil, fmt.Errorf("HelperQueryArithmeticAndLogical: many-to-many matching not allowed: matching labels must be unique on one side")
+			// A result is only produced at the timestamps where both series have a value.
+			for _, match := range matches {
+				tsRHS := resultRHS.Results[match.RHSGroupID]
+				finalResult[match.GroupID] = make(map[uint32]float64)
+				for timestamp, valueLHS := range resultLHS.Results[match.LHSGroupID] {
+					valueRHS, exists := tsRHS[timestamp]
+					if !exists {
+						continue
 					}
-					matchingLabelsComb[matchingLabelValStr] = struct{}{}
+					putils.SetFinalResult(queryOp, finalResult, match.GroupID, timestamp, valueLHS, valueRHS, false)
 				}
-				idToMatchingLabelSet[lGroupID] = matchingLabelValStr
 			}
 
-			matchingLabelsComb = make(map[string]struct{}, 0)
-			for rGroupID := range resultRHS.Results {
-				matchingLabelValStr := putils.ExtractMatchingLabelSet(rGroupID, queryOp.VectorMatching.MatchingLabels, queryOp.VectorMatching.On)
-				// Right vector is always the 'One' (vector with lower cardinality), it should not have repeated MatchingLabels.
-				_, exists := matchingLabelsComb[matchingLabelValStr]
-				// None of the operators we currently implement support many-to-many operations, and this may need to be modified in the future.
-				if exists {
-					return nil, nil, fmt.Errorf("HelperQueryArithmeticAndLogical: many-to-many matching not allowed: matching labels must be unique on one side")
-				}
-				matchingLabelsComb[matchingLabelValStr] = struct{}{}
-
-				matchingLabelValTorightGroupID[matchingLabelValStr] = rGroupID
-			}
+			return finalResult, nil, nil
+		}
 
-		} else if opLabelsDoNotNeedToMatch {
+		// Since each grpID is unique and contains label set information, we can map lGrpID to labelSet and labelSet to rGrpID.
+		// This way, we can quickly find the corresponding rGrpID for a given lGrpID in the other vector. If there is no corresponding result, it means there are no matching labels between the two vectors.
+		idToMatchingLabelSet := make(map[string]string)
+		matchingLabelValTorightGroupID := make(map[string]string)
+		if opLabelsDoNotNeedToMatch {
 			// Then regardless of whether there is a match or not, we should perform the operation on the two vectors.
 			// if it is one to one, we need to perform the operation on these two series.
 			// If it is one to many, we need to perform the operation on each series in the left vector with each series in the right vector.
@@ -361,7 +346,7 @@ func HelperQueryArithmeticAndLogical(queryOp *structs.QueryArithmetic, resMap ma
 			// So, if we want to determine whether there are elements with the same labels in another metric, we need to appropriately modify the group ID.
 			rGroupID := ""
 
-			if hasVectorMatchingOp || opLabelsDoNotNeedToMatch {
+			if opLabelsDoNotNeedToMatch {
 				matchingLabelVal, exists := idToMatchingLabelSet[lGroupID]
 				if !exists {
 					continue
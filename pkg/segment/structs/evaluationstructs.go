@@ -250,6 +250,11 @@ type TimechartExpr struct {
 	LimitExpr  *LimitExpr
 }
 
+type ChartExpr struct {
+	OverField     string         // Each distinct value of this field is a row of the chart.
+	TimechartExpr *TimechartExpr // The aggregations, the by field, and the limit and useother options.
+}
+
 type LimitExpr struct {
 	IsTop          bool // True: keeps the N highest scoring distinct values of the split-by field
 	Num            int
@@ -61,6 +61,10 @@ type MetricsQuery struct {
 	GetAllLabels        bool // flag to get all label sets for each time series
 	Groupby             bool // flag to group by tags
 	GroupByMetricName   bool // flag to group by metric name
+
+	Offset          int64  // seconds the evaluation time is moved back by, from the PromQL offset modifier
+	AtEpochSec      uint32 // evaluation time fixed by the PromQL @ modifier, 0 if not set
+	LookbackSeconds uint32 // seconds of data needed before the evaluation time range, e.g. by absent
 }
 
 type Aggregation struct {
@@ -76,6 +80,10 @@ type Function struct {
 	TimeWindow    float64 //E.g: rate(metrics[1m]), extract 1m and convert to seconds
 	Step          float64 //E.g: rate(metrics[5m:1m]), extract 1m and convert to seconds
 	TimeFunction  utils.TimeFunctions
+	// label and histogram functions work across all the series of a vector, instead of on a single series
+	LabelFunction     utils.LabelFunctions
+	HistogramFunction utils.HistogramFunctions
+	AbsentFunction    utils.AbsentFunctions // needs the evaluation time range, as it creates data points where there are none
 }
 
 type Downsampler struct {
@@ -168,6 +176,9 @@ type VectorMatching struct {
 	// On includes the given label names from matching,
 	// rather than excluding them.
 	On bool
+	// Include contains additional labels that should be included in
+	// the result from the side with the lower cardinality.
+	Include []string
 }
 
 // VectorMatchCardinality describes the cardinality relationship
@@ -442,6 +453,47 @@ func (metricFunc Function) ShallowClone() *Function {
 	return &functionCopy
 }
 
+func (mQuery *MetricsQuery) HasTimeModifiers() bool {
+	return mQuery.Offset != 0 || mQuery.AtEpochSec != 0
+}
+
+// Returns the time range the query has to be evaluated over to answer it for
+// the given time range. The @ modifier fixes the end of the time range and the
+// offset modifier moves it back, while the length stays the same.
+func (mQuery *MetricsQuery) GetEvaluationTimeRange(timeRange *dtu.MetricsTimeRange) *dtu.MetricsTimeRange {
+	if !mQuery.HasTimeModifiers() {
+		return timeRange
+	}
+
+	duration := int64(timeRange.EndEpochSec) - int64(timeRange.StartEpochSec)
+	end := int64(timeRange.EndEpochSec)
+	if mQuery.AtEpochSec != 0 {
+		end = int64(mQuery.AtEpochSec)
+	}
+	end -= mQuery.Offset
+
+	return &dtu.MetricsTimeRange{
+		StartEpochSec: clampToEpochSec(end - duration),
+		EndEpochSec:   clampToEpochSec(end),
+	}
+}
+
+func clampToEpochSec(epochSec int64) uint32 {
+	if epochSec < 0 {
+		return 0
+	}
+	if epochSec > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(epochSec)
+}
+
+// Label functions rename series and histogram functions combine the bucket
+// series, so both need every series of the vector at once.
+func (metricFunc Function) IsFunctionFromAllTimeseries() bool {
+	return metricFunc.LabelFunction > 0 || metricFunc.HistogramFunction > 0
+}
+
 func (agg Aggregation) ShallowClone() *Aggregation {
 	aggCopy := agg
 	return &aggCopy
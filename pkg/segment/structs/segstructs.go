@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strings"
 	"sync/atomic"
 
 	"github.com/cespare/xxhash"
@@ -153,6 +154,11 @@ type StatsExpr struct {
 	GroupByRequest    *GroupByRequest
 }
 
+type EventstatsExpr struct {
+	StatsExpr     *StatsExpr
+	RenameColumns map[string]string // Maps an aggregation like "avg(latency)" to its AS name.
+}
+
 // Update this function: GetAllColsInAggsIfStatsPresent() to return all columns in the query aggregators if stats are present.
 // This function should return all columns in the query aggregators if stats are present.
 type QueryAggregators struct {
@@ -177,26 +183,39 @@ type QueryAggregators struct {
 
 	// TODO: eventually, we shouldn't need any of the above fields; then we can
 	// delete them.
-	BinExpr         *BinCmdOptions
-	DedupExpr       *DedupExpr
-	EvalExpr        *EvalExpr
-	FieldsExpr      *ColumnsRequest
-	FillNullExpr    *FillNullExpr
-	GentimesExpr    *GenTimes
-	InputLookupExpr *InputLookup
-	HeadExpr        *HeadExpr
-	MakeMVExpr      *MultiValueColLetRequest
-	RareExpr        *StatisticExpr
-	RegexExpr       *RegexExpr
-	RexExpr         *RexExpr
-	SortExpr        *SortExpr
-	StatsExpr       *StatsExpr
-	StreamstatsExpr *StreamStatsOptions
-	TailExpr        *TailExpr
-	TimechartExpr   *TimechartExpr
-	TopExpr         *StatisticExpr
-	TransactionExpr *TransactionArguments
-	WhereExpr       *BoolExpr
+	BinExpr          *BinCmdOptions
+	ChartExpr        *ChartExpr
+	DedupExpr        *DedupExpr
+	EvalExpr         *EvalExpr
+	EventstatsExpr   *EventstatsExpr
+	FieldsExpr       *ColumnsRequest
+	FillNullExpr     *FillNullExpr
+	ForeachExpr      *ForeachExpr
+	GentimesExpr     *GenTimes
+	GeostatsExpr     *GeostatsExpr
+	InputLookupExpr  *InputLookup
+	IPLocationExpr   *IPLocationExpr
+	HeadExpr         *HeadExpr
+	JoinExpr         *JoinExpr
+	LogfmtExpr       *ColumnsRequest
+	LookupExpr       *LookupExpr
+	MakeMVExpr       *MultiValueColLetRequest
+	MakeResultsExpr  *MakeResultsExpr
+	OutputLookupExpr *OutputLookupExpr
+	RareExpr         *StatisticExpr
+	RegexExpr        *RegexExpr
+	RexExpr          *RexExpr
+	SortExpr         *SortExpr
+	StatsExpr        *StatsExpr
+	StreamstatsExpr  *StreamStatsOptions
+	TailExpr         *TailExpr
+	TimechartExpr    *TimechartExpr
+	TopExpr          *StatisticExpr
+	TransactionExpr  *TransactionArguments
+	TstatsExpr       *TstatsExpr
+	UntableExpr      *UntableExpr
+	WhereExpr        *BoolExpr
+	XyseriesExpr     *XyseriesExpr
 }
 
 type GenerateEvent struct {
@@ -215,6 +234,13 @@ type GenTimes struct {
 	Interval  *SpanLength
 }
 
+type MakeResultsExpr struct {
+	Count    uint64 // Number of results to generate when there's no Data.
+	Annotate bool   // If true, adds the _raw, host, source, sourcetype, and splunk_server fields.
+	Format   string // Either "csv" or "json"; only used with Data.
+	Data     string // If set, each row of the data is a result.
+}
+
 type InputLookup struct {
 	Filename             string
 	Append               bool
@@ -227,6 +253,139 @@ type InputLookup struct {
 	UpdatedRecordIndex   bool
 }
 
+type JoinExpr struct {
+	JoinType  string   // One of "inner", "left", or "outer". An outer join behaves like a left join.
+	FieldList []string // Fields to join on. If empty, the fields common to both sides are used.
+	Max       uint64   // Max subsearch rows joined to each event; 0 means no limit.
+	Overwrite bool     // If true, subsearch values overwrite event values for the same field.
+
+	Subsearch           interface{} // The parsed subsearch; an ast.QueryStruct.
+	SubsearchNode       *ASTNode
+	SubsearchAggs       *QueryAggregators
+	SubsearchIndexNames []string
+}
+
+type LookupExpr struct {
+	Filename     string
+	MatchFields  []*LookupField
+	OutputFields []*LookupField // If empty, every non-match column of the lookup file is output.
+	OutputNew    bool           // If true, only fill in output fields that are null in the event.
+}
+
+type LookupField struct {
+	LookupFieldName string // Column name in the lookup file.
+	EventFieldName  string // Field name in the event. Same as LookupFieldName unless renamed with AS.
+}
+
+type OutputLookupExpr struct {
+	Filename    string
+	Append      bool // If true, results are added to the end of an existing lookup file.
+	CreateEmpty bool // If true, an empty lookup file is created when there are no results.
+}
+
+type XyseriesExpr struct {
+	XField      string   // Each distinct value of this field is an output row.
+	YField      string   // Each distinct value of this field is an output column.
+	ValueFields []string // The fields that hold the cell values.
+}
+
+type UntableExpr struct {
+	XField     string // This field is kept as-is in every output row.
+	NameField  string // Holds the names of the other columns in the output.
+	ValueField string // Holds the values of the other columns in the output.
+}
+
+type ForeachExpr struct {
+	FieldPatterns []string    // Field names, which may have wildcards.
+	Template      string      // The eval command to run for each matching field.
+	Evals         []*EvalExpr // The template parsed with placeholder names; see GetPlaceholderReplacer().
+}
+
+// The template can't be parsed with its <<FIELD>> style placeholders, so it's
+// parsed with these names in their place.
+const foreachFieldPlaceholder = "siglensForeachFieldPlaceholder"
+
+func getForeachMatchSegPlaceholder(segNum int) string {
+	return fmt.Sprintf("siglensForeachMatchSeg%dPlaceholder", segNum)
+}
+
+// Replaces the placeholders in the template for one matching field. The
+// matchSegs are the parts of the field name matched by each wildcard.
+func (fe *ForeachExpr) ExpandTemplate(field string, matchSegs []string) string {
+	replacements := []string{"<<FIELD>>", field, "<<MATCHSTR>>", strings.Join(matchSegs, "")}
+	for i, matchSeg := range matchSegs {
+		replacements = append(replacements, fmt.Sprintf("<<MATCHSEG%d>>", i+1), matchSeg)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(fe.Template)
+}
+
+// Returns the template with parseable names in place of the placeholders.
+func (fe *ForeachExpr) GetParseableTemplate() string {
+	matchSegs := make([]string, fe.getNumMatchSegs())
+	for i := range matchSegs {
+		matchSegs[i] = getForeachMatchSegPlaceholder(i + 1)
+	}
+
+	return fe.ExpandTemplate(foreachFieldPlaceholder, matchSegs)
+}
+
+// Returns a replacer that changes the placeholder names in the parsed template
+// to the values for one matching field. Segments the field's pattern doesn't
+// have are empty.
+func (fe *ForeachExpr) GetPlaceholderReplacer(field string, matchSegs []string) *strings.Replacer {
+	replacements := []string{foreachFieldPlaceholder, field}
+	for i := 0; i < fe.getNumMatchSegs(); i++ {
+		matchSeg := ""
+		if i < len(matchSegs) {
+			matchSeg = matchSegs[i]
+		}
+		replacements = append(replacements, getForeachMatchSegPlaceholder(i+1), matchSeg)
+	}
+
+	return strings.NewReplacer(replacements...)
+}
+
+// Returns the most wildcards in any of the field patterns.
+func (fe *ForeachExpr) getNumMatchSegs() int {
+	numMatchSegs := 0
+	for _, pattern := range fe.FieldPatterns {
+		if numWildcards := strings.Count(pattern, "*"); numWildcards > numMatchSegs {
+			numMatchSegs = numWildcards
+		}
+	}
+
+	return numMatchSegs
+}
+
+type IPLocationExpr struct {
+	IPField   string
+	Prefix    string // Added to the start of each output field name.
+	AllFields bool   // If true, Continent, MetroCode, and Timezone are also output.
+	Language  string // Language for city, region, country, and continent names.
+}
+
+type GeostatsExpr struct {
+	LatField          string
+	LongField         string
+	OutputLatField    string
+	OutputLongField   string
+	BinSpanLat        float64 // Height of each bin in degrees.
+	BinSpanLong       float64 // Width of each bin in degrees.
+	GlobalLimit       int     // Max distinct by values that get their own column; 0 means no limit.
+	MeasureOperations []*MeasureAggregator
+	ByField           string
+}
+
+// The tstats command only answers from the star trees and segment stats built
+// at ingest time; it never falls back to a raw search.
+type TstatsExpr struct {
+	MeasureOperations []*MeasureAggregator
+	GroupByColumns    []string
+	IndexNames        []string    // From the where clause; if empty, the indexes of the query are used.
+	SpanLength        *SpanLength // If set, results are bucketed by time.
+}
+
 type StreamStatsOptions struct {
 	AllNum        bool
 	Current       bool
@@ -905,6 +1064,14 @@ func (qa *QueryAggregators) HasGeneratedEventsWithoutSearch() bool {
 	return true
 }
 
+// Returns true if this block can only be run by the new query pipeline.
+func (qa *QueryAggregators) IsNewPipelineOnlyCmd() bool {
+	return qa != nil && (qa.LookupExpr != nil || qa.JoinExpr != nil || qa.EventstatsExpr != nil ||
+		qa.ChartExpr != nil || qa.XyseriesExpr != nil || qa.UntableExpr != nil || qa.OutputLookupExpr != nil ||
+		qa.MakeResultsExpr != nil || qa.TstatsExpr != nil || qa.ForeachExpr != nil || qa.IPLocationExpr != nil ||
+		qa.GeostatsExpr != nil)
+}
+
 func (qa *QueryAggregators) HasDedupBlock() bool {
 	if qa != nil && qa.OutputTransforms != nil && qa.OutputTransforms.LetColumns != nil {
 		letColumns := qa.OutputTransforms.LetColumns
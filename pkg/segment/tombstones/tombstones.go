@@ -0,0 +1,191 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tombstones
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Deleted records stay in the segment files; instead, their locations are
+// written next to the segment so that searches can skip them. The file goes
+// away with the rest of the segment when the segment is deleted.
+const fileSuffix = ".tomb"
+
+// Maps a block number to the set of deleted record numbers in that block.
+type blockToRecords map[uint16]map[uint16]struct{}
+
+// Maps a segKey to its deleted records. A nil value means the segment has been
+// checked and has no deleted records, so we don't have to stat the file again.
+// The values are never modified once stored; adding tombstones replaces them,
+// so readers don't need to hold the lock while using them.
+var allTombstones = make(map[string]blockToRecords)
+var allTombstonesLock sync.RWMutex
+
+func getFileName(segKey string) string {
+	return segKey + fileSuffix
+}
+
+func HasTombstones(segKey string) bool {
+	return len(getTombstones(segKey)) > 0
+}
+
+// Returns the deleted record numbers in the block, or nil if none of its
+// records are deleted.
+func GetTombstonedRecords(segKey string, blockNum uint16) map[uint16]struct{} {
+	return getTombstones(segKey)[blockNum]
+}
+
+// Marks the records as deleted so that searches skip them. The records map a
+// block number to record numbers in that block.
+func AddTombstones(segKey string, records map[uint16][]uint16) error {
+	allTombstonesLock.Lock()
+	defer allTombstonesLock.Unlock()
+
+	existing, err := getTombstonesLocked(segKey)
+	if err != nil {
+		return fmt.Errorf("AddTombstones: failed to read tombstones for segKey %v; err=%v", segKey, err)
+	}
+
+	updated := make(blockToRecords, len(existing)+len(records))
+	for blockNum, recNums := range existing {
+		updated[blockNum] = recNums
+	}
+	for blockNum, recNums := range records {
+		merged := make(map[uint16]struct{}, len(updated[blockNum])+len(recNums))
+		for recNum := range updated[blockNum] {
+			merged[recNum] = struct{}{}
+		}
+		for _, recNum := range recNums {
+			merged[recNum] = struct{}{}
+		}
+		updated[blockNum] = merged
+	}
+
+	err = writeTombstonesFile(segKey, updated)
+	if err != nil {
+		return fmt.Errorf("AddTombstones: failed to write tombstones for segKey %v; err=%v", segKey, err)
+	}
+
+	allTombstones[segKey] = updated
+	return nil
+}
+
+// Forgets the cached tombstones of a segment that's being deleted, so the
+// cache doesn't grow with every segment ever searched. The file goes away
+// with the rest of the segment's files.
+func DeleteSegmentKey(segKey string) {
+	allTombstonesLock.Lock()
+	delete(allTombstones, segKey)
+	allTombstonesLock.Unlock()
+}
+
+func getTombstones(segKey string) blockToRecords {
+	allTombstonesLock.RLock()
+	tombstones, ok := allTombstones[segKey]
+	allTombstonesLock.RUnlock()
+	if ok {
+		return tombstones
+	}
+
+	allTombstonesLock.Lock()
+	defer allTombstonesLock.Unlock()
+
+	tombstones, err := getTombstonesLocked(segKey)
+	if err != nil {
+		log.Errorf("getTombstones: failed to read tombstones for segKey %v; err=%v", segKey, err)
+		return nil
+	}
+
+	return tombstones
+}
+
+// The caller must hold allTombstonesLock for writing.
+func getTombstonesLocked(segKey string) (blockToRecords, error) {
+	tombstones, ok := allTombstones[segKey]
+	if ok {
+		return tombstones, nil
+	}
+
+	tombstones, err := readTombstonesFile(segKey)
+	if err != nil {
+		return nil, err
+	}
+
+	allTombstones[segKey] = tombstones
+	return tombstones, nil
+}
+
+func readTombstonesFile(segKey string) (blockToRecords, error) {
+	data, err := os.ReadFile(getFileName(segKey))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("readTombstonesFile: failed to read %v; err=%v", getFileName(segKey), err)
+	}
+
+	var records map[uint16][]uint16
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("readTombstonesFile: failed to unmarshal %v; err=%v", getFileName(segKey), err)
+	}
+
+	tombstones := make(blockToRecords, len(records))
+	for blockNum, recNums := range records {
+		tombstones[blockNum] = make(map[uint16]struct{}, len(recNums))
+		for _, recNum := range recNums {
+			tombstones[blockNum][recNum] = struct{}{}
+		}
+	}
+
+	return tombstones, nil
+}
+
+// Writes to a temporary file first so a crash can't leave a partial file.
+func writeTombstonesFile(segKey string, tombstones blockToRecords) error {
+	records := make(map[uint16][]uint16, len(tombstones))
+	for blockNum, recNums := range tombstones {
+		for recNum := range recNums {
+			records[blockNum] = append(records[blockNum], recNum)
+		}
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("writeTombstonesFile: failed to marshal tombstones; err=%v", err)
+	}
+
+	fileName := getFileName(segKey)
+	tempFileName := fileName + ".tmp"
+	err = os.WriteFile(tempFileName, data, 0644)
+	if err != nil {
+		return fmt.Errorf("writeTombstonesFile: failed to write %v; err=%v", tempFileName, err)
+	}
+
+	err = os.Rename(tempFileName, fileName)
+	if err != nil {
+		return fmt.Errorf("writeTombstonesFile: failed to rename %v to %v; err=%v", tempFileName, fileName, err)
+	}
+
+	return nil
+}
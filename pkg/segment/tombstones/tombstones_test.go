@@ -0,0 +1,73 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tombstones
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AddTombstones(t *testing.T) {
+	segKey := filepath.Join(t.TempDir(), "seg0")
+	assert.False(t, HasTombstones(segKey))
+	assert.Nil(t, GetTombstonedRecords(segKey, 0))
+
+	err := AddTombstones(segKey, map[uint16][]uint16{0: {1, 5}, 2: {7}})
+	assert.Nil(t, err)
+	err = AddTombstones(segKey, map[uint16][]uint16{0: {3, 5}})
+	assert.Nil(t, err)
+
+	assert.True(t, HasTombstones(segKey))
+	assert.Equal(t, map[uint16]struct{}{1: {}, 3: {}, 5: {}}, GetTombstonedRecords(segKey, 0))
+	assert.Nil(t, GetTombstonedRecords(segKey, 1))
+	assert.Equal(t, map[uint16]struct{}{7: {}}, GetTombstonedRecords(segKey, 2))
+}
+
+func Test_TombstonesArePersisted(t *testing.T) {
+	segKey := filepath.Join(t.TempDir(), "seg0")
+	err := AddTombstones(segKey, map[uint16][]uint16{4: {0, 2}})
+	assert.Nil(t, err)
+
+	// Drop the cached copy so they're read back from disk.
+	allTombstonesLock.Lock()
+	delete(allTombstones, segKey)
+	allTombstonesLock.Unlock()
+
+	assert.True(t, HasTombstones(segKey))
+	assert.Equal(t, map[uint16]struct{}{0: {}, 2: {}}, GetTombstonedRecords(segKey, 4))
+}
+
+func Test_DeleteSegmentKey(t *testing.T) {
+	segKey := filepath.Join(t.TempDir(), "seg0")
+	assert.False(t, HasTombstones(segKey))
+
+	// Segments without tombstones are cached too.
+	allTombstonesLock.RLock()
+	_, ok := allTombstones[segKey]
+	allTombstonesLock.RUnlock()
+	assert.True(t, ok)
+
+	DeleteSegmentKey(segKey)
+
+	allTombstonesLock.RLock()
+	_, ok = allTombstones[segKey]
+	allTombstonesLock.RUnlock()
+	assert.False(t, ok)
+}
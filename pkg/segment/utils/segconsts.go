@@ -413,6 +413,26 @@ const (
 	Resets
 )
 
+type LabelFunctions int
+
+const (
+	LabelReplace LabelFunctions = iota + 1
+	LabelJoin
+)
+
+type HistogramFunctions int
+
+const (
+	HistogramQuantile HistogramFunctions = iota + 1
+)
+
+type AbsentFunctions int
+
+const (
+	Absent AbsentFunctions = iota + 1
+	Absent_Over_Time
+)
+
 // For columns used by aggs with eval statements, we should keep their raw values because we need to evaluate them
 // For columns only used by aggs without eval statements, we should not keep their raw values because it is a waste of performance
 // If we only use two modes. Later occurring aggs will overwrite earlier occurring aggs' usage status. E.g. stats dc(eval(lower(state))), dc(state)
@@ -671,6 +671,29 @@ func FlushWipBufferToFile(idleWipFlushDuration *time.Duration, maxWaitWipFlushDu
 	allSegStoresLock.RUnlock()
 }
 
+// Flushes the buffered records of the index so that searches can find them
+// right away, without waiting for the periodic flush.
+func FlushWipBufferForIndex(indexName string, orgId uint64) error {
+	allSegStoresLock.RLock()
+	defer allSegStoresLock.RUnlock()
+
+	for streamid, segstore := range allSegStores {
+		segstore.Lock.Lock()
+		if segstore.VirtualTableName != indexName || segstore.OrgId != orgId || segstore.wipBlock.maxIdx == 0 {
+			segstore.Lock.Unlock()
+			continue
+		}
+
+		err := segstore.AppendWipToSegfile(streamid, false, false, false)
+		segstore.Lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("FlushWipBufferForIndex: failed to flush stream %v of index %v; err=%v", streamid, indexName, err)
+		}
+	}
+
+	return nil
+}
+
 func InitColWip(segKey string, colName string) *ColWip {
 
 	deData := DeData{deMap: make(map[string][]uint16),
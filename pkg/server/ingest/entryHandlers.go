@@ -110,6 +110,13 @@ func splunkHecIngestHandler() func(ctx *fasthttp.RequestCtx) {
 	}
 }
 
+func splunkHecRawIngestHandler() func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
+		serverutils.CallWithOrgId(splunk.ProcessSplunkHecRawIngestRequest, ctx)
+	}
+}
+
 func EsPutIndexHandler() func(ctx *fasthttp.RequestCtx) {
 	return func(ctx *fasthttp.RequestCtx) {
 		serverutils.CallWithOrgId(eswriter.ProcessPutIndex, ctx)
@@ -157,6 +164,34 @@ func otlpIngestTracesHandler() func(ctx *fasthttp.RequestCtx) {
 	}
 }
 
+func zipkinIngestTracesHandler() func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
+		serverutils.CallWithOrgId(otlp.ProcessZipkinTraceIngest, ctx)
+	}
+}
+
+func jaegerIngestTracesHandler() func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
+		serverutils.CallWithOrgId(otlp.ProcessJaegerTraceIngest, ctx)
+	}
+}
+
+func otlpIngestLogsHandler() func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
+		serverutils.CallWithOrgId(otlp.ProcessLogIngest, ctx)
+	}
+}
+
+func otlpIngestMetricsHandler() func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
+		serverutils.CallWithOrgId(otlp.ProcessMetricIngest, ctx)
+	}
+}
+
 func sampleDatasetBulkHandler() func(ctx *fasthttp.RequestCtx) {
 	return func(ctx *fasthttp.RequestCtx) {
 		instrumentation.IncrementInt64Counter(instrumentation.POST_REQUESTS_COUNT, 1)
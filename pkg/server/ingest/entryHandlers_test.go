@@ -32,10 +32,17 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/siglens/siglens/pkg/config"
+	segmetadata "github.com/siglens/siglens/pkg/segment/metadata"
+	"github.com/siglens/siglens/pkg/segment/memory/limit"
+	"github.com/siglens/siglens/pkg/segment/writer"
 	vtable "github.com/siglens/siglens/pkg/virtualtable"
 )
 
 func cleanupOutDir() {
+	// Rotate and forget the segments the test wrote, so later tests don't find
+	// its docs.
+	writer.ForcedFlushToSegfile()
+	segmetadata.ResetGlobalMetadataForTest()
 	os.RemoveAll("data/")
 	os.RemoveAll("ingestnodes/")
 }
@@ -44,6 +51,7 @@ func TestPartial_esBulkPostHandler(t *testing.T) {
 
 	config.InitializeDefaultConfig(t.TempDir())
 	_ = vtable.InitVTable()
+	limit.InitMemoryLimiter()
 	// init a webServer to use the post handler method
 	// setup listener , it's fasthttp in memory listener for TESTING only
 	ln := fasthttputil.NewInmemoryListener()
@@ -93,7 +101,7 @@ func TestPartial_esBulkPostHandler(t *testing.T) {
 	err := client.Do(req, resp)
 	assert.NoError(t, err)
 
-	payload := []byte(`{"error":true,"items":[{"index":{"status":201}},{"index":{"error":{"reason":"indexing request failed","type":"mapper_parse_exception"}},"status":400},{"index":{"status":201}},{"index":{"error":{"reason":"indexing request failed","type":"mapper_parse_exception"}},"status":400}],"took":33068}`)
+	payload := []byte(`{"errors":false,"items":[{"index":{"status":201}},{"delete":{"_id":"2","_index":"test","result":"not_found","status":404}},{"index":{"status":201}},{"update":{"_id":"1","_index":"test","result":"updated","status":200}}],"took":33068}`)
 	expected := make(map[string]interface{})
 	_ = json.Unmarshal(payload, &expected)
 	actual := make(map[string]interface{})
@@ -194,6 +202,7 @@ func TestOk_esBulkPostHandler(t *testing.T) {
 func TestDelete_esBulkPostHandler(t *testing.T) {
 	_ = vtable.InitVTable()
 	config.InitializeDefaultConfig(t.TempDir())
+	limit.InitMemoryLimiter()
 	// init a webServer to use the post handler method
 	// setup listener , it's fasthttp in memory listener for TESTING only
 	ln := fasthttputil.NewInmemoryListener()
@@ -236,7 +245,7 @@ func TestDelete_esBulkPostHandler(t *testing.T) {
 	err := client.Do(req, resp)
 	assert.NoError(t, err)
 
-	payload := []byte(`{"index":{"error":{"reason":"request body is required","type":"parse_exception"}},"status":400}`)
+	payload := []byte(`{"errors":false,"items":[{"delete":{"_id":"2","_index":"test","result":"not_found","status":404}}],"took":1800}`)
 	expected := make(map[string]interface{})
 	_ = json.Unmarshal(payload, &expected)
 	actual := make(map[string]interface{})
@@ -244,18 +253,22 @@ func TestDelete_esBulkPostHandler(t *testing.T) {
 
 	//check if both response are true
 	var flag bool
-	if reflect.DeepEqual(actual, expected) == true {
-		flag = true
+	if _, ok := actual["items"]; ok {
+		actual_response := actual["items"].([]interface{})
+		expected_response := expected["items"].([]interface{})
+		if reflect.DeepEqual(actual_response, expected_response) == true {
+			flag = true
+		}
 	}
-	assert.Equal(t, 400, resp.StatusCode())
-	//TODO Fix test since we are not returning any loglines after parsing/validation
-	//change test to check for response code instead of response body
+	assert.Equal(t, 200, resp.StatusCode())
 	assert.Equal(t, true, flag)
 	cleanupOutDir()
 }
 
 func TestUpdate_esBulkPostHandler(t *testing.T) {
 	_ = vtable.InitVTable()
+	config.InitializeDefaultConfig(t.TempDir())
+	limit.InitMemoryLimiter()
 
 	// init a webServer to use the post handler method
 	// setup listener , it's fasthttp in memory listener for TESTING only
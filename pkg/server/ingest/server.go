@@ -92,7 +92,11 @@ func (hs *ingestionServerCfg) Run() (err error) {
 	hs.router.POST(server_utils.LOKI_PREFIX+"/api/v1/push", hs.Recovery(lokiPostBulkHandler()))
 
 	// Splunk Handlers
+	hs.router.POST("/services/collector", hs.Recovery(splunkHecIngestHandler()))
 	hs.router.POST("/services/collector/event", hs.Recovery(splunkHecIngestHandler()))
+	hs.router.POST("/services/collector/event/1.0", hs.Recovery(splunkHecIngestHandler()))
+	hs.router.POST("/services/collector/raw", hs.Recovery(splunkHecRawIngestHandler()))
+	hs.router.POST("/services/collector/raw/1.0", hs.Recovery(splunkHecRawIngestHandler()))
 	hs.router.GET("/services/collector/health", hs.Recovery(getHealthHandler()))
 	hs.router.GET("/services/collector/health/1.0", hs.Recovery(getHealthHandler()))
 
@@ -110,6 +114,12 @@ func (hs *ingestionServerCfg) Run() (err error) {
 
 	// OTLP Handlers
 	hs.router.POST(server_utils.OTLP_PREFIX+"/v1/traces", hs.Recovery(otlpIngestTracesHandler()))
+	hs.router.POST(server_utils.OTLP_PREFIX+"/v1/logs", hs.Recovery(otlpIngestLogsHandler()))
+	hs.router.POST(server_utils.OTLP_PREFIX+"/v1/metrics", hs.Recovery(otlpIngestMetricsHandler()))
+
+	// Zipkin and Jaeger Handlers
+	hs.router.POST("/api/v2/spans", hs.Recovery(zipkinIngestTracesHandler()))
+	hs.router.POST("/api/traces", hs.Recovery(jaegerIngestTracesHandler()))
 
 	if hook := hooks.GlobalHooks.ExtraIngestEndpointsHook; hook != nil {
 		hook(hs.router, hs.Recovery)
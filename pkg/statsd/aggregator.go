@@ -0,0 +1,227 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Series that receive no metrics for this many flush intervals are dropped; a
+// counter or timer that comes back after that starts its totals over.
+const maxIdleFlushes = 30
+
+// A value to write for one series at the end of a flush interval.
+type point struct {
+	name  string
+	tags  map[string]string
+	value float64
+}
+
+type counter struct {
+	name        string
+	tags        map[string]string
+	total       float64
+	updated     bool
+	idleFlushes int
+}
+
+type gauge struct {
+	name        string
+	tags        map[string]string
+	value       float64
+	updated     bool
+	idleFlushes int
+}
+
+type timer struct {
+	name        string
+	tags        map[string]string
+	values      []float64 // values received during the current interval
+	totalCount  float64
+	totalSum    float64
+	idleFlushes int
+}
+
+type set struct {
+	name   string
+	tags   map[string]string
+	values map[string]struct{}
+}
+
+// Aggregates metrics between flushes. Counters, and the count and sum of
+// timers, are kept as running totals so they can be queried like Prometheus
+// counters; gauges keep their last value so relative updates can be applied.
+// Only series that received metrics during an interval are written, and the
+// ones idle for maxIdleFlushes intervals are forgotten.
+type aggregator struct {
+	lock        sync.Mutex
+	percentiles []float64
+	counters    map[string]*counter
+	gauges      map[string]*gauge
+	timers      map[string]*timer
+	sets        map[string]*set
+
+	bytesReceived   uint64
+	metricsReceived uint64
+}
+
+func newAggregator(percentiles []float64) *aggregator {
+	return &aggregator{
+		percentiles: percentiles,
+		counters:    make(map[string]*counter),
+		gauges:      make(map[string]*gauge),
+		timers:      make(map[string]*timer),
+		sets:        make(map[string]*set),
+	}
+}
+
+func (a *aggregator) add(m *metric) {
+	key := getSeriesKey(m.name, m.tags)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.metricsReceived++
+	switch m.metricType {
+	case counterMetric:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{name: m.name, tags: m.tags}
+			a.counters[key] = c
+		}
+		c.total += m.value / m.sampleRate
+		c.updated = true
+	case gaugeMetric:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{name: m.name, tags: m.tags}
+			a.gauges[key] = g
+		}
+		if m.isRelative {
+			g.value += m.value
+		} else {
+			g.value = m.value
+		}
+		g.updated = true
+	case timerMetric:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timer{name: m.name, tags: m.tags}
+			a.timers[key] = t
+		}
+		t.values = append(t.values, m.value)
+		t.totalCount += 1 / m.sampleRate
+		t.totalSum += m.value / m.sampleRate
+	case setMetric:
+		s, ok := a.sets[key]
+		if !ok {
+			s = &set{name: m.name, tags: m.tags, values: make(map[string]struct{})}
+			a.sets[key] = s
+		}
+		s.values[m.setValue] = struct{}{}
+	}
+}
+
+func (a *aggregator) addBytesReceived(numBytes uint64) {
+	a.lock.Lock()
+	a.bytesReceived += numBytes
+	a.lock.Unlock()
+}
+
+// Returns the points for the interval that just ended, and the number of
+// bytes and metrics received during it.
+func (a *aggregator) flush() ([]point, uint64, uint64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	points := make([]point, 0)
+	for key, c := range a.counters {
+		if !c.updated {
+			c.idleFlushes++
+			if c.idleFlushes >= maxIdleFlushes {
+				delete(a.counters, key)
+			}
+			continue
+		}
+
+		points = append(points, point{name: c.name, tags: c.tags, value: c.total})
+		c.updated = false
+		c.idleFlushes = 0
+	}
+
+	for key, g := range a.gauges {
+		if !g.updated {
+			g.idleFlushes++
+			if g.idleFlushes >= maxIdleFlushes {
+				delete(a.gauges, key)
+			}
+			continue
+		}
+
+		points = append(points, point{name: g.name, tags: g.tags, value: g.value})
+		g.updated = false
+		g.idleFlushes = 0
+	}
+
+	for key, t := range a.timers {
+		if len(t.values) == 0 {
+			t.idleFlushes++
+			if t.idleFlushes >= maxIdleFlushes {
+				delete(a.timers, key)
+			}
+			continue
+		}
+
+		sort.Float64s(t.values)
+		for _, percentile := range a.percentiles {
+			tags := make(map[string]string, len(t.tags)+1)
+			for key, value := range t.tags {
+				tags[key] = value
+			}
+			tags["quantile"] = strconv.FormatFloat(percentile/100, 'f', -1, 64)
+			points = append(points, point{name: t.name, tags: tags, value: getPercentile(t.values, percentile)})
+		}
+		points = append(points, point{name: t.name + "_sum", tags: t.tags, value: t.totalSum})
+		points = append(points, point{name: t.name + "_count", tags: t.tags, value: t.totalCount})
+		t.values = t.values[:0]
+		t.idleFlushes = 0
+	}
+
+	for key, s := range a.sets {
+		points = append(points, point{name: s.name, tags: s.tags, value: float64(len(s.values))})
+		delete(a.sets, key)
+	}
+
+	bytesReceived, metricsReceived := a.bytesReceived, a.metricsReceived
+	a.bytesReceived, a.metricsReceived = 0, 0
+
+	return points, bytesReceived, metricsReceived
+}
+
+// Uses the nearest-rank method on the sorted values.
+func getPercentile(sortedValues []float64, percentile float64) float64 {
+	rank := int(math.Ceil(percentile / 100 * float64(len(sortedValues))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sortedValues[rank-1]
+}
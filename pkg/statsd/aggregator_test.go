@@ -0,0 +1,125 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flushSorted(a *aggregator) []point {
+	points, _, _ := a.flush()
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].name != points[j].name {
+			return points[i].name < points[j].name
+		}
+		return points[i].tags["quantile"] < points[j].tags["quantile"]
+	})
+	return points
+}
+
+func Test_Aggregator_CountersAndGauges(t *testing.T) {
+	a := newAggregator(nil)
+	addDatagram(a, []byte("hits:1|c\nhits:1|c|@0.5\ntemp:20|g\ntemp:+5|g\n\nbad line"))
+
+	points, bytesReceived, metricsReceived := a.flush()
+	assert.ElementsMatch(t, []point{{name: "hits", value: 3}, {name: "temp", value: 25}}, points)
+	assert.Equal(t, uint64(52), bytesReceived)
+	assert.Equal(t, uint64(4), metricsReceived)
+
+	// Series without new metrics aren't written.
+	addDatagram(a, []byte("temp:-1|g"))
+	assert.Equal(t, []point{{name: "temp", value: 24}}, flushSorted(a))
+
+	// Counters keep their running total.
+	addDatagram(a, []byte("hits:2|c"))
+	assert.Equal(t, []point{{name: "hits", value: 5}}, flushSorted(a))
+}
+
+func Test_Aggregator_Tags(t *testing.T) {
+	a := newAggregator(nil)
+	addDatagram(a, []byte("hits:1|c|#env:prod\nhits:1|c|#env:dev\nhits:1|c|#env:prod"))
+
+	assert.ElementsMatch(t, []point{
+		{name: "hits", tags: map[string]string{"env": "prod"}, value: 2},
+		{name: "hits", tags: map[string]string{"env": "dev"}, value: 1},
+	}, flushSorted(a))
+}
+
+func Test_Aggregator_Timers(t *testing.T) {
+	a := newAggregator([]float64{50, 90})
+	for _, line := range []string{"5", "1", "4", "2", "3", "10", "6", "9", "7", "8"} {
+		addDatagram(a, []byte("latency:"+line+"|ms|#op:get"))
+	}
+
+	tags := map[string]string{"op": "get"}
+	assert.Equal(t, []point{
+		{name: "latency", tags: map[string]string{"op": "get", "quantile": "0.5"}, value: 5},
+		{name: "latency", tags: map[string]string{"op": "get", "quantile": "0.9"}, value: 9},
+		{name: "latency_count", tags: tags, value: 10},
+		{name: "latency_sum", tags: tags, value: 55},
+	}, flushSorted(a))
+
+	// Percentiles only cover the last interval, but the count and sum are
+	// running totals.
+	addDatagram(a, []byte("latency:100|ms|@0.5|#op:get"))
+	assert.Equal(t, []point{
+		{name: "latency", tags: map[string]string{"op": "get", "quantile": "0.5"}, value: 100},
+		{name: "latency", tags: map[string]string{"op": "get", "quantile": "0.9"}, value: 100},
+		{name: "latency_count", tags: tags, value: 12},
+		{name: "latency_sum", tags: tags, value: 255},
+	}, flushSorted(a))
+}
+
+func Test_Aggregator_Sets(t *testing.T) {
+	a := newAggregator(nil)
+	addDatagram(a, []byte("users:alice|s\nusers:bob|s\nusers:alice|s"))
+	assert.Equal(t, []point{{name: "users", value: 2}}, flushSorted(a))
+
+	// Sets start over each interval.
+	addDatagram(a, []byte("users:carol|s"))
+	assert.Equal(t, []point{{name: "users", value: 1}}, flushSorted(a))
+
+	assert.Empty(t, flushSorted(a))
+}
+
+func Test_Aggregator_ExpireIdleSeries(t *testing.T) {
+	a := newAggregator([]float64{50})
+	addDatagram(a, []byte("hits:1|c\ntemp:20|g\nlatency:5|ms"))
+	assert.Len(t, flushSorted(a), 5)
+
+	for i := 0; i < maxIdleFlushes-1; i++ {
+		addDatagram(a, []byte("active:1|c"))
+		assert.Len(t, flushSorted(a), 1)
+	}
+	assert.Len(t, a.counters, 2)
+	assert.Len(t, a.gauges, 1)
+	assert.Len(t, a.timers, 1)
+
+	addDatagram(a, []byte("active:1|c"))
+	flushSorted(a)
+	assert.Len(t, a.counters, 1)
+	assert.Empty(t, a.gauges)
+	assert.Empty(t, a.timers)
+
+	// A counter that comes back starts its total over.
+	addDatagram(a, []byte("hits:2|c"))
+	assert.Equal(t, []point{{name: "hits", value: 2}}, flushSorted(a))
+}
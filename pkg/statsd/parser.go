@@ -0,0 +1,179 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type metricType int
+
+const (
+	counterMetric metricType = iota
+	gaugeMetric
+	timerMetric
+	setMetric
+)
+
+// One metric from a StatsD line: <name>:<value>|<type>[|@<rate>][|#<tags>]
+type metric struct {
+	name       string
+	metricType metricType
+	value      float64
+	setValue   string // the raw value for sets, which count unique strings
+	isRelative bool   // a gauge value with a sign adjusts the previous value
+	sampleRate float64
+	tags       map[string]string
+}
+
+// Parses one line. Returns a nil metric without an error for DogStatsD events
+// and service checks, which aren't metrics.
+func parseLine(line string) (*metric, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, nil
+	}
+
+	// DogStatsD tags after the first pipe may contain colons, so the value is
+	// after the last colon before it.
+	pipeIdx := strings.IndexByte(line, '|')
+	colonIdx := -1
+	if pipeIdx >= 0 {
+		colonIdx = strings.LastIndexByte(line[:pipeIdx], ':')
+	}
+	if colonIdx <= 0 {
+		return nil, fmt.Errorf("parseLine: expected <name>:<value>|<type> but got %q", line)
+	}
+
+	result := &metric{
+		name:       sanitizeName(line[:colonIdx], true),
+		sampleRate: 1,
+	}
+	rawValue := line[colonIdx+1 : pipeIdx]
+
+	sections := strings.Split(line[pipeIdx+1:], "|")
+	switch sections[0] {
+	case "c":
+		result.metricType = counterMetric
+	case "g":
+		result.metricType = gaugeMetric
+		result.isRelative = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	case "ms", "h", "d":
+		// DogStatsD histograms and distributions are aggregated like timers.
+		result.metricType = timerMetric
+	case "s":
+		result.metricType = setMetric
+		result.setValue = rawValue
+	default:
+		return nil, fmt.Errorf("parseLine: unknown metric type %q in %q", sections[0], line)
+	}
+
+	if result.metricType != setMetric {
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parseLine: invalid value %q in %q; err=%v", rawValue, line, err)
+		}
+		result.value = value
+	}
+
+	for _, section := range sections[1:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("parseLine: invalid sample rate %q in %q", section, line)
+			}
+			result.sampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			result.tags = parseTags(section[1:])
+		default:
+			// Other DogStatsD extensions, like container ids, are ignored.
+		}
+	}
+
+	return result, nil
+}
+
+// Tags are comma separated key:value pairs. A tag without a value gets the
+// value "true".
+func parseTags(rawTags string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(rawTags, ",") {
+		if tag == "" {
+			continue
+		}
+
+		key, value := tag, "true"
+		if idx := strings.IndexByte(tag, ':'); idx >= 0 {
+			key, value = tag[:idx], tag[idx+1:]
+		}
+		tags[sanitizeName(key, false)] = value
+	}
+
+	return tags
+}
+
+// Identifies the series a metric belongs to, so metrics with the same name
+// and tags are aggregated together.
+func getSeriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, key := range keys {
+		sb.WriteByte(',')
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(tags[key])
+	}
+
+	return sb.String()
+}
+
+// StatsD names are usually dotted, which PromQL can't query, so characters
+// that aren't valid in a Prometheus name are replaced with underscores.
+func sanitizeName(name string, allowColon bool) string {
+	if name == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	if name[0] >= '0' && name[0] <= '9' {
+		sb.WriteByte('_')
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		isValid := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') || char == '_' || (allowColon && char == ':')
+		if isValid {
+			sb.WriteByte(char)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
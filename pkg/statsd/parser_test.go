@@ -0,0 +1,66 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLine(t *testing.T) {
+	cases := map[string]*metric{
+		"api.requests:3|c": {name: "api_requests", metricType: counterMetric, value: 3, sampleRate: 1},
+		"api.requests:1|c|@0.1|#env:prod,region:us-east:1,canary": {name: "api_requests", metricType: counterMetric, value: 1, sampleRate: 0.1,
+			tags: map[string]string{"env": "prod", "region": "us-east:1", "canary": "true"}},
+		"queue.depth:42|g":              {name: "queue_depth", metricType: gaugeMetric, value: 42, sampleRate: 1},
+		"queue.depth:-5|g":              {name: "queue_depth", metricType: gaugeMetric, value: -5, isRelative: true, sampleRate: 1},
+		"db.query:12.5|ms":              {name: "db_query", metricType: timerMetric, value: 12.5, sampleRate: 1},
+		"db.query:12|h|#db:a":           {name: "db_query", metricType: timerMetric, value: 12, sampleRate: 1, tags: map[string]string{"db": "a"}},
+		"users.unique:alice|s|c:abc123": {name: "users_unique", metricType: setMetric, setValue: "alice", sampleRate: 1},
+		"_e{5,4}:title|text":            nil,
+		"_sc|check|0":                   nil,
+	}
+
+	for line, expected := range cases {
+		actual, err := parseLine(line)
+		assert.NoError(t, err, "line: %v", line)
+		assert.Equal(t, expected, actual, "line: %v", line)
+	}
+}
+
+func Test_ParseLine_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"no value",
+		":1|c",
+		"name|c",
+		"name:1",
+		"name:abc|c",
+		"name:1|x",
+		"name:1|c|@2",
+		"name:1|c|@abc",
+	} {
+		_, err := parseLine(line)
+		assert.Error(t, err, "line: %v", line)
+	}
+}
+
+func Test_GetSeriesKey(t *testing.T) {
+	assert.Equal(t, "name", getSeriesKey("name", nil))
+	assert.Equal(t, "name,a=1,b=2", getSeriesKey("name", map[string]string{"b": "2", "a": "1"}))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	jp "github.com/buger/jsonparser"
+	"github.com/siglens/siglens/pkg/segment/writer/metrics"
+	"github.com/siglens/siglens/pkg/usageStats"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxDatagramSize = 65536
+
+// Listens on the UDP address and aggregates the StatsD metrics it receives,
+// writing them to the metrics store every flushInterval until the connection
+// fails. Returns an error if the address can't be listened on.
+func RunServer(addr string, flushInterval time.Duration, percentiles []float64) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("RunServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return serve(conn, newAggregator(percentiles), flushInterval, 0)
+}
+
+func serve(conn net.PacketConn, aggregator *aggregator, flushInterval time.Duration, orgId uint64) error {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				flushToMetricsStore(aggregator, time.Now(), orgId)
+				return
+			case now := <-ticker.C:
+				flushToMetricsStore(aggregator, now, orgId)
+			}
+		}
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("serve: failed to read datagram; err=%v", err)
+		}
+
+		addDatagram(aggregator, buf[:n])
+	}
+}
+
+// A datagram may hold several metrics separated by newlines.
+func addDatagram(aggregator *aggregator, datagram []byte) {
+	aggregator.addBytesReceived(uint64(len(datagram)))
+	for _, line := range bytes.Split(datagram, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		metric, err := parseLine(string(line))
+		if err != nil {
+			log.Debugf("addDatagram: dropping metric; err=%v", err)
+			continue
+		}
+		if metric != nil {
+			aggregator.add(metric)
+		}
+	}
+}
+
+func flushToMetricsStore(aggregator *aggregator, now time.Time, orgId uint64) {
+	points, bytesReceived, metricsReceived := aggregator.flush()
+	if bytesReceived > 0 {
+		usageStats.UpdateMetricsStats(bytesReceived, metricsReceived, orgId)
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	numFailedPoints := 0
+	timestamp := uint32(now.Unix())
+	for _, point := range points {
+		tagsHolder := metrics.GetTagsHolder()
+		for key, value := range point.tags {
+			tagsHolder.Insert(key, []byte(value), jp.String)
+		}
+
+		err := metrics.EncodeDatapoint([]byte(point.name), tagsHolder, point.value, timestamp, 0, orgId)
+		if err != nil {
+			log.Errorf("flushToMetricsStore: failed to write point for %v %v; err=%v", point.name, point.tags, err)
+			numFailedPoints++
+		}
+	}
+
+	log.Debugf("flushToMetricsStore: wrote %v points from %v metrics; %v failed", len(points)-numFailedPoints, metricsReceived, numFailedPoints)
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Priority used for messages without a valid PRI part, as RFC 3164 suggests.
+const defaultPriority = 13
+
+const nilValue = "-"
+
+var facilityLabels = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityLabels = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// A parsed syslog message. Version is 0 for RFC 3164 messages. Header fields
+// that were absent or the NILVALUE are left empty.
+type Message struct {
+	Priority       int
+	Version        int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcId         string
+	MsgId          string
+	StructuredData map[string]map[string]string // SD-ID to its params
+	Message        string
+}
+
+func (m *Message) Facility() int {
+	return m.Priority / 8
+}
+
+func (m *Message) Severity() int {
+	return m.Priority % 8
+}
+
+func (m *Message) FacilityLabel() string {
+	if m.Facility() < len(facilityLabels) {
+		return facilityLabels[m.Facility()]
+	}
+	return ""
+}
+
+func (m *Message) SeverityLabel() string {
+	return severityLabels[m.Severity()]
+}
+
+// Parses an RFC 5424 or RFC 3164 message. Messages with a version after the
+// PRI are RFC 5424, anything else is treated as RFC 3164. The current time is
+// used to pick the year of RFC 3164 timestamps and their location.
+func Parse(data []byte, now time.Time) (*Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+
+	priority, rest, ok := parsePriority(data)
+	if !ok {
+		message := &Message{Priority: defaultPriority}
+		parseRFC3164(message, data, now)
+		return message, nil
+	}
+
+	if version, afterVersion, ok := parseVersion(rest); ok {
+		message := &Message{Priority: priority, Version: version}
+		err := parseRFC5424(message, afterVersion)
+		if err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+
+	message := &Message{Priority: priority}
+	parseRFC3164(message, rest, now)
+	return message, nil
+}
+
+func parsePriority(data []byte) (int, []byte, bool) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, nil, false
+	}
+
+	end := bytes.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return 0, nil, false
+	}
+
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority < 0 || priority > 191 {
+		return 0, nil, false
+	}
+
+	return priority, data[end+1:], true
+}
+
+func parseVersion(data []byte) (int, []byte, bool) {
+	end := bytes.IndexByte(data, ' ')
+	if end < 1 || end > 2 {
+		return 0, nil, false
+	}
+
+	version, err := strconv.Atoi(string(data[:end]))
+	if err != nil || version < 1 {
+		return 0, nil, false
+	}
+
+	return version, data[end+1:], true
+}
+
+// Parses everything after "<PRI>VERSION ".
+func parseRFC5424(message *Message, data []byte) error {
+	fields := make([]string, 5)
+	for i := range fields {
+		var field []byte
+		field, data = nextToken(data)
+		if len(field) == 0 {
+			return fmt.Errorf("parseRFC5424: the header is missing fields")
+		}
+		if string(field) != nilValue {
+			fields[i] = string(field)
+		}
+	}
+
+	if fields[0] != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("parseRFC5424: invalid timestamp %v; err=%v", fields[0], err)
+		}
+		message.Timestamp = timestamp
+	}
+	message.Hostname = fields[1]
+	message.AppName = fields[2]
+	message.ProcId = fields[3]
+	message.MsgId = fields[4]
+
+	if len(data) == 0 {
+		return fmt.Errorf("parseRFC5424: missing structured data")
+	}
+
+	if data[0] == '-' {
+		data = data[1:]
+	} else {
+		structuredData, rest, err := parseStructuredData(data)
+		if err != nil {
+			return err
+		}
+		message.StructuredData = structuredData
+		data = rest
+	}
+
+	if len(data) > 0 {
+		if data[0] != ' ' {
+			return fmt.Errorf("parseRFC5424: expected a space before the message")
+		}
+		data = bytes.TrimPrefix(data[1:], []byte("\xef\xbb\xbf"))
+	}
+	message.Message = string(data)
+
+	return nil
+}
+
+// Parses one or more SD-ELEMENTs, like [id param="value" ...][id2 ...], and
+// returns the data after them.
+func parseStructuredData(data []byte) (map[string]map[string]string, []byte, error) {
+	structuredData := make(map[string]map[string]string)
+	for len(data) > 0 && data[0] == '[' {
+		data = data[1:]
+
+		idEnd := bytes.IndexAny(data, " ]")
+		if idEnd < 1 {
+			return nil, nil, fmt.Errorf("parseStructuredData: invalid SD-ID")
+		}
+		id := string(data[:idEnd])
+		data = data[idEnd:]
+
+		params, ok := structuredData[id]
+		if !ok {
+			params = make(map[string]string)
+			structuredData[id] = params
+		}
+
+		for len(data) > 0 && data[0] == ' ' {
+			data = data[1:]
+
+			nameEnd := bytes.IndexByte(data, '=')
+			if nameEnd < 1 || nameEnd+1 >= len(data) || data[nameEnd+1] != '"' {
+				return nil, nil, fmt.Errorf("parseStructuredData: invalid param in SD-ID %v", id)
+			}
+			name := string(data[:nameEnd])
+			data = data[nameEnd+2:]
+
+			value, rest, err := parseParamValue(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parseStructuredData: invalid value for param %v in SD-ID %v; err=%v", name, id, err)
+			}
+			params[name] = value
+			data = rest
+		}
+
+		if len(data) == 0 || data[0] != ']' {
+			return nil, nil, fmt.Errorf("parseStructuredData: SD-ID %v is not terminated", id)
+		}
+		data = data[1:]
+	}
+
+	return structuredData, data, nil
+}
+
+// Reads a param value up to its closing quote, unescaping \", \\ and \].
+func parseParamValue(data []byte) (string, []byte, error) {
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			if i+1 < len(data) && (data[i+1] == '"' || data[i+1] == '\\' || data[i+1] == ']') {
+				i++
+			}
+			sb.WriteByte(data[i])
+		case '"':
+			return sb.String(), data[i+1:], nil
+		default:
+			sb.WriteByte(data[i])
+		}
+	}
+
+	return "", nil, fmt.Errorf("parseParamValue: missing closing quote")
+}
+
+// Parses everything after the PRI of a BSD syslog message, like
+// "Oct 11 22:14:15 mymachine su[123]: 'su root' failed". Since the format
+// isn't strict, whatever can't be recognized is kept in the message.
+func parseRFC3164(message *Message, data []byte, now time.Time) {
+	timestamp, rest, ok := parseRFC3164Timestamp(data, now)
+	if !ok {
+		message.Message = string(data)
+		return
+	}
+	message.Timestamp = timestamp
+
+	// The hostname is optional, so a first token that looks like a tag is
+	// not taken as the hostname.
+	token, afterToken := nextToken(rest)
+	if len(token) > 0 && len(afterToken) > 0 && !bytes.ContainsAny(token, ":[") {
+		message.Hostname = string(token)
+		rest = afterToken
+	}
+
+	appName, procId, content, ok := parseTag(rest)
+	if ok {
+		message.AppName = appName
+		message.ProcId = procId
+		rest = content
+	}
+
+	message.Message = string(rest)
+}
+
+// Accepts the RFC 3164 "Mmm dd hh:mm:ss" timestamp, which has no year, and
+// RFC 3339 timestamps that many newer senders use instead.
+func parseRFC3164Timestamp(data []byte, now time.Time) (time.Time, []byte, bool) {
+	if len(data) >= len(time.Stamp) {
+		timestamp, err := time.ParseInLocation(time.Stamp, string(data[:len(time.Stamp)]), now.Location())
+		if err == nil {
+			timestamp = time.Date(now.Year(), timestamp.Month(), timestamp.Day(), timestamp.Hour(),
+				timestamp.Minute(), timestamp.Second(), 0, now.Location())
+			// A message from late December received in early January is
+			// from the previous year.
+			if timestamp.After(now.Add(24 * time.Hour)) {
+				timestamp = timestamp.AddDate(-1, 0, 0)
+			}
+			return timestamp, bytes.TrimPrefix(data[len(time.Stamp):], []byte(" ")), true
+		}
+	}
+
+	token, rest := nextToken(data)
+	timestamp, err := time.Parse(time.RFC3339Nano, string(token))
+	if err == nil {
+		return timestamp, rest, true
+	}
+
+	return time.Time{}, nil, false
+}
+
+// Parses a "TAG[PID]: " or "TAG: " prefix.
+func parseTag(data []byte) (string, string, []byte, bool) {
+	end := bytes.IndexAny(data, ":[ ")
+	if end < 1 {
+		return "", "", nil, false
+	}
+
+	appName := string(data[:end])
+	procId := ""
+	rest := data[end:]
+	if rest[0] == '[' {
+		pidEnd := bytes.IndexByte(rest, ']')
+		if pidEnd < 0 {
+			return "", "", nil, false
+		}
+		procId = string(rest[1:pidEnd])
+		rest = rest[pidEnd+1:]
+	}
+
+	if len(rest) == 0 || rest[0] != ':' {
+		return "", "", nil, false
+	}
+
+	return appName, procId, bytes.TrimPrefix(rest[1:], []byte(" ")), true
+}
+
+// Returns the data up to the next space, and the data after that space.
+func nextToken(data []byte) ([]byte, []byte) {
+	end := bytes.IndexByte(data, ' ')
+	if end < 0 {
+		return data, nil
+	}
+	return data[:end], data[end+1:]
+}
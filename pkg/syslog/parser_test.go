@@ -0,0 +1,109 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse_RFC5424(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	data := []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high \"x\" \] \\"] ` + "\xef\xbb\xbf" + `An application event log entry...` + "\n")
+
+	message, err := Parse(data, now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{
+		Priority:  165,
+		Version:   1,
+		Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3_000_000, time.UTC),
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		ProcId:    "",
+		MsgId:     "ID47",
+		StructuredData: map[string]map[string]string{
+			"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+			"examplePriority@32473": {"class": `high "x" ] \`},
+		},
+		Message: "An application event log entry...",
+	}, message)
+	assert.Equal(t, 20, message.Facility())
+	assert.Equal(t, "local4", message.FacilityLabel())
+	assert.Equal(t, 5, message.Severity())
+	assert.Equal(t, "notice", message.SeverityLabel())
+}
+
+func Test_Parse_RFC5424_NilValues(t *testing.T) {
+	message, err := Parse([]byte("<34>1 - - - - - -"), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{Priority: 34, Version: 1}, message)
+
+	_, err = Parse([]byte("<34>1 2003-10-11T22:14:15Z host app"), time.Now())
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("<34>1 - host app - - [id a=\"b\" msg"), time.Now())
+	assert.Error(t, err)
+}
+
+func Test_Parse_RFC3164(t *testing.T) {
+	location := time.FixedZone("test", 3600)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, location)
+
+	message, err := Parse([]byte("<34>Oct 11 22:14:15 mymachine su[1234]: 'su root' failed for lonvick on /dev/pts/8"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{
+		Priority:  34,
+		Timestamp: time.Date(2023, 10, 11, 22, 14, 15, 0, location),
+		Hostname:  "mymachine",
+		AppName:   "su",
+		ProcId:    "1234",
+		Message:   "'su root' failed for lonvick on /dev/pts/8",
+	}, message)
+
+	// No hostname.
+	message, err = Parse([]byte("<13>Feb  5 17:32:18 sshd: Accepted publickey"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{
+		Priority:  13,
+		Timestamp: time.Date(2024, 2, 5, 17, 32, 18, 0, location),
+		AppName:   "sshd",
+		Message:   "Accepted publickey",
+	}, message)
+
+	// RFC 3339 timestamp and no tag.
+	message, err = Parse([]byte("<14>2024-05-31T10:00:00Z router1 link down on ge-0/0/1"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{
+		Priority:  14,
+		Timestamp: time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC),
+		Hostname:  "router1",
+		Message:   "link down on ge-0/0/1",
+	}, message)
+
+	// No timestamp, so everything after the PRI is the message.
+	message, err = Parse([]byte("<14>link down"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{Priority: 14, Message: "link down"}, message)
+
+	// No PRI.
+	message, err = Parse([]byte("hello world"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{Priority: defaultPriority, Message: "hello world"}, message)
+}
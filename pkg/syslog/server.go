@@ -0,0 +1,279 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/siglens/siglens/pkg/es/writer"
+	"github.com/siglens/siglens/pkg/usageStats"
+	"github.com/siglens/siglens/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Octet-counted frames larger than this are rejected so a bad length can't
+// make us buffer an arbitrary amount of data.
+const maxFrameSize = 1024 * 1024
+
+const maxDatagramSize = 65536
+
+// Holds the per-goroutine state needed to write events to an index.
+type ingester struct {
+	indexName               string
+	orgId                   uint64
+	localIndexMap           map[string]string
+	idxToStreamIdCache      map[string]string
+	cnameCacheByteHashToStr map[uint64]string
+	jsParsingStackbuf       [utils.UnescapeStackBufSize]byte
+}
+
+func newIngester(indexName string, orgId uint64) *ingester {
+	return &ingester{
+		indexName:               indexName,
+		orgId:                   orgId,
+		localIndexMap:           make(map[string]string),
+		idxToStreamIdCache:      make(map[string]string),
+		cnameCacheByteHashToStr: make(map[uint64]string),
+	}
+}
+
+// Listens on the address and ingests syslog messages sent over TCP until the
+// listener fails. Returns an error if the address can't be listened on.
+func RunTCPServer(addr string, indexName string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("RunTCPServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return ServeTCP(listener, indexName)
+}
+
+func ServeTCP(listener net.Listener, indexName string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Errorf("ServeTCP: failed to accept connection; err=%v", err)
+			continue
+		}
+
+		go handleTCPConnection(conn, indexName)
+	}
+}
+
+func handleTCPConnection(conn net.Conn, indexName string) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	ingester := newIngester(indexName, 0)
+	for {
+		frame, err := readFrame(reader)
+		if len(frame) > 0 {
+			ingester.ingest(frame)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Errorf("handleTCPConnection: closing connection from %v; err=%v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Reads one message using either of the RFC 6587 framings: octet counting,
+// where the message is prefixed with its length and a space, or
+// non-transparent framing, where messages are separated by newlines. Senders
+// may switch between them, so the framing is detected for each message.
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	// The length has at most 7 digits since frames are limited to 1MB.
+	header, err := reader.Peek(8)
+	if len(header) == 0 {
+		return nil, err
+	}
+
+	numDigits := 0
+	for numDigits < len(header) && header[numDigits] >= '0' && header[numDigits] <= '9' {
+		numDigits++
+	}
+
+	isOctetCounted := numDigits > 0 && numDigits < len(header) && header[0] != '0' && header[numDigits] == ' '
+	if !isOctetCounted {
+		return readLine(reader)
+	}
+
+	length, err := strconv.Atoi(string(header[:numDigits]))
+	if err != nil {
+		return nil, fmt.Errorf("readFrame: invalid frame length %v; err=%v", string(header[:numDigits]), err)
+	}
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("readFrame: frame of %v bytes is larger than the limit of %v bytes", length, maxFrameSize)
+	}
+
+	_, err = reader.Discard(numDigits + 1)
+	if err != nil {
+		return nil, fmt.Errorf("readFrame: failed to skip the frame length; err=%v", err)
+	}
+
+	frame := make([]byte, length)
+	_, err = io.ReadFull(reader, frame)
+	if err != nil {
+		return nil, fmt.Errorf("readFrame: failed to read frame of %v bytes; err=%v", length, err)
+	}
+
+	return frame, nil
+}
+
+// Reads up to the next newline. Lines longer than maxFrameSize are read to
+// the end but dropped, so a sender that never writes a newline can't make us
+// buffer an arbitrary amount of data.
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > maxFrameSize {
+			tooLong = true
+			line = nil
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if tooLong {
+			log.Warnf("readLine: dropping line longer than the limit of %v bytes", maxFrameSize)
+			return nil, err
+		}
+
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+}
+
+// Listens on the address and ingests each UDP datagram as one syslog message
+// until the connection fails. Returns an error if the address can't be
+// listened on.
+func RunUDPServer(addr string, indexName string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("RunUDPServer: failed to listen on %v; err=%v", addr, err)
+	}
+
+	return ServeUDP(conn, indexName)
+}
+
+func ServeUDP(conn net.PacketConn, indexName string) error {
+	defer conn.Close()
+
+	buf := make([]byte, maxDatagramSize)
+	ingester := newIngester(indexName, 0)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("ServeUDP: failed to read datagram; err=%v", err)
+		}
+
+		if n > 0 {
+			ingester.ingest(buf[:n])
+		}
+	}
+}
+
+// Messages that can't be parsed are still ingested, with the raw data as the
+// message, so nothing a device sends is lost.
+func (i *ingester) ingest(data []byte) {
+	now := time.Now()
+	message, err := Parse(data, now)
+	if err != nil {
+		log.Debugf("ingester.ingest: ingesting unparsable message as is; err=%v", err)
+		message = &Message{Priority: defaultPriority, Message: string(bytes.TrimRight(data, "\r\n\x00"))}
+	}
+
+	jsonData, err := messageToJson(message, now)
+	if err != nil {
+		log.Errorf("ingester.ingest: failed to convert message %v to JSON; err=%v", string(data), err)
+		return
+	}
+
+	err = writer.ProcessIndexRequest(jsonData, uint64(now.UnixMilli()), i.indexName, uint64(len(jsonData)), false,
+		i.localIndexMap, i.orgId, 0, i.idxToStreamIdCache, i.cnameCacheByteHashToStr, i.jsParsingStackbuf[:])
+	if err != nil {
+		log.Errorf("ingester.ingest: failed to process ingest request; err=%v. JSON Data: %s", err, string(jsonData))
+		return
+	}
+
+	usageStats.UpdateStats(uint64(len(data)), 1, i.orgId)
+}
+
+// Structured data params become columns named sd.<SD-ID>.<param>.
+func messageToJson(message *Message, now time.Time) ([]byte, error) {
+	result := map[string]interface{}{
+		"priority":       message.Priority,
+		"facility":       message.Facility(),
+		"facility_label": message.FacilityLabel(),
+		"severity":       message.Severity(),
+		"severity_label": message.SeverityLabel(),
+		"message":        message.Message,
+	}
+
+	timestamp := message.Timestamp
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	result[config.GetTimeStampKey()] = timestamp.UnixMilli()
+
+	if message.Version != 0 {
+		result["version"] = message.Version
+	}
+
+	optionalFields := map[string]string{
+		"hostname": message.Hostname,
+		"appname":  message.AppName,
+		"procid":   message.ProcId,
+		"msgid":    message.MsgId,
+	}
+	for key, value := range optionalFields {
+		if value != "" {
+			result[key] = value
+		}
+	}
+
+	for id, params := range message.StructuredData {
+		for name, value := range params {
+			result["sd."+id+"."+name] = value
+		}
+	}
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siglens/siglens/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadFrame(t *testing.T) {
+	input := "11 <13>1 - - a" + "<14>plain message\r\n" + "\n" + "3 abc" + "2024-05-31 starts with digits\n" + "12 <13>x\nno newline"
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	var frames []string
+	for {
+		frame, err := readFrame(reader)
+		if len(frame) > 0 {
+			frames = append(frames, string(frame))
+		}
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"<13>1 - - a", "<14>plain message", "abc", "2024-05-31 starts with digits", "<13>x\nno new", "line"}, frames)
+}
+
+func Test_ReadFrame_TooLarge(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("9999999 <13>x"))
+	_, err := readFrame(reader)
+	assert.Error(t, err)
+}
+
+func Test_ReadFrame_LongLine(t *testing.T) {
+	input := strings.Repeat("a", maxFrameSize+10) + "\n" + "<14>next message\n" + strings.Repeat("b", maxFrameSize+10)
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	frame, err := readFrame(reader)
+	assert.NoError(t, err)
+	assert.Empty(t, frame)
+
+	frame, err = readFrame(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "<14>next message", string(frame))
+
+	frame, err = readFrame(reader)
+	assert.Equal(t, io.EOF, err)
+	assert.Empty(t, frame)
+}
+
+func Test_MessageToJson(t *testing.T) {
+	config.InitializeTestingConfig(t.TempDir() + "/")
+
+	message := &Message{
+		Priority:       165,
+		Version:        1,
+		Timestamp:      time.UnixMilli(1_700_000_000_123),
+		Hostname:       "host1",
+		AppName:        "app",
+		StructuredData: map[string]map[string]string{"origin": {"ip": "10.0.0.1"}},
+		Message:        "hello",
+	}
+
+	jsonData, err := messageToJson(message, time.Now())
+	assert.NoError(t, err)
+
+	var result map[string]interface{}
+	err = json.Unmarshal(jsonData, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		config.GetTimeStampKey(): float64(1_700_000_000_123),
+		"priority":               float64(165),
+		"facility":               float64(20),
+		"facility_label":         "local4",
+		"severity":               float64(5),
+		"severity_label":         "notice",
+		"version":                float64(1),
+		"hostname":               "host1",
+		"appname":                "app",
+		"sd.origin.ip":           "10.0.0.1",
+		"message":                "hello",
+	}, result)
+}
@@ -20,6 +20,7 @@ package utils
 import (
 	"encoding/base64"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/siglens/siglens/pkg/common/dtypeutils"
@@ -77,3 +78,65 @@ func DecodeFromBase64(s string) (string, error) {
 
 	return string(data), nil
 }
+
+// Parses a logfmt line like `level=info msg="request done" retry` into its
+// key-value pairs. A key without a value maps to an empty string. Parsing
+// stops at the first malformed pair, so the pairs before it are still
+// returned.
+func ParseLogfmt(line string) map[string]string {
+	pairs := make(map[string]string)
+
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+
+		keyStart := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '"' {
+			i++
+		}
+		key := line[keyStart:i]
+		if key == "" {
+			return pairs
+		}
+		if i == len(line) || line[i] != '=' {
+			pairs[key] = ""
+			continue
+		}
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			valueStart := i
+			i++
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(line) {
+				return pairs
+			}
+			i++
+
+			value, err := strconv.Unquote(line[valueStart:i])
+			if err != nil {
+				return pairs
+			}
+			pairs[key] = value
+			continue
+		}
+
+		valueStart := i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		pairs[key] = line[valueStart:i]
+	}
+
+	return pairs
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2021-2024 SigScalr, Inc.
+//
+// This file is part of SigLens Observability Solution
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLogfmt(t *testing.T) {
+	pairs := ParseLogfmt(`level=info msg="request \"done\"" duration=12ms retry`)
+	assert.Equal(t, map[string]string{
+		"level":    "info",
+		"msg":      `request "done"`,
+		"duration": "12ms",
+		"retry":    "",
+	}, pairs)
+
+	pairs = ParseLogfmt(`  a=1   b=  c="x y"`)
+	assert.Equal(t, map[string]string{"a": "1", "b": "", "c": "x y"}, pairs)
+
+	// The pairs before a malformed one are kept
+	pairs = ParseLogfmt(`a=1 b="unterminated`)
+	assert.Equal(t, map[string]string{"a": "1"}, pairs)
+
+	assert.Empty(t, ParseLogfmt(""))
+	assert.Empty(t, ParseLogfmt(`"quoted key"=1`))
+}